@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var cacheCommands = map[string]command{
+	"flush": {"Vacía los cachés en memoria del servidor en ejecución", runCacheFlush},
+}
+
+func runCache(args []string) int {
+	return dispatch("cli cache", cacheCommands, args)
+}
+
+// runCacheFlush: cli cache flush [--names a,b] [--url BASE]
+// Los cachés viven en el proceso del servidor, así que se vacían vía POST /api/admin/cache/flush
+func runCacheFlush(args []string) int {
+	fs, jsonOut := newFlagSet("cache flush")
+	baseURL := fs.String("url", apiBaseURL(), "URL base de la API (default: BASE_URL)")
+	names := fs.String("names", "", "Cachés a vaciar separados por coma (default: todos)")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout de la solicitud")
+	out, code, ok := parseFlags(fs, jsonOut, args)
+	if !ok {
+		return code
+	}
+
+	token := strings.TrimSpace(os.Getenv("ADMIN_TOKEN"))
+	if token == "" {
+		return out.fail(exitUsage, errors.New("ADMIN_TOKEN no definido"), nil)
+	}
+
+	endpoint := strings.TrimRight(*baseURL, "/") + "/api/admin/cache/flush"
+	if n := strings.TrimSpace(*names); n != "" {
+		endpoint += "?names=" + url.QueryEscape(n)
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, nil)
+	if err != nil {
+		return out.fail(exitUsage, err, nil)
+	}
+	req.Header.Set("X-Admin-Token", token)
+
+	resp, err := (&http.Client{Timeout: *timeout}).Do(req)
+	if err != nil {
+		return out.fail(exitUnavailable, err, nil)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Flushed   []string `json:"flushed"`
+		Error     string   `json:"error"`
+		Available []string `json:"available"`
+	}
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body)
+
+	if resp.StatusCode != http.StatusOK {
+		if body.Error == "" {
+			body.Error = resp.Status
+		}
+		code := exitError
+		if resp.StatusCode == http.StatusNotFound {
+			code = exitUsage
+		} else if resp.StatusCode >= 500 {
+			code = exitUnavailable
+		}
+		var extra map[string]interface{}
+		if len(body.Available) > 0 {
+			extra = map[string]interface{}{"available": body.Available}
+		}
+		return out.fail(code, fmt.Errorf("cache flush: %s", body.Error), extra)
+	}
+
+	out.result(map[string]interface{}{"ok": true, "flushed": body.Flushed}, func(w io.Writer) {
+		fmt.Fprintf(w, "Cachés vaciados: %s\n", strings.Join(body.Flushed, ", "))
+	})
+	return exitOK
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	appdb "github.com/yourorg/wayfindcl/internal/db"
+)
+
+// connectDB conecta a la base de datos sin tocar el esquema
+func connectDB(out *output) (*sql.DB, int, bool) {
+	db, err := appdb.Connect()
+	if err != nil {
+		return nil, out.fail(exitUnavailable, fmt.Errorf("db connect: %w", err), nil), false
+	}
+	return db, exitOK, true
+}
+
+// openDB conecta a la base de datos y aplica las migraciones pendientes
+func openDB(out *output) (*sql.DB, int, bool) {
+	db, code, ok := connectDB(out)
+	if !ok {
+		return nil, code, false
+	}
+	if err := appdb.EnsureSchema(db); err != nil {
+		db.Close()
+		return nil, out.fail(migrateExitCode(err), fmt.Errorf("ensure schema: %w", err), nil), false
+	}
+	return db, exitOK, true
+}
+
+func migrateExitCode(err error) int {
+	switch {
+	case errors.Is(err, appdb.ErrMigrationLocked):
+		return exitUnavailable
+	case errors.Is(err, appdb.ErrUnknownVersion):
+		return exitNotFound
+	default:
+		return exitError
+	}
+}
+
+var dbCommands = map[string]command{
+	"status":  {"Estado de cada migración", runDBStatus},
+	"up":      {"Aplica las migraciones pendientes", runDBUp},
+	"down":    {"Revierte las últimas migraciones (--steps N, default 1)", runDBDown},
+	"to":      {"Sube o baja el esquema hasta una versión (--version N, 0 = vacío)", runDBTo},
+	"migrate": {"Alias de \"db up\"", runDBUp},
+}
+
+func runDB(args []string) int {
+	return dispatch("cli db", dbCommands, args)
+}
+
+// runDBStatus: cli db status
+func runDBStatus(args []string) int {
+	fs, jsonOut := newFlagSet("db status")
+	out, code, ok := parseFlags(fs, jsonOut, args)
+	if !ok {
+		return code
+	}
+
+	db, code, ok := connectDB(out)
+	if !ok {
+		return code
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	states, err := appdb.MigrationStatus(ctx, db)
+	if err != nil {
+		return out.fail(exitError, err, nil)
+	}
+	latest, err := appdb.LatestVersion()
+	if err != nil {
+		return out.fail(exitError, err, nil)
+	}
+	var current int64
+	pending := 0
+	for _, s := range states {
+		if s.Applied && s.Version > current {
+			current = s.Version
+		}
+		if !s.Applied {
+			pending++
+		}
+	}
+
+	doc := map[string]interface{}{
+		"current_version": current,
+		"latest_version":  latest,
+		"pending":         pending,
+		"migrations":      states,
+	}
+	out.result(doc, func(w io.Writer) {
+		fmt.Fprintf(w, "Versión actual: %d (última embebida: %d, pendientes: %d)\n", current, latest, pending)
+		fmt.Fprintf(w, "%-8s %-32s %-20s %s\n", "VERSIÓN", "NOMBRE", "APLICADA", "NOTA")
+		for _, s := range states {
+			applied := "pendiente"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04")
+			}
+			var notes []string
+			if s.Modified {
+				notes = append(notes, "modificada después de aplicarse")
+			}
+			if s.Missing {
+				notes = append(notes, "desconocida para este binario")
+			}
+			fmt.Fprintf(w, "%-8d %-32s %-20s %s\n", s.Version, s.Name, applied, strings.Join(notes, "; "))
+		}
+	})
+	return exitOK
+}
+
+// runDBUp: cli db up
+func runDBUp(args []string) int {
+	fs, jsonOut := newFlagSet("db up")
+	timeout := fs.Duration("timeout", 10*time.Minute, "Tiempo máximo de la migración")
+	out, code, ok := parseFlags(fs, jsonOut, args)
+	if !ok {
+		return code
+	}
+	return migrate(out, *timeout, func(ctx context.Context, db *sql.DB) (*appdb.MigrationResult, error) {
+		return appdb.MigrateUp(ctx, db)
+	})
+}
+
+// runDBDown: cli db down [--steps N]
+func runDBDown(args []string) int {
+	fs, jsonOut := newFlagSet("db down")
+	steps := fs.Int("steps", 1, "Cantidad de migraciones a revertir")
+	timeout := fs.Duration("timeout", 10*time.Minute, "Tiempo máximo de la migración")
+	out, code, ok := parseFlags(fs, jsonOut, args)
+	if !ok {
+		return code
+	}
+	if *steps <= 0 {
+		return out.usageError(fs, "--steps debe ser mayor que 0")
+	}
+	return migrate(out, *timeout, func(ctx context.Context, db *sql.DB) (*appdb.MigrationResult, error) {
+		return appdb.MigrateDown(ctx, db, *steps)
+	})
+}
+
+// runDBTo: cli db to --version N
+func runDBTo(args []string) int {
+	fs, jsonOut := newFlagSet("db to")
+	version := fs.Int64("version", -1, "Versión destino (0 revierte todas las migraciones)")
+	timeout := fs.Duration("timeout", 10*time.Minute, "Tiempo máximo de la migración")
+	out, code, ok := parseFlags(fs, jsonOut, args)
+	if !ok {
+		return code
+	}
+	if *version < 0 {
+		return out.usageError(fs, "--version es obligatorio")
+	}
+	return migrate(out, *timeout, func(ctx context.Context, db *sql.DB) (*appdb.MigrationResult, error) {
+		return appdb.MigrateTo(ctx, db, *version)
+	})
+}
+
+func migrate(out *output, timeout time.Duration, run func(context.Context, *sql.DB) (*appdb.MigrationResult, error)) int {
+	db, code, ok := connectDB(out)
+	if !ok {
+		return code
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := run(ctx, db)
+	if err != nil {
+		var extra map[string]interface{}
+		if result != nil {
+			extra = map[string]interface{}{"applied": result.Applied, "reverted": result.Reverted}
+		}
+		return out.fail(migrateExitCode(err), err, extra)
+	}
+
+	out.result(result, func(w io.Writer) {
+		if len(result.Applied) == 0 && len(result.Reverted) == 0 {
+			fmt.Fprintf(w, "Esquema ya en la versión %d\n", result.To)
+			return
+		}
+		for _, v := range result.Applied {
+			fmt.Fprintf(w, "⬆️  %04d aplicada\n", v)
+		}
+		for _, v := range result.Reverted {
+			fmt.Fprintf(w, "⬇️  %04d revertida\n", v)
+		}
+		fmt.Fprintf(w, "Esquema en la versión %d\n", result.To)
+	})
+	return exitOK
+}
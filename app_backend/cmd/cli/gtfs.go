@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yourorg/wayfindcl/internal/gtfs"
+)
+
+const defaultGTFSFeedURL = "https://www.dtpm.cl/descarga.php?file=gtfs/gtfs.zip"
+
+var gtfsCommands = map[string]command{
+	"sync":        {"Descarga (o lee de un zip local) e importa el feed GTFS", runGTFSSync},
+	"status":      {"Generación activa, último sync y reporte de validación", runGTFSStatus},
+	"generations": {"Lista las generaciones GTFS", runGTFSGenerations},
+	"activate":    {"Activa una generación existente (--feed N)", runGTFSActivate},
+	"rollback":    {"Vuelve a la generación retirada más reciente", runGTFSRollback},
+}
+
+func runGTFS(args []string) int {
+	return dispatch("cli gtfs", gtfsCommands, args)
+}
+
+// maxValidationErrorsFromEnv lee GTFS_MAX_VALIDATION_ERRORS (mismo default que el servidor)
+func maxValidationErrorsFromEnv() int {
+	if v := strings.TrimSpace(os.Getenv("GTFS_MAX_VALIDATION_ERRORS")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return gtfs.DefaultMaxValidationErrors
+}
+
+// runGTFSSync: cli gtfs sync [--url URL | --file feed.zip] [--max-errors N] [--timeout 10m]
+func runGTFSSync(args []string) int {
+	fs, jsonOut := newFlagSet("gtfs sync")
+	feedURL := fs.String("url", "", "URL del feed (default: GTFS_FEED_URL con GTFS_FALLBACK_URL)")
+	file := fs.String("file", "", "Zip GTFS local a importar en vez de descargar")
+	maxErrors := fs.Int("max-errors", maxValidationErrorsFromEnv(), "Errores de validación tolerados (-1 = sin límite)")
+	timeout := fs.Duration("timeout", 10*time.Minute, "Tiempo máximo de la sincronización")
+	out, code, ok := parseFlags(fs, jsonOut, args)
+	if !ok {
+		return code
+	}
+	if *feedURL != "" && *file != "" {
+		return out.usageError(fs, "--url y --file son excluyentes")
+	}
+
+	var data []byte
+	var source string
+	if *file != "" {
+		abs, err := filepath.Abs(*file)
+		if err != nil {
+			return out.fail(exitUsage, err, nil)
+		}
+		data, err = os.ReadFile(abs)
+		if err != nil {
+			return out.fail(exitUsage, fmt.Errorf("gtfs sync: %w", err), nil)
+		}
+		source = "file://" + filepath.ToSlash(abs)
+	}
+
+	db, code, ok := openDB(out)
+	if !ok {
+		return code
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var summary *gtfs.Summary
+	var err error
+	if data != nil {
+		summary, err = gtfs.Import(ctx, db, data, source, gtfs.ImportOptions{MaxValidationErrors: *maxErrors})
+	} else {
+		url, fallback := *feedURL, ""
+		if url == "" {
+			url = strings.TrimSpace(os.Getenv("GTFS_FEED_URL"))
+			if url == "" {
+				url = defaultGTFSFeedURL
+				fmt.Fprintln(os.Stderr, "GTFS_FEED_URL no definido, usando feed por defecto de DTPM.")
+			}
+			fallback = strings.TrimSpace(os.Getenv("GTFS_FALLBACK_URL"))
+			if fallback == "" {
+				fallback = defaultGTFSFeedURL
+			}
+		}
+		loader := gtfs.NewLoader(url, fallback, nil)
+		loader.SetMaxValidationErrors(*maxErrors)
+		summary, err = loader.Sync(ctx, db)
+	}
+
+	if err != nil {
+		var verr *gtfs.ValidationError
+		if errors.As(err, &verr) {
+			if !out.json {
+				fmt.Fprintln(os.Stderr, "GTFS sync: feed rechazado por el validador")
+				printValidationReport(os.Stderr, verr.Report)
+			}
+			return out.fail(exitRejected, err, map[string]interface{}{"validation": verr.Report})
+		}
+		return out.fail(exitError, fmt.Errorf("gtfs sync: %w", err), nil)
+	}
+
+	out.result(summary, func(w io.Writer) {
+		if summary.Validation != nil {
+			printValidationReport(w, summary.Validation)
+		}
+		if summary.Skipped {
+			fmt.Fprintf(w, "GTFS sin cambios (feed %d, versión %s), sincronización omitida\n", summary.FeedID, summary.FeedVersion)
+			return
+		}
+		fmt.Fprintf(w, "GTFS sync OK: feed %d, archivos cambiados: %s\n", summary.FeedID, strings.Join(summary.ChangedFiles, ", "))
+		fmt.Fprintf(w, "  paradas +%d ~%d -%d | rutas +%d ~%d -%d | viajes +%d ~%d -%d\n",
+			summary.Changes.Stops.AddedCount, summary.Changes.Stops.ModifiedCount, summary.Changes.Stops.RemovedCount,
+			summary.Changes.Routes.AddedCount, summary.Changes.Routes.ModifiedCount, summary.Changes.Routes.RemovedCount,
+			summary.Changes.Trips.AddedCount, summary.Changes.Trips.ModifiedCount, summary.Changes.Trips.RemovedCount)
+		fmt.Fprintf(w, "  paradas escritas=%d (versión %s) [%s]\n", summary.StopsImported, summary.FeedVersion, summary.DownloadedAt.Format(time.RFC3339))
+		fmt.Fprintf(w, "  rutas=%d viajes=%d horarios=%d calendarios=%d excepciones=%d shapes=%d frecuencias=%d transbordos=%d\n",
+			summary.RoutesImported, summary.TripsImported, summary.StopTimesImported,
+			summary.CalendarsImported, summary.CalendarDatesImported, summary.ShapePointsImported,
+			summary.FrequenciesImported, summary.TransfersImported)
+	})
+	return exitOK
+}
+
+func printValidationReport(w io.Writer, report *gtfs.ValidationReport) {
+	fmt.Fprintf(w, "Validación: %d errores, %d advertencias (válido: %t)\n", report.ErrorCount, report.WarningCount, report.Valid)
+	codes := make([]string, 0, len(report.Counts))
+	for code := range report.Counts {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "  %-26s %d\n", code, report.Counts[code])
+	}
+	for i, issue := range report.Issues {
+		if i >= 20 {
+			fmt.Fprintf(w, "  ... %d hallazgos más en el reporte guardado\n", len(report.Issues)-i)
+			break
+		}
+		fmt.Fprintf(w, "  [%s] %s:%d %s %s\n", issue.Severity, issue.File, issue.Line, issue.EntityID, issue.Message)
+	}
+}
+
+type gtfsStatus struct {
+	ActiveFeedID int64                  `json:"active_feed_id"`
+	Active       *gtfs.Generation       `json:"active,omitempty"`
+	Latest       *gtfs.Generation       `json:"latest,omitempty"`
+	Validation   *gtfs.ValidationReport `json:"validation,omitempty"`
+	Generations  int                    `json:"generations"`
+}
+
+// runGTFSStatus: cli gtfs status
+func runGTFSStatus(args []string) int {
+	fs, jsonOut := newFlagSet("gtfs status")
+	out, code, ok := parseFlags(fs, jsonOut, args)
+	if !ok {
+		return code
+	}
+
+	db, code, ok := openDB(out)
+	if !ok {
+		return code
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	generations, err := gtfs.ListGenerations(ctx, db)
+	if err != nil {
+		return out.fail(exitError, err, nil)
+	}
+	status := gtfsStatus{Generations: len(generations)}
+	for i := range generations {
+		g := &generations[i]
+		if status.Latest == nil {
+			status.Latest = g
+		}
+		if g.Status == gtfs.GenerationActive && status.Active == nil {
+			status.Active = g
+			status.ActiveFeedID = g.FeedID
+		}
+	}
+	if status.ActiveFeedID != 0 {
+		status.Validation, err = gtfs.LoadValidationReport(ctx, db, status.ActiveFeedID)
+	} else {
+		status.Validation, err = gtfs.LatestValidationReport(ctx, db)
+	}
+	if err != nil {
+		return out.fail(exitError, err, nil)
+	}
+
+	out.result(status, func(w io.Writer) {
+		if status.Active == nil {
+			fmt.Fprintln(w, "Sin generación GTFS activa")
+		} else {
+			fmt.Fprintf(w, "Generación activa: %d (versión %s, activada %s)\n", status.Active.FeedID, status.Active.FeedVersion, formatTime(status.Active.ActivatedAt))
+			fmt.Fprintf(w, "  origen: %s\n", status.Active.SourceURL)
+		}
+		if status.Latest != nil && status.Latest != status.Active {
+			fmt.Fprintf(w, "Última generación: %d (%s, creada %s)\n", status.Latest.FeedID, status.Latest.Status, status.Latest.CreatedAt.Format("2006-01-02 15:04"))
+			if status.Latest.ErrorMessage != "" {
+				fmt.Fprintf(w, "  error: %s\n", status.Latest.ErrorMessage)
+			}
+		}
+		fmt.Fprintf(w, "Generaciones registradas: %d\n", status.Generations)
+		if status.Validation != nil {
+			printValidationReport(w, status.Validation)
+		}
+	})
+	return exitOK
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+// runGTFSGenerations: cli gtfs generations
+func runGTFSGenerations(args []string) int {
+	fs, jsonOut := newFlagSet("gtfs generations")
+	out, code, ok := parseFlags(fs, jsonOut, args)
+	if !ok {
+		return code
+	}
+
+	db, code, ok := openDB(out)
+	if !ok {
+		return code
+	}
+	defer db.Close()
+
+	generations, err := gtfs.ListGenerations(context.Background(), db)
+	if err != nil {
+		return out.fail(exitError, err, nil)
+	}
+	if generations == nil {
+		generations = []gtfs.Generation{}
+	}
+
+	out.result(generations, func(w io.Writer) {
+		if len(generations) == 0 {
+			fmt.Fprintln(w, "No hay generaciones GTFS registradas")
+			return
+		}
+		fmt.Fprintf(w, "%-8s %-10s %-20s %-20s %s\n", "FEED", "ESTADO", "CREADA", "ACTIVADA", "VERSIÓN")
+		for _, g := range generations {
+			fmt.Fprintf(w, "%-8d %-10s %-20s %-20s %s\n", g.FeedID, g.Status, g.CreatedAt.Format("2006-01-02 15:04"), formatTime(g.ActivatedAt), g.FeedVersion)
+			if g.ErrorMessage != "" {
+				fmt.Fprintf(w, "         error: %s\n", g.ErrorMessage)
+			}
+		}
+	})
+	return exitOK
+}
+
+// runGTFSActivate: cli gtfs activate --feed N
+func runGTFSActivate(args []string) int {
+	fs, jsonOut := newFlagSet("gtfs activate")
+	feedID := fs.Int64("feed", 0, "Feed ID de la generación a activar")
+	out, code, ok := parseFlags(fs, jsonOut, args)
+	if !ok {
+		return code
+	}
+	if *feedID <= 0 {
+		return out.usageError(fs, "--feed es obligatorio")
+	}
+
+	db, code, ok := openDB(out)
+	if !ok {
+		return code
+	}
+	defer db.Close()
+
+	if err := gtfs.Activate(context.Background(), db, *feedID); err != nil {
+		if errors.Is(err, gtfs.ErrGenerationNotFound) {
+			return out.fail(exitNotFound, err, nil)
+		}
+		return out.fail(exitError, fmt.Errorf("gtfs activate: %w", err), nil)
+	}
+
+	out.result(map[string]interface{}{"ok": true, "active_feed_id": *feedID}, func(w io.Writer) {
+		fmt.Fprintf(w, "Generación %d activa\n", *feedID)
+	})
+	return exitOK
+}
+
+// runGTFSRollback: cli gtfs rollback
+func runGTFSRollback(args []string) int {
+	fs, jsonOut := newFlagSet("gtfs rollback")
+	out, code, ok := parseFlags(fs, jsonOut, args)
+	if !ok {
+		return code
+	}
+
+	db, code, ok := openDB(out)
+	if !ok {
+		return code
+	}
+	defer db.Close()
+
+	feedID, err := gtfs.Rollback(context.Background(), db)
+	if err != nil {
+		return out.fail(exitError, fmt.Errorf("gtfs rollback: %w", err), nil)
+	}
+
+	out.result(map[string]interface{}{"ok": true, "active_feed_id": feedID}, func(w io.Writer) {
+		fmt.Fprintf(w, "Rollback completado: generación %d activa\n", feedID)
+	})
+	return exitOK
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// apiBaseURL retorna BASE_URL o el servidor local por defecto
+func apiBaseURL() string {
+	base := os.Getenv("BASE_URL")
+	if base == "" {
+		base = "http://127.0.0.1:8080"
+	}
+	return strings.TrimRight(base, "/")
+}
+
+type healthResult struct {
+	OK         bool            `json:"ok"`
+	URL        string          `json:"url"`
+	StatusCode int             `json:"status_code,omitempty"`
+	Status     string          `json:"status,omitempty"`
+	LatencyMS  int64           `json:"latency_ms"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// runHealth: cli health [--url BASE] [--timeout 5s]
+func runHealth(args []string) int {
+	fs, jsonOut := newFlagSet("health")
+	baseURL := fs.String("url", apiBaseURL(), "URL base de la API (default: BASE_URL)")
+	timeout := fs.Duration("timeout", 5*time.Second, "Timeout de la solicitud")
+	out, code, ok := parseFlags(fs, jsonOut, args)
+	if !ok {
+		return code
+	}
+
+	res := healthResult{URL: strings.TrimRight(*baseURL, "/") + "/api/health"}
+	client := &http.Client{Timeout: *timeout}
+	start := time.Now()
+	resp, err := client.Get(res.URL)
+	res.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		defer resp.Body.Close()
+		res.StatusCode = resp.StatusCode
+		res.Status = resp.Status
+		res.OK = resp.StatusCode >= 200 && resp.StatusCode < 300
+		if body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024)); err == nil && json.Valid(body) {
+			res.Body = body
+		}
+	}
+
+	out.result(res, func(w io.Writer) {
+		if res.Error != "" {
+			fmt.Fprintln(w, "Health: ERROR:", res.Error)
+			return
+		}
+		fmt.Fprintf(w, "Health status: %s (%d ms)\n", res.Status, res.LatencyMS)
+	})
+	if !res.OK {
+		return exitUnavailable
+	}
+	return exitOK
+}
@@ -1,138 +1,155 @@
+// ============================================================================
+// WayFindCL CLI - tareas de operación para cron, scripts y contenedores
+// ============================================================================
+// Uso: cli <comando> [subcomando] [flags]
+// Todos los comandos aceptan --json (resultado en stdout, logs en stderr) y
+// terminan con un exit code significativo (ver exit*).
+// ============================================================================
+
 package main
 
 import (
-	"bufio"
-	"context"
-	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
-	"net/http"
+	"io"
 	"os"
+	"sort"
 	"strings"
-	"time"
 
-	appdb "github.com/yourorg/wayfindcl/internal/db"
-	"github.com/yourorg/wayfindcl/internal/gtfs"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/joho/godotenv"
+)
+
+// Exit codes
+const (
+	exitOK          = 0
+	exitError       = 1 // Error de ejecución
+	exitUsage       = 2 // Comando o flags inválidos
+	exitUnavailable = 3 // API o base de datos inalcanzable / no saludable
+	exitRejected    = 4 // Feed GTFS rechazado por el validador
+	exitConflict    = 5 // El recurso ya existe (ej: usuario duplicado)
+	exitNotFound    = 6 // Usuario o generación inexistente
 )
 
+// command es un comando o subcomando del CLI
+type command struct {
+	summary string
+	run     func(args []string) int
+}
+
+var commands = map[string]command{
+	"health": {"Verifica GET /api/health del servidor", runHealth},
+	"seed":   {"Crea el usuario de ejemplo (demo/demo1234)", runSeed},
+	"gtfs":   {"Sincronización y generaciones del feed GTFS", runGTFS},
+	"users":  {"Administración de usuarios", runUsers},
+	"cache":  {"Cachés en memoria del servidor", runCache},
+	"db":     {"Esquema de la base de datos", runDB},
+}
+
 func main() {
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		fmt.Println("==== WayFindCL CLI ====")
-		fmt.Println("1) Health check API")
-		fmt.Println("2) Seed database (create sample user)")
-		fmt.Println("3) Sync GTFS feed")
-		fmt.Println("4) Exit")
-		fmt.Print("Select option: ")
-		choice, _ := reader.ReadString('\n')
-		choice = strings.TrimSpace(choice)
-		switch choice {
-		case "1":
-			doHealthCheck()
-		case "2":
-			doSeed()
-		case "3":
-			doSyncGTFS()
-		case "4":
-			fmt.Println("Bye")
-			return
-		default:
-			fmt.Println("Invalid option")
-		}
-		fmt.Println()
-	}
+	_ = godotenv.Load()
+	os.Exit(dispatch("cli", commands, os.Args[1:]))
 }
 
-func doHealthCheck() {
-	base := os.Getenv("BASE_URL")
-	if base == "" {
-		base = "http://127.0.0.1:8080"
+// dispatch ejecuta el comando nombrado en args[0]
+func dispatch(prefix string, cmds map[string]command, args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		printUsage(os.Stderr, prefix, cmds)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
 	}
-	url := strings.TrimRight(base, "/") + "/api/health"
-	resp, err := http.Get(url)
-	if err != nil {
-		fmt.Println("Health: ERROR:", err)
-		return
+	cmd, ok := cmds[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "%s: comando desconocido %q\n\n", prefix, args[0])
+		printUsage(os.Stderr, prefix, cmds)
+		return exitUsage
 	}
-	defer resp.Body.Close()
-	fmt.Println("Health status:", resp.Status)
+	return cmd.run(args[1:])
 }
 
-func doSeed() {
-	db, err := appdb.Connect()
-	if err != nil {
-		log.Println("DB connect error:", err)
-		return
+func printUsage(w io.Writer, prefix string, cmds map[string]command) {
+	names := make([]string, 0, len(cmds))
+	for name := range cmds {
+		names = append(names, name)
 	}
-	if err := appdb.EnsureSchema(db); err != nil {
-		log.Println("Ensure schema error:", err)
-		return
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "Uso: %s <comando> [flags]\n\nComandos:\n", prefix)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-12s %s\n", name, cmds[name].summary)
 	}
-	seedUser(db)
+	fmt.Fprintf(w, "\nUse \"%s <comando> -h\" para ver los flags. Todos aceptan --json.\n", prefix)
 }
 
-func doSyncGTFS() {
-	feedURL := strings.TrimSpace(os.Getenv("GTFS_FEED_URL"))
-	if feedURL == "" {
-		feedURL = "https://www.dtpm.cl/descarga.php?file=gtfs/gtfs.zip"
-		fmt.Println("GTFS_FEED_URL no definido, usando feed por defecto de DTPM.")
-	}
-	fallbackURL := strings.TrimSpace(os.Getenv("GTFS_FALLBACK_URL"))
-	if fallbackURL == "" {
-		fallbackURL = "https://www.dtpm.cl/descarga.php?file=gtfs/gtfs.zip"
-	}
-	loader := gtfs.NewLoader(feedURL, fallbackURL, nil)
+// output escribe el resultado de un comando como texto o como JSON
+type output struct {
+	json   bool
+	stdout io.Writer
+}
 
-	db, err := appdb.Connect()
-	if err != nil {
-		log.Println("GTFS sync: db connect error:", err)
-		return
+// newFlagSet crea el FlagSet de un comando con el flag --json común
+func newFlagSet(name string) (*flag.FlagSet, *bool) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	jsonOut := fs.Bool("json", false, "Resultado en JSON por stdout")
+	return fs, jsonOut
+}
+
+// parseFlags parsea args y prepara la salida. Retorna el exit code si hay que terminar.
+func parseFlags(fs *flag.FlagSet, jsonOut *bool, args []string) (*output, int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, exitOK, false
+		}
+		return nil, exitUsage, false
 	}
-	defer db.Close()
-	if err := appdb.EnsureSchema(db); err != nil {
-		log.Println("GTFS sync: ensure schema error:", err)
-		return
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "%s: argumentos inesperados: %s\n", fs.Name(), strings.Join(fs.Args(), " "))
+		return nil, exitUsage, false
 	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-	defer cancel()
-
-	summary, err := loader.Sync(ctx, db)
-	if err != nil {
-		log.Println("GTFS sync: error:", err)
-		return
+	out := &output{json: *jsonOut, stdout: os.Stdout}
+	if out.json {
+		// El loader GTFS y otros paquetes imprimen progreso en stdout: desviarlo a stderr
+		// para que stdout contenga sólo el documento JSON
+		os.Stdout = os.Stderr
 	}
-	fmt.Printf("GTFS sync OK: %d paradas (versión %s) [%s]\n", summary.StopsImported, summary.FeedVersion, summary.DownloadedAt.Format(time.RFC3339))
+	return out, exitOK, true
 }
 
-func seedUser(db *sql.DB) {
-	// Creates a sample user if not exists
-	username := "demo"
-	email := "demo@example.com"
-	name := "Demo"
-	password := "demo1234"
-	var exists int
-	_ = db.QueryRow("SELECT 1 FROM users WHERE username = ?", username).Scan(&exists)
-	if exists == 1 {
-		fmt.Println("Seed: user 'demo' already exists")
-		return
-	}
-	// Store bcrypt hash using the same logic as handler (quick inline)
-	hash, err := bcryptHash(password)
-	if err != nil {
-		fmt.Println("Seed: bcrypt error:", err)
+// result imprime v como JSON o ejecuta text para la salida legible
+func (o *output) result(v interface{}, text func(w io.Writer)) {
+	if o.json {
+		enc := json.NewEncoder(o.stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(v)
 		return
 	}
-	_, err = db.Exec("INSERT INTO users (username,email,name,password_hash) VALUES (?,?,?,?)", username, email, name, hash)
-	if err != nil {
-		fmt.Println("Seed: insert error:", err)
-		return
+	text(o.stdout)
+}
+
+// fail reporta un error y retorna su exit code. extra se agrega al documento JSON.
+func (o *output) fail(code int, err error, extra map[string]interface{}) int {
+	if o.json {
+		doc := map[string]interface{}{"ok": false, "error": err.Error(), "exit_code": code}
+		for k, v := range extra {
+			doc[k] = v
+		}
+		o.result(doc, nil)
+		return code
 	}
-	fmt.Println("Seed: created user 'demo' with password 'demo1234'")
+	fmt.Fprintln(os.Stderr, "error:", err)
+	return code
 }
 
-func bcryptHash(pw string) (string, error) {
-	b, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
-	return string(b), err
+// usageError reporta flags inválidos
+func (o *output) usageError(fs *flag.FlagSet, msg string) int {
+	if !o.json {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", fs.Name(), msg)
+		fs.Usage()
+		return exitUsage
+	}
+	return o.fail(exitUsage, errors.New(msg), nil)
 }
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yourorg/wayfindcl/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var usersCommands = map[string]command{
+	"list":    {"Lista usuarios (--search, --disabled, --limit)", runUsersList},
+	"create":  {"Crea un usuario con password", runUsersCreate},
+	"disable": {"Deshabilita un usuario y revoca sus sesiones", runUsersDisable},
+	"enable":  {"Rehabilita un usuario deshabilitado", runUsersEnable},
+	"role":    {"Asigna el rol de un usuario (user, moderator, admin)", runUsersRole},
+}
+
+func runUsers(args []string) int {
+	return dispatch("cli users", usersCommands, args)
+}
+
+type userRow struct {
+	ID         int64      `json:"id"`
+	Username   string     `json:"username"`
+	Email      string     `json:"email,omitempty"`
+	Name       string     `json:"name"`
+	Role       string     `json:"role"`
+	CreatedAt  time.Time  `json:"created_at"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+}
+
+// runUsersList: cli users list [--search texto] [--role admin] [--disabled] [--limit 50]
+func runUsersList(args []string) int {
+	fs, jsonOut := newFlagSet("users list")
+	search := fs.String("search", "", "Filtra por username, email o nombre")
+	role := fs.String("role", "", "Sólo usuarios con este rol")
+	onlyDisabled := fs.Bool("disabled", false, "Sólo usuarios deshabilitados")
+	limit := fs.Int("limit", 50, "Máximo de usuarios")
+	out, code, ok := parseFlags(fs, jsonOut, args)
+	if !ok {
+		return code
+	}
+	if *limit <= 0 {
+		return out.usageError(fs, "--limit debe ser mayor que 0")
+	}
+	if *role != "" {
+		parsed, ok := models.ParseRole(*role)
+		if !ok {
+			return out.usageError(fs, "--role debe ser user, moderator o admin")
+		}
+		*role = string(parsed)
+	}
+
+	db, code, ok := openDB(out)
+	if !ok {
+		return code
+	}
+	defer db.Close()
+
+	query := `SELECT id, username, COALESCE(email, ''), name, role, created_at, disabled_at FROM users WHERE 1=1`
+	var params []interface{}
+	if s := strings.TrimSpace(*search); s != "" {
+		query += ` AND (username LIKE ? OR email LIKE ? OR name LIKE ?)`
+		like := "%" + s + "%"
+		params = append(params, like, like, like)
+	}
+	if *role != "" {
+		query += ` AND role = ?`
+		params = append(params, *role)
+	}
+	if *onlyDisabled {
+		query += ` AND disabled_at IS NOT NULL`
+	}
+	query += ` ORDER BY id LIMIT ?`
+	params = append(params, *limit)
+
+	rows, err := db.QueryContext(context.Background(), query, params...)
+	if err != nil {
+		return out.fail(exitError, fmt.Errorf("users list: %w", err), nil)
+	}
+	defer rows.Close()
+
+	users := []userRow{}
+	for rows.Next() {
+		var u userRow
+		var disabledAt sql.NullTime
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.Name, &u.Role, &u.CreatedAt, &disabledAt); err != nil {
+			return out.fail(exitError, fmt.Errorf("users list: %w", err), nil)
+		}
+		if disabledAt.Valid {
+			u.DisabledAt = &disabledAt.Time
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return out.fail(exitError, fmt.Errorf("users list: %w", err), nil)
+	}
+
+	out.result(users, func(w io.Writer) {
+		if len(users) == 0 {
+			fmt.Fprintln(w, "No hay usuarios")
+			return
+		}
+		fmt.Fprintf(w, "%-6s %-20s %-30s %-10s %-17s %s\n", "ID", "USERNAME", "EMAIL", "ROL", "CREADO", "ESTADO")
+		for _, u := range users {
+			state := "activo"
+			if u.DisabledAt != nil {
+				state = "deshabilitado " + u.DisabledAt.Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(w, "%-6d %-20s %-30s %-10s %-17s %s\n", u.ID, u.Username, u.Email, u.Role, u.CreatedAt.Format("2006-01-02 15:04"), state)
+		}
+	})
+	return exitOK
+}
+
+// runUsersCreate: cli users create --username U --email E [--name N] (--password P | --password-stdin)
+func runUsersCreate(args []string) int {
+	fs, jsonOut := newFlagSet("users create")
+	username := fs.String("username", "", "Nombre de usuario (obligatorio)")
+	email := fs.String("email", "", "Email (obligatorio)")
+	name := fs.String("name", "", "Nombre visible (default: username)")
+	password := fs.String("password", "", "Password (preferir --password-stdin en scripts)")
+	passwordStdin := fs.Bool("password-stdin", false, "Leer el password desde la primera línea de stdin")
+	out, code, ok := parseFlags(fs, jsonOut, args)
+	if !ok {
+		return code
+	}
+
+	u := userRow{
+		Username: strings.TrimSpace(*username),
+		Email:    strings.TrimSpace(strings.ToLower(*email)),
+		Name:     strings.TrimSpace(*name),
+	}
+	if u.Username == "" || u.Email == "" {
+		return out.usageError(fs, "--username y --email son obligatorios")
+	}
+	if !strings.Contains(u.Email, "@") {
+		return out.usageError(fs, "email inválido")
+	}
+	if u.Name == "" {
+		u.Name = u.Username
+	}
+	pw := *password
+	if *passwordStdin {
+		if pw != "" {
+			return out.usageError(fs, "--password y --password-stdin son excluyentes")
+		}
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return out.fail(exitError, fmt.Errorf("users create: leer password: %w", err), nil)
+		}
+		pw = strings.TrimRight(line, "\r\n")
+	}
+	if strings.TrimSpace(pw) == "" {
+		return out.usageError(fs, "password requerido (--password o --password-stdin)")
+	}
+
+	db, code, ok := openDB(out)
+	if !ok {
+		return code
+	}
+	defer db.Close()
+
+	hash, err := bcryptHash(pw)
+	if err != nil {
+		return out.fail(exitError, fmt.Errorf("users create: bcrypt: %w", err), nil)
+	}
+	res, err := db.Exec("INSERT INTO users (username,email,name,password_hash) VALUES (?,?,?,?)", u.Username, u.Email, u.Name, hash)
+	if err != nil {
+		if strings.Contains(err.Error(), "Duplicate entry") {
+			return out.fail(exitConflict, errors.New("username or email already exists"), nil)
+		}
+		return out.fail(exitError, fmt.Errorf("users create: %w", err), nil)
+	}
+	u.ID, _ = res.LastInsertId()
+	u.Role = string(models.RoleUser)
+	u.CreatedAt = time.Now()
+
+	out.result(u, func(w io.Writer) {
+		fmt.Fprintf(w, "Usuario '%s' creado (id %d)\n", u.Username, u.ID)
+	})
+	return exitOK
+}
+
+// userSelector agrega --id y --username a un comando que actúa sobre un usuario
+func userSelector(fs *flag.FlagSet) (*int64, *string) {
+	return fs.Int64("id", 0, "ID del usuario"), fs.String("username", "", "Username del usuario")
+}
+
+// findUser resuelve --id o --username al ID del usuario
+func findUser(db *sql.DB, id int64, username string) (int64, string, error) {
+	var err error
+	if id > 0 {
+		err = db.QueryRow("SELECT id, username FROM users WHERE id = ?", id).Scan(&id, &username)
+	} else {
+		err = db.QueryRow("SELECT id, username FROM users WHERE username = ?", username).Scan(&id, &username)
+	}
+	return id, username, err
+}
+
+// runUsersDisable: cli users disable (--id N | --username U)
+func runUsersDisable(args []string) int {
+	return setUserDisabled("users disable", args, true)
+}
+
+// runUsersEnable: cli users enable (--id N | --username U)
+func runUsersEnable(args []string) int {
+	return setUserDisabled("users enable", args, false)
+}
+
+func setUserDisabled(name string, args []string, disable bool) int {
+	fs, jsonOut := newFlagSet(name)
+	id, username := userSelector(fs)
+	out, code, ok := parseFlags(fs, jsonOut, args)
+	if !ok {
+		return code
+	}
+	*username = strings.TrimSpace(*username)
+	if (*id > 0) == (*username != "") {
+		return out.usageError(fs, "indique --id o --username")
+	}
+
+	db, code, ok := openDB(out)
+	if !ok {
+		return code
+	}
+	defer db.Close()
+
+	userID, uname, err := findUser(db, *id, *username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return out.fail(exitNotFound, errors.New("user not found"), nil)
+	}
+	if err != nil {
+		return out.fail(exitError, fmt.Errorf("%s: %w", name, err), nil)
+	}
+
+	var revoked int64
+	if disable {
+		tx, err := db.Begin()
+		if err != nil {
+			return out.fail(exitError, fmt.Errorf("%s: %w", name, err), nil)
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec("UPDATE users SET disabled_at = COALESCE(disabled_at, NOW()) WHERE id = ?", userID); err != nil {
+			return out.fail(exitError, fmt.Errorf("%s: %w", name, err), nil)
+		}
+		// Revocar las sesiones invalida también los access tokens vigentes (ver IsSessionActive)
+		res, err := tx.Exec("UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL", userID)
+		if err != nil {
+			return out.fail(exitError, fmt.Errorf("%s: %w", name, err), nil)
+		}
+		revoked, _ = res.RowsAffected()
+		if err := tx.Commit(); err != nil {
+			return out.fail(exitError, fmt.Errorf("%s: %w", name, err), nil)
+		}
+	} else if _, err := db.Exec("UPDATE users SET disabled_at = NULL WHERE id = ?", userID); err != nil {
+		return out.fail(exitError, fmt.Errorf("%s: %w", name, err), nil)
+	}
+
+	result := map[string]interface{}{"ok": true, "id": userID, "username": uname, "disabled": disable}
+	if disable {
+		result["sessions_revoked"] = revoked
+	}
+	out.result(result, func(w io.Writer) {
+		if disable {
+			fmt.Fprintf(w, "Usuario '%s' deshabilitado (%d sesiones revocadas)\n", uname, revoked)
+			return
+		}
+		fmt.Fprintf(w, "Usuario '%s' habilitado\n", uname)
+	})
+	return exitOK
+}
+
+// runUsersRole: cli users role (--id N | --username U) --role user|moderator|admin
+// Al bajar de rol se revocan las sesiones para que los tokens vigentes no
+// conserven el rol anterior; al subir, el nuevo rol llega en la próxima
+// renovación del access token o al volver a iniciar sesión.
+func runUsersRole(args []string) int {
+	fs, jsonOut := newFlagSet("users role")
+	id, username := userSelector(fs)
+	roleFlag := fs.String("role", "", "Rol a asignar: user, moderator o admin (obligatorio)")
+	out, code, ok := parseFlags(fs, jsonOut, args)
+	if !ok {
+		return code
+	}
+	*username = strings.TrimSpace(*username)
+	if (*id > 0) == (*username != "") {
+		return out.usageError(fs, "indique --id o --username")
+	}
+	role, ok := models.ParseRole(*roleFlag)
+	if !ok {
+		return out.usageError(fs, "--role debe ser user, moderator o admin")
+	}
+
+	db, code, ok := openDB(out)
+	if !ok {
+		return code
+	}
+	defer db.Close()
+
+	userID, uname, err := findUser(db, *id, *username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return out.fail(exitNotFound, errors.New("user not found"), nil)
+	}
+	if err != nil {
+		return out.fail(exitError, fmt.Errorf("users role: %w", err), nil)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return out.fail(exitError, fmt.Errorf("users role: %w", err), nil)
+	}
+	defer tx.Rollback()
+
+	var previous string
+	if err := tx.QueryRow("SELECT role FROM users WHERE id = ? FOR UPDATE", userID).Scan(&previous); err != nil {
+		return out.fail(exitError, fmt.Errorf("users role: %w", err), nil)
+	}
+	if _, err := tx.Exec("UPDATE users SET role = ? WHERE id = ?", role, userID); err != nil {
+		return out.fail(exitError, fmt.Errorf("users role: %w", err), nil)
+	}
+	var revoked int64
+	if !role.AtLeast(models.Role(previous)) {
+		res, err := tx.Exec("UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL", userID)
+		if err != nil {
+			return out.fail(exitError, fmt.Errorf("users role: %w", err), nil)
+		}
+		revoked, _ = res.RowsAffected()
+	}
+	if err := tx.Commit(); err != nil {
+		return out.fail(exitError, fmt.Errorf("users role: %w", err), nil)
+	}
+
+	result := map[string]interface{}{
+		"ok":               true,
+		"id":               userID,
+		"username":         uname,
+		"role":             role,
+		"previous_role":    previous,
+		"sessions_revoked": revoked,
+	}
+	out.result(result, func(w io.Writer) {
+		if previous == string(role) {
+			fmt.Fprintf(w, "Usuario '%s' ya tenía el rol %s\n", uname, role)
+			return
+		}
+		fmt.Fprintf(w, "Usuario '%s': rol %s → %s (%d sesiones revocadas)\n", uname, previous, role, revoked)
+	})
+	return exitOK
+}
+
+// runSeed: cli seed
+func runSeed(args []string) int {
+	fs, jsonOut := newFlagSet("seed")
+	out, code, ok := parseFlags(fs, jsonOut, args)
+	if !ok {
+		return code
+	}
+
+	db, code, ok := openDB(out)
+	if !ok {
+		return code
+	}
+	defer db.Close()
+
+	created, err := seedUser(db)
+	if err != nil {
+		return out.fail(exitError, fmt.Errorf("seed: %w", err), nil)
+	}
+	out.result(map[string]interface{}{"ok": true, "username": "demo", "created": created}, func(w io.Writer) {
+		if created {
+			fmt.Fprintln(w, "Seed: created user 'demo' with password 'demo1234'")
+			return
+		}
+		fmt.Fprintln(w, "Seed: user 'demo' already exists")
+	})
+	return exitOK
+}
+
+// seedUser crea el usuario de ejemplo si no existe
+func seedUser(db *sql.DB) (bool, error) {
+	username := "demo"
+	email := "demo@example.com"
+	name := "Demo"
+	password := "demo1234"
+	var exists int
+	_ = db.QueryRow("SELECT 1 FROM users WHERE username = ?", username).Scan(&exists)
+	if exists == 1 {
+		return false, nil
+	}
+	hash, err := bcryptHash(password)
+	if err != nil {
+		return false, err
+	}
+	if _, err := db.Exec("INSERT INTO users (username,email,name,password_hash) VALUES (?,?,?,?)", username, email, name, hash); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func bcryptHash(pw string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
+	return string(b), err
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/yourorg/wayfindcl/internal/handlers"
 	"github.com/yourorg/wayfindcl/internal/middleware"
 	"github.com/yourorg/wayfindcl/internal/routes"
+	"github.com/yourorg/wayfindcl/internal/transit"
 )
 
 func main() {
@@ -110,6 +111,9 @@ func main() {
 			// Configurar servicio de geometría en RedBusHandler para rutas a pie con GraphHopper
 			routes.ConfigureRedBusGeometry(geometrySvc)
 
+			// Router RAPTOR nativo sobre GTFS local (horarios se cargan bajo demanda)
+			handlers.InitTransitRouter(transit.NewRouter(db))
+
 			log.Println("✅ Servicio de Geometría inicializado (GTFS + GraphHopper)")
 			log.Println("✅ RedBusHandler configurado para usar GraphHopper en caminatas")
 
@@ -197,6 +201,7 @@ func main() {
 	log.Println("   ═══ ROUTING (LEGACY - Compatibilidad) ═══")
 	log.Println("   GET  /api/route/walking             - Rutas peatonales")
 	log.Println("   POST /api/route/transit             - Transporte público")
+	log.Println("   POST /api/route/transit/native      - Transporte público (RAPTOR offline)")
 	log.Println("   POST /api/route/options             - Opciones de ruta")
 	log.Println("")
 	log.Println("💡 Presiona Ctrl+C para detener")
@@ -68,66 +68,22 @@ func Connect() (*sql.DB, error) {
 	return db, nil
 }
 
-// EnsureSchema creates required tables if not exist.
+// EnsureSchema aplica las migraciones pendientes (ver migrate.go y migrations/).
 func EnsureSchema(db *sql.DB) error {
 	if skip := strings.TrimSpace(os.Getenv("DB_SKIP_SCHEMA")); strings.EqualFold(skip, "true") || skip == "1" {
 		log.Printf("EnsureSchema: skipped (DB_SKIP_SCHEMA=%q)", skip)
 		return nil
 	}
 
-	if _, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS users (
-			id BIGINT AUTO_INCREMENT PRIMARY KEY,
-			username VARCHAR(50) NOT NULL UNIQUE,
-			email VARCHAR(255) NOT NULL UNIQUE,
-			name VARCHAR(100) NOT NULL,
-			password_hash VARCHAR(255) NOT NULL,
-			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
-	`); err != nil {
-		return err
-	}
-
-	if _, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS gtfs_feeds (
-			id BIGINT AUTO_INCREMENT PRIMARY KEY,
-			source_url VARCHAR(500) NOT NULL,
-			feed_version VARCHAR(100) NULL,
-			downloaded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
-	`); err != nil {
-		return err
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
 
-	if _, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS gtfs_stops (
-			stop_id VARCHAR(64) PRIMARY KEY,
-			feed_id BIGINT NULL,
-			code VARCHAR(64) NULL,
-			name VARCHAR(255) NOT NULL,
-			description VARCHAR(255) NULL,
-			latitude DOUBLE NOT NULL,
-			longitude DOUBLE NOT NULL,
-			zone_id VARCHAR(64) NULL,
-			wheelchair_boarding TINYINT NOT NULL DEFAULT 0,
-			FOREIGN KEY (feed_id) REFERENCES gtfs_feeds(id) ON DELETE SET NULL
-		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
-	`); err != nil {
+	result, err := MigrateUp(ctx, db)
+	if err != nil {
 		return err
 	}
-
-	if _, err := db.Exec(`
-		CREATE INDEX idx_gtfs_stops_latlon ON gtfs_stops(latitude, longitude);
-	`); err != nil {
-		errMsg := strings.ToLower(err.Error())
-		if strings.Contains(errMsg, "duplicate") {
-			// index already exists, nothing to do
-		} else if strings.Contains(errMsg, "permission denied") {
-			log.Printf("EnsureSchema: unable to create gtfs_stops index (permission denied): %v", err)
-		} else {
-			return err
-		}
+	if len(result.Applied) > 0 {
+		log.Printf("✅ Esquema migrado de la versión %d a la %d (%d migraciones)", result.From, result.To, len(result.Applied))
 	}
-
 	return nil
 }
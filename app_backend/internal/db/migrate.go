@@ -0,0 +1,444 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migraciones versionadas embebidas en el binario.
+// Formato: migrations/NNNN_nombre.up.sql y migrations/NNNN_nombre.down.sql.
+// MariaDB no revierte DDL dentro de transacciones, así que cada migración debe ser
+// idempotente (IF [NOT] EXISTS): si falla a mitad de camino se puede reintentar.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockName es el lock de MariaDB (GET_LOCK) que serializa migraciones entre instancias
+const migrationLockName = "wayfindcl_schema_migrations"
+
+// migrationLockTimeout es cuánto se espera a que otra instancia termine de migrar
+const migrationLockTimeout = 60 * time.Second
+
+var (
+	// ErrMigrationLocked indica que otra instancia está migrando el esquema
+	ErrMigrationLocked = errors.New("db migrate: another instance holds the migration lock")
+	// ErrUnknownVersion indica una versión destino que no existe entre las migraciones embebidas
+	ErrUnknownVersion = errors.New("db migrate: unknown migration version")
+)
+
+// Migration es un par up/down de scripts SQL
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // SHA-256 del script up
+}
+
+// MigrationState es el estado de una migración en una base de datos
+type MigrationState struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	// Modified indica que el script embebido cambió después de aplicarse
+	Modified bool `json:"modified,omitempty"`
+	// Missing indica una versión registrada en la base que este binario no conoce
+	Missing bool `json:"missing,omitempty"`
+}
+
+// MigrationResult resume qué migraciones se aplicaron o revirtieron
+type MigrationResult struct {
+	From     int64   `json:"from"`
+	To       int64   `json:"to"`
+	Applied  []int64 `json:"applied,omitempty"`
+	Reverted []int64 `json:"reverted,omitempty"`
+}
+
+// Migrations retorna las migraciones embebidas ordenadas por versión
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("db migrate: read embedded migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(file, "."+direction+".sql")
+		sep := strings.IndexByte(base, '_')
+		if sep <= 0 {
+			return nil, fmt.Errorf("db migrate: invalid migration file name %q", file)
+		}
+		version, err := strconv.ParseInt(base[:sep], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("db migrate: invalid migration version in %q", file)
+		}
+		content, err := migrationFiles.ReadFile(path.Join("migrations", file))
+		if err != nil {
+			return nil, fmt.Errorf("db migrate: read %s: %w", file, err)
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: base[sep+1:]}
+			byVersion[version] = m
+		} else if m.Name != base[sep+1:] {
+			return nil, fmt.Errorf("db migrate: version %d has two names (%s, %s)", version, m.Name, base[sep+1:])
+		}
+		if direction == "up" {
+			m.Up = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" {
+			return nil, fmt.Errorf("db migrate: migration %d (%s) has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// LatestVersion retorna la versión de la última migración embebida
+func LatestVersion() (int64, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+func ensureMigrationsTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum CHAR(64) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
+	`)
+	if err != nil {
+		return fmt.Errorf("db migrate: create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// queryer es *sql.DB o *sql.Conn
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func appliedMigrations(ctx context.Context, q queryer) (map[int64]appliedMigration, error) {
+	rows, err := q.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("db migrate: read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var version int64
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, fmt.Errorf("db migrate: scan schema_migrations: %w", err)
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// MigrationStatus lista cada migración embebida (y las desconocidas registradas) con su estado
+func MigrationStatus(ctx context.Context, db *sql.DB) ([]MigrationState, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationsTable(ctx, db); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := MigrationState{Version: m.Version, Name: m.Name}
+		if a, ok := applied[m.Version]; ok {
+			appliedAt := a.appliedAt
+			state.Applied = true
+			state.AppliedAt = &appliedAt
+			state.Modified = a.checksum != m.Checksum
+			delete(applied, m.Version)
+		}
+		states = append(states, state)
+	}
+	for version, a := range applied {
+		appliedAt := a.appliedAt
+		states = append(states, MigrationState{Version: version, Name: a.name, Applied: true, AppliedAt: &appliedAt, Missing: true})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
+
+// CurrentVersion retorna la versión aplicada más alta (0 si la base está vacía)
+func CurrentVersion(ctx context.Context, db *sql.DB) (int64, error) {
+	if err := ensureMigrationsTable(ctx, db); err != nil {
+		return 0, err
+	}
+	var version int64
+	if err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("db migrate: current version: %w", err)
+	}
+	return version, nil
+}
+
+// MigrateUp aplica todas las migraciones pendientes
+func MigrateUp(ctx context.Context, db *sql.DB) (*MigrationResult, error) {
+	latest, err := LatestVersion()
+	if err != nil {
+		return nil, err
+	}
+	return MigrateTo(ctx, db, latest)
+}
+
+// MigrateDown revierte las últimas "steps" migraciones aplicadas
+func MigrateDown(ctx context.Context, db *sql.DB, steps int) (*MigrationResult, error) {
+	if steps <= 0 {
+		return nil, errors.New("db migrate: steps must be positive")
+	}
+	states, err := MigrationStatus(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return MigrateTo(ctx, db, downTarget(states, steps))
+}
+
+// downTarget retorna la versión que queda después de revertir las últimas
+// "steps" migraciones aplicadas: la embebida más alta por debajo de ellas. Las
+// registradas que este binario no conoce no sirven de destino; si hay que
+// revertir alguna, MigrateTo lo reporta antes de tocar el esquema.
+func downTarget(states []MigrationState, steps int) int64 {
+	var applied []MigrationState
+	for _, s := range states {
+		if s.Applied {
+			applied = append(applied, s)
+		}
+	}
+	for i := len(applied) - steps - 1; i >= 0; i-- {
+		if !applied[i].Missing {
+			return applied[i].Version
+		}
+	}
+	return 0
+}
+
+// MigrateTo deja el esquema exactamente en "version": aplica las migraciones pendientes
+// hasta ella y revierte (en orden inverso) las aplicadas por encima. 0 revierte todo.
+func MigrateTo(ctx context.Context, db *sql.DB, version int64) (*MigrationResult, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	embedded := make(map[int64]bool, len(migrations))
+	for _, m := range migrations {
+		embedded[m.Version] = true
+	}
+	if version != 0 && !embedded[version] {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	if err := ensureMigrationsTable(ctx, db); err != nil {
+		return nil, err
+	}
+
+	// GET_LOCK es por conexión: fijar una conexión del pool durante toda la migración
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("db migrate: %w", err)
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", migrationLockName, int(migrationLockTimeout.Seconds())).Scan(&locked); err != nil {
+		return nil, fmt.Errorf("db migrate: acquire lock: %w", err)
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return nil, ErrMigrationLocked
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", migrationLockName); err != nil {
+			log.Printf("⚠️ [MIGRATE] No se pudo liberar el lock de migraciones: %v", err)
+		}
+	}()
+
+	// Releer con el lock tomado: otra instancia pudo migrar mientras esperábamos
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	result := &MigrationResult{To: version}
+	for v, a := range applied {
+		if v > result.From {
+			result.From = v
+		}
+		// Sin su script down no se puede revertir: fallar antes de cambiar nada
+		if v > version && !embedded[v] {
+			return nil, fmt.Errorf("%w: %04d_%s is applied but not embedded in this binary, cannot revert it", ErrUnknownVersion, v, a.name)
+		}
+	}
+
+	for _, m := range migrations {
+		if m.Version > version {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		log.Printf("⬆️  [MIGRATE] %04d_%s", m.Version, m.Name)
+		if err := execScript(ctx, conn, m.Up); err != nil {
+			return result, fmt.Errorf("db migrate: up %04d_%s: %w", m.Version, m.Name, err)
+		}
+		if _, err := conn.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)",
+			m.Version, m.Name, m.Checksum,
+		); err != nil {
+			return result, fmt.Errorf("db migrate: record %04d_%s: %w", m.Version, m.Name, err)
+		}
+		result.Applied = append(result.Applied, m.Version)
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= version {
+			break
+		}
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if strings.TrimSpace(m.Down) == "" {
+			return result, fmt.Errorf("db migrate: %04d_%s has no down script", m.Version, m.Name)
+		}
+		log.Printf("⬇️  [MIGRATE] %04d_%s", m.Version, m.Name)
+		if err := execScript(ctx, conn, m.Down); err != nil {
+			return result, fmt.Errorf("db migrate: down %04d_%s: %w", m.Version, m.Name, err)
+		}
+		if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", m.Version); err != nil {
+			return result, fmt.Errorf("db migrate: unrecord %04d_%s: %w", m.Version, m.Name, err)
+		}
+		result.Reverted = append(result.Reverted, m.Version)
+	}
+
+	return result, nil
+}
+
+// execScript ejecuta un script SQL sentencia por sentencia (el DSN no habilita multiStatements)
+func execScript(ctx context.Context, conn *sql.Conn, script string) error {
+	for _, stmt := range splitStatements(script) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%w\n%s", err, stmt)
+		}
+	}
+	return nil
+}
+
+// splitStatements separa un script por ";" respetando strings, identificadores
+// entre backticks y comentarios (-- , # y /* */)
+func splitStatements(script string) []string {
+	var (
+		statements []string
+		current    strings.Builder
+		quote      byte
+	)
+	flush := func() {
+		if stmt := strings.TrimSpace(current.String()); stmt != "" {
+			statements = append(statements, stmt)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		if quote != 0 {
+			current.WriteByte(c)
+			if c == '\\' && quote != '`' && i+1 < len(script) {
+				i++
+				current.WriteByte(script[i])
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			current.WriteByte(c)
+		case c == '#' || isLineComment(script, i):
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			current.WriteByte('\n')
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 3
+			}
+			current.WriteByte(' ')
+		case c == ';':
+			flush()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	flush()
+	return statements
+}
+
+// isLineComment indica si en script[i] empieza un comentario "--": MariaDB
+// exige un espacio o carácter de control después (\r\n incluido) o el fin
+// del script, así que "5--2" es una resta
+func isLineComment(script string, i int) bool {
+	if !strings.HasPrefix(script[i:], "--") {
+		return false
+	}
+	return i+2 == len(script) || script[i+2] <= ' '
+}
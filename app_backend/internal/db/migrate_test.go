@@ -0,0 +1,183 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "vacío",
+			script: "  \n\t",
+		},
+		{
+			name:   "sólo comentarios",
+			script: "-- nada que ejecutar\n# tampoco\n/* ni esto */\n",
+		},
+		{
+			name:   "varias sentencias",
+			script: "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);\n",
+			want:   []string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"},
+		},
+		{
+			name:   "última sentencia sin punto y coma",
+			script: "SELECT 1;\nSELECT 2",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "punto y coma repetido",
+			script: "SELECT 1;;\n;SELECT 2;",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "punto y coma dentro de strings",
+			script: `INSERT INTO t VALUES ('a;b', "c;d");SELECT 1;`,
+			want:   []string{`INSERT INTO t VALUES ('a;b', "c;d")`, "SELECT 1"},
+		},
+		{
+			name:   "comillas escapadas",
+			script: `INSERT INTO t VALUES ('it\'s; fine', 'x''y;z');SELECT 2;`,
+			want:   []string{`INSERT INTO t VALUES ('it\'s; fine', 'x''y;z')`, "SELECT 2"},
+		},
+		{
+			name:   "identificador entre backticks",
+			script: "CREATE TABLE `a;b` (`c\\` INT);SELECT 3;",
+			want:   []string{"CREATE TABLE `a;b` (`c\\` INT)", "SELECT 3"},
+		},
+		{
+			name:   "comentarios de línea",
+			script: "SELECT 1; -- fin; no separa\n# otro; comentario\nSELECT 2;",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "comentario de línea vacío",
+			script: "SELECT 1;\n--\nSELECT 2;",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "comentario de línea vacío al final",
+			script: "SELECT 1;\n--",
+			want:   []string{"SELECT 1"},
+		},
+		{
+			name:   "comentario vacío al final sin punto y coma",
+			script: "SELECT 1\n--",
+			want:   []string{"SELECT 1"},
+		},
+		{
+			name:   "fin de línea CRLF",
+			script: "-- cabecera\r\nSELECT 1;\r\n--\r\nSELECT 2; -- fin\r\n",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "comentario seguido de tab",
+			script: "SELECT 1;\n--\tnota; no separa\nSELECT 2;",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "resta no es comentario",
+			script: "SELECT 5--2;",
+			want:   []string{"SELECT 5--2"},
+		},
+		{
+			name:   "comentario de bloque",
+			script: "SELECT /* uno; dos */ 1;/* multi\nlínea; */SELECT 2;",
+			want:   []string{"SELECT   1", "SELECT 2"},
+		},
+		{
+			name:   "comentario de bloque sin cerrar",
+			script: "SELECT 1; /* sin cierre; SELECT 2;",
+			want:   []string{"SELECT 1"},
+		},
+		{
+			name:   "comentario dentro de un string",
+			script: "INSERT INTO t VALUES ('-- no; /* es */ # comentario');",
+			want:   []string{"INSERT INTO t VALUES ('-- no; /* es */ # comentario')"},
+		},
+		{
+			name:   "string sin cerrar",
+			script: "SELECT 'abierto; SELECT 2;",
+			want:   []string{"SELECT 'abierto; SELECT 2;"},
+		},
+		{
+			name:   "UTF-8 se conserva",
+			script: "INSERT INTO t VALUES ('Ñuñoa; Peñalolén');",
+			want:   []string{"INSERT INTO t VALUES ('Ñuñoa; Peñalolén')"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitStatements(tt.script)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements(%q)\n got  %q\n want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownTarget(t *testing.T) {
+	applied := func(version int64) MigrationState { return MigrationState{Version: version, Applied: true} }
+	missing := func(version int64) MigrationState {
+		return MigrationState{Version: version, Applied: true, Missing: true}
+	}
+	pending := func(version int64) MigrationState { return MigrationState{Version: version} }
+
+	tests := []struct {
+		name   string
+		states []MigrationState
+		steps  int
+		want   int64
+	}{
+		{"una", []MigrationState{applied(1), applied(2), applied(3)}, 1, 2},
+		{"varias", []MigrationState{applied(1), applied(2), applied(3)}, 2, 1},
+		{"todas", []MigrationState{applied(1), applied(2)}, 2, 0},
+		{"más de las aplicadas", []MigrationState{applied(1), applied(2)}, 5, 0},
+		{"ignora las pendientes", []MigrationState{applied(1), applied(2), pending(3)}, 1, 1},
+		// 2 quedó registrada por otro binario: no puede ser el destino
+		{"salta una desconocida", []MigrationState{applied(1), missing(2), applied(3)}, 1, 1},
+		{"sólo desconocidas debajo", []MigrationState{missing(1), applied(2)}, 1, 0},
+		// Revertir 4 la incluye: MigrateTo la reporta antes de tocar el esquema
+		{"desconocida a revertir", []MigrationState{applied(1), applied(2), missing(4)}, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := downTarget(tt.states, tt.steps); got != tt.want {
+				t.Errorf("downTarget(steps=%d) = %d, want %d", tt.steps, got, tt.want)
+			}
+		})
+	}
+}
+
+// Las migraciones embebidas tienen que separarse en sentencias ejecutables
+func TestEmbeddedMigrationsSplit(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no hay migraciones embebidas")
+	}
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("versión %d en la posición %d: las versiones deben ser correlativas", m.Version, i)
+		}
+		for direction, script := range map[string]string{"up": m.Up, "down": m.Down} {
+			statements := splitStatements(script)
+			if len(statements) == 0 {
+				t.Errorf("%04d_%s.%s.sql no tiene sentencias", m.Version, m.Name, direction)
+			}
+			for _, stmt := range statements {
+				if strings.HasPrefix(stmt, "--") || strings.HasPrefix(stmt, "#") || strings.HasPrefix(stmt, "/*") {
+					t.Errorf("%04d_%s.%s.sql: comentario sin quitar en %q", m.Version, m.Name, direction, stmt)
+				}
+			}
+		}
+	}
+}
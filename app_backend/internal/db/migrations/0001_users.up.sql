@@ -0,0 +1,36 @@
+-- ============================================================================
+-- 0001 - Usuarios (password y biométricos)
+-- ============================================================================
+-- Bases creadas por el antiguo EnsureSchema no tienen las columnas de
+-- autenticación biométrica (ver sql/migrate_biometric_auth.sql): se agregan
+-- con IF NOT EXISTS para que la migración sea idempotente.
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS users (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	username VARCHAR(50) NOT NULL,
+	email VARCHAR(255) NULL DEFAULT NULL,
+	name VARCHAR(100) NOT NULL,
+	password_hash VARCHAR(255) NULL DEFAULT NULL COMMENT 'Hash bcrypt del password - NULL para usuarios biométricos',
+	biometric_id VARCHAR(64) NULL DEFAULT NULL COMMENT 'SHA-256 hash del dispositivo para autenticación biométrica',
+	auth_type VARCHAR(20) NOT NULL DEFAULT 'password' COMMENT 'Tipo de autenticación: password o biometric',
+	device_info VARCHAR(255) NULL DEFAULT NULL COMMENT 'Información del dispositivo para usuarios biométricos',
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_login TIMESTAMP NULL DEFAULT NULL COMMENT 'Último inicio de sesión del usuario',
+	disabled_at DATETIME NULL DEFAULT NULL COMMENT 'Cuenta deshabilitada por un administrador',
+	UNIQUE KEY username (username),
+	UNIQUE KEY email (email),
+	UNIQUE KEY idx_biometric_id (biometric_id),
+	KEY idx_auth_type (auth_type)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS biometric_id VARCHAR(64) NULL DEFAULT NULL COMMENT 'SHA-256 hash del dispositivo para autenticación biométrica',
+	ADD COLUMN IF NOT EXISTS auth_type VARCHAR(20) NOT NULL DEFAULT 'password' COMMENT 'Tipo de autenticación: password o biometric',
+	ADD COLUMN IF NOT EXISTS device_info VARCHAR(255) NULL DEFAULT NULL COMMENT 'Información del dispositivo para usuarios biométricos',
+	ADD COLUMN IF NOT EXISTS last_login TIMESTAMP NULL DEFAULT NULL COMMENT 'Último inicio de sesión del usuario',
+	ADD COLUMN IF NOT EXISTS disabled_at DATETIME NULL DEFAULT NULL COMMENT 'Cuenta deshabilitada por un administrador',
+	MODIFY COLUMN email VARCHAR(255) NULL DEFAULT NULL,
+	MODIFY COLUMN password_hash VARCHAR(255) NULL DEFAULT NULL COMMENT 'Hash bcrypt del password - NULL para usuarios biométricos',
+	ADD UNIQUE INDEX IF NOT EXISTS idx_biometric_id (biometric_id),
+	ADD INDEX IF NOT EXISTS idx_auth_type (auth_type);
@@ -0,0 +1,21 @@
+-- ============================================================================
+-- 0002 - Sesiones por dispositivo (refresh tokens rotativos)
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+	id VARCHAR(64) PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	refresh_token_hash CHAR(64) NOT NULL,
+	previous_token_hash CHAR(64) NULL,
+	device_info VARCHAR(255) NULL,
+	ip_address VARCHAR(64) NULL,
+	user_agent VARCHAR(255) NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	expires_at DATETIME NOT NULL,
+	revoked_at DATETIME NULL,
+	UNIQUE KEY idx_user_sessions_refresh (refresh_token_hash),
+	KEY idx_user_sessions_previous (previous_token_hash),
+	KEY idx_user_sessions_user (user_id, revoked_at),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS gtfs_stop_times;
+DROP TABLE IF EXISTS gtfs_trips;
+DROP TABLE IF EXISTS gtfs_routes;
+DROP TABLE IF EXISTS gtfs_stops;
+DROP TABLE IF EXISTS gtfs_feeds;
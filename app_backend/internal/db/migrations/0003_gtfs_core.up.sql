@@ -0,0 +1,70 @@
+-- ============================================================================
+-- 0003 - GTFS: feeds, paradas, rutas, viajes y horarios
+-- ============================================================================
+-- Sin foreign keys entre stop_times/trips/stops: las generaciones del feed
+-- (gtfs_*_g<feed_id>) se crean con CREATE TABLE ... LIKE, que no las copia,
+-- y el loader borra explícitamente las filas dependientes.
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS gtfs_feeds (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	source_url VARCHAR(500) NOT NULL,
+	feed_version VARCHAR(100) NULL,
+	downloaded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS gtfs_stops (
+	stop_id VARCHAR(64) PRIMARY KEY,
+	feed_id BIGINT NULL,
+	code VARCHAR(64) NULL,
+	name VARCHAR(255) NOT NULL,
+	description VARCHAR(255) NULL,
+	latitude DOUBLE NOT NULL,
+	longitude DOUBLE NOT NULL,
+	zone_id VARCHAR(64) NULL,
+	wheelchair_boarding TINYINT NOT NULL DEFAULT 0,
+	FOREIGN KEY (feed_id) REFERENCES gtfs_feeds(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE INDEX IF NOT EXISTS idx_gtfs_stops_latlon ON gtfs_stops(latitude, longitude);
+
+CREATE TABLE IF NOT EXISTS gtfs_routes (
+	route_id VARCHAR(64) PRIMARY KEY,
+	feed_id BIGINT NULL,
+	short_name VARCHAR(64) NULL,
+	long_name VARCHAR(255) NULL,
+	type INT NULL,
+	color VARCHAR(10) NULL,
+	text_color VARCHAR(10) NULL,
+	KEY feed_id (feed_id),
+	FOREIGN KEY (feed_id) REFERENCES gtfs_feeds(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS gtfs_trips (
+	trip_id VARCHAR(64) PRIMARY KEY,
+	feed_id BIGINT NULL,
+	route_id VARCHAR(64) NOT NULL,
+	service_id VARCHAR(64) NULL,
+	headsign VARCHAR(255) NULL,
+	direction_id TINYINT NULL,
+	shape_id VARCHAR(64) NULL,
+	KEY idx_gtfs_trips_feed (feed_id),
+	KEY idx_gtfs_trips_route (route_id),
+	KEY idx_gtfs_trips_service (service_id),
+	FOREIGN KEY (feed_id) REFERENCES gtfs_feeds(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS gtfs_stop_times (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	feed_id BIGINT NULL,
+	trip_id VARCHAR(64) NOT NULL,
+	arrival_time VARCHAR(10) NULL,
+	departure_time VARCHAR(10) NULL,
+	stop_id VARCHAR(64) NOT NULL,
+	stop_sequence INT NOT NULL,
+	KEY idx_gtfs_stop_times_feed (feed_id),
+	KEY idx_gtfs_stop_times_trip (trip_id),
+	KEY idx_gtfs_stop_times_stop (stop_id),
+	KEY idx_gtfs_stop_times_departure (departure_time),
+	FOREIGN KEY (feed_id) REFERENCES gtfs_feeds(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS gtfs_transfers;
+DROP TABLE IF EXISTS gtfs_frequencies;
+DROP TABLE IF EXISTS gtfs_shapes;
+DROP TABLE IF EXISTS gtfs_calendar_dates;
+DROP TABLE IF EXISTS gtfs_calendar;
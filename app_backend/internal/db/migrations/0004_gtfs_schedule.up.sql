@@ -0,0 +1,66 @@
+-- ============================================================================
+-- 0004 - GTFS: calendarios, excepciones, shapes, frecuencias y transbordos
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS gtfs_calendar (
+	service_id VARCHAR(64) PRIMARY KEY,
+	feed_id BIGINT NULL,
+	monday TINYINT NOT NULL DEFAULT 0,
+	tuesday TINYINT NOT NULL DEFAULT 0,
+	wednesday TINYINT NOT NULL DEFAULT 0,
+	thursday TINYINT NOT NULL DEFAULT 0,
+	friday TINYINT NOT NULL DEFAULT 0,
+	saturday TINYINT NOT NULL DEFAULT 0,
+	sunday TINYINT NOT NULL DEFAULT 0,
+	start_date DATE NOT NULL,
+	end_date DATE NOT NULL,
+	KEY idx_gtfs_calendar_dates (start_date, end_date),
+	FOREIGN KEY (feed_id) REFERENCES gtfs_feeds(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS gtfs_calendar_dates (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	feed_id BIGINT NULL,
+	service_id VARCHAR(64) NOT NULL,
+	date DATE NOT NULL,
+	exception_type TINYINT NOT NULL,
+	UNIQUE KEY idx_gtfs_calendar_dates_service (service_id, date),
+	KEY idx_gtfs_calendar_dates_date (date),
+	FOREIGN KEY (feed_id) REFERENCES gtfs_feeds(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS gtfs_shapes (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	feed_id BIGINT NULL,
+	shape_id VARCHAR(64) NOT NULL,
+	shape_pt_lat DOUBLE NOT NULL,
+	shape_pt_lon DOUBLE NOT NULL,
+	shape_pt_sequence INT NOT NULL,
+	shape_dist_traveled DOUBLE NULL,
+	KEY idx_gtfs_shapes_shape (shape_id, shape_pt_sequence),
+	FOREIGN KEY (feed_id) REFERENCES gtfs_feeds(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS gtfs_frequencies (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	feed_id BIGINT NULL,
+	trip_id VARCHAR(64) NOT NULL,
+	start_time VARCHAR(10) NOT NULL,
+	end_time VARCHAR(10) NOT NULL,
+	headway_secs INT NOT NULL,
+	exact_times TINYINT NOT NULL DEFAULT 0,
+	KEY idx_gtfs_frequencies_trip (trip_id),
+	FOREIGN KEY (feed_id) REFERENCES gtfs_feeds(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS gtfs_transfers (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	feed_id BIGINT NULL,
+	from_stop_id VARCHAR(64) NOT NULL,
+	to_stop_id VARCHAR(64) NOT NULL,
+	transfer_type TINYINT NOT NULL DEFAULT 0,
+	min_transfer_time INT NULL,
+	KEY idx_gtfs_transfers_from (from_stop_id),
+	KEY idx_gtfs_transfers_to (to_stop_id),
+	FOREIGN KEY (feed_id) REFERENCES gtfs_feeds(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,5 @@
+-- Las tablas de generaciones retiradas (gtfs_*_g<feed_id>) no se eliminan:
+-- usar "cli gtfs generations" antes de revertir para revisarlas.
+DROP TABLE IF EXISTS gtfs_generations;
+DROP TABLE IF EXISTS gtfs_validation_reports;
+DROP TABLE IF EXISTS gtfs_feed_files;
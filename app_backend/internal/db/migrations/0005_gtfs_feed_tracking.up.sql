@@ -0,0 +1,33 @@
+-- ============================================================================
+-- 0005 - GTFS: hashes por archivo, reportes de validación y generaciones
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS gtfs_feed_files (
+	feed_id BIGINT NOT NULL,
+	file_name VARCHAR(64) NOT NULL,
+	content_hash CHAR(64) NOT NULL,
+	size_bytes BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (feed_id, file_name),
+	FOREIGN KEY (feed_id) REFERENCES gtfs_feeds(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS gtfs_validation_reports (
+	feed_id BIGINT PRIMARY KEY,
+	valid TINYINT(1) NOT NULL DEFAULT 0,
+	error_count INT NOT NULL DEFAULT 0,
+	warning_count INT NOT NULL DEFAULT 0,
+	report LONGTEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (feed_id) REFERENCES gtfs_feeds(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS gtfs_generations (
+	feed_id BIGINT PRIMARY KEY,
+	status VARCHAR(16) NOT NULL DEFAULT 'building',
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	activated_at DATETIME NULL,
+	retired_at DATETIME NULL,
+	error_message TEXT NULL,
+	KEY idx_gtfs_generations_status (status),
+	FOREIGN KEY (feed_id) REFERENCES gtfs_feeds(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,25 @@
+-- ============================================================================
+-- 0006 - Incidentes reportados por usuarios
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS incidents (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	type VARCHAR(50) NOT NULL COMMENT 'bus_full, bus_delayed, bus_not_running, stop_out_of_service, stop_damaged, unsafe_area, accessibility, other',
+	latitude DOUBLE NOT NULL,
+	longitude DOUBLE NOT NULL,
+	severity VARCHAR(20) NOT NULL DEFAULT 'medium' COMMENT 'low, medium, high, critical',
+	reporter_id VARCHAR(100) NULL DEFAULT NULL COMMENT 'User ID or "anonymous"',
+	route_name VARCHAR(100) NULL DEFAULT NULL COMMENT 'Nombre de ruta afectada',
+	stop_name VARCHAR(255) NULL DEFAULT NULL COMMENT 'Nombre de parada afectada',
+	description TEXT NULL,
+	is_verified TINYINT(1) NOT NULL DEFAULT 0,
+	upvotes INT NOT NULL DEFAULT 0,
+	downvotes INT NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	KEY idx_incidents_type (type),
+	KEY idx_incidents_severity (severity),
+	KEY idx_incidents_location (latitude, longitude),
+	KEY idx_incidents_route (route_name),
+	KEY idx_incidents_created (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,20 @@
+-- ============================================================================
+-- 0007 - Ubicación compartida en tiempo real
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS location_shares (
+	id VARCHAR(64) NOT NULL PRIMARY KEY COMMENT 'UUID',
+	user_id BIGINT NOT NULL,
+	latitude DOUBLE NOT NULL,
+	longitude DOUBLE NOT NULL,
+	recipient_name VARCHAR(100) NULL DEFAULT NULL,
+	message TEXT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	is_active TINYINT(1) NOT NULL DEFAULT 1,
+	last_updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	KEY idx_location_shares_user (user_id),
+	KEY idx_location_shares_expires (expires_at),
+	KEY idx_location_shares_active (is_active, expires_at),
+	CONSTRAINT fk_location_shares_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,25 @@
+-- ============================================================================
+-- 0008 - Historial de viajes
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS trip_history (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	origin_lat DOUBLE NOT NULL,
+	origin_lon DOUBLE NOT NULL,
+	destination_lat DOUBLE NOT NULL,
+	destination_lon DOUBLE NOT NULL,
+	destination_name VARCHAR(255) NOT NULL,
+	distance_meters DOUBLE NOT NULL,
+	duration_seconds INT NOT NULL,
+	bus_route VARCHAR(100) NULL DEFAULT NULL,
+	route_geometry TEXT NULL COMMENT 'JSON encoded geometry',
+	started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	completed_at TIMESTAMP NULL DEFAULT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	KEY idx_trip_history_user (user_id),
+	KEY idx_trip_history_destination (destination_name),
+	KEY idx_trip_history_completed (completed_at),
+	KEY idx_trip_history_started (started_at),
+	CONSTRAINT fk_trip_history_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,21 @@
+-- ============================================================================
+-- 0009 - Preferencias de notificaciones de proximidad
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS notification_preferences (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	approaching_distance DOUBLE NOT NULL DEFAULT 300 COMMENT 'Metros para "acercándose"',
+	near_distance DOUBLE NOT NULL DEFAULT 100 COMMENT 'Metros para "cerca"',
+	very_near_distance DOUBLE NOT NULL DEFAULT 30 COMMENT 'Metros para "muy cerca"',
+	enable_audio TINYINT(1) NOT NULL DEFAULT 1,
+	enable_vibration TINYINT(1) NOT NULL DEFAULT 1,
+	enable_visual TINYINT(1) NOT NULL DEFAULT 1,
+	audio_volume DOUBLE NOT NULL DEFAULT 0.8 COMMENT '0.0 a 1.0',
+	vibration_intensity DOUBLE NOT NULL DEFAULT 0.7 COMMENT '0.0 a 1.0',
+	minimum_priority VARCHAR(20) NOT NULL DEFAULT 'medium' COMMENT 'low, medium, high, critical',
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	UNIQUE KEY user_id (user_id),
+	CONSTRAINT fk_notification_prefs_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,33 @@
+-- ============================================================================
+-- 0010 - Contribuciones de la comunidad (reportes y sugerencias)
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS contributions (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	user_id BIGINT NULL DEFAULT NULL COMMENT 'Usuario que reporta (NULL para anónimo)',
+	type VARCHAR(50) NOT NULL COMMENT 'bus_status, route_issues, stop_info, general_suggestion',
+	category VARCHAR(50) NULL DEFAULT NULL COMMENT 'delayed, crowded, broken, detour, suspension, new_stop, accessibility, etc.',
+	title VARCHAR(255) NOT NULL COMMENT 'Título del reporte',
+	description TEXT NOT NULL COMMENT 'Descripción detallada del problema',
+	latitude DOUBLE NULL DEFAULT NULL COMMENT 'Ubicación del reporte',
+	longitude DOUBLE NULL DEFAULT NULL COMMENT 'Ubicación del reporte',
+	bus_route VARCHAR(100) NULL DEFAULT NULL COMMENT 'Ruta de bus afectada',
+	stop_name VARCHAR(255) NULL DEFAULT NULL COMMENT 'Parada afectada',
+	delay_minutes INT NULL DEFAULT NULL COMMENT 'Minutos de retraso reportados',
+	severity VARCHAR(20) NOT NULL DEFAULT 'medium' COMMENT 'low, medium, high, critical',
+	status VARCHAR(20) NOT NULL DEFAULT 'pending' COMMENT 'pending, verified, rejected, resolved',
+	upvotes INT NOT NULL DEFAULT 0,
+	downvotes INT NOT NULL DEFAULT 0,
+	contact_email VARCHAR(255) NULL DEFAULT NULL COMMENT 'Email de contacto (opcional)',
+	device_info LONGTEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NULL DEFAULT NULL COMMENT 'Información del dispositivo' CHECK (json_valid(device_info)),
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	KEY idx_contributions_type (type),
+	KEY idx_contributions_category (category),
+	KEY idx_contributions_status (status),
+	KEY idx_contributions_location (latitude, longitude),
+	KEY idx_contributions_route (bus_route),
+	KEY idx_contributions_created (created_at),
+	KEY idx_contributions_user (user_id),
+	CONSTRAINT fk_contributions_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
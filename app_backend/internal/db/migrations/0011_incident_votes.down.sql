@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS incident_moderation_log;
+DROP TABLE IF EXISTS incident_votes;
+
+ALTER TABLE incidents
+	DROP INDEX IF EXISTS idx_incidents_reporter,
+	DROP COLUMN IF EXISTS weighted_score,
+	DROP COLUMN IF EXISTS is_hidden;
@@ -0,0 +1,41 @@
+-- ============================================================================
+-- 0011 - Votos de incidentes (uno por usuario/dispositivo) y moderación
+-- ============================================================================
+-- upvotes/downvotes siguen siendo contadores: los votos anteriores a esta
+-- migración no tienen fila en incident_votes, así que para esos incidentes
+-- weighted_score parte de upvotes - downvotes (peso 1).
+-- ============================================================================
+
+ALTER TABLE incidents
+	ADD COLUMN IF NOT EXISTS is_hidden TINYINT(1) NOT NULL DEFAULT 0 COMMENT 'Ocultado por votos negativos' AFTER is_verified,
+	ADD COLUMN IF NOT EXISTS weighted_score DOUBLE NOT NULL DEFAULT 0 COMMENT 'Suma de votos ponderados por reputación' AFTER downvotes,
+	ADD INDEX IF NOT EXISTS idx_incidents_reporter (reporter_id);
+
+CREATE TABLE IF NOT EXISTS incident_votes (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	incident_id BIGINT NOT NULL,
+	voter_key VARCHAR(120) NOT NULL COMMENT 'user:<id> o device:<id>',
+	vote TINYINT NOT NULL COMMENT '1 upvote, -1 downvote',
+	weight DOUBLE NOT NULL DEFAULT 1 COMMENT 'Peso según la reputación del votante al votar',
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	UNIQUE KEY uq_incident_votes_voter (incident_id, voter_key),
+	CONSTRAINT fk_incident_votes_incident FOREIGN KEY (incident_id) REFERENCES incidents(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS incident_moderation_log (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	incident_id BIGINT NOT NULL,
+	action VARCHAR(20) NOT NULL COMMENT 'verified, unverified, hidden, unhidden',
+	weighted_score DOUBLE NOT NULL,
+	upvotes INT NOT NULL,
+	downvotes INT NOT NULL,
+	trigger_voter VARCHAR(120) NULL DEFAULT NULL COMMENT 'Voto que cruzó el umbral',
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	KEY idx_incident_moderation_incident (incident_id, created_at),
+	CONSTRAINT fk_incident_moderation_incident FOREIGN KEY (incident_id) REFERENCES incidents(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+UPDATE incidents SET weighted_score = upvotes - downvotes
+WHERE weighted_score = 0
+  AND NOT EXISTS (SELECT 1 FROM incident_votes v WHERE v.incident_id = incidents.id);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS incident_confirmations;
+
+ALTER TABLE incidents
+	DROP INDEX IF EXISTS idx_incidents_status_expires,
+	DROP COLUMN IF EXISTS resolved_at,
+	DROP COLUMN IF EXISTS expires_at,
+	DROP COLUMN IF EXISTS status;
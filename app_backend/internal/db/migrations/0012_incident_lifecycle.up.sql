@@ -0,0 +1,41 @@
+-- ============================================================================
+-- 0012 - Ciclo de vida de incidentes (active, resolved, expired, hidden)
+-- ============================================================================
+-- expires_at se calcula al crear según el TTL del tipo (models.IncidentType.TTL)
+-- y se extiende con confirmaciones "sigue ahí". El backfill usa los mismos
+-- TTL vigentes al publicar esta migración.
+-- ============================================================================
+
+ALTER TABLE incidents
+	ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'active' COMMENT 'active, resolved, expired, hidden' AFTER severity,
+	ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP NULL DEFAULT NULL COMMENT 'Vence salvo nuevas confirmaciones' AFTER updated_at,
+	ADD COLUMN IF NOT EXISTS resolved_at TIMESTAMP NULL DEFAULT NULL AFTER expires_at,
+	ADD INDEX IF NOT EXISTS idx_incidents_status_expires (status, expires_at);
+
+CREATE TABLE IF NOT EXISTS incident_confirmations (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	incident_id BIGINT NOT NULL,
+	voter_key VARCHAR(120) NOT NULL COMMENT 'user:<id> o device:<id>',
+	still_there TINYINT(1) NOT NULL COMMENT '1 sigue ahí, 0 ya no está',
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	UNIQUE KEY uq_incident_confirmations_voter (incident_id, voter_key),
+	CONSTRAINT fk_incident_confirmations_incident FOREIGN KEY (incident_id) REFERENCES incidents(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+UPDATE incidents SET status = 'hidden' WHERE is_hidden = 1 AND status = 'active';
+
+UPDATE incidents SET expires_at = CASE type
+	WHEN 'bus_full' THEN created_at + INTERVAL 20 MINUTE
+	WHEN 'bus_delayed' THEN created_at + INTERVAL 45 MINUTE
+	WHEN 'bus_not_running' THEN created_at + INTERVAL 3 HOUR
+	WHEN 'unsafe_area' THEN created_at + INTERVAL 12 HOUR
+	WHEN 'stop_out_of_service' THEN created_at + INTERVAL 3 DAY
+	WHEN 'stop_damaged' THEN created_at + INTERVAL 7 DAY
+	WHEN 'accessibility' THEN created_at + INTERVAL 7 DAY
+	ELSE created_at + INTERVAL 6 HOUR
+END
+WHERE expires_at IS NULL;
+
+UPDATE incidents SET status = 'expired'
+WHERE status IN ('active', 'hidden') AND expires_at <= NOW();
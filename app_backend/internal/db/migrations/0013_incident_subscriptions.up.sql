@@ -0,0 +1,41 @@
+-- ============================================================================
+-- 0013 - Suscripciones a rutas/paraderos/zonas y bandeja de notificaciones
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS incident_subscriptions (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	kind VARCHAR(10) NOT NULL COMMENT 'route, stop, area',
+	route_name VARCHAR(100) NULL DEFAULT NULL COMMENT 'kind = route',
+	stop_name VARCHAR(255) NULL DEFAULT NULL COMMENT 'kind = stop',
+	latitude DOUBLE NULL DEFAULT NULL COMMENT 'kind = area',
+	longitude DOUBLE NULL DEFAULT NULL COMMENT 'kind = area',
+	radius_m DOUBLE NULL DEFAULT NULL COMMENT 'kind = area',
+	label VARCHAR(100) NULL DEFAULT NULL COMMENT 'Nombre visible (ej: "Casa")',
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	KEY idx_incident_subscriptions_user (user_id),
+	KEY idx_incident_subscriptions_route (kind, route_name),
+	KEY idx_incident_subscriptions_stop (kind, stop_name),
+	KEY idx_incident_subscriptions_area (kind, latitude, longitude),
+	CONSTRAINT fk_incident_subscriptions_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS notifications (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	kind VARCHAR(20) NOT NULL COMMENT 'incident',
+	incident_id BIGINT NULL DEFAULT NULL,
+	subscription_id BIGINT NULL DEFAULT NULL COMMENT 'Suscripción que la originó',
+	title VARCHAR(200) NOT NULL,
+	body TEXT NULL,
+	priority VARCHAR(20) NOT NULL DEFAULT 'medium' COMMENT 'low, medium, high, critical',
+	audio TINYINT(1) NOT NULL DEFAULT 1 COMMENT 'Canales según notification_preferences',
+	vibration TINYINT(1) NOT NULL DEFAULT 1,
+	visual TINYINT(1) NOT NULL DEFAULT 1,
+	read_at TIMESTAMP NULL DEFAULT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	KEY idx_notifications_user (user_id, created_at),
+	CONSTRAINT fk_notifications_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	CONSTRAINT fk_notifications_incident FOREIGN KEY (incident_id) REFERENCES incidents(id) ON DELETE SET NULL,
+	CONSTRAINT fk_notifications_subscription FOREIGN KEY (subscription_id) REFERENCES incident_subscriptions(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,6 @@
+ALTER TABLE contributions
+	DROP FOREIGN KEY IF EXISTS fk_contributions_incident,
+	DROP COLUMN IF EXISTS incident_id,
+	DROP COLUMN IF EXISTS moderated_at,
+	DROP COLUMN IF EXISTS moderated_by,
+	DROP COLUMN IF EXISTS moderator_note;
@@ -0,0 +1,13 @@
+-- ============================================================================
+-- 0014 - Moderación de contribuciones
+-- ============================================================================
+-- Las contribuciones aprobadas de retraso o desvío generan un incidente en la
+-- ruta afectada (incident_id).
+-- ============================================================================
+
+ALTER TABLE contributions
+	ADD COLUMN IF NOT EXISTS moderator_note TEXT NULL DEFAULT NULL COMMENT 'Nota al aprobar, rechazar o resolver' AFTER status,
+	ADD COLUMN IF NOT EXISTS moderated_by VARCHAR(100) NULL DEFAULT NULL AFTER moderator_note,
+	ADD COLUMN IF NOT EXISTS moderated_at TIMESTAMP NULL DEFAULT NULL AFTER moderated_by,
+	ADD COLUMN IF NOT EXISTS incident_id BIGINT NULL DEFAULT NULL COMMENT 'Incidente generado al aprobar' AFTER moderated_at,
+	ADD CONSTRAINT fk_contributions_incident FOREIGN KEY IF NOT EXISTS (incident_id) REFERENCES incidents(id) ON DELETE SET NULL;
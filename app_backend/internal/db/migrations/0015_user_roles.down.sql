@@ -0,0 +1,3 @@
+ALTER TABLE users
+	DROP INDEX IF EXISTS idx_users_role,
+	DROP COLUMN IF EXISTS role;
@@ -0,0 +1,9 @@
+-- ============================================================================
+-- 0015 - Roles de usuario (user, moderator, admin)
+-- ============================================================================
+-- El rol viaja en los claims del JWT; se asigna con `cli users role`.
+-- ============================================================================
+
+ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user' COMMENT 'user, moderator, admin' AFTER auth_type,
+	ADD INDEX IF NOT EXISTS idx_users_role (role);
@@ -0,0 +1,27 @@
+-- ============================================================================
+-- 0016 - Logs, errores y eventos de navegación enviados por la app Flutter
+-- ============================================================================
+-- Antes sólo se reenviaban a los dashboards conectados; ahora se guardan con
+-- retención (DEBUG_EVENTS_RETENTION / DEBUG_EVENTS_MAX) para consultarlos.
+
+CREATE TABLE IF NOT EXISTS app_debug_events (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	kind VARCHAR(12) NOT NULL COMMENT 'log, error, navigation',
+	level VARCHAR(10) NOT NULL COMMENT 'debug, info, warn, error',
+	device_id VARCHAR(100) NULL DEFAULT NULL,
+	session_id VARCHAR(100) NULL DEFAULT NULL COMMENT 'Sesión de la app (arranque a cierre)',
+	user_id BIGINT NULL DEFAULT NULL,
+	event_type VARCHAR(60) NULL DEFAULT NULL COMMENT 'errorType o eventType de navegación',
+	message TEXT NOT NULL,
+	stack_trace MEDIUMTEXT NULL DEFAULT NULL,
+	fingerprint CHAR(40) NULL DEFAULT NULL COMMENT 'SHA-1 del tipo y stack normalizado (errores)',
+	metadata LONGTEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NULL DEFAULT NULL CHECK (json_valid(metadata)),
+	occurred_at TIMESTAMP(3) NOT NULL COMMENT 'Reloj del dispositivo (o de llegada si no lo envía)',
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	KEY idx_app_debug_events_device (device_id, occurred_at),
+	KEY idx_app_debug_events_session (session_id, occurred_at),
+	KEY idx_app_debug_events_level (kind, level, occurred_at),
+	KEY idx_app_debug_events_fingerprint (fingerprint, occurred_at),
+	KEY idx_app_debug_events_created (created_at),
+	CONSTRAINT fk_app_debug_events_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,6 @@
+ALTER TABLE location_shares
+	DROP COLUMN IF EXISTS next_stop_eta,
+	DROP COLUMN IF EXISTS next_stop,
+	DROP COLUMN IF EXISTS bus_route,
+	DROP COLUMN IF EXISTS speed,
+	DROP COLUMN IF EXISTS heading;
@@ -0,0 +1,13 @@
+-- ============================================================================
+-- 0017 - Rumbo, velocidad y viaje activo en las ubicaciones compartidas
+-- ============================================================================
+-- Cada PUT /api/shares/:id/location reemplaza estos campos y se transmite a
+-- quienes siguen el share por GET /api/shares/:id/stream.
+-- ============================================================================
+
+ALTER TABLE location_shares
+	ADD COLUMN IF NOT EXISTS heading DOUBLE NULL DEFAULT NULL COMMENT 'Grados desde el norte (0-360)' AFTER longitude,
+	ADD COLUMN IF NOT EXISTS speed DOUBLE NULL DEFAULT NULL COMMENT 'm/s' AFTER heading,
+	ADD COLUMN IF NOT EXISTS bus_route VARCHAR(100) NULL DEFAULT NULL COMMENT 'Ruta del viaje activo' AFTER speed,
+	ADD COLUMN IF NOT EXISTS next_stop VARCHAR(255) NULL DEFAULT NULL COMMENT 'Próximo paradero del viaje activo' AFTER bus_route,
+	ADD COLUMN IF NOT EXISTS next_stop_eta TIMESTAMP NULL DEFAULT NULL AFTER next_stop;
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS location_share_alerts;
+DROP TABLE IF EXISTS location_share_points;
+ALTER TABLE location_shares
+	DROP COLUMN IF EXISTS stationary_minutes,
+	DROP COLUMN IF EXISTS deviation_threshold_m,
+	DROP COLUMN IF EXISTS planned_route,
+	DROP COLUMN IF EXISTS destination_name,
+	DROP COLUMN IF EXISTS destination_lon,
+	DROP COLUMN IF EXISTS destination_lat;
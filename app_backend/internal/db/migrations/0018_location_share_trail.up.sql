@@ -0,0 +1,39 @@
+-- ============================================================================
+-- 0018 - Recorrido (breadcrumbs) y alertas de las ubicaciones compartidas
+-- ============================================================================
+-- Un share puede llevar destino y ruta planificada: con cada posición el
+-- backend detecta llegada, desvío de la ruta y detención prolongada.
+-- ============================================================================
+
+ALTER TABLE location_shares
+	ADD COLUMN IF NOT EXISTS destination_lat DOUBLE NULL DEFAULT NULL AFTER next_stop_eta,
+	ADD COLUMN IF NOT EXISTS destination_lon DOUBLE NULL DEFAULT NULL AFTER destination_lat,
+	ADD COLUMN IF NOT EXISTS destination_name VARCHAR(255) NULL DEFAULT NULL AFTER destination_lon,
+	ADD COLUMN IF NOT EXISTS planned_route LONGTEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NULL DEFAULT NULL COMMENT 'JSON [[lon, lat], ...]' CHECK (json_valid(planned_route)) AFTER destination_name,
+	ADD COLUMN IF NOT EXISTS deviation_threshold_m DOUBLE NULL DEFAULT NULL COMMENT 'Distancia a la ruta que cuenta como desvío' AFTER planned_route,
+	ADD COLUMN IF NOT EXISTS stationary_minutes INT NULL DEFAULT NULL COMMENT 'Minutos sin moverse que generan alerta (NULL/0 = no)' AFTER deviation_threshold_m;
+
+CREATE TABLE IF NOT EXISTS location_share_points (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	share_id VARCHAR(64) NOT NULL,
+	latitude DOUBLE NOT NULL,
+	longitude DOUBLE NOT NULL,
+	heading DOUBLE NULL DEFAULT NULL,
+	speed DOUBLE NULL DEFAULT NULL,
+	recorded_at TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	KEY idx_location_share_points_share (share_id, id),
+	CONSTRAINT fk_location_share_points_share FOREIGN KEY (share_id) REFERENCES location_shares(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS location_share_alerts (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	share_id VARCHAR(64) NOT NULL,
+	kind VARCHAR(20) NOT NULL COMMENT 'arrived, off_route, back_on_route, stationary',
+	message VARCHAR(255) NOT NULL,
+	latitude DOUBLE NOT NULL,
+	longitude DOUBLE NOT NULL,
+	distance_m DOUBLE NULL DEFAULT NULL COMMENT 'Al destino o a la ruta, según kind',
+	created_at TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+	KEY idx_location_share_alerts_share (share_id, id),
+	CONSTRAINT fk_location_share_alerts_share FOREIGN KEY (share_id) REFERENCES location_shares(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS location_share_access_log;
+DROP TABLE IF EXISTS location_share_recipients;
@@ -0,0 +1,35 @@
+-- ============================================================================
+-- 0019 - Receptores de las ubicaciones compartidas y registro de accesos
+-- ============================================================================
+-- Cada receptor recibe un token propio (sólo se guarda su hash SHA-256),
+-- opcionalmente protegido con PIN, que el dueño puede revocar por separado.
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS location_share_recipients (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	share_id VARCHAR(64) NOT NULL,
+	label VARCHAR(100) NULL DEFAULT NULL,
+	token_hash CHAR(64) NOT NULL,
+	pin_hash VARCHAR(255) NULL DEFAULT NULL COMMENT 'bcrypt; NULL = sin PIN',
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP NULL DEFAULT NULL,
+	last_access_at TIMESTAMP NULL DEFAULT NULL,
+	UNIQUE KEY uq_location_share_recipients_token (token_hash),
+	KEY idx_location_share_recipients_share (share_id),
+	CONSTRAINT fk_location_share_recipients_share FOREIGN KEY (share_id) REFERENCES location_shares(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS location_share_access_log (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	share_id VARCHAR(64) NOT NULL,
+	recipient_id BIGINT NULL DEFAULT NULL,
+	via VARCHAR(10) NOT NULL COMMENT 'page, api, stream',
+	outcome VARCHAR(20) NOT NULL COMMENT 'granted, pin_required, bad_pin, locked, revoked, ended',
+	ip_address VARCHAR(45) NULL DEFAULT NULL,
+	user_agent VARCHAR(255) NULL DEFAULT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	KEY idx_location_share_access_share (share_id, id),
+	KEY idx_location_share_access_recipient (recipient_id, outcome, created_at),
+	CONSTRAINT fk_location_share_access_share FOREIGN KEY (share_id) REFERENCES location_shares(id) ON DELETE CASCADE,
+	CONSTRAINT fk_location_share_access_recipient FOREIGN KEY (recipient_id) REFERENCES location_share_recipients(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
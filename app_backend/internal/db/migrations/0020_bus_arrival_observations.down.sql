@@ -0,0 +1 @@
+DROP TABLE IF EXISTS bus_arrival_observations;
@@ -0,0 +1,20 @@
+-- ============================================================================
+-- 0020 - Serie de tiempo de llegadas de Red.cl
+-- ============================================================================
+-- Una fila por bus visto en cada consulta a un paradero (distancia y minutos
+-- predichos) y otra por cada bus que acaba de pasar (passed = 1). Sobre ella
+-- se calculan headways, error de predicción y confiabilidad por ruta/hora.
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS bus_arrival_observations (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	stop_code VARCHAR(20) NOT NULL,
+	route VARCHAR(20) NOT NULL,
+	observed_at DATETIME NOT NULL,
+	distance_m MEDIUMINT UNSIGNED NULL DEFAULT NULL,
+	predicted_minutes SMALLINT UNSIGNED NULL DEFAULT NULL,
+	plate VARCHAR(12) NULL DEFAULT NULL,
+	passed TINYINT(1) NOT NULL DEFAULT 0,
+	KEY idx_bus_arrival_observations_stop (stop_code, route, observed_at),
+	KEY idx_bus_arrival_observations_time (observed_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
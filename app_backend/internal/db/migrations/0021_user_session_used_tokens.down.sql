@@ -0,0 +1,5 @@
+ALTER TABLE user_sessions
+	ADD COLUMN IF NOT EXISTS previous_token_hash CHAR(64) NULL AFTER refresh_token_hash,
+	ADD INDEX IF NOT EXISTS idx_user_sessions_previous (previous_token_hash);
+
+DROP TABLE IF EXISTS user_session_used_tokens;
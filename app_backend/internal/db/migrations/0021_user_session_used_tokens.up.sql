@@ -0,0 +1,22 @@
+-- ============================================================================
+-- 0021 - Refresh tokens ya usados por cada sesión
+-- ============================================================================
+-- Cada rotación guarda el hash del token que se reemplazó. Presentar cualquiera
+-- de ellos (no sólo el inmediatamente anterior) se trata como robo y revoca la
+-- sesión completa. Reemplaza a user_sessions.previous_token_hash.
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS user_session_used_tokens (
+	token_hash CHAR(64) PRIMARY KEY,
+	session_id VARCHAR(64) NOT NULL,
+	used_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	KEY idx_user_session_used_tokens_session (session_id),
+	FOREIGN KEY (session_id) REFERENCES user_sessions(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+INSERT IGNORE INTO user_session_used_tokens (token_hash, session_id)
+SELECT previous_token_hash, id FROM user_sessions WHERE previous_token_hash IS NOT NULL;
+
+ALTER TABLE user_sessions
+	DROP INDEX IF EXISTS idx_user_sessions_previous,
+	DROP COLUMN IF EXISTS previous_token_hash;
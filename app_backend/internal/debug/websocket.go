@@ -3,19 +3,165 @@ package debug
 import (
 	"encoding/json"
 	"log"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gofiber/websocket/v2"
 )
 
+// Valores por defecto del hub del dashboard
+const (
+	defaultReplaySize  = 200
+	defaultClientQueue = 256
+
+	// writeTimeout corta a un dashboard que no acepta escrituras
+	writeTimeout = 10 * time.Second
+)
+
+// Subscription filtra los mensajes que recibe un dashboard. Un campo vacío
+// acepta todo; Sources y Levels sólo se aplican a los mensajes que los traen
+// (los logs), así que metrics/api_status/scraping_status pasan si su tipo pasa.
+type Subscription struct {
+	Types   []string `json:"types,omitempty"`
+	Sources []string `json:"sources,omitempty"`
+	Levels  []string `json:"levels,omitempty"`
+}
+
+// Matches indica si el mensaje pasa el filtro
+func (s Subscription) Matches(e envelope) bool {
+	return matchesAny(s.Types, e.kind) && matchesAny(s.Sources, e.source) && matchesAny(s.Levels, e.level)
+}
+
+func matchesAny(allowed []string, value string) bool {
+	if len(allowed) == 0 || value == "" {
+		return true
+	}
+	for _, a := range allowed {
+		if a == value {
+			return true
+		}
+	}
+	return false
+}
+
+// splitFilter convierte "log, metrics" en ["log","metrics"]
+func splitFilter(raw string) []string {
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.ToLower(strings.TrimSpace(part)); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func normalizeFilter(values []string) []string {
+	return splitFilter(strings.Join(values, ","))
+}
+
+// envelope es un mensaje ya serializado junto con los campos por los que se filtra
+type envelope struct {
+	kind   string
+	source string
+	level  string
+	data   []byte
+}
+
+// ring guarda los últimos mensajes para reenviarlos a quien se conecta
+type ring struct {
+	items []envelope
+	next  int
+	full  bool
+}
+
+func newRing(size int) *ring {
+	return &ring{items: make([]envelope, size)}
+}
+
+func (r *ring) push(e envelope) {
+	r.items[r.next] = e
+	r.next = (r.next + 1) % len(r.items)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// last retorna, del más antiguo al más nuevo, hasta n mensajes que pasan el filtro
+func (r *ring) last(n int, sub Subscription) []envelope {
+	if n <= 0 {
+		return nil
+	}
+	ordered := r.items[:r.next]
+	if r.full {
+		ordered = append(append([]envelope{}, r.items[r.next:]...), r.items[:r.next]...)
+	}
+
+	var matched []envelope
+	for _, e := range ordered {
+		if sub.Matches(e) {
+			matched = append(matched, e)
+		}
+	}
+	if len(matched) > n {
+		matched = matched[len(matched)-n:]
+	}
+	return matched
+}
+
+// client es un dashboard conectado: su cola de envío es propia, así que uno
+// lento pierde mensajes (y se le avisa) sin frenar el broadcast de los demás
+type client struct {
+	conn     *websocket.Conn
+	username string
+	send     chan []byte
+	dropped  atomic.Int64
+
+	mu  sync.RWMutex
+	sub Subscription
+}
+
+func (c *client) subscription() Subscription {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.sub
+}
+
+func (c *client) setSubscription(sub Subscription) {
+	c.mu.Lock()
+	c.sub = sub
+	c.mu.Unlock()
+}
+
+// enqueue nunca bloquea: con la cola llena el mensaje se descarta y se cuenta
+func (c *client) enqueue(data []byte) bool {
+	select {
+	case c.send <- data:
+		return true
+	default:
+		c.dropped.Add(1)
+		return false
+	}
+}
+
+// replayRequest pide reenviar el historial tras un cambio de suscripción
+type replayRequest struct {
+	client *client
+	limit  int
+}
+
 // WebSocketHub maneja las conexiones WebSocket del dashboard de debugging
 type WebSocketHub struct {
-	clients    map[*websocket.Conn]bool
-	broadcast  chan []byte
-	register   chan *websocket.Conn
-	unregister chan *websocket.Conn
-	mu         sync.RWMutex
+	clients    map[*client]bool
+	broadcast  chan envelope
+	register   chan replayRequest
+	unregister chan *client
+	replay     chan replayRequest
+	history    *ring
+	count      atomic.Int32
 }
 
 var (
@@ -24,64 +170,210 @@ var (
 
 func init() {
 	Hub = &WebSocketHub{
-		broadcast:  make(chan []byte, 256),
-		register:   make(chan *websocket.Conn),
-		unregister: make(chan *websocket.Conn),
-		clients:    make(map[*websocket.Conn]bool),
+		broadcast:  make(chan envelope, 256),
+		register:   make(chan replayRequest),
+		unregister: make(chan *client),
+		replay:     make(chan replayRequest),
+		clients:    make(map[*client]bool),
 	}
 	go Hub.run()
 }
 
+// replaySize lee DEBUG_WS_REPLAY_SIZE: cuántos mensajes guarda el historial.
+// Se lee al primer uso y no en init, para que aplique lo cargado desde .env.
+func replaySize() int {
+	return envPositiveInt("DEBUG_WS_REPLAY_SIZE", defaultReplaySize)
+}
+
+// clientQueueSize lee DEBUG_WS_CLIENT_QUEUE: mensajes pendientes por dashboard
+func clientQueueSize() int {
+	return envPositiveInt("DEBUG_WS_CLIENT_QUEUE", defaultClientQueue)
+}
+
+func envPositiveInt(key string, fallback int) int {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		log.Printf("⚠️  %s inválido (%q), usando %d", key, raw, fallback)
+		return fallback
+	}
+	return n
+}
+
+// ClientCount retorna cuántos dashboards están conectados
+func (h *WebSocketHub) ClientCount() int {
+	return int(h.count.Load())
+}
+
 func (h *WebSocketHub) run() {
 	for {
 		select {
-		case client := <-h.register:
-			h.mu.Lock()
-			h.clients[client] = true
-			h.mu.Unlock()
-			log.Printf("🔌 Dashboard conectado. Total clientes: %d", len(h.clients))
-
-		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				client.Close()
+		case req := <-h.register:
+			h.clients[req.client] = true
+			h.count.Store(int32(len(h.clients)))
+			log.Printf("🔌 Dashboard conectado (%s). Total clientes: %d", req.client.username, len(h.clients))
+			h.sendReplay(req)
+
+		case req := <-h.replay:
+			if h.clients[req.client] {
+				h.sendReplay(req)
 			}
-			h.mu.Unlock()
-			log.Printf("🔌 Dashboard desconectado. Total clientes: %d", len(h.clients))
-
-		case message := <-h.broadcast:
-			h.mu.RLock()
-			for client := range h.clients {
-				err := client.WriteMessage(websocket.TextMessage, message)
-				if err != nil {
-					log.Printf("Error enviando mensaje al dashboard: %v", err)
-					client.Close()
-					delete(h.clients, client)
+
+		case c := <-h.unregister:
+			if _, ok := h.clients[c]; ok {
+				delete(h.clients, c)
+				close(c.send)
+				h.count.Store(int32(len(h.clients)))
+				log.Printf("🔌 Dashboard desconectado (%s). Total clientes: %d", c.username, len(h.clients))
+			}
+
+		case e := <-h.broadcast:
+			h.ensureHistory().push(e)
+			for c := range h.clients {
+				if c.subscription().Matches(e) {
+					c.enqueue(e.data)
 				}
 			}
-			h.mu.RUnlock()
 		}
 	}
 }
 
-// HandleWebSocketFiber maneja las conexiones WebSocket de Fiber
-func HandleWebSocketFiber(conn *websocket.Conn) {
-	Hub.register <- conn
+func (h *WebSocketHub) ensureHistory() *ring {
+	if h.history == nil {
+		h.history = newRing(replaySize())
+	}
+	return h.history
+}
+
+// sendReplay encola el historial que pasa el filtro del cliente y luego la
+// confirmación "subscribed" con su filtro vigente
+func (h *WebSocketHub) sendReplay(req replayRequest) {
+	sub := req.client.subscription()
+	replayed := h.ensureHistory().last(req.limit, sub)
+	for _, e := range replayed {
+		req.client.enqueue(e.data)
+	}
+
+	ack, err := json.Marshal(struct {
+		Type         string       `json:"type"`
+		Subscription Subscription `json:"subscription"`
+		Replayed     int          `json:"replayed"`
+	}{"subscribed", sub, len(replayed)})
+	if err == nil {
+		req.client.enqueue(ack)
+	}
+}
+
+// publish entrega el mensaje al hub sin bloquear a quien loguea
+func (h *WebSocketHub) publish(e envelope) {
+	select {
+	case h.broadcast <- e:
+	default:
+		// Canal lleno, saltar mensaje
+	}
+}
+
+// subscribeCommand es el mensaje que el dashboard envía para cambiar su filtro:
+// {"type":"subscribe","types":["log"],"levels":["warn","error"],"replay":50}
+type subscribeCommand struct {
+	Type string `json:"type"`
+	Subscription
+	Replay int `json:"replay"`
+}
 
-	// Leer mensajes del cliente (para comandos futuros)
-	defer func() {
-		Hub.unregister <- conn
+// subscriptionFromQuery arma el filtro inicial con ?types=&sources=&levels=
+// y cuántos mensajes del historial reenviar (?replay=, por defecto todos)
+func subscriptionFromQuery(conn *websocket.Conn) (Subscription, int) {
+	sub := Subscription{
+		Types:   splitFilter(conn.Query("types")),
+		Sources: splitFilter(conn.Query("sources")),
+		Levels:  splitFilter(conn.Query("levels")),
+	}
+
+	limit := replaySize()
+	if raw := strings.TrimSpace(conn.Query("replay")); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n >= 0 {
+			limit = n
+		}
+	}
+	return sub, limit
+}
+
+// HandleWebSocketFiber atiende a un dashboard ya autenticado: lee sus comandos
+// en una goroutine y escribe su cola en ésta, hasta que alguna de las dos falle
+func HandleWebSocketFiber(conn *websocket.Conn, username string) {
+	sub, limit := subscriptionFromQuery(conn)
+	c := &client{
+		conn:     conn,
+		username: username,
+		send:     make(chan []byte, clientQueueSize()),
+		sub:      sub,
+	}
+	Hub.register <- replayRequest{client: c, limit: limit}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.readCommands()
+		Hub.unregister <- c
 	}()
-	
+
+	c.writeQueue()
+	Hub.unregister <- c
+	conn.Close()
+	<-done
+}
+
+// readCommands procesa los comandos del dashboard hasta que se cierre la conexión
+func (c *client) readCommands() {
 	for {
-		_, _, err := conn.ReadMessage()
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
-			break
+			return
+		}
+
+		var cmd subscribeCommand
+		if err := json.Unmarshal(data, &cmd); err != nil || cmd.Type != "subscribe" {
+			continue // Otros comandos se ignoran por ahora
+		}
+		c.setSubscription(Subscription{
+			Types:   normalizeFilter(cmd.Types),
+			Sources: normalizeFilter(cmd.Sources),
+			Levels:  normalizeFilter(cmd.Levels),
+		})
+		Hub.replay <- replayRequest{client: c, limit: cmd.Replay}
+	}
+}
+
+// writeQueue escribe la cola del cliente; tras cada escritura avisa cuántos
+// mensajes se descartaron por tenerla llena
+func (c *client) writeQueue() {
+	for data := range c.send {
+		if err := c.write(data); err != nil {
+			log.Printf("Error enviando mensaje al dashboard: %v", err)
+			return
+		}
+
+		if dropped := c.dropped.Swap(0); dropped > 0 {
+			log.Printf("⚠️  Dashboard lento (%s): %d mensajes descartados", c.username, dropped)
+			notice, _ := json.Marshal(map[string]interface{}{"type": "dropped", "count": dropped})
+			if err := c.write(notice); err != nil {
+				return
+			}
 		}
 	}
 }
 
+func (c *client) write(data []byte) error {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
 // LogMessage representa un mensaje de log para el dashboard
 type LogMessage struct {
 	Type     string                 `json:"type"`
@@ -93,10 +385,6 @@ type LogMessage struct {
 
 // SendLog envía un log al dashboard
 func SendLog(source, level, message string, metadata map[string]interface{}) {
-	if Hub == nil || len(Hub.clients) == 0 {
-		return // No hay clientes conectados
-	}
-
 	msg := LogMessage{
 		Type:     "log",
 		Source:   source,
@@ -111,11 +399,7 @@ func SendLog(source, level, message string, metadata map[string]interface{}) {
 		return
 	}
 
-	select {
-	case Hub.broadcast <- data:
-	default:
-		// Canal lleno, saltar mensaje
-	}
+	Hub.publish(envelope{kind: msg.Type, source: source, level: level, data: data})
 }
 
 // MetricsMessage representa métricas del sistema
@@ -133,10 +417,6 @@ type Metric struct {
 
 // SendMetrics envía métricas al dashboard
 func SendMetrics(metrics []Metric) {
-	if Hub == nil || len(Hub.clients) == 0 {
-		return
-	}
-
 	msg := MetricsMessage{
 		Type:    "metrics",
 		Metrics: metrics,
@@ -148,10 +428,7 @@ func SendMetrics(metrics []Metric) {
 		return
 	}
 
-	select {
-	case Hub.broadcast <- data:
-	default:
-	}
+	Hub.publish(envelope{kind: msg.Type, data: data})
 }
 
 // ApiStatusMessage representa el estado de las APIs
@@ -182,10 +459,6 @@ var startTime = time.Now()
 
 // SendApiStatus envía el estado de las APIs al dashboard
 func SendApiStatus(status ApiStatus) {
-	if Hub == nil || len(Hub.clients) == 0 {
-		return
-	}
-
 	// Calcular uptime
 	status.Backend.Uptime = int64(time.Since(startTime).Seconds())
 
@@ -200,10 +473,7 @@ func SendApiStatus(status ApiStatus) {
 		return
 	}
 
-	select {
-	case Hub.broadcast <- data:
-	default:
-	}
+	Hub.publish(envelope{kind: msg.Type, data: data})
 }
 
 // ScrapingStatusMessage representa el estado del scraping
@@ -229,10 +499,6 @@ type ScrapingStatus struct {
 
 // SendScrapingStatus envía el estado del scraping al dashboard
 func SendScrapingStatus(status ScrapingStatus) {
-	if Hub == nil || len(Hub.clients) == 0 {
-		return
-	}
-
 	msg := ScrapingStatusMessage{
 		Type:   "scraping_status",
 		Status: status,
@@ -244,8 +510,5 @@ func SendScrapingStatus(status ScrapingStatus) {
 		return
 	}
 
-	select {
-	case Hub.broadcast <- data:
-	default:
-	}
+	Hub.publish(envelope{kind: msg.Type, data: data})
 }
@@ -16,7 +16,6 @@ import (
 	"os"
 	"os/exec"
 	"strings"
-	"syscall"
 	"time"
 )
 
@@ -132,9 +131,7 @@ func StartGraphHopperProcess() error {
 	ghProcess = exec.Command("powershell", "-Command", psCommand)
 
 	// CRÍTICO: Configurar para que el proceso hijo tenga su propia ventana
-	ghProcess.SysProcAttr = &syscall.SysProcAttr{
-		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | 0x00000010, // CREATE_NEW_CONSOLE
-	}
+	ghProcess.SysProcAttr = newConsoleProcAttr()
 
 	// Iniciar proceso (esto abrirá una nueva ventana de PowerShell)
 	if err := ghProcess.Start(); err != nil {
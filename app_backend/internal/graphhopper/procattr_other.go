@@ -0,0 +1,11 @@
+//go:build !windows
+
+package graphhopper
+
+import "syscall"
+
+// newConsoleProcAttr sólo separa el grupo de procesos: fuera de Windows no
+// hay consola que abrir (el arranque vía PowerShell es para desarrollo local)
+func newConsoleProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
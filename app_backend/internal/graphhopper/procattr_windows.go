@@ -0,0 +1,13 @@
+//go:build windows
+
+package graphhopper
+
+import "syscall"
+
+// newConsoleProcAttr abre el proceso hijo en su propia consola y grupo de
+// procesos, para que un Ctrl+C en el backend no lo mate de rebote
+func newConsoleProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | 0x00000010, // CREATE_NEW_CONSOLE
+	}
+}
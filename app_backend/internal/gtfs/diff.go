@@ -0,0 +1,628 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// insertBatchSize filas por INSERT multi-valor (muy por debajo del límite de placeholders de MariaDB)
+	insertBatchSize = 500
+	// maxReportedIDs limita cuántos IDs se listan por categoría en el reporte de cambios
+	maxReportedIDs = 200
+)
+
+// ChangeSet lista los IDs agregados, eliminados y modificados de una entidad GTFS.
+// Las listas se truncan a maxReportedIDs; los contadores siempre son exactos.
+type ChangeSet struct {
+	AddedCount    int      `json:"added_count"`
+	RemovedCount  int      `json:"removed_count"`
+	ModifiedCount int      `json:"modified_count"`
+	Added         []string `json:"added,omitempty"`
+	Removed       []string `json:"removed,omitempty"`
+	Modified      []string `json:"modified,omitempty"`
+	Truncated     bool     `json:"truncated,omitempty"`
+}
+
+// ChangeReport resume qué cambió entre el feed anterior y el nuevo
+type ChangeReport struct {
+	Stops                   ChangeSet `json:"stops"`
+	Routes                  ChangeSet `json:"routes"`
+	Trips                   ChangeSet `json:"trips"`
+	StopTimesTripsRewritten int       `json:"stop_times_trips_rewritten"`
+}
+
+func newChangeSet(added, removed, modified []string) ChangeSet {
+	cs := ChangeSet{
+		AddedCount:    len(added),
+		RemovedCount:  len(removed),
+		ModifiedCount: len(modified),
+	}
+	clip := func(ids []string) []string {
+		sort.Strings(ids)
+		if len(ids) > maxReportedIDs {
+			cs.Truncated = true
+			return ids[:maxReportedIDs]
+		}
+		return ids
+	}
+	cs.Added = clip(added)
+	cs.Removed = clip(removed)
+	cs.Modified = clip(modified)
+	return cs
+}
+
+// ============================================================================
+// Hashes de archivos
+// ============================================================================
+
+// fileDigest calcula el SHA-256 del contenido descomprimido de un archivo del feed
+func fileDigest(file *zip.File) (string, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("gtfs loader: open %s: %w", file.Name, err)
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		return "", fmt.Errorf("gtfs loader: hash %s: %w", file.Name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// baseFeedFiles retorna el feed contra el que se compara uno nuevo y los hashes de sus archivos:
+// la generación activa o, si todavía no hay una, el último feed importado sin generación.
+func baseFeedFiles(ctx context.Context, db *sql.DB) (int64, map[string]string, error) {
+	feedID, err := ActiveGeneration(ctx, db)
+	if err != nil {
+		return 0, nil, err
+	}
+	if feedID == 0 {
+		if err := db.QueryRowContext(ctx, `
+			SELECT COALESCE(MAX(ff.feed_id), 0)
+			FROM gtfs_feed_files ff
+			LEFT JOIN gtfs_generations g ON g.feed_id = ff.feed_id
+			WHERE g.feed_id IS NULL
+		`).Scan(&feedID); err != nil {
+			return 0, nil, fmt.Errorf("gtfs loader: query previous feed: %w", err)
+		}
+	}
+	if feedID == 0 {
+		return 0, map[string]string{}, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT file_name, content_hash FROM gtfs_feed_files WHERE feed_id = ?`, feedID)
+	if err != nil {
+		return 0, nil, fmt.Errorf("gtfs loader: query previous feed files: %w", err)
+	}
+	defer rows.Close()
+
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var name, hash string
+		if err := rows.Scan(&name, &hash); err != nil {
+			return 0, nil, fmt.Errorf("gtfs loader: scan previous feed files: %w", err)
+		}
+		hashes[name] = hash
+	}
+	return feedID, hashes, rows.Err()
+}
+
+// changedFiles compara hashes actuales contra los del feed anterior (incluye archivos que desaparecieron)
+func changedFiles(current, previous map[string]string) []string {
+	var changed []string
+	for name, hash := range current {
+		if previous[name] != hash {
+			changed = append(changed, name)
+		}
+	}
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// ============================================================================
+// Inserción por lotes
+// ============================================================================
+
+// batchInserter agrupa filas en INSERTs multi-valor. Si un lote falla (p. ej. una FK
+// inválida) se reintenta fila por fila para no perder el resto del lote.
+type batchInserter struct {
+	ctx      context.Context
+	tx       *sql.Tx
+	table    string
+	columns  []string
+	rows     [][]interface{}
+	inserted int
+	failed   int
+}
+
+func newBatchInserter(ctx context.Context, tx *sql.Tx, table string, columns []string) *batchInserter {
+	return &batchInserter{
+		ctx:     ctx,
+		tx:      tx,
+		table:   table,
+		columns: columns,
+		rows:    make([][]interface{}, 0, insertBatchSize),
+	}
+}
+
+func (b *batchInserter) Add(values ...interface{}) error {
+	b.rows = append(b.rows, values)
+	if len(b.rows) >= insertBatchSize {
+		return b.Flush()
+	}
+	return nil
+}
+
+func (b *batchInserter) Flush() error {
+	if len(b.rows) == 0 {
+		return nil
+	}
+	rows := b.rows
+	b.rows = make([][]interface{}, 0, insertBatchSize)
+
+	placeholder := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(b.columns)), ", ") + ")"
+	prefix := "INSERT INTO " + b.table + " (" + strings.Join(b.columns, ", ") + ") VALUES "
+
+	args := make([]interface{}, 0, len(rows)*len(b.columns))
+	for _, row := range rows {
+		args = append(args, row...)
+	}
+	query := prefix + strings.TrimSuffix(strings.Repeat(placeholder+", ", len(rows)), ", ")
+	if _, err := b.tx.ExecContext(b.ctx, query, args...); err == nil {
+		b.inserted += len(rows)
+		return nil
+	}
+
+	// Reintento fila por fila para aislar los registros inválidos
+	for _, row := range rows {
+		if err := b.ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := b.tx.ExecContext(b.ctx, prefix+placeholder, row...); err != nil {
+			b.failed++
+			if b.failed <= 20 {
+				fmt.Printf("gtfs loader: insert into %s failed: %v\n", b.table, err)
+			}
+			continue
+		}
+		b.inserted++
+	}
+	return nil
+}
+
+// deleteByKeys elimina filas por clave en lotes de DELETE ... IN (...)
+func deleteByKeys(ctx context.Context, tx *sql.Tx, table, column string, keys []string) (int64, error) {
+	var total int64
+	for start := 0; start < len(keys); start += insertBatchSize {
+		end := start + insertBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		chunk := keys[start:end]
+		args := make([]interface{}, len(chunk))
+		for i, k := range chunk {
+			args[i] = k
+		}
+		query := "DELETE FROM " + table + " WHERE " + column + " IN (" +
+			strings.TrimSuffix(strings.Repeat("?, ", len(chunk)), ", ") + ")"
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return total, fmt.Errorf("gtfs loader: delete from %s: %w", table, err)
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			total += n
+		}
+	}
+	return total, nil
+}
+
+// ============================================================================
+// Diff de tablas con clave (stops, routes, trips)
+// ============================================================================
+
+type columnKind int
+
+const (
+	kindString columnKind = iota
+	kindInt
+	kindFloat
+)
+
+type diffColumn struct {
+	name string
+	kind columnKind
+}
+
+// keyedTable describe cómo comparar un archivo GTFS contra su tabla por ID.
+// table es el nombre base; el diff se aplica sobre la tabla de la generación en construcción.
+type keyedTable struct {
+	file    string
+	table   string
+	key     string
+	columns []diffColumn
+	// parse retorna el ID y los valores en el orden de columns (string, int64 o float64)
+	parse func(record []string, idx map[string]int) (string, []interface{}, bool)
+}
+
+type keyedResult struct {
+	added    []string
+	removed  []string
+	modified []string
+	written  int
+}
+
+var stopsTable = keyedTable{
+	file:  "stops.txt",
+	table: "gtfs_stops",
+	key:   "stop_id",
+	columns: []diffColumn{
+		{"code", kindString}, {"name", kindString}, {"description", kindString},
+		{"latitude", kindFloat}, {"longitude", kindFloat}, {"zone_id", kindString},
+		{"wheelchair_boarding", kindInt},
+	},
+	parse: func(record []string, idx map[string]int) (string, []interface{}, bool) {
+		stopID := safeField(record, idx, "stop_id")
+		if stopID == "" {
+			return "", nil, false
+		}
+		lat, err := strconv.ParseFloat(safeField(record, idx, "stop_lat"), 64)
+		if err != nil {
+			return "", nil, false
+		}
+		lon, err := strconv.ParseFloat(safeField(record, idx, "stop_lon"), 64)
+		if err != nil {
+			return "", nil, false
+		}
+		return stopID, []interface{}{
+			safeField(record, idx, "stop_code"),
+			safeField(record, idx, "stop_name"),
+			safeField(record, idx, "stop_desc"),
+			lat, lon,
+			safeField(record, idx, "zone_id"),
+			int64(atoiDefault(safeField(record, idx, "wheelchair_boarding"), 0)),
+		}, true
+	},
+}
+
+var routesTable = keyedTable{
+	file:  "routes.txt",
+	table: "gtfs_routes",
+	key:   "route_id",
+	columns: []diffColumn{
+		{"short_name", kindString}, {"long_name", kindString}, {"type", kindInt},
+		{"color", kindString}, {"text_color", kindString},
+	},
+	parse: func(record []string, idx map[string]int) (string, []interface{}, bool) {
+		routeID := safeField(record, idx, "route_id")
+		if routeID == "" {
+			return "", nil, false
+		}
+		return routeID, []interface{}{
+			safeField(record, idx, "route_short_name"),
+			safeField(record, idx, "route_long_name"),
+			int64(atoiDefault(safeField(record, idx, "route_type"), 0)),
+			safeField(record, idx, "route_color"),
+			safeField(record, idx, "route_text_color"),
+		}, true
+	},
+}
+
+var tripsTable = keyedTable{
+	file:  "trips.txt",
+	table: "gtfs_trips",
+	key:   "trip_id",
+	columns: []diffColumn{
+		{"route_id", kindString}, {"service_id", kindString}, {"headsign", kindString},
+		{"direction_id", kindInt}, {"shape_id", kindString},
+	},
+	parse: func(record []string, idx map[string]int) (string, []interface{}, bool) {
+		tripID := safeField(record, idx, "trip_id")
+		routeID := safeField(record, idx, "route_id")
+		if tripID == "" || routeID == "" {
+			return "", nil, false
+		}
+		return tripID, []interface{}{
+			routeID,
+			safeField(record, idx, "service_id"),
+			safeField(record, idx, "trip_headsign"),
+			int64(atoiDefault(safeField(record, idx, "direction_id"), 0)),
+			safeField(record, idx, "shape_id"),
+		}, true
+	},
+}
+
+// rowDigest genera un hash estable de los valores de una fila
+func rowDigest(values ...interface{}) uint64 {
+	h := fnv.New64a()
+	for _, v := range values {
+		switch val := v.(type) {
+		case string:
+			h.Write([]byte(val))
+		case int64:
+			h.Write([]byte(strconv.FormatInt(val, 10)))
+		case float64:
+			h.Write([]byte(strconv.FormatFloat(val, 'g', -1, 64)))
+		}
+		h.Write([]byte{0x1f})
+	}
+	return h.Sum64()
+}
+
+// existingDigests lee la tabla actual y calcula el hash de cada fila por ID
+func existingDigests(ctx context.Context, tx *sql.Tx, spec keyedTable, table string) (map[string]uint64, error) {
+	names := make([]string, len(spec.columns))
+	for i, col := range spec.columns {
+		names[i] = col.name
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT "+spec.key+", "+strings.Join(names, ", ")+" FROM "+table)
+	if err != nil {
+		return nil, fmt.Errorf("gtfs loader: read %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	digests := make(map[string]uint64)
+	dest := make([]interface{}, len(spec.columns)+1)
+	var id string
+	dest[0] = &id
+	strs := make([]sql.NullString, len(spec.columns))
+	ints := make([]sql.NullInt64, len(spec.columns))
+	floats := make([]sql.NullFloat64, len(spec.columns))
+	for i, col := range spec.columns {
+		switch col.kind {
+		case kindInt:
+			dest[i+1] = &ints[i]
+		case kindFloat:
+			dest[i+1] = &floats[i]
+		default:
+			dest[i+1] = &strs[i]
+		}
+	}
+
+	values := make([]interface{}, len(spec.columns))
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("gtfs loader: scan %s: %w", table, err)
+		}
+		for i, col := range spec.columns {
+			switch col.kind {
+			case kindInt:
+				values[i] = ints[i].Int64
+			case kindFloat:
+				values[i] = floats[i].Float64
+			default:
+				values[i] = strs[i].String
+			}
+		}
+		digests[id] = rowDigest(values...)
+	}
+	return digests, rows.Err()
+}
+
+// applyKeyedDiff inserta filas nuevas y actualiza las modificadas. Las eliminadas
+// solo se reportan: se borran al final para respetar las foreign keys.
+func applyKeyedDiff(ctx context.Context, tx *sql.Tx, feedID int64, spec keyedTable, table string, file *zip.File) (*keyedResult, error) {
+	existing, err := existingDigests(ctx, tx, spec, table)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, reader, idx, err := openCSV(file)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	names := make([]string, len(spec.columns))
+	sets := make([]string, len(spec.columns))
+	for i, col := range spec.columns {
+		names[i] = col.name
+		sets[i] = col.name + " = ?"
+	}
+	inserter := newBatchInserter(ctx, tx, table, append([]string{spec.key, "feed_id"}, names...))
+	update, err := tx.PrepareContext(ctx, "UPDATE "+table+" SET feed_id = ?, "+strings.Join(sets, ", ")+" WHERE "+spec.key+" = ?")
+	if err != nil {
+		return nil, fmt.Errorf("gtfs loader: prepare update %s: %w", table, err)
+	}
+	defer update.Close()
+
+	result := &keyedResult{}
+	seen := make(map[string]bool, len(existing))
+	skipped := 0
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			skipped++
+			continue
+		}
+		id, values, ok := spec.parse(record, idx)
+		if !ok || seen[id] {
+			skipped++
+			continue
+		}
+		seen[id] = true
+
+		prev, exists := existing[id]
+		switch {
+		case !exists:
+			if err := inserter.Add(append([]interface{}{id, feedID}, values...)...); err != nil {
+				return nil, err
+			}
+			result.added = append(result.added, id)
+		case prev != rowDigest(values...):
+			args := append(append([]interface{}{feedID}, values...), id)
+			if _, err := update.ExecContext(ctx, args...); err != nil {
+				skipped++
+				continue
+			}
+			result.modified = append(result.modified, id)
+			result.written++
+		}
+	}
+	if err := inserter.Flush(); err != nil {
+		return nil, err
+	}
+	result.written += inserter.inserted
+
+	for id := range existing {
+		if !seen[id] {
+			result.removed = append(result.removed, id)
+		}
+	}
+
+	fmt.Printf("   %s: +%d ~%d -%d (skipped: %d, failed inserts: %d)\n",
+		spec.file, len(result.added), len(result.modified), len(result.removed), skipped, inserter.failed)
+	return result, nil
+}
+
+// ============================================================================
+// Diff de stop_times (por viaje)
+// ============================================================================
+
+// tripDigest es un hash independiente del orden de las filas de un viaje
+type tripDigest struct {
+	sum  uint64
+	rows int
+}
+
+func (d *tripDigest) add(seq int64, arrival, departure, stopID string) {
+	d.sum += rowDigest(seq, arrival, departure, stopID)
+	d.rows++
+}
+
+// applyStopTimesDiff reescribe solo los horarios de viajes cuyo contenido cambió
+func applyStopTimesDiff(ctx context.Context, tx *sql.Tx, feedID int64, table string, file *zip.File) (int, int, error) {
+	existing := make(map[string]*tripDigest)
+	rows, err := tx.QueryContext(ctx, "SELECT trip_id, stop_sequence, arrival_time, departure_time, stop_id FROM "+table)
+	if err != nil {
+		return 0, 0, fmt.Errorf("gtfs loader: read stop_times: %w", err)
+	}
+	for rows.Next() {
+		var tripID, stopID string
+		var seq int64
+		var arrival, departure sql.NullString
+		if err := rows.Scan(&tripID, &seq, &arrival, &departure, &stopID); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("gtfs loader: scan stop_times: %w", err)
+		}
+		d := existing[tripID]
+		if d == nil {
+			d = &tripDigest{}
+			existing[tripID] = d
+		}
+		d.add(seq, arrival.String, departure.String, stopID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("gtfs loader: read stop_times: %w", err)
+	}
+
+	// Primera pasada: hash por viaje del archivo nuevo
+	incoming := make(map[string]*tripDigest, len(existing))
+	if err := scanStopTimes(file, func(tripID string, seq int64, arrival, departure, stopID string) error {
+		d := incoming[tripID]
+		if d == nil {
+			d = &tripDigest{}
+			incoming[tripID] = d
+		}
+		d.add(seq, arrival, departure, stopID)
+		return nil
+	}); err != nil {
+		return 0, 0, err
+	}
+
+	rewrite := make(map[string]bool)
+	var stale []string
+	for tripID, d := range incoming {
+		if prev, ok := existing[tripID]; !ok || *prev != *d {
+			rewrite[tripID] = true
+			if ok {
+				stale = append(stale, tripID)
+			}
+		}
+	}
+	for tripID := range existing {
+		if _, ok := incoming[tripID]; !ok {
+			stale = append(stale, tripID)
+		}
+	}
+
+	if _, err := deleteByKeys(ctx, tx, table, "trip_id", stale); err != nil {
+		return 0, 0, err
+	}
+
+	// Segunda pasada: insertar solo los viajes que cambiaron
+	inserter := newBatchInserter(ctx, tx, table,
+		[]string{"feed_id", "trip_id", "arrival_time", "departure_time", "stop_id", "stop_sequence"})
+	if len(rewrite) > 0 {
+		err := scanStopTimes(file, func(tripID string, seq int64, arrival, departure, stopID string) error {
+			if !rewrite[tripID] {
+				return nil
+			}
+			if err := inserter.Add(feedID, tripID, arrival, departure, stopID, seq); err != nil {
+				return err
+			}
+			if inserter.inserted > 0 && inserter.inserted%100000 == 0 && len(inserter.rows) == 0 {
+				fmt.Printf("   imported %d stop times...\n", inserter.inserted)
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+		if err := inserter.Flush(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	fmt.Printf("   stop_times: %d trips rewritten, %d rows inserted (failed: %d, trips unchanged: %d)\n",
+		len(rewrite), inserter.inserted, inserter.failed, len(incoming)-len(rewrite))
+	return inserter.inserted, len(rewrite), nil
+}
+
+// scanStopTimes recorre stop_times.txt entregando cada fila válida a fn
+func scanStopTimes(file *zip.File, fn func(tripID string, seq int64, arrival, departure, stopID string) error) error {
+	rc, reader, idx, err := openCSV(file)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			continue
+		}
+		tripID := safeField(record, idx, "trip_id")
+		stopID := safeField(record, idx, "stop_id")
+		if tripID == "" || stopID == "" {
+			continue
+		}
+		seq := int64(atoiDefault(safeField(record, idx, "stop_sequence"), 0))
+		if err := fn(tripID, seq, safeField(record, idx, "arrival_time"), safeField(record, idx, "departure_time"), stopID); err != nil {
+			return err
+		}
+	}
+}
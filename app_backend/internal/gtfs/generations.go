@@ -0,0 +1,462 @@
+package gtfs
+
+// ============================================================================
+// GENERACIONES DE FEED (blue/green)
+// ============================================================================
+// Cada importación escribe en un juego de tablas propio (gtfs_stops_g<feed_id>,
+// gtfs_trips_g<feed_id>, ...). Las tablas sin sufijo son siempre la generación
+// activa: la API, geometry.Service, el router y los scrapers las leen sin saber
+// nada de generaciones. La activación reemplaza el juego completo con un único
+// RENAME TABLE, que en MariaDB es atómico, y el juego anterior queda archivado
+// con su sufijo para poder volver atrás.
+// ============================================================================
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/yourorg/wayfindcl/internal/validation"
+)
+
+// Estados de una generación
+const (
+	GenerationBuilding = "building"
+	GenerationReady    = "ready"
+	GenerationActive   = "active"
+	GenerationRetired  = "retired"
+	GenerationFailed   = "failed"
+	GenerationPruned   = "pruned"
+)
+
+// keepRetiredGenerations cuántas generaciones anteriores se conservan para rollback
+const keepRetiredGenerations = 2
+
+// generationLockName es el lock de MariaDB (GET_LOCK) que serializa los
+// cambios de generación entre el CLI y las instancias del servidor
+const generationLockName = "gtfs_generations"
+
+// generationLockTimeout es cuánto se espera a que otro proceso termine su cambio
+const generationLockTimeout = 60 * time.Second
+
+var (
+	ErrGenerationNotFound   = errors.New("gtfs generations: generation not found")
+	ErrNoPreviousGeneration = errors.New("gtfs generations: no previous generation to roll back to")
+	// ErrGenerationLocked indica que otro proceso está cambiando de generación
+	ErrGenerationLocked = errors.New("gtfs generations: another process holds the generation lock")
+)
+
+// generationTables en orden hijo → padre (seguro para DROP con foreign keys)
+var generationTables = []string{
+	"gtfs_stop_times",
+	"gtfs_frequencies",
+	"gtfs_transfers",
+	"gtfs_trips",
+	"gtfs_routes",
+	"gtfs_stops",
+	"gtfs_calendar_dates",
+	"gtfs_calendar",
+	"gtfs_shapes",
+}
+
+// generationColumns columnas de datos (sin feed_id ni ids autoincrementales) para copiar entre generaciones
+var generationColumns = map[string][]string{
+	"gtfs_stops":          {"stop_id", "code", "name", "description", "latitude", "longitude", "zone_id", "wheelchair_boarding"},
+	"gtfs_routes":         {"route_id", "short_name", "long_name", "type", "color", "text_color"},
+	"gtfs_trips":          {"trip_id", "route_id", "service_id", "headsign", "direction_id", "shape_id"},
+	"gtfs_stop_times":     {"trip_id", "arrival_time", "departure_time", "stop_id", "stop_sequence"},
+	"gtfs_calendar":       {"service_id", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday", "start_date", "end_date"},
+	"gtfs_calendar_dates": {"service_id", "date", "exception_type"},
+	"gtfs_shapes":         {"shape_id", "shape_pt_lat", "shape_pt_lon", "shape_pt_sequence", "shape_dist_traveled"},
+	"gtfs_frequencies":    {"trip_id", "start_time", "end_time", "headway_secs", "exact_times"},
+	"gtfs_transfers":      {"from_stop_id", "to_stop_id", "transfer_type", "min_transfer_time"},
+}
+
+// Generation describe una versión importada del feed
+type Generation struct {
+	FeedID       int64      `json:"feed_id"`
+	FeedVersion  string     `json:"feed_version,omitempty"`
+	SourceURL    string     `json:"source_url"`
+	Status       string     `json:"status"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ActivatedAt  *time.Time `json:"activated_at,omitempty"`
+	RetiredAt    *time.Time `json:"retired_at,omitempty"`
+	ErrorMessage string     `json:"error_message,omitempty"`
+}
+
+func generationTable(base string, feedID int64) string {
+	return fmt.Sprintf("%s_g%d", base, feedID)
+}
+
+// ActiveGeneration retorna el feed_id de la generación activa (0 si nunca se activó una)
+func ActiveGeneration(ctx context.Context, db *sql.DB) (int64, error) {
+	var feedID int64
+	err := db.QueryRowContext(ctx,
+		"SELECT feed_id FROM gtfs_generations WHERE status = ? ORDER BY activated_at DESC LIMIT 1",
+		GenerationActive,
+	).Scan(&feedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("gtfs generations: query active: %w", err)
+	}
+	return feedID, nil
+}
+
+// ListGenerations lista todas las generaciones, la más reciente primero
+func ListGenerations(ctx context.Context, db *sql.DB) ([]Generation, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT g.feed_id, COALESCE(f.feed_version, ''), f.source_url, g.status,
+		       g.created_at, g.activated_at, g.retired_at, COALESCE(g.error_message, '')
+		FROM gtfs_generations g
+		JOIN gtfs_feeds f ON f.id = g.feed_id
+		ORDER BY g.feed_id DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("gtfs generations: list: %w", err)
+	}
+	defer rows.Close()
+
+	var generations []Generation
+	for rows.Next() {
+		var g Generation
+		var activatedAt, retiredAt sql.NullTime
+		if err := rows.Scan(&g.FeedID, &g.FeedVersion, &g.SourceURL, &g.Status,
+			&g.CreatedAt, &activatedAt, &retiredAt, &g.ErrorMessage); err != nil {
+			return nil, fmt.Errorf("gtfs generations: scan: %w", err)
+		}
+		if activatedAt.Valid {
+			g.ActivatedAt = &activatedAt.Time
+		}
+		if retiredAt.Valid {
+			g.RetiredAt = &retiredAt.Time
+		}
+		generations = append(generations, g)
+	}
+	return generations, rows.Err()
+}
+
+// withGenerationLock ejecuta fn con el lock de generaciones tomado
+func withGenerationLock(ctx context.Context, db *sql.DB, fn func() error) error {
+	// GET_LOCK es por conexión: fijar una conexión del pool mientras dure fn
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("gtfs generations: %w", err)
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", generationLockName, int(generationLockTimeout.Seconds())).Scan(&locked); err != nil {
+		return fmt.Errorf("gtfs generations: acquire lock: %w", err)
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return ErrGenerationLocked
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", generationLockName); err != nil {
+			log.Printf("⚠️ [GTFS] No se pudo liberar el lock de generaciones: %v", err)
+		}
+	}()
+
+	return fn()
+}
+
+// Activate reemplaza atómicamente las tablas activas por las de la generación indicada
+func Activate(ctx context.Context, db *sql.DB, feedID int64) error {
+	return withGenerationLock(ctx, db, func() error {
+		return activate(ctx, db, feedID)
+	})
+}
+
+// activate hace el cambio de generación; requiere el lock de generaciones
+func activate(ctx context.Context, db *sql.DB, feedID int64) error {
+	var status string
+	err := db.QueryRowContext(ctx, "SELECT status FROM gtfs_generations WHERE feed_id = ?", feedID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %d", ErrGenerationNotFound, feedID)
+	}
+	if err != nil {
+		return fmt.Errorf("gtfs generations: query generation %d: %w", feedID, err)
+	}
+	switch status {
+	case GenerationActive:
+		return nil
+	case GenerationReady, GenerationRetired:
+	default:
+		return fmt.Errorf("gtfs generations: generation %d is %s and cannot be activated", feedID, status)
+	}
+
+	for _, base := range generationTables {
+		exists, err := tableExists(ctx, db, generationTable(base, feedID))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("gtfs generations: table %s is missing, generation %d cannot be activated", generationTable(base, feedID), feedID)
+		}
+	}
+
+	current, err := ActiveGeneration(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	// Sin generación activa: las tablas actuales vienen de un import anterior a las generaciones.
+	// Se archivan bajo el último feed registrado para que también se pueda volver a ellas.
+	archiveID := current
+	legacy := false
+	if current == 0 {
+		if err := db.QueryRowContext(ctx, `
+			SELECT COALESCE(MAX(f.id), 0)
+			FROM gtfs_feeds f
+			LEFT JOIN gtfs_generations g ON g.feed_id = f.id
+			WHERE g.feed_id IS NULL
+		`).Scan(&archiveID); err != nil {
+			return fmt.Errorf("gtfs generations: find legacy feed: %w", err)
+		}
+		legacy = archiveID > 0
+	}
+
+	var renames, dropAfter []string
+	for _, base := range generationTables {
+		exists, err := tableExists(ctx, db, base)
+		if err != nil {
+			return err
+		}
+		if exists {
+			archived := base + "_legacy"
+			if archiveID > 0 {
+				archived = generationTable(base, archiveID)
+			} else {
+				dropAfter = append(dropAfter, archived)
+			}
+			if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS "+archived); err != nil {
+				return fmt.Errorf("gtfs generations: clear %s: %w", archived, err)
+			}
+			renames = append(renames, base+" TO "+archived)
+		}
+		renames = append(renames, generationTable(base, feedID)+" TO "+base)
+	}
+
+	// RENAME TABLE con varias tablas es atómico: las consultas ven el juego viejo o el nuevo, nunca una mezcla
+	if _, err := db.ExecContext(ctx, "RENAME TABLE "+strings.Join(renames, ", ")); err != nil {
+		return fmt.Errorf("gtfs generations: switch to generation %d: %w", feedID, err)
+	}
+
+	if err := recordActivation(ctx, db, feedID, current, archiveID, legacy); err != nil {
+		// Sin la metadata las tablas activas no corresponden a ninguna generación: deshacer el cambio
+		inverse := make([]string, len(renames))
+		for i, rename := range renames {
+			from, to, _ := strings.Cut(rename, " TO ")
+			inverse[len(renames)-1-i] = to + " TO " + from
+		}
+		if _, undoErr := db.ExecContext(context.Background(), "RENAME TABLE "+strings.Join(inverse, ", ")); undoErr != nil {
+			return fmt.Errorf("%w (undo switch failed: %v)", err, undoErr)
+		}
+		return err
+	}
+
+	for _, table := range dropAfter {
+		if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+			fmt.Printf("gtfs generations: warning - could not drop %s: %v\n", table, err)
+		}
+	}
+
+	fmt.Printf("gtfs generations: generation %d is now active (previous: %d)\n", feedID, archiveID)
+	return nil
+}
+
+// recordActivation registra en gtfs_generations el cambio de current (o de la
+// generación legacy archiveID) a feedID
+func recordActivation(ctx context.Context, db *sql.DB, feedID, current, archiveID int64, legacy bool) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("gtfs generations: begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if current > 0 {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE gtfs_generations SET status = ?, retired_at = NOW() WHERE feed_id = ?",
+			GenerationRetired, current,
+		); err != nil {
+			return fmt.Errorf("gtfs generations: retire %d: %w", current, err)
+		}
+	} else if legacy {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO gtfs_generations (feed_id, status, retired_at) VALUES (?, ?, NOW())",
+			archiveID, GenerationRetired,
+		); err != nil {
+			return fmt.Errorf("gtfs generations: register legacy %d: %w", archiveID, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE gtfs_generations SET status = ?, activated_at = NOW(), retired_at = NULL WHERE feed_id = ?",
+		GenerationActive, feedID,
+	); err != nil {
+		return fmt.Errorf("gtfs generations: activate %d: %w", feedID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("gtfs generations: commit: %w", err)
+	}
+	return nil
+}
+
+// Rollback reactiva la generación que estaba activa antes de la actual
+func Rollback(ctx context.Context, db *sql.DB) (int64, error) {
+	var feedID int64
+	err := withGenerationLock(ctx, db, func() error {
+		// Elegir la generación anterior con el lock tomado: otro proceso pudo cambiarla
+		err := db.QueryRowContext(ctx,
+			"SELECT feed_id FROM gtfs_generations WHERE status = ? ORDER BY retired_at DESC, feed_id DESC LIMIT 1",
+			GenerationRetired,
+		).Scan(&feedID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoPreviousGeneration
+		}
+		if err != nil {
+			return fmt.Errorf("gtfs generations: query previous: %w", err)
+		}
+		return activate(ctx, db, feedID)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return feedID, nil
+}
+
+// PruneGenerations elimina las tablas de generaciones retiradas más allá de las "keep" más recientes
+func PruneGenerations(ctx context.Context, db *sql.DB, keep int) error {
+	return withGenerationLock(ctx, db, func() error {
+		return pruneGenerations(ctx, db, keep)
+	})
+}
+
+func pruneGenerations(ctx context.Context, db *sql.DB, keep int) error {
+	rows, err := db.QueryContext(ctx,
+		"SELECT feed_id FROM gtfs_generations WHERE status = ? ORDER BY retired_at DESC, feed_id DESC",
+		GenerationRetired,
+	)
+	if err != nil {
+		return fmt.Errorf("gtfs generations: query retired: %w", err)
+	}
+	var retired []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("gtfs generations: scan retired: %w", err)
+		}
+		retired = append(retired, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, id := range retired {
+		if i < keep {
+			continue
+		}
+		if err := dropGenerationTables(ctx, db, id); err != nil {
+			return err
+		}
+		if _, err := db.ExecContext(ctx, "UPDATE gtfs_generations SET status = ? WHERE feed_id = ?", GenerationPruned, id); err != nil {
+			return fmt.Errorf("gtfs generations: mark %d pruned: %w", id, err)
+		}
+		fmt.Printf("gtfs generations: pruned generation %d\n", id)
+	}
+	return nil
+}
+
+// createGeneration crea las tablas de una generación nueva. Las tablas indicadas en
+// copyFrom se inicializan con el contenido de la generación activa.
+func createGeneration(ctx context.Context, db *sql.DB, feedID int64, copyFrom map[string]bool) error {
+	if err := dropGenerationTables(ctx, db, feedID); err != nil {
+		return err
+	}
+	// Crear en orden padre → hijo no es necesario: entre tablas GTFS no hay
+	// foreign keys. La de feed_id → gtfs_feeds (migraciones 0003/0004) sí se
+	// recrea, porque LIKE no copia ninguna; el nombre lleva el sufijo de la
+	// generación para no chocar con las de otras tablas después del RENAME.
+	for _, base := range generationTables {
+		table := generationTable(base, feedID)
+		if _, err := db.ExecContext(ctx, "CREATE TABLE "+table+" LIKE "+base); err != nil {
+			return fmt.Errorf("gtfs generations: create %s: %w", table, err)
+		}
+		if _, err := db.ExecContext(ctx,
+			"ALTER TABLE "+table+" ADD CONSTRAINT fk_"+table+"_feed FOREIGN KEY (feed_id) REFERENCES gtfs_feeds(id) ON DELETE SET NULL",
+		); err != nil {
+			return fmt.Errorf("gtfs generations: add feed foreign key to %s: %w", table, err)
+		}
+		if !copyFrom[base] {
+			continue
+		}
+		cols := strings.Join(generationColumns[base], ", ")
+		res, err := db.ExecContext(ctx,
+			"INSERT INTO "+table+" (feed_id, "+cols+") SELECT ?, "+cols+" FROM "+base,
+			feedID,
+		)
+		if err != nil {
+			return fmt.Errorf("gtfs generations: copy %s: %w", base, err)
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			fmt.Printf("   copied %d rows from %s\n", n, base)
+		}
+	}
+	return nil
+}
+
+func dropGenerationTables(ctx context.Context, db *sql.DB, feedID int64) error {
+	for _, base := range generationTables {
+		table := generationTable(base, feedID)
+		if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+			return fmt.Errorf("gtfs generations: drop %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// failGeneration marca una generación como fallida y libera sus tablas
+func failGeneration(ctx context.Context, db *sql.DB, feedID int64, cause error) {
+	if err := dropGenerationTables(ctx, db, feedID); err != nil {
+		fmt.Printf("gtfs generations: warning - %v\n", err)
+	}
+	if _, err := db.ExecContext(ctx,
+		"UPDATE gtfs_generations SET status = ?, error_message = ? WHERE feed_id = ?",
+		GenerationFailed, validation.Truncate(cause.Error(), 2000), feedID,
+	); err != nil {
+		fmt.Printf("gtfs generations: warning - could not mark %d as failed: %v\n", feedID, err)
+	}
+}
+
+// validateGeneration verifica que la generación construida sea utilizable antes de activarla
+func validateGeneration(ctx context.Context, db *sql.DB, feedID int64) error {
+	for _, base := range []string{"gtfs_stops", "gtfs_routes", "gtfs_trips", "gtfs_stop_times"} {
+		var count int64
+		if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+generationTable(base, feedID)).Scan(&count); err != nil {
+			return fmt.Errorf("gtfs generations: count %s: %w", base, err)
+		}
+		if count == 0 {
+			return fmt.Errorf("gtfs generations: generation %d has no rows in %s", feedID, base)
+		}
+	}
+	return nil
+}
+
+func tableExists(ctx context.Context, db *sql.DB, table string) (bool, error) {
+	var count int
+	err := db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?",
+		table,
+	).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("gtfs generations: check table %s: %w", table, err)
+	}
+	return count > 0, nil
+}
@@ -10,7 +10,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -20,16 +19,50 @@ type Loader struct {
 	feedURL     string
 	fallbackURL string
 	httpClient  *http.Client
+	options     ImportOptions
+}
+
+// ImportOptions ajusta cómo se valida y activa un feed importado
+type ImportOptions struct {
+	// MaxValidationErrors errores tolerados antes de rechazar el feed (negativo = sin límite)
+	MaxValidationErrors int
+}
+
+// DefaultImportOptions retorna las opciones usadas por NewLoader
+func DefaultImportOptions() ImportOptions {
+	return ImportOptions{MaxValidationErrors: DefaultMaxValidationErrors}
 }
 
 // Summary describes the result of a GTFS sync.
 type Summary struct {
-	FeedVersion   string    `json:"feed_version"`
-	StopsImported int       `json:"stops_imported"`
-	DownloadedAt  time.Time `json:"downloaded_at"`
-	SourceURL     string    `json:"source_url"`
+	FeedVersion           string    `json:"feed_version"`
+	StopsImported         int       `json:"stops_imported"`
+	RoutesImported        int       `json:"routes_imported"`
+	TripsImported         int       `json:"trips_imported"`
+	StopTimesImported     int       `json:"stop_times_imported"`
+	CalendarsImported     int       `json:"calendars_imported"`
+	CalendarDatesImported int       `json:"calendar_dates_imported"`
+	ShapePointsImported   int       `json:"shape_points_imported"`
+	FrequenciesImported   int       `json:"frequencies_imported"`
+	TransfersImported     int       `json:"transfers_imported"`
+	DownloadedAt          time.Time `json:"downloaded_at"`
+	SourceURL             string    `json:"source_url"`
+
+	// Sincronización incremental
+	FeedID       int64        `json:"feed_id"`
+	Skipped      bool         `json:"skipped"`
+	ChangedFiles []string     `json:"changed_files"`
+	Changes      ChangeReport `json:"changes"`
+
+	Validation *ValidationReport `json:"validation,omitempty"`
 }
 
+// requiredFiles y optionalFiles son los archivos del feed que el loader importa
+var (
+	requiredFiles = []string{"stops.txt", "routes.txt", "trips.txt", "stop_times.txt"}
+	optionalFiles = []string{"calendar.txt", "calendar_dates.txt", "shapes.txt", "frequencies.txt", "transfers.txt"}
+)
+
 // NewLoader builds a loader for the provided GTFS feed URL. Optionally accepts a fallback URL that will
 // be attempted when the primary feed returns a non-success status (e.g. 404).
 func NewLoader(feedURL, fallbackURL string, client *http.Client) *Loader {
@@ -40,10 +73,16 @@ func NewLoader(feedURL, fallbackURL string, client *http.Client) *Loader {
 		feedURL:     strings.TrimSpace(feedURL),
 		fallbackURL: strings.TrimSpace(fallbackURL),
 		httpClient:  client,
+		options:     DefaultImportOptions(),
 	}
 }
 
-// Sync downloads the GTFS feed and refreshes the stops table.
+// SetMaxValidationErrors cambia cuántos errores de validación se toleran antes de rechazar un feed
+func (l *Loader) SetMaxValidationErrors(n int) {
+	l.options.MaxValidationErrors = n
+}
+
+// Sync downloads the GTFS feed and applies it incrementally against the last imported feed.
 func (l *Loader) Sync(ctx context.Context, db *sql.DB) (*Summary, error) {
 	if l.feedURL == "" {
 		return nil, errors.New("gtfs loader: feed url is empty")
@@ -53,6 +92,15 @@ func (l *Loader) Sync(ctx context.Context, db *sql.DB) (*Summary, error) {
 	if err != nil {
 		return nil, err
 	}
+	return Import(ctx, db, data, sourceURL, l.options)
+}
+
+// Import compara un feed GTFS (zip en memoria) con la generación activa, archivo por archivo
+// (SHA-256 del contenido), y construye una generación nueva aplicando solo las filas que
+// cambiaron. El feed se valida antes de construirla (el reporte queda guardado junto al
+// registro de gtfs_feeds) y la generación se activa de forma atómica; si algo falla la
+// generación activa no se toca. Si ningún archivo cambió el feed se omite por completo.
+func Import(ctx context.Context, db *sql.DB, data []byte, sourceURL string, opts ImportOptions) (*Summary, error) {
 	readerAt := bytes.NewReader(data)
 	zr, err := zip.NewReader(readerAt, int64(len(data)))
 	if err != nil {
@@ -60,50 +108,66 @@ func (l *Loader) Sync(ctx context.Context, db *sql.DB) (*Summary, error) {
 	}
 
 	feedVersion := extractFeedVersion(zr)
-	
-	// Buscar todos los archivos necesarios
-	stopsFile, err := findFile(zr, "stops.txt")
-	if err != nil {
-		return nil, err
+
+	// Archivos obligatorios y opcionales según la especificación GTFS
+	files := make(map[string]*zip.File)
+	for _, name := range requiredFiles {
+		file, err := findFile(zr, name)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = file
 	}
-	
-	routesFile, err := findFile(zr, "routes.txt")
-	if err != nil {
-		return nil, fmt.Errorf("gtfs loader: routes.txt not found: %w", err)
+	for _, name := range optionalFiles {
+		if file, err := findFile(zr, name); err == nil {
+			files[name] = file
+		}
 	}
-	
-	tripsFile, err := findFile(zr, "trips.txt")
-	if err != nil {
-		return nil, fmt.Errorf("gtfs loader: trips.txt not found: %w", err)
+	if files["calendar.txt"] == nil && files["calendar_dates.txt"] == nil {
+		fmt.Println("gtfs loader: warning - feed has neither calendar.txt nor calendar_dates.txt")
 	}
-	
-	stopTimesFile, err := findFile(zr, "stop_times.txt")
-	if err != nil {
-		return nil, fmt.Errorf("gtfs loader: stop_times.txt not found: %w", err)
+
+	hashes := make(map[string]string, len(files))
+	for name, file := range files {
+		digest, err := fileDigest(file)
+		if err != nil {
+			return nil, err
+		}
+		hashes[name] = digest
 	}
 
-	tx, err := db.BeginTx(ctx, nil)
+	prevFeedID, prevHashes, err := baseFeedFiles(ctx, db)
 	if err != nil {
-		return nil, fmt.Errorf("gtfs loader: begin tx: %w", err)
+		return nil, err
 	}
-	defer tx.Rollback()
+	changed := changedFiles(hashes, prevHashes)
 
-	// Limpiar tablas en orden (respetando foreign keys)
-	fmt.Println("gtfs loader: clearing old data...")
-	if _, err := tx.ExecContext(ctx, "DELETE FROM gtfs_stop_times"); err != nil {
-		return nil, fmt.Errorf("gtfs loader: clear stop_times: %w", err)
-	}
-	if _, err := tx.ExecContext(ctx, "DELETE FROM gtfs_trips"); err != nil {
-		return nil, fmt.Errorf("gtfs loader: clear trips: %w", err)
+	summary := &Summary{
+		FeedVersion:  feedVersion,
+		DownloadedAt: time.Now().UTC(),
+		SourceURL:    sourceURL,
+		ChangedFiles: changed,
 	}
-	if _, err := tx.ExecContext(ctx, "DELETE FROM gtfs_routes"); err != nil {
-		return nil, fmt.Errorf("gtfs loader: clear routes: %w", err)
+
+	if prevFeedID != 0 && len(changed) == 0 {
+		fmt.Printf("gtfs loader: feed unchanged since feed %d (version %q), skipping import\n", prevFeedID, feedVersion)
+		// Registrar la verificación para que el auto-sync no vuelva a descargar de inmediato
+		if _, err := db.ExecContext(ctx, "UPDATE gtfs_feeds SET downloaded_at = CURRENT_TIMESTAMP WHERE id = ?", prevFeedID); err != nil {
+			fmt.Printf("gtfs loader: warning - could not touch feed %d: %v\n", prevFeedID, err)
+		}
+		summary.FeedID = prevFeedID
+		summary.Skipped = true
+		return summary, nil
 	}
-	if _, err := tx.ExecContext(ctx, "DELETE FROM gtfs_stops"); err != nil {
-		return nil, fmt.Errorf("gtfs loader: clear stops: %w", err)
+	fmt.Printf("gtfs loader: changed files since feed %d: %s\n", prevFeedID, strings.Join(changed, ", "))
+
+	isChanged := make(map[string]bool, len(changed))
+	for _, name := range changed {
+		isChanged[name] = true
 	}
 
-	res, err := tx.ExecContext(ctx,
+	// El feed y su generación se registran fuera de la transacción: construir las tablas usa DDL
+	res, err := db.ExecContext(ctx,
 		"INSERT INTO gtfs_feeds (source_url, feed_version) VALUES (?, ?)",
 		sourceURL, feedVersion,
 	)
@@ -114,49 +178,177 @@ func (l *Loader) Sync(ctx context.Context, db *sql.DB) (*Summary, error) {
 	if err != nil {
 		return nil, fmt.Errorf("gtfs loader: fetch feed id: %w", err)
 	}
+	summary.FeedID = feedID
+
+	if _, err := db.ExecContext(ctx,
+		"INSERT INTO gtfs_generations (feed_id, status) VALUES (?, ?)",
+		feedID, GenerationBuilding,
+	); err != nil {
+		return nil, fmt.Errorf("gtfs loader: register generation: %w", err)
+	}
+	for name, digest := range hashes {
+		if _, err := db.ExecContext(ctx,
+			"INSERT INTO gtfs_feed_files (feed_id, file_name, content_hash, size_bytes) VALUES (?, ?, ?, ?)",
+			feedID, name, digest, files[name].UncompressedSize64,
+		); err != nil {
+			return nil, fmt.Errorf("gtfs loader: record file hash %s: %w", name, err)
+		}
+	}
 
-	// Importar en orden (respetando foreign keys)
-	fmt.Println("📍 Importing stops...")
-	stopsCount, err := importStops(ctx, tx, feedID, stopsFile)
+	fmt.Println("🩺 Validating feed...")
+	report, err := validateFiles(files)
 	if err != nil {
+		failGeneration(context.Background(), db, feedID, err)
 		return nil, err
 	}
-	
-	fmt.Println("🚌 Importing routes...")
-	routesCount, err := importRoutes(ctx, tx, feedID, routesFile)
+	if err := saveValidationReport(ctx, db, feedID, report); err != nil {
+		fmt.Printf("gtfs loader: warning - %v\n", err)
+	}
+	summary.Validation = report
+	fmt.Printf("   validation: %d errors, %d warnings\n", report.ErrorCount, report.WarningCount)
+	if opts.MaxValidationErrors >= 0 && report.ErrorCount > opts.MaxValidationErrors {
+		verr := &ValidationError{Report: report}
+		failGeneration(context.Background(), db, feedID, verr)
+		return nil, verr
+	}
+
+	results, err := buildGeneration(ctx, db, feedID, files, isChanged, summary)
+	if err == nil {
+		err = validateGeneration(ctx, db, feedID)
+	}
 	if err != nil {
+		// La generación activa sigue intacta; solo se descarta la nueva
+		failGeneration(context.Background(), db, feedID, err)
 		return nil, err
 	}
-	
-	fmt.Println("🚏 Importing trips...")
-	tripsCount, err := importTrips(ctx, tx, feedID, tripsFile)
-	if err != nil {
+	if _, err := db.ExecContext(ctx, "UPDATE gtfs_generations SET status = ? WHERE feed_id = ?", GenerationReady, feedID); err != nil {
+		return nil, fmt.Errorf("gtfs loader: mark generation ready: %w", err)
+	}
+	if err := Activate(ctx, db, feedID); err != nil {
 		return nil, err
 	}
-	
-	fmt.Println("⏰ Importing stop times (this may take several minutes)...")
-	stopTimesCount, err := importStopTimes(ctx, tx, feedID, stopTimesFile)
-	if err != nil {
+	if err := PruneGenerations(ctx, db, keepRetiredGenerations); err != nil {
+		fmt.Printf("gtfs loader: warning - %v\n", err)
+	}
+
+	stops, routes, trips := results[stopsTable.file], results[routesTable.file], results[tripsTable.file]
+	summary.StopsImported = stops.written
+	summary.RoutesImported = routes.written
+	summary.TripsImported = trips.written
+	summary.Changes.Stops = newChangeSet(stops.added, stops.removed, stops.modified)
+	summary.Changes.Routes = newChangeSet(routes.added, routes.removed, routes.modified)
+	summary.Changes.Trips = newChangeSet(trips.added, trips.removed, trips.modified)
+
+	fmt.Printf("✅ GTFS import complete (feed %d):\n", feedID)
+	fmt.Printf("   - Stops: +%d ~%d -%d\n", len(stops.added), len(stops.modified), len(stops.removed))
+	fmt.Printf("   - Routes: +%d ~%d -%d\n", len(routes.added), len(routes.modified), len(routes.removed))
+	fmt.Printf("   - Trips: +%d ~%d -%d\n", len(trips.added), len(trips.modified), len(trips.removed))
+	fmt.Printf("   - Stop Times: %d rows (%d trips rewritten)\n", summary.StopTimesImported, summary.Changes.StopTimesTripsRewritten)
+	fmt.Printf("   - Calendars: %d (+%d exceptions)\n", summary.CalendarsImported, summary.CalendarDatesImported)
+	fmt.Printf("   - Shape points: %d\n", summary.ShapePointsImported)
+	fmt.Printf("   - Frequencies: %d\n", summary.FrequenciesImported)
+	fmt.Printf("   - Transfers: %d\n", summary.TransfersImported)
+
+	return summary, nil
+}
+
+// buildGeneration copia la generación activa a las tablas de la nueva y aplica encima los cambios del feed
+func buildGeneration(ctx context.Context, db *sql.DB, feedID int64, files map[string]*zip.File, isChanged map[string]bool, summary *Summary) (map[string]*keyedResult, error) {
+	scheduleFiles := []struct {
+		file   string
+		table  string
+		load   func(context.Context, *sql.Tx, int64, string, *zip.File) (int, error)
+		target *int
+	}{
+		{"calendar.txt", "gtfs_calendar", importCalendar, &summary.CalendarsImported},
+		{"calendar_dates.txt", "gtfs_calendar_dates", importCalendarDates, &summary.CalendarDatesImported},
+		{"shapes.txt", "gtfs_shapes", importShapes, &summary.ShapePointsImported},
+		{"frequencies.txt", "gtfs_frequencies", importFrequencies, &summary.FrequenciesImported},
+		{"transfers.txt", "gtfs_transfers", importTransfers, &summary.TransfersImported},
+	}
+
+	// Las tablas con diff parten de la generación activa; las complementarias solo si no cambiaron
+	copyFrom := map[string]bool{
+		"gtfs_stops":      true,
+		"gtfs_routes":     true,
+		"gtfs_trips":      true,
+		"gtfs_stop_times": true,
+	}
+	for _, sf := range scheduleFiles {
+		copyFrom[sf.table] = !isChanged[sf.file]
+	}
+	fmt.Printf("🧱 Building generation %d...\n", feedID)
+	if err := createGeneration(ctx, db, feedID, copyFrom); err != nil {
 		return nil, err
 	}
 
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("gtfs loader: commit: %w", err)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("gtfs loader: begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 1. Altas y modificaciones (stops, routes, trips)
+	results := make(map[string]*keyedResult)
+	for _, spec := range []keyedTable{stopsTable, routesTable, tripsTable} {
+		if !isChanged[spec.file] {
+			fmt.Printf("   %s unchanged, skipping\n", spec.file)
+			results[spec.file] = &keyedResult{}
+			continue
+		}
+		fmt.Printf("🔎 Diffing %s...\n", spec.file)
+		result, err := applyKeyedDiff(ctx, tx, feedID, spec, generationTable(spec.table, feedID), files[spec.file])
+		if err != nil {
+			return nil, err
+		}
+		results[spec.file] = result
 	}
 
-	fmt.Printf("✅ GTFS import complete:\n")
-	fmt.Printf("   - Stops: %d\n", stopsCount)
-	fmt.Printf("   - Routes: %d\n", routesCount)
-	fmt.Printf("   - Trips: %d\n", tripsCount)
-	fmt.Printf("   - Stop Times: %d\n", stopTimesCount)
+	// 2. Horarios: solo se reescriben los viajes cuyo contenido cambió
+	if isChanged["stop_times.txt"] {
+		fmt.Println("⏰ Diffing stop times...")
+		inserted, rewritten, err := applyStopTimesDiff(ctx, tx, feedID, generationTable("gtfs_stop_times", feedID), files["stop_times.txt"])
+		if err != nil {
+			return nil, err
+		}
+		summary.StopTimesImported = inserted
+		summary.Changes.StopTimesTripsRewritten = rewritten
+	} else {
+		fmt.Println("   stop_times.txt unchanged, skipping")
+	}
 
-	summary := &Summary{
-		FeedVersion:   feedVersion,
-		StopsImported: stopsCount,
-		DownloadedAt:  time.Now().UTC(),
-		SourceURL:     sourceURL,
+	// 3. Tablas complementarias: se cargan completas cuando su archivo cambió
+	for _, sf := range scheduleFiles {
+		if !isChanged[sf.file] {
+			continue
+		}
+		fmt.Printf("📅 Loading %s...\n", sf.file)
+		count, err := sf.load(ctx, tx, feedID, generationTable(sf.table, feedID), files[sf.file])
+		if err != nil {
+			return nil, err
+		}
+		*sf.target = count
 	}
-	return summary, nil
+
+	// 4. Bajas. Las tablas de generación no tienen foreign keys (CREATE TABLE ... LIKE no las
+	// copia), así que los horarios que dependen de viajes o paradas eliminadas se borran aquí.
+	stopTimesTable := generationTable("gtfs_stop_times", feedID)
+	if _, err := deleteByKeys(ctx, tx, stopTimesTable, "trip_id", results[tripsTable.file].removed); err != nil {
+		return nil, err
+	}
+	if _, err := deleteByKeys(ctx, tx, stopTimesTable, "stop_id", results[stopsTable.file].removed); err != nil {
+		return nil, err
+	}
+	for _, spec := range []keyedTable{tripsTable, routesTable, stopsTable} {
+		if _, err := deleteByKeys(ctx, tx, generationTable(spec.table, feedID), spec.key, results[spec.file].removed); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("gtfs loader: commit: %w", err)
+	}
+	return results, nil
 }
 
 func (l *Loader) obtainFeed(ctx context.Context) ([]byte, string, error) {
@@ -236,116 +428,6 @@ func extractFeedVersion(zr *zip.Reader) string {
 	return ""
 }
 
-func importStops(ctx context.Context, tx *sql.Tx, feedID int64, file *zip.File) (int, error) {
-	rc, err := file.Open()
-	if err != nil {
-		return 0, fmt.Errorf("gtfs loader: open stops.txt: %w", err)
-	}
-	defer rc.Close()
-
-	reader := csv.NewReader(rc)
-	reader.FieldsPerRecord = -1      // Permitir registros con diferente número de campos
-	reader.LazyQuotes = true         // Permitir comillas no escapadas
-	reader.TrimLeadingSpace = true   // Remover espacios al inicio
-	
-	header, err := reader.Read()
-	if err != nil {
-		return 0, fmt.Errorf("gtfs loader: read stops header: %w", err)
-	}
-	idx := headerIndex(header)
-	required := []string{"stop_id", "stop_name", "stop_lat", "stop_lon"}
-	for _, field := range required {
-		if _, ok := idx[field]; !ok {
-			return 0, fmt.Errorf("gtfs loader: missing column %s in stops.txt", field)
-		}
-	}
-
-	stmt, err := tx.PrepareContext(ctx, `INSERT INTO gtfs_stops 
-        (stop_id, feed_id, code, name, description, latitude, longitude, zone_id, wheelchair_boarding)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
-	if err != nil {
-		return 0, fmt.Errorf("gtfs loader: prepare insert stop: %w", err)
-	}
-	defer stmt.Close()
-
-	count := 0
-	skipped := 0
-	errorCount := 0
-	lineNum := 1 // Header es línea 1
-	
-	for {
-		lineNum++
-		record, err := reader.Read()
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		if err != nil {
-			errorCount++
-			// Log solo los primeros 20 errores de parsing
-			if errorCount <= 20 {
-				fmt.Printf("gtfs loader: error reading line %d: %v\n", lineNum, err)
-			}
-			// NO retornar error, continuar con la siguiente línea
-			continue
-		}
-		
-		stopID := safeField(record, idx, "stop_id")
-		if stopID == "" {
-			skipped++
-			continue
-		}
-		name := safeField(record, idx, "stop_name")
-		latStr := safeField(record, idx, "stop_lat")
-		lonStr := safeField(record, idx, "stop_lon")
-		lat, err := strconv.ParseFloat(latStr, 64)
-		if err != nil {
-			skipped++
-			if skipped <= 20 {
-				fmt.Printf("gtfs loader: line %d - invalid latitude '%s' for stop %s\n", lineNum, latStr, stopID)
-			}
-			continue
-		}
-		lon, err := strconv.ParseFloat(lonStr, 64)
-		if err != nil {
-			skipped++
-			if skipped <= 20 {
-				fmt.Printf("gtfs loader: line %d - invalid longitude '%s' for stop %s\n", lineNum, lonStr, stopID)
-			}
-			continue
-		}
-		desc := safeField(record, idx, "stop_desc")
-		code := safeField(record, idx, "stop_code")
-		zone := safeField(record, idx, "zone_id")
-		wheelchair := 0
-		if v := safeField(record, idx, "wheelchair_boarding"); v != "" {
-			if parsed, err := strconv.Atoi(v); err == nil {
-				wheelchair = parsed
-			}
-		}
-
-		if _, err := stmt.ExecContext(ctx, stopID, feedID, code, name, desc, lat, lon, zone, wheelchair); err != nil {
-			errorCount++
-			// Log solo los primeros 10 errores de inserción
-			if errorCount <= 30 {
-				fmt.Printf("gtfs loader: line %d - error inserting stop %s: %v\n", lineNum, stopID, err)
-			}
-			// No retornar error, continuar con el siguiente
-			continue
-		}
-		count++
-		
-		// Log progreso cada 50,000 registros para feeds grandes
-		if count%50000 == 0 {
-			fmt.Printf("gtfs loader: imported %d stops so far (line %d)...\n", count, lineNum)
-		} else if count%10000 == 0 {
-			fmt.Printf("gtfs loader: imported %d stops so far...\n", count)
-		}
-	}
-	
-	fmt.Printf("gtfs loader: import complete - success: %d, skipped: %d, errors: %d, total lines: %d\n", count, skipped, errorCount, lineNum)
-	return count, nil
-}
-
 func headerIndex(header []string) map[string]int {
 	idx := make(map[string]int, len(header))
 	for i, field := range header {
@@ -360,207 +442,3 @@ func safeField(record []string, idx map[string]int, key string) string {
 	}
 	return ""
 }
-
-// importRoutes imports routes.txt into gtfs_routes table
-func importRoutes(ctx context.Context, tx *sql.Tx, feedID int64, file *zip.File) (int, error) {
-	rc, err := file.Open()
-	if err != nil {
-		return 0, fmt.Errorf("gtfs loader: open routes.txt: %w", err)
-	}
-	defer rc.Close()
-
-	reader := csv.NewReader(rc)
-	reader.FieldsPerRecord = -1
-	reader.LazyQuotes = true
-	reader.TrimLeadingSpace = true
-
-	header, err := reader.Read()
-	if err != nil {
-		return 0, fmt.Errorf("gtfs loader: read routes header: %w", err)
-	}
-	idx := headerIndex(header)
-
-	stmt, err := tx.PrepareContext(ctx, `INSERT INTO gtfs_routes 
-        (route_id, feed_id, short_name, long_name, type, color, text_color)
-        VALUES (?, ?, ?, ?, ?, ?, ?)`)
-	if err != nil {
-		return 0, fmt.Errorf("gtfs loader: prepare insert route: %w", err)
-	}
-	defer stmt.Close()
-
-	count := 0
-	for {
-		record, err := reader.Read()
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		if err != nil {
-			continue
-		}
-
-		routeID := safeField(record, idx, "route_id")
-		if routeID == "" {
-			continue
-		}
-
-		shortName := safeField(record, idx, "route_short_name")
-		longName := safeField(record, idx, "route_long_name")
-		routeType := 0
-		if v := safeField(record, idx, "route_type"); v != "" {
-			if parsed, err := strconv.Atoi(v); err == nil {
-				routeType = parsed
-			}
-		}
-		color := safeField(record, idx, "route_color")
-		textColor := safeField(record, idx, "route_text_color")
-
-		if _, err := stmt.ExecContext(ctx, routeID, feedID, shortName, longName, routeType, color, textColor); err != nil {
-			continue
-		}
-		count++
-
-		if count%1000 == 0 {
-			fmt.Printf("   imported %d routes...\n", count)
-		}
-	}
-
-	fmt.Printf("   routes import complete: %d routes\n", count)
-	return count, nil
-}
-
-// importTrips imports trips.txt into gtfs_trips table
-func importTrips(ctx context.Context, tx *sql.Tx, feedID int64, file *zip.File) (int, error) {
-	rc, err := file.Open()
-	if err != nil {
-		return 0, fmt.Errorf("gtfs loader: open trips.txt: %w", err)
-	}
-	defer rc.Close()
-
-	reader := csv.NewReader(rc)
-	reader.FieldsPerRecord = -1
-	reader.LazyQuotes = true
-	reader.TrimLeadingSpace = true
-
-	header, err := reader.Read()
-	if err != nil {
-		return 0, fmt.Errorf("gtfs loader: read trips header: %w", err)
-	}
-	idx := headerIndex(header)
-
-	stmt, err := tx.PrepareContext(ctx, `INSERT INTO gtfs_trips 
-        (trip_id, feed_id, route_id, service_id, headsign, direction_id, shape_id)
-        VALUES (?, ?, ?, ?, ?, ?, ?)`)
-	if err != nil {
-		return 0, fmt.Errorf("gtfs loader: prepare insert trip: %w", err)
-	}
-	defer stmt.Close()
-
-	count := 0
-	for {
-		record, err := reader.Read()
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		if err != nil {
-			continue
-		}
-
-		tripID := safeField(record, idx, "trip_id")
-		routeID := safeField(record, idx, "route_id")
-		if tripID == "" || routeID == "" {
-			continue
-		}
-
-		serviceID := safeField(record, idx, "service_id")
-		headsign := safeField(record, idx, "trip_headsign")
-		directionID := 0
-		if v := safeField(record, idx, "direction_id"); v != "" {
-			if parsed, err := strconv.Atoi(v); err == nil {
-				directionID = parsed
-			}
-		}
-		shapeID := safeField(record, idx, "shape_id")
-
-		if _, err := stmt.ExecContext(ctx, tripID, feedID, routeID, serviceID, headsign, directionID, shapeID); err != nil {
-			continue
-		}
-		count++
-
-		if count%10000 == 0 {
-			fmt.Printf("   imported %d trips...\n", count)
-		}
-	}
-
-	fmt.Printf("   trips import complete: %d trips\n", count)
-	return count, nil
-}
-
-// importStopTimes imports stop_times.txt into gtfs_stop_times table
-func importStopTimes(ctx context.Context, tx *sql.Tx, feedID int64, file *zip.File) (int, error) {
-	rc, err := file.Open()
-	if err != nil {
-		return 0, fmt.Errorf("gtfs loader: open stop_times.txt: %w", err)
-	}
-	defer rc.Close()
-
-	reader := csv.NewReader(rc)
-	reader.FieldsPerRecord = -1
-	reader.LazyQuotes = true
-	reader.TrimLeadingSpace = true
-
-	header, err := reader.Read()
-	if err != nil {
-		return 0, fmt.Errorf("gtfs loader: read stop_times header: %w", err)
-	}
-	idx := headerIndex(header)
-
-	stmt, err := tx.PrepareContext(ctx, `INSERT INTO gtfs_stop_times 
-        (feed_id, trip_id, arrival_time, departure_time, stop_id, stop_sequence)
-        VALUES (?, ?, ?, ?, ?, ?)`)
-	if err != nil {
-		return 0, fmt.Errorf("gtfs loader: prepare insert stop_time: %w", err)
-	}
-	defer stmt.Close()
-
-	count := 0
-	skipped := 0
-	for {
-		record, err := reader.Read()
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		if err != nil {
-			skipped++
-			continue
-		}
-
-		tripID := safeField(record, idx, "trip_id")
-		stopID := safeField(record, idx, "stop_id")
-		if tripID == "" || stopID == "" {
-			skipped++
-			continue
-		}
-
-		arrivalTime := safeField(record, idx, "arrival_time")
-		departureTime := safeField(record, idx, "departure_time")
-		stopSeq := 0
-		if v := safeField(record, idx, "stop_sequence"); v != "" {
-			if parsed, err := strconv.Atoi(v); err == nil {
-				stopSeq = parsed
-			}
-		}
-
-		if _, err := stmt.ExecContext(ctx, feedID, tripID, arrivalTime, departureTime, stopID, stopSeq); err != nil {
-			skipped++
-			continue
-		}
-		count++
-
-		if count%100000 == 0 {
-			fmt.Printf("   imported %d stop times...\n", count)
-		}
-	}
-
-	fmt.Printf("   stop_times import complete: %d records (skipped: %d)\n", count, skipped)
-	return count, nil
-}
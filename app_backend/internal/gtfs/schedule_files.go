@@ -0,0 +1,342 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openCSV abre un archivo del feed y retorna el lector CSV con su índice de columnas
+func openCSV(file *zip.File) (io.ReadCloser, *csv.Reader, map[string]int, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("gtfs loader: open %s: %w", file.Name, err)
+	}
+
+	reader := csv.NewReader(rc)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		rc.Close()
+		return nil, nil, nil, fmt.Errorf("gtfs loader: read %s header: %w", file.Name, err)
+	}
+	return rc, reader, headerIndex(header), nil
+}
+
+// parseGTFSDate convierte fechas GTFS (YYYYMMDD) a time.Time
+func parseGTFSDate(value string) (time.Time, error) {
+	return time.Parse("20060102", strings.TrimSpace(value))
+}
+
+func atoiDefault(value string, def int) int {
+	if value = strings.TrimSpace(value); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return def
+}
+
+// importCalendar imports calendar.txt into the given gtfs_calendar generation table
+func importCalendar(ctx context.Context, tx *sql.Tx, feedID int64, table string, file *zip.File) (int, error) {
+	if file == nil {
+		fmt.Println("   calendar.txt not present, skipping")
+		return 0, nil
+	}
+	rc, reader, idx, err := openCSV(file)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO `+table+`
+        (service_id, feed_id, monday, tuesday, wednesday, thursday, friday, saturday, sunday, start_date, end_date)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("gtfs loader: prepare insert calendar: %w", err)
+	}
+	defer stmt.Close()
+
+	count := 0
+	skipped := 0
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			skipped++
+			continue
+		}
+
+		serviceID := safeField(record, idx, "service_id")
+		if serviceID == "" {
+			skipped++
+			continue
+		}
+		startDate, err := parseGTFSDate(safeField(record, idx, "start_date"))
+		if err != nil {
+			skipped++
+			continue
+		}
+		endDate, err := parseGTFSDate(safeField(record, idx, "end_date"))
+		if err != nil {
+			skipped++
+			continue
+		}
+
+		if _, err := stmt.ExecContext(ctx, serviceID, feedID,
+			atoiDefault(safeField(record, idx, "monday"), 0),
+			atoiDefault(safeField(record, idx, "tuesday"), 0),
+			atoiDefault(safeField(record, idx, "wednesday"), 0),
+			atoiDefault(safeField(record, idx, "thursday"), 0),
+			atoiDefault(safeField(record, idx, "friday"), 0),
+			atoiDefault(safeField(record, idx, "saturday"), 0),
+			atoiDefault(safeField(record, idx, "sunday"), 0),
+			startDate, endDate,
+		); err != nil {
+			skipped++
+			continue
+		}
+		count++
+	}
+
+	fmt.Printf("   calendar import complete: %d services (skipped: %d)\n", count, skipped)
+	return count, nil
+}
+
+// importCalendarDates imports calendar_dates.txt into the given gtfs_calendar_dates generation table
+func importCalendarDates(ctx context.Context, tx *sql.Tx, feedID int64, table string, file *zip.File) (int, error) {
+	if file == nil {
+		fmt.Println("   calendar_dates.txt not present, skipping")
+		return 0, nil
+	}
+	rc, reader, idx, err := openCSV(file)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO `+table+`
+        (feed_id, service_id, date, exception_type)
+        VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("gtfs loader: prepare insert calendar_date: %w", err)
+	}
+	defer stmt.Close()
+
+	count := 0
+	skipped := 0
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			skipped++
+			continue
+		}
+
+		serviceID := safeField(record, idx, "service_id")
+		date, err := parseGTFSDate(safeField(record, idx, "date"))
+		exceptionType := atoiDefault(safeField(record, idx, "exception_type"), 0)
+		// exception_type: 1 = servicio agregado, 2 = servicio removido
+		if serviceID == "" || err != nil || (exceptionType != 1 && exceptionType != 2) {
+			skipped++
+			continue
+		}
+
+		if _, err := stmt.ExecContext(ctx, feedID, serviceID, date, exceptionType); err != nil {
+			skipped++
+			continue
+		}
+		count++
+	}
+
+	fmt.Printf("   calendar_dates import complete: %d exceptions (skipped: %d)\n", count, skipped)
+	return count, nil
+}
+
+// importShapes imports shapes.txt into the given gtfs_shapes generation table
+func importShapes(ctx context.Context, tx *sql.Tx, feedID int64, table string, file *zip.File) (int, error) {
+	if file == nil {
+		fmt.Println("   shapes.txt not present, skipping")
+		return 0, nil
+	}
+	rc, reader, idx, err := openCSV(file)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO `+table+`
+        (feed_id, shape_id, shape_pt_lat, shape_pt_lon, shape_pt_sequence, shape_dist_traveled)
+        VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("gtfs loader: prepare insert shape: %w", err)
+	}
+	defer stmt.Close()
+
+	count := 0
+	skipped := 0
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			skipped++
+			continue
+		}
+
+		shapeID := safeField(record, idx, "shape_id")
+		lat, latErr := strconv.ParseFloat(strings.TrimSpace(safeField(record, idx, "shape_pt_lat")), 64)
+		lon, lonErr := strconv.ParseFloat(strings.TrimSpace(safeField(record, idx, "shape_pt_lon")), 64)
+		seq, seqErr := strconv.Atoi(strings.TrimSpace(safeField(record, idx, "shape_pt_sequence")))
+		if shapeID == "" || latErr != nil || lonErr != nil || seqErr != nil {
+			skipped++
+			continue
+		}
+
+		var distTraveled sql.NullFloat64
+		if v := strings.TrimSpace(safeField(record, idx, "shape_dist_traveled")); v != "" {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				distTraveled = sql.NullFloat64{Float64: parsed, Valid: true}
+			}
+		}
+
+		if _, err := stmt.ExecContext(ctx, feedID, shapeID, lat, lon, seq, distTraveled); err != nil {
+			skipped++
+			continue
+		}
+		count++
+
+		if count%100000 == 0 {
+			fmt.Printf("   imported %d shape points...\n", count)
+		}
+	}
+
+	fmt.Printf("   shapes import complete: %d points (skipped: %d)\n", count, skipped)
+	return count, nil
+}
+
+// importFrequencies imports frequencies.txt into the given gtfs_frequencies generation table
+func importFrequencies(ctx context.Context, tx *sql.Tx, feedID int64, table string, file *zip.File) (int, error) {
+	if file == nil {
+		fmt.Println("   frequencies.txt not present, skipping")
+		return 0, nil
+	}
+	rc, reader, idx, err := openCSV(file)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO `+table+`
+        (feed_id, trip_id, start_time, end_time, headway_secs, exact_times)
+        VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("gtfs loader: prepare insert frequency: %w", err)
+	}
+	defer stmt.Close()
+
+	count := 0
+	skipped := 0
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			skipped++
+			continue
+		}
+
+		tripID := safeField(record, idx, "trip_id")
+		startTime := strings.TrimSpace(safeField(record, idx, "start_time"))
+		endTime := strings.TrimSpace(safeField(record, idx, "end_time"))
+		headway := atoiDefault(safeField(record, idx, "headway_secs"), 0)
+		if tripID == "" || startTime == "" || endTime == "" || headway <= 0 {
+			skipped++
+			continue
+		}
+		exactTimes := atoiDefault(safeField(record, idx, "exact_times"), 0)
+
+		if _, err := stmt.ExecContext(ctx, feedID, tripID, startTime, endTime, headway, exactTimes); err != nil {
+			skipped++
+			continue
+		}
+		count++
+	}
+
+	fmt.Printf("   frequencies import complete: %d records (skipped: %d)\n", count, skipped)
+	return count, nil
+}
+
+// importTransfers imports transfers.txt into the given gtfs_transfers generation table
+func importTransfers(ctx context.Context, tx *sql.Tx, feedID int64, table string, file *zip.File) (int, error) {
+	if file == nil {
+		fmt.Println("   transfers.txt not present, skipping")
+		return 0, nil
+	}
+	rc, reader, idx, err := openCSV(file)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO `+table+`
+        (feed_id, from_stop_id, to_stop_id, transfer_type, min_transfer_time)
+        VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("gtfs loader: prepare insert transfer: %w", err)
+	}
+	defer stmt.Close()
+
+	count := 0
+	skipped := 0
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			skipped++
+			continue
+		}
+
+		fromStop := safeField(record, idx, "from_stop_id")
+		toStop := safeField(record, idx, "to_stop_id")
+		if fromStop == "" || toStop == "" {
+			skipped++
+			continue
+		}
+		transferType := atoiDefault(safeField(record, idx, "transfer_type"), 0)
+
+		var minTransfer sql.NullInt64
+		if v := strings.TrimSpace(safeField(record, idx, "min_transfer_time")); v != "" {
+			if parsed, err := strconv.Atoi(v); err == nil {
+				minTransfer = sql.NullInt64{Int64: int64(parsed), Valid: true}
+			}
+		}
+
+		if _, err := stmt.ExecContext(ctx, feedID, fromStop, toStop, transferType, minTransfer); err != nil {
+			skipped++
+			continue
+		}
+		count++
+	}
+
+	fmt.Printf("   transfers import complete: %d records (skipped: %d)\n", count, skipped)
+	return count, nil
+}
@@ -0,0 +1,407 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yourorg/wayfindcl/internal/validation"
+)
+
+// Severidades de un hallazgo de validación
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Códigos de hallazgo (estables: los consume el dashboard)
+const (
+	IssueMalformedRow          = "malformed_row"
+	IssueDuplicateID           = "duplicate_id"
+	IssueInvalidCoordinates    = "invalid_coordinates"
+	IssueOutsideRegion         = "outside_region"
+	IssueUnknownRoute          = "unknown_route"
+	IssueUnknownService        = "unknown_service"
+	IssueUnknownTrip           = "unknown_trip"
+	IssueUnknownStop           = "unknown_stop"
+	IssueInvalidTime           = "invalid_time"
+	IssueImplausibleTime       = "implausible_time"
+	IssueDuplicateStopSequence = "duplicate_stop_sequence"
+	IssueDecreasingTime        = "decreasing_time"
+	IssueTripWithoutStopTimes  = "trip_without_stop_times"
+)
+
+const (
+	// maxReportedIssues limita el detalle guardado; los contadores siempre son exactos
+	maxReportedIssues = 500
+	maxIssuesPerCode  = 50
+	// DefaultMaxValidationErrors errores tolerados antes de rechazar la activación de un feed
+	DefaultMaxValidationErrors = 100
+	// Horas de servicio > 48 son válidas según la especificación pero casi siempre un error de datos
+	implausibleServiceSeconds = 48 * 3600
+)
+
+// ValidationIssue es un hallazgo puntual del validador
+type ValidationIssue struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	EntityID string `json:"entity_id,omitempty"`
+	Message  string `json:"message"`
+}
+
+// ValidationReport es el resultado legible por máquinas de validar un feed
+type ValidationReport struct {
+	FeedID       int64             `json:"feed_id,omitempty"`
+	Valid        bool              `json:"valid"`
+	ErrorCount   int               `json:"error_count"`
+	WarningCount int               `json:"warning_count"`
+	Counts       map[string]int    `json:"counts"`
+	Issues       []ValidationIssue `json:"issues"`
+	Truncated    bool              `json:"truncated,omitempty"`
+	ValidatedAt  time.Time         `json:"validated_at"`
+}
+
+// ValidationError se retorna cuando un feed supera los errores tolerados y no se activa
+type ValidationError struct {
+	Report *ValidationReport
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("gtfs validator: feed rejected with %d errors and %d warnings",
+		e.Report.ErrorCount, e.Report.WarningCount)
+}
+
+func (r *ValidationReport) add(severity, code, file string, line int, entityID, message string) {
+	r.Counts[code]++
+	if severity == SeverityError {
+		r.ErrorCount++
+	} else {
+		r.WarningCount++
+	}
+	if len(r.Issues) >= maxReportedIssues || r.Counts[code] > maxIssuesPerCode {
+		r.Truncated = true
+		return
+	}
+	r.Issues = append(r.Issues, ValidationIssue{
+		Severity: severity,
+		Code:     code,
+		File:     file,
+		Line:     line,
+		EntityID: entityID,
+		Message:  message,
+	})
+}
+
+// ParseTime convierte un horario GTFS "HH:MM:SS" a segundos desde el inicio del día de servicio.
+// Las horas pueden exceder 24 (viajes que terminan después de medianoche).
+func ParseTime(value string) (int, bool) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	h, errH := strconv.Atoi(parts[0])
+	m, errM := strconv.Atoi(parts[1])
+	s, errS := strconv.Atoi(parts[2])
+	if errH != nil || errM != nil || errS != nil || h < 0 || m < 0 || m > 59 || s < 0 || s > 59 {
+		return 0, false
+	}
+	return h*3600 + m*60 + s, true
+}
+
+// Validate valida un feed GTFS (zip en memoria) sin tocar la base de datos
+func Validate(data []byte) (*ValidationReport, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("gtfs validator: open zip: %w", err)
+	}
+	files := make(map[string]*zip.File)
+	for _, name := range requiredFiles {
+		file, err := findFile(zr, name)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = file
+	}
+	for _, name := range optionalFiles {
+		if file, err := findFile(zr, name); err == nil {
+			files[name] = file
+		}
+	}
+	return validateFiles(files)
+}
+
+// stopTimeEntry es la forma compacta de una fila de stop_times para los chequeos por viaje
+type stopTimeEntry struct {
+	seq  int32
+	arr  int32 // -1 si viene vacío (horario interpolado)
+	dep  int32
+	line int32
+}
+
+// validateFiles revisa integridad referencial, IDs duplicados, coordenadas, horarios y secuencias
+func validateFiles(files map[string]*zip.File) (*ValidationReport, error) {
+	report := &ValidationReport{
+		Counts:      make(map[string]int),
+		Issues:      []ValidationIssue{},
+		ValidatedAt: time.Now().UTC(),
+	}
+
+	// stops.txt
+	stops := make(map[string]bool)
+	err := eachRecord(report, "stops.txt", files["stops.txt"], func(line int, record []string, idx map[string]int) {
+		stopID := safeField(record, idx, "stop_id")
+		if stopID == "" {
+			report.add(SeverityError, IssueMalformedRow, "stops.txt", line, "", "stop_id vacío")
+			return
+		}
+		if stops[stopID] {
+			report.add(SeverityError, IssueDuplicateID, "stops.txt", line, stopID, "stop_id duplicado")
+			return
+		}
+		stops[stopID] = true
+
+		lat, errLat := strconv.ParseFloat(strings.TrimSpace(safeField(record, idx, "stop_lat")), 64)
+		lon, errLon := strconv.ParseFloat(strings.TrimSpace(safeField(record, idx, "stop_lon")), 64)
+		if errLat != nil || errLon != nil {
+			report.add(SeverityError, IssueInvalidCoordinates, "stops.txt", line, stopID, "stop_lat/stop_lon no numéricos")
+			return
+		}
+		if err := validation.ValidateCoordinatePair(lat, lon, "stop"); err != nil || validation.IsZeroCoordinate(lat, lon) {
+			report.add(SeverityError, IssueInvalidCoordinates, "stops.txt", line, stopID, fmt.Sprintf("coordenadas inválidas (%.6f, %.6f)", lat, lon))
+			return
+		}
+		if err := validation.ValidateSantiagoRegion(lat, lon); err != nil {
+			report.add(SeverityWarning, IssueOutsideRegion, "stops.txt", line, stopID, err.Error())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// routes.txt
+	routes := make(map[string]bool)
+	err = eachRecord(report, "routes.txt", files["routes.txt"], func(line int, record []string, idx map[string]int) {
+		routeID := safeField(record, idx, "route_id")
+		if routeID == "" {
+			report.add(SeverityError, IssueMalformedRow, "routes.txt", line, "", "route_id vacío")
+			return
+		}
+		if routes[routeID] {
+			report.add(SeverityError, IssueDuplicateID, "routes.txt", line, routeID, "route_id duplicado")
+			return
+		}
+		routes[routeID] = true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Servicios declarados (solo se verifican si el feed trae calendario)
+	services := make(map[string]bool)
+	for _, name := range []string{"calendar.txt", "calendar_dates.txt"} {
+		if files[name] == nil {
+			continue
+		}
+		err := eachRecord(report, name, files[name], func(line int, record []string, idx map[string]int) {
+			if id := safeField(record, idx, "service_id"); id != "" {
+				services[id] = true
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// trips.txt
+	trips := make(map[string]bool)
+	err = eachRecord(report, "trips.txt", files["trips.txt"], func(line int, record []string, idx map[string]int) {
+		tripID := safeField(record, idx, "trip_id")
+		if tripID == "" {
+			report.add(SeverityError, IssueMalformedRow, "trips.txt", line, "", "trip_id vacío")
+			return
+		}
+		if trips[tripID] {
+			report.add(SeverityError, IssueDuplicateID, "trips.txt", line, tripID, "trip_id duplicado")
+			return
+		}
+		trips[tripID] = true
+
+		if routeID := safeField(record, idx, "route_id"); !routes[routeID] {
+			report.add(SeverityError, IssueUnknownRoute, "trips.txt", line, tripID, fmt.Sprintf("route_id %q no existe en routes.txt", routeID))
+		}
+		if serviceID := safeField(record, idx, "service_id"); len(services) > 0 && !services[serviceID] {
+			report.add(SeverityWarning, IssueUnknownService, "trips.txt", line, tripID, fmt.Sprintf("service_id %q no existe en calendar/calendar_dates", serviceID))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// stop_times.txt
+	perTrip := make(map[string][]stopTimeEntry, len(trips))
+	parseTimeField := func(line int, tripID, field, value string) int32 {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return -1
+		}
+		secs, ok := ParseTime(value)
+		if !ok {
+			report.add(SeverityError, IssueInvalidTime, "stop_times.txt", line, tripID, fmt.Sprintf("%s %q no es un horario GTFS válido", field, value))
+			return -1
+		}
+		if secs >= implausibleServiceSeconds {
+			report.add(SeverityWarning, IssueImplausibleTime, "stop_times.txt", line, tripID, fmt.Sprintf("%s %q excede 48:00:00", field, value))
+		}
+		return int32(secs)
+	}
+	err = eachRecord(report, "stop_times.txt", files["stop_times.txt"], func(line int, record []string, idx map[string]int) {
+		tripID := safeField(record, idx, "trip_id")
+		stopID := safeField(record, idx, "stop_id")
+		seq, seqErr := strconv.Atoi(strings.TrimSpace(safeField(record, idx, "stop_sequence")))
+		if tripID == "" || stopID == "" || seqErr != nil {
+			report.add(SeverityError, IssueMalformedRow, "stop_times.txt", line, tripID, "trip_id, stop_id o stop_sequence inválido")
+			return
+		}
+		if !trips[tripID] {
+			report.add(SeverityError, IssueUnknownTrip, "stop_times.txt", line, tripID, fmt.Sprintf("trip_id %q no existe en trips.txt", tripID))
+		}
+		if !stops[stopID] {
+			report.add(SeverityError, IssueUnknownStop, "stop_times.txt", line, tripID, fmt.Sprintf("stop_id %q no existe en stops.txt", stopID))
+		}
+		perTrip[tripID] = append(perTrip[tripID], stopTimeEntry{
+			seq:  int32(seq),
+			arr:  parseTimeField(line, tripID, "arrival_time", safeField(record, idx, "arrival_time")),
+			dep:  parseTimeField(line, tripID, "departure_time", safeField(record, idx, "departure_time")),
+			line: int32(line),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Secuencias y horarios crecientes dentro de cada viaje
+	tripIDs := make([]string, 0, len(perTrip))
+	for tripID := range perTrip {
+		tripIDs = append(tripIDs, tripID)
+	}
+	sort.Strings(tripIDs)
+	for _, tripID := range tripIDs {
+		entries := perTrip[tripID]
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+		last := int32(-1)
+		for i, e := range entries {
+			if i > 0 && e.seq == entries[i-1].seq {
+				report.add(SeverityError, IssueDuplicateStopSequence, "stop_times.txt", int(e.line), tripID,
+					fmt.Sprintf("stop_sequence %d repetido", e.seq))
+			}
+			if e.arr >= 0 {
+				if e.arr < last {
+					report.add(SeverityError, IssueDecreasingTime, "stop_times.txt", int(e.line), tripID,
+						fmt.Sprintf("arrival_time retrocede en stop_sequence %d", e.seq))
+				}
+				last = e.arr
+			}
+			if e.dep >= 0 {
+				if e.dep < last {
+					report.add(SeverityError, IssueDecreasingTime, "stop_times.txt", int(e.line), tripID,
+						fmt.Sprintf("departure_time anterior a arrival_time en stop_sequence %d", e.seq))
+				}
+				last = e.dep
+			}
+		}
+	}
+	for tripID := range trips {
+		if _, ok := perTrip[tripID]; !ok {
+			report.add(SeverityWarning, IssueTripWithoutStopTimes, "trips.txt", 0, tripID, "viaje sin horarios en stop_times.txt")
+		}
+	}
+
+	report.Valid = report.ErrorCount == 0
+	return report, nil
+}
+
+// eachRecord recorre un archivo CSV del feed entregando el número de línea de cada registro.
+// Las líneas que el lector CSV no puede interpretar se reportan como malformed_row.
+func eachRecord(report *ValidationReport, name string, file *zip.File, fn func(line int, record []string, idx map[string]int)) error {
+	rc, reader, idx, err := openCSV(file)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			line := 0
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				line = parseErr.Line
+			}
+			report.add(SeverityError, IssueMalformedRow, name, line, "", err.Error())
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		fn(line, record, idx)
+	}
+}
+
+// saveValidationReport guarda el reporte junto al registro del feed
+func saveValidationReport(ctx context.Context, db *sql.DB, feedID int64, report *ValidationReport) error {
+	report.FeedID = feedID
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("gtfs validator: encode report: %w", err)
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO gtfs_validation_reports (feed_id, valid, error_count, warning_count, report)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE valid = VALUES(valid), error_count = VALUES(error_count),
+			warning_count = VALUES(warning_count), report = VALUES(report)
+	`, feedID, report.Valid, report.ErrorCount, report.WarningCount, string(payload))
+	if err != nil {
+		return fmt.Errorf("gtfs validator: save report: %w", err)
+	}
+	return nil
+}
+
+// LoadValidationReport retorna el reporte de validación de un feed (nil si no tiene)
+func LoadValidationReport(ctx context.Context, db *sql.DB, feedID int64) (*ValidationReport, error) {
+	return scanValidationReport(db.QueryRowContext(ctx,
+		"SELECT report FROM gtfs_validation_reports WHERE feed_id = ?", feedID))
+}
+
+// LatestValidationReport retorna el reporte del último feed validado (nil si no hay)
+func LatestValidationReport(ctx context.Context, db *sql.DB) (*ValidationReport, error) {
+	return scanValidationReport(db.QueryRowContext(ctx,
+		"SELECT report FROM gtfs_validation_reports ORDER BY feed_id DESC LIMIT 1"))
+}
+
+func scanValidationReport(row *sql.Row) (*ValidationReport, error) {
+	var payload string
+	if err := row.Scan(&payload); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("gtfs validator: load report: %w", err)
+	}
+	var report ValidationReport
+	if err := json.Unmarshal([]byte(payload), &report); err != nil {
+		return nil, fmt.Errorf("gtfs validator: decode report: %w", err)
+	}
+	return &report, nil
+}
@@ -15,7 +15,9 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/yourorg/wayfindcl/internal/gtfs"
+	"github.com/yourorg/wayfindcl/internal/middleware"
 	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/repository"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -25,8 +27,10 @@ var (
 	setupOnce       sync.Once     // Garantiza inicialización única
 	setupMu         sync.RWMutex  // Protege acceso a variables globales
 	dbConn          *sql.DB
+	repos           *repository.Store // Repositorios por agregado (MariaDB salvo en tests)
 	jwtSecret       []byte
-	tokenTTL        = 24 * time.Hour
+	tokenTTL        = 15 * time.Minute   // Access token de vida corta
+	refreshTTL      = 30 * 24 * time.Hour // Refresh token rotativo (por dispositivo)
 	gtfsLoader      *gtfs.Loader
 	gtfsSyncMu      sync.Mutex
 	gtfsSummaryMu   sync.RWMutex
@@ -40,6 +44,9 @@ func Setup(db *sql.DB) {
 		defer setupMu.Unlock()
 
 		dbConn = db
+		if repos == nil {
+			repos = repository.NewMariaDB(db)
+		}
 		secret := os.Getenv("JWT_SECRET")
 		if secret == "" {
 			// Verificar si estamos en producción
@@ -66,6 +73,15 @@ func Setup(db *sql.DB) {
 			}
 		}
 
+		if ttl := os.Getenv("JWT_REFRESH_TTL"); ttl != "" {
+			dur, err := time.ParseDuration(ttl)
+			if err != nil || dur <= 0 {
+				log.Printf("invalid JWT_REFRESH_TTL=%q, using default %s", ttl, refreshTTL)
+			} else {
+				refreshTTL = dur
+			}
+		}
+
 		feedURL := strings.TrimSpace(os.Getenv("GTFS_FEED_URL"))
 		if feedURL == "" {
 			feedURL = "https://www.dtpm.cl/descarga.php?file=gtfs/gtfs.zip"
@@ -75,6 +91,28 @@ func Setup(db *sql.DB) {
 			fallbackURL = "https://www.dtpm.cl/descarga.php?file=gtfs/gtfs.zip"
 		}
 		gtfsLoader = gtfs.NewLoader(feedURL, fallbackURL, nil)
+		if v := strings.TrimSpace(os.Getenv("GTFS_MAX_VALIDATION_ERRORS")); v != "" {
+			if n, err := strconv.Atoi(v); err == nil {
+				gtfsLoader.SetMaxValidationErrors(n)
+			} else {
+				log.Printf("invalid GTFS_MAX_VALIDATION_ERRORS=%q, using default %d", v, gtfs.DefaultMaxValidationErrors)
+			}
+		}
+
+		if interval := incidentSweepInterval(); interval > 0 {
+			// Expirar incidentes vencidos según el TTL de su tipo
+			go startIncidentSweeper(repos.Incidents, interval)
+		}
+
+		if retention, max := debugEventsRetention(), debugEventsMax(); retention > 0 || max > 0 {
+			// Aplicar la retención de los logs/errores guardados de la app
+			go startDebugEventPruner(repos.DebugEvents, retention, max)
+		}
+
+		if retention := arrivalObservationsRetention(); retention > 0 {
+			// Aplicar la retención de la serie de tiempo de llegadas de Red.cl
+			go startArrivalObservationPruner(repos.Arrivals, retention)
+		}
 
 		if auto := strings.TrimSpace(os.Getenv("GTFS_AUTO_SYNC")); strings.EqualFold(auto, "true") {
 			// Iniciar sincronización inicial y programar actualizaciones mensuales
@@ -90,6 +128,27 @@ func getDBConn() *sql.DB {
 	return dbConn
 }
 
+// InitRepositories reemplaza los repositorios que usan los handlers. Llamarlo
+// antes de Setup para que éste no cree los de MariaDB (ej: repository.NewMemory()
+// en tests).
+func InitRepositories(store *repository.Store) {
+	setupMu.Lock()
+	defer setupMu.Unlock()
+	repos = store
+}
+
+// getRepos retorna los repositorios de forma segura (nil antes de Setup)
+func getRepos() *repository.Store {
+	setupMu.RLock()
+	defer setupMu.RUnlock()
+	return repos
+}
+
+// Repositories expone los repositorios vigentes para construir los handlers
+func Repositories() *repository.Store {
+	return getRepos()
+}
+
 // getJWTSecret retorna el secret JWT de forma segura
 func getJWTSecret() []byte {
 	setupMu.RLock()
@@ -133,9 +192,11 @@ func checkIfSyncNeeded(db *sql.DB) (bool, time.Time) {
 	var lastDownload time.Time
 	
 	err := db.QueryRow(`
-		SELECT MAX(downloaded_at) 
-		FROM gtfs_feeds 
-		WHERE downloaded_at IS NOT NULL
+		SELECT MAX(f.downloaded_at)
+		FROM gtfs_feeds f
+		LEFT JOIN gtfs_generations g ON g.feed_id = f.id
+		WHERE f.downloaded_at IS NOT NULL
+		  AND (g.status IS NULL OR g.status <> 'failed')
 	`).Scan(&lastDownload)
 	
 	if err != nil {
@@ -164,6 +225,12 @@ func performGTFSSync(db *sql.DB) {
 	
 	summary, err := gtfsLoader.Sync(ctx, db)
 	if err != nil {
+		var verr *gtfs.ValidationError
+		if errors.As(err, &verr) {
+			log.Printf("❌ [GTFS-SYNC] Feed rechazado por el validador: %d errores, %d advertencias %v",
+				verr.Report.ErrorCount, verr.Report.WarningCount, verr.Report.Counts)
+			return
+		}
 		log.Printf("❌ [GTFS-SYNC] Error en sincronización: %v", err)
 		return
 	}
@@ -171,23 +238,40 @@ func performGTFSSync(db *sql.DB) {
 	gtfsSummaryMu.Lock()
 	gtfsLastSummary = summary
 	gtfsSummaryMu.Unlock()
-	
+
 	elapsed := time.Since(startTime)
+	if summary.Skipped {
+		log.Printf("✅ [GTFS-SYNC] Feed sin cambios (feed %d), nada que importar (%.1fs)", summary.FeedID, elapsed.Seconds())
+		return
+	}
+	invalidateTransitRouter()
+	
 	log.Printf("✅ [GTFS-SYNC] Sincronización completada en %.1f minutos", elapsed.Minutes())
-	log.Printf("📊 [GTFS-SYNC] Paradas importadas: %d", summary.StopsImported)
+	log.Printf("📊 [GTFS-SYNC] Archivos cambiados: %s", strings.Join(summary.ChangedFiles, ", "))
+	log.Printf("📊 [GTFS-SYNC] Paradas +%d ~%d -%d, rutas +%d ~%d -%d, viajes +%d ~%d -%d",
+		summary.Changes.Stops.AddedCount, summary.Changes.Stops.ModifiedCount, summary.Changes.Stops.RemovedCount,
+		summary.Changes.Routes.AddedCount, summary.Changes.Routes.ModifiedCount, summary.Changes.Routes.RemovedCount,
+		summary.Changes.Trips.AddedCount, summary.Changes.Trips.ModifiedCount, summary.Changes.Trips.RemovedCount)
+	log.Printf("📊 [GTFS-SYNC] Paradas escritas: %d", summary.StopsImported)
+	log.Printf("📊 [GTFS-SYNC] Rutas: %d, viajes: %d, horarios: %d", summary.RoutesImported, summary.TripsImported, summary.StopTimesImported)
+	log.Printf("📊 [GTFS-SYNC] Calendarios: %d (+%d excepciones), puntos de shape: %d, frecuencias: %d, transbordos: %d",
+		summary.CalendarsImported, summary.CalendarDatesImported, summary.ShapePointsImported,
+		summary.FrequenciesImported, summary.TransfersImported)
 	log.Printf("📅 [GTFS-SYNC] Próxima verificación programada en 30 días")
 }
 
-type userClaims struct {
-	Username string `json:"username"`
-	jwt.RegisteredClaims
+// JWTSecret expone el secret JWT para el middleware de autenticación
+func JWTSecret() []byte {
+	return getJWTSecret()
 }
 
-func issueToken(userID int64, username string) (string, time.Time, error) {
+func issueToken(userID int64, username string, role models.Role, sessionID string) (string, time.Time, error) {
 	now := time.Now()
 	expires := now.Add(tokenTTL)
-	claims := userClaims{
-		Username: username,
+	claims := middleware.Claims{
+		Username:  username,
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Subject:   strconv.FormatInt(userID, 10),
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -201,10 +285,11 @@ func issueToken(userID int64, username string) (string, time.Time, error) {
 
 // Register handles POST /api/register.
 func Register(c *fiber.Ctx) error {
-	db := getDBConn()
-	if db == nil {
+	store := getRepos()
+	if store == nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "server not ready"})
 	}
+	ctx := c.UserContext()
 	var req models.RegisterRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{Error: "invalid json"})
@@ -231,31 +316,31 @@ func Register(c *fiber.Ctx) error {
 		log.Printf("📱 Registro biométrico para usuario: %s", req.Username)
 
 		// Verificar que el token biométrico no esté ya registrado
-		var existingID int64
-		err := db.QueryRow(`SELECT id FROM users WHERE biometric_id = ?`, req.BiometricToken).Scan(&existingID)
+		existing, err := store.Users.ByBiometricID(ctx, req.BiometricToken)
 		if err == nil {
-			log.Printf("⚠️ Token biométrico ya registrado para user_id=%d", existingID)
+			log.Printf("⚠️ Token biométrico ya registrado para user_id=%d", existing.ID)
 			return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{Error: "biometric token already registered"})
-		} else if !errors.Is(err, sql.ErrNoRows) {
+		} else if !errors.Is(err, repository.ErrNotFound) {
 			log.Printf("❌ Error verificando token biométrico: %v", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "db error"})
 		}
 
 		// Insertar usuario con autenticación biométrica (sin password)
-		res, err := db.Exec(`
-			INSERT INTO users (username, email, name, biometric_id, auth_type) 
-			VALUES (?, ?, ?, ?, 'biometric')
-		`, req.Username, req.Email, req.Name, req.BiometricToken)
-
+		userID, err = store.Users.Create(ctx, &models.User{
+			Username:    req.Username,
+			Email:       req.Email,
+			Name:        req.Name,
+			BiometricID: req.BiometricToken,
+			AuthType:    "biometric",
+		})
 		if err != nil {
-			if strings.Contains(err.Error(), "Duplicate entry") {
+			if errors.Is(err, repository.ErrDuplicate) {
 				return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{Error: "username or email already exists"})
 			}
 			log.Printf("❌ Error insertando usuario biométrico: %v", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "db error"})
 		}
 
-		userID, _ = res.LastInsertId()
 		log.Printf("✅ Usuario biométrico registrado: id=%d, username=%s", userID, req.Username)
 
 	} else if req.Password != "" {
@@ -267,41 +352,38 @@ func Register(c *fiber.Ctx) error {
 			return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "failed to secure password"})
 		}
 
-		res, err := db.Exec(`
-			INSERT INTO users (username, email, name, password_hash, auth_type) 
-			VALUES (?, ?, ?, ?, 'password')
-		`, req.Username, req.Email, req.Name, string(hash))
-
+		userID, err = store.Users.Create(ctx, &models.User{
+			Username:     req.Username,
+			Email:        req.Email,
+			Name:         req.Name,
+			PasswordHash: string(hash),
+			AuthType:     "password",
+		})
 		if err != nil {
-			if strings.Contains(err.Error(), "Duplicate entry") {
+			if errors.Is(err, repository.ErrDuplicate) {
 				return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{Error: "username or email already exists"})
 			}
 			return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "db error"})
 		}
-
-		userID, _ = res.LastInsertId()
 		log.Printf("✅ Usuario con password registrado: id=%d, username=%s", userID, req.Username)
 
 	} else {
 		return c.Status(fiber.StatusUnprocessableEntity).JSON(models.ErrorResponse{Error: "password or biometric_token required"})
 	}
 
-	token, expiresAt, err := issueToken(userID, req.Username)
+	resp, err := startSession(c, store, userID, req.Username, models.RoleUser, req.DeviceInfo)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "failed to sign token"})
 	}
+	resp.User = models.UserDTO{ID: userID, Username: req.Username, Name: req.Name, Role: models.RoleUser}
 	c.Set("Cache-Control", "no-store")
-	return c.Status(fiber.StatusCreated).JSON(models.LoginResponse{
-		Token:     token,
-		User:      models.UserDTO{ID: userID, Username: req.Username, Name: req.Name},
-		ExpiresAt: expiresAt,
-	})
+	return c.Status(fiber.StatusCreated).JSON(resp)
 }
 
 // Login handles POST /api/login.
 func Login(c *fiber.Ctx) error {
-	db := getDBConn()
-	if db == nil {
+	store := getRepos()
+	if store == nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "server not ready"})
 	}
 	var req models.LoginRequest
@@ -313,38 +395,34 @@ func Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnprocessableEntity).JSON(models.ErrorResponse{Error: "username and password required"})
 	}
 
-	var (
-		id                           int64
-		username, name, passwordHash string
-	)
-	err := db.QueryRow(`SELECT id, username, name, password_hash FROM users WHERE username = ?`, req.Username).Scan(&id, &username, &name, &passwordHash)
+	user, err := store.Users.ByUsername(c.UserContext(), req.Username)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, repository.ErrNotFound) {
 			return c.Status(fiber.StatusUnauthorized).JSON(models.ErrorResponse{Error: "invalid credentials"})
 		}
 		log.Printf("❌ Error consultando usuario: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "db error"})
 	}
-	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(models.ErrorResponse{Error: "invalid credentials"})
 	}
-	token, expiresAt, err := issueToken(id, username)
+	if user.DisabledAt != nil {
+		return c.Status(fiber.StatusForbidden).JSON(models.ErrorResponse{Error: "account disabled"})
+	}
+	resp, err := startSession(c, store, user.ID, user.Username, user.Role, req.DeviceInfo)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "failed to sign token"})
 	}
+	resp.User = models.UserDTO{ID: user.ID, Username: user.Username, Name: user.Name, Role: user.Role}
 	c.Set("Cache-Control", "no-store")
-	return c.Status(fiber.StatusOK).JSON(models.LoginResponse{
-		Token:     token,
-		User:      models.UserDTO{ID: id, Username: username, Name: name},
-		ExpiresAt: expiresAt,
-	})
+	return c.Status(fiber.StatusOK).JSON(resp)
 }
 
 // BiometricRegister handles POST /api/auth/biometric/register
 // Registers a new user using biometric authentication (for blind users)
 func BiometricRegister(c *fiber.Ctx) error {
-	db := getDBConn()
-	if db == nil {
+	store := getRepos()
+	if store == nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "server not ready"})
 	}
 
@@ -373,46 +451,47 @@ func BiometricRegister(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnprocessableEntity).JSON(models.ErrorResponse{Error: "invalid email"})
 	}
 
+	ctx := c.UserContext()
+
 	// Verificar si ya existe el biometric_id
-	var existingID int64
-	err := db.QueryRow(`SELECT id FROM users WHERE biometric_id = ?`, req.BiometricID).Scan(&existingID)
+	_, err := store.Users.ByBiometricID(ctx, req.BiometricID)
 	if err == nil {
 		return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{Error: "biometric already registered"})
-	} else if !errors.Is(err, sql.ErrNoRows) {
+	} else if !errors.Is(err, repository.ErrNotFound) {
 		log.Printf("❌ Error verificando biometric_id: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "db error"})
 	}
 
 	// Verificar si ya existe el username
-	err = db.QueryRow(`SELECT id FROM users WHERE username = ?`, req.Username).Scan(&existingID)
+	_, err = store.Users.ByUsername(ctx, req.Username)
 	if err == nil {
 		return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{Error: "username already exists"})
-	} else if !errors.Is(err, sql.ErrNoRows) {
+	} else if !errors.Is(err, repository.ErrNotFound) {
 		log.Printf("❌ Error verificando username: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "db error"})
 	}
 
 	// Insertar nuevo usuario biométrico
-	res, err := db.Exec(
-		`INSERT INTO users (biometric_id, username, name, email, device_info, auth_type, created_at, last_login) VALUES (?, ?, ?, ?, ?, 'biometric', NOW(), NOW())`,
-		req.BiometricID,
-		req.Username,
-		req.Username,
-		sql.NullString{String: req.Email, Valid: req.Email != ""},
-		sql.NullString{String: req.DeviceInfo, Valid: req.DeviceInfo != ""},
-	)
+	now := time.Now()
+	userID, err := store.Users.Create(ctx, &models.User{
+		BiometricID: req.BiometricID,
+		Username:    req.Username,
+		Name:        req.Username,
+		Email:       req.Email,
+		DeviceInfo:  req.DeviceInfo,
+		AuthType:    "biometric",
+		LastLogin:   &now,
+	})
 	if err != nil {
 		log.Printf("Error inserting biometric user: %v", err)
-		if strings.Contains(err.Error(), "Duplicate entry") {
+		if errors.Is(err, repository.ErrDuplicate) {
 			return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{Error: "username or biometric already exists"})
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "db error"})
 	}
 
-	userID, _ := res.LastInsertId()
-
-	// Generar token JWT
-	token, expiresAt, err := issueToken(userID, req.Username)
+	// Generar token JWT + sesión del dispositivo
+	resp, err := startSession(c, store, userID, req.Username, models.RoleUser, req.DeviceInfo)
 	if err != nil {
 		log.Printf("Error generating token: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "failed to sign token"})
@@ -420,25 +499,24 @@ func BiometricRegister(c *fiber.Ctx) error {
 
 	log.Printf("✅ Biometric user registered: id=%d, username=%s", userID, req.Username)
 
+	resp.User = models.UserDTO{
+		ID:       userID,
+		Username: req.Username,
+		Name:     req.Username,
+		Email:    req.Email,
+		Role:     models.RoleUser,
+	}
+	resp.Message = fmt.Sprintf("¡Bienvenido, %s! Tu cuenta ha sido creada exitosamente", req.Username)
+
 	c.Set("Cache-Control", "no-store")
-	return c.Status(fiber.StatusCreated).JSON(models.LoginResponse{
-		Token: token,
-		User: models.UserDTO{
-			ID:       userID,
-			Username: req.Username,
-			Name:     req.Username,
-			Email:    req.Email,
-		},
-		ExpiresAt: expiresAt,
-		Message:   fmt.Sprintf("¡Bienvenido, %s! Tu cuenta ha sido creada exitosamente", req.Username),
-	})
+	return c.Status(fiber.StatusCreated).JSON(resp)
 }
 
 // BiometricLogin handles POST /api/auth/biometric/login
 // Authenticates a user using biometric ID (for blind users)
 func BiometricLogin(c *fiber.Ctx) error {
-	db := getDBConn()
-	if db == nil {
+	store := getRepos()
+	if store == nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "server not ready"})
 	}
 
@@ -453,32 +531,29 @@ func BiometricLogin(c *fiber.Ctx) error {
 	}
 
 	// Buscar usuario por biometric_id
-	var (
-		id       int64
-		username string
-		email    sql.NullString
-	)
-	err := db.QueryRow(
-		`SELECT id, username, email FROM users WHERE biometric_id = ? AND auth_type = 'biometric'`,
-		req.BiometricID,
-	).Scan(&id, &username, &email)
-
+	user, err := store.Users.ByBiometricID(c.UserContext(), req.BiometricID)
+	if err == nil && user.AuthType != "biometric" {
+		err = repository.ErrNotFound
+	}
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, repository.ErrNotFound) {
 			return c.Status(fiber.StatusUnauthorized).JSON(models.ErrorResponse{Error: "biometric not recognized"})
 		}
 		log.Printf("❌ Error consultando usuario biométrico: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "db error"})
 	}
+	if user.DisabledAt != nil {
+		return c.Status(fiber.StatusForbidden).JSON(models.ErrorResponse{Error: "account disabled"})
+	}
+	id, username, role := user.ID, user.Username, user.Role
 
 	// Actualizar last_login
-	_, err = db.Exec(`UPDATE users SET last_login = NOW() WHERE id = ?`, id)
-	if err != nil {
+	if err := store.Users.TouchLastLogin(c.UserContext(), id); err != nil {
 		log.Printf("⚠️ Warning: failed to update last_login for user %d: %v", id, err)
 	}
 
-	// Generar token JWT
-	token, expiresAt, err := issueToken(id, username)
+	// Generar token JWT + sesión del dispositivo
+	resp, err := startSession(c, store, id, username, role, req.DeviceInfo)
 	if err != nil {
 		log.Printf("Error generating token: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "failed to sign token"})
@@ -486,30 +561,24 @@ func BiometricLogin(c *fiber.Ctx) error {
 
 	log.Printf("✅ Biometric login successful: id=%d, username=%s", id, username)
 
-	emailStr := ""
-	if email.Valid {
-		emailStr = email.String
+	resp.User = models.UserDTO{
+		ID:       id,
+		Username: username,
+		Name:     username,
+		Email:    user.Email,
+		Role:     role,
 	}
+	resp.Message = fmt.Sprintf("Bienvenido de nuevo, %s!", username) // Mensaje de bienvenida
 
 	c.Set("Cache-Control", "no-store")
-	return c.Status(fiber.StatusOK).JSON(models.LoginResponse{
-		Token: token,
-		User: models.UserDTO{
-			ID:       id,
-			Username: username,
-			Name:     username,
-			Email:    emailStr,
-		},
-		ExpiresAt: expiresAt,
-		Message:   fmt.Sprintf("Bienvenido de nuevo, %s!", username), // Mensaje de bienvenida
-	})
+	return c.Status(fiber.StatusOK).JSON(resp)
 }
 
 // CheckBiometricExists handles POST /api/biometric/check
 // Verifica si un token biométrico ya está registrado y retorna info del usuario
 func CheckBiometricExists(c *fiber.Ctx) error {
-	db := getDBConn()
-	if db == nil {
+	store := getRepos()
+	if store == nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "server not ready"})
 	}
 
@@ -527,18 +596,12 @@ func CheckBiometricExists(c *fiber.Ctx) error {
 	}
 
 	// Verificar si existe y obtener datos del usuario
-	var (
-		userID   int64
-		username string
-		email    sql.NullString
-	)
-	err := db.QueryRow(
-		`SELECT id, username, email FROM users WHERE biometric_id = ? AND auth_type = 'biometric'`,
-		req.BiometricToken,
-	).Scan(&userID, &username, &email)
-
+	user, err := store.Users.ByBiometricID(c.UserContext(), req.BiometricToken)
+	if err == nil && user.AuthType != "biometric" {
+		err = repository.ErrNotFound
+	}
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, repository.ErrNotFound) {
 			// No existe - cliente debe mostrar pantalla de registro
 			log.Printf("🔍 Token biométrico no encontrado - usuario nuevo")
 			return c.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -553,19 +616,14 @@ func CheckBiometricExists(c *fiber.Ctx) error {
 	}
 
 	// Usuario existe - retornar información para login automático
-	log.Printf("✅ Token biométrico encontrado: user_id=%d, username=%s", userID, username)
-	
-	emailStr := ""
-	if email.Valid {
-		emailStr = email.String
-	}
+	log.Printf("✅ Token biométrico encontrado: user_id=%d, username=%s", user.ID, user.Username)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"exists":   true,
 		"action":   "auto_login",
-		"user_id":  userID,
-		"username": username,
-		"email":    emailStr,
-		"message":  fmt.Sprintf("Bienvenido de nuevo, %s!", username),
+		"user_id":  user.ID,
+		"username": user.Username,
+		"email":    user.Email,
+		"message":  fmt.Sprintf("Bienvenido de nuevo, %s!", user.Username),
 	})
 }
@@ -0,0 +1,525 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/middleware"
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/redcl"
+)
+
+const (
+	// boardingPollInterval es cada cuánto se consultan los paraderos con alertas
+	boardingPollInterval = 15 * time.Second
+	// boardingHotLease es la suscripción al refresco en segundo plano de cada
+	// paradero con alertas; se renueva en cada vuelta
+	boardingHotLease = 4 * boardingPollInterval
+	// boardingPollWorkers limita los paraderos consultados a la vez
+	boardingPollWorkers = 4
+	// boardingArrivalKm es la distancia a la que el bus cuenta como llegando
+	boardingArrivalKm = 0.15
+	// boardingBusSpeedKmh estima los minutos cuando la fuente no los informa
+	boardingBusSpeedKmh = 18.0
+
+	maxBoardingAlertsPerUser      = 5
+	defaultBoardingExpiresMinutes = 60
+	maxBoardingExpiresMinutes     = 180
+	defaultBoardingMinutes        = 5.0
+	defaultBoardingDistanceKm     = 1.0
+)
+
+var boardingRoutePattern = regexp.MustCompile(`^[A-Z0-9-]{1,10}$`)
+
+// BoardingAlertHandler vigila las alertas de abordaje: consulta las llegadas
+// de cada paradero con alertas (a través del caché compartido) y envía los
+// eventos a la app del usuario por Server-Sent Events. Las alertas viven en
+// memoria: duran a lo más maxBoardingExpiresMinutes.
+type BoardingAlertHandler struct {
+	arrivals *redcl.ArrivalsCache
+
+	mu      sync.Mutex
+	alerts  map[int64]*models.BoardingAlert
+	nextID  int64
+	streams map[int64]map[chan sseEvent]struct{} // userID -> streams abiertos
+	wake    chan struct{}
+}
+
+func NewBoardingAlertHandler(arrivals *redcl.ArrivalsCache) *BoardingAlertHandler {
+	h := &BoardingAlertHandler{
+		arrivals: arrivals,
+		alerts:   make(map[int64]*models.BoardingAlert),
+		streams:  make(map[int64]map[chan sseEvent]struct{}),
+		wake:     make(chan struct{}, 1),
+	}
+	go h.watch()
+	return h
+}
+
+// buildBoardingAlert valida la solicitud; retorna el mensaje de error si no es válida
+func buildBoardingAlert(userID int64, req models.BoardingAlertRequest, now time.Time) (*models.BoardingAlert, string) {
+	alert := &models.BoardingAlert{
+		UserID:    userID,
+		StopCode:  strings.ToUpper(strings.TrimSpace(req.StopCode)),
+		Route:     strings.ToUpper(strings.TrimSpace(req.Route)),
+		Trigger:   req.Trigger,
+		Status:    models.BoardingAlertWatching,
+		CreatedAt: now,
+	}
+	if !stopCodePattern.MatchString(alert.StopCode) {
+		return nil, "stop_code is invalid"
+	}
+	if !boardingRoutePattern.MatchString(alert.Route) {
+		return nil, "route is invalid"
+	}
+
+	switch req.Trigger {
+	case models.BoardingTriggerMinutes:
+		threshold := defaultBoardingMinutes
+		if req.Threshold != nil {
+			threshold = *req.Threshold
+		}
+		if threshold < 1 || threshold > 60 {
+			return nil, "threshold must be between 1 and 60 minutes"
+		}
+		alert.Threshold = &threshold
+	case models.BoardingTriggerDistance:
+		threshold := defaultBoardingDistanceKm
+		if req.Threshold != nil {
+			threshold = *req.Threshold
+		}
+		if threshold < 0.2 || threshold > 20 {
+			return nil, "threshold must be between 0.2 and 20 km"
+		}
+		alert.Threshold = &threshold
+	case models.BoardingTriggerArrived:
+	default:
+		return nil, "trigger must be minutes, distance or arrived"
+	}
+
+	minutes := defaultBoardingExpiresMinutes
+	if req.ExpiresInMinutes != nil {
+		minutes = *req.ExpiresInMinutes
+	}
+	if minutes < 1 || minutes > maxBoardingExpiresMinutes {
+		return nil, fmt.Sprintf("expires_in_minutes must be between 1 and %d", maxBoardingExpiresMinutes)
+	}
+	alert.ExpiresAt = now.Add(time.Duration(minutes) * time.Minute)
+	return alert, ""
+}
+
+// nearestBoardingBus retorna el bus de la ruta más cercano al paradero
+func nearestBoardingBus(stop *redcl.StopArrivals, route string) *models.BoardingBus {
+	var nearest *models.BoardingBus
+	for _, arrival := range stop.Arrivals {
+		if !strings.EqualFold(arrival.RouteNumber, route) {
+			continue
+		}
+		if nearest != nil && arrival.DistanceKm >= nearest.DistanceKm {
+			continue
+		}
+		bus := &models.BoardingBus{DistanceKm: arrival.DistanceKm, Plate: arrival.Plate}
+		if arrival.EstimatedMinutes != nil {
+			bus.Minutes = *arrival.EstimatedMinutes
+		} else {
+			bus.Minutes = int(math.Ceil(arrival.DistanceKm / boardingBusSpeedKmh * 60))
+			bus.MinutesEstimated = true
+		}
+		nearest = bus
+	}
+	return nearest
+}
+
+// evaluateBoardingAlert actualiza la alerta con una consulta de su paradero y
+// retorna los eventos a enviar. done indica que la alerta terminó.
+//   - El bus está llegando (≤ boardingArrivalKm o 0 minutos): "arrived" y termina
+//   - Se cumple el umbral: "triggered" y sigue vigilando hasta la llegada
+//   - La ruta aparece entre los buses que pasaron sin verse llegar: "passed" y
+//     vuelve a esperar al siguiente bus
+//   - Cambian los minutos del bus más cercano: "update"
+func evaluateBoardingAlert(alert *models.BoardingAlert, stop *redcl.StopArrivals, now time.Time) (events []models.BoardingEvent, done bool) {
+	event := func(kind models.BoardingEventKind, message string, bus *models.BoardingBus) models.BoardingEvent {
+		return models.BoardingEvent{
+			AlertID:  alert.ID,
+			Kind:     kind,
+			StopCode: alert.StopCode,
+			Route:    alert.Route,
+			Message:  message,
+			Bus:      bus,
+			At:       now,
+		}
+	}
+
+	// Con el caché la misma consulta puede llegar dos veces
+	if alert.CheckedAt != nil && !stop.LastUpdated.After(*alert.CheckedAt) {
+		return nil, false
+	}
+	checkedAt := stop.LastUpdated
+	alert.CheckedAt = &checkedAt
+
+	bus := nearestBoardingBus(stop, alert.Route)
+	previous := alert.Bus
+	alert.Bus = bus
+
+	if bus != nil && (bus.DistanceKm <= boardingArrivalKm || bus.Minutes == 0) {
+		alert.Status = models.BoardingAlertArrived
+		message := fmt.Sprintf("El %s está llegando al paradero %s", alert.Route, alert.StopCode)
+		if bus.Plate != "" {
+			message += ", patente " + spellPlate(bus.Plate)
+		}
+		return append(events, event(models.BoardingEventArrived, message, bus)), true
+	}
+
+	// Los buses que pasaron antes de crear la alerta no le interesan al usuario
+	for _, route := range stop.BussesPassed {
+		if strings.EqualFold(route, alert.Route) && stop.LastUpdated.After(alert.CreatedAt) {
+			alert.Status = models.BoardingAlertWatching
+			alert.TriggeredAt = nil
+			events = append(events, event(models.BoardingEventPassed,
+				fmt.Sprintf("Un %s acaba de pasar por el paradero. Te aviso cuando se acerque el siguiente", alert.Route), bus))
+			break
+		}
+	}
+	if bus == nil {
+		return events, false
+	}
+
+	if alert.Status == models.BoardingAlertWatching {
+		reached := false
+		switch alert.Trigger {
+		case models.BoardingTriggerMinutes:
+			reached = float64(bus.Minutes) <= *alert.Threshold
+		case models.BoardingTriggerDistance:
+			reached = bus.DistanceKm <= *alert.Threshold
+		}
+		if reached {
+			alert.Status = models.BoardingAlertTriggered
+			alert.TriggeredAt = &now
+			return append(events, event(models.BoardingEventTriggered, describeBoardingBus(alert.Route, bus), bus)), false
+		}
+	}
+
+	if previous == nil || previous.Minutes != bus.Minutes {
+		events = append(events, event(models.BoardingEventUpdate, describeBoardingBus(alert.Route, bus), bus))
+	}
+	return events, false
+}
+
+// describeBoardingBus arma el mensaje hablado de un bus que se acerca
+func describeBoardingBus(route string, bus *models.BoardingBus) string {
+	minutes := "1 minuto"
+	if bus.Minutes != 1 {
+		minutes = strconv.Itoa(bus.Minutes) + " minutos"
+	}
+	if bus.MinutesEstimated {
+		minutes = "unos " + minutes
+	}
+	distance := fmt.Sprintf("%d metros", int(math.Round(bus.DistanceKm*1000/10))*10)
+	if bus.DistanceKm >= 1 {
+		distance = strings.Replace(fmt.Sprintf("%.1f kilómetros", bus.DistanceKm), ".", ",", 1)
+	}
+	return fmt.Sprintf("El %s está a %s, a %s", route, minutes, distance)
+}
+
+// spellPlate separa la patente para que el lector de pantalla la deletree
+func spellPlate(plate string) string {
+	return strings.Join(strings.Split(strings.ToUpper(plate), ""), " ")
+}
+
+// watch consulta cada boardingPollInterval (o apenas se crea una alerta) los
+// paraderos con alertas activas
+func (h *BoardingAlertHandler) watch() {
+	ticker := time.NewTicker(boardingPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-h.wake:
+		}
+		h.poll()
+	}
+}
+
+func (h *BoardingAlertHandler) poll() {
+	now := time.Now()
+	stops := make(map[string]bool)
+
+	h.mu.Lock()
+	for id, alert := range h.alerts {
+		if !now.Before(alert.ExpiresAt) {
+			alert.Status = models.BoardingAlertExpired
+			h.finishLocked(id, models.BoardingEvent{
+				AlertID:  id,
+				Kind:     models.BoardingEventExpired,
+				StopCode: alert.StopCode,
+				Route:    alert.Route,
+				Message:  fmt.Sprintf("Se acabó el tiempo de espera del %s en el paradero %s", alert.Route, alert.StopCode),
+				At:       now,
+			})
+			continue
+		}
+		stops[alert.StopCode] = true
+	}
+	h.mu.Unlock()
+
+	// Sin suscripción cada vuelta puede leer un caché de hasta
+	// BUS_ARRIVALS_CACHE_TTL: el refresco mantiene las llegadas al día
+	for stopCode := range stops {
+		if _, err := h.arrivals.Subscribe(stopCode, boardingHotLease); err != nil {
+			log.Printf("⚠️  [BOARDING] No se pudo suscribir el paradero %s: %v", stopCode, err)
+		}
+	}
+
+	slots := make(chan struct{}, boardingPollWorkers)
+	var wg sync.WaitGroup
+	for stopCode := range stops {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(stopCode string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			h.pollStop(stopCode)
+		}(stopCode)
+	}
+	wg.Wait()
+}
+
+func (h *BoardingAlertHandler) pollStop(stopCode string) {
+	ctx, cancel := context.WithTimeout(context.Background(), boardingPollInterval*2)
+	defer cancel()
+
+	stop, _, err := h.arrivals.Get(ctx, stopCode)
+	if err != nil {
+		// Se reintenta en la próxima vuelta; la alerta sigue activa
+		log.Printf("⚠️  [BOARDING] Error consultando llegadas de %s: %v", stopCode, err)
+		return
+	}
+
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for id, alert := range h.alerts {
+		if alert.StopCode != stopCode {
+			continue
+		}
+		events, done := evaluateBoardingAlert(alert, stop, now)
+		for i, event := range events {
+			if done && i == len(events)-1 {
+				h.finishLocked(id, event)
+				break
+			}
+			h.publishLocked(alert.UserID, event)
+		}
+	}
+}
+
+// publishLocked envía el evento a los streams del usuario. Requiere h.mu tomado.
+func (h *BoardingAlertHandler) publishLocked(userID int64, event models.BoardingEvent) {
+	if event.Kind != models.BoardingEventUpdate {
+		log.Printf("🚏 [BOARDING] Alerta %d (%s en %s): %s", event.AlertID, event.Route, event.StopCode, event.Message)
+	}
+	for ch := range h.streams[userID] {
+		deliverSSE(ch, sseEvent{name: string(event.Kind), data: event})
+	}
+}
+
+// finishLocked envía el evento final de una alerta y la descarta. Requiere h.mu tomado.
+func (h *BoardingAlertHandler) finishLocked(id int64, event models.BoardingEvent) {
+	alert := h.alerts[id]
+	delete(h.alerts, id)
+	h.publishLocked(alert.UserID, event)
+}
+
+// CreateBoardingAlert maneja POST /api/boarding-alerts
+// Avisa cuando la ruta está a N minutos, a N km o llegando al paradero
+func (h *BoardingAlertHandler) CreateBoardingAlert(c *fiber.Ctx) error {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Authentication required",
+		})
+	}
+
+	var req models.BoardingAlertRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	alert, errMsg := buildBoardingAlert(userID, req, time.Now())
+	if errMsg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errMsg,
+		})
+	}
+
+	h.mu.Lock()
+	active := 0
+	for _, existing := range h.alerts {
+		if existing.UserID == userID {
+			active++
+		}
+	}
+	if active >= maxBoardingAlertsPerUser {
+		h.mu.Unlock()
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Boarding alert limit reached",
+		})
+	}
+	h.nextID++
+	alert.ID = h.nextID
+	h.alerts[alert.ID] = alert
+	created := *alert
+	h.mu.Unlock()
+
+	// Consultar ya, sin esperar la próxima vuelta
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+// ListBoardingAlerts maneja GET /api/boarding-alerts (alertas activas del usuario)
+func (h *BoardingAlertHandler) ListBoardingAlerts(c *fiber.Ctx) error {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Authentication required",
+		})
+	}
+
+	alerts := h.userAlerts(userID)
+	return c.JSON(fiber.Map{
+		"alerts": alerts,
+		"count":  len(alerts),
+	})
+}
+
+// userAlerts copia las alertas activas del usuario, más antiguas primero
+func (h *BoardingAlertHandler) userAlerts(userID int64) []models.BoardingAlert {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	alerts := []models.BoardingAlert{}
+	for _, alert := range h.alerts {
+		if alert.UserID == userID {
+			alerts = append(alerts, *alert)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].ID < alerts[j].ID })
+	return alerts
+}
+
+// CancelBoardingAlert maneja DELETE /api/boarding-alerts/:id
+func (h *BoardingAlertHandler) CancelBoardingAlert(c *fiber.Ctx) error {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Authentication required",
+		})
+	}
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid alert ID",
+		})
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	alert, ok := h.alerts[id]
+	if !ok || alert.UserID != userID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Boarding alert not found",
+		})
+	}
+	alert.Status = models.BoardingAlertCancelled
+	h.finishLocked(id, models.BoardingEvent{
+		AlertID:  id,
+		Kind:     models.BoardingEventCancelled,
+		StopCode: alert.StopCode,
+		Route:    alert.Route,
+		Message:  fmt.Sprintf("Alerta del %s cancelada", alert.Route),
+		At:       time.Now(),
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Boarding alert cancelled",
+	})
+}
+
+// StreamBoardingAlerts maneja GET /api/boarding-alerts/stream
+// Server-Sent Events con las alertas del usuario: "alerts" con las activas al
+// conectar y luego update, triggered, arrived, passed, expired y cancelled
+// (ver models.BoardingEvent). Al reconectar no se pierden alertas: siguen
+// activas en el servidor.
+func (h *BoardingAlertHandler) StreamBoardingAlerts(c *fiber.Ctx) error {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Authentication required",
+		})
+	}
+
+	// Suscribirse antes de leer las activas para no perder eventos
+	events := make(chan sseEvent, sseBuffer)
+	h.mu.Lock()
+	if h.streams[userID] == nil {
+		h.streams[userID] = make(map[chan sseEvent]struct{})
+	}
+	h.streams[userID][events] = struct{}{}
+	h.mu.Unlock()
+	cancel := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.streams[userID], events)
+		if len(h.streams[userID]) == 0 {
+			delete(h.streams, userID)
+		}
+	}
+	active := h.userAlerts(userID)
+	conn := c.Context().Conn()
+
+	setSSEHeaders(c)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+
+		send := func(event sseEvent) bool {
+			_ = conn.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+			return writeSSE(w, event) == nil
+		}
+		heartbeat := time.NewTicker(sseHeartbeat)
+		defer heartbeat.Stop()
+
+		if !send(sseEvent{name: "alerts", data: active}) {
+			return
+		}
+		for {
+			select {
+			case event := <-events:
+				if !send(event) {
+					return
+				}
+			case <-heartbeat.C:
+				_ = conn.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+				if writeSSEPing(w) != nil {
+					return
+				}
+			}
+		}
+	})
+	return nil
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/redcl"
+)
+
+func TestEvaluateBoardingAlert(t *testing.T) {
+	created := time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC)
+	now := created.Add(5 * time.Minute)
+
+	bus := func(route string, km float64, minutes *int) redcl.BusArrival {
+		return redcl.BusArrival{RouteNumber: route, DistanceKm: km, EstimatedMinutes: minutes}
+	}
+	stop := func(updated time.Time, passed []string, arrivals ...redcl.BusArrival) *redcl.StopArrivals {
+		return &redcl.StopArrivals{StopCode: "PA433", Arrivals: arrivals, BussesPassed: passed, LastUpdated: updated}
+	}
+	watching := func(trigger models.BoardingTrigger, threshold float64) models.BoardingAlert {
+		return models.BoardingAlert{
+			ID: 1, StopCode: "PA433", Route: "405", Trigger: trigger, Threshold: &threshold,
+			Status: models.BoardingAlertWatching, CreatedAt: created,
+		}
+	}
+	checkedAt := now
+
+	tests := []struct {
+		name       string
+		alert      models.BoardingAlert
+		stop       *redcl.StopArrivals
+		want       []models.BoardingEventKind
+		wantDone   bool
+		wantStatus models.BoardingAlertStatus
+	}{
+		{
+			name:       "primera consulta informa el bus más cercano",
+			alert:      watching(models.BoardingTriggerMinutes, 3),
+			stop:       stop(now, nil, bus("405", 2.5, intPtr(9)), bus("405", 1.2, intPtr(5)), bus("C01", 0.3, intPtr(1))),
+			want:       []models.BoardingEventKind{models.BoardingEventUpdate},
+			wantStatus: models.BoardingAlertWatching,
+		},
+		{
+			name: "consulta repetida del caché se ignora",
+			alert: func() models.BoardingAlert {
+				a := watching(models.BoardingTriggerMinutes, 3)
+				a.CheckedAt = &checkedAt
+				return a
+			}(),
+			stop:       stop(now, nil, bus("405", 0.1, intPtr(0))),
+			wantStatus: models.BoardingAlertWatching,
+		},
+		{
+			name:       "umbral de minutos",
+			alert:      watching(models.BoardingTriggerMinutes, 3),
+			stop:       stop(now, nil, bus("405", 0.6, intPtr(2))),
+			want:       []models.BoardingEventKind{models.BoardingEventTriggered},
+			wantStatus: models.BoardingAlertTriggered,
+		},
+		{
+			name:       "umbral de distancia",
+			alert:      watching(models.BoardingTriggerDistance, 1),
+			stop:       stop(now, nil, bus("405", 0.8, intPtr(4))),
+			want:       []models.BoardingEventKind{models.BoardingEventTriggered},
+			wantStatus: models.BoardingAlertTriggered,
+		},
+		{
+			name:       "minutos estimados por distancia cuando la fuente no los informa",
+			alert:      watching(models.BoardingTriggerMinutes, 3),
+			stop:       stop(now, nil, bus("405", 1.0, nil)), // 1 km a 18 km/h = 3,3 min → 4
+			want:       []models.BoardingEventKind{models.BoardingEventUpdate},
+			wantStatus: models.BoardingAlertWatching,
+		},
+		{
+			name: "la ruta no distingue mayúsculas",
+			alert: func() models.BoardingAlert {
+				a := watching(models.BoardingTriggerMinutes, 3)
+				a.Route = "c01"
+				return a
+			}(),
+			stop:       stop(now, nil, bus("C01", 0.6, intPtr(2))),
+			want:       []models.BoardingEventKind{models.BoardingEventTriggered},
+			wantStatus: models.BoardingAlertTriggered,
+		},
+		{
+			name:       "llegando por distancia",
+			alert:      watching(models.BoardingTriggerMinutes, 3),
+			stop:       stop(now, nil, bus("405", 0.1, intPtr(1))),
+			want:       []models.BoardingEventKind{models.BoardingEventArrived},
+			wantDone:   true,
+			wantStatus: models.BoardingAlertArrived,
+		},
+		{
+			name:       "llegando por minutos",
+			alert:      watching(models.BoardingTriggerArrived, 0),
+			stop:       stop(now, nil, bus("405", 0.4, intPtr(0))),
+			want:       []models.BoardingEventKind{models.BoardingEventArrived},
+			wantDone:   true,
+			wantStatus: models.BoardingAlertArrived,
+		},
+		{
+			name:       "sin buses de la ruta",
+			alert:      watching(models.BoardingTriggerMinutes, 3),
+			stop:       stop(now, nil, bus("C01", 0.1, intPtr(0))),
+			wantStatus: models.BoardingAlertWatching,
+		},
+		{
+			name: "pasó sin verse llegar: vuelve a esperar",
+			alert: func() models.BoardingAlert {
+				a := watching(models.BoardingTriggerMinutes, 3)
+				a.Status = models.BoardingAlertTriggered
+				a.TriggeredAt = &checkedAt
+				return a
+			}(),
+			stop:       stop(now, []string{"405"}, bus("405", 3, intPtr(12))),
+			want:       []models.BoardingEventKind{models.BoardingEventPassed, models.BoardingEventUpdate},
+			wantStatus: models.BoardingAlertWatching,
+		},
+		{
+			name:       "pasó y no queda otro bus",
+			alert:      watching(models.BoardingTriggerMinutes, 3),
+			stop:       stop(now, []string{"405"}),
+			want:       []models.BoardingEventKind{models.BoardingEventPassed},
+			wantStatus: models.BoardingAlertWatching,
+		},
+		{
+			name:       "pasadas anteriores a la alerta no cuentan",
+			alert:      watching(models.BoardingTriggerMinutes, 3),
+			stop:       stop(created.Add(-time.Minute), []string{"405"}),
+			wantStatus: models.BoardingAlertWatching,
+		},
+		{
+			name: "ya avisado: sólo cambios de minutos",
+			alert: func() models.BoardingAlert {
+				a := watching(models.BoardingTriggerMinutes, 3)
+				a.Status = models.BoardingAlertTriggered
+				a.Bus = &models.BoardingBus{Minutes: 3, DistanceKm: 0.9}
+				return a
+			}(),
+			stop:       stop(now, nil, bus("405", 0.5, intPtr(2))),
+			want:       []models.BoardingEventKind{models.BoardingEventUpdate},
+			wantStatus: models.BoardingAlertTriggered,
+		},
+		{
+			name: "mismos minutos: sin eventos",
+			alert: func() models.BoardingAlert {
+				a := watching(models.BoardingTriggerMinutes, 3)
+				a.Bus = &models.BoardingBus{Minutes: 6, DistanceKm: 1.6}
+				return a
+			}(),
+			stop:       stop(now, nil, bus("405", 1.5, intPtr(6))),
+			wantStatus: models.BoardingAlertWatching,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := tt.alert
+			events, done := evaluateBoardingAlert(&alert, tt.stop, now)
+
+			var kinds []models.BoardingEventKind
+			for _, e := range events {
+				kinds = append(kinds, e.Kind)
+			}
+			if !reflect.DeepEqual(kinds, tt.want) {
+				t.Errorf("eventos %v, want %v", kinds, tt.want)
+			}
+			if done != tt.wantDone {
+				t.Errorf("done %v, want %v", done, tt.wantDone)
+			}
+			if alert.Status != tt.wantStatus {
+				t.Errorf("estado %s, want %s", alert.Status, tt.wantStatus)
+			}
+			if alert.Status == models.BoardingAlertWatching && alert.TriggeredAt != nil {
+				t.Errorf("alerta esperando con triggered_at")
+			}
+		})
+	}
+}
+
+func TestEvaluateBoardingAlertMessages(t *testing.T) {
+	now := time.Date(2026, 3, 10, 8, 5, 0, 0, time.UTC)
+	alert := &models.BoardingAlert{StopCode: "PA433", Route: "405", Trigger: models.BoardingTriggerArrived,
+		Status: models.BoardingAlertWatching, CreatedAt: now.Add(-time.Minute)}
+
+	events, _ := evaluateBoardingAlert(alert, &redcl.StopArrivals{LastUpdated: now, Arrivals: []redcl.BusArrival{
+		{RouteNumber: "405", DistanceKm: 1.0},
+	}}, now)
+	if len(events) != 1 || events[0].Message != "El 405 está a unos 4 minutos, a 1,0 kilómetros" {
+		t.Errorf("minutos estimados: %+v", events)
+	}
+
+	events, _ = evaluateBoardingAlert(alert, &redcl.StopArrivals{LastUpdated: now.Add(time.Minute), Arrivals: []redcl.BusArrival{
+		{RouteNumber: "405", DistanceKm: 0.44, EstimatedMinutes: intPtr(1)},
+	}}, now)
+	if len(events) != 1 || events[0].Message != "El 405 está a 1 minuto, a 440 metros" {
+		t.Errorf("un minuto: %+v", events)
+	}
+
+	events, done := evaluateBoardingAlert(alert, &redcl.StopArrivals{LastUpdated: now.Add(2 * time.Minute), Arrivals: []redcl.BusArrival{
+		{RouteNumber: "405", DistanceKm: 0.05, EstimatedMinutes: intPtr(0), Plate: "abcd12"},
+	}}, now)
+	if !done || len(events) != 1 || events[0].Message != "El 405 está llegando al paradero PA433, patente A B C D 1 2" {
+		t.Errorf("llegada con patente: done=%v %+v", done, events)
+	}
+}
+
+// TestBoardingAlertWithFileSource recorre las consultas sucesivas del fixture
+// testdata/redcl/PA433.json: el 405 se acerca y luego la última se repite
+func TestBoardingAlertWithFileSource(t *testing.T) {
+	source := redcl.NewFileSource("../../testdata/redcl")
+	threshold := 3.0
+	created := time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC)
+	alert := &models.BoardingAlert{ID: 7, StopCode: "PA433", Route: "405", Trigger: models.BoardingTriggerMinutes,
+		Threshold: &threshold, Status: models.BoardingAlertWatching, CreatedAt: created}
+
+	want := [][]models.BoardingEventKind{
+		{models.BoardingEventUpdate},    // 405 a 5 minutos
+		{models.BoardingEventTriggered}, // 405 a 2 minutos
+		nil,                             // El fixture repite la última consulta
+	}
+	for i, wantKinds := range want {
+		fetched, err := source.FetchArrivals(context.Background(), alert.StopCode)
+		if err != nil {
+			t.Fatalf("consulta %d: %v", i, err)
+		}
+		at := created.Add(time.Duration(i+1) * time.Minute)
+		stop := &redcl.StopArrivals{StopCode: alert.StopCode, StopName: fetched.StopName, Arrivals: fetched.Arrivals, LastUpdated: at}
+
+		events, done := evaluateBoardingAlert(alert, stop, at)
+		var kinds []models.BoardingEventKind
+		for _, e := range events {
+			kinds = append(kinds, e.Kind)
+			if e.AlertID != alert.ID || e.StopCode != "PA433" {
+				t.Errorf("consulta %d: evento de otra alerta %+v", i, e)
+			}
+		}
+		if !reflect.DeepEqual(kinds, wantKinds) {
+			t.Errorf("consulta %d: eventos %v, want %v", i, kinds, wantKinds)
+		}
+		if done {
+			t.Fatalf("consulta %d: la alerta terminó sin que llegara el bus", i)
+		}
+	}
+	if alert.Status != models.BoardingAlertTriggered || alert.Bus == nil || alert.Bus.Minutes != 2 {
+		t.Errorf("alerta final %+v", alert)
+	}
+}
@@ -2,23 +2,127 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"log"
+	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/middleware"
+	"github.com/yourorg/wayfindcl/internal/models"
 	"github.com/yourorg/wayfindcl/internal/redcl"
+	"github.com/yourorg/wayfindcl/internal/repository"
 )
 
+const (
+	defaultBusArrivalsCacheTTL      = 20 * time.Second
+	defaultBusArrivalsRefreshPeriod = 15 * time.Second
+	defaultBusArrivalsMaxHotStops   = 200
+
+	// busArrivalsHotLease es cuánto dura una suscripción a un paradero
+	busArrivalsHotLease = 10 * time.Minute
+	// maxStopSubscriptionsPerUser son los paraderos suscritos a la vez por usuario
+	maxStopSubscriptionsPerUser = 5
+)
+
+// stopCodePattern es el formato de un código de paradero (ej: "PA433", "PC615")
+var stopCodePattern = regexp.MustCompile(`^[A-Z0-9-]{2,20}$`)
+
 // BusArrivalsHandler maneja solicitudes de llegadas de buses
 type BusArrivalsHandler struct {
-	scraper *redcl.Scraper
+	db           *sql.DB
+	arrivals     *redcl.ArrivalsCache
+	observations repository.ArrivalObservationRepository
+
+	reliabilityMu sync.Mutex
+	reliability   map[string]*stopReliabilityEntry // stopCode -> confiabilidad en caché
+
+	subscriptionsMu sync.Mutex
+	subscriptions   map[int64]map[string]time.Time // userID -> paradero -> suscrito hasta
+
+	scheduleMu sync.Mutex
+	schedules  map[string]*stopScheduleEntry // stopCode -> horario GTFS en caché
+}
+
+// NewBusArrivalsHandler crea una nueva instancia del handler. Las consultas
+// pasan por un caché compartido (BUS_ARRIVALS_CACHE_TTL) y los paraderos
+// suscritos se refrescan cada BUS_ARRIVALS_REFRESH_INTERVAL. Cada resultado
+// nuevo se guarda en la serie de tiempo de observaciones. Si Red.cl falla
+// se responde con el horario programado del GTFS.
+func NewBusArrivalsHandler(db *sql.DB, observations repository.ArrivalObservationRepository) *BusArrivalsHandler {
+	h := &BusArrivalsHandler{
+		db: db,
+		arrivals: redcl.NewArrivalsCache(
+			redcl.NewScraper(db, redcl.SourceFromEnv()),
+			busArrivalsDuration("BUS_ARRIVALS_CACHE_TTL", defaultBusArrivalsCacheTTL),
+			busArrivalsDuration("BUS_ARRIVALS_REFRESH_INTERVAL", defaultBusArrivalsRefreshPeriod),
+			busArrivalsMaxHotStops(),
+		),
+		observations:  observations,
+		reliability:   make(map[string]*stopReliabilityEntry),
+		subscriptions: make(map[int64]map[string]time.Time),
+		schedules:     make(map[string]*stopScheduleEntry),
+	}
+	h.arrivals.OnFetch(newArrivalRecorder(observations).record)
+	go h.arrivals.StartRefresher()
+	return h
+}
+
+// busArrivalsResponse son las llegadas de un paradero con la confiabilidad
+// de cada ruta para la hora actual
+type busArrivalsResponse struct {
+	*redcl.StopArrivals
+	Reliability map[string]models.ArrivalReliability `json:"reliability,omitempty"`
+}
+
+// busArrivalsDuration lee una duración (ej: "30s") del entorno; "0" la desactiva
+func busArrivalsDuration(name string, fallback time.Duration) time.Duration {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return fallback
+	}
+	if raw == "0" {
+		return 0
+	}
+	dur, err := time.ParseDuration(raw)
+	if err != nil || dur < 0 {
+		log.Printf("⚠️  %s inválido (%q), usando %s", name, raw, fallback)
+		return fallback
+	}
+	return dur
 }
 
-// NewBusArrivalsHandler crea una nueva instancia del handler
-func NewBusArrivalsHandler(db *sql.DB) *BusArrivalsHandler {
-	return &BusArrivalsHandler{
-		scraper: redcl.NewScraper(db),
+// busArrivalsMaxHotStops lee BUS_ARRIVALS_MAX_HOT_STOPS; "0" sin límite
+func busArrivalsMaxHotStops() int {
+	raw := strings.TrimSpace(os.Getenv("BUS_ARRIVALS_MAX_HOT_STOPS"))
+	if raw == "" {
+		return defaultBusArrivalsMaxHotStops
 	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("⚠️  BUS_ARRIVALS_MAX_HOT_STOPS inválido (%q), usando %d", raw, defaultBusArrivalsMaxHotStops)
+		return defaultBusArrivalsMaxHotStops
+	}
+	return n
+}
+
+// ClearCache vacía el caché de llegadas y el de buses vistos del scraper de Red.cl
+func (h *BusArrivalsHandler) ClearCache() {
+	h.arrivals.Clear()
+}
+
+// Arrivals retorna el caché de llegadas, para otros consumidores (alertas de abordaje)
+func (h *BusArrivalsHandler) Arrivals() *redcl.ArrivalsCache {
+	return h.arrivals
+}
+
+// CacheStats retorna las métricas del caché de llegadas (ver /api/stats/scraper)
+func (h *BusArrivalsHandler) CacheStats() redcl.CacheStats {
+	return h.arrivals.Stats()
 }
 
 // GetBusArrivals maneja GET /api/bus-arrivals/:stopCode
@@ -37,7 +141,24 @@ func (h *BusArrivalsHandler) GetBusArrivals(c *fiber.Ctx) error {
 
 	log.Printf("🚌 Obteniendo llegadas para paradero: %s", stopCode)
 
-	arrivals, err := h.scraper.GetBusArrivals(stopCode)
+	arrivals, cached, err := h.arrivals.Get(c.UserContext(), stopCode)
+	if err != nil || len(arrivals.Arrivals) == 0 {
+		// Sin datos en tiempo real: usar el horario programado del GTFS
+		scheduled, schedErr := h.scheduledArrivals(c.UserContext(), stopCode)
+		if schedErr != nil {
+			log.Printf("⚠️  [GTFS] Error calculando horario de %s: %v", stopCode, schedErr)
+		}
+		if scheduled != nil {
+			if err != nil {
+				log.Printf("⚠️  Red.cl falló para %s (%v), usando horario programado", stopCode, err)
+			}
+			c.Set("X-Cache", "MISS")
+			return c.JSON(busArrivalsResponse{
+				StopArrivals: scheduled,
+				Reliability:  h.currentReliability(scheduled.StopCode),
+			})
+		}
+	}
 	if err != nil {
 		log.Printf("❌ Error obteniendo llegadas: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -55,7 +176,98 @@ func (h *BusArrivalsHandler) GetBusArrivals(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(arrivals)
+	if cached {
+		c.Set("X-Cache", "HIT")
+	} else {
+		c.Set("X-Cache", "MISS")
+	}
+	return c.JSON(busArrivalsResponse{
+		StopArrivals: arrivals,
+		Reliability:  h.currentReliability(arrivals.StopCode),
+	})
+}
+
+// SubscribeStop maneja POST /api/bus-arrivals/:stopCode/subscribe
+// Marca el paradero como caliente por busArrivalsHotLease: sus llegadas se
+// refrescan en segundo plano. Se renueva llamando de nuevo. Requiere login y
+// un paradero del GTFS; cada usuario suscribe hasta maxStopSubscriptionsPerUser.
+func (h *BusArrivalsHandler) SubscribeStop(c *fiber.Ctx) error {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Authentication required",
+		})
+	}
+
+	stopCode := strings.ToUpper(strings.TrimSpace(c.Params("stopCode")))
+	if !stopCodePattern.MatchString(stopCode) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "stop code is invalid",
+		})
+	}
+	if h.db != nil {
+		var exists int
+		err := h.db.QueryRowContext(c.UserContext(), "SELECT 1 FROM gtfs_stops WHERE code = ? LIMIT 1", stopCode).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Stop not found",
+			})
+		}
+		if err != nil {
+			log.Printf("❌ Error validando paradero %s: %v", stopCode, err)
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "Failed to validate stop code",
+			})
+		}
+	}
+
+	now := time.Now()
+	h.subscriptionsMu.Lock()
+	stops := h.subscriptions[userID]
+	for code, until := range stops {
+		if !now.Before(until) {
+			delete(stops, code)
+		}
+	}
+	if _, renewing := stops[stopCode]; !renewing && len(stops) >= maxStopSubscriptionsPerUser {
+		h.subscriptionsMu.Unlock()
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": "Too many subscribed stops for this user",
+			"limit": maxStopSubscriptionsPerUser,
+		})
+	}
+	h.subscriptionsMu.Unlock()
+
+	until, err := h.arrivals.Subscribe(stopCode, busArrivalsHotLease)
+	if errors.Is(err, redcl.ErrTooManyHotStops) {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Too many subscribed stops, try again later",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to subscribe stop",
+		})
+	}
+
+	h.subscriptionsMu.Lock()
+	if h.subscriptions[userID] == nil {
+		h.subscriptions[userID] = make(map[string]time.Time)
+	}
+	h.subscriptions[userID][stopCode] = until
+	// Sin suscripciones vigentes el usuario no necesita entrada
+	for id, stops := range h.subscriptions {
+		if len(stops) == 0 {
+			delete(h.subscriptions, id)
+		}
+	}
+	h.subscriptionsMu.Unlock()
+
+	return c.JSON(fiber.Map{
+		"stop_code":  stopCode,
+		"hot_until":  until,
+		"lease_secs": int(busArrivalsHotLease.Seconds()),
+	})
 }
 
 // GetBusArrivalsByLocation maneja POST /api/bus-arrivals/nearby
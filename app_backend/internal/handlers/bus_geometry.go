@@ -8,12 +8,14 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/repository"
 )
 
 // BusGeometryRequest representa la solicitud de geometría
@@ -72,6 +74,7 @@ func GetBusRouteSegment(c *fiber.Ctx) error {
 	// ESTRATEGIA 1: Intentar obtener geometría desde GTFS shapes
 	if req.FromStopCode != "" && req.ToStopCode != "" {
 		geometry, source, err := getGeometryFromGTFSShapes(
+			c.UserContext(),
 			req.RouteNumber,
 			req.FromStopCode,
 			req.ToStopCode,
@@ -85,11 +88,11 @@ func GetBusRouteSegment(c *fiber.Ctx) error {
 			duration := int(distance / 10.0) // ~10 m/s para buses (36 km/h promedio)
 			
 			// Obtener info de paradas
-			fromStop, _ := getStopInfo(req.FromStopCode)
-			toStop, _ := getStopInfo(req.ToStopCode)
+			fromStop, _ := getStopInfo(c.UserContext(), req.FromStopCode)
+			toStop, _ := getStopInfo(c.UserContext(), req.ToStopCode)
 			
 			// Contar paradas intermedias
-			numStops := countStopsBetween(req.RouteNumber, req.FromStopCode, req.ToStopCode)
+			numStops := countStopsBetween(c.UserContext(), req.RouteNumber, req.FromStopCode, req.ToStopCode)
 			
 			return c.JSON(BusGeometryResponse{
 				Geometry:        geometry,
@@ -145,8 +148,8 @@ func GetBusRouteSegment(c *fiber.Ctx) error {
 	// ESTRATEGIA 3: Fallback - línea recta
 	log.Printf("⚠️ [BUS-GEOMETRY] Usando fallback (línea recta)")
 	
-	fromStop, _ := getStopInfo(req.FromStopCode)
-	toStop, _ := getStopInfo(req.ToStopCode)
+	fromStop, _ := getStopInfo(c.UserContext(), req.FromStopCode)
+	toStop, _ := getStopInfo(c.UserContext(), req.ToStopCode)
 	
 	geometry := [][]float64{
 		{fromStop.Lon, fromStop.Lat},
@@ -170,75 +173,32 @@ func GetBusRouteSegment(c *fiber.Ctx) error {
 // ============================================================================
 
 // getGeometryFromGTFSShapes obtiene geometría desde shapes GTFS
-func getGeometryFromGTFSShapes(routeNumber, fromStopCode, toStopCode string) ([][]float64, string, error) {
-	setupMu.RLock()
-	database := dbConn
-	setupMu.RUnlock()
-	
-	if database == nil {
+func getGeometryFromGTFSShapes(ctx context.Context, routeNumber, fromStopCode, toStopCode string) ([][]float64, string, error) {
+	store := getRepos()
+	if store == nil {
 		return nil, "", fmt.Errorf("base de datos no inicializada")
 	}
 	
-	// 1. Buscar shape_id de la ruta
-	var shapeID string
-	query := `
-		SELECT DISTINCT s.shape_id
-		FROM gtfs_trips t
-		JOIN gtfs_routes r ON t.route_id = r.route_id
-		JOIN gtfs_shapes s ON t.shape_id = s.shape_id
-		WHERE r.route_short_name = $1
-		LIMIT 1
-	`
-	
-	err := database.QueryRow(query, routeNumber).Scan(&shapeID)
+	// 1. Obtener el shape de la ruta, con todos sus puntos ordenados
+	shapeID, allPoints, err := store.Routes.Shape(ctx, routeNumber)
 	if err != nil {
 		return nil, "", fmt.Errorf("no se encontró shape para ruta %s: %w", routeNumber, err)
 	}
 	
-	log.Printf("📍 [GTFS] Shape encontrado: %s para ruta %s", shapeID, routeNumber)
+	log.Printf("📍 [GTFS] Shape encontrado: %s para ruta %s (%d puntos)", shapeID, routeNumber, len(allPoints))
 	
 	// 2. Obtener coordenadas de paradas
-	fromStop, err := getStopInfo(fromStopCode)
+	fromStop, err := getStopInfo(ctx, fromStopCode)
 	if err != nil {
 		return nil, "", fmt.Errorf("parada origen no encontrada: %w", err)
 	}
 	
-	toStop, err := getStopInfo(toStopCode)
+	toStop, err := getStopInfo(ctx, toStopCode)
 	if err != nil {
 		return nil, "", fmt.Errorf("parada destino no encontrada: %w", err)
 	}
 	
-	// 3. Obtener todos los puntos del shape ordenados
-	shapeQuery := `
-		SELECT shape_pt_lat, shape_pt_lon, shape_pt_sequence
-		FROM gtfs_shapes
-		WHERE shape_id = $1
-		ORDER BY shape_pt_sequence
-	`
-	
-	rows, err := database.Query(shapeQuery, shapeID)
-	if err != nil {
-		return nil, "", fmt.Errorf("error obteniendo shape points: %w", err)
-	}
-	defer rows.Close()
-	
-	var allPoints [][]float64
-	for rows.Next() {
-		var lat, lon float64
-		var seq int
-		if err := rows.Scan(&lat, &lon, &seq); err != nil {
-			continue
-		}
-		allPoints = append(allPoints, []float64{lon, lat})
-	}
-	
-	if len(allPoints) == 0 {
-		return nil, "", fmt.Errorf("no se encontraron puntos en el shape")
-	}
-	
-	log.Printf("📍 [GTFS] Shape completo: %d puntos", len(allPoints))
-	
-	// 4. Encontrar índices más cercanos a las paradas en el shape
+	// 3. Encontrar índices más cercanos a las paradas en el shape
 	startIdx := findClosestPointIndex(allPoints, fromStop.Lat, fromStop.Lon)
 	endIdx := findClosestPointIndex(allPoints, toStop.Lat, toStop.Lon)
 	
@@ -248,7 +208,7 @@ func getGeometryFromGTFSShapes(routeNumber, fromStopCode, toStopCode string) ([]
 		return allPoints, "gtfs_shape_full", nil
 	}
 	
-	// 5. Extraer segmento
+	// 4. Extraer segmento
 	segment := allPoints[startIdx : endIdx+1]
 	
 	log.Printf("✅ [GTFS] Segmento extraído: %d puntos (índices %d a %d)", len(segment), startIdx, endIdx)
@@ -257,29 +217,22 @@ func getGeometryFromGTFSShapes(routeNumber, fromStopCode, toStopCode string) ([]
 }
 
 // getStopInfo obtiene información de una parada por código
-func getStopInfo(stopCode string) (StopInfo, error) {
-	setupMu.RLock()
-	database := dbConn
-	setupMu.RUnlock()
-	
-	if database == nil {
+func getStopInfo(ctx context.Context, stopCode string) (StopInfo, error) {
+	store := getRepos()
+	if store == nil {
 		return StopInfo{}, fmt.Errorf("base de datos no inicializada")
 	}
 	
-	var info StopInfo
-	query := `
-		SELECT stop_code, stop_name, stop_lat, stop_lon
-		FROM gtfs_stops
-		WHERE stop_code = $1
-		LIMIT 1
-	`
-	
-	err := database.QueryRow(query, stopCode).Scan(&info.Code, &info.Name, &info.Lat, &info.Lon)
+	stop, err := store.Stops.ByCode(ctx, stopCode)
 	if err != nil {
-		return info, err
+		return StopInfo{}, err
 	}
 	
-	return info, nil
+	code := stop.Code
+	if code == "" {
+		code = stop.StopID
+	}
+	return StopInfo{Code: code, Name: stop.Name, Lat: stop.Latitude, Lon: stop.Longitude}, nil
 }
 
 // findClosestPointIndex encuentra el índice del punto más cercano
@@ -341,34 +294,14 @@ func toRadians(degrees float64) float64 {
 }
 
 // countStopsBetween cuenta paradas entre dos códigos en una ruta
-func countStopsBetween(routeNumber, fromStopCode, toStopCode string) int {
-	setupMu.RLock()
-	database := dbConn
-	setupMu.RUnlock()
-	
-	if database == nil {
+func countStopsBetween(ctx context.Context, routeNumber, fromStopCode, toStopCode string) int {
+	store := getRepos()
+	if store == nil {
 		return 0
 	}
 	
-	query := `
-		WITH route_stops AS (
-			SELECT st.stop_id, st.stop_sequence, s.stop_code
-			FROM gtfs_stop_times st
-			JOIN gtfs_trips t ON st.trip_id = t.trip_id
-			JOIN gtfs_routes r ON t.route_id = r.route_id
-			JOIN gtfs_stops s ON st.stop_id = s.stop_id
-			WHERE r.route_short_name = $1
-			ORDER BY st.stop_sequence
-		)
-		SELECT COUNT(DISTINCT stop_id)
-		FROM route_stops
-		WHERE stop_sequence >= (SELECT stop_sequence FROM route_stops WHERE stop_code = $2 LIMIT 1)
-		  AND stop_sequence <= (SELECT stop_sequence FROM route_stops WHERE stop_code = $3 LIMIT 1)
-	`
-	
-	var count int
-	err := database.QueryRow(query, routeNumber, fromStopCode, toStopCode).Scan(&count)
-	if err != nil && err != sql.ErrNoRows {
+	count, err := store.Routes.CountStopsBetween(ctx, routeNumber, fromStopCode, toStopCode)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
 		log.Printf("⚠️ Error contando paradas: %v", err)
 		return 0
 	}
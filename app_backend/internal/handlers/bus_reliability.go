@@ -0,0 +1,581 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/redcl"
+	"github.com/yourorg/wayfindcl/internal/repository"
+	"github.com/yourorg/wayfindcl/internal/transit"
+	"github.com/yourorg/wayfindcl/internal/validation"
+)
+
+const (
+	defaultArrivalObservationsRetention = 30 * 24 * time.Hour
+	arrivalObservationsPruneInterval    = time.Hour
+
+	// arrivalObservationInterval es cada cuánto se guarda, como máximo, una
+	// consulta de un paradero (los buses que pasaron se guardan siempre)
+	arrivalObservationInterval = 30 * time.Second
+	// maxObservationGap corta la serie: sin observaciones de la ruta por más
+	// tiempo no se sabe qué pasó entremedio (nadie consultaba el paradero)
+	maxObservationGap = 5 * time.Minute
+	// maxHeadway descarta intervalos que sólo pueden ser huecos de servicio
+	maxHeadway = 90 * time.Minute
+	// minHeadway descarta la misma pasada detectada dos veces
+	minHeadway = 30 * time.Second
+	// predictionOnTimeMinutes es el error que todavía cuenta como acierto
+	predictionOnTimeMinutes = 2.0
+	// reliabilityMinSamples son las muestras que necesita cada componente del score
+	reliabilityMinSamples = 3
+
+	defaultReliabilityDays  = 7
+	maxReliabilityDays      = 30
+	maxStatsReliabilityDays = 3
+	// maxReliabilityObservations acota las filas que lee un cálculo
+	maxReliabilityObservations = 200000
+	// stopReliabilityTTL es cuánto se reutiliza la confiabilidad que acompaña
+	// a las llegadas de un paradero
+	stopReliabilityTTL = 10 * time.Minute
+)
+
+// arrivalObservationsRetention lee ARRIVAL_OBSERVATIONS_RETENTION (ej: "168h"); "0" conserva todo
+func arrivalObservationsRetention() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("ARRIVAL_OBSERVATIONS_RETENTION"))
+	if raw == "" {
+		return defaultArrivalObservationsRetention
+	}
+	if raw == "0" {
+		return 0
+	}
+	dur, err := time.ParseDuration(raw)
+	if err != nil || dur < 0 {
+		log.Printf("⚠️  ARRIVAL_OBSERVATIONS_RETENTION inválido (%q), usando %s", raw, defaultArrivalObservationsRetention)
+		return defaultArrivalObservationsRetention
+	}
+	return dur
+}
+
+// startArrivalObservationPruner aplica la retención al iniciar y luego cada hora
+func startArrivalObservationPruner(arrivals repository.ArrivalObservationRepository, retention time.Duration) {
+	prune := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		deleted, err := arrivals.Prune(ctx, time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("⚠️  [RED.CL] Error aplicando retención de observaciones de llegadas: %v", err)
+			return
+		}
+		if deleted > 0 {
+			log.Printf("🧹 [RED.CL] %d observaciones de llegadas eliminadas por retención", deleted)
+		}
+	}
+	prune()
+
+	ticker := time.NewTicker(arrivalObservationsPruneInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		prune()
+	}
+}
+
+// arrivalRecorder guarda en la serie de tiempo cada resultado nuevo del
+// scraper (ver ArrivalsCache.OnFetch)
+type arrivalRecorder struct {
+	arrivals repository.ArrivalObservationRepository
+
+	mu   sync.Mutex
+	last map[string]time.Time // stopCode -> última consulta guardada
+}
+
+func newArrivalRecorder(arrivals repository.ArrivalObservationRepository) *arrivalRecorder {
+	return &arrivalRecorder{arrivals: arrivals, last: make(map[string]time.Time)}
+}
+
+func (r *arrivalRecorder) record(stop *redcl.StopArrivals) {
+	observedAt := stop.LastUpdated.UTC().Truncate(time.Second)
+
+	r.mu.Lock()
+	withArrivals := observedAt.Sub(r.last[stop.StopCode]) >= arrivalObservationInterval
+	if withArrivals {
+		r.last[stop.StopCode] = observedAt
+	}
+	r.mu.Unlock()
+
+	observations := []models.ArrivalObservation{}
+	if withArrivals {
+		for _, arrival := range stop.Arrivals {
+			meters := int(math.Round(arrival.DistanceKm * 1000))
+			observation := models.ArrivalObservation{
+				StopCode:         stop.StopCode,
+				Route:            validation.Truncate(arrival.RouteNumber, 20),
+				ObservedAt:       observedAt,
+				DistanceMeters:   &meters,
+				PredictedMinutes: arrival.EstimatedMinutes,
+			}
+			if arrival.Plate != "" {
+				plate := validation.Truncate(arrival.Plate, 12)
+				observation.Plate = &plate
+			}
+			observations = append(observations, observation)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, route := range stop.BussesPassed {
+		if seen[route] {
+			continue
+		}
+		seen[route] = true
+		observations = append(observations, models.ArrivalObservation{
+			StopCode:   stop.StopCode,
+			Route:      validation.Truncate(route, 20),
+			ObservedAt: observedAt,
+			Passed:     true,
+		})
+	}
+	if len(observations) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := r.arrivals.Record(ctx, observations); err != nil {
+		log.Printf("⚠️  [RED.CL] Error guardando observaciones de %s: %v", stop.StopCode, err)
+	}
+}
+
+// headwayKey identifica una hora local de un día: el horario programado se
+// compara con lo observado en el mismo día y hora
+type headwayKey struct {
+	date  string
+	route string
+	hour  int
+}
+
+// reliabilityAccumulator junta las muestras de una ruta (y hora)
+type reliabilityAccumulator struct {
+	headways  []float64
+	scheduled []float64 // Headway programado de la misma hora de cada muestra (si lo hay)
+	errors    []float64
+}
+
+// computeArrivalReliability calcula las métricas por ruta y hora a partir de
+// las observaciones (ordenadas por paradero, ruta y hora, como las retorna
+// ArrivalObservationRepository.List). scheduled es el headway programado en
+// minutos por día, ruta y hora (nil = sin horario).
+//
+//   - Headway observado: minutos entre pasadas consecutivas de la ruta, sólo
+//     si la ruta se siguió observando entremedio (huecos ≤ maxObservationGap).
+//   - Error de predicción: por cada consulta, el bus más cercano de la ruta se
+//     compara con la siguiente pasada; real - predicho (los minutos de Red.cl
+//     son la cota inferior del rango, así que un sesgo positivo es esperable).
+func computeArrivalReliability(observations []models.ArrivalObservation, scheduled map[headwayKey]float64, loc *time.Location, byHour bool) []models.RouteReliability {
+	results := []models.RouteReliability{}
+	for start := 0; start < len(observations); {
+		end := start + 1
+		for end < len(observations) && observations[end].StopCode == observations[start].StopCode &&
+			observations[end].Route == observations[start].Route {
+			end++
+		}
+		results = append(results, routeReliability(observations[start:end], scheduled, loc, byHour))
+		start = end
+	}
+	return results
+}
+
+func routeReliability(observations []models.ArrivalObservation, scheduled map[headwayKey]float64, loc *time.Location, byHour bool) models.RouteReliability {
+	stopCode, route := observations[0].StopCode, observations[0].Route
+
+	// Tramos de observación continua y pasadas de la ruta
+	type pass struct {
+		at      time.Time
+		segment int
+	}
+	segments := make([]int, len(observations))
+	var passes []pass
+	segment := 0
+	for i, o := range observations {
+		if i > 0 && o.ObservedAt.Sub(observations[i-1].ObservedAt) > maxObservationGap {
+			segment++
+		}
+		segments[i] = segment
+		if o.Passed {
+			passes = append(passes, pass{at: o.ObservedAt, segment: segment})
+		}
+	}
+
+	var total reliabilityAccumulator
+	var hours [24]reliabilityAccumulator
+
+	for i := 1; i < len(passes); i++ {
+		prev, cur := passes[i-1], passes[i]
+		gap := cur.at.Sub(prev.at)
+		if prev.segment != cur.segment || gap < minHeadway || gap > maxHeadway {
+			continue
+		}
+		local := cur.at.In(loc)
+		minutes := gap.Minutes()
+		total.headways = append(total.headways, minutes)
+		hours[local.Hour()].headways = append(hours[local.Hour()].headways, minutes)
+		if planned, ok := scheduled[headwayKey{local.Format("2006-01-02"), route, local.Hour()}]; ok {
+			total.scheduled = append(total.scheduled, planned)
+			hours[local.Hour()].scheduled = append(hours[local.Hour()].scheduled, planned)
+		}
+	}
+
+	for i := 0; i < len(observations); {
+		// Una consulta = las filas con el mismo observed_at; el bus más cercano
+		j, nearest := i, -1
+		for ; j < len(observations) && observations[j].ObservedAt.Equal(observations[i].ObservedAt); j++ {
+			o := observations[j]
+			if o.Passed || o.DistanceMeters == nil {
+				continue
+			}
+			if nearest < 0 || *o.DistanceMeters < *observations[nearest].DistanceMeters {
+				nearest = j
+			}
+		}
+		if nearest >= 0 && observations[nearest].PredictedMinutes != nil {
+			o := observations[nearest]
+			next := sort.Search(len(passes), func(k int) bool { return passes[k].at.After(o.ObservedAt) })
+			if next < len(passes) && passes[next].segment == segments[nearest] {
+				if waited := passes[next].at.Sub(o.ObservedAt); waited <= maxHeadway {
+					diff := waited.Minutes() - float64(*o.PredictedMinutes)
+					hour := o.ObservedAt.In(loc).Hour()
+					total.errors = append(total.errors, diff)
+					hours[hour].errors = append(hours[hour].errors, diff)
+				}
+			}
+		}
+		i = j
+	}
+
+	result := models.RouteReliability{ArrivalReliability: total.summarize(stopCode, route, nil)}
+	if byHour {
+		for hour := range hours {
+			if len(hours[hour].headways) == 0 && len(hours[hour].errors) == 0 {
+				continue
+			}
+			h := hour
+			result.Hours = append(result.Hours, hours[hour].summarize(stopCode, route, &h))
+		}
+	}
+	return result
+}
+
+func (a *reliabilityAccumulator) summarize(stopCode, route string, hour *int) models.ArrivalReliability {
+	r := models.ArrivalReliability{
+		StopCode:          stopCode,
+		Route:             route,
+		Hour:              hour,
+		HeadwaySamples:    len(a.headways),
+		PredictionSamples: len(a.errors),
+	}
+
+	var weighted, weights float64
+	if len(a.headways) > 0 {
+		mean, stddev := meanStddev(a.headways)
+		r.ActualHeadwayMin = rounded(mean)
+		if len(a.headways) >= reliabilityMinSamples && mean > 0 {
+			cv := stddev / mean
+			r.HeadwayCV = rounded(cv)
+			// Regularidad: buses igualmente espaciados
+			weighted += 0.35 * math.Max(0, 1-cv)
+			weights += 0.35
+		}
+		if len(a.scheduled) > 0 {
+			planned, _ := meanStddev(a.scheduled)
+			r.ScheduledHeadwayMin = rounded(planned)
+			if len(a.scheduled) >= reliabilityMinSamples && mean > 0 {
+				// Cumplimiento: pasan tan seguido como promete el horario
+				weighted += 0.35 * math.Min(1, planned/mean)
+				weights += 0.35
+			}
+		}
+	}
+	if len(a.errors) > 0 {
+		bias, _ := meanStddev(a.errors)
+		var absSum float64
+		onTime := 0
+		for _, e := range a.errors {
+			absSum += math.Abs(e)
+			if math.Abs(e) <= predictionOnTimeMinutes {
+				onTime++
+			}
+		}
+		share := float64(onTime) / float64(len(a.errors))
+		r.PredictionBiasMin = rounded(bias)
+		r.PredictionMAEMin = rounded(absSum / float64(len(a.errors)))
+		r.PredictionOnTime = rounded(share)
+		if len(a.errors) >= reliabilityMinSamples {
+			// Precisión de las predicciones de Red.cl
+			weighted += 0.3 * share
+			weights += 0.3
+		}
+	}
+	if weights > 0 {
+		r.Score = rounded(100 * weighted / weights)
+	}
+	return r
+}
+
+func meanStddev(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)))
+}
+
+// rounded redondea a un decimal
+func rounded(value float64) *float64 {
+	value = math.Round(value*10) / 10
+	return &value
+}
+
+// scheduledHeadways calcula el headway programado (minutos) por día, ruta y
+// hora del paradero entre since y now, según los servicios activos de cada
+// día. Los viajes después de medianoche (horas > 24:00) cuentan en el día y
+// la hora en que realmente pasan.
+func scheduledHeadways(ctx context.Context, db *sql.DB, stopCode string, since, now time.Time, loc *time.Location) (map[headwayKey]float64, error) {
+	schedule, err := transit.LoadStopSchedule(ctx, db, stopCode)
+	if err != nil {
+		return nil, err
+	}
+
+	type gapSum struct {
+		total float64
+		count int
+	}
+	sums := make(map[headwayKey]*gapSum)
+
+	// Desde el día anterior a since: sus viajes nocturnos pasan dentro del
+	// rango. Las fechas van al mediodía para no depender del cambio de hora.
+	first := since.In(loc).AddDate(0, 0, -1)
+	date := time.Date(first.Year(), first.Month(), first.Day(), 12, 0, 0, 0, loc)
+	for ; !transit.ServiceDayStart(date).After(now); date = date.AddDate(0, 0, 1) {
+		services, err := transit.ActiveServices(ctx, db, date)
+		if err != nil {
+			return nil, err
+		}
+		dayStart := transit.ServiceDayStart(date)
+		last := make(map[string]int) // ruta -> hora de la pasada anterior
+		for _, d := range schedule.On(services) {
+			route := strings.ToUpper(d.RouteShortName)
+			prev, ok := last[route]
+			last[route] = d.Secs
+			if !ok || d.Secs <= prev || time.Duration(d.Secs-prev)*time.Second > maxHeadway {
+				continue
+			}
+			// Horas GTFS desde el inicio del día de servicio: respeta los cambios de horario
+			at := dayStart.Add(time.Duration(d.Secs) * time.Second).In(loc)
+			key := headwayKey{at.Format("2006-01-02"), route, at.Hour()}
+			if sums[key] == nil {
+				sums[key] = &gapSum{}
+			}
+			sums[key].total += float64(d.Secs-prev) / 60
+			sums[key].count++
+		}
+	}
+
+	headways := make(map[headwayKey]float64, len(sums))
+	for key, sum := range sums {
+		headways[key] = sum.total / float64(sum.count)
+	}
+	return headways, nil
+}
+
+// stopReliability calcula las métricas por ruta y hora de un paradero en los
+// últimos days días
+func (h *BusArrivalsHandler) stopReliability(ctx context.Context, stopCode, route string, days int) ([]models.RouteReliability, error) {
+	now := time.Now()
+	since := now.AddDate(0, 0, -days)
+	observations, err := h.observations.List(ctx, repository.ArrivalObservationFilter{
+		StopCode: stopCode,
+		Route:    route,
+		Since:    since,
+		Limit:    maxReliabilityObservations,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(observations) == 0 {
+		return []models.RouteReliability{}, nil
+	}
+
+	var scheduled map[headwayKey]float64
+	if h.db != nil {
+		scheduled, err = scheduledHeadways(ctx, h.db, stopCode, since, now, transit.Location())
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			// Sin horario el score usa sólo regularidad y predicciones
+			log.Printf("⚠️  [RED.CL] Error leyendo horario GTFS de %s: %v", stopCode, err)
+		}
+	}
+	return computeArrivalReliability(observations, scheduled, transit.Location(), true), nil
+}
+
+// stopReliabilityEntry es la confiabilidad en caché de un paradero
+type stopReliabilityEntry struct {
+	routes    map[string]models.RouteReliability
+	updatedAt time.Time
+	loading   bool
+}
+
+// currentReliability retorna, por ruta, la confiabilidad de la hora actual
+// (o la del día si esa hora no tiene score) desde el caché. Si está vencida
+// la recalcula en segundo plano: las llegadas no esperan el cálculo.
+func (h *BusArrivalsHandler) currentReliability(stopCode string) map[string]models.ArrivalReliability {
+	h.reliabilityMu.Lock()
+	entry := h.reliability[stopCode]
+	if entry == nil {
+		entry = &stopReliabilityEntry{}
+		h.reliability[stopCode] = entry
+	}
+	if !entry.loading && time.Since(entry.updatedAt) > stopReliabilityTTL {
+		entry.loading = true
+		go h.refreshReliability(stopCode, entry)
+	}
+	routes := entry.routes
+	h.reliabilityMu.Unlock()
+
+	if len(routes) == 0 {
+		return nil
+	}
+	hour := time.Now().In(transit.Location()).Hour()
+	current := make(map[string]models.ArrivalReliability, len(routes))
+	for route, reliability := range routes {
+		if reliability.HeadwaySamples == 0 && reliability.PredictionSamples == 0 {
+			continue
+		}
+		current[route] = reliability.ArrivalReliability
+		for _, byHour := range reliability.Hours {
+			if *byHour.Hour == hour && byHour.Score != nil {
+				current[route] = byHour
+			}
+		}
+	}
+	return current
+}
+
+func (h *BusArrivalsHandler) refreshReliability(stopCode string, entry *stopReliabilityEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	results, err := h.stopReliability(ctx, stopCode, "", defaultReliabilityDays)
+	if err != nil {
+		log.Printf("⚠️  [RED.CL] Error calculando confiabilidad de %s: %v", stopCode, err)
+	}
+
+	routes := make(map[string]models.RouteReliability, len(results))
+	for _, r := range results {
+		routes[r.Route] = r
+	}
+
+	h.reliabilityMu.Lock()
+	if err == nil {
+		entry.routes = routes
+	}
+	// También tras un error: reintentar recién cuando vuelva a vencer
+	entry.updatedAt = time.Now()
+	entry.loading = false
+	h.reliabilityMu.Unlock()
+}
+
+// GetStopReliability maneja GET /api/bus-arrivals/:stopCode/reliability
+// Headway observado vs. programado, error de predicción y score de
+// confiabilidad por ruta y hora del día (query: route, days; default 7)
+func (h *BusArrivalsHandler) GetStopReliability(c *fiber.Ctx) error {
+	stopCode := strings.ToUpper(strings.TrimSpace(c.Params("stopCode")))
+	if stopCode == "" || len(stopCode) > 20 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "stop code is required",
+		})
+	}
+	route := strings.ToUpper(strings.TrimSpace(c.Query("route")))
+
+	days := c.QueryInt("days", defaultReliabilityDays)
+	if days < 1 || days > maxReliabilityDays {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "days must be between 1 and 30",
+		})
+	}
+
+	routes, err := h.stopReliability(c.UserContext(), stopCode, route, days)
+	if err != nil {
+		log.Printf("❌ Error calculando confiabilidad de %s: %v", stopCode, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to compute reliability",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"stop_code": stopCode,
+		"days":      days,
+		"timezone":  transit.Location().String(),
+		"routes":    routes,
+	})
+}
+
+// GetReliabilityStats maneja GET /api/stats/reliability
+// Confiabilidad de todas las rutas y paraderos observados en los últimos days
+// días (default 1, máx. 3), las menos confiables primero. No incluye el
+// horario programado: el score usa regularidad y predicciones.
+func (h *BusArrivalsHandler) GetReliabilityStats(c *fiber.Ctx) error {
+	days := c.QueryInt("days", 1)
+	if days < 1 || days > maxStatsReliabilityDays {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "days must be between 1 and 3",
+		})
+	}
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	observations, err := h.observations.List(c.UserContext(), repository.ArrivalObservationFilter{
+		Since: time.Now().AddDate(0, 0, -days),
+		Limit: maxReliabilityObservations,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch observations",
+		})
+	}
+
+	results := computeArrivalReliability(observations, nil, transit.Location(), false)
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i].Score, results[j].Score
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return *a < *b
+	})
+	total := len(results)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return c.JSON(fiber.Map{
+		"days":         days,
+		"observations": len(observations),
+		"truncated":    len(observations) == maxReliabilityObservations,
+		"total":        total,
+		"routes":       results,
+	})
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/yourorg/wayfindcl/internal/models"
+)
+
+// observationSeries arma las consultas de una ruta: una fila sin bus por cada
+// minuto observado y una fila passed por cada pasada (desde start)
+func observationSeries(stop, route string, start time.Time, observed [][2]int, passes ...time.Duration) []models.ArrivalObservation {
+	var rows []models.ArrivalObservation
+	for _, span := range observed {
+		for m := span[0]; m <= span[1]; m++ {
+			rows = append(rows, models.ArrivalObservation{StopCode: stop, Route: route, ObservedAt: start.Add(time.Duration(m) * time.Minute)})
+		}
+	}
+	for _, p := range passes {
+		rows = append(rows, models.ArrivalObservation{StopCode: stop, Route: route, ObservedAt: start.Add(p), Passed: true})
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].ObservedAt.Before(rows[j].ObservedAt) })
+	return rows
+}
+
+func prediction(stop, route string, at time.Time, meters, minutes int) models.ArrivalObservation {
+	return models.ArrivalObservation{StopCode: stop, Route: route, ObservedAt: at, DistanceMeters: &meters, PredictedMinutes: &minutes}
+}
+
+func TestComputeArrivalReliability(t *testing.T) {
+	start := time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC)
+	mins := func(m float64) time.Duration { return time.Duration(m * float64(time.Minute)) }
+
+	// Consultas con predicción: a las 8:00 el 405 más cercano viene a 5 min
+	// (pasa 8:07, error +2) y a las 8:03 a 1 min (error +3)
+	predicted := observationSeries("PA433", "405", start, [][2]int{{0, 10}}, mins(7))
+	predicted = append(predicted,
+		prediction("PA433", "405", start, 2000, 12),
+		prediction("PA433", "405", start, 800, 5),
+		prediction("PA433", "405", start.Add(mins(3)), 300, 1),
+	)
+	sort.SliceStable(predicted, func(i, j int) bool { return predicted[i].ObservedAt.Before(predicted[j].ObservedAt) })
+
+	tests := []struct {
+		name      string
+		obs       []models.ArrivalObservation
+		scheduled map[headwayKey]float64
+
+		headways    int
+		actual      *float64
+		cv          *float64
+		planned     *float64
+		predictions int
+		bias        *float64
+		mae         *float64
+		onTime      *float64
+		score       *float64
+	}{
+		{
+			name:     "headways regulares",
+			obs:      observationSeries("PA433", "405", start, [][2]int{{0, 40}}, mins(5), mins(15), mins(25), mins(35)),
+			headways: 3, actual: floatPtr(10), cv: floatPtr(0), score: floatPtr(100),
+		},
+		{
+			name: "horario programado más frecuente que lo observado",
+			obs:  observationSeries("PA433", "405", start, [][2]int{{0, 40}}, mins(5), mins(15), mins(25), mins(35)),
+			scheduled: map[headwayKey]float64{
+				{date: "2026-03-10", route: "405", hour: 8}: 5,
+			},
+			// 0,35 * 1 (regular) + 0,35 * 0,5 (cumplimiento) sobre 0,7
+			headways: 3, actual: floatPtr(10), cv: floatPtr(0), planned: floatPtr(5), score: floatPtr(75),
+		},
+		{
+			name: "un hueco de observación corta la serie",
+			obs:  observationSeries("PA433", "405", start, [][2]int{{0, 12}, {20, 40}}, mins(5), mins(25), mins(35)),
+			// 8:05 → 8:25 cruza el hueco; sólo cuenta 8:25 → 8:35 y no alcanza para el CV
+			headways: 1, actual: floatPtr(10),
+		},
+		{
+			name:     "la misma pasada detectada dos veces",
+			obs:      observationSeries("PA433", "405", start, [][2]int{{0, 20}}, mins(5), mins(5.25), mins(15)),
+			headways: 1, actual: floatPtr(9.8),
+		},
+		{
+			name: "intervalo mayor a maxHeadway",
+			obs:  observationSeries("PA433", "405", start, [][2]int{{0, 100}}, mins(2), mins(98)),
+		},
+		{
+			name:        "error de predicción del bus más cercano",
+			obs:         predicted,
+			predictions: 2, bias: floatPtr(2.5), mae: floatPtr(2.5), onTime: floatPtr(0.5),
+		},
+		{
+			name: "predicción sin pasada posterior",
+			obs: append(observationSeries("PA433", "405", start, [][2]int{{0, 10}}),
+				prediction("PA433", "405", start.Add(mins(10)), 500, 2)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := computeArrivalReliability(tt.obs, tt.scheduled, time.UTC, false)
+			if len(results) != 1 {
+				t.Fatalf("%d resultados, want 1", len(results))
+			}
+			r := results[0]
+			if r.StopCode != "PA433" || r.Route != "405" || r.Hour != nil || r.Hours != nil {
+				t.Errorf("identificación %s/%s hour=%v hours=%v", r.StopCode, r.Route, r.Hour, r.Hours)
+			}
+			if r.HeadwaySamples != tt.headways {
+				t.Errorf("headway_samples %d, want %d", r.HeadwaySamples, tt.headways)
+			}
+			if r.PredictionSamples != tt.predictions {
+				t.Errorf("prediction_samples %d, want %d", r.PredictionSamples, tt.predictions)
+			}
+			checks := []struct {
+				field     string
+				got, want *float64
+			}{
+				{"actual_headway_min", r.ActualHeadwayMin, tt.actual},
+				{"headway_cv", r.HeadwayCV, tt.cv},
+				{"scheduled_headway_min", r.ScheduledHeadwayMin, tt.planned},
+				{"prediction_bias_min", r.PredictionBiasMin, tt.bias},
+				{"prediction_mae_min", r.PredictionMAEMin, tt.mae},
+				{"prediction_on_time", r.PredictionOnTime, tt.onTime},
+				{"score", r.Score, tt.score},
+			}
+			for _, c := range checks {
+				if (c.got == nil) != (c.want == nil) || (c.got != nil && *c.got != *c.want) {
+					t.Errorf("%s = %s, want %s", c.field, formatOptional(c.got), formatOptional(c.want))
+				}
+			}
+		})
+	}
+}
+
+func TestComputeArrivalReliabilityGrouping(t *testing.T) {
+	start := time.Date(2026, 3, 10, 8, 40, 0, 0, time.UTC)
+	mins := func(m int) time.Duration { return time.Duration(m) * time.Minute }
+
+	var obs []models.ArrivalObservation
+	obs = append(obs, observationSeries("PA433", "405", start, [][2]int{{0, 40}}, mins(5), mins(15), mins(25), mins(35))...)
+	obs = append(obs, observationSeries("PA433", "C01", start, [][2]int{{0, 20}}, mins(2), mins(14))...)
+	obs = append(obs, observationSeries("PC615", "405", start, [][2]int{{0, 5}})...)
+
+	results := computeArrivalReliability(obs, nil, time.UTC, true)
+	if len(results) != 3 {
+		t.Fatalf("%d resultados, want 3 (uno por paradero y ruta)", len(results))
+	}
+	for i, want := range []struct{ stop, route string }{{"PA433", "405"}, {"PA433", "C01"}, {"PC615", "405"}} {
+		if results[i].StopCode != want.stop || results[i].Route != want.route {
+			t.Errorf("resultado %d: %s/%s, want %s/%s", i, results[i].StopCode, results[i].Route, want.stop, want.route)
+		}
+	}
+
+	// 8:45 → 8:55 cuenta a las 8; 8:55 → 9:05 y 9:05 → 9:15 a las 9
+	hours := results[0].Hours
+	if len(hours) != 2 || *hours[0].Hour != 8 || *hours[1].Hour != 9 {
+		t.Fatalf("horas %+v, want 8 y 9", hours)
+	}
+	if hours[0].HeadwaySamples != 1 || hours[1].HeadwaySamples != 2 {
+		t.Errorf("muestras por hora %d/%d, want 1/2", hours[0].HeadwaySamples, hours[1].HeadwaySamples)
+	}
+	if results[2].Hours != nil || results[2].HeadwaySamples != 0 || results[2].Score != nil {
+		t.Errorf("ruta sin pasadas con métricas: %+v", results[2])
+	}
+
+	if got := computeArrivalReliability(nil, nil, time.UTC, true); got == nil || len(got) != 0 {
+		t.Errorf("sin observaciones: %v, want lista vacía", got)
+	}
+}
+
+func formatOptional(v *float64) string {
+	if v == nil {
+		return "nil"
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
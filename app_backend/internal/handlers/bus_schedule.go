@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/yourorg/wayfindcl/internal/gtfs"
+	"github.com/yourorg/wayfindcl/internal/redcl"
+	"github.com/yourorg/wayfindcl/internal/transit"
+)
+
+const (
+	// stopScheduleTTL es cuánto se reutiliza el horario GTFS leído de un
+	// paradero mientras no cambie la generación activa del feed
+	stopScheduleTTL = time.Hour
+
+	// scheduledArrivalsWindow es hasta cuándo se buscan pasadas programadas
+	scheduledArrivalsWindow = 90 * time.Minute
+	// scheduledArrivalsPerRoute son las próximas pasadas informadas por ruta
+	scheduledArrivalsPerRoute = 2
+)
+
+// stopScheduleEntry es el horario en caché de un paradero
+type stopScheduleEntry struct {
+	schedule   *transit.StopSchedule
+	generation int64 // Generación GTFS activa al leerlo
+	loadedAt   time.Time
+}
+
+// stopSchedule retorna el horario GTFS del paradero desde el caché o la base.
+// Una activación o rollback (también desde el CLI) cambia la generación
+// activa y deja vencidos los horarios leídos antes.
+func (h *BusArrivalsHandler) stopSchedule(ctx context.Context, stopCode string) (*transit.StopSchedule, error) {
+	generation, err := gtfs.ActiveGeneration(ctx, h.db)
+	if err != nil {
+		return nil, err
+	}
+
+	h.scheduleMu.Lock()
+	entry := h.schedules[stopCode]
+	h.scheduleMu.Unlock()
+	if entry != nil && entry.generation == generation && time.Since(entry.loadedAt) < stopScheduleTTL {
+		return entry.schedule, nil
+	}
+
+	schedule, err := transit.LoadStopSchedule(ctx, h.db, stopCode)
+	if err != nil {
+		return nil, err
+	}
+	h.scheduleMu.Lock()
+	h.schedules[stopCode] = &stopScheduleEntry{schedule: schedule, generation: generation, loadedAt: time.Now()}
+	h.scheduleMu.Unlock()
+	return schedule, nil
+}
+
+// ClearSchedules vacía el caché de horarios GTFS por paradero
+func (h *BusArrivalsHandler) ClearSchedules() {
+	h.scheduleMu.Lock()
+	h.schedules = make(map[string]*stopScheduleEntry)
+	h.scheduleMu.Unlock()
+}
+
+// scheduledArrivals estima las llegadas de un paradero desde el horario GTFS
+// del día de servicio, para cuando Red.cl no responde. Retorna nil sin error
+// si no hay GTFS, el paradero no existe o no hay pasadas próximas.
+func (h *BusArrivalsHandler) scheduledArrivals(ctx context.Context, stopCode string) (*redcl.StopArrivals, error) {
+	if h.db == nil {
+		return nil, nil
+	}
+	schedule, err := h.stopSchedule(ctx, stopCode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().In(transit.Location())
+	upcoming, err := schedule.Upcoming(now, scheduledArrivalsWindow, func(day time.Time) (map[string]bool, error) {
+		return transit.ActiveServices(ctx, h.db, day)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	arrivals := []redcl.BusArrival{}
+	perRoute := make(map[string]int)
+	for _, d := range upcoming {
+		route := strings.ToUpper(d.RouteShortName)
+		if route == "" || perRoute[route] >= scheduledArrivalsPerRoute {
+			continue
+		}
+		perRoute[route]++
+
+		at := d.At
+		minutes := int(at.Sub(now).Minutes())
+		arrivals = append(arrivals, redcl.BusArrival{
+			RouteNumber:      route,
+			EstimatedMinutes: &minutes,
+			Source:           redcl.ArrivalSourceScheduled,
+			ScheduledAt:      &at,
+			Headsign:         d.Headsign,
+		})
+	}
+	if len(arrivals) == 0 {
+		return nil, nil
+	}
+
+	return &redcl.StopArrivals{
+		StopCode:    stopCode,
+		StopName:    schedule.StopName,
+		Arrivals:    arrivals,
+		LastUpdated: time.Now(),
+		Source:      redcl.ArrivalSourceScheduled,
+	}, nil
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Cachés en memoria del servidor que se pueden vaciar desde el CLI (cache flush)
+var (
+	cacheFlushersMu sync.Mutex
+	cacheFlushers   = map[string]func(){}
+)
+
+// RegisterCacheFlusher registra una función que vacía un caché en memoria bajo un nombre
+func RegisterCacheFlusher(name string, flush func()) {
+	cacheFlushersMu.Lock()
+	defer cacheFlushersMu.Unlock()
+	cacheFlushers[name] = flush
+}
+
+// FlushCaches handles POST /api/admin/cache/flush
+// Vacía todos los cachés registrados, o sólo los indicados en ?names=a,b
+func FlushCaches(c *fiber.Ctx) error {
+	cacheFlushersMu.Lock()
+	defer cacheFlushersMu.Unlock()
+
+	var names []string
+	if raw := strings.TrimSpace(c.Query("names")); raw != "" {
+		for _, name := range strings.Split(raw, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if _, ok := cacheFlushers[name]; !ok {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error":     "unknown cache: " + name,
+					"available": registeredCacheNames(),
+				})
+			}
+			names = append(names, name)
+		}
+	} else {
+		names = registeredCacheNames()
+	}
+
+	for _, name := range names {
+		cacheFlushers[name]()
+	}
+	log.Printf("🧹 [ADMIN] Cachés vaciados: %s", strings.Join(names, ", "))
+
+	return c.JSON(fiber.Map{
+		"flushed": names,
+	})
+}
+
+func registeredCacheNames() []string {
+	names := make([]string, 0, len(cacheFlushers))
+	for name := range cacheFlushers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,585 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/middleware"
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/notifications"
+	"github.com/yourorg/wayfindcl/internal/repository"
+	"github.com/yourorg/wayfindcl/internal/validation"
+)
+
+const (
+	defaultContributionListLimit = 50
+	maxContributionListLimit     = 100
+	maxContributionDeviceInfo    = 4096
+
+	// adminUserHeader identifica al moderador en el registro (opcional, por defecto "admin")
+	adminUserHeader = "X-Admin-User"
+)
+
+// publicContributionStatuses son los estados visibles para cualquier usuario
+var publicContributionStatuses = []models.ContributionStatus{
+	models.ContributionVerified,
+	models.ContributionResolved,
+}
+
+type ContributionHandler struct {
+	contributions repository.ContributionRepository
+	routes        repository.RouteRepository
+	alerts        *notifications.IncidentAlerts
+}
+
+func NewContributionHandler(contributions repository.ContributionRepository, routes repository.RouteRepository, alerts *notifications.IncidentAlerts) *ContributionHandler {
+	return &ContributionHandler{contributions: contributions, routes: routes, alerts: alerts}
+}
+
+// CreateContribution registra un reporte o sugerencia (también anónimo); queda pendiente de moderación
+func (h *ContributionHandler) CreateContribution(c *fiber.Ctx) error {
+	var req models.ContributionCreateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	switch req.Type {
+	case models.ContributionBusStatus, models.ContributionRouteIssues, models.ContributionStopInfo, models.ContributionGeneralSuggestion:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "type must be 'bus_status', 'route_issues', 'stop_info' or 'general_suggestion'",
+		})
+	}
+	if len(req.DeviceInfo) > maxContributionDeviceInfo || (len(req.DeviceInfo) > 0 && !json.Valid(req.DeviceInfo)) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "device_info must be a JSON object of at most 4KB",
+		})
+	}
+
+	contribution := &models.Contribution{
+		Type:         req.Type,
+		Category:     req.Category,
+		Title:        req.Title,
+		Description:  req.Description,
+		Latitude:     req.Latitude,
+		Longitude:    req.Longitude,
+		BusRoute:     req.BusRoute,
+		StopName:     req.StopName,
+		DelayMinutes: req.DelayMinutes,
+		Severity:     req.Severity,
+		ContactEmail: req.ContactEmail,
+		DeviceInfo:   req.DeviceInfo,
+	}
+	if contribution.Severity == "" {
+		contribution.Severity = models.SeverityMedium
+	}
+	if userID, ok := middleware.UserIDFromCtx(c); ok {
+		contribution.UserID = &userID
+	}
+	if errMsg := validateContribution(contribution); errMsg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errMsg,
+		})
+	}
+
+	id, err := h.contributions.Create(c.UserContext(), contribution)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create contribution",
+		})
+	}
+	contribution.ID = id
+	contribution.Status = models.ContributionPending
+	contribution.CreatedAt = time.Now()
+	contribution.UpdatedAt = contribution.CreatedAt
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":      "Contribution submitted for review",
+		"contribution": contribution,
+	})
+}
+
+// validateContribution normaliza y valida los campos editables; retorna el mensaje de error si no es válida
+func validateContribution(contribution *models.Contribution) string {
+	contribution.Title = strings.TrimSpace(contribution.Title)
+	contribution.Description = strings.TrimSpace(contribution.Description)
+	if contribution.Title == "" || len(contribution.Title) > 255 {
+		return "title is required (max 255 characters)"
+	}
+	if contribution.Description == "" {
+		return "description is required"
+	}
+
+	if (contribution.Latitude == nil) != (contribution.Longitude == nil) {
+		return "latitude and longitude must be sent together"
+	}
+	if contribution.Latitude != nil {
+		if err := validation.ValidateCoordinatePair(*contribution.Latitude, *contribution.Longitude, "contribution"); err != nil {
+			return err.Error()
+		}
+	}
+
+	contribution.Category = trimmedOrNil(contribution.Category)
+	contribution.BusRoute = trimmedOrNil(contribution.BusRoute)
+	contribution.StopName = trimmedOrNil(contribution.StopName)
+	contribution.ContactEmail = trimmedOrNil(contribution.ContactEmail)
+	if contribution.Category != nil && len(*contribution.Category) > 50 {
+		return "category is too long"
+	}
+	if contribution.BusRoute != nil && len(*contribution.BusRoute) > 100 {
+		return "bus_route is too long"
+	}
+	if contribution.StopName != nil && len(*contribution.StopName) > 255 {
+		return "stop_name is too long"
+	}
+	if contribution.ContactEmail != nil && (len(*contribution.ContactEmail) > 255 || !strings.Contains(*contribution.ContactEmail, "@")) {
+		return "contact_email is invalid"
+	}
+	if contribution.DelayMinutes != nil && (*contribution.DelayMinutes < 0 || *contribution.DelayMinutes > 24*60) {
+		return "delay_minutes must be between 0 and 1440"
+	}
+
+	switch contribution.Severity {
+	case models.SeverityLow, models.SeverityMedium, models.SeverityHigh, models.SeverityCritical:
+	default:
+		return "severity must be 'low', 'medium', 'high' or 'critical'"
+	}
+	return ""
+}
+
+// trimmedOrNil descarta los textos opcionales vacíos
+func trimmedOrNil(s *string) *string {
+	value := trimmed(s)
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// contributionListFilter lee type, bus_route, limit y offset de la query
+func contributionListFilter(c *fiber.Ctx) repository.ContributionFilter {
+	limit := c.QueryInt("limit", defaultContributionListLimit)
+	if limit <= 0 || limit > maxContributionListLimit {
+		limit = defaultContributionListLimit
+	}
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+	return repository.ContributionFilter{
+		Type:     models.ContributionType(strings.TrimSpace(c.Query("type"))),
+		BusRoute: strings.TrimSpace(c.Query("bus_route")),
+		Limit:    limit,
+		Offset:   offset,
+	}
+}
+
+// GetContributions lista las contribuciones aprobadas o resueltas (sin datos de contacto)
+func (h *ContributionHandler) GetContributions(c *fiber.Ctx) error {
+	filter := contributionListFilter(c)
+	filter.Statuses = publicContributionStatuses
+	if status := models.ContributionStatus(c.Query("status")); status != "" {
+		if status != models.ContributionVerified && status != models.ContributionResolved {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "status must be 'verified' or 'resolved'",
+			})
+		}
+		filter.Statuses = []models.ContributionStatus{status}
+	}
+
+	contributions, err := h.contributions.List(c.UserContext(), filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch contributions",
+		})
+	}
+	for i := range contributions {
+		contributions[i] = contributions[i].Public()
+	}
+
+	return c.JSON(fiber.Map{
+		"contributions": contributions,
+		"count":         len(contributions),
+	})
+}
+
+// GetMyContributions lista las contribuciones del usuario en cualquier estado
+func (h *ContributionHandler) GetMyContributions(c *fiber.Ctx) error {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Authentication required",
+		})
+	}
+
+	filter := contributionListFilter(c)
+	filter.UserID = &userID
+	contributions, err := h.contributions.List(c.UserContext(), filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch contributions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"contributions": contributions,
+		"count":         len(contributions),
+	})
+}
+
+// GetContribution retorna una contribución: completa para su autor, pública si
+// fue aprobada o resuelta; las pendientes o rechazadas de otros no existen
+func (h *ContributionHandler) GetContribution(c *fiber.Ctx) error {
+	contribution, ok := h.contributionFromParam(c)
+	if !ok {
+		return nil
+	}
+
+	if isContributionOwner(c, contribution) {
+		return c.JSON(contribution)
+	}
+	if contribution.Status != models.ContributionVerified && contribution.Status != models.ContributionResolved {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Contribution not found",
+		})
+	}
+	return c.JSON(contribution.Public())
+}
+
+// contributionFromParam carga la contribución de :id; si falla ya respondió al cliente
+func (h *ContributionHandler) contributionFromParam(c *fiber.Ctx) (*models.Contribution, bool) {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Contribution not found",
+		})
+		return nil, false
+	}
+
+	contribution, err := h.contributions.Get(c.UserContext(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Contribution not found",
+		})
+		return nil, false
+	}
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch contribution",
+		})
+		return nil, false
+	}
+	return contribution, true
+}
+
+func isContributionOwner(c *fiber.Ctx, contribution *models.Contribution) bool {
+	userID, ok := middleware.UserIDFromCtx(c)
+	return ok && contribution.UserID != nil && *contribution.UserID == userID
+}
+
+// UpdateContribution edita una contribución propia mientras siga pendiente
+func (h *ContributionHandler) UpdateContribution(c *fiber.Ctx) error {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Authentication required",
+		})
+	}
+
+	var req models.ContributionUpdateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req == (models.ContributionUpdateRequest{}) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "No fields to update",
+		})
+	}
+
+	contribution, ok := h.contributionFromParam(c)
+	if !ok {
+		return nil
+	}
+	if !isContributionOwner(c, contribution) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Contribution not found",
+		})
+	}
+
+	// Validar el resultado de aplicar los cambios antes de guardarlos
+	contribution.Apply(req)
+	if errMsg := validateContribution(contribution); errMsg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errMsg,
+		})
+	}
+	normalized := models.ContributionUpdateRequest{
+		Category:     contribution.Category,
+		Title:        &contribution.Title,
+		Description:  &contribution.Description,
+		Latitude:     contribution.Latitude,
+		Longitude:    contribution.Longitude,
+		BusRoute:     contribution.BusRoute,
+		StopName:     contribution.StopName,
+		DelayMinutes: contribution.DelayMinutes,
+		Severity:     &contribution.Severity,
+		ContactEmail: contribution.ContactEmail,
+	}
+
+	err := h.contributions.Update(c.UserContext(), contribution.ID, userID, normalized)
+	if errMsg, status := contributionWriteError(err); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": errMsg,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update contribution",
+		})
+	}
+
+	updated, err := h.contributions.Get(c.UserContext(), contribution.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch contribution",
+		})
+	}
+	return c.JSON(updated)
+}
+
+// DeleteContribution retira una contribución propia mientras siga pendiente
+func (h *ContributionHandler) DeleteContribution(c *fiber.Ctx) error {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Authentication required",
+		})
+	}
+
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Contribution not found",
+		})
+	}
+
+	err = h.contributions.Delete(c.UserContext(), id, userID)
+	if errMsg, status := contributionWriteError(err); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": errMsg,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete contribution",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Contribution deleted successfully",
+	})
+}
+
+// contributionWriteError traduce los errores esperados de Update/Delete (status 0 si no aplica)
+func contributionWriteError(err error) (string, int) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return "Contribution not found", fiber.StatusNotFound
+	case errors.Is(err, repository.ErrConflict):
+		return "Contribution was already reviewed and can no longer be changed", fiber.StatusConflict
+	}
+	return "", 0
+}
+
+// ============================================================================
+// MODERACIÓN (ADMIN)
+// ============================================================================
+
+// GetModerationQueue lista contribuciones por estado (?status=pending por
+// defecto, "all" para todas); las pendientes salen de la más antigua a la más nueva
+func (h *ContributionHandler) GetModerationQueue(c *fiber.Ctx) error {
+	filter := contributionListFilter(c)
+	switch status := models.ContributionStatus(c.Query("status", string(models.ContributionPending))); status {
+	case "all":
+	case models.ContributionPending:
+		filter.Statuses = []models.ContributionStatus{status}
+		filter.OldestFirst = true
+	case models.ContributionVerified, models.ContributionRejected, models.ContributionResolved:
+		filter.Statuses = []models.ContributionStatus{status}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "status must be 'pending', 'verified', 'rejected', 'resolved' or 'all'",
+		})
+	}
+
+	contributions, err := h.contributions.List(c.UserContext(), filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch contributions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"contributions": contributions,
+		"count":         len(contributions),
+	})
+}
+
+// ApproveContribution verifica una contribución pendiente. Los retrasos y
+// desvíos con ruta se publican además como incidente en esa ruta.
+func (h *ContributionHandler) ApproveContribution(c *fiber.Ctx) error {
+	return h.moderate(c, repository.ContributionDecision{
+		From: []models.ContributionStatus{models.ContributionPending},
+		To:   models.ContributionVerified,
+	}, false)
+}
+
+// RejectContribution descarta una contribución pendiente (requiere nota)
+func (h *ContributionHandler) RejectContribution(c *fiber.Ctx) error {
+	return h.moderate(c, repository.ContributionDecision{
+		From: []models.ContributionStatus{models.ContributionPending},
+		To:   models.ContributionRejected,
+	}, true)
+}
+
+// ResolveContribution cierra una contribución pendiente o aprobada cuyo
+// problema ya se solucionó (requiere nota); resuelve también su incidente
+func (h *ContributionHandler) ResolveContribution(c *fiber.Ctx) error {
+	return h.moderate(c, repository.ContributionDecision{
+		From: []models.ContributionStatus{models.ContributionPending, models.ContributionVerified},
+		To:   models.ContributionResolved,
+	}, true)
+}
+
+func (h *ContributionHandler) moderate(c *fiber.Ctx, decision repository.ContributionDecision, noteRequired bool) error {
+	var req models.ContributionModerationRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+	decision.Note = strings.TrimSpace(req.Note)
+	if noteRequired && decision.Note == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "note is required",
+		})
+	}
+	decision.Moderator = moderatorName(c)
+
+	contribution, ok := h.contributionFromParam(c)
+	if !ok {
+		return nil
+	}
+	if decision.To == models.ContributionVerified {
+		decision.Incident = h.incidentFor(c.UserContext(), contribution)
+	}
+
+	moderated, err := h.contributions.Moderate(c.UserContext(), contribution.ID, decision)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Contribution not found",
+		})
+	}
+	if errors.Is(err, repository.ErrConflict) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("Contribution cannot be %s from its current status", decision.To),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to moderate contribution",
+		})
+	}
+
+	log.Printf("🛡️  [CONTRIBUTIONS] Contribución %d: %s → %s por %s", moderated.ID, contribution.Status, moderated.Status, decision.Moderator)
+
+	// Avisar a los suscritos a la ruta sin demorar la respuesta
+	if decision.Incident != nil && moderated.IncidentID != nil {
+		incident := *decision.Incident
+		incident.ID = *moderated.IncidentID
+		incident.Status = models.IncidentStatusActive
+		if h.alerts != nil {
+			go notifyIncidentSubscribers(h.alerts, incident)
+		}
+	}
+
+	return c.JSON(moderated)
+}
+
+// moderatorName identifica a quien modera: el usuario autenticado (rol
+// moderator) o, con el token de admin, el header X-Admin-User
+func moderatorName(c *fiber.Ctx) string {
+	if claims, ok := middleware.ClaimsFromCtx(c); ok && claims.Username != "" {
+		return claims.Username
+	}
+	name := strings.TrimSpace(c.Get(adminUserHeader))
+	if name == "" || len(name) > 100 {
+		return "admin"
+	}
+	return name
+}
+
+// incidentFor arma el incidente que publica una contribución aprobada de
+// retraso o desvío. Sin coordenadas propias se ubica en el punto medio del
+// trazado de la ruta; retorna nil si no aplica o no hay cómo ubicarlo.
+func (h *ContributionHandler) incidentFor(ctx context.Context, contribution *models.Contribution) *models.Incident {
+	if contribution.Category == nil || contribution.BusRoute == nil {
+		return nil
+	}
+	var incidentType models.IncidentType
+	switch *contribution.Category {
+	case models.ContributionCategoryDelayed:
+		incidentType = models.IncidentBusDelayed
+	case models.ContributionCategoryDetour:
+		incidentType = models.IncidentBusDetour
+	default:
+		return nil
+	}
+
+	var lat, lon float64
+	if contribution.Latitude != nil && contribution.Longitude != nil {
+		lat, lon = *contribution.Latitude, *contribution.Longitude
+	} else {
+		_, points, err := h.routes.Shape(ctx, *contribution.BusRoute)
+		if err != nil || len(points) == 0 {
+			log.Printf("⚠️  [CONTRIBUTIONS] Sin ubicación para el incidente de la contribución %d (ruta %s): %v", contribution.ID, *contribution.BusRoute, err)
+			return nil
+		}
+		mid := points[len(points)/2]
+		lon, lat = mid[0], mid[1]
+	}
+
+	description := contribution.Title + ": " + contribution.Description
+	if contribution.DelayMinutes != nil && *contribution.DelayMinutes > 0 {
+		description += fmt.Sprintf(" (retraso reportado: %d min)", *contribution.DelayMinutes)
+	}
+	reporterID := "anonymous"
+	if contribution.UserID != nil {
+		reporterID = strconv.FormatInt(*contribution.UserID, 10)
+	}
+
+	routeName := *contribution.BusRoute
+	return &models.Incident{
+		Type:        incidentType,
+		Latitude:    lat,
+		Longitude:   lon,
+		Severity:    contribution.Severity,
+		ReporterID:  reporterID,
+		RouteName:   &routeName,
+		StopName:    contribution.StopName,
+		Description: &description,
+	}
+}
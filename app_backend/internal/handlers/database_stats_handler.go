@@ -5,11 +5,13 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/redcl"
 )
 
 // DatabaseStatsHandler maneja estadísticas de la base de datos
 type DatabaseStatsHandler struct {
-	db *sql.DB
+	db            *sql.DB
+	arrivalsStats func() redcl.CacheStats
 }
 
 // NewDatabaseStatsHandler crea un nuevo handler
@@ -169,6 +171,12 @@ func (h *DatabaseStatsHandler) GetDatabaseReport(c *fiber.Ctx) error {
 	return c.JSON(report)
 }
 
+// SetArrivalsStats configura la fuente de métricas del caché de llegadas de
+// Red.cl que se incluyen en GetScraperMetrics
+func (h *DatabaseStatsHandler) SetArrivalsStats(stats func() redcl.CacheStats) {
+	h.arrivalsStats = stats
+}
+
 // GetScraperMetrics obtiene métricas de scraping de Moovit
 func (h *DatabaseStatsHandler) GetScraperMetrics(c *fiber.Ctx) error {
 	type ScraperStatus struct {
@@ -185,6 +193,8 @@ func (h *DatabaseStatsHandler) GetScraperMetrics(c *fiber.Ctx) error {
 		StopsExtracted  int       `json:"stopsExtracted"`
 		MetroLines      []string  `json:"metroLines,omitempty"`
 		LastError       string    `json:"lastError,omitempty"`
+		// Caché de llegadas de Red.cl: hits/misses y latencia de las consultas
+		Arrivals *redcl.CacheStats `json:"arrivals,omitempty"`
 	}
 
 	// Verificar si hay actividad reciente del scraper
@@ -225,6 +235,11 @@ func (h *DatabaseStatsHandler) GetScraperMetrics(c *fiber.Ctx) error {
 		moovitStatus.MetroLines = []string{}
 	}
 
+	if h.arrivalsStats != nil {
+		arrivals := h.arrivalsStats()
+		moovitStatus.Arrivals = &arrivals
+	}
+
 	return c.JSON(moovitStatus)
 }
 
@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/middleware"
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/repository"
+	"github.com/yourorg/wayfindcl/internal/validation"
+)
+
+// Límites de los eventos que envía la app y de su retención
+const (
+	defaultDebugEventsRetention = 7 * 24 * time.Hour
+	defaultDebugEventsMax       = 100000
+	debugEventsPruneInterval    = time.Hour
+
+	defaultDebugEventListLimit = 100
+	maxDebugEventListLimit     = 500
+	maxSessionTimelineEvents   = 2000
+
+	maxDebugMessageLength    = 4000
+	maxDebugStackTraceLength = 64 * 1024
+	maxDebugMetadataSize     = 16 * 1024
+	maxSessionIDLength       = 100
+
+	// maxFingerprintFrames son los frames del stack que definen un issue
+	maxFingerprintFrames = 8
+	// maxClockSkew tolera relojes de dispositivos adelantados
+	maxClockSkew = 5 * time.Minute
+)
+
+// debugEventsRetention lee DEBUG_EVENTS_RETENTION (ej: "72h"); "0" conserva todo
+func debugEventsRetention() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("DEBUG_EVENTS_RETENTION"))
+	if raw == "" {
+		return defaultDebugEventsRetention
+	}
+	if raw == "0" {
+		return 0
+	}
+	dur, err := time.ParseDuration(raw)
+	if err != nil || dur < 0 {
+		log.Printf("⚠️  DEBUG_EVENTS_RETENTION inválido (%q), usando %s", raw, defaultDebugEventsRetention)
+		return defaultDebugEventsRetention
+	}
+	return dur
+}
+
+// debugEventsMax lee DEBUG_EVENTS_MAX: eventos guardados como máximo; "0" sin límite
+func debugEventsMax() int {
+	raw := strings.TrimSpace(os.Getenv("DEBUG_EVENTS_MAX"))
+	if raw == "" {
+		return defaultDebugEventsMax
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("⚠️  DEBUG_EVENTS_MAX inválido (%q), usando %d", raw, defaultDebugEventsMax)
+		return defaultDebugEventsMax
+	}
+	return n
+}
+
+// startDebugEventPruner aplica la retención al iniciar y luego cada hora
+func startDebugEventPruner(events repository.DebugEventRepository, retention time.Duration, max int) {
+	pruneDebugEvents(events, retention, max)
+
+	ticker := time.NewTicker(debugEventsPruneInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		pruneDebugEvents(events, retention, max)
+	}
+}
+
+func pruneDebugEvents(events repository.DebugEventRepository, retention time.Duration, max int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	// Sin retención por edad (before cero) sólo aplica el máximo
+	var before time.Time
+	if retention > 0 {
+		before = time.Now().Add(-retention)
+	}
+
+	deleted, err := events.Prune(ctx, before, max)
+	if err != nil {
+		log.Printf("⚠️  [DEBUG] Error aplicando retención de eventos de la app: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("🧹 [DEBUG] %d eventos de la app eliminados por retención", deleted)
+	}
+}
+
+var (
+	stackFrameNumber = regexp.MustCompile(`^#\d+\s+`)
+	stackLineColumn  = regexp.MustCompile(`:\d+(:\d+)?`)
+	stackHexAddress  = regexp.MustCompile(`0x[0-9a-fA-F]+`)
+	messageNumbers   = regexp.MustCompile(`\d+`)
+)
+
+// errorFingerprint identifica un issue: el tipo de error y los primeros frames
+// del stack sin números de frame, línea/columna ni direcciones (que cambian
+// entre builds). Sin stack se usa el mensaje sin números.
+func errorFingerprint(errorType, message, stackTrace string) string {
+	var frames []string
+	for _, line := range strings.Split(stackTrace, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line == "<asynchronous suspension>" {
+			continue
+		}
+		line = stackFrameNumber.ReplaceAllString(line, "")
+		line = stackLineColumn.ReplaceAllString(line, "")
+		line = stackHexAddress.ReplaceAllString(line, "0x")
+		frames = append(frames, strings.Join(strings.Fields(line), " "))
+		if len(frames) == maxFingerprintFrames {
+			break
+		}
+	}
+	if len(frames) == 0 {
+		frames = append(frames, messageNumbers.ReplaceAllString(strings.ToLower(strings.TrimSpace(message)), "#"))
+	}
+
+	sum := sha1.Sum([]byte(errorType + "\n" + strings.Join(frames, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+type DebugEventHandler struct {
+	events repository.DebugEventRepository
+}
+
+func NewDebugEventHandler(events repository.DebugEventRepository) *DebugEventHandler {
+	return &DebugEventHandler{events: events}
+}
+
+// DebugClientInfo identifica el dispositivo y la sesión de la app que envía el
+// evento (también por los headers X-Device-ID y X-Session-ID)
+type DebugClientInfo struct {
+	DeviceID  string `json:"deviceId,omitempty"`
+	SessionID string `json:"sessionId,omitempty"`
+	Timestamp string `json:"timestamp,omitempty"` // ISO-8601 del dispositivo
+}
+
+// record completa el evento con el dispositivo, la sesión, el usuario y la hora,
+// y lo guarda
+func (h *DebugEventHandler) record(c *fiber.Ctx, event *models.DebugEvent, info DebugClientInfo, metadata map[string]interface{}) error {
+	// Los headers de Fiber apuntan al buffer de la request: se copian para guardarlos
+	deviceID := strings.TrimSpace(info.DeviceID)
+	if deviceID == "" {
+		deviceID = strings.Clone(strings.TrimSpace(c.Get("X-Device-ID")))
+	}
+	sessionID := strings.TrimSpace(info.SessionID)
+	if sessionID == "" {
+		sessionID = strings.Clone(strings.TrimSpace(c.Get("X-Session-ID")))
+	}
+	event.DeviceID = validation.Truncate(deviceID, maxDeviceIDLength)
+	event.SessionID = validation.Truncate(sessionID, maxSessionIDLength)
+	event.Message = validation.Truncate(event.Message, maxDebugMessageLength)
+	event.StackTrace = validation.Truncate(event.StackTrace, maxDebugStackTraceLength)
+	if userID, ok := middleware.UserIDFromCtx(c); ok {
+		event.UserID = &userID
+	}
+
+	now := time.Now()
+	event.OccurredAt = now
+	if info.Timestamp != "" {
+		if t, err := parseTripTime(info.Timestamp); err == nil && t.Before(now.Add(maxClockSkew)) {
+			event.OccurredAt = t
+		}
+	}
+
+	if len(metadata) > 0 {
+		// La metadata que excede el límite se descarta, el evento se guarda igual
+		if data, err := json.Marshal(metadata); err == nil && len(data) <= maxDebugMetadataSize {
+			event.Metadata = data
+		}
+	}
+
+	id, err := h.events.Create(c.UserContext(), event)
+	if err != nil {
+		log.Printf("⚠️  [DEBUG] Error guardando evento de la app: %v", err)
+		return err
+	}
+	event.ID = id
+	return nil
+}
+
+// debugEventFilter lee level, device_id, session_id, user_id, q, since, until,
+// limit y offset de la query; retorna el mensaje de error si alguno es inválido
+func debugEventFilter(c *fiber.Ctx) (repository.DebugEventFilter, string) {
+	limit := c.QueryInt("limit", defaultDebugEventListLimit)
+	if limit <= 0 || limit > maxDebugEventListLimit {
+		limit = defaultDebugEventListLimit
+	}
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+
+	filter := repository.DebugEventFilter{
+		DeviceID:  strings.TrimSpace(c.Query("device_id")),
+		SessionID: strings.TrimSpace(c.Query("session_id")),
+		Query:     strings.TrimSpace(c.Query("q")),
+		Limit:     limit,
+		Offset:    offset,
+	}
+	for _, level := range strings.Split(c.Query("level"), ",") {
+		if level = strings.ToLower(strings.TrimSpace(level)); level != "" {
+			filter.Levels = append(filter.Levels, level)
+		}
+	}
+	if raw := strings.TrimSpace(c.Query("user_id")); raw != "" {
+		userID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return filter, "user_id must be a number"
+		}
+		filter.UserID = &userID
+	}
+	for key, dest := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if raw := strings.TrimSpace(c.Query(key)); raw != "" {
+			t, err := parseTripTime(raw)
+			if err != nil {
+				return filter, key + " must be an ISO-8601 timestamp"
+			}
+			*dest = &t
+		}
+	}
+	return filter, ""
+}
+
+// SearchDebugEvents busca logs, errores y eventos de navegación (?kind=log,error)
+func (h *DebugEventHandler) SearchDebugEvents(c *fiber.Ctx) error {
+	filter, errMsg := debugEventFilter(c)
+	if errMsg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errMsg,
+		})
+	}
+	for _, kind := range strings.Split(c.Query("kind"), ",") {
+		switch kind = strings.TrimSpace(kind); models.DebugEventKind(kind) {
+		case "":
+		case models.DebugEventLog, models.DebugEventError, models.DebugEventNavigation:
+			filter.Kinds = append(filter.Kinds, models.DebugEventKind(kind))
+		default:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "kind must be 'log', 'error' or 'navigation'",
+			})
+		}
+	}
+
+	return h.listEvents(c, filter)
+}
+
+// SearchErrors busca errores de la app (mismos filtros que SearchDebugEvents)
+func (h *DebugEventHandler) SearchErrors(c *fiber.Ctx) error {
+	filter, errMsg := debugEventFilter(c)
+	if errMsg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errMsg,
+		})
+	}
+	filter.Kinds = []models.DebugEventKind{models.DebugEventError}
+	return h.listEvents(c, filter)
+}
+
+// GetIssueEvents lista las ocurrencias de un issue, más recientes primero
+func (h *DebugEventHandler) GetIssueEvents(c *fiber.Ctx) error {
+	filter, errMsg := debugEventFilter(c)
+	if errMsg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errMsg,
+		})
+	}
+	filter.Kinds = []models.DebugEventKind{models.DebugEventError}
+	filter.Fingerprint = strings.ToLower(strings.TrimSpace(c.Params("fingerprint")))
+	return h.listEvents(c, filter)
+}
+
+func (h *DebugEventHandler) listEvents(c *fiber.Ctx, filter repository.DebugEventFilter) error {
+	events, err := h.events.List(c.UserContext(), filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch debug events",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"events": events,
+		"count":  len(events),
+	})
+}
+
+// GetIssues agrupa los errores con el mismo stack normalizado (?sort=count|recent)
+func (h *DebugEventHandler) GetIssues(c *fiber.Ctx) error {
+	filter, errMsg := debugEventFilter(c)
+	if errMsg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errMsg,
+		})
+	}
+
+	var byCount bool
+	switch c.Query("sort", "recent") {
+	case "recent":
+	case "count":
+		byCount = true
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "sort must be 'recent' or 'count'",
+		})
+	}
+
+	issues, err := h.events.Issues(c.UserContext(), filter, byCount)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch issues",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"issues": issues,
+		"count":  len(issues),
+	})
+}
+
+// GetSessionTimeline reconstruye una sesión de la app: todos sus logs, errores
+// y eventos de navegación en orden cronológico
+func (h *DebugEventHandler) GetSessionTimeline(c *fiber.Ctx) error {
+	sessionID := strings.TrimSpace(c.Params("sessionId"))
+	events, err := h.events.List(c.UserContext(), repository.DebugEventFilter{
+		SessionID:   sessionID,
+		OldestFirst: true,
+		Limit:       maxSessionTimelineEvents + 1,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch session",
+		})
+	}
+	if len(events) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Session not found",
+		})
+	}
+
+	truncated := len(events) > maxSessionTimelineEvents
+	if truncated {
+		events = events[:maxSessionTimelineEvents]
+	}
+
+	counts := map[models.DebugEventKind]int{}
+	var deviceID string
+	var userID *int64
+	for _, e := range events {
+		counts[e.Kind]++
+		if deviceID == "" {
+			deviceID = e.DeviceID
+		}
+		if userID == nil {
+			userID = e.UserID
+		}
+	}
+	startedAt, endedAt := events[0].OccurredAt, events[len(events)-1].OccurredAt
+
+	return c.JSON(fiber.Map{
+		"session_id":       sessionID,
+		"device_id":        deviceID,
+		"user_id":          userID,
+		"started_at":       startedAt,
+		"ended_at":         endedAt,
+		"duration_seconds": int(endedAt.Sub(startedAt).Seconds()),
+		"counts":           counts,
+		"events":           events,
+		"truncated":        truncated,
+	})
+}
@@ -3,6 +3,8 @@ package handlers
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/yourorg/wayfindcl/internal/debug"
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/validation"
 )
 
 // DebugLogRequest representa un log enviado desde la app Flutter
@@ -12,6 +14,7 @@ type DebugLogRequest struct {
 	Message  string                 `json:"message"`
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
 	UserID   *int                   `json:"userId,omitempty"`
+	DebugClientInfo
 }
 
 // DebugEventRequest representa un evento de la app Flutter
@@ -28,6 +31,7 @@ type DebugErrorRequest struct {
 	StackTrace string                 `json:"stackTrace,omitempty"`
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`
 	UserID     *int                   `json:"userId,omitempty"`
+	DebugClientInfo
 }
 
 // DebugMetricsRequest representa métricas de la app Flutter
@@ -39,12 +43,8 @@ type DebugMetricsRequest struct {
 	UserID           *int    `json:"userId,omitempty"`
 }
 
-// ReceiveFlutterLog recibe logs desde la app Flutter y los reenvía al dashboard
-func ReceiveFlutterLog(c *fiber.Ctx) error {
-	if !debug.IsEnabled() {
-		return c.JSON(fiber.Map{"status": "disabled"})
-	}
-
+// ReceiveFlutterLog recibe logs desde la app Flutter, los guarda y los reenvía al dashboard
+func (h *DebugEventHandler) ReceiveFlutterLog(c *fiber.Ctx) error {
 	var req DebugLogRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -58,6 +58,17 @@ func ReceiveFlutterLog(c *fiber.Ctx) error {
 		req.Level = "info"
 	}
 
+	event := &models.DebugEvent{Kind: models.DebugEventLog, Level: req.Level, Message: req.Message}
+	if err := h.record(c, event, req.DebugClientInfo, req.Metadata); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to store log",
+		})
+	}
+
+	if !debug.IsEnabled() {
+		return c.JSON(fiber.Map{"status": "ok"})
+	}
+
 	// Agregar información adicional al metadata
 	if req.Metadata == nil {
 		req.Metadata = make(map[string]interface{})
@@ -73,8 +84,8 @@ func ReceiveFlutterLog(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"status": "ok"})
 }
 
-// ReceiveFlutterEvent recibe eventos desde la app Flutter
-func ReceiveFlutterEvent(c *fiber.Ctx) error {
+// ReceiveFlutterEvent recibe eventos desde la app Flutter (sólo se reenvían al dashboard)
+func (h *DebugEventHandler) ReceiveFlutterEvent(c *fiber.Ctx) error {
 	if !debug.IsEnabled() {
 		return c.JSON(fiber.Map{"status": "disabled"})
 	}
@@ -110,12 +121,9 @@ func ReceiveFlutterEvent(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"status": "ok"})
 }
 
-// ReceiveFlutterError recibe errores desde la app Flutter
-func ReceiveFlutterError(c *fiber.Ctx) error {
-	if !debug.IsEnabled() {
-		return c.JSON(fiber.Map{"status": "disabled"})
-	}
-
+// ReceiveFlutterError recibe errores desde la app Flutter; se guardan agrupados
+// por fingerprint para GET /api/debug/issues
+func (h *DebugEventHandler) ReceiveFlutterError(c *fiber.Ctx) error {
 	var req DebugErrorRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -123,6 +131,24 @@ func ReceiveFlutterError(c *fiber.Ctx) error {
 		})
 	}
 
+	event := &models.DebugEvent{
+		Kind:        models.DebugEventError,
+		Level:       "error",
+		EventType:   validation.Truncate(req.ErrorType, 60),
+		Message:     req.Message,
+		StackTrace:  req.StackTrace,
+		Fingerprint: errorFingerprint(req.ErrorType, req.Message, req.StackTrace),
+	}
+	if err := h.record(c, event, req.DebugClientInfo, req.Metadata); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to store error",
+		})
+	}
+
+	if !debug.IsEnabled() {
+		return c.JSON(fiber.Map{"status": "ok", "fingerprint": event.Fingerprint})
+	}
+
 	// Agregar información adicional
 	if req.Metadata == nil {
 		req.Metadata = make(map[string]interface{})
@@ -136,14 +162,16 @@ func ReceiveFlutterError(c *fiber.Ctx) error {
 		req.Metadata["stackTrace"] = req.StackTrace
 	}
 
+	req.Metadata["fingerprint"] = event.Fingerprint
+
 	message := "[" + req.ErrorType + "] " + req.Message
 	debug.SendLog("frontend", "error", message, req.Metadata)
 
-	return c.JSON(fiber.Map{"status": "ok"})
+	return c.JSON(fiber.Map{"status": "ok", "fingerprint": event.Fingerprint})
 }
 
-// ReceiveFlutterMetrics recibe métricas desde la app Flutter
-func ReceiveFlutterMetrics(c *fiber.Ctx) error {
+// ReceiveFlutterMetrics recibe métricas desde la app Flutter (sólo se reenvían al dashboard)
+func (h *DebugEventHandler) ReceiveFlutterMetrics(c *fiber.Ctx) error {
 	if !debug.IsEnabled() {
 		return c.JSON(fiber.Map{"status": "disabled"})
 	}
@@ -189,14 +217,12 @@ type NavigationEventRequest struct {
 	BusRoute        string  `json:"busRoute,omitempty"`
 	StopName        string  `json:"stopName,omitempty"`
 	UserID          *int    `json:"userId,omitempty"`
+	DebugClientInfo
 }
 
-// ReceiveNavigationEvent recibe eventos de navegación desde Flutter
-func ReceiveNavigationEvent(c *fiber.Ctx) error {
-	if !debug.IsEnabled() {
-		return c.JSON(fiber.Map{"status": "disabled"})
-	}
-
+// ReceiveNavigationEvent recibe eventos de navegación desde Flutter, los guarda
+// y los reenvía al dashboard
+func (h *DebugEventHandler) ReceiveNavigationEvent(c *fiber.Ctx) error {
 	var req NavigationEventRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -235,6 +261,21 @@ func ReceiveNavigationEvent(c *fiber.Ctx) error {
 	}
 
 	message := "🧭 Navigation: " + req.EventType
+	event := &models.DebugEvent{
+		Kind:      models.DebugEventNavigation,
+		Level:     "info",
+		EventType: validation.Truncate(req.EventType, 60),
+		Message:   message,
+	}
+	if err := h.record(c, event, req.DebugClientInfo, metadata); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to store navigation event",
+		})
+	}
+
+	if !debug.IsEnabled() {
+		return c.JSON(fiber.Map{"status": "ok"})
+	}
 	debug.SendLog("frontend", "info", message, metadata)
 
 	return c.JSON(fiber.Map{"status": "ok"})
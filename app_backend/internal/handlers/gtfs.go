@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"math"
 	"sort"
 	"strconv"
@@ -9,7 +10,9 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/gtfs"
 	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/repository"
 )
 
 const (
@@ -36,28 +39,69 @@ func SyncGTFS(c *fiber.Ctx) error {
 
 	summary, err := gtfsLoader.Sync(ctx, dbConn)
 	if err != nil {
+		var verr *gtfs.ValidationError
+		if errors.As(err, &verr) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error":      "feed GTFS rechazado por el validador",
+				"validation": verr.Report,
+			})
+		}
 		return c.Status(fiber.StatusBadGateway).JSON(models.ErrorResponse{Error: err.Error()})
 	}
 
 	gtfsSummaryMu.Lock()
 	gtfsLastSummary = summary
 	gtfsSummaryMu.Unlock()
+	if !summary.Skipped {
+		invalidateTransitRouter()
+	}
+
+	message := "GTFS actualizado"
+	if summary.Skipped {
+		message = "GTFS sin cambios, sincronización omitida"
+	}
 
 	resp := models.GTFSSyncResponse{
-		Message: "GTFS actualizado",
+		Message: message,
 		Summary: models.GTFSSummary{
-			FeedVersion:   summary.FeedVersion,
-			StopsImported: summary.StopsImported,
-			DownloadedAt:  summary.DownloadedAt,
-			SourceURL:     summary.SourceURL,
+			FeedVersion:           summary.FeedVersion,
+			StopsImported:         summary.StopsImported,
+			RoutesImported:        summary.RoutesImported,
+			TripsImported:         summary.TripsImported,
+			StopTimesImported:     summary.StopTimesImported,
+			CalendarsImported:     summary.CalendarsImported,
+			CalendarDatesImported: summary.CalendarDatesImported,
+			ShapePointsImported:   summary.ShapePointsImported,
+			FrequenciesImported:   summary.FrequenciesImported,
+			TransfersImported:     summary.TransfersImported,
+			DownloadedAt:          summary.DownloadedAt,
+			SourceURL:             summary.SourceURL,
+			FeedID:                summary.FeedID,
+			Skipped:               summary.Skipped,
+			ChangedFiles:          summary.ChangedFiles,
+			Changes: models.GTFSChangeReport{
+				Stops:                   models.GTFSChangeSet(summary.Changes.Stops),
+				Routes:                  models.GTFSChangeSet(summary.Changes.Routes),
+				Trips:                   models.GTFSChangeSet(summary.Changes.Trips),
+				StopTimesTripsRewritten: summary.Changes.StopTimesTripsRewritten,
+			},
 		},
 	}
+	if v := summary.Validation; v != nil {
+		resp.Summary.Validation = &models.GTFSValidationSummary{
+			Valid:        v.Valid,
+			ErrorCount:   v.ErrorCount,
+			WarningCount: v.WarningCount,
+			Counts:       v.Counts,
+		}
+	}
 	return c.Status(fiber.StatusOK).JSON(resp)
 }
 
 // GetNearbyStops returns stops close to a coordinate using the imported GTFS data.
 func GetNearbyStops(c *fiber.Ctx) error {
-	if dbConn == nil {
+	store := getRepos()
+	if store == nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "database not ready"})
 	}
 
@@ -92,22 +136,13 @@ func GetNearbyStops(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	rows, err := dbConn.QueryContext(ctx, `
-        SELECT stop_id, code, name, description, latitude, longitude, zone_id, wheelchair_boarding
-        FROM gtfs_stops
-        WHERE latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?
-    `, minLat, maxLat, minLon, maxLon)
+	candidates, err := store.Stops.InBoundingBox(ctx, repository.BoundingBox{MinLat: minLat, MaxLat: maxLat, MinLon: minLon, MaxLon: maxLon})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "no se pudo consultar las paradas"})
 	}
-	defer rows.Close()
 
 	stops := make([]models.Stop, 0)
-	for rows.Next() {
-		var stop models.Stop
-		if err := rows.Scan(&stop.StopID, &stop.Code, &stop.Name, &stop.Description, &stop.Latitude, &stop.Longitude, &stop.ZoneID, &stop.WheelchairBoarding); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "error leyendo resultados"})
-		}
+	for _, stop := range candidates {
 		distance := haversineMeters(lat, lon, stop.Latitude, stop.Longitude)
 		if distance <= radius {
 			stop.DistanceMeters = distance
@@ -160,7 +195,8 @@ func degreesToRadians(deg float64) float64 {
 
 // GetStopByCode busca un paradero por su código (ej: "PC1237")
 func GetStopByCode(c *fiber.Ctx) error {
-	if dbConn == nil {
+	store := getRepos()
+	if store == nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "database not ready"})
 	}
 
@@ -172,20 +208,15 @@ func GetStopByCode(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var stop models.Stop
-	err := dbConn.QueryRowContext(ctx, `
-		SELECT stop_id, code, name, description, latitude, longitude, zone_id, wheelchair_boarding
-		FROM gtfs_stops
-		WHERE UPPER(stop_id) = ? OR UPPER(code) = ?
-		LIMIT 1
-	`, code, code).Scan(&stop.StopID, &stop.Code, &stop.Name, &stop.Description, 
-		&stop.Latitude, &stop.Longitude, &stop.ZoneID, &stop.WheelchairBoarding)
-
-	if err != nil {
+	stop, err := store.Stops.ByCode(ctx, code)
+	if errors.Is(err, repository.ErrNotFound) {
 		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
 			Error: "paradero no encontrado con código: " + code,
 		})
 	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "no se pudo consultar el paradero"})
+	}
 
 	return c.Status(fiber.StatusOK).JSON(stop)
 }
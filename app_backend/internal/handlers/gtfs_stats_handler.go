@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/gtfs"
 )
 
 // GTFSStatsHandler maneja estadísticas del sistema GTFS
@@ -25,6 +27,13 @@ func NewGTFSStatsHandler(db *sql.DB) *GTFSStatsHandler {
 	}
 }
 
+// ClearCache fuerza a que la próxima consulta lea las estadísticas desde la DB
+func (h *GTFSStatsHandler) ClearCache() {
+	h.cacheMutex.Lock()
+	h.cache = nil
+	h.cacheMutex.Unlock()
+}
+
 // GTFSStats representa las estadísticas completas del sistema GTFS
 type GTFSStats struct {
 	LastSync      *GTFSFeedInfo `json:"lastSync"`
@@ -36,6 +45,9 @@ type GTFSStats struct {
 	TotalDistance float64       `json:"totalDistance"` // km (estimado)
 	Coverage      *Coverage     `json:"coverage"`
 	CachedAt      time.Time     `json:"cachedAt"`      // Cuándo se consultó la DB
+
+	// Reporte del validador del último feed procesado (puede ser uno rechazado, distinto de lastSync)
+	LatestValidation *gtfs.ValidationReport `json:"latestValidation,omitempty"`
 }
 
 // GTFSFeedInfo representa información del último feed sincronizado
@@ -44,6 +56,8 @@ type GTFSFeedInfo struct {
 	SourceURL    string    `json:"sourceUrl"`
 	FeedVersion  string    `json:"feedVersion"`
 	ImportedAt   time.Time `json:"importedAt"`
+	Status       string    `json:"status,omitempty"` // Estado de la generación (active, retired, ...)
+	Validation   *gtfs.ValidationReport `json:"validation,omitempty"`
 	StopsCount   int       `json:"stopsCount"`
 	RoutesCount  int       `json:"routesCount"`
 	TripsCount   int       `json:"tripsCount"`
@@ -91,14 +105,15 @@ func (h *GTFSStatsHandler) fetchStatsFromDB() GTFSStats {
 		CachedAt: time.Now(),
 	}
 
-	// Obtener información del último feed
+	// Obtener información de la generación activa (o del último feed si aún no hay generaciones)
 	var feedInfo GTFSFeedInfo
 	err := h.db.QueryRow(`
-		SELECT id, source_url, feed_version, imported_at
-		FROM gtfs_feeds
-		ORDER BY imported_at DESC
+		SELECT f.id, f.source_url, COALESCE(f.feed_version, ''), f.downloaded_at, COALESCE(g.status, '')
+		FROM gtfs_feeds f
+		LEFT JOIN gtfs_generations g ON g.feed_id = f.id
+		ORDER BY (g.status = 'active') DESC, f.downloaded_at DESC
 		LIMIT 1
-	`).Scan(&feedInfo.ID, &feedInfo.SourceURL, &feedInfo.FeedVersion, &feedInfo.ImportedAt)
+	`).Scan(&feedInfo.ID, &feedInfo.SourceURL, &feedInfo.FeedVersion, &feedInfo.ImportedAt, &feedInfo.Status)
 
 	if err != nil && err != sql.ErrNoRows {
 		// Error de BD, pero continuamos con valores vacíos
@@ -111,9 +126,18 @@ func (h *GTFSStatsHandler) fetchStatsFromDB() GTFSStats {
 		h.db.QueryRow("SELECT COUNT(*) FROM gtfs_routes WHERE feed_id = ?", feedInfo.ID).Scan(&feedInfo.RoutesCount)
 		h.db.QueryRow("SELECT COUNT(*) FROM gtfs_trips WHERE feed_id = ?", feedInfo.ID).Scan(&feedInfo.TripsCount)
 		h.db.QueryRow("SELECT COUNT(*) FROM gtfs_stop_times WHERE feed_id = ?", feedInfo.ID).Scan(&feedInfo.TimesCount)
+
+		if report, err := gtfs.LoadValidationReport(context.Background(), h.db, feedInfo.ID); err == nil {
+			feedInfo.Validation = report
+		}
+	}
+	if report, err := gtfs.LatestValidationReport(context.Background(), h.db); err == nil && report != nil {
+		if stats.LastSync == nil || report.FeedID != stats.LastSync.ID {
+			stats.LatestValidation = report
+		}
 	}
 
-	// Totales generales (todas las versiones) - ignorar errores si las tablas no existen
+	// Totales de las tablas activas - ignorar errores si las tablas no existen
 	h.db.QueryRow("SELECT COUNT(*) FROM gtfs_stops").Scan(&stats.Stops)
 	h.db.QueryRow("SELECT COUNT(*) FROM gtfs_routes").Scan(&stats.Routes)
 	h.db.QueryRow("SELECT COUNT(*) FROM gtfs_trips").Scan(&stats.Trips)
@@ -1,19 +1,37 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
+	"errors"
+	"log"
 	"math"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/middleware"
 	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/notifications"
+	"github.com/yourorg/wayfindcl/internal/repository"
 )
 
+// recentIncidentsWindow es la ventana de "incidentes recientes"
+const recentIncidentsWindow = 24 * time.Hour
+
 type IncidentHandler struct {
-	db *sql.DB
+	incidents    repository.IncidentRepository
+	alerts       *notifications.IncidentAlerts // nil = sin avisos a suscriptores
+	voting       incidentVotingConfig
+	resolveAfter int // Confirmaciones "ya no está" para resolver un incidente
 }
 
-func NewIncidentHandler(db *sql.DB) *IncidentHandler {
-	return &IncidentHandler{db: db}
+func NewIncidentHandler(incidents repository.IncidentRepository, alerts *notifications.IncidentAlerts) *IncidentHandler {
+	return &IncidentHandler{
+		incidents:    incidents,
+		alerts:       alerts,
+		voting:       loadIncidentVotingConfig(),
+		resolveAfter: incidentResolveConfirmations(),
+	}
 }
 
 // CreateIncident crea un nuevo incidente
@@ -24,39 +42,45 @@ func (h *IncidentHandler) CreateIncident(c *fiber.Ctx) error {
 			"error": "Invalid request body",
 		})
 	}
+	if !req.Type.Valid() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid incident type",
+		})
+	}
+	if !req.Severity.Valid() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid incident severity",
+		})
+	}
 
 	// Obtener ID del usuario desde el contexto (agregado por middleware de auth)
-	userID := c.Locals("userID")
-	if userID == nil {
-		userID = "anonymous"
-	}
-
-	// Insertar incidente
-	query := `
-		INSERT INTO incidents (
-			type, latitude, longitude, severity, reporter_id,
-			route_name, stop_name, description, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())
-	`
-
-	result, err := h.db.Exec(
-		query,
-		req.Type,
-		req.Latitude,
-		req.Longitude,
-		req.Severity,
-		userID,
-		req.RouteName,
-		req.StopName,
-		req.Description,
-	)
+	reporterID := "anonymous"
+	if userID, ok := middleware.UserIDFromCtx(c); ok {
+		reporterID = strconv.FormatInt(userID, 10)
+	}
+
+	incident := &models.Incident{
+		Type:        req.Type,
+		Latitude:    req.Latitude,
+		Longitude:   req.Longitude,
+		Severity:    req.Severity,
+		ReporterID:  reporterID,
+		RouteName:   req.RouteName,
+		StopName:    req.StopName,
+		Description: req.Description,
+	}
+	incidentID, err := h.incidents.Create(c.UserContext(), incident)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create incident",
 		})
 	}
+	incident.ID = incidentID
 
-	incidentID, _ := result.LastInsertId()
+	// Avisar a los suscritos sin demorar la respuesta
+	if h.alerts != nil {
+		go notifyIncidentSubscribers(h.alerts, *incident)
+	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message":     "Incident reported successfully",
@@ -64,6 +88,20 @@ func (h *IncidentHandler) CreateIncident(c *fiber.Ctx) error {
 	})
 }
 
+// notifyIncidentSubscribers avisa a los usuarios suscritos a la ruta, paradero o zona del incidente
+func notifyIncidentSubscribers(alerts *notifications.IncidentAlerts, incident models.Incident) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	notified, err := alerts.IncidentCreated(ctx, &incident)
+	if err != nil {
+		log.Printf("⚠️  [INCIDENTS] Error notificando incidente %d: %v", incident.ID, err)
+	}
+	if notified > 0 {
+		log.Printf("🔔 [INCIDENTS] Incidente %d notificado a %d usuarios", incident.ID, notified)
+	}
+}
+
 // GetNearbyIncidents obtiene incidentes cercanos a una ubicación
 func (h *IncidentHandler) GetNearbyIncidents(c *fiber.Ctx) error {
 	lat := c.QueryFloat("lat", 0)
@@ -81,61 +119,28 @@ func (h *IncidentHandler) GetNearbyIncidents(c *fiber.Ctx) error {
 	latDelta := radiusKm / 111.0 // Aproximadamente 111km por grado de latitud
 	lonDelta := radiusKm / (111.0 * math.Cos(lat*math.Pi/180.0))
 
-	query := `
-		SELECT 
-			id, type, latitude, longitude, severity, reporter_id,
-			route_name, stop_name, description, is_verified,
-			upvotes, downvotes, created_at, updated_at
-		FROM incidents
-		WHERE 
-			latitude BETWEEN ? AND ?
-			AND longitude BETWEEN ? AND ?
-	`
-
-	args := []interface{}{
-		lat - latDelta,
-		lat + latDelta,
-		lon - lonDelta,
-		lon + lonDelta,
+	filter := repository.IncidentFilter{
+		Box: &repository.BoundingBox{
+			MinLat: lat - latDelta,
+			MaxLat: lat + latDelta,
+			MinLon: lon - lonDelta,
+			MaxLon: lon + lonDelta,
+		},
+		Limit: 100,
 	}
-
 	if onlyRecent {
-		query += " AND created_at > DATE_SUB(NOW(), INTERVAL 24 HOUR)"
+		filter.Within = recentIncidentsWindow
 	}
 
-	query += " ORDER BY created_at DESC LIMIT 100"
-
-	rows, err := h.db.Query(query, args...)
+	candidates, err := h.incidents.List(c.UserContext(), filter)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch incidents",
 		})
 	}
-	defer rows.Close()
 
 	incidents := []models.Incident{}
-	for rows.Next() {
-		var incident models.Incident
-		err := rows.Scan(
-			&incident.ID,
-			&incident.Type,
-			&incident.Latitude,
-			&incident.Longitude,
-			&incident.Severity,
-			&incident.ReporterID,
-			&incident.RouteName,
-			&incident.StopName,
-			&incident.Description,
-			&incident.IsVerified,
-			&incident.Upvotes,
-			&incident.Downvotes,
-			&incident.CreatedAt,
-			&incident.UpdatedAt,
-		)
-		if err != nil {
-			continue
-		}
-
+	for _, incident := range candidates {
 		// Calcular distancia exacta
 		distance := calculateDistance(lat, lon, incident.Latitude, incident.Longitude)
 		if distance <= radiusKm {
@@ -151,36 +156,15 @@ func (h *IncidentHandler) GetNearbyIncidents(c *fiber.Ctx) error {
 
 // GetIncidentByID obtiene un incidente específico
 func (h *IncidentHandler) GetIncidentByID(c *fiber.Ctx) error {
-	id := c.Params("id")
-
-	query := `
-		SELECT 
-			id, type, latitude, longitude, severity, reporter_id,
-			route_name, stop_name, description, is_verified,
-			upvotes, downvotes, created_at, updated_at
-		FROM incidents
-		WHERE id = ?
-	`
-
-	var incident models.Incident
-	err := h.db.QueryRow(query, id).Scan(
-		&incident.ID,
-		&incident.Type,
-		&incident.Latitude,
-		&incident.Longitude,
-		&incident.Severity,
-		&incident.ReporterID,
-		&incident.RouteName,
-		&incident.StopName,
-		&incident.Description,
-		&incident.IsVerified,
-		&incident.Upvotes,
-		&incident.Downvotes,
-		&incident.CreatedAt,
-		&incident.UpdatedAt,
-	)
-
-	if err == sql.ErrNoRows {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Incident not found",
+		})
+	}
+
+	incident, err := h.incidents.Get(c.UserContext(), id)
+	if errors.Is(err, repository.ErrNotFound) {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Incident not found",
 		})
@@ -195,9 +179,15 @@ func (h *IncidentHandler) GetIncidentByID(c *fiber.Ctx) error {
 	return c.JSON(incident)
 }
 
-// VoteIncident vota por un incidente (upvote/downvote)
+// VoteIncident vota por un incidente (upvote/downvote). Cada usuario o
+// dispositivo tiene un solo voto: puede cambiarlo pero no repetirlo.
 func (h *IncidentHandler) VoteIncident(c *fiber.Ctx) error {
-	id := c.Params("id")
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Incident not found",
+		})
+	}
 
 	var req models.IncidentVoteRequest
 	if err := c.BodyParser(&req); err != nil {
@@ -206,29 +196,76 @@ func (h *IncidentHandler) VoteIncident(c *fiber.Ctx) error {
 		})
 	}
 
-	var query string
-	if req.VoteType == "upvote" {
-		query = "UPDATE incidents SET upvotes = upvotes + 1, updated_at = NOW() WHERE id = ?"
-	} else {
-		query = "UPDATE incidents SET downvotes = downvotes + 1, updated_at = NOW() WHERE id = ?"
+	vote, ok := parseVote(req.VoteType)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "vote_type must be 'upvote' or 'downvote'",
+		})
 	}
 
-	result, err := h.db.Exec(query, id)
+	incident, err := h.incidents.Get(c.UserContext(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Incident not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch incident",
+		})
+	}
+
+	// No se puede votar el propio reporte
+	if userID, ok := middleware.UserIDFromCtx(c); ok && incident.ReporterID == strconv.FormatInt(userID, 10) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Cannot vote on your own incident",
+		})
+	}
+
+	key, weight, err := h.voterFor(c, req.DeviceID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to vote",
 		})
 	}
+	if key == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Authentication or device_id (X-Device-ID) required to vote",
+		})
+	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	updated, changes, err := h.incidents.CastVote(c.UserContext(), models.IncidentVote{
+		IncidentID: id,
+		VoterKey:   key,
+		Vote:       vote,
+		Weight:     weight,
+	}, h.voting.thresholds)
+	if errors.Is(err, repository.ErrNotFound) {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Incident not found",
 		})
 	}
+	if errors.Is(err, repository.ErrDuplicate) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "You already cast this vote",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to vote",
+		})
+	}
 
 	return c.JSON(fiber.Map{
-		"message": "Vote registered successfully",
+		"message":        "Vote registered successfully",
+		"incident_id":    updated.ID,
+		"upvotes":        updated.Upvotes,
+		"downvotes":      updated.Downvotes,
+		"weighted_score": updated.WeightedScore,
+		"vote_weight":    weight,
+		"is_verified":    updated.IsVerified,
+		"is_hidden":      updated.IsHidden,
+		"moderation":     changes,
 	})
 }
 
@@ -241,50 +278,16 @@ func (h *IncidentHandler) GetIncidentsByRoute(c *fiber.Ctx) error {
 		})
 	}
 
-	query := `
-		SELECT 
-			id, type, latitude, longitude, severity, reporter_id,
-			route_name, stop_name, description, is_verified,
-			upvotes, downvotes, created_at, updated_at
-		FROM incidents
-		WHERE route_name = ?
-		AND created_at > DATE_SUB(NOW(), INTERVAL 24 HOUR)
-		ORDER BY created_at DESC
-		LIMIT 50
-	`
-
-	rows, err := h.db.Query(query, routeName)
+	incidents, err := h.incidents.List(c.UserContext(), repository.IncidentFilter{
+		RouteName: routeName,
+		Within:    recentIncidentsWindow,
+		Limit:     50,
+	})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch incidents",
 		})
 	}
-	defer rows.Close()
-
-	incidents := []models.Incident{}
-	for rows.Next() {
-		var incident models.Incident
-		err := rows.Scan(
-			&incident.ID,
-			&incident.Type,
-			&incident.Latitude,
-			&incident.Longitude,
-			&incident.Severity,
-			&incident.ReporterID,
-			&incident.RouteName,
-			&incident.StopName,
-			&incident.Description,
-			&incident.IsVerified,
-			&incident.Upvotes,
-			&incident.Downvotes,
-			&incident.CreatedAt,
-			&incident.UpdatedAt,
-		)
-		if err != nil {
-			continue
-		}
-		incidents = append(incidents, incident)
-	}
 
 	return c.JSON(fiber.Map{
 		"incidents": incidents,
@@ -294,58 +297,13 @@ func (h *IncidentHandler) GetIncidentsByRoute(c *fiber.Ctx) error {
 
 // GetIncidentStats obtiene estadísticas de incidentes
 func (h *IncidentHandler) GetIncidentStats(c *fiber.Ctx) error {
-	stats := models.IncidentStats{
-		ByType:     make(map[models.IncidentType]int),
-		BySeverity: make(map[models.IncidentSeverity]int),
-	}
-
-	// Total de incidentes
-	err := h.db.QueryRow("SELECT COUNT(*) FROM incidents").Scan(&stats.TotalIncidents)
+	stats, err := h.incidents.Stats(c.UserContext())
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch stats",
 		})
 	}
 
-	// Por tipo
-	rows, _ := h.db.Query("SELECT type, COUNT(*) FROM incidents GROUP BY type")
-	defer rows.Close()
-	for rows.Next() {
-		var incType models.IncidentType
-		var count int
-		rows.Scan(&incType, &count)
-		stats.ByType[incType] = count
-	}
-
-	// Por severidad
-	rows, _ = h.db.Query("SELECT severity, COUNT(*) FROM incidents GROUP BY severity")
-	for rows.Next() {
-		var severity models.IncidentSeverity
-		var count int
-		rows.Scan(&severity, &count)
-		stats.BySeverity[severity] = count
-	}
-	rows.Close()
-
-	// Verificados
-	h.db.QueryRow("SELECT COUNT(*) FROM incidents WHERE is_verified = true").Scan(&stats.VerifiedCount)
-
-	// Últimas 24 horas
-	h.db.QueryRow("SELECT COUNT(*) FROM incidents WHERE created_at > DATE_SUB(NOW(), INTERVAL 24 HOUR)").Scan(&stats.Last24Hours)
-
-	// Ruta más reportada
-	var mostReported string
-	err = h.db.QueryRow(`
-		SELECT route_name FROM incidents 
-		WHERE route_name IS NOT NULL 
-		GROUP BY route_name 
-		ORDER BY COUNT(*) DESC 
-		LIMIT 1
-	`).Scan(&mostReported)
-	if err == nil {
-		stats.MostReportedRoute = &mostReported
-	}
-
 	return c.JSON(stats)
 }
 
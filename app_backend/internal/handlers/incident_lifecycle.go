@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/middleware"
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/repository"
+)
+
+// Valores por defecto del ciclo de vida de incidentes
+const (
+	defaultIncidentResolveConfirmations = 2
+	defaultIncidentSweepInterval        = 5 * time.Minute
+)
+
+// incidentResolveConfirmations lee INCIDENT_RESOLVE_CONFIRMATIONS: cuántos
+// votantes distintos deben decir "ya no está" para resolver un incidente
+func incidentResolveConfirmations() int {
+	raw := strings.TrimSpace(os.Getenv("INCIDENT_RESOLVE_CONFIRMATIONS"))
+	if raw == "" {
+		return defaultIncidentResolveConfirmations
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		log.Printf("⚠️  INCIDENT_RESOLVE_CONFIRMATIONS inválido (%q), usando %d", raw, defaultIncidentResolveConfirmations)
+		return defaultIncidentResolveConfirmations
+	}
+	return n
+}
+
+// incidentSweepInterval lee INCIDENT_SWEEP_INTERVAL (ej: "5m"); "0" desactiva el barrido
+func incidentSweepInterval() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("INCIDENT_SWEEP_INTERVAL"))
+	if raw == "" {
+		return defaultIncidentSweepInterval
+	}
+	if raw == "0" {
+		return 0
+	}
+	dur, err := time.ParseDuration(raw)
+	if err != nil || dur < 0 {
+		log.Printf("⚠️  INCIDENT_SWEEP_INTERVAL inválido (%q), usando %s", raw, defaultIncidentSweepInterval)
+		return defaultIncidentSweepInterval
+	}
+	return dur
+}
+
+// startIncidentSweeper marca como expirados los incidentes vencidos al iniciar
+// y luego cada interval. Los listados ya excluyen los vencidos; el barrido
+// mantiene consistente la columna status.
+func startIncidentSweeper(incidents repository.IncidentRepository, interval time.Duration) {
+	sweepIncidents(incidents)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		sweepIncidents(incidents)
+	}
+}
+
+func sweepIncidents(incidents repository.IncidentRepository) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	expired, err := incidents.ExpireDue(ctx)
+	if err != nil {
+		log.Printf("⚠️  [INCIDENTS] Error expirando incidentes: %v", err)
+		return
+	}
+	if expired > 0 {
+		log.Printf("🧹 [INCIDENTS] %d incidentes expirados", expired)
+	}
+}
+
+// ConfirmIncident registra si un incidente sigue ahí: "sigue ahí" extiende su
+// vigencia por el TTL del tipo; "ya no está" lo resuelve cuando suficientes
+// votantes lo confirman y superan a los que dicen que sigue (al reportero le
+// basta su propia confirmación)
+func (h *IncidentHandler) ConfirmIncident(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Incident not found",
+		})
+	}
+
+	var req models.IncidentConfirmRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.StillThere == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "still_there is required",
+		})
+	}
+
+	key := voterKey(c, req.DeviceID)
+	if key == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Authentication or device_id (X-Device-ID) required to confirm",
+		})
+	}
+
+	incident, err := h.incidents.Get(c.UserContext(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Incident not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch incident",
+		})
+	}
+
+	resolveAfter := h.resolveAfter
+	if userID, ok := middleware.UserIDFromCtx(c); ok && incident.ReporterID == strconv.FormatInt(userID, 10) {
+		resolveAfter = 1
+	}
+
+	result, err := h.incidents.Confirm(c.UserContext(), models.IncidentConfirmation{
+		IncidentID: id,
+		VoterKey:   key,
+		StillThere: *req.StillThere,
+	}, resolveAfter)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Incident not found",
+		})
+	}
+	if errors.Is(err, repository.ErrInactive) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Incident is no longer active",
+		})
+	}
+	if errors.Is(err, repository.ErrDuplicate) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "You already confirmed this",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to confirm incident",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":     "Confirmation registered successfully",
+		"incident_id": result.Incident.ID,
+		"status":      result.Incident.Status,
+		"expires_at":  result.Incident.ExpiresAt,
+		"resolved_at": result.Incident.ResolvedAt,
+		"still_there": result.StillThere,
+		"gone":        result.Gone,
+	})
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/middleware"
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/repository"
+)
+
+// Valores por defecto de la moderación automática de incidentes
+const (
+	defaultIncidentVerifyThreshold = 3.0
+	defaultIncidentHideThreshold   = 3.0
+	defaultIncidentDeviceWeight    = 0.5
+	// defaultIncidentDeviceMaxScore deja a los votos anónimos bajo los umbrales:
+	// solos no verifican ni ocultan un incidente
+	defaultIncidentDeviceMaxScore = 1.0
+
+	// maxDeviceIDLength deja espacio al prefijo "device:" en voter_key (120)
+	maxDeviceIDLength = 100
+)
+
+// incidentVotingConfig controla el peso de los votos y los umbrales de moderación
+type incidentVotingConfig struct {
+	thresholds   repository.ModerationThresholds
+	deviceWeight float64 // Peso de los votos anónimos (por dispositivo)
+}
+
+// loadIncidentVotingConfig lee INCIDENT_VERIFY_THRESHOLD, INCIDENT_HIDE_THRESHOLD,
+// INCIDENT_DEVICE_VOTE_WEIGHT e INCIDENT_DEVICE_MAX_SCORE; valores inválidos
+// usan el defecto
+func loadIncidentVotingConfig() incidentVotingConfig {
+	return incidentVotingConfig{
+		thresholds: repository.ModerationThresholds{
+			Verify:         envPositiveFloat("INCIDENT_VERIFY_THRESHOLD", defaultIncidentVerifyThreshold),
+			Hide:           envPositiveFloat("INCIDENT_HIDE_THRESHOLD", defaultIncidentHideThreshold),
+			MaxDeviceScore: envPositiveFloat("INCIDENT_DEVICE_MAX_SCORE", defaultIncidentDeviceMaxScore),
+		},
+		deviceWeight: envPositiveFloat("INCIDENT_DEVICE_VOTE_WEIGHT", defaultIncidentDeviceWeight),
+	}
+}
+
+func envPositiveFloat(key string, fallback float64) float64 {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || value <= 0 {
+		log.Printf("⚠️  %s inválido (%q), usando %.2f", key, raw, fallback)
+		return fallback
+	}
+	return value
+}
+
+// reputationScore es la proporción suavizada de votos positivos recibidos por
+// los reportes del usuario: 0.5 sin historial, los reportes verificados suman
+// como dos upvotes y los ocultados como dos downvotes
+func reputationScore(rep *models.ReporterReputation) float64 {
+	positive := float64(rep.Upvotes+2*rep.Verified) + 1
+	total := float64(rep.Upvotes+rep.Downvotes+2*rep.Verified+2*rep.Hidden) + 2
+	return positive / total
+}
+
+// withReputationWeight completa Score y VoteWeight (0.5 - 1.5)
+func withReputationWeight(rep *models.ReporterReputation) *models.ReporterReputation {
+	rep.Score = reputationScore(rep)
+	rep.VoteWeight = 0.5 + rep.Score
+	return rep
+}
+
+// parseVote traduce vote_type a +1/-1
+func parseVote(voteType string) (int, bool) {
+	switch strings.ToLower(strings.TrimSpace(voteType)) {
+	case "upvote":
+		return 1, true
+	case "downvote":
+		return -1, true
+	}
+	return 0, false
+}
+
+// GetIncidentAudit retorna los cambios de verificación/visibilidad del incidente
+func (h *IncidentHandler) GetIncidentAudit(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Incident not found",
+		})
+	}
+
+	incident, err := h.incidents.Get(c.UserContext(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Incident not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch incident",
+		})
+	}
+
+	entries, err := h.incidents.ModerationLog(c.UserContext(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch audit log",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"incident_id":    incident.ID,
+		"is_verified":    incident.IsVerified,
+		"is_hidden":      incident.IsHidden,
+		"weighted_score": incident.WeightedScore,
+		"entries":        entries,
+		"count":          len(entries),
+	})
+}
+
+// GetReporterReputation retorna la reputación de un usuario como reportero
+func (h *IncidentHandler) GetReporterReputation(c *fiber.Ctx) error {
+	reporterID := strings.TrimSpace(c.Params("reporterId"))
+	if reporterID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "reporterId is required",
+		})
+	}
+
+	rep, err := h.incidents.Reputation(c.UserContext(), reporterID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch reputation",
+		})
+	}
+
+	return c.JSON(withReputationWeight(rep))
+}
+
+// voterFor identifica al votante y el peso de su voto: el usuario autenticado
+// (según su reputación) o, para votos anónimos, el dispositivo. Retorna key
+// vacía si no hay cómo identificarlo.
+func (h *IncidentHandler) voterFor(c *fiber.Ctx, deviceID string) (string, float64, error) {
+	key := voterKey(c, deviceID)
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
+		return key, h.voting.deviceWeight, nil
+	}
+
+	rep, err := h.incidents.Reputation(c.UserContext(), strconv.FormatInt(userID, 10))
+	if err != nil {
+		return "", 0, err
+	}
+	return key, withReputationWeight(rep).VoteWeight, nil
+}
+
+// voterKey identifica a quien vota o confirma: "user:<id>" si está autenticado,
+// si no "device:<id>" con el device_id del body o del header X-Device-ID.
+// Retorna "" si no hay cómo identificarlo.
+func voterKey(c *fiber.Ctx, deviceID string) string {
+	if userID, ok := middleware.UserIDFromCtx(c); ok {
+		return "user:" + strconv.FormatInt(userID, 10)
+	}
+
+	deviceID = strings.TrimSpace(deviceID)
+	if deviceID == "" {
+		deviceID = strings.TrimSpace(c.Get("X-Device-ID"))
+	}
+	if deviceID == "" || len(deviceID) > maxDeviceIDLength {
+		return ""
+	}
+	return repository.DeviceVoterPrefix + deviceID
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/middleware"
+	"github.com/yourorg/wayfindcl/internal/models"
+)
+
+// newIncidentTestApp monta las rutas de incidentes como en routes.Register
+func newIncidentTestApp() *fiber.App {
+	app := newAuthTestApp()
+	incidents := NewIncidentHandler(testStore.Incidents, nil)
+	group := app.Group("/api/incidents", middleware.OptionalAuth(JWTSecret))
+	group.Post("/", incidents.CreateIncident)
+	group.Get("/nearby", incidents.GetNearbyIncidents)
+	group.Get("/:id", incidents.GetIncidentByID)
+	group.Put("/:id/vote", incidents.VoteIncident)
+	return app
+}
+
+func TestCreateIncidentReporter(t *testing.T) {
+	app := newIncidentTestApp()
+	reporter := registerUser(t, app, "reportero")
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"anónimo", "", "anonymous"},
+		{"autenticado", reporter.Token, fmt.Sprint(reporter.User.ID)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created struct {
+				IncidentID int64 `json:"incident_id"`
+			}
+			status := doJSON(t, app, fiber.MethodPost, "/api/incidents/", tt.token, models.IncidentCreateRequest{
+				Type:      models.IncidentBusFull,
+				Latitude:  -33.4372,
+				Longitude: -70.6506,
+				Severity:  models.SeverityLow,
+			}, &created)
+			if status != fiber.StatusCreated {
+				t.Fatalf("crear: status %d, want 201", status)
+			}
+
+			var incident models.Incident
+			path := fmt.Sprintf("/api/incidents/%d", created.IncidentID)
+			if status := doJSON(t, app, fiber.MethodGet, path, "", nil, &incident); status != fiber.StatusOK {
+				t.Fatalf("leer: status %d, want 200", status)
+			}
+			if incident.ReporterID != tt.want {
+				t.Errorf("reporter_id %q, want %q", incident.ReporterID, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateIncidentValidation(t *testing.T) {
+	app := newIncidentTestApp()
+
+	tests := []struct {
+		name     string
+		typ      models.IncidentType
+		severity models.IncidentSeverity
+		want     int
+	}{
+		{"válido", models.IncidentStopDamaged, models.SeverityCritical, fiber.StatusCreated},
+		{"tipo desconocido", "bus_on_fire", models.SeverityLow, fiber.StatusBadRequest},
+		{"sin tipo", "", models.SeverityLow, fiber.StatusBadRequest},
+		{"tipo con mayúsculas", "BUS_FULL", models.SeverityLow, fiber.StatusBadRequest},
+		{"severidad desconocida", models.IncidentBusFull, "extreme", fiber.StatusBadRequest},
+		{"sin severidad", models.IncidentBusFull, "", fiber.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := doJSON(t, app, fiber.MethodPost, "/api/incidents/", "", models.IncidentCreateRequest{
+				Type:      tt.typ,
+				Latitude:  -33.4372,
+				Longitude: -70.6506,
+				Severity:  tt.severity,
+			}, nil)
+			if status != tt.want {
+				t.Errorf("status %d, want %d", status, tt.want)
+			}
+		})
+	}
+}
+
+func TestVoteIncidentOneVotePerVoter(t *testing.T) {
+	app := newIncidentTestApp()
+
+	id, err := testStore.Incidents.Create(context.Background(), &models.Incident{
+		Type:       models.IncidentBusDelayed,
+		Latitude:   -33.4489,
+		Longitude:  -70.6693,
+		Severity:   models.SeverityMedium,
+		ReporterID: "reporter-votos",
+	})
+	if err != nil {
+		t.Fatalf("crear incidente: %v", err)
+	}
+	path := fmt.Sprintf("/api/incidents/%d/vote", id)
+	voter := registerUser(t, app, "votante")
+
+	type counts struct {
+		Upvotes   int `json:"upvotes"`
+		Downvotes int `json:"downvotes"`
+	}
+	steps := []struct {
+		name   string
+		token  string
+		req    models.IncidentVoteRequest
+		want   int
+		counts *counts // Conteo esperado tras un voto aceptado
+	}{
+		{"primer voto del dispositivo", "", models.IncidentVoteRequest{VoteType: "upvote", DeviceID: "device-a"}, fiber.StatusOK, &counts{1, 0}},
+		{"mismo voto repetido", "", models.IncidentVoteRequest{VoteType: "upvote", DeviceID: "device-a"}, fiber.StatusConflict, nil},
+		{"cambio de voto", "", models.IncidentVoteRequest{VoteType: "downvote", DeviceID: "device-a"}, fiber.StatusOK, &counts{0, 1}},
+		{"cambio repetido", "", models.IncidentVoteRequest{VoteType: "downvote", DeviceID: "device-a"}, fiber.StatusConflict, nil},
+		{"otro dispositivo", "", models.IncidentVoteRequest{VoteType: "upvote", DeviceID: "device-b"}, fiber.StatusOK, &counts{1, 1}},
+		{"usuario autenticado", voter.Token, models.IncidentVoteRequest{VoteType: "upvote"}, fiber.StatusOK, &counts{2, 1}},
+		// El voto es del usuario, no del dispositivo desde el que lo emite
+		{"usuario con otro device_id", voter.Token, models.IncidentVoteRequest{VoteType: "upvote", DeviceID: "device-c"}, fiber.StatusConflict, nil},
+		{"sin identificar al votante", "", models.IncidentVoteRequest{VoteType: "upvote"}, fiber.StatusBadRequest, nil},
+		{"tipo de voto inválido", "", models.IncidentVoteRequest{VoteType: "meh", DeviceID: "device-d"}, fiber.StatusBadRequest, nil},
+	}
+	for _, step := range steps {
+		var got counts
+		status := doJSON(t, app, fiber.MethodPut, path, step.token, step.req, &got)
+		if status != step.want {
+			t.Fatalf("%s: status %d, want %d", step.name, status, step.want)
+		}
+		if step.counts != nil && got != *step.counts {
+			t.Errorf("%s: votos %+v, want %+v", step.name, got, *step.counts)
+		}
+	}
+
+	incident, err := testStore.Incidents.Get(context.Background(), id)
+	if err != nil {
+		t.Fatalf("leer incidente: %v", err)
+	}
+	if incident.Upvotes != 2 || incident.Downvotes != 1 {
+		t.Errorf("incidente guardado con %d/%d votos, want 2/1", incident.Upvotes, incident.Downvotes)
+	}
+}
+
+func TestIncidentNotFound(t *testing.T) {
+	app := newIncidentTestApp()
+
+	for _, id := range []string{"999999", "abc"} {
+		if status := doJSON(t, app, fiber.MethodGet, "/api/incidents/"+id, "", nil, nil); status != fiber.StatusNotFound {
+			t.Errorf("GET incidente %s: status %d, want 404", id, status)
+		}
+		if status := doJSON(t, app, fiber.MethodPut, "/api/incidents/"+id+"/vote", "",
+			models.IncidentVoteRequest{VoteType: "upvote", DeviceID: "device-a"}, nil); status != fiber.StatusNotFound {
+			t.Errorf("PUT voto incidente %s: status %d, want 404", id, status)
+		}
+	}
+}
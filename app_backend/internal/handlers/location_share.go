@@ -1,21 +1,26 @@
 package handlers
 
 import (
-	"database/sql"
-	"fmt"
+	"errors"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/yourorg/wayfindcl/internal/middleware"
 	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/repository"
+	"github.com/yourorg/wayfindcl/internal/validation"
 )
 
 type LocationShareHandler struct {
-	db *sql.DB
+	shares  repository.ShareRepository
+	streams *shareStreams
 }
 
-func NewLocationShareHandler(db *sql.DB) *LocationShareHandler {
-	return &LocationShareHandler{db: db}
+func NewLocationShareHandler(shares repository.ShareRepository) *LocationShareHandler {
+	return &LocationShareHandler{shares: shares, streams: newShareStreams()}
 }
 
 // CreateLocationShare crea un nuevo compartir de ubicación
@@ -28,89 +33,103 @@ func (h *LocationShareHandler) CreateLocationShare(c *fiber.Ctx) error {
 	}
 
 	// Obtener ID del usuario
-	userID := c.Locals("userID")
-	if userID == nil {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Authentication required",
 		})
 	}
 
+	pin, pinOK := normalizeSharePIN(req.PIN)
+	if !pinOK {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "pin must be 4 to 8 digits",
+		})
+	}
+
 	// Generar ID único para el compartido
 	shareID := uuid.New().String()
 	expiresAt := time.Now().Add(time.Duration(req.DurationHours) * time.Hour)
 
-	query := `
-		INSERT INTO location_shares (
-			id, user_id, latitude, longitude, recipient_name,
-			message, expires_at, is_active, created_at, last_updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, true, NOW(), NOW())
-	`
-
-	_, err := h.db.Exec(
-		query,
-		shareID,
-		userID,
-		req.Latitude,
-		req.Longitude,
-		req.RecipientName,
-		req.Message,
-		expiresAt,
-	)
+	share := &models.LocationShare{
+		ID:            shareID,
+		UserID:        userID,
+		Latitude:      req.Latitude,
+		Longitude:     req.Longitude,
+		RecipientName: req.RecipientName,
+		Message:       req.Message,
+		ExpiresAt:     expiresAt,
+	}
+	if errMsg := applyShareMonitoring(share, req); errMsg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errMsg,
+		})
+	}
+
+	if err := h.shares.Create(c.UserContext(), share); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create location share",
+		})
+	}
+
+	// La posición inicial es el primer punto del recorrido
+	point := models.SharePoint{Latitude: share.Latitude, Longitude: share.Longitude}
+	if err := h.shares.AddPoint(c.UserContext(), shareID, point, shareTrailMaxPoints); err != nil {
+		log.Printf("⚠️  Error guardando recorrido del share %s: %v", shareID, err)
+	}
+
+	// El primer receptor (recipient_name) recibe el enlace de la respuesta
+	recipient, token, err := h.issueRecipient(c.UserContext(), shareID, req.RecipientName, pin)
 	if err != nil {
+		log.Printf("❌ Error creando receptor del share %s: %v", shareID, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create location share",
 		})
 	}
 
-	// Generar URL de compartido
-	shareURL := fmt.Sprintf("wayfindcl://share/%s", shareID)
 	timeRemaining := int64(time.Until(expiresAt).Seconds())
 
 	return c.Status(fiber.StatusCreated).JSON(models.LocationShareResponse{
-		ShareURL:      shareURL,
+		ShareURL:      shareViewerURL(c, token),
 		TimeRemaining: timeRemaining,
+		RecipientID:   recipient.ID,
+		Token:         token,
 	})
 }
 
-// GetLocationShare obtiene detalles de un compartido
+// GetLocationShare obtiene detalles de un compartido del usuario. Los
+// receptores usan GET /api/shared/:token.
 func (h *LocationShareHandler) GetLocationShare(c *fiber.Ctx) error {
-	shareID := c.Params("id")
+	share, ok, err := h.ownedActiveShare(c)
+	if !ok {
+		return err
+	}
 
-	query := `
-		SELECT 
-			id, user_id, latitude, longitude, recipient_name,
-			message, expires_at, is_active, created_at, last_updated_at
-		FROM location_shares
-		WHERE id = ? AND is_active = true AND expires_at > NOW()
-	`
-
-	var share models.LocationShare
-	err := h.db.QueryRow(query, shareID).Scan(
-		&share.ID,
-		&share.UserID,
-		&share.Latitude,
-		&share.Longitude,
-		&share.RecipientName,
-		&share.Message,
-		&share.ExpiresAt,
-		&share.IsActive,
-		&share.CreatedAt,
-		&share.LastUpdatedAt,
-	)
-
-	if err == sql.ErrNoRows {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Share not found or expired",
+	return c.JSON(share)
+}
+
+// ownedActiveShare busca el share activo de la ruta y verifica que sea del
+// usuario; si no, ya escribió la respuesta de error y retorna ok=false
+func (h *LocationShareHandler) ownedActiveShare(c *fiber.Ctx) (*models.LocationShare, bool, error) {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
+		return nil, false, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Authentication required",
 		})
 	}
 
+	share, err := h.shares.GetActive(c.UserContext(), c.Params("id"))
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && share.UserID != userID) {
+		return nil, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Share not found or expired",
+		})
+	}
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		return nil, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch share",
 		})
 	}
-
-	return c.JSON(share)
+	return share, true, nil
 }
 
 // UpdateLocationShare actualiza la posición de un compartido activo
@@ -125,68 +144,116 @@ func (h *LocationShareHandler) UpdateLocationShare(c *fiber.Ctx) error {
 	}
 
 	// Verificar que el usuario sea el propietario
-	userID := c.Locals("userID")
-	if userID == nil {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Authentication required",
 		})
 	}
 
-	query := `
-		UPDATE location_shares
-		SET latitude = ?, longitude = ?, last_updated_at = NOW()
-		WHERE id = ? AND user_id = ? AND is_active = true AND expires_at > NOW()
-	`
-
-	result, err := h.db.Exec(query, req.Latitude, req.Longitude, shareID, userID)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update location",
+	pos, errMsg := sharePositionFrom(req)
+	if errMsg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errMsg,
 		})
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	share, err := h.shares.UpdatePosition(c.UserContext(), shareID, userID, pos)
+	if errors.Is(err, repository.ErrNotFound) {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Share not found or expired",
 		})
 	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update location",
+		})
+	}
+
+	h.streams.publish(share.ID, sseEvent{name: "position", data: livePosition(share)})
+	alerts := h.monitorShare(c.UserContext(), share)
 
 	return c.JSON(fiber.Map{
 		"message": "Location updated successfully",
+		"alerts":  alerts,
 	})
 }
 
+// livePosition es el share sin la ruta planificada, que no cambia entre
+// posiciones (se obtiene una vez al abrir el share), ni el user_id del dueño
+func livePosition(share *models.LocationShare) *models.LocationShare {
+	live := viewerShare(share)
+	live.PlannedRoute = nil
+	return live
+}
+
+// viewerShare es el share tal como lo ven los receptores: sin el user_id del dueño
+func viewerShare(share *models.LocationShare) *models.LocationShare {
+	view := *share
+	view.UserID = 0
+	return &view
+}
+
+// sharePositionFrom valida la actualización; retorna el mensaje de error si no es válida
+func sharePositionFrom(req models.LocationShareUpdateRequest) (models.SharePosition, string) {
+	pos := models.SharePosition{
+		Latitude:  req.Latitude,
+		Longitude: req.Longitude,
+		Heading:   req.Heading,
+		Speed:     req.Speed,
+		BusRoute:  trimmedOrNil(req.BusRoute),
+		NextStop:  trimmedOrNil(req.NextStop),
+	}
+	if err := validation.ValidateCoordinatePair(pos.Latitude, pos.Longitude, "share"); err != nil {
+		return pos, err.Error()
+	}
+	if pos.Heading != nil && (*pos.Heading < 0 || *pos.Heading >= 360) {
+		return pos, "heading must be between 0 and 360"
+	}
+	if pos.Speed != nil && *pos.Speed < 0 {
+		return pos, "speed must be positive"
+	}
+	if pos.BusRoute != nil && len(*pos.BusRoute) > 100 {
+		return pos, "bus_route is too long"
+	}
+	if pos.NextStop != nil && len(*pos.NextStop) > 255 {
+		return pos, "next_stop is too long"
+	}
+	if req.ETASeconds != nil {
+		if *req.ETASeconds < 0 {
+			return pos, "eta_seconds must be positive"
+		}
+		eta := time.Now().Add(time.Duration(*req.ETASeconds) * time.Second)
+		pos.NextStopETA = &eta
+	}
+	return pos, ""
+}
+
 // StopLocationShare detiene un compartido activo
 func (h *LocationShareHandler) StopLocationShare(c *fiber.Ctx) error {
-	shareID := c.Params("id")
+	// Copia: el id viaja en el evento "stopped" más allá de esta request
+	shareID := strings.Clone(c.Params("id"))
 
-	userID := c.Locals("userID")
-	if userID == nil {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Authentication required",
 		})
 	}
 
-	query := `
-		UPDATE location_shares
-		SET is_active = false, last_updated_at = NOW()
-		WHERE id = ? AND user_id = ?
-	`
-
-	result, err := h.db.Exec(query, shareID, userID)
+	err := h.shares.Stop(c.UserContext(), shareID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Share not found",
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to stop sharing",
 		})
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Share not found",
-		})
-	}
+	h.streams.publish(shareID, sseEvent{name: "stopped", data: fiber.Map{"share_id": shareID}, final: true})
 
 	return c.JSON(fiber.Map{
 		"message": "Sharing stopped successfully",
@@ -195,51 +262,19 @@ func (h *LocationShareHandler) StopLocationShare(c *fiber.Ctx) error {
 
 // GetUserShares obtiene todos los compartidos del usuario
 func (h *LocationShareHandler) GetUserShares(c *fiber.Ctx) error {
-	userID := c.Locals("userID")
-	if userID == nil {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Authentication required",
 		})
 	}
 
-	query := `
-		SELECT 
-			id, user_id, latitude, longitude, recipient_name,
-			message, expires_at, is_active, created_at, last_updated_at
-		FROM location_shares
-		WHERE user_id = ?
-		ORDER BY created_at DESC
-		LIMIT 50
-	`
-
-	rows, err := h.db.Query(query, userID)
+	shares, err := h.shares.ListByUser(c.UserContext(), userID, 50)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch shares",
 		})
 	}
-	defer rows.Close()
-
-	shares := []models.LocationShare{}
-	for rows.Next() {
-		var share models.LocationShare
-		err := rows.Scan(
-			&share.ID,
-			&share.UserID,
-			&share.Latitude,
-			&share.Longitude,
-			&share.RecipientName,
-			&share.Message,
-			&share.ExpiresAt,
-			&share.IsActive,
-			&share.CreatedAt,
-			&share.LastUpdatedAt,
-		)
-		if err != nil {
-			continue
-		}
-		shares = append(shares, share)
-	}
 
 	return c.JSON(fiber.Map{
 		"shares": shares,
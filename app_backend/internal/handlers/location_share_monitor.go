@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/validation"
+)
+
+const (
+	// shareTrailMaxPoints es el largo máximo del recorrido guardado por share
+	shareTrailMaxPoints = 500
+	// shareArrivalRadius es la distancia al destino que cuenta como llegada
+	shareArrivalRadius = 50.0
+	// shareStationaryRadius es cuánto puede moverse (ruido GPS) sin dejar de
+	// considerarse detenido
+	shareStationaryRadius = 30.0
+	// maxSharePlannedRoutePoints limita la ruta planificada de un share
+	maxSharePlannedRoutePoints = 5000
+
+	defaultShareDeviationThreshold = 75.0 // metros
+	defaultShareStationaryMinutes  = 10
+)
+
+// applyShareMonitoring valida destino, ruta planificada y umbrales del request
+// y los copia al share; retorna el mensaje de error si no son válidos.
+// Con destino o ruta la detención se vigila por defecto (stationary_minutes=0
+// la desactiva).
+func applyShareMonitoring(share *models.LocationShare, req models.LocationShareCreateRequest) string {
+	if req.Destination != nil {
+		if err := validation.ValidateCoordinatePair(req.Destination.Latitude, req.Destination.Longitude, "destination"); err != nil {
+			return err.Error()
+		}
+		share.DestinationLat = &req.Destination.Latitude
+		share.DestinationLon = &req.Destination.Longitude
+		share.DestinationName = trimmedOrNil(req.Destination.Name)
+		if share.DestinationName != nil && len(*share.DestinationName) > 255 {
+			return "destination name is too long"
+		}
+	}
+
+	if len(req.PlannedRoute) > 0 {
+		if len(req.PlannedRoute) < 2 || len(req.PlannedRoute) > maxSharePlannedRoutePoints {
+			return fmt.Sprintf("planned_route must have between 2 and %d points", maxSharePlannedRoutePoints)
+		}
+		for _, point := range req.PlannedRoute {
+			if len(point) != 2 {
+				return "planned_route points must be [longitude, latitude]"
+			}
+			if err := validation.ValidateCoordinatePair(point[1], point[0], "planned_route"); err != nil {
+				return err.Error()
+			}
+		}
+		share.PlannedRoute = req.PlannedRoute
+
+		threshold := defaultShareDeviationThreshold
+		if req.DeviationThresholdM != nil {
+			threshold = *req.DeviationThresholdM
+		}
+		if threshold < 20 || threshold > 2000 {
+			return "deviation_threshold_m must be between 20 and 2000"
+		}
+		share.DeviationThresholdM = &threshold
+	}
+
+	minutes := 0
+	if share.DestinationLat != nil || share.PlannedRoute != nil {
+		minutes = defaultShareStationaryMinutes
+	}
+	if req.StationaryMinutes != nil {
+		minutes = *req.StationaryMinutes
+	}
+	if minutes < 0 || minutes > 240 {
+		return "stationary_minutes must be between 0 and 240"
+	}
+	if minutes > 0 {
+		share.StationaryMinutes = &minutes
+	}
+	return ""
+}
+
+// evaluateShareAlerts compara la posición actual del share con su destino,
+// su ruta planificada y su recorrido reciente (trail, más antiguos primero,
+// incluye la posición actual). prev son las alertas ya emitidas: la llegada
+// y cada detención se avisan una sola vez, y el desvío alterna entre
+// off_route y back_on_route.
+func evaluateShareAlerts(share *models.LocationShare, trail []models.SharePoint, prev []models.ShareAlert, now time.Time) []models.ShareAlert {
+	arrived := false
+	offRoute := false
+	var lastStationary time.Time
+	for _, alert := range prev {
+		switch alert.Kind {
+		case models.ShareAlertArrived:
+			arrived = true
+		case models.ShareAlertOffRoute:
+			offRoute = true
+		case models.ShareAlertBackOnRoute:
+			offRoute = false
+		case models.ShareAlertStationary:
+			lastStationary = alert.CreatedAt
+		}
+	}
+	// Tras llegar al destino no se vigila más el recorrido
+	if arrived {
+		return nil
+	}
+
+	newAlert := func(kind models.ShareAlertKind, message string, distance *float64) models.ShareAlert {
+		return models.ShareAlert{
+			ShareID:        share.ID,
+			Kind:           kind,
+			Message:        message,
+			Latitude:       share.Latitude,
+			Longitude:      share.Longitude,
+			DistanceMeters: distance,
+		}
+	}
+	var alerts []models.ShareAlert
+
+	if share.DestinationLat != nil && share.DestinationLon != nil {
+		distance := haversineMeters(share.Latitude, share.Longitude, *share.DestinationLat, *share.DestinationLon)
+		if distance <= shareArrivalRadius {
+			message := "Llegó a destino"
+			if share.DestinationName != nil {
+				message = "Llegó a " + *share.DestinationName
+			}
+			return append(alerts, newAlert(models.ShareAlertArrived, message, roundedMeters(distance)))
+		}
+	}
+
+	if len(share.PlannedRoute) > 1 && share.DeviationThresholdM != nil {
+		distance := distanceToPolyline(share.PlannedRoute, share.Latitude, share.Longitude)
+		switch {
+		case !offRoute && distance > *share.DeviationThresholdM:
+			alerts = append(alerts, newAlert(models.ShareAlertOffRoute,
+				fmt.Sprintf("Se alejó %.0f m de la ruta planificada", distance), roundedMeters(distance)))
+		case offRoute && distance <= *share.DeviationThresholdM:
+			alerts = append(alerts, newAlert(models.ShareAlertBackOnRoute,
+				"Volvió a la ruta planificada", roundedMeters(distance)))
+		}
+	}
+
+	if share.StationaryMinutes != nil && *share.StationaryMinutes > 0 && len(trail) > 1 {
+		since := stationarySince(trail)
+		stopped := now.Sub(since)
+		// Una alerta por detención: la anterior tiene que ser de antes de que empezara
+		if stopped >= time.Duration(*share.StationaryMinutes)*time.Minute && lastStationary.Before(since) {
+			alerts = append(alerts, newAlert(models.ShareAlertStationary,
+				fmt.Sprintf("Lleva %d minutos sin moverse", int(stopped.Minutes())), nil))
+		}
+	}
+
+	return alerts
+}
+
+// stationarySince retorna desde cuándo el recorrido se mantiene dentro de
+// shareStationaryRadius alrededor del último punto
+func stationarySince(trail []models.SharePoint) time.Time {
+	last := trail[len(trail)-1]
+	since := last.RecordedAt
+	for i := len(trail) - 2; i >= 0; i-- {
+		if haversineMeters(trail[i].Latitude, trail[i].Longitude, last.Latitude, last.Longitude) > shareStationaryRadius {
+			break
+		}
+		since = trail[i].RecordedAt
+	}
+	return since
+}
+
+// distanceToPolyline calcula en metros la distancia de un punto al tramo más
+// cercano de la línea ([lon, lat]). Proyecta cada tramo en un plano local
+// (equirectangular), suficiente para las distancias de una ciudad.
+func distanceToPolyline(line [][]float64, lat, lon float64) float64 {
+	const metersPerDegree = 111320.0
+	cosLat := math.Cos(degreesToRadians(lat))
+	project := func(p []float64) (float64, float64) {
+		return (p[0] - lon) * metersPerDegree * cosLat, (p[1] - lat) * metersPerDegree
+	}
+
+	best := math.MaxFloat64
+	for i := 1; i < len(line); i++ {
+		ax, ay := project(line[i-1])
+		bx, by := project(line[i])
+		dx, dy := bx-ax, by-ay
+
+		// Punto del tramo más cercano al origen (la posición)
+		t := 0.0
+		if length := dx*dx + dy*dy; length > 0 {
+			t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/length))
+		}
+		if d := math.Hypot(ax+t*dx, ay+t*dy); d < best {
+			best = d
+		}
+	}
+	return best
+}
+
+func roundedMeters(meters float64) *float64 {
+	rounded := math.Round(meters)
+	return &rounded
+}
+
+// monitorShare guarda la posición en el recorrido y emite las alertas nuevas
+// a quienes siguen el share. Los errores sólo se registran: la posición ya
+// quedó actualizada.
+func (h *LocationShareHandler) monitorShare(ctx context.Context, share *models.LocationShare) []models.ShareAlert {
+	point := models.SharePoint{
+		Latitude:  share.Latitude,
+		Longitude: share.Longitude,
+		Heading:   share.Heading,
+		Speed:     share.Speed,
+	}
+	if err := h.shares.AddPoint(ctx, share.ID, point, shareTrailMaxPoints); err != nil {
+		log.Printf("⚠️  Error guardando recorrido del share %s: %v", share.ID, err)
+		return nil
+	}
+	if !share.Monitored() {
+		return nil
+	}
+
+	trail, err := h.shares.Trail(ctx, share.ID, shareTrailMaxPoints)
+	if err != nil {
+		log.Printf("⚠️  Error leyendo recorrido del share %s: %v", share.ID, err)
+		return nil
+	}
+	prev, err := h.shares.Alerts(ctx, share.ID)
+	if err != nil {
+		log.Printf("⚠️  Error leyendo alertas del share %s: %v", share.ID, err)
+		return nil
+	}
+
+	created := []models.ShareAlert{}
+	for _, alert := range evaluateShareAlerts(share, trail, prev, time.Now()) {
+		id, err := h.shares.AddAlert(ctx, &alert)
+		if err != nil {
+			log.Printf("⚠️  Error guardando alerta %s del share %s: %v", alert.Kind, share.ID, err)
+			continue
+		}
+		alert.ID = id
+		alert.CreatedAt = time.Now()
+		log.Printf("📍 Share %s: %s", share.ID, alert.Message)
+		h.streams.publish(share.ID, sseEvent{name: "alert", data: alert})
+		created = append(created, alert)
+	}
+	return created
+}
+
+// GetShareTrail retorna el recorrido de un share activo del usuario, más
+// antiguos primero
+func (h *LocationShareHandler) GetShareTrail(c *fiber.Ctx) error {
+	share, ok, err := h.ownedActiveShare(c)
+	if !ok {
+		return err
+	}
+
+	limit := c.QueryInt("limit", shareTrailMaxPoints)
+	if limit < 1 || limit > shareTrailMaxPoints {
+		limit = shareTrailMaxPoints
+	}
+	points, err := h.shares.Trail(c.UserContext(), share.ID, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch trail",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"share_id": share.ID,
+		"points":   points,
+		"count":    len(points),
+	})
+}
+
+// GetShareAlerts retorna las alertas emitidas por un share activo del usuario
+func (h *LocationShareHandler) GetShareAlerts(c *fiber.Ctx) error {
+	share, ok, err := h.ownedActiveShare(c)
+	if !ok {
+		return err
+	}
+
+	alerts, err := h.shares.Alerts(c.UserContext(), share.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch alerts",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"share_id": share.ID,
+		"alerts":   alerts,
+		"count":    len(alerts),
+	})
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yourorg/wayfindcl/internal/models"
+)
+
+func floatPtr(v float64) *float64 { return &v }
+func intPtr(v int) *int           { return &v }
+func stringPtr(v string) *string  { return &v }
+
+func TestEvaluateShareAlerts(t *testing.T) {
+	now := time.Date(2026, 3, 10, 18, 0, 0, 0, time.UTC)
+	const lat, lon = -33.4489, -70.6693
+
+	// still es un recorrido detenido en la posición actual desde hace d
+	still := func(d time.Duration) []models.SharePoint {
+		var trail []models.SharePoint
+		for at := now.Add(-d); !at.After(now); at = at.Add(time.Minute) {
+			trail = append(trail, models.SharePoint{Latitude: lat, Longitude: lon, RecordedAt: at})
+		}
+		return trail
+	}
+	// ~220 m al norte de la posición, paralela al eje este-oeste
+	farRoute := [][]float64{{lon - 0.01, lat + 0.002}, {lon + 0.01, lat + 0.002}}
+	// Pasa por la posición
+	nearRoute := [][]float64{{lon - 0.01, lat}, {lon + 0.01, lat}}
+	alert := func(kind models.ShareAlertKind, at time.Time) models.ShareAlert {
+		return models.ShareAlert{Kind: kind, CreatedAt: at}
+	}
+
+	tests := []struct {
+		name  string
+		share models.LocationShare
+		trail []models.SharePoint
+		prev  []models.ShareAlert
+		want  []models.ShareAlertKind
+	}{
+		{
+			name:  "sin destino, ruta ni detención",
+			share: models.LocationShare{},
+			trail: still(time.Hour),
+		},
+		{
+			name:  "llega al destino",
+			share: models.LocationShare{DestinationLat: floatPtr(lat + 0.0003), DestinationLon: floatPtr(lon), DestinationName: stringPtr("Casa")},
+			want:  []models.ShareAlertKind{models.ShareAlertArrived},
+		},
+		{
+			name:  "todavía lejos del destino",
+			share: models.LocationShare{DestinationLat: floatPtr(lat + 0.001), DestinationLon: floatPtr(lon)},
+		},
+		{
+			name: "la llegada se avisa una vez y termina la vigilancia",
+			share: models.LocationShare{
+				DestinationLat: floatPtr(lat), DestinationLon: floatPtr(lon),
+				PlannedRoute: farRoute, DeviationThresholdM: floatPtr(100),
+			},
+			prev: []models.ShareAlert{alert(models.ShareAlertArrived, now.Add(-time.Minute))},
+		},
+		{
+			name: "la llegada tiene prioridad sobre el desvío",
+			share: models.LocationShare{
+				DestinationLat: floatPtr(lat), DestinationLon: floatPtr(lon),
+				PlannedRoute: farRoute, DeviationThresholdM: floatPtr(100),
+			},
+			want: []models.ShareAlertKind{models.ShareAlertArrived},
+		},
+		{
+			name:  "se desvía de la ruta",
+			share: models.LocationShare{PlannedRoute: farRoute, DeviationThresholdM: floatPtr(100)},
+			want:  []models.ShareAlertKind{models.ShareAlertOffRoute},
+		},
+		{
+			name:  "dentro del umbral",
+			share: models.LocationShare{PlannedRoute: farRoute, DeviationThresholdM: floatPtr(500)},
+		},
+		{
+			name:  "sigue desviado: no se repite",
+			share: models.LocationShare{PlannedRoute: farRoute, DeviationThresholdM: floatPtr(100)},
+			prev:  []models.ShareAlert{alert(models.ShareAlertOffRoute, now.Add(-time.Minute))},
+		},
+		{
+			name:  "vuelve a la ruta",
+			share: models.LocationShare{PlannedRoute: nearRoute, DeviationThresholdM: floatPtr(100)},
+			prev:  []models.ShareAlert{alert(models.ShareAlertOffRoute, now.Add(-time.Minute))},
+			want:  []models.ShareAlertKind{models.ShareAlertBackOnRoute},
+		},
+		{
+			name:  "se desvía otra vez tras volver",
+			share: models.LocationShare{PlannedRoute: farRoute, DeviationThresholdM: floatPtr(100)},
+			prev: []models.ShareAlert{
+				alert(models.ShareAlertOffRoute, now.Add(-10*time.Minute)),
+				alert(models.ShareAlertBackOnRoute, now.Add(-5*time.Minute)),
+			},
+			want: []models.ShareAlertKind{models.ShareAlertOffRoute},
+		},
+		{
+			name:  "ruta de un solo punto se ignora",
+			share: models.LocationShare{PlannedRoute: farRoute[:1], DeviationThresholdM: floatPtr(100)},
+		},
+		{
+			name:  "detenido más que el umbral",
+			share: models.LocationShare{StationaryMinutes: intPtr(10)},
+			trail: still(15 * time.Minute),
+			want:  []models.ShareAlertKind{models.ShareAlertStationary},
+		},
+		{
+			name:  "detenido menos que el umbral",
+			share: models.LocationShare{StationaryMinutes: intPtr(10)},
+			trail: still(5 * time.Minute),
+		},
+		{
+			name:  "una alerta por detención",
+			share: models.LocationShare{StationaryMinutes: intPtr(10)},
+			trail: still(20 * time.Minute),
+			prev:  []models.ShareAlert{alert(models.ShareAlertStationary, now.Add(-5*time.Minute))},
+		},
+		{
+			name:  "nueva detención tras moverse",
+			share: models.LocationShare{StationaryMinutes: intPtr(10)},
+			trail: still(15 * time.Minute),
+			prev:  []models.ShareAlert{alert(models.ShareAlertStationary, now.Add(-time.Hour))},
+			want:  []models.ShareAlertKind{models.ShareAlertStationary},
+		},
+		{
+			name:  "se movió hace poco",
+			share: models.LocationShare{StationaryMinutes: intPtr(10)},
+			trail: append([]models.SharePoint{
+				{Latitude: lat + 0.01, Longitude: lon, RecordedAt: now.Add(-30 * time.Minute)},
+			}, still(3*time.Minute)...),
+		},
+		{
+			name:  "un solo punto no alcanza para saber si está detenido",
+			share: models.LocationShare{StationaryMinutes: intPtr(1)},
+			trail: []models.SharePoint{{Latitude: lat, Longitude: lon, RecordedAt: now.Add(-time.Hour)}},
+		},
+		{
+			name: "desvío y detención a la vez",
+			share: models.LocationShare{
+				PlannedRoute: farRoute, DeviationThresholdM: floatPtr(100), StationaryMinutes: intPtr(10),
+			},
+			trail: still(15 * time.Minute),
+			want:  []models.ShareAlertKind{models.ShareAlertOffRoute, models.ShareAlertStationary},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			share := tt.share
+			share.ID = "share-test"
+			share.Latitude, share.Longitude = lat, lon
+
+			alerts := evaluateShareAlerts(&share, tt.trail, tt.prev, now)
+			var kinds []models.ShareAlertKind
+			for _, a := range alerts {
+				kinds = append(kinds, a.Kind)
+				if a.ShareID != share.ID {
+					t.Errorf("alerta %s con share_id %q", a.Kind, a.ShareID)
+				}
+			}
+			if !reflect.DeepEqual(kinds, tt.want) {
+				t.Errorf("alertas %v, want %v", kinds, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateShareAlertsArrivalMessage(t *testing.T) {
+	share := &models.LocationShare{Latitude: -33.4489, Longitude: -70.6693,
+		DestinationLat: floatPtr(-33.4489), DestinationLon: floatPtr(-70.6693)}
+
+	alerts := evaluateShareAlerts(share, nil, nil, time.Now())
+	if len(alerts) != 1 || alerts[0].Message != "Llegó a destino" {
+		t.Fatalf("sin nombre de destino: %+v", alerts)
+	}
+
+	share.DestinationName = stringPtr("Metro Los Héroes")
+	alerts = evaluateShareAlerts(share, nil, nil, time.Now())
+	if len(alerts) != 1 || alerts[0].Message != "Llegó a Metro Los Héroes" {
+		t.Fatalf("con nombre de destino: %+v", alerts)
+	}
+	if alerts[0].DistanceMeters == nil || *alerts[0].DistanceMeters != 0 {
+		t.Errorf("distancia %v, want 0", alerts[0].DistanceMeters)
+	}
+}
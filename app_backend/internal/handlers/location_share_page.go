@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/repository"
+)
+
+// sharePageData alimenta la página pública /share/:token
+type sharePageData struct {
+	Notice   string // Estado sin acceso (revocado, terminado, bloqueado...)
+	AskPIN   bool
+	PINError bool
+	Token    string
+	PIN      string // El stream lo necesita en el header X-Share-PIN
+	Share    *models.LocationShare
+	Alerts   []models.ShareAlert
+}
+
+var sharePageTemplate = template.Must(template.New("share").Funcs(template.FuncMap{
+	"mapURL": func(lat, lon float64) string {
+		return fmt.Sprintf("https://www.openstreetmap.org/?mlat=%.6f&mlon=%.6f#map=17/%.6f/%.6f", lat, lon, lat, lon)
+	},
+	"iso": func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+}).Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>WayFindCL · Ubicación compartida</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 32rem; margin: 2rem auto; padding: 0 1rem; color: #111; }
+h1 { font-size: 1.3rem; }
+.card { border: 1px solid #ddd; border-radius: .75rem; padding: 1rem; margin: 1rem 0; }
+.muted { color: #666; font-size: .9rem; }
+.error { color: #b00020; }
+a.button, button { display: inline-block; padding: .6rem 1rem; border-radius: .5rem; border: 0; background: #1a56db; color: #fff; text-decoration: none; font-size: 1rem; }
+input { font-size: 1.2rem; padding: .5rem; width: 8rem; letter-spacing: .3rem; }
+ul { padding-left: 1.2rem; }
+</style>
+</head>
+<body>
+<h1>Ubicación compartida</h1>
+{{if .Notice}}
+<div class="card" role="alert"><p>{{.Notice}}</p></div>
+{{else if .AskPIN}}
+<form class="card" method="post">
+	<p><label for="pin">Esta ubicación está protegida. Ingresa el PIN que te enviaron:</label></p>
+	<p><input id="pin" name="pin" inputmode="numeric" autocomplete="off" pattern="[0-9]{4,8}" required autofocus>
+	<button type="submit">Ver</button></p>
+	{{if .PINError}}<p class="error" role="alert">PIN incorrecto.</p>{{end}}
+</form>
+{{else}}
+{{with .Share}}
+<div class="card" aria-live="polite">
+	{{if .Message}}<p>{{.Message}}</p>{{end}}
+	<p id="status">Compartiendo en vivo</p>
+	<p>Posición: <span id="coords">{{printf "%.5f, %.5f" .Latitude .Longitude}}</span></p>
+	<p id="trip">{{if .BusRoute}}En el recorrido {{.BusRoute}}{{if .NextStop}}, próxima parada {{.NextStop}}{{end}}{{end}}</p>
+	<p class="muted">Actualizado <time id="updated" datetime="{{iso .LastUpdatedAt}}">{{iso .LastUpdatedAt}}</time> · hasta <time datetime="{{iso .ExpiresAt}}">{{iso .ExpiresAt}}</time></p>
+	<p><a id="map" class="button" href="{{mapURL .Latitude .Longitude}}" target="_blank" rel="noreferrer">Ver en el mapa</a></p>
+	{{if .DestinationName}}<p class="muted">Destino: {{.DestinationName}}</p>{{end}}
+</div>
+{{end}}
+<div class="card">
+	<p>Avisos</p>
+	<ul id="alerts">{{range .Alerts}}<li><time datetime="{{iso .CreatedAt}}">{{iso .CreatedAt}}</time> · {{.Message}}</li>{{else}}<li class="muted" id="no-alerts">Sin avisos</li>{{end}}</ul>
+</div>
+<script>
+(function () {
+	var token = {{.Token}}, pin = {{.PIN}};
+	var $ = function (id) { return document.getElementById(id); };
+	function localize(el) {
+		var d = new Date(el.getAttribute('datetime'));
+		el.textContent = d.toLocaleString([], { hour: '2-digit', minute: '2-digit', day: 'numeric', month: 'short' });
+	}
+	document.querySelectorAll('time').forEach(localize);
+
+	function finish(text) { $('status').textContent = text; done = true; }
+	function handle(name, data) {
+		if (name === 'position') {
+			$('coords').textContent = data.latitude.toFixed(5) + ', ' + data.longitude.toFixed(5);
+			$('map').href = 'https://www.openstreetmap.org/?mlat=' + data.latitude + '&mlon=' + data.longitude + '#map=17/' + data.latitude + '/' + data.longitude;
+			$('trip').textContent = data.bus_route ? 'En el recorrido ' + data.bus_route + (data.next_stop ? ', próxima parada ' + data.next_stop : '') : '';
+			$('updated').setAttribute('datetime', data.last_updated_at);
+			localize($('updated'));
+		} else if (name === 'alert') {
+			var empty = $('no-alerts');
+			if (empty) empty.remove();
+			var li = document.createElement('li'), t = document.createElement('time');
+			t.setAttribute('datetime', data.created_at);
+			localize(t);
+			li.append(t, ' · ' + data.message);
+			$('alerts').prepend(li);
+		} else if (name === 'stopped' || name === 'expired') {
+			finish('Ya no se está compartiendo la ubicación.');
+		} else if (name === 'revoked') {
+			finish('El acceso a esta ubicación fue revocado.');
+		}
+	}
+
+	// EventSource no permite headers (el PIN), así que se lee el stream con fetch
+	var done = false;
+	function connect() {
+		fetch('/api/shared/' + encodeURIComponent(token) + '/stream', { headers: pin ? { 'X-Share-PIN': pin } : {} })
+			.then(function (res) {
+				if (!res.ok) { finish('Ya no es posible ver esta ubicación.'); return; }
+				var reader = res.body.getReader(), decoder = new TextDecoder(), buffer = '';
+				return reader.read().then(function pump(chunk) {
+					if (chunk.done) return;
+					buffer += decoder.decode(chunk.value, { stream: true });
+					var parts = buffer.split('\n\n');
+					buffer = parts.pop();
+					parts.forEach(function (block) {
+						var name = 'message', data = '';
+						block.split('\n').forEach(function (line) {
+							if (line.indexOf('event: ') === 0) name = line.slice(7);
+							else if (line.indexOf('data: ') === 0) data += line.slice(6);
+						});
+						if (data) handle(name, JSON.parse(data));
+					});
+					return reader.read().then(pump);
+				});
+			})
+			.catch(function () {})
+			.then(function () { if (!done) setTimeout(connect, 5000); });
+	}
+	connect();
+})();
+</script>
+{{end}}
+</body>
+</html>
+`))
+
+// ViewSharePage es la página pública de un receptor: muestra la posición en
+// vivo sin instalar la app. Con PIN, GET muestra el formulario y POST lo valida.
+func (h *LocationShareHandler) ViewSharePage(c *fiber.Ctx) error {
+	// Copias: token y PIN terminan en la página renderizada
+	token := strings.Clone(c.Params("token"))
+	pin := strings.TrimSpace(strings.Clone(c.FormValue("pin")))
+	if c.Method() != fiber.MethodPost {
+		pin = ""
+	}
+
+	// El token va en la URL: que no se filtre como Referer ni quede en cachés
+	c.Set("Referrer-Policy", "no-referrer")
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set("X-Robots-Tag", "noindex")
+
+	data := sharePageData{Token: token, PIN: pin}
+	status := fiber.StatusOK
+
+	access, err := h.authorizeViewer(c, token, pin, "page")
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		status, data.Notice = fiber.StatusNotFound, "Este enlace no existe."
+	case err != nil:
+		log.Printf("❌ Error resolviendo enlace de share: %v", err)
+		status, data.Notice = fiber.StatusInternalServerError, "No se pudo cargar la ubicación. Intenta de nuevo en unos minutos."
+	case access.outcome == models.ShareAccessPINRequired:
+		status, data.AskPIN = fiber.StatusUnauthorized, true
+	case access.outcome == models.ShareAccessBadPIN:
+		status, data.AskPIN, data.PINError = fiber.StatusUnauthorized, true, true
+	case access.outcome == models.ShareAccessLocked:
+		status, data.Notice = fiber.StatusTooManyRequests, "Demasiados intentos con PIN incorrecto. Vuelve a intentar en unos minutos."
+	case access.outcome == models.ShareAccessRevoked:
+		status, data.Notice = fiber.StatusForbidden, "El acceso a esta ubicación fue revocado."
+	case access.outcome == models.ShareAccessEnded:
+		status, data.Notice = fiber.StatusGone, "Esta ubicación ya no se está compartiendo."
+	default:
+		data.Share = viewerShare(access.share)
+		if data.Alerts, err = h.shares.Alerts(c.UserContext(), access.share.ID); err != nil {
+			log.Printf("⚠️  Error leyendo alertas del share %s: %v", access.share.ID, err)
+		}
+		// Más recientes primero, como las que agrega el stream
+		for i, j := 0, len(data.Alerts)-1; i < j; i, j = i+1, j-1 {
+			data.Alerts[i], data.Alerts[j] = data.Alerts[j], data.Alerts[i]
+		}
+	}
+
+	var page bytes.Buffer
+	if err := sharePageTemplate.Execute(&page, data); err != nil {
+		log.Printf("❌ Error renderizando página de share: %v", err)
+		return c.Status(fiber.StatusInternalServerError).SendString("Error interno")
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Status(status).Send(page.Bytes())
+}
@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/middleware"
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/repository"
+	"github.com/yourorg/wayfindcl/internal/validation"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// maxShareRecipients limita los receptores vigentes (no revocados) por share
+	maxShareRecipients = 20
+	// sharePINMaxAttempts PIN incorrectos dentro de sharePINLockout bloquean al receptor
+	sharePINMaxAttempts = 5
+	sharePINLockout     = 15 * time.Minute
+	// sharePINHeader lleva el PIN en la API pública (/api/shared/:token)
+	sharePINHeader = "X-Share-PIN"
+)
+
+// normalizeSharePIN valida un PIN opcional (4 a 8 dígitos); nil si no viene
+func normalizeSharePIN(pin *string) (*string, bool) {
+	pin = trimmedOrNil(pin)
+	if pin == nil {
+		return nil, true
+	}
+	if len(*pin) < 4 || len(*pin) > 8 {
+		return nil, false
+	}
+	for _, r := range *pin {
+		if r < '0' || r > '9' {
+			return nil, false
+		}
+	}
+	return pin, true
+}
+
+// issueRecipient crea un receptor con token nuevo. El token sólo existe en la
+// respuesta: se guarda su hash SHA-256 (y el PIN con bcrypt).
+func (h *LocationShareHandler) issueRecipient(ctx context.Context, shareID string, label, pin *string) (*models.ShareRecipient, string, error) {
+	token, tokenHash, err := generateRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	recipient := &models.ShareRecipient{
+		ShareID:   shareID,
+		Label:     trimmedOrNil(label),
+		TokenHash: tokenHash,
+	}
+	if recipient.Label != nil {
+		truncated := validation.Truncate(*recipient.Label, 100)
+		recipient.Label = &truncated
+	}
+	if pin != nil {
+		hash, err := bcrypt.GenerateFromPassword([]byte(*pin), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, "", err
+		}
+		pinHash := string(hash)
+		recipient.PINHash = &pinHash
+		recipient.HasPIN = true
+	}
+
+	id, err := h.shares.AddRecipient(ctx, recipient)
+	if err != nil {
+		return nil, "", err
+	}
+	recipient.ID = id
+	recipient.CreatedAt = time.Now()
+	return recipient, token, nil
+}
+
+// shareViewerURL es el enlace de la página pública del receptor. Usa
+// PUBLIC_BASE_URL si está configurada (detrás de un proxy) o la URL de la request.
+func shareViewerURL(c *fiber.Ctx, token string) string {
+	base := strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/")
+	if base == "" {
+		base = c.BaseURL()
+	}
+	return base + "/share/" + token
+}
+
+// ownedShare busca un share del usuario (activo o no); si no, ya escribió la
+// respuesta de error y retorna ok=false
+func (h *LocationShareHandler) ownedShare(c *fiber.Ctx) (*models.LocationShare, bool, error) {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
+		return nil, false, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Authentication required",
+		})
+	}
+
+	share, err := h.shares.GetForUser(c.UserContext(), c.Params("id"), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Share not found",
+		})
+	}
+	if err != nil {
+		return nil, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch share",
+		})
+	}
+	return share, true, nil
+}
+
+// CreateShareRecipient agrega un receptor a un share activo del usuario. El
+// token y el enlace sólo se entregan en esta respuesta.
+func (h *LocationShareHandler) CreateShareRecipient(c *fiber.Ctx) error {
+	share, ok, err := h.ownedShare(c)
+	if !ok {
+		return err
+	}
+	if !share.IsActive || !share.ExpiresAt.After(time.Now()) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Share is no longer active",
+		})
+	}
+
+	var req models.ShareRecipientRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	pin, pinOK := normalizeSharePIN(req.PIN)
+	if !pinOK {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "pin must be 4 to 8 digits",
+		})
+	}
+
+	recipients, err := h.shares.Recipients(c.UserContext(), share.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch recipients",
+		})
+	}
+	active := 0
+	for _, recipient := range recipients {
+		if recipient.RevokedAt == nil {
+			active++
+		}
+	}
+	if active >= maxShareRecipients {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Too many recipients for this share",
+		})
+	}
+
+	recipient, token, err := h.issueRecipient(c.UserContext(), share.ID, req.Label, pin)
+	if err != nil {
+		log.Printf("❌ Error creando receptor del share %s: %v", share.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create recipient",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"recipient": recipient,
+		"token":     token,
+		"share_url": shareViewerURL(c, token),
+	})
+}
+
+// ListShareRecipients lista los receptores de un share del usuario (sin tokens)
+func (h *LocationShareHandler) ListShareRecipients(c *fiber.Ctx) error {
+	share, ok, err := h.ownedShare(c)
+	if !ok {
+		return err
+	}
+
+	recipients, err := h.shares.Recipients(c.UserContext(), share.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch recipients",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"recipients": recipients,
+		"count":      len(recipients),
+	})
+}
+
+// RevokeShareRecipient revoca el token de un receptor y corta sus streams abiertos
+func (h *LocationShareHandler) RevokeShareRecipient(c *fiber.Ctx) error {
+	share, ok, err := h.ownedShare(c)
+	if !ok {
+		return err
+	}
+	recipientID, err := strconv.ParseInt(c.Params("recipientId"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid recipient ID",
+		})
+	}
+
+	err = h.shares.RevokeRecipient(c.UserContext(), share.ID, recipientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Recipient not found or already revoked",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke recipient",
+		})
+	}
+
+	h.streams.closeRecipient(share.ID, recipientID, sseEvent{
+		name:  "revoked",
+		data:  fiber.Map{"share_id": share.ID},
+		final: true,
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Recipient revoked successfully",
+	})
+}
+
+// GetShareAccessLog retorna los intentos de ver un share del usuario, más
+// recientes primero (?limit=, máximo 500)
+func (h *LocationShareHandler) GetShareAccessLog(c *fiber.Ctx) error {
+	share, ok, err := h.ownedShare(c)
+	if !ok {
+		return err
+	}
+
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 500 {
+		limit = 100
+	}
+	entries, err := h.shares.AccessLog(c.UserContext(), share.ID, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch access log",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
+
+// viewerAccess es el resultado de resolver el token de un receptor
+type viewerAccess struct {
+	share     *models.LocationShare
+	recipient *models.ShareRecipient
+	outcome   models.ShareAccessOutcome
+}
+
+// authorizeViewer resuelve token y PIN de un receptor y registra el intento
+// en el log de accesos (via: page, api o stream). Un token desconocido
+// retorna ErrNotFound y no se registra: no hay share al que asociarlo.
+func (h *LocationShareHandler) authorizeViewer(c *fiber.Ctx, token, pin, via string) (viewerAccess, error) {
+	ctx := c.UserContext()
+	recipient, err := h.shares.RecipientByToken(ctx, hashRefreshToken(token))
+	if err != nil {
+		return viewerAccess{}, err
+	}
+
+	access := viewerAccess{recipient: recipient, outcome: models.ShareAccessGranted}
+	switch share, err := h.shares.GetActive(ctx, recipient.ShareID); {
+	case recipient.RevokedAt != nil:
+		access.outcome = models.ShareAccessRevoked
+	case errors.Is(err, repository.ErrNotFound):
+		access.outcome = models.ShareAccessEnded
+	case err != nil:
+		return viewerAccess{}, err
+	default:
+		access.share = share
+	}
+
+	// Copias: los strings de fiber apuntan al buffer de la request
+	ip := strings.Clone(c.IP())
+	userAgent := validation.Truncate(strings.Clone(c.Get(fiber.HeaderUserAgent)), 255)
+	entry := &models.ShareAccess{
+		ShareID:     recipient.ShareID,
+		RecipientID: &recipient.ID,
+		Via:         via,
+		Outcome:     access.outcome,
+		IPAddress:   trimmedOrNil(&ip),
+		UserAgent:   trimmedOrNil(&userAgent),
+	}
+	if access.outcome == models.ShareAccessGranted && recipient.PINHash != nil {
+		access.outcome, err = h.checkSharePIN(ctx, recipient, pin, entry)
+		if err != nil {
+			return viewerAccess{}, err
+		}
+		return access, nil
+	}
+
+	if err := h.shares.LogAccess(ctx, entry); err != nil {
+		log.Printf("⚠️  Error registrando acceso al share %s: %v", recipient.ShareID, err)
+	}
+	return access, nil
+}
+
+// checkSharePIN compara el PIN salvo que el receptor esté bloqueado por
+// demasiados intentos fallidos recientes, y registra el acceso en entry. El
+// intento queda registrado como fallido antes de contar: con requests en
+// paralelo cada una cuenta también las que llegaron antes, así que no pueden
+// pasar más de sharePINMaxAttempts a comparar el PIN.
+func (h *LocationShareHandler) checkSharePIN(ctx context.Context, recipient *models.ShareRecipient, pin string, entry *models.ShareAccess) (models.ShareAccessOutcome, error) {
+	since := time.Now().Add(-sharePINLockout)
+
+	// Sin PIN no hay intento que contar
+	if pin == "" {
+		failed, err := h.shares.CountAccess(ctx, recipient.ID, models.ShareAccessBadPIN, since)
+		if err != nil {
+			return "", err
+		}
+		entry.Outcome = models.ShareAccessPINRequired
+		if failed >= sharePINMaxAttempts {
+			entry.Outcome = models.ShareAccessLocked
+		}
+		if err := h.shares.LogAccess(ctx, entry); err != nil {
+			log.Printf("⚠️  Error registrando acceso al share %s: %v", recipient.ShareID, err)
+		}
+		return entry.Outcome, nil
+	}
+
+	entry.Outcome = models.ShareAccessBadPIN
+	if err := h.shares.LogAccess(ctx, entry); err != nil {
+		return "", err
+	}
+	failed, err := h.shares.CountAccess(ctx, recipient.ID, models.ShareAccessBadPIN, since)
+	if err != nil {
+		return "", err
+	}
+
+	outcome := models.ShareAccessGranted
+	switch {
+	case failed > sharePINMaxAttempts: // El intento propio ya está contado
+		outcome = models.ShareAccessLocked
+	case bcrypt.CompareHashAndPassword([]byte(*recipient.PINHash), []byte(pin)) != nil:
+		return models.ShareAccessBadPIN, nil
+	}
+	if err := h.shares.SetAccessOutcome(ctx, entry.ID, outcome); err != nil {
+		// Queda como fallido: a lo más adelanta el bloqueo
+		log.Printf("⚠️  Error actualizando acceso %d al share %s: %v", entry.ID, recipient.ShareID, err)
+	}
+	entry.Outcome = outcome
+	return outcome, nil
+}
+
+// viewerDenied escribe la respuesta JSON de un acceso no concedido
+func viewerDenied(c *fiber.Ctx, outcome models.ShareAccessOutcome) error {
+	switch outcome {
+	case models.ShareAccessPINRequired:
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":        "PIN required",
+			"pin_required": true,
+		})
+	case models.ShareAccessBadPIN:
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":        "Invalid PIN",
+			"pin_required": true,
+		})
+	case models.ShareAccessLocked:
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": "Too many PIN attempts, try again later",
+		})
+	case models.ShareAccessRevoked:
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Access revoked",
+		})
+	default:
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{
+			"error": "Share ended",
+		})
+	}
+}
+
+// authorizeViewerJSON resuelve el acceso para la API pública; si no se
+// concede ya escribió la respuesta y retorna ok=false
+func (h *LocationShareHandler) authorizeViewerJSON(c *fiber.Ctx, via string) (viewerAccess, bool, error) {
+	access, err := h.authorizeViewer(c, c.Params("token"), c.Get(sharePINHeader), via)
+	if errors.Is(err, repository.ErrNotFound) {
+		return access, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Share not found",
+		})
+	}
+	if err != nil {
+		return access, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch share",
+		})
+	}
+	if access.outcome != models.ShareAccessGranted {
+		return access, false, viewerDenied(c, access.outcome)
+	}
+	return access, true, nil
+}
+
+// GetSharedLocation es la vista pública de un receptor: el share (sin datos
+// del dueño) y sus alertas. El PIN, si lo hay, va en el header X-Share-PIN.
+func (h *LocationShareHandler) GetSharedLocation(c *fiber.Ctx) error {
+	access, ok, err := h.authorizeViewerJSON(c, "api")
+	if !ok {
+		return err
+	}
+
+	alerts, err := h.shares.Alerts(c.UserContext(), access.share.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch alerts",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"share":     viewerShare(access.share),
+		"alerts":    alerts,
+		"recipient": access.recipient.Label,
+	})
+}
+
+// StreamSharedLocation transmite el share a un receptor por Server-Sent
+// Events; se corta con "revoked" si el dueño lo revoca
+func (h *LocationShareHandler) StreamSharedLocation(c *fiber.Ctx) error {
+	access, ok, err := h.authorizeViewerJSON(c, "stream")
+	if !ok {
+		return err
+	}
+	return h.streamShare(c, access.share, access.recipient.ID)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/middleware"
+	"github.com/yourorg/wayfindcl/internal/models"
+)
+
+// newShareTestApp monta las rutas de shares y la vista de receptores como en routes.Register
+func newShareTestApp() *fiber.App {
+	app := newAuthTestApp()
+	shares := NewLocationShareHandler(testStore.Shares)
+	group := app.Group("/api/shares", middleware.RequireAuth(JWTSecret))
+	group.Post("/", shares.CreateLocationShare)
+	group.Get("/:id/access", shares.GetShareAccessLog)
+	app.Get("/api/shared/:token", shares.GetSharedLocation)
+	return app
+}
+
+// createPINShare crea un share con PIN y retorna el token de su receptor
+func createPINShare(t *testing.T, app *fiber.App, username, pin string) string {
+	t.Helper()
+	owner := registerUser(t, app, username)
+	var created models.LocationShareResponse
+	status := doJSON(t, app, fiber.MethodPost, "/api/shares/", owner.Token, models.LocationShareCreateRequest{
+		Latitude:      -33.4372,
+		Longitude:     -70.6506,
+		DurationHours: 1,
+		PIN:           &pin,
+	}, &created)
+	if status != fiber.StatusCreated {
+		t.Fatalf("crear share: status %d, want 201", status)
+	}
+	return created.Token
+}
+
+// viewShared pide la vista del receptor con el PIN en el header (sin t: se
+// llama desde varias goroutines)
+func viewShared(app *fiber.App, token, pin string) (int, error) {
+	req := httptest.NewRequest(fiber.MethodGet, "/api/shared/"+token, nil)
+	if pin != "" {
+		req.Header.Set(sharePINHeader, pin)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestSharePINLockout(t *testing.T) {
+	app := newShareTestApp()
+	token := createPINShare(t, app, "pinsecuencial", "4821")
+
+	steps := []struct {
+		name string
+		pin  string
+		want int
+	}{
+		{"sin PIN", "", fiber.StatusUnauthorized},
+		{"PIN correcto", "4821", fiber.StatusOK},
+		{"incorrecto 1", "0000", fiber.StatusUnauthorized},
+		{"incorrecto 2", "0001", fiber.StatusUnauthorized},
+		{"incorrecto 3", "0002", fiber.StatusUnauthorized},
+		{"incorrecto 4", "0003", fiber.StatusUnauthorized},
+		// Los aciertos y los pedidos sin PIN no cuentan como intentos fallidos
+		{"correcto entre fallidos", "4821", fiber.StatusOK},
+		{"incorrecto 5", "0004", fiber.StatusUnauthorized},
+		{"bloqueado", "0005", fiber.StatusTooManyRequests},
+		{"bloqueado con el PIN correcto", "4821", fiber.StatusTooManyRequests},
+		{"bloqueado sin PIN", "", fiber.StatusTooManyRequests},
+	}
+	for _, step := range steps {
+		status, err := viewShared(app, token, step.pin)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if status != step.want {
+			t.Fatalf("%s: status %d, want %d", step.name, status, step.want)
+		}
+	}
+}
+
+// Cada intento queda registrado antes de contar: requests en paralelo no
+// pueden comparar más de sharePINMaxAttempts PIN
+func TestSharePINLockoutParallel(t *testing.T) {
+	app := newShareTestApp()
+	token := createPINShare(t, app, "pinparalelo", "4821")
+
+	const attempts = 4 * sharePINMaxAttempts
+	statuses := make([]int, attempts)
+	errs := make([]error, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i], errs[i] = viewShared(app, token, "0000")
+		}(i)
+	}
+	wg.Wait()
+
+	badPIN := 0
+	for i, status := range statuses {
+		if errs[i] != nil {
+			t.Fatalf("intento %d: %v", i, errs[i])
+		}
+		switch status {
+		case fiber.StatusUnauthorized:
+			badPIN++
+		case fiber.StatusTooManyRequests:
+		default:
+			t.Errorf("intento %d: status %d, want 401 o 429", i, status)
+		}
+	}
+	if badPIN > sharePINMaxAttempts {
+		t.Errorf("%d PIN comparados en paralelo, want a lo más %d", badPIN, sharePINMaxAttempts)
+	}
+
+	status, err := viewShared(app, token, "4821")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != fiber.StatusTooManyRequests {
+		t.Errorf("PIN correcto tras los intentos: status %d, want 429", status)
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"bufio"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/models"
+)
+
+// shareStreams reparte los eventos de cada share a sus streams abiertos (en
+// memoria: con varias instancias del backend cada una ve sólo sus updates).
+// Cada stream recuerda su receptor (0 = el dueño) para poder cortarlo al revocarlo.
+type shareStreams struct {
+	mu   sync.Mutex
+	subs map[string]map[chan sseEvent]int64
+}
+
+func newShareStreams() *shareStreams {
+	return &shareStreams{subs: make(map[string]map[chan sseEvent]int64)}
+}
+
+// subscribe abre un canal con los eventos del share; cancel lo da de baja
+func (s *shareStreams) subscribe(shareID string, recipientID int64) (<-chan sseEvent, func()) {
+	ch := make(chan sseEvent, sseBuffer)
+
+	s.mu.Lock()
+	if s.subs[shareID] == nil {
+		s.subs[shareID] = make(map[chan sseEvent]int64)
+	}
+	s.subs[shareID][ch] = recipientID
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.subs[shareID], ch)
+		if len(s.subs[shareID]) == 0 {
+			delete(s.subs, shareID)
+		}
+	}
+}
+
+// publish entrega el evento sin bloquear a quien actualiza el share. Tras un
+// evento final los streams quedan dados de baja.
+func (s *shareStreams) publish(shareID string, event sseEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch := range s.subs[shareID] {
+		deliverSSE(ch, event)
+	}
+	if event.final {
+		delete(s.subs, shareID)
+	}
+}
+
+// closeRecipient envía un evento final sólo a los streams de un receptor
+func (s *shareStreams) closeRecipient(shareID string, recipientID int64, event sseEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch, id := range s.subs[shareID] {
+		if id == recipientID {
+			deliverSSE(ch, event)
+			delete(s.subs[shareID], ch)
+		}
+	}
+	if len(s.subs[shareID]) == 0 {
+		delete(s.subs, shareID)
+	}
+}
+
+// StreamLocationShare transmite el share a su dueño por Server-Sent Events
+// (ver streamShare)
+func (h *LocationShareHandler) StreamLocationShare(c *fiber.Ctx) error {
+	share, ok, err := h.ownedActiveShare(c)
+	if !ok {
+		return err
+	}
+	return h.streamShare(c, share, 0)
+}
+
+// streamShare envía la posición actual al conectar, luego cada actualización
+// ("position") y las alertas de llegada, desvío o detención ("alert"), y por
+// último "stopped", "expired" o "revoked" (sólo al receptor revocado), tras
+// lo cual se cierra el stream
+func (h *LocationShareHandler) streamShare(c *fiber.Ctx, share *models.LocationShare, recipientID int64) error {
+	// Suscribirse antes de enviar la posición inicial para no perder updates
+	events, cancel := h.streams.subscribe(share.ID, recipientID)
+	conn := c.Context().Conn()
+
+	setSSEHeaders(c)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+
+		send := func(event sseEvent) bool {
+			_ = conn.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+			return writeSSE(w, event) == nil
+		}
+
+		expiry := time.NewTimer(time.Until(share.ExpiresAt))
+		defer expiry.Stop()
+		heartbeat := time.NewTicker(sseHeartbeat)
+		defer heartbeat.Stop()
+
+		if !send(sseEvent{name: "position", data: livePosition(share)}) {
+			return
+		}
+		for {
+			select {
+			case event := <-events:
+				if !send(event) || event.final {
+					return
+				}
+			case <-expiry.C:
+				send(sseEvent{name: "expired", data: fiber.Map{"share_id": share.ID}})
+				return
+			case <-heartbeat.C:
+				_ = conn.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+				if writeSSEPing(w) != nil {
+					return
+				}
+			}
+		}
+	})
+	return nil
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/middleware"
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/repository"
+)
+
+// testStore son los repositorios en memoria que usan los handlers en los tests
+var testStore *repository.Memory
+
+func TestMain(m *testing.M) {
+	os.Setenv("JWT_SECRET", "test-secret-0123456789abcdefghijklmnop")
+	// Sin tareas de fondo: los tests controlan el estado de los repositorios
+	os.Setenv("INCIDENT_SWEEP_INTERVAL", "0")
+	os.Setenv("DEBUG_EVENTS_RETENTION", "0")
+	os.Setenv("DEBUG_EVENTS_MAX", "0")
+	os.Setenv("ARRIVAL_OBSERVATIONS_RETENTION", "0")
+
+	testStore = repository.NewMemory()
+	InitRepositories(&testStore.Store)
+	Setup(nil)
+
+	os.Exit(m.Run())
+}
+
+// doJSON envía body como JSON y decodifica la respuesta en out (si no es nil)
+func doJSON(t *testing.T, app *fiber.App, method, path, token string, body, out interface{}) int {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal %s %s: %v", method, path, err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("decode %s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// newAuthTestApp monta las rutas de autenticación y sesiones como en routes.Register
+// (sin rate limiting)
+func newAuthTestApp() *fiber.App {
+	middleware.SetSessionValidator(IsSessionActive)
+	app := fiber.New()
+	app.Post("/api/register", Register)
+	app.Post("/api/auth/refresh", RefreshToken)
+	app.Post("/api/auth/logout", middleware.RequireAuth(JWTSecret), Logout)
+	app.Get("/api/auth/sessions", middleware.RequireAuth(JWTSecret), ListSessions)
+	return app
+}
+
+// registerUser crea un usuario con password y retorna su primera sesión
+func registerUser(t *testing.T, app *fiber.App, username string) models.LoginResponse {
+	t.Helper()
+	var resp models.LoginResponse
+	status := doJSON(t, app, fiber.MethodPost, "/api/register", "", models.RegisterRequest{
+		Username: username,
+		Email:    username + "@example.com",
+		Password: "secreto-de-prueba",
+	}, &resp)
+	if status != fiber.StatusCreated {
+		t.Fatalf("register %s: status %d", username, status)
+	}
+	return resp
+}
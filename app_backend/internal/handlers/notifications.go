@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/middleware"
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/repository"
+)
+
+type NotificationHandler struct {
+	inbox repository.NotificationRepository
+}
+
+func NewNotificationHandler(inbox repository.NotificationRepository) *NotificationHandler {
+	return &NotificationHandler{inbox: inbox}
+}
+
+// GetNotifications obtiene la bandeja de notificaciones del usuario
+func (h *NotificationHandler) GetNotifications(c *fiber.Ctx) error {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Authentication required",
+		})
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	unreadOnly := c.QueryBool("unread_only", false)
+
+	list, err := h.inbox.ListByUser(c.UserContext(), userID, unreadOnly, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch notifications",
+		})
+	}
+	unread, err := h.inbox.UnreadCount(c.UserContext(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch notifications",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"notifications": list,
+		"count":         len(list),
+		"unread":        unread,
+	})
+}
+
+// MarkNotificationsRead marca como leídas las notificaciones indicadas (todas si no se indican)
+func (h *NotificationHandler) MarkNotificationsRead(c *fiber.Ctx) error {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Authentication required",
+		})
+	}
+
+	var req models.NotificationReadRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+
+	marked, err := h.inbox.MarkRead(c.UserContext(), userID, req.IDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update notifications",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Notifications marked as read",
+		"marked":  marked,
+	})
+}
@@ -102,6 +102,11 @@ func NewRedBusHandler(db *sql.DB) *RedBusHandler {
 	}
 }
 
+// ClearCache vacía los cachés de rutas e itinerarios del scraper de Moovit
+func (h *RedBusHandler) ClearCache() {
+	h.scraper.ClearCache()
+}
+
 // ConfigureRedBusGeometry configura el servicio de geometría en el scraper existente
 func (h *RedBusHandler) ConfigureRedBusGeometry(geometrySvc *geometry.Service) {
 	if geometrySvc != nil {
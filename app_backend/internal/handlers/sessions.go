@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/yourorg/wayfindcl/internal/middleware"
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/repository"
+	"github.com/yourorg/wayfindcl/internal/validation"
+)
+
+// startSession crea una sesión de dispositivo con refresh token y emite el access token
+func startSession(c *fiber.Ctx, store *repository.Store, userID int64, username string, role models.Role, deviceInfo string) (models.LoginResponse, error) {
+	refreshToken, refreshHash, err := generateRefreshToken()
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	sessionID := uuid.New().String()
+	refreshExpires := time.Now().Add(refreshTTL)
+
+	deviceInfo = strings.TrimSpace(deviceInfo)
+	if deviceInfo == "" {
+		deviceInfo = c.Get(fiber.HeaderUserAgent)
+	}
+
+	session := &models.UserSession{
+		ID:         sessionID,
+		UserID:     userID,
+		DeviceInfo: optionalString(validation.Truncate(deviceInfo, 255)),
+		IPAddress:  optionalString(c.IP()),
+		UserAgent:  optionalString(validation.Truncate(c.Get(fiber.HeaderUserAgent), 255)),
+		ExpiresAt:  refreshExpires,
+	}
+	if err := store.Sessions.Create(c.UserContext(), session, refreshHash); err != nil {
+		log.Printf("❌ Error creando sesión para user_id=%d: %v", userID, err)
+		return models.LoginResponse{}, err
+	}
+
+	token, expiresAt, err := issueToken(userID, username, role, sessionID)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	return models.LoginResponse{
+		Token:            token,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpires,
+		SessionID:        sessionID,
+	}, nil
+}
+
+// generateRefreshToken retorna un token aleatorio opaco y su hash SHA-256 (lo único que se guarda)
+func generateRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sessionGraceTTL es cuánto se sigue aceptando una sesión vista activa si la
+// BD deja de responder. Sin una verificación reciente se rechaza: aceptar
+// cualquier token durante una caída dejaría pasar sesiones revocadas.
+const sessionGraceTTL = 30 * time.Second
+
+var (
+	sessionSeenMu sync.Mutex
+	sessionSeen   = make(map[string]time.Time) // sessionID -> última vez verificada activa
+)
+
+// IsSessionActive verifica que la sesión no esté revocada ni expirada.
+// Se registra como middleware.SessionValidator.
+func IsSessionActive(sessionID string) (bool, error) {
+	store := getRepos()
+	if store == nil {
+		return false, errors.New("database not ready")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	active, err := store.Sessions.IsActive(ctx, sessionID)
+	if err != nil {
+		sessionSeenMu.Lock()
+		seen, ok := sessionSeen[sessionID]
+		sessionSeenMu.Unlock()
+		if ok && time.Since(seen) < sessionGraceTTL {
+			return true, nil
+		}
+		log.Printf("⚠️ [AUTH] Error verificando sesión %s: %v", sessionID, err)
+		return false, err
+	}
+
+	if !active {
+		forgetSession(sessionID)
+		return false, nil
+	}
+	now := time.Now()
+	sessionSeenMu.Lock()
+	sessionSeen[sessionID] = now
+	// Descartar las verificaciones que ya no sirven de respaldo
+	if len(sessionSeen) > 10000 {
+		for id, seen := range sessionSeen {
+			if now.Sub(seen) >= sessionGraceTTL {
+				delete(sessionSeen, id)
+			}
+		}
+	}
+	sessionSeenMu.Unlock()
+	return true, nil
+}
+
+// forgetSession descarta el respaldo de una sesión cerrada o revocada
+func forgetSession(sessionID string) {
+	sessionSeenMu.Lock()
+	delete(sessionSeen, sessionID)
+	sessionSeenMu.Unlock()
+}
+
+func forgetAllSessions() {
+	sessionSeenMu.Lock()
+	sessionSeen = make(map[string]time.Time)
+	sessionSeenMu.Unlock()
+}
+
+// RefreshToken handles POST /api/auth/refresh
+// Rota el refresh token: el anterior queda inválido y se emite un nuevo par de tokens.
+// Si se presenta cualquier refresh token ya rotado de la sesión, se asume robo
+// y se revoca la sesión completa.
+func RefreshToken(c *fiber.Ctx) error {
+	store := getRepos()
+	if store == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "server not ready"})
+	}
+
+	var req models.RefreshTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{Error: "invalid json"})
+	}
+	req.RefreshToken = strings.TrimSpace(req.RefreshToken)
+	if req.RefreshToken == "" {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(models.ErrorResponse{Error: "refresh_token required"})
+	}
+
+	presentedHash := hashRefreshToken(req.RefreshToken)
+
+	ctx := c.UserContext()
+	session, err := store.Sessions.ByRefreshHash(ctx, presentedHash)
+	if errors.Is(err, repository.ErrNotFound) {
+		// ¿Token de una rotación anterior (cualquiera)? => posible robo, revocar la sesión completa
+		reusedSessionID, reuseErr := store.Sessions.ByUsedHash(ctx, presentedHash)
+		if reuseErr == nil {
+			log.Printf("🚨 [AUTH] Reutilización de refresh token detectada, revocando sesión %s", reusedSessionID)
+			forgetSession(reusedSessionID)
+			if err := store.Sessions.Revoke(ctx, reusedSessionID, 0); err != nil && !errors.Is(err, repository.ErrNotFound) {
+				log.Printf("❌ Error revocando sesión %s: %v", reusedSessionID, err)
+			}
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ErrorResponse{Error: "invalid refresh token"})
+	}
+	if err != nil {
+		log.Printf("❌ Error consultando sesión: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "db error"})
+	}
+	if !session.Active {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ErrorResponse{Error: "session expired or revoked"})
+	}
+
+	newRefresh, newHash, err := generateRefreshToken()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "failed to generate token"})
+	}
+	refreshExpires := time.Now().Add(refreshTTL)
+
+	// Compare-and-swap: sólo una rotación concurrente puede ganar
+	err = store.Sessions.Rotate(ctx, session.SessionID, presentedHash, newHash, refreshExpires, c.IP())
+	if errors.Is(err, repository.ErrConflict) {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ErrorResponse{Error: "invalid refresh token"})
+	}
+	if err != nil {
+		log.Printf("❌ Error rotando refresh token: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "db error"})
+	}
+
+	token, expiresAt, err := issueToken(session.UserID, session.Username, session.Role, session.SessionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "failed to sign token"})
+	}
+
+	c.Set("Cache-Control", "no-store")
+	return c.JSON(models.RefreshTokenResponse{
+		Token:            token,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     newRefresh,
+		RefreshExpiresAt: refreshExpires,
+		SessionID:        session.SessionID,
+	})
+}
+
+// Logout handles POST /api/auth/logout
+// Revoca la sesión del token actual
+func Logout(c *fiber.Ctx) error {
+	store := getRepos()
+	if store == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "server not ready"})
+	}
+
+	claims, ok := middleware.ClaimsFromCtx(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ErrorResponse{Error: "authentication required"})
+	}
+	if claims.SessionID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{Error: "token has no session"})
+	}
+
+	// Una sesión ya revocada (ej: desde otro dispositivo) también queda cerrada
+	err := store.Sessions.Revoke(c.UserContext(), claims.SessionID, 0)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		log.Printf("❌ Error cerrando sesión %s: %v", claims.SessionID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "db error"})
+	}
+	forgetSession(claims.SessionID)
+
+	return c.JSON(fiber.Map{
+		"message": "Sesión cerrada",
+	})
+}
+
+// ListSessions handles GET /api/auth/sessions
+// Lista los dispositivos con sesión activa del usuario
+func ListSessions(c *fiber.Ctx) error {
+	store := getRepos()
+	if store == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "server not ready"})
+	}
+
+	claims, ok := middleware.ClaimsFromCtx(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ErrorResponse{Error: "authentication required"})
+	}
+	userID, _ := claims.UserID()
+
+	sessions, err := store.Sessions.ListActive(c.UserContext(), userID)
+	if err != nil {
+		log.Printf("❌ Error listando sesiones: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "db error"})
+	}
+	for i := range sessions {
+		sessions[i].IsCurrent = sessions[i].ID == claims.SessionID
+	}
+
+	return c.JSON(fiber.Map{
+		"sessions": sessions,
+		"count":    len(sessions),
+	})
+}
+
+// RevokeSession handles DELETE /api/auth/sessions/:id
+// Revoca un dispositivo específico (ej: teléfono robado)
+func RevokeSession(c *fiber.Ctx) error {
+	store := getRepos()
+	if store == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "server not ready"})
+	}
+
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ErrorResponse{Error: "authentication required"})
+	}
+
+	err := store.Sessions.Revoke(c.UserContext(), c.Params("id"), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{Error: "session not found"})
+	}
+	if err != nil {
+		log.Printf("❌ Error revocando sesión: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "db error"})
+	}
+	forgetSession(c.Params("id"))
+
+	return c.JSON(fiber.Map{
+		"message": "Sesión revocada",
+	})
+}
+
+// RevokeAllSessions handles DELETE /api/auth/sessions?keep_current=true
+// Revoca todas las sesiones del usuario (opcionalmente conserva la actual)
+func RevokeAllSessions(c *fiber.Ctx) error {
+	store := getRepos()
+	if store == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "server not ready"})
+	}
+
+	claims, ok := middleware.ClaimsFromCtx(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ErrorResponse{Error: "authentication required"})
+	}
+	userID, _ := claims.UserID()
+
+	exceptID := ""
+	if c.QueryBool("keep_current", false) {
+		exceptID = claims.SessionID
+	}
+
+	revoked, err := store.Sessions.RevokeAll(c.UserContext(), userID, exceptID)
+	if err != nil {
+		log.Printf("❌ Error revocando sesiones de user_id=%d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: "db error"})
+	}
+	// No se sabe qué sesiones eran: descartar todo el respaldo
+	forgetAllSessions()
+
+	return c.JSON(fiber.Map{
+		"message": "Sesiones revocadas",
+		"revoked": revoked,
+	})
+}
+
+// optionalString retorna nil para un texto vacío (columna NULL)
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yourorg/wayfindcl/internal/middleware"
+	"github.com/yourorg/wayfindcl/internal/models"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	app := newAuthTestApp()
+	login := registerUser(t, app, "rotacion")
+
+	var rotated models.RefreshTokenResponse
+	status := doJSON(t, app, fiber.MethodPost, "/api/auth/refresh", "",
+		models.RefreshTokenRequest{RefreshToken: login.RefreshToken}, &rotated)
+	if status != fiber.StatusOK {
+		t.Fatalf("refresh: status %d, want 200", status)
+	}
+	if rotated.SessionID != login.SessionID {
+		t.Errorf("refresh cambió la sesión: %q, want %q", rotated.SessionID, login.SessionID)
+	}
+	if rotated.RefreshToken == "" || rotated.RefreshToken == login.RefreshToken {
+		t.Fatalf("refresh no rotó el refresh token")
+	}
+
+	// El access token nuevo sirve mientras la sesión siga activa
+	var list struct {
+		Count int `json:"count"`
+	}
+	if status := doJSON(t, app, fiber.MethodGet, "/api/auth/sessions", rotated.Token, nil, &list); status != fiber.StatusOK {
+		t.Fatalf("sessions con el token rotado: status %d, want 200", status)
+	}
+	if list.Count != 1 {
+		t.Errorf("sessions: count %d, want 1", list.Count)
+	}
+
+	// El refresh token siguiente también rota
+	var again models.RefreshTokenResponse
+	status = doJSON(t, app, fiber.MethodPost, "/api/auth/refresh", "",
+		models.RefreshTokenRequest{RefreshToken: rotated.RefreshToken}, &again)
+	if status != fiber.StatusOK {
+		t.Fatalf("segundo refresh: status %d, want 200", status)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	app := newAuthTestApp()
+	login := registerUser(t, app, "reutilizado")
+
+	var rotated models.RefreshTokenResponse
+	if status := doJSON(t, app, fiber.MethodPost, "/api/auth/refresh", "",
+		models.RefreshTokenRequest{RefreshToken: login.RefreshToken}, &rotated); status != fiber.StatusOK {
+		t.Fatalf("refresh: status %d, want 200", status)
+	}
+
+	// Presentar el token ya rotado se trata como robo
+	if status := doJSON(t, app, fiber.MethodPost, "/api/auth/refresh", "",
+		models.RefreshTokenRequest{RefreshToken: login.RefreshToken}, nil); status != fiber.StatusUnauthorized {
+		t.Fatalf("reuso del token rotado: status %d, want 401", status)
+	}
+
+	// ...y revoca la sesión completa: tampoco sirven el refresh ni el access token vigentes
+	if status := doJSON(t, app, fiber.MethodPost, "/api/auth/refresh", "",
+		models.RefreshTokenRequest{RefreshToken: rotated.RefreshToken}, nil); status != fiber.StatusUnauthorized {
+		t.Errorf("refresh tras el reuso: status %d, want 401", status)
+	}
+	if status := doJSON(t, app, fiber.MethodGet, "/api/auth/sessions", rotated.Token, nil, nil); status != fiber.StatusUnauthorized {
+		t.Errorf("access token tras el reuso: status %d, want 401", status)
+	}
+}
+
+func TestRefreshTokenOlderReuseRevokesSession(t *testing.T) {
+	app := newAuthTestApp()
+	login := registerUser(t, app, "reutilizado-antiguo")
+
+	// Dos rotaciones: el token original ya no es el inmediatamente anterior
+	current := models.RefreshTokenResponse{RefreshToken: login.RefreshToken}
+	for i := 0; i < 2; i++ {
+		var rotated models.RefreshTokenResponse
+		if status := doJSON(t, app, fiber.MethodPost, "/api/auth/refresh", "",
+			models.RefreshTokenRequest{RefreshToken: current.RefreshToken}, &rotated); status != fiber.StatusOK {
+			t.Fatalf("refresh %d: status %d, want 200", i+1, status)
+		}
+		current = rotated
+	}
+
+	if status := doJSON(t, app, fiber.MethodPost, "/api/auth/refresh", "",
+		models.RefreshTokenRequest{RefreshToken: login.RefreshToken}, nil); status != fiber.StatusUnauthorized {
+		t.Fatalf("reuso del token original: status %d, want 401", status)
+	}
+	if status := doJSON(t, app, fiber.MethodPost, "/api/auth/refresh", "",
+		models.RefreshTokenRequest{RefreshToken: current.RefreshToken}, nil); status != fiber.StatusUnauthorized {
+		t.Errorf("refresh tras el reuso: status %d, want 401", status)
+	}
+	if status := doJSON(t, app, fiber.MethodGet, "/api/auth/sessions", current.Token, nil, nil); status != fiber.StatusUnauthorized {
+		t.Errorf("access token tras el reuso: status %d, want 401", status)
+	}
+}
+
+func TestRefreshTokenUnknown(t *testing.T) {
+	app := newAuthTestApp()
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"vacío", "", fiber.StatusUnprocessableEntity},
+		{"espacios", "   ", fiber.StatusUnprocessableEntity},
+		{"desconocido", "no-es-un-refresh-token", fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := doJSON(t, app, fiber.MethodPost, "/api/auth/refresh", "",
+				models.RefreshTokenRequest{RefreshToken: tt.token}, nil)
+			if status != tt.want {
+				t.Errorf("status %d, want %d", status, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	app := newAuthTestApp()
+	login := registerUser(t, app, "cierre")
+
+	if status := doJSON(t, app, fiber.MethodPost, "/api/auth/logout", login.Token, nil, nil); status != fiber.StatusOK {
+		t.Fatalf("logout: status %d, want 200", status)
+	}
+	if status := doJSON(t, app, fiber.MethodGet, "/api/auth/sessions", login.Token, nil, nil); status != fiber.StatusUnauthorized {
+		t.Errorf("access token tras logout: status %d, want 401", status)
+	}
+	if status := doJSON(t, app, fiber.MethodPost, "/api/auth/refresh", "",
+		models.RefreshTokenRequest{RefreshToken: login.RefreshToken}, nil); status != fiber.StatusUnauthorized {
+		t.Errorf("refresh tras logout: status %d, want 401", status)
+	}
+}
+
+func TestAccessTokenWithoutSessionRejected(t *testing.T) {
+	app := newAuthTestApp()
+	login := registerUser(t, app, "sin-sid")
+
+	// Firmado con el secret vigente pero sin "sid", como los emitidos antes de las sesiones
+	now := time.Now()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, middleware.Claims{
+		Username: "sin-sid",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatInt(login.User.ID, 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}).SignedString(JWTSecret())
+	if err != nil {
+		t.Fatalf("firmar token: %v", err)
+	}
+
+	var body struct {
+		Error string `json:"error"`
+	}
+	if status := doJSON(t, app, fiber.MethodGet, "/api/auth/sessions", token, nil, &body); status != fiber.StatusUnauthorized {
+		t.Fatalf("token sin sid: status %d, want 401", status)
+	}
+	if body.Error != "session required" {
+		t.Errorf("token sin sid: error %q, want %q", body.Error, "session required")
+	}
+	if status := doJSON(t, app, fiber.MethodGet, "/api/auth/sessions", login.Token, nil, nil); status != fiber.StatusOK {
+		t.Errorf("token con sid: status %d, want 200", status)
+	}
+}
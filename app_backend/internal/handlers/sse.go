@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// sseBuffer son los eventos pendientes por stream; a uno atrasado se le
+	// descartan los más antiguos (el evento nuevo reemplaza al viejo)
+	sseBuffer = 16
+	// sseHeartbeat mantiene viva la conexión a través de proxies
+	sseHeartbeat = 15 * time.Second
+	// sseWriteTimeout corta a un receptor que dejó de leer. Reemplaza al
+	// WriteTimeout del servidor, que cortaría cualquier stream largo.
+	sseWriteTimeout = 10 * time.Second
+)
+
+// sseEvent es un evento Server-Sent Events
+type sseEvent struct {
+	name  string
+	data  interface{}
+	final bool // El stream se cierra después de enviarlo
+}
+
+// setSSEHeaders prepara la respuesta para un stream de eventos
+func setSSEHeaders(c *fiber.Ctx) {
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // Sin buffering en nginx
+}
+
+// deliverSSE encola sin bloquear: a un stream atrasado se le descarta el
+// evento más antiguo
+func deliverSSE(ch chan sseEvent, event sseEvent) {
+	select {
+	case ch <- event:
+	default:
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// writeSSE escribe un evento en formato Server-Sent Events
+func writeSSE(w *bufio.Writer, event sseEvent) error {
+	data, err := json.Marshal(event.data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// writeSSEPing escribe un comentario de heartbeat
+func writeSSEPing(w *bufio.Writer) error {
+	if _, err := w.WriteString(": ping\n\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/middleware"
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/repository"
+	"github.com/yourorg/wayfindcl/internal/validation"
+)
+
+const (
+	// maxSubscriptionsPerUser limita cuántas rutas/paraderos/zonas sigue un usuario
+	maxSubscriptionsPerUser = 50
+	defaultAreaRadiusM      = 500.0
+	minAreaRadiusM          = 50.0
+	maxAreaRadiusM          = 5000.0
+)
+
+type SubscriptionHandler struct {
+	subs repository.SubscriptionRepository
+}
+
+func NewSubscriptionHandler(subs repository.SubscriptionRepository) *SubscriptionHandler {
+	return &SubscriptionHandler{subs: subs}
+}
+
+// CreateSubscription suscribe al usuario a una ruta, paradero o zona
+func (h *SubscriptionHandler) CreateSubscription(c *fiber.Ctx) error {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Authentication required",
+		})
+	}
+
+	var req models.IncidentSubscriptionCreateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	sub, errMsg := buildSubscription(userID, req)
+	if errMsg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errMsg,
+		})
+	}
+
+	existing, err := h.subs.ListByUser(c.UserContext(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create subscription",
+		})
+	}
+	if len(existing) >= maxSubscriptionsPerUser {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Subscription limit reached",
+		})
+	}
+
+	id, err := h.subs.Create(c.UserContext(), sub)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create subscription",
+		})
+	}
+	sub.ID = id
+	sub.CreatedAt = time.Now()
+
+	return c.Status(fiber.StatusCreated).JSON(sub)
+}
+
+// buildSubscription valida la solicitud según el tipo; retorna el mensaje de error si no es válida
+func buildSubscription(userID int64, req models.IncidentSubscriptionCreateRequest) (*models.IncidentSubscription, string) {
+	sub := &models.IncidentSubscription{UserID: userID, Kind: req.Kind}
+	if label := trimmed(req.Label); label != "" {
+		if len(label) > 100 {
+			return nil, "label is too long"
+		}
+		sub.Label = &label
+	}
+
+	switch req.Kind {
+	case models.SubscriptionRoute:
+		name := trimmed(req.RouteName)
+		if name == "" || len(name) > 100 {
+			return nil, "route_name is required"
+		}
+		sub.RouteName = &name
+	case models.SubscriptionStop:
+		name := trimmed(req.StopName)
+		if name == "" || len(name) > 255 {
+			return nil, "stop_name is required"
+		}
+		sub.StopName = &name
+	case models.SubscriptionArea:
+		if req.Latitude == nil || req.Longitude == nil {
+			return nil, "latitude and longitude are required"
+		}
+		if err := validation.ValidateCoordinatePair(*req.Latitude, *req.Longitude, "area"); err != nil {
+			return nil, err.Error()
+		}
+		radius := defaultAreaRadiusM
+		if req.RadiusM != nil {
+			radius = *req.RadiusM
+		}
+		if radius < minAreaRadiusM || radius > maxAreaRadiusM {
+			return nil, "radius_m must be between 50 and 5000"
+		}
+		sub.Latitude, sub.Longitude, sub.RadiusM = req.Latitude, req.Longitude, &radius
+	default:
+		return nil, "kind must be 'route', 'stop' or 'area'"
+	}
+	return sub, ""
+}
+
+func trimmed(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return strings.TrimSpace(*s)
+}
+
+// GetSubscriptions lista las suscripciones del usuario
+func (h *SubscriptionHandler) GetSubscriptions(c *fiber.Ctx) error {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Authentication required",
+		})
+	}
+
+	subs, err := h.subs.ListByUser(c.UserContext(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch subscriptions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"subscriptions": subs,
+		"count":         len(subs),
+	})
+}
+
+// DeleteSubscription elimina una suscripción del usuario
+func (h *SubscriptionHandler) DeleteSubscription(c *fiber.Ctx) error {
+	userID, ok := middleware.UserIDFromCtx(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Authentication required",
+		})
+	}
+
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Subscription not found",
+		})
+	}
+
+	err = h.subs.Delete(c.UserContext(), id, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Subscription not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete subscription",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Subscription deleted successfully",
+	})
+}
@@ -0,0 +1,107 @@
+// ============================================================================
+// NATIVE TRANSIT ROUTER HANDLERS - WayFindCL
+// ============================================================================
+// Routing de transporte público en proceso (RAPTOR) sobre las tablas GTFS
+// locales. No depende de GraphHopper ni de Moovit.
+// ============================================================================
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/transit"
+)
+
+var transitRouter *transit.Router
+
+// maxDepartureOffset acota departure_time: cada día de servicio distinto carga
+// un horario completo en memoria
+const maxDepartureOffset = 7 * 24 * time.Hour
+
+// InitTransitRouter inicializa el router RAPTOR sobre la base de datos GTFS
+func InitTransitRouter(router *transit.Router) {
+	transitRouter = router
+	RegisterCacheFlusher("transit_timetables", router.Invalidate)
+}
+
+// invalidateTransitRouter descarta los horarios en memoria tras un GTFS sync
+func invalidateTransitRouter() {
+	if transitRouter != nil {
+		transitRouter.Invalidate()
+	}
+}
+
+// ============================================================================
+// ENDPOINT: POST /api/route/transit/native
+// ============================================================================
+// Itinerarios Pareto-óptimos (hora de llegada vs. transbordos) calculados
+// offline con RAPTOR.
+// Body JSON:
+//   {
+//     "origin": {"lat": -33.45, "lon": -70.66},
+//     "destination": {"lat": -33.52, "lon": -70.68},
+//     "departure_time": "2025-10-18T14:30:00-03:00",  // opcional, default: ahora (máx. ±7 días)
+//     "max_walk_distance": 600,  // opcional, metros de acceso/egreso
+//     "max_transfers": 3         // opcional
+//   }
+// ============================================================================
+func GetNativeTransitRoute(c *fiber.Ctx) error {
+	if transitRouter == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(models.ErrorResponse{Error: "transit router not ready"})
+	}
+
+	var req models.NativeTransitRouteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{Error: "invalid json"})
+	}
+	if req.Origin.Lat == 0 || req.Origin.Lon == 0 || req.Destination.Lat == 0 || req.Destination.Lon == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{Error: "origin and destination required"})
+	}
+
+	departure := time.Now()
+	if req.DepartureTime != nil {
+		departure = req.DepartureTime.Time
+		if offset := time.Until(departure); offset > maxDepartureOffset || offset < -maxDepartureOffset {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{Error: "departure_time must be within 7 days of now"})
+		}
+	}
+	maxTransfers := 3
+	if req.MaxTransfers != nil {
+		maxTransfers = *req.MaxTransfers
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	start := time.Now()
+	journeys, err := transitRouter.Plan(ctx, transit.PlanRequest{
+		FromLat:       req.Origin.Lat,
+		FromLon:       req.Origin.Lon,
+		ToLat:         req.Destination.Lat,
+		ToLon:         req.Destination.Lon,
+		Departure:     departure,
+		MaxWalkMeters: req.MaxWalkDistance,
+		MaxTransfers:  maxTransfers,
+	})
+	if errors.Is(err, transit.ErrNoStopsNearby) {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{Error: "no stops within walking distance"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{Error: err.Error()})
+	}
+	if len(journeys) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{Error: "no public transit route found"})
+	}
+
+	return c.JSON(fiber.Map{
+		"journeys":   journeys,
+		"count":      len(journeys),
+		"source":     "raptor_gtfs",
+		"elapsed_ms": time.Since(start).Milliseconds(),
+	})
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminTokenHeader es el header con el token de operaciones internas (CLI, cron)
+const AdminTokenHeader = "X-Admin-Token"
+
+// RequireAdminToken protege endpoints internos con el token compartido ADMIN_TOKEN.
+// Si ADMIN_TOKEN no está configurado los endpoints quedan deshabilitados.
+func RequireAdminToken() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		expected := strings.TrimSpace(os.Getenv("ADMIN_TOKEN"))
+		if expected == "" {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "admin endpoints disabled (ADMIN_TOKEN not set)"})
+		}
+		presented := strings.TrimSpace(c.Get(AdminTokenHeader))
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(expected)) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid admin token"})
+		}
+		return c.Next()
+	}
+}
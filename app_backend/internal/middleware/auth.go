@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yourorg/wayfindcl/internal/models"
+)
+
+// Claves usadas en c.Locals por los handlers protegidos
+const (
+	LocalUserID   = "userID"
+	LocalUsername = "username"
+	LocalClaims   = "claims"
+)
+
+// ErrSessionRevoked indica que la sesión del token fue cerrada o revocada
+var ErrSessionRevoked = errors.New("session revoked")
+
+// ErrSessionMissing indica un token sin "sid": con sesiones no se podría revocar
+var ErrSessionMissing = errors.New("token has no session")
+
+// ErrSessionUnverified indica que no se pudo verificar la sesión (ej: la BD no
+// responde). El token se rechaza: aceptarlo dejaría pasar sesiones revocadas.
+var ErrSessionUnverified = errors.New("session could not be verified")
+
+// defaultLeeway tolera diferencias de reloj entre el servidor y el cliente
+const defaultLeeway = 30 * time.Second
+
+// Claims son los claims tipados del JWT emitido por handlers.issueToken
+type Claims struct {
+	Username  string      `json:"username"`
+	Role      models.Role `json:"role,omitempty"` // Vacío en tokens emitidos antes de los roles
+	SessionID string      `json:"sid,omitempty"`  // Sesión/dispositivo que emitió el token (obligatorio con sesiones)
+	jwt.RegisteredClaims
+}
+
+// UserID retorna el ID de usuario contenido en el subject del token
+func (c *Claims) UserID() (int64, error) {
+	return strconv.ParseInt(c.Subject, 10, 64)
+}
+
+// EffectiveRole retorna el rol del token (RoleUser si no trae uno)
+func (c *Claims) EffectiveRole() models.Role {
+	if c.Role == "" {
+		return models.RoleUser
+	}
+	return c.Role
+}
+
+// SecretFunc retorna el secret HS256 vigente (ej: handlers.JWTSecret)
+type SecretFunc func() []byte
+
+// SessionValidator indica si la sesión de un token sigue vigente (no
+// revocada). Un error significa que no se pudo verificar.
+type SessionValidator func(sessionID string) (bool, error)
+
+var sessionValidator SessionValidator
+
+// SetSessionValidator registra la verificación de revocación de sesiones.
+// Desde entonces se rechazan los tokens sin "sid" (emitidos antes de las
+// sesiones): ningún logout ni revocación los alcanzaría.
+func SetSessionValidator(v SessionValidator) {
+	sessionValidator = v
+}
+
+// ParseToken valida un JWT HS256 y retorna sus claims tipados
+func ParseToken(tokenString string, secret []byte) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		claims,
+		func(t *jwt.Token) (interface{}, error) {
+			return secret, nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(jwtLeeway()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, errors.New("invalid subject")
+	}
+	if sessionValidator != nil {
+		if claims.SessionID == "" {
+			return nil, ErrSessionMissing
+		}
+		active, err := sessionValidator(claims.SessionID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSessionUnverified, err)
+		}
+		if !active {
+			return nil, ErrSessionRevoked
+		}
+	}
+	return claims, nil
+}
+
+// RequireAuth exige un Bearer token válido y expone los claims en c.Locals
+func RequireAuth(secret SecretFunc) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return authenticate(c, bearerToken(c), secret)
+	}
+}
+
+// RequireWebSocketAuth es RequireAuth para el handshake de un WebSocket: los
+// navegadores no pueden enviar headers al abrirlo, así que también acepta el
+// token en el query param access_token
+func RequireWebSocketAuth(secret SecretFunc) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tokenString := bearerToken(c)
+		if tokenString == "" {
+			tokenString = strings.TrimSpace(c.Query("access_token"))
+		}
+		return authenticate(c, tokenString, secret)
+	}
+}
+
+func authenticate(c *fiber.Ctx, tokenString string, secret SecretFunc) error {
+	if tokenString == "" {
+		return unauthorized(c, "missing token", "se requiere autenticación")
+	}
+
+	claims, err := ParseToken(tokenString, secret())
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return unauthorized(c, "token expired", "el token expiró, renuévalo con el refresh token")
+		}
+		if errors.Is(err, ErrSessionRevoked) {
+			return unauthorized(c, "session revoked", "la sesión fue cerrada en este dispositivo")
+		}
+		if errors.Is(err, ErrSessionMissing) {
+			return unauthorized(c, "session required", "el token no pertenece a una sesión, inicia sesión nuevamente")
+		}
+		if errors.Is(err, ErrSessionUnverified) {
+			c.Set(fiber.HeaderRetryAfter, "5")
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error":   "session check unavailable",
+				"message": "no se pudo verificar la sesión, reintenta en unos segundos",
+			})
+		}
+		return unauthorized(c, "invalid token", "token de autenticación inválido")
+	}
+
+	setClaims(c, claims)
+	return c.Next()
+}
+
+// OptionalAuth popula c.Locals si viene un token válido, pero permite
+// continuar de forma anónima (ej: reportes de incidentes)
+func OptionalAuth(secret SecretFunc) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tokenString := bearerToken(c)
+		if tokenString == "" {
+			return c.Next()
+		}
+
+		claims, err := ParseToken(tokenString, secret())
+		if err != nil {
+			log.Printf("⚠️ [AUTH] Token ignorado en ruta opcional %s: %v", c.Path(), err)
+			return c.Next()
+		}
+
+		setClaims(c, claims)
+		return c.Next()
+	}
+}
+
+// ClaimsFromCtx retorna los claims dejados por RequireAuth/OptionalAuth
+func ClaimsFromCtx(c *fiber.Ctx) (*Claims, bool) {
+	claims, ok := c.Locals(LocalClaims).(*Claims)
+	return claims, ok
+}
+
+// UserIDFromCtx retorna el ID del usuario autenticado
+func UserIDFromCtx(c *fiber.Ctx) (int64, bool) {
+	userID, ok := c.Locals(LocalUserID).(int64)
+	return userID, ok
+}
+
+func setClaims(c *fiber.Ctx, claims *Claims) {
+	userID, _ := claims.UserID()
+	c.Locals(LocalUserID, userID)
+	c.Locals(LocalUsername, claims.Username)
+	c.Locals(LocalClaims, claims)
+}
+
+func bearerToken(c *fiber.Ctx) string {
+	header := strings.TrimSpace(c.Get(fiber.HeaderAuthorization))
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
+
+func unauthorized(c *fiber.Ctx, errMsg, message string) error {
+	c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="wayfindcl"`)
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error":   errMsg,
+		"message": message,
+	})
+}
+
+// jwtLeeway lee JWT_LEEWAY (ej: "30s") para tolerar desfase de reloj
+func jwtLeeway() time.Duration {
+	if env := strings.TrimSpace(os.Getenv("JWT_LEEWAY")); env != "" {
+		if dur, err := time.ParseDuration(env); err == nil && dur >= 0 {
+			return dur
+		}
+	}
+	return defaultLeeway
+}
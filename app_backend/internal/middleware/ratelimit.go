@@ -63,3 +63,28 @@ func ScrapingRateLimiter() fiber.Handler {
 		},
 	})
 }
+
+// AnonymousVoteRateLimiter limita por IP los votos y confirmaciones sin login:
+// se identifican por un device_id que elige el cliente, así que sin límite
+// bastaría inventar IDs para mover la moderación. Va después de OptionalAuth;
+// los usuarios autenticados no cuentan.
+func AnonymousVoteRateLimiter() fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        10,               // 10 votos anónimos
+		Expiration: 10 * time.Minute, // cada 10 minutos
+		Next: func(c *fiber.Ctx) bool {
+			_, authenticated := UserIDFromCtx(c)
+			return authenticated
+		},
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error":       "rate limit exceeded",
+				"message":     "demasiados votos anónimos, inicia sesión o intenta en 10 minutos",
+				"retry_after": 600,
+			})
+		},
+	})
+}
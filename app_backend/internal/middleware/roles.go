@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/wayfindcl/internal/models"
+)
+
+// RequireRole exige que el usuario autenticado tenga al menos el rol indicado.
+// Va después de RequireAuth: sin claims responde 401, con un rol menor 403.
+func RequireRole(minimum models.Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := ClaimsFromCtx(c)
+		if !ok {
+			return unauthorized(c, "missing token", "se requiere autenticación")
+		}
+		if !claims.EffectiveRole().AtLeast(minimum) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "insufficient role",
+				"message": "se requiere el rol " + string(minimum),
+			})
+		}
+		return c.Next()
+	}
+}
+
+// RoleFromCtx retorna el rol del usuario autenticado (RoleUser si el token no trae rol)
+func RoleFromCtx(c *fiber.Ctx) (models.Role, bool) {
+	claims, ok := ClaimsFromCtx(c)
+	if !ok {
+		return "", false
+	}
+	return claims.EffectiveRole(), true
+}
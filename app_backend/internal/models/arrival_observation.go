@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// ArrivalObservation es una fila de la serie de tiempo de llegadas de Red.cl:
+// un bus visto acercándose a un paradero o, con Passed, uno que acaba de pasar
+type ArrivalObservation struct {
+	ID               int64     `json:"id" db:"id"`
+	StopCode         string    `json:"stop_code" db:"stop_code"`
+	Route            string    `json:"route" db:"route"`
+	ObservedAt       time.Time `json:"observed_at" db:"observed_at"`
+	DistanceMeters   *int      `json:"distance_m,omitempty" db:"distance_m"`
+	PredictedMinutes *int      `json:"predicted_minutes,omitempty" db:"predicted_minutes"`
+	Plate            *string   `json:"plate,omitempty" db:"plate"`
+	Passed           bool      `json:"passed" db:"passed"`
+}
+
+// ArrivalReliability son las métricas de una ruta en un paradero, para una
+// hora del día (Hour) o para todo el día (Hour nil). Los promedios quedan en
+// nil cuando no hay muestras.
+type ArrivalReliability struct {
+	StopCode string `json:"stop_code"`
+	Route    string `json:"route"`
+	Hour     *int   `json:"hour,omitempty"` // Hora local (America/Santiago), 0-23
+
+	// Minutos entre buses consecutivos: observado y según el GTFS
+	HeadwaySamples      int      `json:"headway_samples"`
+	ActualHeadwayMin    *float64 `json:"actual_headway_min,omitempty"`
+	ScheduledHeadwayMin *float64 `json:"scheduled_headway_min,omitempty"`
+	// HeadwayCV es la desviación estándar / promedio del headway observado
+	// (0 = buses perfectamente espaciados)
+	HeadwayCV *float64 `json:"headway_cv,omitempty"`
+
+	// Error de predicción en minutos (real - predicho; positivo = llegó más tarde)
+	PredictionSamples int      `json:"prediction_samples"`
+	PredictionBiasMin *float64 `json:"prediction_bias_min,omitempty"`
+	PredictionMAEMin  *float64 `json:"prediction_mae_min,omitempty"`
+	// PredictionOnTime es la fracción de predicciones con error de hasta 2 minutos
+	PredictionOnTime *float64 `json:"prediction_on_time,omitempty"`
+
+	// Score resume regularidad, cumplimiento del horario y precisión (0-100)
+	Score *float64 `json:"score,omitempty"`
+}
+
+// RouteReliability son las métricas de una ruta en un paradero para todo el
+// día y desglosadas por hora
+type RouteReliability struct {
+	ArrivalReliability
+	Hours []ArrivalReliability `json:"hours,omitempty"`
+}
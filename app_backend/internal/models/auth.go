@@ -4,8 +4,9 @@ import "time"
 
 // LoginRequest represents credentials provided by the client.
 type LoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	DeviceInfo string `json:"device_info,omitempty"`
 }
 
 // BiometricRegisterRequest represents biometric registration data
@@ -28,14 +29,18 @@ type UserDTO struct {
 	Username string `json:"username"`
 	Name     string `json:"name"`
 	Email    string `json:"email,omitempty"`
+	Role     Role   `json:"role,omitempty"`
 }
 
 // LoginResponse is returned upon successful authentication.
 type LoginResponse struct {
-	Token     string    `json:"token"`
-	User      UserDTO   `json:"user"`
-	ExpiresAt time.Time `json:"expires_at"`
-	Message   string    `json:"message,omitempty"` // Mensaje de bienvenida personalizado
+	Token            string    `json:"token"`
+	User             UserDTO   `json:"user"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token,omitempty"`      // Token rotativo para renovar el access token
+	RefreshExpiresAt time.Time `json:"refresh_expires_at,omitempty"` // Vencimiento de la sesión del dispositivo
+	SessionID        string    `json:"session_id,omitempty"`
+	Message          string    `json:"message,omitempty"` // Mensaje de bienvenida personalizado
 }
 
 // ErrorResponse is a simple error shape for API errors.
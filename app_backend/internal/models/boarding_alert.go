@@ -0,0 +1,83 @@
+package models
+
+import "time"
+
+// BoardingTrigger es cuándo avisar que se acerca el bus
+type BoardingTrigger string
+
+const (
+	BoardingTriggerMinutes  BoardingTrigger = "minutes"  // A N minutos o menos
+	BoardingTriggerDistance BoardingTrigger = "distance" // A N km o menos
+	BoardingTriggerArrived  BoardingTrigger = "arrived"  // Llegando al paradero
+)
+
+// BoardingAlertStatus es el estado de una alerta de abordaje
+type BoardingAlertStatus string
+
+const (
+	BoardingAlertWatching  BoardingAlertStatus = "watching"  // Esperando el umbral
+	BoardingAlertTriggered BoardingAlertStatus = "triggered" // Umbral cumplido, esperando la llegada
+	BoardingAlertArrived   BoardingAlertStatus = "arrived"   // El bus llegó (terminada)
+	BoardingAlertExpired   BoardingAlertStatus = "expired"   // Venció sin llegar (terminada)
+	BoardingAlertCancelled BoardingAlertStatus = "cancelled" // Cancelada por el usuario
+)
+
+// BoardingBus es el bus de la ruta más cercano al paradero en una consulta
+type BoardingBus struct {
+	DistanceKm float64 `json:"distance_km"`
+	Minutes    int     `json:"minutes"`
+	// MinutesEstimated indica que la fuente no informó minutos y se
+	// estimaron a partir de la distancia
+	MinutesEstimated bool   `json:"minutes_estimated,omitempty"`
+	Plate            string `json:"plate,omitempty"`
+}
+
+// BoardingAlert avisa a un usuario que espera en un paradero cuando su ruta
+// se acerca y cuando llega. Tras el umbral sigue vigilando hasta la llegada.
+type BoardingAlert struct {
+	ID          int64               `json:"id"`
+	UserID      int64               `json:"-"`
+	StopCode    string              `json:"stop_code"`
+	Route       string              `json:"route"`
+	Trigger     BoardingTrigger     `json:"trigger"`
+	Threshold   *float64            `json:"threshold,omitempty"` // Minutos o km según Trigger
+	Status      BoardingAlertStatus `json:"status"`
+	Bus         *BoardingBus        `json:"bus,omitempty"`        // Última posición conocida del bus
+	CheckedAt   *time.Time          `json:"checked_at,omitempty"` // Hora de la última consulta evaluada
+	CreatedAt   time.Time           `json:"created_at"`
+	ExpiresAt   time.Time           `json:"expires_at"`
+	TriggeredAt *time.Time          `json:"triggered_at,omitempty"`
+}
+
+// BoardingAlertRequest es la solicitud para crear una alerta de abordaje
+type BoardingAlertRequest struct {
+	StopCode         string          `json:"stop_code"`
+	Route            string          `json:"route"`
+	Trigger          BoardingTrigger `json:"trigger"`
+	Threshold        *float64        `json:"threshold,omitempty"`          // Default: 5 minutos o 1 km
+	ExpiresInMinutes *int            `json:"expires_in_minutes,omitempty"` // Default: 60, máx. 180
+}
+
+// BoardingEventKind es el tipo de un evento de alerta de abordaje (nombre del evento SSE)
+type BoardingEventKind string
+
+const (
+	BoardingEventUpdate    BoardingEventKind = "update"    // Cambió la estimación del bus más cercano
+	BoardingEventTriggered BoardingEventKind = "triggered" // Se cumplió el umbral
+	BoardingEventArrived   BoardingEventKind = "arrived"   // El bus está llegando al paradero
+	BoardingEventPassed    BoardingEventKind = "passed"    // Un bus pasó sin verse llegar; se espera el siguiente
+	BoardingEventExpired   BoardingEventKind = "expired"
+	BoardingEventCancelled BoardingEventKind = "cancelled"
+)
+
+// BoardingEvent es lo que recibe la app por el stream. Message está pensado
+// para leerse en voz alta (TalkBack/VoiceOver).
+type BoardingEvent struct {
+	AlertID  int64             `json:"alert_id"`
+	Kind     BoardingEventKind `json:"kind"`
+	StopCode string            `json:"stop_code"`
+	Route    string            `json:"route"`
+	Message  string            `json:"message"`
+	Bus      *BoardingBus      `json:"bus,omitempty"`
+	At       time.Time         `json:"at"`
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ContributionType es el tipo de aporte de la comunidad
+type ContributionType string
+
+const (
+	ContributionBusStatus         ContributionType = "bus_status"
+	ContributionRouteIssues       ContributionType = "route_issues"
+	ContributionStopInfo          ContributionType = "stop_info"
+	ContributionGeneralSuggestion ContributionType = "general_suggestion"
+)
+
+// Categorías de contribución que, al aprobarse, generan un incidente en la ruta
+const (
+	ContributionCategoryDelayed = "delayed"
+	ContributionCategoryDetour  = "detour"
+)
+
+// ContributionStatus es el estado de moderación de una contribución
+type ContributionStatus string
+
+const (
+	ContributionPending  ContributionStatus = "pending"
+	ContributionVerified ContributionStatus = "verified" // Aprobada por un moderador
+	ContributionRejected ContributionStatus = "rejected"
+	ContributionResolved ContributionStatus = "resolved" // El problema reportado ya se solucionó
+)
+
+// Contribution es un reporte o sugerencia de la comunidad
+type Contribution struct {
+	ID            int64              `json:"id" db:"id"`
+	UserID        *int64             `json:"user_id,omitempty" db:"user_id"` // nil = anónimo
+	Type          ContributionType   `json:"type" db:"type"`
+	Category      *string            `json:"category,omitempty" db:"category"`
+	Title         string             `json:"title" db:"title"`
+	Description   string             `json:"description" db:"description"`
+	Latitude      *float64           `json:"latitude,omitempty" db:"latitude"`
+	Longitude     *float64           `json:"longitude,omitempty" db:"longitude"`
+	BusRoute      *string            `json:"bus_route,omitempty" db:"bus_route"`
+	StopName      *string            `json:"stop_name,omitempty" db:"stop_name"`
+	DelayMinutes  *int               `json:"delay_minutes,omitempty" db:"delay_minutes"`
+	Severity      IncidentSeverity   `json:"severity" db:"severity"`
+	Status        ContributionStatus `json:"status" db:"status"`
+	ModeratorNote *string            `json:"moderator_note,omitempty" db:"moderator_note"`
+	ModeratedBy   *string            `json:"moderated_by,omitempty" db:"moderated_by"`
+	ModeratedAt   *time.Time         `json:"moderated_at,omitempty" db:"moderated_at"`
+	IncidentID    *int64             `json:"incident_id,omitempty" db:"incident_id"` // Incidente generado al aprobar
+	Upvotes       int                `json:"upvotes" db:"upvotes"`
+	Downvotes     int                `json:"downvotes" db:"downvotes"`
+	ContactEmail  *string            `json:"contact_email,omitempty" db:"contact_email"`
+	DeviceInfo    json.RawMessage    `json:"device_info,omitempty" db:"device_info"`
+	CreatedAt     time.Time          `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at" db:"updated_at"`
+}
+
+// Public oculta los datos de contacto, del dispositivo y del moderador para terceros
+func (c Contribution) Public() Contribution {
+	c.ContactEmail = nil
+	c.ModeratedBy = nil
+	c.DeviceInfo = nil
+	c.UserID = nil
+	return c
+}
+
+// ContributionCreateRequest representa la solicitud para crear una contribución
+type ContributionCreateRequest struct {
+	Type         ContributionType `json:"type" validate:"required,oneof=bus_status route_issues stop_info general_suggestion"`
+	Category     *string          `json:"category,omitempty"`
+	Title        string           `json:"title" validate:"required,max=255"`
+	Description  string           `json:"description" validate:"required"`
+	Latitude     *float64         `json:"latitude,omitempty"`
+	Longitude    *float64         `json:"longitude,omitempty"`
+	BusRoute     *string          `json:"bus_route,omitempty"`
+	StopName     *string          `json:"stop_name,omitempty"`
+	DelayMinutes *int             `json:"delay_minutes,omitempty" validate:"omitempty,min=0"`
+	Severity     IncidentSeverity `json:"severity,omitempty"`
+	ContactEmail *string          `json:"contact_email,omitempty" validate:"omitempty,email"`
+	DeviceInfo   json.RawMessage  `json:"device_info,omitempty"`
+}
+
+// ContributionUpdateRequest edita una contribución pendiente (campos presentes)
+type ContributionUpdateRequest struct {
+	Category     *string           `json:"category,omitempty"`
+	Title        *string           `json:"title,omitempty"`
+	Description  *string           `json:"description,omitempty"`
+	Latitude     *float64          `json:"latitude,omitempty"`
+	Longitude    *float64          `json:"longitude,omitempty"`
+	BusRoute     *string           `json:"bus_route,omitempty"`
+	StopName     *string           `json:"stop_name,omitempty"`
+	DelayMinutes *int              `json:"delay_minutes,omitempty"`
+	Severity     *IncidentSeverity `json:"severity,omitempty"`
+	ContactEmail *string           `json:"contact_email,omitempty"`
+}
+
+// Apply copia a la contribución los campos presentes en req
+func (c *Contribution) Apply(req ContributionUpdateRequest) {
+	if req.Category != nil {
+		c.Category = req.Category
+	}
+	if req.Title != nil {
+		c.Title = *req.Title
+	}
+	if req.Description != nil {
+		c.Description = *req.Description
+	}
+	if req.Latitude != nil {
+		c.Latitude = req.Latitude
+	}
+	if req.Longitude != nil {
+		c.Longitude = req.Longitude
+	}
+	if req.BusRoute != nil {
+		c.BusRoute = req.BusRoute
+	}
+	if req.StopName != nil {
+		c.StopName = req.StopName
+	}
+	if req.DelayMinutes != nil {
+		c.DelayMinutes = req.DelayMinutes
+	}
+	if req.Severity != nil {
+		c.Severity = *req.Severity
+	}
+	if req.ContactEmail != nil {
+		c.ContactEmail = req.ContactEmail
+	}
+}
+
+// ContributionModerationRequest acompaña una decisión de moderación
+type ContributionModerationRequest struct {
+	Note string `json:"note,omitempty"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DebugEventKind distingue qué endpoint de /api/debug originó el evento
+type DebugEventKind string
+
+const (
+	DebugEventLog        DebugEventKind = "log"
+	DebugEventError      DebugEventKind = "error"
+	DebugEventNavigation DebugEventKind = "navigation"
+)
+
+// DebugEvent es un log, error o evento de navegación de la app Flutter
+type DebugEvent struct {
+	ID          int64           `json:"id" db:"id"`
+	Kind        DebugEventKind  `json:"kind" db:"kind"`
+	Level       string          `json:"level" db:"level"`
+	DeviceID    string          `json:"device_id,omitempty" db:"device_id"`
+	SessionID   string          `json:"session_id,omitempty" db:"session_id"`
+	UserID      *int64          `json:"user_id,omitempty" db:"user_id"`
+	EventType   string          `json:"event_type,omitempty" db:"event_type"`
+	Message     string          `json:"message" db:"message"`
+	StackTrace  string          `json:"stack_trace,omitempty" db:"stack_trace"`
+	Fingerprint string          `json:"fingerprint,omitempty" db:"fingerprint"`
+	Metadata    json.RawMessage `json:"metadata,omitempty" db:"metadata"`
+	OccurredAt  time.Time       `json:"occurred_at" db:"occurred_at"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+}
+
+// DebugIssue agrupa los errores con el mismo fingerprint (stack normalizado)
+type DebugIssue struct {
+	Fingerprint string    `json:"fingerprint"`
+	ErrorType   string    `json:"error_type,omitempty"`
+	Message     string    `json:"message"`               // Del error más reciente
+	StackTrace  string    `json:"stack_trace,omitempty"` // Del error más reciente
+	LastEventID int64     `json:"last_event_id"`
+	Count       int       `json:"count"`
+	Devices     int       `json:"devices"`  // Dispositivos distintos afectados
+	Sessions    int       `json:"sessions"` // Sesiones distintas afectadas
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+}
@@ -20,10 +20,52 @@ type GTFSStop = Stop
 
 // GTFSSummary contains metadata about the last imported feed.
 type GTFSSummary struct {
-	FeedVersion   string    `json:"feed_version,omitempty"`
-	StopsImported int       `json:"stops_imported"`
-	DownloadedAt  time.Time `json:"downloaded_at"`
-	SourceURL     string    `json:"source_url"`
+	FeedVersion           string    `json:"feed_version,omitempty"`
+	StopsImported         int       `json:"stops_imported"`
+	RoutesImported        int       `json:"routes_imported"`
+	TripsImported         int       `json:"trips_imported"`
+	StopTimesImported     int       `json:"stop_times_imported"`
+	CalendarsImported     int       `json:"calendars_imported"`
+	CalendarDatesImported int       `json:"calendar_dates_imported"`
+	ShapePointsImported   int       `json:"shape_points_imported"`
+	FrequenciesImported   int       `json:"frequencies_imported"`
+	TransfersImported     int       `json:"transfers_imported"`
+	DownloadedAt          time.Time `json:"downloaded_at"`
+	SourceURL             string    `json:"source_url"`
+
+	FeedID       int64            `json:"feed_id,omitempty"`
+	Skipped      bool             `json:"skipped"`
+	ChangedFiles []string         `json:"changed_files,omitempty"`
+	Changes      GTFSChangeReport `json:"changes"`
+
+	Validation *GTFSValidationSummary `json:"validation,omitempty"`
+}
+
+// GTFSValidationSummary condenses the validator report (full report in /api/stats/gtfs).
+type GTFSValidationSummary struct {
+	Valid        bool           `json:"valid"`
+	ErrorCount   int            `json:"error_count"`
+	WarningCount int            `json:"warning_count"`
+	Counts       map[string]int `json:"counts"`
+}
+
+// GTFSChangeSet lists added, removed and modified IDs (lists truncated, counts exact).
+type GTFSChangeSet struct {
+	AddedCount    int      `json:"added_count"`
+	RemovedCount  int      `json:"removed_count"`
+	ModifiedCount int      `json:"modified_count"`
+	Added         []string `json:"added,omitempty"`
+	Removed       []string `json:"removed,omitempty"`
+	Modified      []string `json:"modified,omitempty"`
+	Truncated     bool     `json:"truncated,omitempty"`
+}
+
+// GTFSChangeReport describes what changed between the previous and the new feed.
+type GTFSChangeReport struct {
+	Stops                   GTFSChangeSet `json:"stops"`
+	Routes                  GTFSChangeSet `json:"routes"`
+	Trips                   GTFSChangeSet `json:"trips"`
+	StopTimesTripsRewritten int           `json:"stop_times_trips_rewritten"`
 }
 
 // GTFSSyncResponse is returned by the sync endpoint.
@@ -9,6 +9,7 @@ const (
 	IncidentBusFull          IncidentType = "bus_full"
 	IncidentBusDelayed       IncidentType = "bus_delayed"
 	IncidentBusNotRunning    IncidentType = "bus_not_running"
+	IncidentBusDetour        IncidentType = "bus_detour"
 	IncidentStopOutOfService IncidentType = "stop_out_of_service"
 	IncidentStopDamaged      IncidentType = "stop_damaged"
 	IncidentUnsafeArea       IncidentType = "unsafe_area"
@@ -26,22 +27,74 @@ const (
 	SeverityCritical IncidentSeverity = "critical"
 )
 
+// IncidentStatus es el estado del ciclo de vida de un incidente
+type IncidentStatus string
+
+const (
+	IncidentStatusActive   IncidentStatus = "active"
+	IncidentStatusResolved IncidentStatus = "resolved" // Confirmado como terminado
+	IncidentStatusExpired  IncidentStatus = "expired"  // Venció su TTL sin nuevas confirmaciones
+	IncidentStatusHidden   IncidentStatus = "hidden"   // Ocultado por votos negativos
+)
+
+// incidentTTLs es cuánto sigue vigente un reporte sin nuevas confirmaciones:
+// minutos para situaciones del bus, días para infraestructura dañada
+var incidentTTLs = map[IncidentType]time.Duration{
+	IncidentBusFull:          20 * time.Minute,
+	IncidentBusDelayed:       45 * time.Minute,
+	IncidentBusNotRunning:    3 * time.Hour,
+	IncidentBusDetour:        12 * time.Hour,
+	IncidentUnsafeArea:       12 * time.Hour,
+	IncidentStopOutOfService: 3 * 24 * time.Hour,
+	IncidentStopDamaged:      7 * 24 * time.Hour,
+	IncidentAccessibility:    7 * 24 * time.Hour,
+	IncidentOther:            6 * time.Hour,
+}
+
+// TTL retorna la vigencia por defecto del tipo (la de "other" si es desconocido)
+func (t IncidentType) TTL() time.Duration {
+	if ttl, ok := incidentTTLs[t]; ok {
+		return ttl
+	}
+	return incidentTTLs[IncidentOther]
+}
+
+// Valid indica si t es uno de los tipos conocidos (todos tienen TTL propio)
+func (t IncidentType) Valid() bool {
+	_, ok := incidentTTLs[t]
+	return ok
+}
+
+// Valid indica si s es una de las severidades conocidas
+func (s IncidentSeverity) Valid() bool {
+	switch s {
+	case SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical:
+		return true
+	}
+	return false
+}
+
 // Incident representa un incidente reportado por un usuario
 type Incident struct {
-	ID          int64            `json:"id" db:"id"`
-	Type        IncidentType     `json:"type" db:"type"`
-	Latitude    float64          `json:"latitude" db:"latitude"`
-	Longitude   float64          `json:"longitude" db:"longitude"`
-	Severity    IncidentSeverity `json:"severity" db:"severity"`
-	ReporterID  string           `json:"reporter_id" db:"reporter_id"`
-	RouteName   *string          `json:"route_name,omitempty" db:"route_name"`
-	StopName    *string          `json:"stop_name,omitempty" db:"stop_name"`
-	Description *string          `json:"description,omitempty" db:"description"`
-	IsVerified  bool             `json:"is_verified" db:"is_verified"`
-	Upvotes     int              `json:"upvotes" db:"upvotes"`
-	Downvotes   int              `json:"downvotes" db:"downvotes"`
-	CreatedAt   time.Time        `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time        `json:"updated_at" db:"updated_at"`
+	ID            int64            `json:"id" db:"id"`
+	Type          IncidentType     `json:"type" db:"type"`
+	Latitude      float64          `json:"latitude" db:"latitude"`
+	Longitude     float64          `json:"longitude" db:"longitude"`
+	Severity      IncidentSeverity `json:"severity" db:"severity"`
+	Status        IncidentStatus   `json:"status" db:"status"`
+	ReporterID    string           `json:"reporter_id" db:"reporter_id"`
+	RouteName     *string          `json:"route_name,omitempty" db:"route_name"`
+	StopName      *string          `json:"stop_name,omitempty" db:"stop_name"`
+	Description   *string          `json:"description,omitempty" db:"description"`
+	IsVerified    bool             `json:"is_verified" db:"is_verified"`
+	IsHidden      bool             `json:"is_hidden" db:"is_hidden"` // Ocultado por votos negativos
+	Upvotes       int              `json:"upvotes" db:"upvotes"`
+	Downvotes     int              `json:"downvotes" db:"downvotes"`
+	WeightedScore float64          `json:"weighted_score" db:"weighted_score"` // Suma de votos ponderados por reputación
+	CreatedAt     time.Time        `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at" db:"updated_at"`
+	ExpiresAt     time.Time        `json:"expires_at" db:"expires_at"`
+	ResolvedAt    *time.Time       `json:"resolved_at,omitempty" db:"resolved_at"`
 }
 
 // IncidentCreateRequest representa la solicitud para crear un incidente
@@ -58,14 +111,71 @@ type IncidentCreateRequest struct {
 // IncidentVoteRequest representa una votación en un incidente
 type IncidentVoteRequest struct {
 	VoteType string `json:"vote_type" validate:"required,oneof=upvote downvote"`
+	DeviceID string `json:"device_id,omitempty"` // Requerido para votos anónimos (o header X-Device-ID)
+}
+
+// IncidentConfirmRequest confirma si un incidente sigue vigente
+type IncidentConfirmRequest struct {
+	StillThere *bool  `json:"still_there" validate:"required"`
+	DeviceID   string `json:"device_id,omitempty"` // Requerido para confirmaciones anónimas (o header X-Device-ID)
+}
+
+// IncidentConfirmation es la confirmación vigente de un usuario o dispositivo
+type IncidentConfirmation struct {
+	IncidentID int64  `json:"incident_id"`
+	VoterKey   string `json:"voter_key"`
+	StillThere bool   `json:"still_there"`
+}
+
+// IncidentVote es el voto vigente de un usuario o dispositivo sobre un incidente
+type IncidentVote struct {
+	IncidentID int64   `json:"incident_id"`
+	VoterKey   string  `json:"voter_key"` // "user:<id>" o "device:<id>"
+	Vote       int     `json:"vote"`      // 1 upvote, -1 downvote
+	Weight     float64 `json:"weight"`    // Peso según la reputación del votante al votar
+}
+
+// Acciones de moderación automática registradas en la auditoría
+const (
+	ModerationVerified   = "verified"
+	ModerationUnverified = "unverified"
+	ModerationHidden     = "hidden"
+	ModerationUnhidden   = "unhidden"
+)
+
+// IncidentModerationEntry es un cambio de verificación/visibilidad de un incidente
+type IncidentModerationEntry struct {
+	ID            int64     `json:"id"`
+	IncidentID    int64     `json:"incident_id"`
+	Action        string    `json:"action"`
+	WeightedScore float64   `json:"weighted_score"`
+	Upvotes       int       `json:"upvotes"`
+	Downvotes     int       `json:"downvotes"`
+	TriggerVoter  string    `json:"trigger_voter,omitempty"` // Voto que cruzó el umbral
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ReporterReputation resume cómo fueron votados los reportes de un usuario
+type ReporterReputation struct {
+	ReporterID string  `json:"reporter_id"`
+	Reports    int     `json:"reports"`
+	Upvotes    int     `json:"upvotes_received"`
+	Downvotes  int     `json:"downvotes_received"`
+	Verified   int     `json:"verified_reports"`
+	Hidden     int     `json:"hidden_reports"`
+	Score      float64 `json:"score"`       // 0.0 - 1.0 (0.5 = neutral)
+	VoteWeight float64 `json:"vote_weight"` // Peso de sus votos sobre otros incidentes
 }
 
 // IncidentStats representa estadísticas de incidentes
 type IncidentStats struct {
-	TotalIncidents  int                      `json:"total_incidents"`
-	ByType          map[IncidentType]int     `json:"by_type"`
-	BySeverity      map[IncidentSeverity]int `json:"by_severity"`
-	VerifiedCount   int                      `json:"verified_count"`
-	Last24Hours     int                      `json:"last_24_hours"`
-	MostReportedRoute *string                `json:"most_reported_route,omitempty"`
+	TotalIncidents    int                      `json:"total_incidents"`
+	ByType            map[IncidentType]int     `json:"by_type"`
+	BySeverity        map[IncidentSeverity]int `json:"by_severity"`
+	VerifiedCount     int                      `json:"verified_count"`
+	HiddenCount       int                      `json:"hidden_count"`
+	ActiveCount       int                      `json:"active_count"`
+	ByStatus          map[IncidentStatus]int   `json:"by_status"`
+	Last24Hours       int                      `json:"last_24_hours"`
+	MostReportedRoute *string                  `json:"most_reported_route,omitempty"` // Entre los incidentes activos
 }
@@ -4,16 +4,28 @@ import "time"
 
 // LocationShare representa un compartir de ubicación en tiempo real
 type LocationShare struct {
-	ID            string    `json:"id" db:"id"`
-	UserID        int64     `json:"user_id" db:"user_id"`
-	Latitude      float64   `json:"latitude" db:"latitude"`
-	Longitude     float64   `json:"longitude" db:"longitude"`
-	RecipientName *string   `json:"recipient_name,omitempty" db:"recipient_name"`
-	Message       *string   `json:"message,omitempty" db:"message"`
-	CreatedAt     time.Time `json:"created_at" db:"created_at"`
-	ExpiresAt     time.Time `json:"expires_at" db:"expires_at"`
-	IsActive      bool      `json:"is_active" db:"is_active"`
-	LastUpdatedAt time.Time `json:"last_updated_at" db:"last_updated_at"`
+	ID          string     `json:"id" db:"id"`
+	UserID      int64      `json:"user_id,omitempty" db:"user_id"` // Se omite para los receptores
+	Latitude    float64    `json:"latitude" db:"latitude"`
+	Longitude   float64    `json:"longitude" db:"longitude"`
+	Heading     *float64   `json:"heading,omitempty" db:"heading"`     // Grados desde el norte
+	Speed       *float64   `json:"speed,omitempty" db:"speed"`         // m/s
+	BusRoute    *string    `json:"bus_route,omitempty" db:"bus_route"` // Viaje activo, si lo hay
+	NextStop    *string    `json:"next_stop,omitempty" db:"next_stop"`
+	NextStopETA *time.Time `json:"next_stop_eta,omitempty" db:"next_stop_eta"`
+	// Destino y ruta planificada opcionales para las alertas del recorrido
+	DestinationLat      *float64    `json:"destination_lat,omitempty" db:"destination_lat"`
+	DestinationLon      *float64    `json:"destination_lon,omitempty" db:"destination_lon"`
+	DestinationName     *string     `json:"destination_name,omitempty" db:"destination_name"`
+	PlannedRoute        [][]float64 `json:"planned_route,omitempty" db:"planned_route"` // [lon, lat]
+	DeviationThresholdM *float64    `json:"deviation_threshold_m,omitempty" db:"deviation_threshold_m"`
+	StationaryMinutes   *int        `json:"stationary_minutes,omitempty" db:"stationary_minutes"`
+	RecipientName       *string     `json:"recipient_name,omitempty" db:"recipient_name"`
+	Message             *string     `json:"message,omitempty" db:"message"`
+	CreatedAt           time.Time   `json:"created_at" db:"created_at"`
+	ExpiresAt           time.Time   `json:"expires_at" db:"expires_at"`
+	IsActive            bool        `json:"is_active" db:"is_active"`
+	LastUpdatedAt       time.Time   `json:"last_updated_at" db:"last_updated_at"`
 }
 
 // LocationShareCreateRequest representa la solicitud para crear un share
@@ -23,12 +35,43 @@ type LocationShareCreateRequest struct {
 	RecipientName *string `json:"recipient_name,omitempty"`
 	Message       *string `json:"message,omitempty"`
 	DurationHours int     `json:"duration_hours" validate:"required,min=1,max=24"`
+	// PIN opcional (4-8 dígitos) del primer receptor (recipient_name)
+	PIN *string `json:"pin,omitempty"`
+	// Opcionales: activan las alertas de llegada, desvío y detención
+	Destination         *ShareDestination `json:"destination,omitempty"`
+	PlannedRoute        [][]float64       `json:"planned_route,omitempty"` // [lon, lat]
+	DeviationThresholdM *float64          `json:"deviation_threshold_m,omitempty"`
+	StationaryMinutes   *int              `json:"stationary_minutes,omitempty"`
 }
 
-// LocationShareUpdateRequest representa la actualización de ubicación
+// ShareDestination es el destino de un share
+type ShareDestination struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      *string `json:"name,omitempty"`
+}
+
+// LocationShareUpdateRequest representa la actualización de ubicación. Los
+// campos del viaje se omiten cuando no hay uno activo (se borran del share).
 type LocationShareUpdateRequest struct {
-	Latitude  float64 `json:"latitude" validate:"required,latitude"`
-	Longitude float64 `json:"longitude" validate:"required,longitude"`
+	Latitude   float64  `json:"latitude" validate:"required,latitude"`
+	Longitude  float64  `json:"longitude" validate:"required,longitude"`
+	Heading    *float64 `json:"heading,omitempty"` // Grados desde el norte
+	Speed      *float64 `json:"speed,omitempty"`   // m/s
+	BusRoute   *string  `json:"bus_route,omitempty"`
+	NextStop   *string  `json:"next_stop,omitempty"`
+	ETASeconds *int     `json:"eta_seconds,omitempty"` // Hasta llegar a next_stop
+}
+
+// SharePosition es lo que cambia en cada actualización de un share
+type SharePosition struct {
+	Latitude    float64
+	Longitude   float64
+	Heading     *float64
+	Speed       *float64
+	BusRoute    *string
+	NextStop    *string
+	NextStopETA *time.Time
 }
 
 // LocationShareResponse representa la respuesta con datos del share
@@ -36,4 +79,90 @@ type LocationShareResponse struct {
 	*LocationShare
 	ShareURL      string `json:"share_url"`
 	TimeRemaining int64  `json:"time_remaining_seconds"`
+	// Receptor creado junto con el share; el token sólo se entrega aquí
+	RecipientID int64  `json:"recipient_id"`
+	Token       string `json:"token"`
+}
+
+// Monitored indica si el share tiene destino, ruta o detención que vigilar
+func (s *LocationShare) Monitored() bool {
+	return s.DestinationLat != nil || len(s.PlannedRoute) > 1 ||
+		(s.StationaryMinutes != nil && *s.StationaryMinutes > 0)
+}
+
+// SharePoint es un punto del recorrido (breadcrumb) de un share
+type SharePoint struct {
+	ID         int64     `json:"id" db:"id"`
+	ShareID    string    `json:"-" db:"share_id"`
+	Latitude   float64   `json:"latitude" db:"latitude"`
+	Longitude  float64   `json:"longitude" db:"longitude"`
+	Heading    *float64  `json:"heading,omitempty" db:"heading"`
+	Speed      *float64  `json:"speed,omitempty" db:"speed"`
+	RecordedAt time.Time `json:"recorded_at" db:"recorded_at"`
+}
+
+// ShareAlertKind es el tipo de alerta de un share
+type ShareAlertKind string
+
+const (
+	ShareAlertArrived     ShareAlertKind = "arrived"
+	ShareAlertOffRoute    ShareAlertKind = "off_route"
+	ShareAlertBackOnRoute ShareAlertKind = "back_on_route"
+	ShareAlertStationary  ShareAlertKind = "stationary"
+)
+
+// ShareAlert es un aviso para quienes siguen el share (llegada, desvío, detención)
+type ShareAlert struct {
+	ID             int64          `json:"id" db:"id"`
+	ShareID        string         `json:"share_id" db:"share_id"`
+	Kind           ShareAlertKind `json:"kind" db:"kind"`
+	Message        string         `json:"message" db:"message"`
+	Latitude       float64        `json:"latitude" db:"latitude"`
+	Longitude      float64        `json:"longitude" db:"longitude"`
+	DistanceMeters *float64       `json:"distance_m,omitempty" db:"distance_m"`
+	CreatedAt      time.Time      `json:"created_at" db:"created_at"`
+}
+
+// ShareRecipient es un receptor de un share: accede con su propio token
+// (sólo se guarda el hash) y opcionalmente un PIN
+type ShareRecipient struct {
+	ID           int64      `json:"id" db:"id"`
+	ShareID      string     `json:"share_id" db:"share_id"`
+	Label        *string    `json:"label,omitempty" db:"label"`
+	TokenHash    string     `json:"-" db:"token_hash"`
+	PINHash      *string    `json:"-" db:"pin_hash"`
+	HasPIN       bool       `json:"has_pin" db:"-"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	LastAccessAt *time.Time `json:"last_access_at,omitempty" db:"last_access_at"`
+}
+
+// ShareRecipientRequest crea un receptor nuevo para un share
+type ShareRecipientRequest struct {
+	Label *string `json:"label,omitempty"`
+	PIN   *string `json:"pin,omitempty"` // 4-8 dígitos
+}
+
+// ShareAccessOutcome es el resultado de un intento de ver un share
+type ShareAccessOutcome string
+
+const (
+	ShareAccessGranted     ShareAccessOutcome = "granted"
+	ShareAccessPINRequired ShareAccessOutcome = "pin_required"
+	ShareAccessBadPIN      ShareAccessOutcome = "bad_pin"
+	ShareAccessLocked      ShareAccessOutcome = "locked"
+	ShareAccessRevoked     ShareAccessOutcome = "revoked"
+	ShareAccessEnded       ShareAccessOutcome = "ended" // Share detenido o expirado
+)
+
+// ShareAccess es una entrada del registro de accesos de un share
+type ShareAccess struct {
+	ID          int64              `json:"id" db:"id"`
+	ShareID     string             `json:"share_id" db:"share_id"`
+	RecipientID *int64             `json:"recipient_id,omitempty" db:"recipient_id"`
+	Via         string             `json:"via" db:"via"` // page, api, stream
+	Outcome     ShareAccessOutcome `json:"outcome" db:"outcome"`
+	IPAddress   *string            `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent   *string            `json:"user_agent,omitempty" db:"user_agent"`
+	CreatedAt   time.Time          `json:"created_at" db:"created_at"`
 }
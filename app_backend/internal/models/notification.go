@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// NotificationIncident es el tipo de notificación por un incidente nuevo
+const NotificationIncident = "incident"
+
+// priorityRanks ordena las prioridades (severidades) de notificación
+var priorityRanks = map[string]int{
+	string(SeverityLow):      1,
+	string(SeverityMedium):   2,
+	string(SeverityHigh):     3,
+	string(SeverityCritical): 4,
+}
+
+// PriorityRank retorna el orden de una prioridad (low < medium < high < critical);
+// valores desconocidos cuentan como medium
+func PriorityRank(priority string) int {
+	if rank, ok := priorityRanks[priority]; ok {
+		return rank
+	}
+	return priorityRanks[string(SeverityMedium)]
+}
+
+// NotificationChannels son los canales que el cliente debe usar al mostrarla,
+// según las preferencias del usuario al momento de enviarla
+type NotificationChannels struct {
+	Audio     bool `json:"audio"`
+	Vibration bool `json:"vibration"`
+	Visual    bool `json:"visual"`
+}
+
+// Notification es un aviso para un usuario (bandeja in-app y webhook)
+type Notification struct {
+	ID             int64                `json:"id" db:"id"`
+	UserID         int64                `json:"user_id" db:"user_id"`
+	Kind           string               `json:"kind" db:"kind"`
+	IncidentID     *int64               `json:"incident_id,omitempty" db:"incident_id"`
+	SubscriptionID *int64               `json:"subscription_id,omitempty" db:"subscription_id"`
+	Title          string               `json:"title" db:"title"`
+	Body           string               `json:"body" db:"body"`
+	Priority       string               `json:"priority" db:"priority"`
+	Channels       NotificationChannels `json:"channels"`
+	ReadAt         *time.Time           `json:"read_at,omitempty" db:"read_at"`
+	CreatedAt      time.Time            `json:"created_at" db:"created_at"`
+}
+
+// NotificationReadRequest marca notificaciones como leídas (vacío = todas)
+type NotificationReadRequest struct {
+	IDs []int64 `json:"ids,omitempty"`
+}
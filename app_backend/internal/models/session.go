@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// UserSession representa un dispositivo/sesión con refresh token activo
+type UserSession struct {
+	ID         string     `json:"id" db:"id"`
+	UserID     int64      `json:"user_id" db:"user_id"`
+	DeviceInfo *string    `json:"device_info,omitempty" db:"device_info"`
+	IPAddress  *string    `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent  *string    `json:"user_agent,omitempty" db:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at" db:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	IsCurrent  bool       `json:"is_current"`
+}
+
+// RefreshTokenRequest representa la solicitud para rotar un refresh token
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshTokenResponse contiene el nuevo par de tokens tras la rotación
+type RefreshTokenResponse struct {
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	SessionID        string    `json:"session_id"`
+}
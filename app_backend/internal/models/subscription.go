@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// SubscriptionKind indica qué sigue una suscripción
+type SubscriptionKind string
+
+const (
+	SubscriptionRoute SubscriptionKind = "route" // Incidentes con ese route_name
+	SubscriptionStop  SubscriptionKind = "stop"  // Incidentes con ese stop_name
+	SubscriptionArea  SubscriptionKind = "area"  // Incidentes dentro del radio
+)
+
+// IncidentSubscription representa el interés de un usuario en una ruta, paradero o zona
+type IncidentSubscription struct {
+	ID        int64            `json:"id" db:"id"`
+	UserID    int64            `json:"user_id" db:"user_id"`
+	Kind      SubscriptionKind `json:"kind" db:"kind"`
+	RouteName *string          `json:"route_name,omitempty" db:"route_name"`
+	StopName  *string          `json:"stop_name,omitempty" db:"stop_name"`
+	Latitude  *float64         `json:"latitude,omitempty" db:"latitude"`
+	Longitude *float64         `json:"longitude,omitempty" db:"longitude"`
+	RadiusM   *float64         `json:"radius_m,omitempty" db:"radius_m"`
+	Label     *string          `json:"label,omitempty" db:"label"`
+	CreatedAt time.Time        `json:"created_at" db:"created_at"`
+}
+
+// IncidentSubscriptionCreateRequest representa la solicitud para suscribirse
+type IncidentSubscriptionCreateRequest struct {
+	Kind      SubscriptionKind `json:"kind" validate:"required,oneof=route stop area"`
+	RouteName *string          `json:"route_name,omitempty"`
+	StopName  *string          `json:"stop_name,omitempty"`
+	Latitude  *float64         `json:"latitude,omitempty"`
+	Longitude *float64         `json:"longitude,omitempty"`
+	RadiusM   *float64         `json:"radius_m,omitempty" validate:"omitempty,min=50,max=5000"`
+	Label     *string          `json:"label,omitempty"`
+}
@@ -110,3 +110,12 @@ type TransitRouteResponse struct {
 	Raw             map[string]any       `json:"raw,omitempty"`
 	Paths           []TransitPath        `json:"paths,omitempty"` // Para compatibilidad con GraphHopper
 }
+
+// NativeTransitRouteRequest is the payload accepted by the in-process RAPTOR router.
+type NativeTransitRouteRequest struct {
+	Origin          Coordinate    `json:"origin"`
+	Destination     Coordinate    `json:"destination"`
+	DepartureTime   *FlexibleTime `json:"departure_time,omitempty"`
+	MaxWalkDistance float64       `json:"max_walk_distance,omitempty"` // metros de acceso/egreso
+	MaxTransfers    *int          `json:"max_transfers,omitempty"`
+}
@@ -1,17 +1,52 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 // User represents a user record in DB (internal use only).
 type User struct {
-	ID           int64     `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	Name         string    `json:"name"`
-	PasswordHash string    `json:"-"`
-	BiometricID  string    `json:"-"` // SHA-256 hash del dispositivo biométrico
-	AuthType     string    `json:"auth_type"` // "password" o "biometric"
-	CreatedAt    time.Time `json:"created_at"`
+	ID           int64      `json:"id"`
+	Username     string     `json:"username"`
+	Email        string     `json:"email"`
+	Name         string     `json:"name"`
+	PasswordHash string     `json:"-"`
+	BiometricID  string     `json:"-"`         // SHA-256 hash del dispositivo biométrico
+	AuthType     string     `json:"auth_type"` // "password" o "biometric"
+	Role         Role       `json:"role"`
+	DeviceInfo   string     `json:"device_info,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastLogin    *time.Time `json:"last_login,omitempty"`
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"` // Cuenta deshabilitada por un administrador
+}
+
+// Role es el nivel de acceso del usuario; cada rol incluye los permisos de los anteriores
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator" // Modera contribuciones de la comunidad
+	RoleAdmin     Role = "admin"     // Dashboard, estadísticas y debug
+)
+
+var roleRank = map[Role]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// ParseRole valida un rol recibido como texto
+func ParseRole(s string) (Role, bool) {
+	role := Role(strings.ToLower(strings.TrimSpace(s)))
+	_, ok := roleRank[role]
+	return role, ok
+}
+
+// AtLeast indica si el rol tiene los permisos de minimum (un rol desconocido no tiene ninguno)
+func (r Role) AtLeast(minimum Role) bool {
+	rank, ok := roleRank[r]
+	return ok && rank >= roleRank[minimum]
 }
 
 // RegisterRequest holds the data for creating a new user.
@@ -21,4 +56,5 @@ type RegisterRequest struct {
 	Password       string `json:"password"`
 	Name           string `json:"name"`
 	BiometricToken string `json:"biometric_token,omitempty"` // Token del dispositivo biométrico
+	DeviceInfo     string `json:"device_info,omitempty"`
 }
@@ -173,6 +173,12 @@ func (s *Scraper) SetDB(db *sql.DB) {
 	s.db = db
 }
 
+// ClearCache descarta las rutas y el HTML cacheados
+func (s *Scraper) ClearCache() {
+	s.cache = make(map[string]*RedBusRoute)
+	s.htmlCache = make(map[string]HTMLCacheEntry)
+}
+
 // SetGeometryService configura el servicio de geometría (GraphHopper)
 func (s *Scraper) SetGeometryService(service GeometryService) {
 	s.geometryService = service
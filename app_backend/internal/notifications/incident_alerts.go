@@ -0,0 +1,154 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/repository"
+)
+
+// incidentLabels son los títulos legibles de cada tipo de incidente
+var incidentLabels = map[models.IncidentType]string{
+	models.IncidentBusFull:          "Bus lleno",
+	models.IncidentBusDelayed:       "Bus retrasado",
+	models.IncidentBusNotRunning:    "Bus fuera de servicio",
+	models.IncidentBusDetour:        "Desvío de recorrido",
+	models.IncidentStopOutOfService: "Paradero fuera de servicio",
+	models.IncidentStopDamaged:      "Paradero dañado",
+	models.IncidentUnsafeArea:       "Zona insegura",
+	models.IncidentAccessibility:    "Problema de accesibilidad",
+	models.IncidentOther:            "Incidente reportado",
+}
+
+// IncidentAlerts avisa a los usuarios suscritos (ruta, paradero o zona) cuando
+// se reporta un incidente, respetando sus preferencias de notificación
+type IncidentAlerts struct {
+	subs     repository.SubscriptionRepository
+	prefs    repository.PreferencesRepository
+	notifier Notifier
+}
+
+func NewIncidentAlerts(subs repository.SubscriptionRepository, prefs repository.PreferencesRepository, notifier Notifier) *IncidentAlerts {
+	return &IncidentAlerts{subs: subs, prefs: prefs, notifier: notifier}
+}
+
+// IncidentCreated notifica una vez a cada usuario con una suscripción que cubre
+// el incidente (salvo a quien lo reportó). Se omiten los usuarios cuya
+// minimum_priority supera la severidad o que desactivaron audio, vibración y
+// visual. Retorna cuántos usuarios fueron notificados.
+func (a *IncidentAlerts) IncidentCreated(ctx context.Context, incident *models.Incident) (int, error) {
+	matches, err := a.subs.Matching(ctx, incident)
+	if err != nil {
+		return 0, err
+	}
+
+	notified := 0
+	var errs []error
+	for _, sub := range mostSpecificPerUser(matches) {
+		if incident.ReporterID == strconv.FormatInt(sub.UserID, 10) {
+			continue
+		}
+
+		prefs, err := a.prefs.Get(ctx, sub.UserID)
+		if errors.Is(err, repository.ErrNotFound) {
+			defaults := repository.DefaultNotificationPreferences()
+			prefs, err = &defaults, nil
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if models.PriorityRank(string(incident.Severity)) < models.PriorityRank(prefs.MinimumPriority) {
+			continue
+		}
+		channels := models.NotificationChannels{
+			Audio:     prefs.EnableAudio,
+			Vibration: prefs.EnableVibration,
+			Visual:    prefs.EnableVisual,
+		}
+		if !channels.Audio && !channels.Vibration && !channels.Visual {
+			continue
+		}
+
+		notification := incidentNotification(incident, sub, channels)
+		if err := a.notifier.Notify(ctx, notification); err != nil {
+			errs = append(errs, fmt.Errorf("usuario %d: %w", sub.UserID, err))
+			continue
+		}
+		notified++
+	}
+	return notified, errors.Join(errs...)
+}
+
+// subscriptionSpecificity prefiere la ruta o paradero por sobre la zona al
+// elegir el motivo que se muestra en la notificación
+var subscriptionSpecificity = map[models.SubscriptionKind]int{
+	models.SubscriptionRoute: 3,
+	models.SubscriptionStop:  2,
+	models.SubscriptionArea:  1,
+}
+
+// mostSpecificPerUser deja una suscripción por usuario, en el orden de matches
+func mostSpecificPerUser(matches []models.IncidentSubscription) []models.IncidentSubscription {
+	best := make(map[int64]int) // usuario -> índice en result
+	result := []models.IncidentSubscription{}
+	for _, sub := range matches {
+		i, ok := best[sub.UserID]
+		if !ok {
+			best[sub.UserID] = len(result)
+			result = append(result, sub)
+			continue
+		}
+		if subscriptionSpecificity[sub.Kind] > subscriptionSpecificity[result[i].Kind] {
+			result[i] = sub
+		}
+	}
+	return result
+}
+
+func incidentNotification(incident *models.Incident, sub models.IncidentSubscription, channels models.NotificationChannels) *models.Notification {
+	title, ok := incidentLabels[incident.Type]
+	if !ok {
+		title = incidentLabels[models.IncidentOther]
+	}
+
+	var where string
+	switch sub.Kind {
+	case models.SubscriptionRoute:
+		where = "en la ruta " + *incident.RouteName
+	case models.SubscriptionStop:
+		where = "en el paradero " + *incident.StopName
+	default:
+		where = "cerca de tu zona"
+		if sub.Label != nil && *sub.Label != "" {
+			where = "cerca de " + *sub.Label
+		}
+	}
+	body := strings.ToUpper(where[:1]) + where[1:]
+	if incident.Description != nil && strings.TrimSpace(*incident.Description) != "" {
+		body += ": " + strings.TrimSpace(*incident.Description)
+	}
+
+	priority := string(incident.Severity)
+	if priority == "" {
+		priority = string(models.SeverityMedium)
+	}
+
+	incidentID := incident.ID
+	subscriptionID := sub.ID
+	return &models.Notification{
+		UserID:         sub.UserID,
+		Kind:           models.NotificationIncident,
+		IncidentID:     &incidentID,
+		SubscriptionID: &subscriptionID,
+		Title:          title,
+		Body:           body,
+		Priority:       priority,
+		Channels:       channels,
+	}
+}
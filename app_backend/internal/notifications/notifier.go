@@ -0,0 +1,121 @@
+// ============================================================================
+// Notifications - WayFindCL
+// ============================================================================
+// Entrega de avisos a usuarios. Notifier es el punto de extensión:
+//   - Inbox:   guarda en la bandeja in-app (GET /api/notifications)
+//   - Webhook: POST JSON a una URL (puente hacia un proveedor de push)
+// FromEnv arma la combinación configurada, de modo que el servicio se prueba
+// localmente sin un proveedor de push real.
+// ============================================================================
+
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/repository"
+)
+
+// Notifier entrega una notificación a su usuario
+type Notifier interface {
+	Notify(ctx context.Context, notification *models.Notification) error
+}
+
+// Inbox guarda las notificaciones en la bandeja in-app y les asigna ID
+type Inbox struct {
+	repo repository.NotificationRepository
+}
+
+func NewInbox(repo repository.NotificationRepository) *Inbox {
+	return &Inbox{repo: repo}
+}
+
+func (n *Inbox) Notify(ctx context.Context, notification *models.Notification) error {
+	notification.CreatedAt = time.Now()
+	id, err := n.repo.Create(ctx, notification)
+	if err != nil {
+		return err
+	}
+	notification.ID = id
+	return nil
+}
+
+// Webhook publica cada notificación como JSON. Con secret, el cuerpo se firma
+// con HMAC-SHA256 en el header X-Webhook-Signature ("sha256=<hex>").
+type Webhook struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func NewWebhook(url, secret string) *Webhook {
+	return &Webhook{
+		url:    url,
+		secret: secret,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *Webhook) Notify(ctx context.Context, notification *models.Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+		req.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook respondió %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Multi entrega por cada notifier en orden (la bandeja primero, para que el
+// webhook reciba el ID) y junta los errores sin detenerse
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, notification *models.Notification) error {
+	var errs []error
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, notification); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FromEnv arma el notifier: siempre la bandeja in-app y, si NOTIFY_WEBHOOK_URL
+// está definido, también el webhook (firmado con NOTIFY_WEBHOOK_SECRET)
+func FromEnv(inbox repository.NotificationRepository) Notifier {
+	notifiers := Multi{NewInbox(inbox)}
+	if url := strings.TrimSpace(os.Getenv("NOTIFY_WEBHOOK_URL")); url != "" {
+		notifiers = append(notifiers, NewWebhook(url, os.Getenv("NOTIFY_WEBHOOK_SECRET")))
+	}
+	return notifiers
+}
@@ -0,0 +1,329 @@
+package redcl
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// arrivalsFetchTimeout acota una consulta compartida; no depende del
+	// request que la inició, para no cortarla a quienes esperan el resultado
+	arrivalsFetchTimeout = 45 * time.Second
+	// hotRefreshWorkers limita las consultas simultáneas del refresco
+	hotRefreshWorkers = 4
+)
+
+// ErrTooManyHotStops indica que se alcanzó el máximo de paraderos suscritos
+var ErrTooManyHotStops = errors.New("demasiados paraderos suscritos")
+
+// ArrivalsCache se ubica delante del Scraper: las llamadas concurrentes para
+// un mismo paradero comparten una sola consulta a la fuente y el resultado se
+// reutiliza por ttl. Los paraderos "calientes" (suscritos por un tiempo) se
+// refrescan en segundo plano para que las consultas siempre encuentren caché.
+//
+// El *StopArrivals retornado es compartido entre llamadas: no debe modificarse.
+type ArrivalsCache struct {
+	scraper      *Scraper
+	ttl          time.Duration
+	refreshEvery time.Duration
+	maxHot       int
+	onFetch      func(*StopArrivals)
+
+	mu       sync.Mutex
+	entries  map[string]cachedArrivals
+	inflight map[string]*arrivalsCall
+	hot      map[string]time.Time // stopCode -> suscrito hasta
+	epoch    int64                // Aumenta con Clear: descarta las consultas iniciadas antes
+	counters cacheCounters
+}
+
+type cachedArrivals struct {
+	arrivals  *StopArrivals
+	fetchedAt time.Time
+}
+
+// arrivalsCall es una consulta en curso; done se cierra al terminar
+type arrivalsCall struct {
+	done     chan struct{}
+	epoch    int64
+	arrivals *StopArrivals
+	err      error
+}
+
+type cacheCounters struct {
+	hits, misses, coalesced int64
+	fetches, fetchErrors    int64
+	refreshes               int64
+	totalFetch, maxFetch    time.Duration
+	lastFetch               time.Duration
+	lastFetchAt             time.Time
+	lastError               string
+}
+
+// CacheStats son las métricas del caché de llegadas
+type CacheStats struct {
+	Source        string     `json:"source"`
+	TTLSeconds    float64    `json:"ttlSeconds"`
+	RefreshSecs   float64    `json:"refreshIntervalSeconds"`
+	Hits          int64      `json:"hits"`
+	Misses        int64      `json:"misses"`
+	Coalesced     int64      `json:"coalesced"` // Misses que esperaron una consulta ya en curso
+	HitRate       float64    `json:"hitRate"`   // Porcentaje de hits
+	Fetches       int64      `json:"fetches"`
+	FetchErrors   int64      `json:"fetchErrors"`
+	Refreshes     int64      `json:"refreshes"` // Consultas iniciadas por el refresco de paraderos calientes (no las que sólo esperó)
+	AvgFetchMs    int64      `json:"avgFetchMs"`
+	MaxFetchMs    int64      `json:"maxFetchMs"`
+	LastFetchMs   int64      `json:"lastFetchMs"`
+	LastFetchAt   *time.Time `json:"lastFetchAt,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+	CachedStops   int        `json:"cachedStops"`
+	InFlightStops int        `json:"inFlightStops"`
+	HotStops      int        `json:"hotStops"`
+}
+
+// NewArrivalsCache crea el caché sobre el scraper. ttl 0 desactiva el caché
+// (se mantiene la deduplicación); refreshEvery 0 desactiva el refresco.
+func NewArrivalsCache(scraper *Scraper, ttl, refreshEvery time.Duration, maxHot int) *ArrivalsCache {
+	return &ArrivalsCache{
+		scraper:      scraper,
+		ttl:          ttl,
+		refreshEvery: refreshEvery,
+		maxHot:       maxHot,
+		entries:      make(map[string]cachedArrivals),
+		inflight:     make(map[string]*arrivalsCall),
+		hot:          make(map[string]time.Time),
+	}
+}
+
+// OnFetch registra una función que recibe cada resultado nuevo de la fuente
+// (no los aciertos del caché). Se llama fuera del lock, después de entregar el
+// resultado a quienes lo esperaban. Configurarlo antes de usar el caché.
+func (c *ArrivalsCache) OnFetch(fn func(*StopArrivals)) {
+	c.onFetch = fn
+}
+
+// Get retorna las llegadas del paradero desde el caché o desde una consulta
+// (propia o compartida). cached indica si vinieron del caché.
+func (c *ArrivalsCache) Get(ctx context.Context, stopCode string) (arrivals *StopArrivals, cached bool, err error) {
+	stopCode = normalizeCacheKey(stopCode)
+
+	c.mu.Lock()
+	if entry, ok := c.entries[stopCode]; ok && time.Since(entry.fetchedAt) < c.ttl {
+		c.counters.hits++
+		c.mu.Unlock()
+		return entry.arrivals, true, nil
+	}
+	c.counters.misses++
+	call, started := c.startFetchLocked(stopCode)
+	if !started {
+		c.counters.coalesced++
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.arrivals, false, call.err
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
+
+// normalizeCacheKey normaliza el código y lo copia: queda como clave de mapas
+// y el llamador puede pasar strings que reutilizan un buffer (Fiber)
+func normalizeCacheKey(stopCode string) string {
+	return strings.Clone(strings.ToUpper(strings.TrimSpace(stopCode)))
+}
+
+// startFetchLocked retorna la consulta en curso del paradero o inicia una
+// (started). Requiere c.mu tomado.
+func (c *ArrivalsCache) startFetchLocked(stopCode string) (call *arrivalsCall, started bool) {
+	if call, ok := c.inflight[stopCode]; ok {
+		return call, false
+	}
+	call = &arrivalsCall{done: make(chan struct{}), epoch: c.epoch}
+	c.inflight[stopCode] = call
+	go c.fetch(stopCode, call)
+	return call, true
+}
+
+func (c *ArrivalsCache) fetch(stopCode string, call *arrivalsCall) {
+	ctx, cancel := context.WithTimeout(context.Background(), arrivalsFetchTimeout)
+	defer cancel()
+
+	start := time.Now()
+	call.arrivals, call.err = c.scraper.GetBusArrivals(ctx, stopCode)
+	elapsed := time.Since(start)
+
+	c.mu.Lock()
+	c.counters.fetches++
+	c.counters.totalFetch += elapsed
+	c.counters.lastFetch = elapsed
+	c.counters.lastFetchAt = time.Now()
+	if elapsed > c.counters.maxFetch {
+		c.counters.maxFetch = elapsed
+	}
+	if call.err != nil {
+		c.counters.fetchErrors++
+		c.counters.lastError = call.err.Error()
+	} else if c.ttl > 0 && call.epoch == c.epoch {
+		// Una consulta iniciada antes de Clear no repuebla el caché
+		c.pruneEntriesLocked()
+		c.entries[stopCode] = cachedArrivals{arrivals: call.arrivals, fetchedAt: time.Now()}
+	}
+	if c.inflight[stopCode] == call {
+		delete(c.inflight, stopCode)
+	}
+	c.mu.Unlock()
+
+	close(call.done)
+	if call.err == nil && c.onFetch != nil {
+		c.onFetch(call.arrivals)
+	}
+}
+
+// Subscribe marca el paradero como caliente por lease (renovable llamando de
+// nuevo) y retorna hasta cuándo queda suscrito
+func (c *ArrivalsCache) Subscribe(stopCode string, lease time.Duration) (time.Time, error) {
+	stopCode = normalizeCacheKey(stopCode)
+	until := time.Now().Add(lease)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.hot[stopCode]; !ok {
+		c.pruneHotLocked(time.Now())
+		if c.maxHot > 0 && len(c.hot) >= c.maxHot {
+			return time.Time{}, ErrTooManyHotStops
+		}
+	}
+	if current := c.hot[stopCode]; current.After(until) {
+		until = current
+	}
+	c.hot[stopCode] = until
+	return until, nil
+}
+
+// pruneHotLocked quita las suscripciones vencidas. Requiere c.mu tomado.
+func (c *ArrivalsCache) pruneHotLocked(now time.Time) {
+	for stopCode, until := range c.hot {
+		if !now.Before(until) {
+			delete(c.hot, stopCode)
+		}
+	}
+}
+
+// pruneEntriesLocked descarta las llegadas vencidas. Requiere c.mu tomado.
+func (c *ArrivalsCache) pruneEntriesLocked() {
+	for stopCode, entry := range c.entries {
+		if time.Since(entry.fetchedAt) >= c.ttl {
+			delete(c.entries, stopCode)
+		}
+	}
+}
+
+// StartRefresher refresca cada refreshEvery los paraderos calientes cuyo
+// caché está por vencer. Bloquea: lanzarlo en una goroutine.
+func (c *ArrivalsCache) StartRefresher() {
+	if c.refreshEvery <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.refreshEvery)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.refreshHot()
+	}
+}
+
+func (c *ArrivalsCache) refreshHot() {
+	now := time.Now()
+	c.mu.Lock()
+	c.pruneHotLocked(now)
+	var due []string
+	for stopCode := range c.hot {
+		// Refrescar lo que vencerá antes del próximo tick
+		entry, ok := c.entries[stopCode]
+		if !ok || now.Sub(entry.fetchedAt)+c.refreshEvery >= c.ttl {
+			due = append(due, stopCode)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(due) == 0 {
+		return
+	}
+	log.Printf("🔄 [RED.CL] Refrescando %d paraderos suscritos", len(due))
+
+	slots := make(chan struct{}, hotRefreshWorkers)
+	var wg sync.WaitGroup
+	for _, stopCode := range due {
+		slots <- struct{}{}
+		c.mu.Lock()
+		call, started := c.startFetchLocked(stopCode)
+		if started {
+			c.counters.refreshes++
+		}
+		c.mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-call.done
+			<-slots
+		}()
+	}
+	wg.Wait()
+}
+
+// Clear vacía el caché de llegadas y el de buses vistos del scraper. Las
+// consultas en curso siguen entregando su resultado a quienes lo esperan,
+// pero no vuelven a llenar el caché; las llamadas siguientes consultan de nuevo.
+func (c *ArrivalsCache) Clear() {
+	c.mu.Lock()
+	c.entries = make(map[string]cachedArrivals)
+	c.inflight = make(map[string]*arrivalsCall)
+	c.epoch++
+	c.mu.Unlock()
+	c.scraper.ClearCache()
+}
+
+// Stats retorna una copia de las métricas del caché
+func (c *ArrivalsCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneHotLocked(time.Now())
+
+	counters := c.counters
+	stats := CacheStats{
+		Source:        c.scraper.SourceName(),
+		TTLSeconds:    c.ttl.Seconds(),
+		RefreshSecs:   c.refreshEvery.Seconds(),
+		Hits:          counters.hits,
+		Misses:        counters.misses,
+		Coalesced:     counters.coalesced,
+		Fetches:       counters.fetches,
+		FetchErrors:   counters.fetchErrors,
+		Refreshes:     counters.refreshes,
+		MaxFetchMs:    counters.maxFetch.Milliseconds(),
+		LastFetchMs:   counters.lastFetch.Milliseconds(),
+		LastError:     counters.lastError,
+		CachedStops:   len(c.entries),
+		InFlightStops: len(c.inflight),
+		HotStops:      len(c.hot),
+	}
+	if total := counters.hits + counters.misses; total > 0 {
+		stats.HitRate = float64(counters.hits) * 100 / float64(total)
+	}
+	if counters.fetches > 0 {
+		stats.AvgFetchMs = (counters.totalFetch / time.Duration(counters.fetches)).Milliseconds()
+	}
+	if !counters.lastFetchAt.IsZero() {
+		lastFetchAt := counters.lastFetchAt
+		stats.LastFetchAt = &lastFetchAt
+	}
+	return stats
+}
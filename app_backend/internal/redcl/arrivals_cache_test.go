@@ -0,0 +1,275 @@
+package redcl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSource cuenta las consultas por paradero; si gate no es nil cada
+// consulta espera a que se cierre
+type fakeSource struct {
+	gate chan struct{}
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func newFakeSource(gate chan struct{}) *fakeSource {
+	return &fakeSource{gate: gate, calls: make(map[string]int)}
+}
+
+func (f *fakeSource) Name() string { return "fake" }
+
+func (f *fakeSource) FetchArrivals(ctx context.Context, stopCode string) (*SourceArrivals, error) {
+	f.mu.Lock()
+	f.calls[stopCode]++
+	n := f.calls[stopCode]
+	f.mu.Unlock()
+	if f.gate != nil {
+		<-f.gate
+	}
+	// El nombre identifica la consulta que produjo el resultado
+	return &SourceArrivals{StopName: fmt.Sprintf("%s #%d", stopCode, n)}, nil
+}
+
+func (f *fakeSource) callsTo(stopCode string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[stopCode]
+}
+
+// waitFor espera (sin dormir de más) a que cond se cumpla
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout esperando %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestArrivalsCacheCoalesces(t *testing.T) {
+	gate := make(chan struct{})
+	source := newFakeSource(gate)
+	cache := NewArrivalsCache(NewScraper(nil, source), time.Minute, 0, 0)
+
+	const callers = 10
+	results := make([]*StopArrivals, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Códigos con distinto formato son el mismo paradero
+			code := "PA433"
+			if i%2 == 1 {
+				code = " pa433 "
+			}
+			arrivals, cached, err := cache.Get(context.Background(), code)
+			if err != nil || cached {
+				t.Errorf("Get %d: cached=%v err=%v", i, cached, err)
+			}
+			results[i] = arrivals
+		}(i)
+	}
+	waitFor(t, "los misses", func() bool { return cache.Stats().Misses == callers })
+	close(gate)
+	wg.Wait()
+
+	if n := source.callsTo("PA433"); n != 1 {
+		t.Errorf("%d consultas a la fuente, want 1", n)
+	}
+	for i, arrivals := range results {
+		if arrivals != results[0] {
+			t.Errorf("Get %d recibió otro resultado", i)
+		}
+	}
+	stats := cache.Stats()
+	if stats.Coalesced != callers-1 || stats.Fetches != 1 {
+		t.Errorf("coalesced=%d fetches=%d, want %d y 1", stats.Coalesced, stats.Fetches, callers-1)
+	}
+
+	// Los siguientes salen del caché
+	arrivals, cached, err := cache.Get(context.Background(), "PA433")
+	if err != nil || !cached || arrivals != results[0] {
+		t.Errorf("Get después de la consulta: cached=%v err=%v", cached, err)
+	}
+}
+
+func TestArrivalsCacheCanceledWaiter(t *testing.T) {
+	gate := make(chan struct{})
+	source := newFakeSource(gate)
+	cache := NewArrivalsCache(NewScraper(nil, source), time.Minute, 0, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := cache.Get(ctx, "PA433"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Get cancelado: err %v, want context.Canceled", err)
+	}
+	// La consulta siguió y llena el caché para los demás
+	close(gate)
+	waitFor(t, "la consulta", func() bool { return cache.Stats().CachedStops == 1 })
+	if _, cached, err := cache.Get(context.Background(), "PA433"); err != nil || !cached {
+		t.Errorf("Get: cached=%v err=%v, want desde el caché", cached, err)
+	}
+}
+
+func TestArrivalsCacheTTL(t *testing.T) {
+	tests := []struct {
+		name        string
+		ttl         time.Duration
+		wait        time.Duration
+		wantCached  bool
+		wantFetches int
+	}{
+		{"vigente", time.Minute, 0, true, 1},
+		{"vencido", 20 * time.Millisecond, 40 * time.Millisecond, false, 2},
+		{"sin caché", 0, 0, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newFakeSource(nil)
+			cache := NewArrivalsCache(NewScraper(nil, source), tt.ttl, 0, 0)
+			ctx := context.Background()
+
+			if _, cached, err := cache.Get(ctx, "PA433"); err != nil || cached {
+				t.Fatalf("primer Get: cached=%v err=%v", cached, err)
+			}
+			time.Sleep(tt.wait)
+			_, cached, err := cache.Get(ctx, "PA433")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cached != tt.wantCached {
+				t.Errorf("segundo Get: cached=%v, want %v", cached, tt.wantCached)
+			}
+			if n := source.callsTo("PA433"); n != tt.wantFetches {
+				t.Errorf("%d consultas a la fuente, want %d", n, tt.wantFetches)
+			}
+		})
+	}
+}
+
+func TestArrivalsCacheMaxHot(t *testing.T) {
+	cache := NewArrivalsCache(NewScraper(nil, newFakeSource(nil)), time.Minute, time.Second, 2)
+
+	if _, err := cache.Subscribe("PA1", time.Minute); err != nil {
+		t.Fatalf("Subscribe PA1: %v", err)
+	}
+	if _, err := cache.Subscribe("PA2", 20*time.Millisecond); err != nil {
+		t.Fatalf("Subscribe PA2: %v", err)
+	}
+	if _, err := cache.Subscribe("PA3", time.Minute); !errors.Is(err, ErrTooManyHotStops) {
+		t.Fatalf("Subscribe PA3 sobre el máximo: err %v, want ErrTooManyHotStops", err)
+	}
+
+	// Renovar uno ya suscrito no cuenta contra el máximo ni acorta el lease
+	first, _ := cache.Subscribe("pa1", time.Minute)
+	renewed, err := cache.Subscribe("PA1", time.Second)
+	if err != nil {
+		t.Fatalf("renovar PA1: %v", err)
+	}
+	if renewed.Before(first) {
+		t.Errorf("renovar con un lease menor acortó la suscripción: %s < %s", renewed, first)
+	}
+
+	// Las suscripciones vencidas liberan su lugar
+	time.Sleep(40 * time.Millisecond)
+	if _, err := cache.Subscribe("PA3", time.Minute); err != nil {
+		t.Errorf("Subscribe PA3 tras vencer PA2: %v", err)
+	}
+	if hot := cache.Stats().HotStops; hot != 2 {
+		t.Errorf("%d paraderos calientes, want 2", hot)
+	}
+}
+
+func TestArrivalsCacheRefreshHot(t *testing.T) {
+	source := newFakeSource(nil)
+	cache := NewArrivalsCache(NewScraper(nil, source), time.Minute, time.Second, 0)
+	ctx := context.Background()
+
+	for _, code := range []string{"PA1", "PA2", "PA3", "PA4"} {
+		if _, err := cache.Subscribe(code, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// PA3 está recién consultado: no vence antes del próximo tick
+	if _, _, err := cache.Get(ctx, "PA3"); err != nil {
+		t.Fatal(err)
+	}
+	// PA2 ya tiene una consulta en curso: el refresco sólo la espera
+	pending := &arrivalsCall{done: make(chan struct{})}
+	close(pending.done)
+	cache.mu.Lock()
+	cache.inflight["PA2"] = pending
+	cache.mu.Unlock()
+
+	cache.refreshHot()
+
+	want := map[string]int{"PA1": 1, "PA2": 0, "PA3": 1, "PA4": 1}
+	for code, n := range want {
+		if got := source.callsTo(code); got != n {
+			t.Errorf("%s: %d consultas, want %d", code, got, n)
+		}
+	}
+	stats := cache.Stats()
+	if stats.Refreshes != 2 {
+		t.Errorf("refreshes=%d, want 2 (PA1 y PA4)", stats.Refreshes)
+	}
+	if stats.Coalesced != 0 {
+		t.Errorf("coalesced=%d, want 0: esperar desde el refresco no es un miss", stats.Coalesced)
+	}
+}
+
+// Una consulta iniciada antes de Clear no vuelve a llenar el caché
+func TestArrivalsCacheClearDuringFetch(t *testing.T) {
+	gate := make(chan struct{})
+	source := newFakeSource(gate)
+	cache := NewArrivalsCache(NewScraper(nil, source), time.Minute, 0, 0)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	get := func(want string) {
+		defer wg.Done()
+		arrivals, _, err := cache.Get(ctx, "PA433")
+		if err != nil {
+			t.Errorf("Get: %v", err)
+			return
+		}
+		// Quienes esperaban reciben igual el resultado de su consulta
+		if arrivals.StopName != want {
+			t.Errorf("Get recibió %q, want %q", arrivals.StopName, want)
+		}
+	}
+
+	wg.Add(1)
+	go get("PA433 #1")
+	waitFor(t, "la primera consulta", func() bool { return source.callsTo("PA433") == 1 })
+
+	cache.Clear()
+
+	// Después de Clear se consulta de nuevo en vez de esperar la anterior
+	wg.Add(1)
+	go get("PA433 #2")
+	waitFor(t, "la segunda consulta", func() bool { return source.callsTo("PA433") == 2 })
+
+	close(gate)
+	wg.Wait()
+
+	arrivals, cached, err := cache.Get(ctx, "PA433")
+	if err != nil || !cached {
+		t.Fatalf("Get: cached=%v err=%v, want desde el caché", cached, err)
+	}
+	if arrivals.StopName != "PA433 #2" {
+		t.Errorf("caché con %q, want el resultado posterior a Clear", arrivals.StopName)
+	}
+	if stats := cache.Stats(); stats.InFlightStops != 0 || stats.CachedStops != 1 {
+		t.Errorf("inFlight=%d cached=%d, want 0 y 1", stats.InFlightStops, stats.CachedStops)
+	}
+}
@@ -0,0 +1,254 @@
+package redcl
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// BrowserSource carga la página "Cuándo llega" de Red.cl en un navegador
+// headless y parsea la tabla de recorridos. El ejecutable viene de
+// REDCL_BROWSER_PATH; sin configurar, en Windows se prueban las rutas de
+// instalación conocidas y en el resto chromedp lo busca en el PATH.
+type BrowserSource struct {
+	execPath string
+}
+
+func NewBrowserSource(execPath string) *BrowserSource {
+	if execPath != "" && !fileExists(execPath) {
+		log.Printf("⚠️  REDCL_BROWSER_PATH no existe (%q), se buscará un navegador instalado", execPath)
+		execPath = ""
+	}
+	return &BrowserSource{execPath: execPath}
+}
+
+func (s *BrowserSource) Name() string { return "browser" }
+
+func (s *BrowserSource) FetchArrivals(ctx context.Context, stopCode string) (*SourceArrivals, error) {
+	pageURL := defaultPageURL + "?codsimt=" + url.QueryEscape(stopCode)
+	log.Printf("🌐 [RED.CL] URL: %s", pageURL)
+
+	// Configurar opciones headless (sin ventana visible)
+	opts := []chromedp.ExecAllocatorOption{
+		chromedp.NoFirstRun,
+		chromedp.NoDefaultBrowserCheck,
+		chromedp.Flag("headless", true),              // HEADLESS: sin interfaz gráfica
+		chromedp.Flag("disable-gpu", true),           // Deshabilitar GPU
+		chromedp.Flag("no-sandbox", true),            // Sin sandbox (para servers)
+		chromedp.Flag("disable-dev-shm-usage", true), // Evitar problemas de memoria compartida
+		chromedp.Flag("disable-extensions", true),    // Sin extensiones
+		chromedp.Flag("disable-background-networking", true),
+		chromedp.Flag("disable-sync", true),
+		chromedp.Flag("disable-translate", true),
+		chromedp.Flag("disable-plugins", true),
+		chromedp.Flag("mute-audio", true), // Sin audio
+		chromedp.Flag("disable-setuid-sandbox", true),
+		chromedp.WindowSize(1920, 1080), // Tamaño de ventana virtual
+		chromedp.UserAgent(userAgent),
+	}
+
+	execPath := s.execPath
+	if execPath == "" {
+		execPath = detectBrowser()
+	}
+	if execPath != "" {
+		opts = append([]chromedp.ExecAllocatorOption{chromedp.ExecPath(execPath)}, opts...)
+	} else {
+		log.Printf("⚠️  [BROWSER] Sin REDCL_BROWSER_PATH, intentando chromedp default")
+		opts = append(chromedp.DefaultExecAllocatorOptions[:], opts...)
+	}
+
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(ctx, opts...)
+	defer cancelAlloc()
+
+	// Crear contexto sin logging excesivo (modo silencioso)
+	browserCtx, cancel := chromedp.NewContext(allocCtx)
+	defer cancel()
+
+	browserCtx, cancel = context.WithTimeout(browserCtx, 30*time.Second)
+	defer cancel()
+
+	var htmlContent string
+
+	log.Printf("🔄 [RED.CL] Iniciando scraping headless (sin ventana visible)...")
+
+	err := chromedp.Run(browserCtx,
+		chromedp.Navigate(pageURL),
+		chromedp.WaitVisible(`body`, chromedp.ByQuery),
+		chromedp.Sleep(4*time.Second),                 // Esperar a que cargue JavaScript dinámico y datos AJAX
+		chromedp.WaitReady(`table`, chromedp.ByQuery), // Esperar a que cargue la tabla de recorridos
+		chromedp.OuterHTML(`html`, &htmlContent, chromedp.ByQuery),
+	)
+	if err != nil {
+		// Si el error es por navegador no encontrado, dar más detalles
+		if strings.Contains(err.Error(), "executable file not found") {
+			return nil, fmt.Errorf("no se encontró navegador compatible (Chrome/Chromium/Edge): configura REDCL_BROWSER_PATH o usa REDCL_ARRIVALS_SOURCE=http")
+		}
+		return nil, fmt.Errorf("error obteniendo datos de Red.cl: %w", err)
+	}
+
+	log.Printf("📄 [RED.CL] HTML obtenido: %d bytes", len(htmlContent))
+
+	return &SourceArrivals{
+		StopName: extractStopNameFromHTML(htmlContent, stopCode),
+		Arrivals: parseArrivals(htmlContent),
+	}, nil
+}
+
+// detectBrowser retorna el primer navegador instalado en las rutas conocidas
+// de Windows; en otros sistemas chromedp lo busca en el PATH
+func detectBrowser() string {
+	if runtime.GOOS != "windows" {
+		return ""
+	}
+	for _, browser := range windowsBrowserPaths() {
+		if fileExists(browser.path) {
+			log.Printf("✅ [BROWSER] %s detectado: %s", browser.name, browser.path)
+			return browser.path
+		}
+	}
+	return ""
+}
+
+// windowsBrowserPaths son las instalaciones habituales de Chrome, Edge, Brave y Chromium
+func windowsBrowserPaths() []struct {
+	name string
+	path string
+} {
+	return []struct {
+		name string
+		path string
+	}{
+		// Microsoft Edge (incluido por defecto en Windows 10/11)
+		{"Edge", "C:\\Program Files (x86)\\Microsoft\\Edge\\Application\\msedge.exe"},
+		{"Edge", "C:\\Program Files\\Microsoft\\Edge\\Application\\msedge.exe"},
+
+		// Google Chrome
+		{"Chrome", "C:\\Program Files\\Google\\Chrome\\Application\\chrome.exe"},
+		{"Chrome", "C:\\Program Files (x86)\\Google\\Chrome\\Application\\chrome.exe"},
+		{"Chrome", "C:\\Users\\" + getCurrentUser() + "\\AppData\\Local\\Google\\Chrome\\Application\\chrome.exe"},
+
+		// Brave Browser
+		{"Brave", "C:\\Program Files\\BraveSoftware\\Brave-Browser\\Application\\brave.exe"},
+		{"Brave", "C:\\Program Files (x86)\\BraveSoftware\\Brave-Browser\\Application\\brave.exe"},
+		{"Brave", "C:\\Users\\" + getCurrentUser() + "\\AppData\\Local\\BraveSoftware\\Brave-Browser\\Application\\brave.exe"},
+
+		// Chromium
+		{"Chromium", "C:\\Program Files\\Chromium\\Application\\chrome.exe"},
+		{"Chromium", "C:\\Program Files (x86)\\Chromium\\Application\\chrome.exe"},
+		{"Chromium", "C:\\Users\\" + getCurrentUser() + "\\AppData\\Local\\Chromium\\Application\\chrome.exe"},
+	}
+}
+
+// parseArrivals extrae información de buses desde el HTML de Red.cl
+func parseArrivals(html string) []BusArrival {
+	arrivals := []BusArrival{}
+	seenRoutes := make(map[string]bool) // Para evitar duplicados
+
+	log.Printf("🔍 [PARSER] Iniciando parseo del HTML")
+
+	// ESTRUCTURA HTML DE RED.CL:
+	// <td class="td-dividido recorrido no-icon"><a class="bus">C01</a></td>
+	// <td class="td-right tiempo-llegada">"0.3km <span>(Llegando.)</span>"</td>
+
+	// Patrón para extraer filas completas de la tabla
+	rowPattern := regexp.MustCompile(`(?s)<tr[^>]*>(.*?)</tr>`)
+	rows := rowPattern.FindAllStringSubmatch(html, -1)
+
+	log.Printf("🔍 [PARSER] Filas de tabla encontradas: %d", len(rows))
+
+	for _, rowMatch := range rows {
+		if len(rowMatch) < 2 {
+			continue
+		}
+		rowHTML := rowMatch[1]
+
+		// Extraer número de ruta (C01, C05, 409, etc.)
+		routePattern := regexp.MustCompile(`class="bus[^"]*"[^>]*>([A-Z]?\d{2,3}[A-Z]?)</`)
+		routeMatch := routePattern.FindStringSubmatch(rowHTML)
+		if len(routeMatch) < 2 {
+			continue
+		}
+		routeNumber := strings.TrimSpace(routeMatch[1])
+
+		// Extraer distancia (0.3km, 7.4km, etc.)
+		distancePattern := regexp.MustCompile(`(\d+\.?\d*)\s*km`)
+		distanceMatch := distancePattern.FindStringSubmatch(rowHTML)
+
+		var distanceKm float64
+		if len(distanceMatch) >= 2 {
+			distanceKm, _ = strconv.ParseFloat(distanceMatch[1], 64)
+		}
+
+		// Crear clave única para evitar duplicados
+		routeKey := fmt.Sprintf("%s_%.1f", routeNumber, distanceKm)
+
+		// Saltar si ya existe esta combinación exacta
+		if seenRoutes[routeKey] {
+			continue
+		}
+		seenRoutes[routeKey] = true
+
+		// Saltar entradas sin datos válidos
+		if routeNumber == "" || distanceKm == 0 {
+			continue
+		}
+
+		arrival := BusArrival{
+			RouteNumber: routeNumber,
+			DistanceKm:  distanceKm,
+		}
+
+		arrivals = append(arrivals, arrival)
+		log.Printf("  ✓ Bus: %s (%.1fkm)", routeNumber, distanceKm)
+	}
+
+	log.Printf("📊 [PARSER] Total parseado: %d llegadas únicas", len(arrivals))
+
+	return arrivals
+}
+
+// extractStopNameFromHTML extrae el nombre del paradero desde el HTML
+func extractStopNameFromHTML(html, stopCode string) string {
+	// Patrón para: "Paradero PC615" seguido del nombre
+	// Ejemplo: <h2>Paradero PC615</h2> <p>Avenida Las Condes / esq. La Cabaña</p>
+	namePattern := regexp.MustCompile(`(?s)Paradero\s+([A-Z]+\d+).*?<.*?>([^<]+)</`)
+	if matches := namePattern.FindStringSubmatch(html); len(matches) > 2 {
+		return strings.TrimSpace(matches[2])
+	}
+
+	// Patrón alternativo: buscar directamente en elementos que siguen al código
+	codePattern := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(stopCode) + `.*?(?:esq\.|/)?\s*([^<]+)</`)
+	if matches := codePattern.FindStringSubmatch(html); len(matches) > 1 {
+		return strings.TrimSpace(matches[1])
+	}
+
+	return ""
+}
+
+// getCurrentUser obtiene el nombre del usuario actual
+func getCurrentUser() string {
+	user := os.Getenv("USERNAME")
+	if user == "" {
+		user = os.Getenv("USER") // Fallback para Linux/Mac
+	}
+	if user == "" {
+		user = "user"
+	}
+	return user
+}
+
+// fileExists verifica si un archivo existe
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
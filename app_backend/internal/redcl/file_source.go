@@ -0,0 +1,69 @@
+package redcl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// stopCodePattern restringe los códigos que se usan como nombre de archivo
+var stopCodePattern = regexp.MustCompile(`^[A-Z0-9-]+$`)
+
+// FileSource lee las llegadas de fixtures JSON (<dir>/<CODIGO>.json) para
+// pruebas y desarrollo sin red. El archivo trae un SourceArrivals o una lista
+// de ellos: la lista se entrega en orden en consultas sucesivas (el último se
+// repite), lo que permite simular buses que se acercan y pasan.
+type FileSource struct {
+	dir string
+
+	mu    sync.Mutex
+	calls map[string]int // Consultas por paradero
+}
+
+func NewFileSource(dir string) *FileSource {
+	return &FileSource{dir: dir, calls: make(map[string]int)}
+}
+
+func (s *FileSource) Name() string { return "file" }
+
+func (s *FileSource) FetchArrivals(ctx context.Context, stopCode string) (*SourceArrivals, error) {
+	if !stopCodePattern.MatchString(stopCode) {
+		return nil, fmt.Errorf("código de paradero inválido: %q", stopCode)
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, stopCode+".json"))
+	if os.IsNotExist(err) {
+		return &SourceArrivals{Arrivals: []BusArrival{}}, nil // Paradero sin buses
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []SourceArrivals
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &snapshots)
+	} else {
+		snapshots = make([]SourceArrivals, 1)
+		err = json.Unmarshal(trimmed, &snapshots[0])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fixture inválido para %s: %w", stopCode, err)
+	}
+	if len(snapshots) == 0 {
+		return &SourceArrivals{Arrivals: []BusArrival{}}, nil
+	}
+
+	s.mu.Lock()
+	i := s.calls[stopCode]
+	s.calls[stopCode]++
+	s.mu.Unlock()
+	if i >= len(snapshots) {
+		i = len(snapshots) - 1
+	}
+	snapshot := snapshots[i]
+	return &snapshot, nil
+}
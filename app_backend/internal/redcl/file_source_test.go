@@ -0,0 +1,78 @@
+package redcl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSourceSequence(t *testing.T) {
+	source := NewFileSource("../../testdata/redcl")
+	ctx := context.Background()
+
+	// El fixture trae dos consultas: se entregan en orden y la última se repite
+	wantKm := []float64{1.2, 0.6, 0.6}
+	for i, want := range wantKm {
+		got, err := source.FetchArrivals(ctx, "PA433")
+		if err != nil {
+			t.Fatalf("consulta %d: %v", i, err)
+		}
+		if got.StopName == "" {
+			t.Errorf("consulta %d sin nombre de paradero", i)
+		}
+		var km float64
+		for _, a := range got.Arrivals {
+			if a.RouteNumber == "405" {
+				km = a.DistanceKm
+			}
+		}
+		if km != want {
+			t.Errorf("consulta %d: 405 a %.1f km, want %.1f", i, km, want)
+		}
+	}
+}
+
+func TestFileSourceFixtures(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("PC615.json", `{"stop_name": "Paradero único", "arrivals": [{"route_number": "C01", "distance_km": 0.3}]}`)
+	write("PB100.json", `[]`)
+	write("PX999.json", `{"arrivals": `)
+	source := NewFileSource(dir)
+
+	tests := []struct {
+		name     string
+		code     string
+		arrivals int
+		wantErr  bool
+	}{
+		{"objeto único", "PC615", 1, false},
+		{"lista vacía", "PB100", 0, false},
+		{"sin fixture: paradero sin buses", "PA001", 0, false},
+		{"fixture inválido", "PX999", 0, true},
+		{"código con ruta", "../PC615", 0, true},
+		{"código en minúsculas", "pc615", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := source.FetchArrivals(context.Background(), tt.code)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("FetchArrivals(%q) sin error", tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FetchArrivals(%q): %v", tt.code, err)
+			}
+			if got.Arrivals == nil || len(got.Arrivals) != tt.arrivals {
+				t.Errorf("FetchArrivals(%q): %d llegadas, want %d", tt.code, len(got.Arrivals), tt.arrivals)
+			}
+		})
+	}
+}
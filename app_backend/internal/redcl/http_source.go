@@ -0,0 +1,202 @@
+package redcl
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPredictorURL = "https://www.red.cl/predictor/prediccion"
+	defaultPageURL      = "https://www.red.cl/planifica-tu-viaje/cuando-llega/"
+
+	// predictorTokenTTL es cuánto se reutiliza el token de sesión de la página
+	predictorTokenTTL = 10 * time.Minute
+	userAgent         = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+)
+
+// errPredictorUnauthorized indica que el token de sesión venció
+var errPredictorUnauthorized = errors.New("red.cl rechazó el token del predictor")
+
+// jwtPattern encuentra el token de sesión que la página "Cuándo llega" embebe
+// (en base64) para llamar al predictor
+var jwtPattern = regexp.MustCompile(`\$jwt\s*=\s*'([^']+)'`)
+
+// HTTPSource consulta el endpoint JSON de predicciones de Red.cl con HTTP
+// plano. El predictor exige el token de sesión que entrega la página pública,
+// así que se obtiene de ella y se reutiliza por predictorTokenTTL.
+type HTTPSource struct {
+	client       *http.Client
+	predictorURL string
+	pageURL      string
+
+	mu      sync.Mutex
+	token   string
+	tokenAt time.Time
+}
+
+func NewHTTPSource(predictorURL, pageURL string) *HTTPSource {
+	return &HTTPSource{
+		client:       &http.Client{Timeout: 10 * time.Second},
+		predictorURL: predictorURL,
+		pageURL:      pageURL,
+	}
+}
+
+func (s *HTTPSource) Name() string { return "http" }
+
+func (s *HTTPSource) FetchArrivals(ctx context.Context, stopCode string) (*SourceArrivals, error) {
+	token, err := s.sessionToken(ctx, stopCode, false)
+	if err != nil {
+		return nil, err
+	}
+	prediction, err := s.predict(ctx, token, stopCode)
+	if errors.Is(err, errPredictorUnauthorized) {
+		// Token vencido antes de tiempo: renovarlo una vez
+		if token, err = s.sessionToken(ctx, stopCode, true); err != nil {
+			return nil, err
+		}
+		prediction, err = s.predict(ctx, token, stopCode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return prediction.arrivals(), nil
+}
+
+// sessionToken retorna el token vigente o lo obtiene de la página del paradero
+func (s *HTTPSource) sessionToken(ctx context.Context, stopCode string, refresh bool) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !refresh && s.token != "" && time.Since(s.tokenAt) < predictorTokenTTL {
+		return s.token, nil
+	}
+
+	body, err := s.get(ctx, s.pageURL+"?codsimt="+url.QueryEscape(stopCode))
+	if err != nil {
+		return "", fmt.Errorf("error obteniendo token de Red.cl: %w", err)
+	}
+	match := jwtPattern.FindSubmatch(body)
+	if match == nil {
+		return "", errors.New("la página de Red.cl no trae token para el predictor")
+	}
+	token := string(match[1])
+	if decoded, err := base64.StdEncoding.DecodeString(token); err == nil {
+		token = string(decoded)
+	}
+
+	s.token, s.tokenAt = token, time.Now()
+	return token, nil
+}
+
+func (s *HTTPSource) predict(ctx context.Context, token, stopCode string) (*predictorResponse, error) {
+	query := url.Values{"t": {token}, "codsimt": {stopCode}, "codser": {""}}
+	body, err := s.get(ctx, s.predictorURL+"?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	var prediction predictorResponse
+	if err := json.Unmarshal(body, &prediction); err != nil {
+		return nil, fmt.Errorf("respuesta inválida del predictor de Red.cl: %w", err)
+	}
+	return &prediction, nil
+}
+
+func (s *HTTPSource) get(ctx context.Context, target string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, errPredictorUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("red.cl respondió %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 2<<20))
+}
+
+// predictorResponse es la respuesta del predictor de Red.cl. Cada servicio
+// informa hasta dos buses; las distancias vienen en metros, como texto.
+type predictorResponse struct {
+	StopName string `json:"nomett"`
+	Services struct {
+		Items []predictorService `json:"item"`
+	} `json:"servicios"`
+}
+
+type predictorService struct {
+	Route     string `json:"servicio"`
+	Time1     string `json:"horaprediccionbus1"`
+	Distance1 string `json:"distanciabus1"`
+	Plate1    string `json:"ppubus1"`
+	Time2     string `json:"horaprediccionbus2"`
+	Distance2 string `json:"distanciabus2"`
+	Plate2    string `json:"ppubus2"`
+}
+
+func (p *predictorResponse) arrivals() *SourceArrivals {
+	result := &SourceArrivals{StopName: strings.TrimSpace(p.StopName), Arrivals: []BusArrival{}}
+	for _, service := range p.Services.Items {
+		route := strings.ToUpper(strings.TrimSpace(service.Route))
+		if route == "" {
+			continue
+		}
+		for _, bus := range [][3]string{
+			{service.Distance1, service.Time1, service.Plate1},
+			{service.Distance2, service.Time2, service.Plate2},
+		} {
+			meters, err := strconv.ParseFloat(strings.TrimSpace(bus[0]), 64)
+			if err != nil || meters <= 0 {
+				continue // Sin bus (fuera de horario, sin predicción)
+			}
+			result.Arrivals = append(result.Arrivals, BusArrival{
+				RouteNumber:      route,
+				DistanceKm:       meters / 1000,
+				EstimatedMinutes: parsePredictionMinutes(bus[1]),
+				Plate:            strings.TrimSpace(bus[2]),
+			})
+		}
+	}
+	sort.SliceStable(result.Arrivals, func(i, j int) bool {
+		return result.Arrivals[i].DistanceKm < result.Arrivals[j].DistanceKm
+	})
+	return result
+}
+
+var minutesPattern = regexp.MustCompile(`\d+`)
+
+// parsePredictionMinutes interpreta textos como "Llegando.", "Menos de 2 min.",
+// "Entre 03 Y 05 min." o "Mas de 20 min." (cota inferior del rango)
+func parsePredictionMinutes(text string) *int {
+	text = strings.ToLower(text)
+	minutes := 0
+	switch {
+	case strings.Contains(text, "llegando"), strings.Contains(text, "menos de"):
+	default:
+		match := minutesPattern.FindString(text)
+		if match == "" {
+			return nil
+		}
+		minutes, _ = strconv.Atoi(match)
+	}
+	return &minutes
+}
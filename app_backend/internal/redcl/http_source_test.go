@@ -0,0 +1,41 @@
+package redcl
+
+import "testing"
+
+func TestParsePredictionMinutes(t *testing.T) {
+	tests := []struct {
+		text string
+		want *int
+	}{
+		{"Llegando.", intPtr(0)},
+		{"LLEGANDO", intPtr(0)},
+		{"Menos de 2 min.", intPtr(0)},
+		{"Entre 03 Y 05 min.", intPtr(3)},
+		{"Entre 11 Y 15 min. ", intPtr(11)},
+		{"Mas de 20 min.", intPtr(20)},
+		{"En menos de 5 min", intPtr(0)},
+		{"07 min", intPtr(7)},
+		{"", nil},
+		{"Fuera de horario", nil},
+		{"Servicio no disponible", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got := parsePredictionMinutes(tt.text)
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil || *got != *tt.want:
+				t.Errorf("parsePredictionMinutes(%q) = %v, want %v", tt.text, deref(got), deref(tt.want))
+			}
+		})
+	}
+}
+
+func intPtr(v int) *int { return &v }
+
+func deref(v *int) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
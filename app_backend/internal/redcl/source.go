@@ -0,0 +1,44 @@
+package redcl
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// ArrivalsSource obtiene las llegadas crudas de un paradero. Es el punto de
+// extensión del Scraper:
+//   - HTTPSource:    endpoint JSON de predicciones de Red.cl (sin navegador)
+//   - BrowserSource: página de Red.cl con un navegador headless (chromedp)
+//   - FileSource:    fixtures JSON en disco, para pruebas y desarrollo
+//
+// SourceFromEnv elige la implementación según el entorno.
+type ArrivalsSource interface {
+	Name() string
+	FetchArrivals(ctx context.Context, stopCode string) (*SourceArrivals, error)
+}
+
+// SourceArrivals es lo que entrega una fuente para un paradero
+type SourceArrivals struct {
+	StopName string       `json:"stop_name"`
+	Arrivals []BusArrival `json:"arrivals"`
+}
+
+// SourceFromEnv arma la fuente indicada por REDCL_ARRIVALS_SOURCE:
+//   - http (default): REDCL_PREDICTOR_URL y REDCL_PAGE_URL reemplazan las URLs de Red.cl
+//   - browser: REDCL_BROWSER_PATH es el ejecutable de Chrome/Chromium/Edge
+//   - file: REDCL_FIXTURES_DIR es el directorio con <CODIGO>.json
+func SourceFromEnv() ArrivalsSource {
+	kind := strings.ToLower(strings.TrimSpace(getEnv("REDCL_ARRIVALS_SOURCE", "http")))
+	switch kind {
+	case "http":
+		return NewHTTPSource(getEnv("REDCL_PREDICTOR_URL", defaultPredictorURL), getEnv("REDCL_PAGE_URL", defaultPageURL))
+	case "browser":
+		return NewBrowserSource(strings.TrimSpace(getEnv("REDCL_BROWSER_PATH", "")))
+	case "file":
+		return NewFileSource(getEnv("REDCL_FIXTURES_DIR", "testdata/redcl"))
+	default:
+		log.Printf("⚠️  REDCL_ARRIVALS_SOURCE inválido (%q), usando http", kind)
+		return NewHTTPSource(getEnv("REDCL_PREDICTOR_URL", defaultPredictorURL), getEnv("REDCL_PAGE_URL", defaultPageURL))
+	}
+}
@@ -0,0 +1,2281 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/yourorg/wayfindcl/internal/models"
+)
+
+// NewMariaDB crea los repositorios sobre la base de datos de producción
+func NewMariaDB(db *sql.DB) *Store {
+	return &Store{
+		Stops:         &mariaStops{db: db},
+		Routes:        &mariaRoutes{db: db},
+		Incidents:     &mariaIncidents{db: db},
+		Trips:         &mariaTrips{db: db},
+		Shares:        &mariaShares{db: db},
+		Users:         &mariaUsers{db: db},
+		Sessions:      &mariaSessions{db: db},
+		Preferences:   &mariaPreferences{db: db},
+		Subscriptions: &mariaSubscriptions{db: db},
+		Notifications: &mariaNotifications{db: db},
+		Contributions: &mariaContributions{db: db},
+		DebugEvents:   &mariaDebugEvents{db: db},
+		Arrivals:      &mariaArrivals{db: db},
+	}
+}
+
+// mysqlDuplicateEntry es el código de error de MariaDB para claves únicas (ER_DUP_ENTRY)
+const mysqlDuplicateEntry = 1062
+
+func isDuplicate(err error) bool {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == mysqlDuplicateEntry
+	}
+	return strings.Contains(err.Error(), "Duplicate entry")
+}
+
+// notFound traduce sql.ErrNoRows a ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// ============================================================================
+// PARADAS Y RUTAS (GTFS)
+// ============================================================================
+
+type mariaStops struct {
+	db *sql.DB
+}
+
+const stopColumns = `stop_id, COALESCE(code, ''), name, COALESCE(description, ''), latitude, longitude, COALESCE(zone_id, ''), wheelchair_boarding`
+
+func scanStop(row interface{ Scan(...interface{}) error }) (models.Stop, error) {
+	var stop models.Stop
+	err := row.Scan(&stop.StopID, &stop.Code, &stop.Name, &stop.Description,
+		&stop.Latitude, &stop.Longitude, &stop.ZoneID, &stop.WheelchairBoarding)
+	return stop, err
+}
+
+func (r *mariaStops) InBoundingBox(ctx context.Context, box BoundingBox) ([]models.Stop, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+stopColumns+`
+		FROM gtfs_stops
+		WHERE latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?
+	`, box.MinLat, box.MaxLat, box.MinLon, box.MaxLon)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stops := make([]models.Stop, 0)
+	for rows.Next() {
+		stop, err := scanStop(rows)
+		if err != nil {
+			return nil, err
+		}
+		stops = append(stops, stop)
+	}
+	return stops, rows.Err()
+}
+
+func (r *mariaStops) ByCode(ctx context.Context, code string) (*models.Stop, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	stop, err := scanStop(r.db.QueryRowContext(ctx, `
+		SELECT `+stopColumns+`
+		FROM gtfs_stops
+		WHERE UPPER(stop_id) = ? OR UPPER(code) = ?
+		LIMIT 1
+	`, code, code))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &stop, nil
+}
+
+type mariaRoutes struct {
+	db *sql.DB
+}
+
+func (r *mariaRoutes) Shape(ctx context.Context, routeShortName string) (string, [][]float64, error) {
+	var shapeID string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT t.shape_id
+		FROM gtfs_trips t
+		JOIN gtfs_routes r ON t.route_id = r.route_id
+		WHERE r.short_name = ? AND t.shape_id IS NOT NULL AND t.shape_id <> ''
+		LIMIT 1
+	`, routeShortName).Scan(&shapeID)
+	if err != nil {
+		return "", nil, notFound(err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT shape_pt_lat, shape_pt_lon
+		FROM gtfs_shapes
+		WHERE shape_id = ?
+		ORDER BY shape_pt_sequence
+	`, shapeID)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+
+	var points [][]float64
+	for rows.Next() {
+		var lat, lon float64
+		if err := rows.Scan(&lat, &lon); err != nil {
+			return "", nil, err
+		}
+		points = append(points, []float64{lon, lat})
+	}
+	if err := rows.Err(); err != nil {
+		return "", nil, err
+	}
+	if len(points) == 0 {
+		return shapeID, nil, ErrNotFound
+	}
+	return shapeID, points, nil
+}
+
+func (r *mariaRoutes) CountStopsBetween(ctx context.Context, routeShortName, fromStopCode, toStopCode string) (int, error) {
+	// Un viaje de la ruta que pase por ambos paraderos en ese orden
+	var tripID string
+	var fromSeq, toSeq int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT a.trip_id, a.stop_sequence, b.stop_sequence
+		FROM gtfs_stop_times a
+		JOIN gtfs_stop_times b ON b.trip_id = a.trip_id AND b.stop_sequence > a.stop_sequence
+		JOIN gtfs_trips t ON t.trip_id = a.trip_id
+		JOIN gtfs_routes r ON r.route_id = t.route_id
+		JOIN gtfs_stops sa ON sa.stop_id = a.stop_id
+		JOIN gtfs_stops sb ON sb.stop_id = b.stop_id
+		WHERE r.short_name = ?
+		  AND (sa.code = ? OR sa.stop_id = ?)
+		  AND (sb.code = ? OR sb.stop_id = ?)
+		LIMIT 1
+	`, routeShortName, fromStopCode, fromStopCode, toStopCode, toStopCode).Scan(&tripID, &fromSeq, &toSeq)
+	if err != nil {
+		return 0, notFound(err)
+	}
+
+	var count int
+	err = r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM gtfs_stop_times
+		WHERE trip_id = ? AND stop_sequence BETWEEN ? AND ?
+	`, tripID, fromSeq, toSeq).Scan(&count)
+	return count, err
+}
+
+// ============================================================================
+// INCIDENTES
+// ============================================================================
+
+type mariaIncidents struct {
+	db *sql.DB
+}
+
+const incidentColumns = `
+	id, type, latitude, longitude, severity, status, COALESCE(reporter_id, ''),
+	route_name, stop_name, description, is_verified, is_hidden,
+	upvotes, downvotes, weighted_score, created_at, updated_at,
+	COALESCE(expires_at, created_at), resolved_at`
+
+// incidentEffectiveStatus trata como expirados los vigentes que vencieron y
+// el barrido (ExpireDue) aún no marcó
+const incidentEffectiveStatus = `
+	CASE WHEN status IN ('active', 'hidden') AND expires_at <= NOW() THEN 'expired' ELSE status END`
+
+func scanIncident(row interface{ Scan(...interface{}) error }) (models.Incident, error) {
+	var incident models.Incident
+	err := row.Scan(
+		&incident.ID,
+		&incident.Type,
+		&incident.Latitude,
+		&incident.Longitude,
+		&incident.Severity,
+		&incident.Status,
+		&incident.ReporterID,
+		&incident.RouteName,
+		&incident.StopName,
+		&incident.Description,
+		&incident.IsVerified,
+		&incident.IsHidden,
+		&incident.Upvotes,
+		&incident.Downvotes,
+		&incident.WeightedScore,
+		&incident.CreatedAt,
+		&incident.UpdatedAt,
+		&incident.ExpiresAt,
+		&incident.ResolvedAt,
+	)
+	return incident, err
+}
+
+func (r *mariaIncidents) Create(ctx context.Context, incident *models.Incident) (int64, error) {
+	return insertIncident(ctx, r.db, incident)
+}
+
+// execer es la parte común de *sql.DB y *sql.Tx que usan los inserts compartidos
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertIncident crea un incidente activo que vence según el TTL de su tipo
+func insertIncident(ctx context.Context, db execer, incident *models.Incident) (int64, error) {
+	result, err := db.ExecContext(ctx, `
+		INSERT INTO incidents (
+			type, latitude, longitude, severity, status, reporter_id,
+			route_name, stop_name, description, created_at, updated_at, expires_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW(), DATE_ADD(NOW(), INTERVAL ? SECOND))
+	`,
+		incident.Type,
+		incident.Latitude,
+		incident.Longitude,
+		incident.Severity,
+		models.IncidentStatusActive,
+		incident.ReporterID,
+		incident.RouteName,
+		incident.StopName,
+		incident.Description,
+		int64(incident.Type.TTL().Seconds()),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *mariaIncidents) Get(ctx context.Context, id int64) (*models.Incident, error) {
+	incident, err := scanIncident(r.db.QueryRowContext(ctx, `SELECT `+incidentColumns+` FROM incidents WHERE id = ?`, id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &incident, nil
+}
+
+func (r *mariaIncidents) List(ctx context.Context, filter IncidentFilter) ([]models.Incident, error) {
+	query := `SELECT ` + incidentColumns + ` FROM incidents WHERE 1=1`
+	var args []interface{}
+	if !filter.IncludeHidden {
+		query += " AND is_hidden = false"
+	}
+	if !filter.IncludeInactive {
+		query += " AND status IN ('active', 'hidden') AND expires_at > NOW()"
+	}
+	if filter.Box != nil {
+		query += " AND latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?"
+		args = append(args, filter.Box.MinLat, filter.Box.MaxLat, filter.Box.MinLon, filter.Box.MaxLon)
+	}
+	if filter.RouteName != "" {
+		query += " AND route_name = ?"
+		args = append(args, filter.RouteName)
+	}
+	if filter.Within > 0 {
+		query += " AND created_at > DATE_SUB(NOW(), INTERVAL ? SECOND)"
+		args = append(args, int64(filter.Within.Seconds()))
+	}
+	query += " ORDER BY created_at DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	incidents := []models.Incident{}
+	for rows.Next() {
+		incident, err := scanIncident(rows)
+		if err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, incident)
+	}
+	return incidents, rows.Err()
+}
+
+func (r *mariaIncidents) CastVote(ctx context.Context, vote models.IncidentVote, thresholds ModerationThresholds) (*models.Incident, []models.IncidentModerationEntry, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// Bloquear el incidente para que votos concurrentes no pisen los contadores
+	incident, err := scanIncident(tx.QueryRowContext(ctx, `SELECT `+incidentColumns+` FROM incidents WHERE id = ? FOR UPDATE`, vote.IncidentID))
+	if err != nil {
+		return nil, nil, notFound(err)
+	}
+
+	var previous *models.IncidentVote
+	var prev models.IncidentVote
+	err = tx.QueryRowContext(ctx, `
+		SELECT vote, weight FROM incident_votes WHERE incident_id = ? AND voter_key = ?
+	`, vote.IncidentID, vote.VoterKey).Scan(&prev.Vote, &prev.Weight)
+	switch {
+	case err == nil:
+		if prev.Vote == vote.Vote {
+			return nil, nil, ErrDuplicate
+		}
+		previous = &prev
+		_, err = tx.ExecContext(ctx, `
+			UPDATE incident_votes SET vote = ?, weight = ?, updated_at = NOW()
+			WHERE incident_id = ? AND voter_key = ?
+		`, vote.Vote, vote.Weight, vote.IncidentID, vote.VoterKey)
+	case errors.Is(err, sql.ErrNoRows):
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO incident_votes (incident_id, voter_key, vote, weight) VALUES (?, ?, ?, ?)
+		`, vote.IncidentID, vote.VoterKey, vote.Vote, vote.Weight)
+		if err != nil && isDuplicate(err) {
+			return nil, nil, ErrDuplicate
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var deviceScore float64
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(vote * weight), 0) FROM incident_votes
+		WHERE incident_id = ? AND voter_key LIKE ?
+	`, vote.IncidentID, DeviceVoterPrefix+"%").Scan(&deviceScore); err != nil {
+		return nil, nil, err
+	}
+
+	applyVote(&incident, previous, vote)
+	actions := thresholds.moderate(&incident, deviceScore)
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE incidents
+		SET upvotes = ?, downvotes = ?, weighted_score = ?, is_verified = ?, is_hidden = ?, status = ?, updated_at = NOW()
+		WHERE id = ?
+	`, incident.Upvotes, incident.Downvotes, incident.WeightedScore, incident.IsVerified, incident.IsHidden, incident.Status, incident.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries := []models.IncidentModerationEntry{}
+	for _, action := range actions {
+		entry := models.IncidentModerationEntry{
+			IncidentID:    incident.ID,
+			Action:        action,
+			WeightedScore: incident.WeightedScore,
+			Upvotes:       incident.Upvotes,
+			Downvotes:     incident.Downvotes,
+			TriggerVoter:  vote.VoterKey,
+			CreatedAt:     time.Now().UTC(),
+		}
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO incident_moderation_log (
+				incident_id, action, weighted_score, upvotes, downvotes, trigger_voter, created_at
+			) VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, entry.IncidentID, entry.Action, entry.WeightedScore, entry.Upvotes, entry.Downvotes, nullString(entry.TriggerVoter), entry.CreatedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+		entry.ID, _ = result.LastInsertId()
+		entries = append(entries, entry)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return &incident, entries, nil
+}
+
+func (r *mariaIncidents) Confirm(ctx context.Context, confirmation models.IncidentConfirmation, resolveAfter int) (*ConfirmationResult, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var live bool
+	incident, err := scanIncident(tx.QueryRowContext(ctx, `SELECT `+incidentColumns+` FROM incidents WHERE id = ? FOR UPDATE`, confirmation.IncidentID))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	err = tx.QueryRowContext(ctx, `
+		SELECT status IN ('active', 'hidden') AND expires_at > NOW() FROM incidents WHERE id = ?
+	`, incident.ID).Scan(&live)
+	if err != nil {
+		return nil, err
+	}
+	if !live {
+		return nil, ErrInactive
+	}
+
+	var previous bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT still_there FROM incident_confirmations WHERE incident_id = ? AND voter_key = ?
+	`, incident.ID, confirmation.VoterKey).Scan(&previous)
+	switch {
+	case err == nil:
+		if previous == confirmation.StillThere {
+			return nil, ErrDuplicate
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE incident_confirmations SET still_there = ?, updated_at = NOW()
+			WHERE incident_id = ? AND voter_key = ?
+		`, confirmation.StillThere, incident.ID, confirmation.VoterKey)
+	case errors.Is(err, sql.ErrNoRows):
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO incident_confirmations (incident_id, voter_key, still_there) VALUES (?, ?, ?)
+		`, incident.ID, confirmation.VoterKey, confirmation.StillThere)
+		if err != nil && isDuplicate(err) {
+			return nil, ErrDuplicate
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ConfirmationResult{}
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(still_there = true), 0), COALESCE(SUM(still_there = false), 0)
+		FROM incident_confirmations WHERE incident_id = ?
+	`, incident.ID).Scan(&result.StillThere, &result.Gone)
+	if err != nil {
+		return nil, err
+	}
+
+	if confirmation.StillThere {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE incidents
+			SET expires_at = GREATEST(expires_at, DATE_ADD(NOW(), INTERVAL ? SECOND)), updated_at = NOW()
+			WHERE id = ?
+		`, int64(incident.Type.TTL().Seconds()), incident.ID)
+	} else if shouldResolve(result.StillThere, result.Gone, resolveAfter) {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE incidents SET status = ?, resolved_at = NOW(), updated_at = NOW() WHERE id = ?
+		`, models.IncidentStatusResolved, incident.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	incident, err = scanIncident(tx.QueryRowContext(ctx, `SELECT `+incidentColumns+` FROM incidents WHERE id = ?`, incident.ID))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	result.Incident = &incident
+	return result, nil
+}
+
+func (r *mariaIncidents) ExpireDue(ctx context.Context) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE incidents SET status = ?, updated_at = NOW()
+		WHERE status IN ('active', 'hidden') AND expires_at <= NOW()
+	`, models.IncidentStatusExpired)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *mariaIncidents) ModerationLog(ctx context.Context, incidentID int64) ([]models.IncidentModerationEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, incident_id, action, weighted_score, upvotes, downvotes,
+		       COALESCE(trigger_voter, ''), created_at
+		FROM incident_moderation_log
+		WHERE incident_id = ?
+		ORDER BY created_at, id
+	`, incidentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.IncidentModerationEntry{}
+	for rows.Next() {
+		var entry models.IncidentModerationEntry
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.IncidentID,
+			&entry.Action,
+			&entry.WeightedScore,
+			&entry.Upvotes,
+			&entry.Downvotes,
+			&entry.TriggerVoter,
+			&entry.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (r *mariaIncidents) Reputation(ctx context.Context, reporterID string) (*models.ReporterReputation, error) {
+	rep := &models.ReporterReputation{ReporterID: reporterID}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(upvotes), 0),
+			COALESCE(SUM(downvotes), 0),
+			COALESCE(SUM(is_verified = true), 0),
+			COALESCE(SUM(is_hidden = true), 0)
+		FROM incidents
+		WHERE reporter_id = ?
+	`, reporterID).Scan(&rep.Reports, &rep.Upvotes, &rep.Downvotes, &rep.Verified, &rep.Hidden)
+	if err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+func (r *mariaIncidents) Stats(ctx context.Context) (*models.IncidentStats, error) {
+	stats := &models.IncidentStats{
+		ByType:     make(map[models.IncidentType]int),
+		BySeverity: make(map[models.IncidentSeverity]int),
+		ByStatus:   make(map[models.IncidentStatus]int),
+	}
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(is_verified = true), 0),
+			COALESCE(SUM(is_hidden = true), 0),
+			COALESCE(SUM(status = 'active' AND expires_at > NOW()), 0),
+			COALESCE(SUM(created_at > DATE_SUB(NOW(), INTERVAL 24 HOUR)), 0)
+		FROM incidents
+	`).Scan(&stats.TotalIncidents, &stats.VerifiedCount, &stats.HiddenCount, &stats.ActiveCount, &stats.Last24Hours)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.countBy(ctx, "type", func(key string, n int) { stats.ByType[models.IncidentType(key)] = n }); err != nil {
+		return nil, err
+	}
+	if err := r.countBy(ctx, "severity", func(key string, n int) { stats.BySeverity[models.IncidentSeverity(key)] = n }); err != nil {
+		return nil, err
+	}
+	if err := r.countBy(ctx, incidentEffectiveStatus, func(key string, n int) { stats.ByStatus[models.IncidentStatus(key)] = n }); err != nil {
+		return nil, err
+	}
+
+	var mostReported string
+	err = r.db.QueryRowContext(ctx, `
+		SELECT route_name FROM incidents
+		WHERE route_name IS NOT NULL AND status = 'active' AND expires_at > NOW()
+		GROUP BY route_name
+		ORDER BY COUNT(*) DESC
+		LIMIT 1
+	`).Scan(&mostReported)
+	if err == nil {
+		stats.MostReportedRoute = &mostReported
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// countBy agrupa incidentes por una columna o expresión fija (type, severity, estado)
+func (r *mariaIncidents) countBy(ctx context.Context, column string, add func(key string, n int)) error {
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf("SELECT %s, COUNT(*) FROM incidents GROUP BY 1", column))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var n int
+		if err := rows.Scan(&key, &n); err != nil {
+			return err
+		}
+		add(key, n)
+	}
+	return rows.Err()
+}
+
+// ============================================================================
+// HISTORIAL DE VIAJES
+// ============================================================================
+
+type mariaTrips struct {
+	db *sql.DB
+}
+
+func (r *mariaTrips) Create(ctx context.Context, trip *models.TripHistory) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO trip_history (
+			user_id, origin_lat, origin_lon,
+			destination_lat, destination_lon, destination_name,
+			distance_meters, duration_seconds, bus_route,
+			route_geometry, started_at, completed_at, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW())
+	`,
+		trip.UserID,
+		trip.OriginLat,
+		trip.OriginLon,
+		trip.DestinationLat,
+		trip.DestinationLon,
+		trip.DestinationName,
+		trip.DistanceMeters,
+		trip.DurationSeconds,
+		trip.BusRoute,
+		trip.RouteGeometry,
+		trip.StartedAt,
+		trip.CompletedAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *mariaTrips) ListByUser(ctx context.Context, userID int64, limit, offset int) ([]models.TripHistory, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT
+			id, user_id, origin_lat, origin_lon,
+			destination_lat, destination_lon, destination_name,
+			distance_meters, duration_seconds, bus_route,
+			route_geometry, started_at, completed_at, created_at
+		FROM trip_history
+		WHERE user_id = ?
+		ORDER BY completed_at DESC
+		LIMIT ? OFFSET ?
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trips := []models.TripHistory{}
+	for rows.Next() {
+		var trip models.TripHistory
+		var completedAt sql.NullTime
+		err := rows.Scan(
+			&trip.ID,
+			&trip.UserID,
+			&trip.OriginLat,
+			&trip.OriginLon,
+			&trip.DestinationLat,
+			&trip.DestinationLon,
+			&trip.DestinationName,
+			&trip.DistanceMeters,
+			&trip.DurationSeconds,
+			&trip.BusRoute,
+			&trip.RouteGeometry,
+			&trip.StartedAt,
+			&completedAt,
+			&trip.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if completedAt.Valid {
+			trip.CompletedAt = &completedAt.Time
+		}
+		trips = append(trips, trip)
+	}
+	return trips, rows.Err()
+}
+
+func (r *mariaTrips) scanLocations(rows *sql.Rows) ([]models.FrequentLocation, error) {
+	defer rows.Close()
+	locations := []models.FrequentLocation{}
+	for rows.Next() {
+		var loc models.FrequentLocation
+		if err := rows.Scan(&loc.Name, &loc.Latitude, &loc.Longitude, &loc.VisitCount, &loc.FirstVisit, &loc.LastVisit); err != nil {
+			return nil, err
+		}
+		locations = append(locations, loc)
+	}
+	return locations, rows.Err()
+}
+
+func (r *mariaTrips) FrequentLocations(ctx context.Context, userID int64, limit int) ([]models.FrequentLocation, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT
+			destination_name,
+			AVG(destination_lat) as lat,
+			AVG(destination_lon) as lon,
+			COUNT(*) as visit_count,
+			MIN(started_at) as first_visit,
+			MAX(started_at) as last_visit
+		FROM trip_history
+		WHERE user_id = ?
+		GROUP BY destination_name
+		ORDER BY visit_count DESC, last_visit DESC
+		LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return r.scanLocations(rows)
+}
+
+func (r *mariaTrips) Statistics(ctx context.Context, userID int64) (*models.TripStatistics, error) {
+	var stats models.TripStatistics
+	err := r.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*) as total_trips,
+			COALESCE(SUM(distance_meters), 0) as total_distance,
+			COALESCE(SUM(duration_seconds), 0) as total_duration,
+			COALESCE(AVG(distance_meters), 0) as avg_distance,
+			COALESCE(ROUND(AVG(duration_seconds)), 0) as avg_duration
+		FROM trip_history
+		WHERE user_id = ?
+	`, userID).Scan(
+		&stats.TotalTrips,
+		&stats.TotalDistanceMeters,
+		&stats.TotalDurationSeconds,
+		&stats.AverageDistanceMeters,
+		&stats.AverageDurationSeconds,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	frequent, err := r.FrequentLocations(ctx, userID, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(frequent) > 0 {
+		stats.MostVisitedLocation = &frequent[0]
+	}
+
+	var favoriteHour int
+	err = r.db.QueryRowContext(ctx, `
+		SELECT HOUR(started_at) as hour
+		FROM trip_history
+		WHERE user_id = ?
+		GROUP BY hour
+		ORDER BY COUNT(*) DESC
+		LIMIT 1
+	`, userID).Scan(&favoriteHour)
+	if err == nil {
+		stats.FavoriteTimeOfDay = fmt.Sprintf("%02d:00", favoriteHour)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func (r *mariaTrips) DestinationsAt(ctx context.Context, userID int64, fromHour, toHour int, weekday time.Weekday, limit int) ([]models.FrequentLocation, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT
+			destination_name,
+			destination_lat,
+			destination_lon,
+			COUNT(*) as frequency,
+			MIN(started_at),
+			MAX(started_at)
+		FROM trip_history
+		WHERE user_id = ?
+		AND HOUR(started_at) BETWEEN ? AND ?
+		AND DAYOFWEEK(started_at) = ?
+		GROUP BY destination_name, destination_lat, destination_lon
+		ORDER BY frequency DESC
+		LIMIT ?
+	`, userID, fromHour, toHour, int(weekday)+1, limit) // MySQL usa 1-7, Go usa 0-6
+	if err != nil {
+		return nil, err
+	}
+	return r.scanLocations(rows)
+}
+
+// ============================================================================
+// UBICACIÓN COMPARTIDA
+// ============================================================================
+
+type mariaShares struct {
+	db *sql.DB
+}
+
+const shareColumns = `
+	id, user_id, latitude, longitude, heading, speed, bus_route, next_stop,
+	next_stop_eta, destination_lat, destination_lon, destination_name,
+	planned_route, deviation_threshold_m, stationary_minutes, recipient_name,
+	message, expires_at, is_active, created_at, last_updated_at`
+
+func scanShare(row interface{ Scan(...interface{}) error }) (models.LocationShare, error) {
+	var share models.LocationShare
+	var plannedRoute []byte
+	err := row.Scan(
+		&share.ID,
+		&share.UserID,
+		&share.Latitude,
+		&share.Longitude,
+		&share.Heading,
+		&share.Speed,
+		&share.BusRoute,
+		&share.NextStop,
+		&share.NextStopETA,
+		&share.DestinationLat,
+		&share.DestinationLon,
+		&share.DestinationName,
+		&plannedRoute,
+		&share.DeviationThresholdM,
+		&share.StationaryMinutes,
+		&share.RecipientName,
+		&share.Message,
+		&share.ExpiresAt,
+		&share.IsActive,
+		&share.CreatedAt,
+		&share.LastUpdatedAt,
+	)
+	if err == nil && len(plannedRoute) > 0 {
+		err = json.Unmarshal(plannedRoute, &share.PlannedRoute)
+	}
+	return share, err
+}
+
+func (r *mariaShares) Create(ctx context.Context, share *models.LocationShare) error {
+	var plannedRoute interface{}
+	if len(share.PlannedRoute) > 0 {
+		data, err := json.Marshal(share.PlannedRoute)
+		if err != nil {
+			return err
+		}
+		plannedRoute = string(data)
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO location_shares (
+			id, user_id, latitude, longitude, destination_lat, destination_lon,
+			destination_name, planned_route, deviation_threshold_m,
+			stationary_minutes, recipient_name, message, expires_at, is_active,
+			created_at, last_updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, true, NOW(), NOW())
+	`,
+		share.ID,
+		share.UserID,
+		share.Latitude,
+		share.Longitude,
+		share.DestinationLat,
+		share.DestinationLon,
+		share.DestinationName,
+		plannedRoute,
+		share.DeviationThresholdM,
+		share.StationaryMinutes,
+		share.RecipientName,
+		share.Message,
+		share.ExpiresAt,
+	)
+	return err
+}
+
+func (r *mariaShares) GetActive(ctx context.Context, id string) (*models.LocationShare, error) {
+	share, err := scanShare(r.db.QueryRowContext(ctx, `
+		SELECT `+shareColumns+`
+		FROM location_shares
+		WHERE id = ? AND is_active = true AND expires_at > NOW()
+	`, id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &share, nil
+}
+
+func (r *mariaShares) GetForUser(ctx context.Context, id string, userID int64) (*models.LocationShare, error) {
+	share, err := scanShare(r.db.QueryRowContext(ctx, `
+		SELECT `+shareColumns+`
+		FROM location_shares
+		WHERE id = ? AND user_id = ?
+	`, id, userID))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &share, nil
+}
+
+func (r *mariaShares) UpdatePosition(ctx context.Context, id string, userID int64, pos models.SharePosition) (*models.LocationShare, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE location_shares
+		SET latitude = ?, longitude = ?, heading = ?, speed = ?, bus_route = ?,
+		    next_stop = ?, next_stop_eta = ?, last_updated_at = NOW()
+		WHERE id = ? AND user_id = ? AND is_active = true AND expires_at > NOW()
+	`, pos.Latitude, pos.Longitude, pos.Heading, pos.Speed, pos.BusRoute,
+		pos.NextStop, pos.NextStopETA, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrNotFound
+	}
+	return r.GetActive(ctx, id)
+}
+
+func (r *mariaShares) Stop(ctx context.Context, id string, userID int64) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE location_shares
+		SET is_active = false, last_updated_at = NOW()
+		WHERE id = ? AND user_id = ?
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mariaShares) ListByUser(ctx context.Context, userID int64, limit int) ([]models.LocationShare, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+shareColumns+`
+		FROM location_shares
+		WHERE user_id = ?
+		ORDER BY created_at DESC
+		LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []models.LocationShare{}
+	for rows.Next() {
+		share, err := scanShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+func (r *mariaShares) AddPoint(ctx context.Context, id string, point models.SharePoint, keep int) error {
+	if _, err := r.db.ExecContext(ctx, `
+		INSERT INTO location_share_points (share_id, latitude, longitude, heading, speed, recorded_at)
+		VALUES (?, ?, ?, ?, ?, NOW(3))
+	`, id, point.Latitude, point.Longitude, point.Heading, point.Speed); err != nil {
+		return err
+	}
+
+	// Recortar al punto más antiguo que se conserva
+	var oldestKept int64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id FROM location_share_points
+		WHERE share_id = ?
+		ORDER BY id DESC
+		LIMIT 1 OFFSET ?
+	`, id, keep-1).Scan(&oldestKept)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		DELETE FROM location_share_points WHERE share_id = ? AND id < ?
+	`, id, oldestKept)
+	return err
+}
+
+func (r *mariaShares) Trail(ctx context.Context, id string, limit int) ([]models.SharePoint, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, share_id, latitude, longitude, heading, speed, recorded_at
+		FROM location_share_points
+		WHERE share_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []models.SharePoint{}
+	for rows.Next() {
+		var p models.SharePoint
+		if err := rows.Scan(&p.ID, &p.ShareID, &p.Latitude, &p.Longitude, &p.Heading, &p.Speed, &p.RecordedAt); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Más antiguos primero
+	for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+		points[i], points[j] = points[j], points[i]
+	}
+	return points, nil
+}
+
+func (r *mariaShares) AddAlert(ctx context.Context, alert *models.ShareAlert) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO location_share_alerts (share_id, kind, message, latitude, longitude, distance_m, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, NOW(3))
+	`, alert.ShareID, alert.Kind, alert.Message, alert.Latitude, alert.Longitude, alert.DistanceMeters)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *mariaShares) Alerts(ctx context.Context, id string) ([]models.ShareAlert, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, share_id, kind, message, latitude, longitude, distance_m, created_at
+		FROM location_share_alerts
+		WHERE share_id = ?
+		ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []models.ShareAlert{}
+	for rows.Next() {
+		var a models.ShareAlert
+		if err := rows.Scan(&a.ID, &a.ShareID, &a.Kind, &a.Message, &a.Latitude, &a.Longitude, &a.DistanceMeters, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+const shareRecipientColumns = `
+	id, share_id, label, token_hash, pin_hash, created_at, revoked_at, last_access_at`
+
+func scanShareRecipient(row interface{ Scan(...interface{}) error }) (models.ShareRecipient, error) {
+	var recipient models.ShareRecipient
+	err := row.Scan(
+		&recipient.ID,
+		&recipient.ShareID,
+		&recipient.Label,
+		&recipient.TokenHash,
+		&recipient.PINHash,
+		&recipient.CreatedAt,
+		&recipient.RevokedAt,
+		&recipient.LastAccessAt,
+	)
+	recipient.HasPIN = recipient.PINHash != nil
+	return recipient, err
+}
+
+func (r *mariaShares) AddRecipient(ctx context.Context, recipient *models.ShareRecipient) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO location_share_recipients (share_id, label, token_hash, pin_hash, created_at)
+		VALUES (?, ?, ?, ?, NOW())
+	`, recipient.ShareID, recipient.Label, recipient.TokenHash, recipient.PINHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *mariaShares) Recipients(ctx context.Context, shareID string) ([]models.ShareRecipient, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+shareRecipientColumns+`
+		FROM location_share_recipients
+		WHERE share_id = ?
+		ORDER BY id
+	`, shareID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := []models.ShareRecipient{}
+	for rows.Next() {
+		recipient, err := scanShareRecipient(rows)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, rows.Err()
+}
+
+func (r *mariaShares) RecipientByToken(ctx context.Context, tokenHash string) (*models.ShareRecipient, error) {
+	recipient, err := scanShareRecipient(r.db.QueryRowContext(ctx, `
+		SELECT `+shareRecipientColumns+`
+		FROM location_share_recipients
+		WHERE token_hash = ?
+	`, tokenHash))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &recipient, nil
+}
+
+func (r *mariaShares) RevokeRecipient(ctx context.Context, shareID string, recipientID int64) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE location_share_recipients
+		SET revoked_at = NOW()
+		WHERE id = ? AND share_id = ? AND revoked_at IS NULL
+	`, recipientID, shareID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mariaShares) LogAccess(ctx context.Context, entry *models.ShareAccess) error {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO location_share_access_log (share_id, recipient_id, via, outcome, ip_address, user_agent, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, NOW())
+	`, entry.ShareID, entry.RecipientID, entry.Via, entry.Outcome, entry.IPAddress, entry.UserAgent)
+	if err != nil {
+		return err
+	}
+	if entry.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+	if entry.Outcome != models.ShareAccessGranted || entry.RecipientID == nil {
+		return nil
+	}
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE location_share_recipients SET last_access_at = NOW() WHERE id = ?
+	`, *entry.RecipientID)
+	return err
+}
+
+func (r *mariaShares) SetAccessOutcome(ctx context.Context, accessID int64, outcome models.ShareAccessOutcome) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE location_share_access_log SET outcome = ? WHERE id = ?
+	`, outcome, accessID)
+	if err != nil {
+		return err
+	}
+	// RowsAffected cuenta filas cambiadas: 0 también si ya tenía ese resultado
+	if n, _ := result.RowsAffected(); n == 0 {
+		var exists bool
+		if err := r.db.QueryRowContext(ctx, `
+			SELECT EXISTS(SELECT 1 FROM location_share_access_log WHERE id = ?)
+		`, accessID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+	}
+	if outcome != models.ShareAccessGranted {
+		return nil
+	}
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE location_share_recipients r
+		JOIN location_share_access_log l ON l.recipient_id = r.id
+		SET r.last_access_at = NOW()
+		WHERE l.id = ?
+	`, accessID)
+	return err
+}
+
+func (r *mariaShares) AccessLog(ctx context.Context, shareID string, limit int) ([]models.ShareAccess, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, share_id, recipient_id, via, outcome, ip_address, user_agent, created_at
+		FROM location_share_access_log
+		WHERE share_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, shareID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.ShareAccess{}
+	for rows.Next() {
+		var e models.ShareAccess
+		if err := rows.Scan(&e.ID, &e.ShareID, &e.RecipientID, &e.Via, &e.Outcome, &e.IPAddress, &e.UserAgent, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (r *mariaShares) CountAccess(ctx context.Context, recipientID int64, outcome models.ShareAccessOutcome, since time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM location_share_access_log
+		WHERE recipient_id = ? AND outcome = ? AND created_at >= ?
+	`, recipientID, outcome, since).Scan(&count)
+	return count, err
+}
+
+// ============================================================================
+// USUARIOS
+// ============================================================================
+
+type mariaUsers struct {
+	db *sql.DB
+}
+
+const userColumns = `
+	id, username, COALESCE(email, ''), name, COALESCE(password_hash, ''),
+	COALESCE(biometric_id, ''), auth_type, role, COALESCE(device_info, ''),
+	created_at, last_login, disabled_at`
+
+func (r *mariaUsers) scan(row *sql.Row) (*models.User, error) {
+	var u models.User
+	var lastLogin, disabledAt sql.NullTime
+	err := row.Scan(&u.ID, &u.Username, &u.Email, &u.Name, &u.PasswordHash,
+		&u.BiometricID, &u.AuthType, &u.Role, &u.DeviceInfo, &u.CreatedAt, &lastLogin, &disabledAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if lastLogin.Valid {
+		u.LastLogin = &lastLogin.Time
+	}
+	if disabledAt.Valid {
+		u.DisabledAt = &disabledAt.Time
+	}
+	return &u, nil
+}
+
+func (r *mariaUsers) Create(ctx context.Context, user *models.User) (int64, error) {
+	authType := user.AuthType
+	if authType == "" {
+		authType = "password"
+	}
+	role := user.Role
+	if role == "" {
+		role = models.RoleUser
+	}
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO users (username, email, name, password_hash, biometric_id, auth_type, role, device_info, last_login)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		user.Username,
+		nullString(user.Email),
+		user.Name,
+		nullString(user.PasswordHash),
+		nullString(user.BiometricID),
+		authType,
+		role,
+		nullString(user.DeviceInfo),
+		user.LastLogin,
+	)
+	if err != nil {
+		if isDuplicate(err) {
+			return 0, ErrDuplicate
+		}
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (r *mariaUsers) ByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.scan(r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE username = ?`, username))
+}
+
+func (r *mariaUsers) ByBiometricID(ctx context.Context, biometricID string) (*models.User, error) {
+	return r.scan(r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE biometric_id = ?`, biometricID))
+}
+
+func (r *mariaUsers) TouchLastLogin(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET last_login = NOW() WHERE id = ?`, id)
+	return err
+}
+
+// ============================================================================
+// SESIONES (refresh tokens por dispositivo)
+// ============================================================================
+
+type mariaSessions struct {
+	db *sql.DB
+}
+
+func (r *mariaSessions) Create(ctx context.Context, session *models.UserSession, refreshHash string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_sessions (
+			id, user_id, refresh_token_hash, device_info, ip_address,
+			user_agent, created_at, last_used_at, expires_at
+		) VALUES (?, ?, ?, ?, ?, ?, NOW(), NOW(), ?)
+	`, session.ID, session.UserID, refreshHash, session.DeviceInfo, session.IPAddress, session.UserAgent, session.ExpiresAt)
+	return err
+}
+
+func (r *mariaSessions) ByRefreshHash(ctx context.Context, hash string) (*RefreshSession, error) {
+	var s RefreshSession
+	// El rol se relee en cada renovación: un cambio de rol llega al siguiente access token
+	err := r.db.QueryRowContext(ctx, `
+		SELECT s.id, s.user_id, u.username, u.role, s.revoked_at IS NULL AND s.expires_at > NOW() AND u.disabled_at IS NULL
+		FROM user_sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.refresh_token_hash = ?
+	`, hash).Scan(&s.SessionID, &s.UserID, &s.Username, &s.Role, &s.Active)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &s, nil
+}
+
+func (r *mariaSessions) ByUsedHash(ctx context.Context, hash string) (string, error) {
+	var id string
+	err := r.db.QueryRowContext(ctx, `SELECT session_id FROM user_session_used_tokens WHERE token_hash = ?`, hash).Scan(&id)
+	return id, notFound(err)
+}
+
+func (r *mariaSessions) Rotate(ctx context.Context, id, currentHash, newHash string, expiresAt time.Time, ipAddress string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE user_sessions
+		SET refresh_token_hash = ?, last_used_at = NOW(), expires_at = ?, ip_address = ?
+		WHERE id = ? AND refresh_token_hash = ? AND revoked_at IS NULL
+	`, newHash, expiresAt, nullString(ipAddress), id, currentHash)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrConflict
+	}
+	// En la misma transacción: no puede quedar un token reemplazado sin registrar
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO user_session_used_tokens (token_hash, session_id) VALUES (?, ?)
+	`, currentHash, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *mariaSessions) IsActive(ctx context.Context, id string) (bool, error) {
+	var active bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT revoked_at IS NULL AND expires_at > NOW()
+		FROM user_sessions
+		WHERE id = ?
+	`, id).Scan(&active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return active, err
+}
+
+func (r *mariaSessions) ListActive(ctx context.Context, userID int64) ([]models.UserSession, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, device_info, ip_address, user_agent,
+			created_at, last_used_at, expires_at, revoked_at
+		FROM user_sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.UserSession{}
+	for rows.Next() {
+		var s models.UserSession
+		if err := rows.Scan(&s.ID, &s.UserID, &s.DeviceInfo, &s.IPAddress, &s.UserAgent,
+			&s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.RevokedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *mariaSessions) Revoke(ctx context.Context, id string, userID int64) error {
+	query := `UPDATE user_sessions SET revoked_at = NOW() WHERE id = ? AND revoked_at IS NULL`
+	args := []interface{}{id}
+	if userID != 0 {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mariaSessions) RevokeAll(ctx context.Context, userID int64, exceptID string) (int64, error) {
+	query := `UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL`
+	args := []interface{}{userID}
+	if exceptID != "" {
+		query += " AND id <> ?"
+		args = append(args, exceptID)
+	}
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ============================================================================
+// PREFERENCIAS DE NOTIFICACIÓN
+// ============================================================================
+
+type mariaPreferences struct {
+	db *sql.DB
+}
+
+func (r *mariaPreferences) Get(ctx context.Context, userID int64) (*models.NotificationPreferences, error) {
+	var prefs models.NotificationPreferences
+	err := r.db.QueryRowContext(ctx, `
+		SELECT
+			id, user_id, approaching_distance, near_distance,
+			very_near_distance, enable_audio, enable_vibration,
+			enable_visual, audio_volume, vibration_intensity,
+			minimum_priority, created_at, updated_at
+		FROM notification_preferences
+		WHERE user_id = ?
+	`, userID).Scan(
+		&prefs.ID,
+		&prefs.UserID,
+		&prefs.ApproachingDistance,
+		&prefs.NearDistance,
+		&prefs.VeryNearDistance,
+		&prefs.EnableAudio,
+		&prefs.EnableVibration,
+		&prefs.EnableVisual,
+		&prefs.AudioVolume,
+		&prefs.VibrationIntensity,
+		&prefs.MinimumPriority,
+		&prefs.CreatedAt,
+		&prefs.UpdatedAt,
+	)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &prefs, nil
+}
+
+func (r *mariaPreferences) Upsert(ctx context.Context, userID int64, req models.NotificationPreferencesUpdateRequest) error {
+	// Columnas presentes en la solicitud: sólo esas se pisan si la fila ya existe
+	fields := []struct {
+		column  string
+		present bool
+	}{
+		{"approaching_distance", req.ApproachingDistance != nil},
+		{"near_distance", req.NearDistance != nil},
+		{"very_near_distance", req.VeryNearDistance != nil},
+		{"enable_audio", req.EnableAudio != nil},
+		{"enable_vibration", req.EnableVibration != nil},
+		{"enable_visual", req.EnableVisual != nil},
+		{"audio_volume", req.AudioVolume != nil},
+		{"vibration_intensity", req.VibrationIntensity != nil},
+		{"minimum_priority", req.MinimumPriority != nil},
+	}
+	updates := []string{}
+	for _, f := range fields {
+		if f.present {
+			updates = append(updates, f.column+" = VALUES("+f.column+")")
+		}
+	}
+	updates = append(updates, "updated_at = NOW()")
+
+	prefs := DefaultNotificationPreferences()
+	applyPreferences(&prefs, req)
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO notification_preferences (
+			user_id, approaching_distance, near_distance,
+			very_near_distance, enable_audio, enable_vibration,
+			enable_visual, audio_volume, vibration_intensity,
+			minimum_priority, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())
+		ON DUPLICATE KEY UPDATE `+strings.Join(updates, ", "),
+		userID,
+		prefs.ApproachingDistance,
+		prefs.NearDistance,
+		prefs.VeryNearDistance,
+		prefs.EnableAudio,
+		prefs.EnableVibration,
+		prefs.EnableVisual,
+		prefs.AudioVolume,
+		prefs.VibrationIntensity,
+		prefs.MinimumPriority,
+	)
+	return err
+}
+
+// ============================================================================
+// SUSCRIPCIONES Y NOTIFICACIONES
+// ============================================================================
+
+type mariaSubscriptions struct {
+	db *sql.DB
+}
+
+const subscriptionColumns = `
+	id, user_id, kind, route_name, stop_name, latitude, longitude, radius_m, label, created_at`
+
+func scanSubscription(row interface{ Scan(...interface{}) error }) (models.IncidentSubscription, error) {
+	var sub models.IncidentSubscription
+	err := row.Scan(
+		&sub.ID,
+		&sub.UserID,
+		&sub.Kind,
+		&sub.RouteName,
+		&sub.StopName,
+		&sub.Latitude,
+		&sub.Longitude,
+		&sub.RadiusM,
+		&sub.Label,
+		&sub.CreatedAt,
+	)
+	return sub, err
+}
+
+func (r *mariaSubscriptions) querySubscriptions(ctx context.Context, query string, args ...interface{}) ([]models.IncidentSubscription, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []models.IncidentSubscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+func (r *mariaSubscriptions) Create(ctx context.Context, sub *models.IncidentSubscription) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO incident_subscriptions (
+			user_id, kind, route_name, stop_name, latitude, longitude, radius_m, label, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW())
+	`,
+		sub.UserID,
+		sub.Kind,
+		sub.RouteName,
+		sub.StopName,
+		sub.Latitude,
+		sub.Longitude,
+		sub.RadiusM,
+		sub.Label,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *mariaSubscriptions) ListByUser(ctx context.Context, userID int64) ([]models.IncidentSubscription, error) {
+	return r.querySubscriptions(ctx, `
+		SELECT `+subscriptionColumns+` FROM incident_subscriptions
+		WHERE user_id = ?
+		ORDER BY created_at, id
+	`, userID)
+}
+
+func (r *mariaSubscriptions) Delete(ctx context.Context, id, userID int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM incident_subscriptions WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mariaSubscriptions) Matching(ctx context.Context, incident *models.Incident) ([]models.IncidentSubscription, error) {
+	var routeName, stopName string
+	if incident.RouteName != nil {
+		routeName = *incident.RouteName
+	}
+	if incident.StopName != nil {
+		stopName = *incident.StopName
+	}
+
+	// Zonas: distancia Haversine en metros contra el radio de cada suscripción
+	return r.querySubscriptions(ctx, `
+		SELECT `+subscriptionColumns+` FROM incident_subscriptions
+		WHERE (kind = 'route' AND ? <> '' AND route_name = ?)
+		   OR (kind = 'stop' AND ? <> '' AND stop_name = ?)
+		   OR (kind = 'area' AND 6371000 * 2 * ASIN(SQRT(
+				POWER(SIN(RADIANS(latitude - ?) / 2), 2) +
+				COS(RADIANS(?)) * COS(RADIANS(latitude)) * POWER(SIN(RADIANS(longitude - ?) / 2), 2)
+			)) <= radius_m)
+		ORDER BY user_id, id
+	`, routeName, routeName, stopName, stopName, incident.Latitude, incident.Latitude, incident.Longitude)
+}
+
+type mariaNotifications struct {
+	db *sql.DB
+}
+
+func (r *mariaNotifications) Create(ctx context.Context, notification *models.Notification) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO notifications (
+			user_id, kind, incident_id, subscription_id, title, body, priority,
+			audio, vibration, visual, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW())
+	`,
+		notification.UserID,
+		notification.Kind,
+		notification.IncidentID,
+		notification.SubscriptionID,
+		notification.Title,
+		notification.Body,
+		notification.Priority,
+		notification.Channels.Audio,
+		notification.Channels.Vibration,
+		notification.Channels.Visual,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *mariaNotifications) ListByUser(ctx context.Context, userID int64, unreadOnly bool, limit int) ([]models.Notification, error) {
+	query := `
+		SELECT id, user_id, kind, incident_id, subscription_id, title, COALESCE(body, ''),
+		       priority, audio, vibration, visual, read_at, created_at
+		FROM notifications
+		WHERE user_id = ?`
+	if unreadOnly {
+		query += " AND read_at IS NULL"
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT ?"
+
+	rows, err := r.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		if err := rows.Scan(
+			&n.ID,
+			&n.UserID,
+			&n.Kind,
+			&n.IncidentID,
+			&n.SubscriptionID,
+			&n.Title,
+			&n.Body,
+			&n.Priority,
+			&n.Channels.Audio,
+			&n.Channels.Vibration,
+			&n.Channels.Visual,
+			&n.ReadAt,
+			&n.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (r *mariaNotifications) UnreadCount(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL
+	`, userID).Scan(&count)
+	return count, err
+}
+
+func (r *mariaNotifications) MarkRead(ctx context.Context, userID int64, ids []int64) (int64, error) {
+	query := "UPDATE notifications SET read_at = NOW() WHERE user_id = ? AND read_at IS NULL"
+	args := []interface{}{userID}
+	if len(ids) > 0 {
+		query += " AND id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+type mariaContributions struct {
+	db *sql.DB
+}
+
+const contributionColumns = `
+	id, user_id, type, category, title, description, latitude, longitude,
+	bus_route, stop_name, delay_minutes, severity, status, moderator_note,
+	moderated_by, moderated_at, incident_id, upvotes, downvotes, contact_email,
+	device_info, created_at, updated_at`
+
+func scanContribution(row interface{ Scan(...interface{}) error }) (models.Contribution, error) {
+	var c models.Contribution
+	var deviceInfo []byte
+	err := row.Scan(
+		&c.ID,
+		&c.UserID,
+		&c.Type,
+		&c.Category,
+		&c.Title,
+		&c.Description,
+		&c.Latitude,
+		&c.Longitude,
+		&c.BusRoute,
+		&c.StopName,
+		&c.DelayMinutes,
+		&c.Severity,
+		&c.Status,
+		&c.ModeratorNote,
+		&c.ModeratedBy,
+		&c.ModeratedAt,
+		&c.IncidentID,
+		&c.Upvotes,
+		&c.Downvotes,
+		&c.ContactEmail,
+		&deviceInfo,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	)
+	if len(deviceInfo) > 0 {
+		c.DeviceInfo = json.RawMessage(deviceInfo)
+	}
+	return c, err
+}
+
+func (r *mariaContributions) Create(ctx context.Context, contribution *models.Contribution) (int64, error) {
+	var deviceInfo interface{}
+	if len(contribution.DeviceInfo) > 0 {
+		deviceInfo = string(contribution.DeviceInfo)
+	}
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO contributions (
+			user_id, type, category, title, description, latitude, longitude,
+			bus_route, stop_name, delay_minutes, severity, status, contact_email,
+			device_info, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())
+	`,
+		contribution.UserID,
+		contribution.Type,
+		contribution.Category,
+		contribution.Title,
+		contribution.Description,
+		contribution.Latitude,
+		contribution.Longitude,
+		contribution.BusRoute,
+		contribution.StopName,
+		contribution.DelayMinutes,
+		contribution.Severity,
+		models.ContributionPending,
+		contribution.ContactEmail,
+		deviceInfo,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *mariaContributions) Get(ctx context.Context, id int64) (*models.Contribution, error) {
+	contribution, err := scanContribution(r.db.QueryRowContext(ctx, `SELECT `+contributionColumns+` FROM contributions WHERE id = ?`, id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &contribution, nil
+}
+
+func (r *mariaContributions) List(ctx context.Context, filter ContributionFilter) ([]models.Contribution, error) {
+	query := `SELECT ` + contributionColumns + ` FROM contributions WHERE 1=1`
+	var args []interface{}
+	if len(filter.Statuses) > 0 {
+		query += " AND status IN (?" + strings.Repeat(", ?", len(filter.Statuses)-1) + ")"
+		for _, status := range filter.Statuses {
+			args = append(args, status)
+		}
+	}
+	if filter.UserID != nil {
+		query += " AND user_id = ?"
+		args = append(args, *filter.UserID)
+	}
+	if filter.Type != "" {
+		query += " AND type = ?"
+		args = append(args, filter.Type)
+	}
+	if filter.BusRoute != "" {
+		query += " AND bus_route = ?"
+		args = append(args, filter.BusRoute)
+	}
+	if filter.OldestFirst {
+		query += " ORDER BY created_at, id"
+	} else {
+		query += " ORDER BY created_at DESC, id DESC"
+	}
+	query += " LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contributions := []models.Contribution{}
+	for rows.Next() {
+		contribution, err := scanContribution(rows)
+		if err != nil {
+			return nil, err
+		}
+		contributions = append(contributions, contribution)
+	}
+	return contributions, rows.Err()
+}
+
+// lockOwnPending bloquea la contribución del usuario y verifica que siga pendiente
+func lockOwnPending(ctx context.Context, tx *sql.Tx, id, userID int64) (*models.Contribution, error) {
+	contribution, err := scanContribution(tx.QueryRowContext(ctx, `
+		SELECT `+contributionColumns+` FROM contributions WHERE id = ? AND user_id = ? FOR UPDATE
+	`, id, userID))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if contribution.Status != models.ContributionPending {
+		return nil, ErrConflict
+	}
+	return &contribution, nil
+}
+
+func (r *mariaContributions) Update(ctx context.Context, id, userID int64, req models.ContributionUpdateRequest) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	contribution, err := lockOwnPending(ctx, tx, id, userID)
+	if err != nil {
+		return err
+	}
+	contribution.Apply(req)
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE contributions
+		SET category = ?, title = ?, description = ?, latitude = ?, longitude = ?,
+		    bus_route = ?, stop_name = ?, delay_minutes = ?, severity = ?,
+		    contact_email = ?, updated_at = NOW()
+		WHERE id = ?
+	`,
+		contribution.Category,
+		contribution.Title,
+		contribution.Description,
+		contribution.Latitude,
+		contribution.Longitude,
+		contribution.BusRoute,
+		contribution.StopName,
+		contribution.DelayMinutes,
+		contribution.Severity,
+		contribution.ContactEmail,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *mariaContributions) Delete(ctx context.Context, id, userID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockOwnPending(ctx, tx, id, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM contributions WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *mariaContributions) Moderate(ctx context.Context, id int64, decision ContributionDecision) (*models.Contribution, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	contribution, err := scanContribution(tx.QueryRowContext(ctx, `SELECT `+contributionColumns+` FROM contributions WHERE id = ? FOR UPDATE`, id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if !hasStatus(contribution.Status, decision.From) {
+		return nil, ErrConflict
+	}
+
+	incidentID := contribution.IncidentID
+	if decision.Incident != nil {
+		newID, err := insertIncident(ctx, tx, decision.Incident)
+		if err != nil {
+			return nil, err
+		}
+		incidentID = &newID
+	}
+	if decision.To == models.ContributionResolved && incidentID != nil {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE incidents SET status = ?, resolved_at = NOW(), updated_at = NOW()
+			WHERE id = ? AND status IN ('active', 'hidden') AND expires_at > NOW()
+		`, models.IncidentStatusResolved, *incidentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE contributions
+		SET status = ?, moderator_note = NULLIF(?, ''), moderated_by = ?, moderated_at = NOW(),
+		    incident_id = ?, updated_at = NOW()
+		WHERE id = ?
+	`, decision.To, decision.Note, decision.Moderator, incidentID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	contribution, err = scanContribution(tx.QueryRowContext(ctx, `SELECT `+contributionColumns+` FROM contributions WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &contribution, nil
+}
+
+// ============================================================================
+// EVENTOS DE DEBUG DE LA APP
+// ============================================================================
+
+type mariaDebugEvents struct {
+	db *sql.DB
+}
+
+const debugEventColumns = `
+	id, kind, level, COALESCE(device_id, ''), COALESCE(session_id, ''), user_id,
+	COALESCE(event_type, ''), message, COALESCE(stack_trace, ''),
+	COALESCE(fingerprint, ''), metadata, occurred_at, created_at`
+
+func (r *mariaDebugEvents) Create(ctx context.Context, event *models.DebugEvent) (int64, error) {
+	var metadata interface{}
+	if len(event.Metadata) > 0 {
+		metadata = string(event.Metadata)
+	}
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO app_debug_events (
+			kind, level, device_id, session_id, user_id, event_type, message,
+			stack_trace, fingerprint, metadata, occurred_at, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW())
+	`,
+		event.Kind,
+		event.Level,
+		nullString(event.DeviceID),
+		nullString(event.SessionID),
+		event.UserID,
+		nullString(event.EventType),
+		event.Message,
+		nullString(event.StackTrace),
+		nullString(event.Fingerprint),
+		metadata,
+		event.OccurredAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// debugEventWhere arma el WHERE común de List e Issues
+func debugEventWhere(filter DebugEventFilter) (string, []interface{}) {
+	where := []string{"1 = 1"}
+	var args []interface{}
+	if len(filter.Kinds) > 0 {
+		where = append(where, "kind IN (?"+strings.Repeat(", ?", len(filter.Kinds)-1)+")")
+		for _, kind := range filter.Kinds {
+			args = append(args, kind)
+		}
+	}
+	if len(filter.Levels) > 0 {
+		where = append(where, "level IN (?"+strings.Repeat(", ?", len(filter.Levels)-1)+")")
+		for _, level := range filter.Levels {
+			args = append(args, level)
+		}
+	}
+	if filter.DeviceID != "" {
+		where = append(where, "device_id = ?")
+		args = append(args, filter.DeviceID)
+	}
+	if filter.SessionID != "" {
+		where = append(where, "session_id = ?")
+		args = append(args, filter.SessionID)
+	}
+	if filter.UserID != nil {
+		where = append(where, "user_id = ?")
+		args = append(args, *filter.UserID)
+	}
+	if filter.Fingerprint != "" {
+		where = append(where, "fingerprint = ?")
+		args = append(args, filter.Fingerprint)
+	}
+	if filter.Query != "" {
+		pattern := "%" + escapeLike(filter.Query) + "%"
+		where = append(where, "(message LIKE ? OR stack_trace LIKE ?)")
+		args = append(args, pattern, pattern)
+	}
+	if filter.Since != nil {
+		where = append(where, "occurred_at >= ?")
+		args = append(args, *filter.Since)
+	}
+	if filter.Until != nil {
+		where = append(where, "occurred_at < ?")
+		args = append(args, *filter.Until)
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// escapeLike escapa los comodines de LIKE en texto del usuario
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (r *mariaDebugEvents) List(ctx context.Context, filter DebugEventFilter) ([]models.DebugEvent, error) {
+	where, args := debugEventWhere(filter)
+	order := "DESC"
+	if filter.OldestFirst {
+		order = "ASC"
+	}
+	query := "SELECT " + debugEventColumns + " FROM app_debug_events WHERE " + where +
+		" ORDER BY occurred_at " + order + ", id " + order + " LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.DebugEvent{}
+	for rows.Next() {
+		var e models.DebugEvent
+		var metadata []byte
+		if err := rows.Scan(
+			&e.ID,
+			&e.Kind,
+			&e.Level,
+			&e.DeviceID,
+			&e.SessionID,
+			&e.UserID,
+			&e.EventType,
+			&e.Message,
+			&e.StackTrace,
+			&e.Fingerprint,
+			&metadata,
+			&e.OccurredAt,
+			&e.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if len(metadata) > 0 {
+			e.Metadata = json.RawMessage(metadata)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (r *mariaDebugEvents) Issues(ctx context.Context, filter DebugEventFilter, byCount bool) ([]models.DebugIssue, error) {
+	filter.Kinds = []models.DebugEventKind{models.DebugEventError}
+	where, args := debugEventWhere(filter)
+	order := "g.last_seen DESC"
+	if byCount {
+		order = "g.events DESC, g.last_seen DESC"
+	}
+	// El error más reciente de cada grupo (MAX(id)) aporta el mensaje y el stack
+	query := `
+		SELECT g.fingerprint, COALESCE(e.event_type, ''), e.message, COALESCE(e.stack_trace, ''),
+		       g.last_id, g.events, g.devices, g.sessions, g.first_seen, g.last_seen
+		FROM (
+			SELECT fingerprint, COUNT(*) AS events, COUNT(DISTINCT device_id) AS devices,
+			       COUNT(DISTINCT session_id) AS sessions, MIN(occurred_at) AS first_seen,
+			       MAX(occurred_at) AS last_seen, MAX(id) AS last_id
+			FROM app_debug_events
+			WHERE ` + where + ` AND fingerprint IS NOT NULL
+			GROUP BY fingerprint
+		) g
+		JOIN app_debug_events e ON e.id = g.last_id
+		ORDER BY ` + order + `
+		LIMIT ? OFFSET ?`
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	issues := []models.DebugIssue{}
+	for rows.Next() {
+		var issue models.DebugIssue
+		if err := rows.Scan(
+			&issue.Fingerprint,
+			&issue.ErrorType,
+			&issue.Message,
+			&issue.StackTrace,
+			&issue.LastEventID,
+			&issue.Count,
+			&issue.Devices,
+			&issue.Sessions,
+			&issue.FirstSeen,
+			&issue.LastSeen,
+		); err != nil {
+			return nil, err
+		}
+		issues = append(issues, issue)
+	}
+	return issues, rows.Err()
+}
+
+func (r *mariaDebugEvents) Prune(ctx context.Context, before time.Time, max int) (int64, error) {
+	var deleted int64
+	if !before.IsZero() {
+		result, err := r.db.ExecContext(ctx, "DELETE FROM app_debug_events WHERE created_at < ?", before)
+		if err != nil {
+			return 0, err
+		}
+		if deleted, err = result.RowsAffected(); err != nil {
+			return 0, err
+		}
+	}
+	if max <= 0 {
+		return deleted, nil
+	}
+
+	// id del evento más nuevo que queda fuera del límite
+	var cutoff int64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id FROM app_debug_events ORDER BY id DESC LIMIT 1 OFFSET ?
+	`, max).Scan(&cutoff)
+	if errors.Is(err, sql.ErrNoRows) {
+		return deleted, nil
+	}
+	if err != nil {
+		return deleted, err
+	}
+
+	result, err := r.db.ExecContext(ctx, "DELETE FROM app_debug_events WHERE id <= ?", cutoff)
+	if err != nil {
+		return deleted, err
+	}
+	overflow, err := result.RowsAffected()
+	return deleted + overflow, err
+}
+
+// ============================================================================
+// OBSERVACIONES DE LLEGADAS (Red.cl)
+// ============================================================================
+
+type mariaArrivals struct {
+	db *sql.DB
+}
+
+func (r *mariaArrivals) Record(ctx context.Context, observations []models.ArrivalObservation) error {
+	if len(observations) == 0 {
+		return nil
+	}
+	values := make([]string, 0, len(observations))
+	args := make([]interface{}, 0, len(observations)*7)
+	for _, o := range observations {
+		values = append(values, "(?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, o.StopCode, o.Route, o.ObservedAt, o.DistanceMeters, o.PredictedMinutes, o.Plate, o.Passed)
+	}
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO bus_arrival_observations (
+			stop_code, route, observed_at, distance_m, predicted_minutes, plate, passed
+		) VALUES `+strings.Join(values, ", "), args...)
+	return err
+}
+
+func (r *mariaArrivals) List(ctx context.Context, filter ArrivalObservationFilter) ([]models.ArrivalObservation, error) {
+	where := []string{"observed_at >= ?"}
+	args := []interface{}{filter.Since}
+	if filter.StopCode != "" {
+		where = append(where, "stop_code = ?")
+		args = append(args, filter.StopCode)
+	}
+	if filter.Route != "" {
+		where = append(where, "route = ?")
+		args = append(args, filter.Route)
+	}
+	query := `
+		SELECT id, stop_code, route, observed_at, distance_m, predicted_minutes, plate, passed
+		FROM bus_arrival_observations
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY stop_code, route, observed_at, id`
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	observations := []models.ArrivalObservation{}
+	for rows.Next() {
+		var o models.ArrivalObservation
+		var distance, predicted sql.NullInt64
+		var plate sql.NullString
+		if err := rows.Scan(&o.ID, &o.StopCode, &o.Route, &o.ObservedAt, &distance, &predicted, &plate, &o.Passed); err != nil {
+			return nil, err
+		}
+		if distance.Valid {
+			meters := int(distance.Int64)
+			o.DistanceMeters = &meters
+		}
+		if predicted.Valid {
+			minutes := int(predicted.Int64)
+			o.PredictedMinutes = &minutes
+		}
+		if plate.Valid {
+			o.Plate = &plate.String
+		}
+		observations = append(observations, o)
+	}
+	return observations, rows.Err()
+}
+
+func (r *mariaArrivals) Prune(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM bus_arrival_observations WHERE observed_at < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,1612 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourorg/wayfindcl/internal/models"
+)
+
+// Memory es la implementación embebida de los repositorios: guarda todo en
+// mapas protegidos por un mutex, sin servidor de base de datos. Pensada para
+// tests end-to-end de los handlers (NewMemory + handlers.InitRepositories).
+// Las paradas y rutas GTFS se cargan con SeedStops y SeedRoute.
+type Memory struct {
+	Store
+
+	mu  sync.RWMutex
+	now func() time.Time
+
+	stops  []models.Stop
+	routes map[string]MemoryRoute
+
+	incidents      map[int64]*models.Incident
+	nextIncidentID int64
+	incidentVotes  map[int64]map[string]models.IncidentVote // incidente -> voter_key -> voto
+	confirmations  map[int64]map[string]bool                // incidente -> voter_key -> sigue ahí
+	moderationLog  []models.IncidentModerationEntry
+
+	trips      []models.TripHistory
+	nextTripID int64
+
+	shares      map[string]*models.LocationShare
+	sharePoints map[string][]models.SharePoint
+	shareAlerts map[string][]models.ShareAlert
+	nextPointID int64
+	nextAlertID int64
+
+	shareRecipients map[int64]*models.ShareRecipient
+	nextRecipientID int64
+	shareAccess     []models.ShareAccess
+	nextAccessID    int64
+
+	users      map[int64]*models.User
+	nextUserID int64
+
+	sessions map[string]*memSession
+
+	prefs       map[int64]*models.NotificationPreferences
+	nextPrefsID int64
+
+	subscriptions      []models.IncidentSubscription
+	nextSubscriptionID int64
+
+	notifications      []models.Notification
+	nextNotificationID int64
+
+	contributions      map[int64]*models.Contribution
+	nextContributionID int64
+
+	debugEvents      []models.DebugEvent
+	nextDebugEventID int64
+
+	arrivals      []models.ArrivalObservation
+	nextArrivalID int64
+}
+
+// MemoryRoute describe una ruta GTFS para SeedRoute
+type MemoryRoute struct {
+	ShortName string
+	ShapeID   string
+	Shape     [][]float64 // [lon, lat] en orden de secuencia
+	Trips     [][]string  // Cada viaje como lista ordenada de stop_id/código
+}
+
+// NewMemory crea un Store vacío en memoria
+func NewMemory() *Memory {
+	m := &Memory{
+		now:             time.Now,
+		routes:          make(map[string]MemoryRoute),
+		incidents:       make(map[int64]*models.Incident),
+		incidentVotes:   make(map[int64]map[string]models.IncidentVote),
+		confirmations:   make(map[int64]map[string]bool),
+		shares:          make(map[string]*models.LocationShare),
+		sharePoints:     make(map[string][]models.SharePoint),
+		shareAlerts:     make(map[string][]models.ShareAlert),
+		shareRecipients: make(map[int64]*models.ShareRecipient),
+		users:           make(map[int64]*models.User),
+		sessions:        make(map[string]*memSession),
+		prefs:           make(map[int64]*models.NotificationPreferences),
+		contributions:   make(map[int64]*models.Contribution),
+	}
+	m.Store = Store{
+		Stops:         (*memStops)(m),
+		Routes:        (*memRoutes)(m),
+		Incidents:     (*memIncidents)(m),
+		Trips:         (*memTrips)(m),
+		Shares:        (*memShares)(m),
+		Users:         (*memUsers)(m),
+		Sessions:      (*memSessions)(m),
+		Preferences:   (*memPreferences)(m),
+		Subscriptions: (*memSubscriptions)(m),
+		Notifications: (*memNotifications)(m),
+		Contributions: (*memContributions)(m),
+		DebugEvents:   (*memDebugEvents)(m),
+		Arrivals:      (*memArrivals)(m),
+	}
+	return m
+}
+
+// SetClock reemplaza el reloj (expiración de shares, ventanas de incidentes)
+func (m *Memory) SetClock(now func() time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = now
+}
+
+// SeedStops agrega paradas GTFS
+func (m *Memory) SeedStops(stops ...models.Stop) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stops = append(m.stops, stops...)
+}
+
+// SeedRoute agrega (o reemplaza) una ruta GTFS
+func (m *Memory) SeedRoute(route MemoryRoute) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.routes[route.ShortName] = route
+}
+
+// ============================================================================
+// PARADAS Y RUTAS (GTFS)
+// ============================================================================
+
+type memStops Memory
+
+func (r *memStops) InBoundingBox(ctx context.Context, box BoundingBox) ([]models.Stop, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stops := make([]models.Stop, 0)
+	for _, stop := range r.stops {
+		if box.Contains(stop.Latitude, stop.Longitude) {
+			stops = append(stops, stop)
+		}
+	}
+	return stops, nil
+}
+
+func (r *memStops) ByCode(ctx context.Context, code string) (*models.Stop, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, stop := range r.stops {
+		if strings.ToUpper(stop.StopID) == code || (stop.Code != "" && strings.ToUpper(stop.Code) == code) {
+			found := stop
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+type memRoutes Memory
+
+func (r *memRoutes) Shape(ctx context.Context, routeShortName string) (string, [][]float64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	route, ok := r.routes[routeShortName]
+	if !ok || len(route.Shape) == 0 {
+		return "", nil, ErrNotFound
+	}
+	points := make([][]float64, len(route.Shape))
+	for i, p := range route.Shape {
+		points[i] = []float64{p[0], p[1]}
+	}
+	return route.ShapeID, points, nil
+}
+
+func (r *memRoutes) CountStopsBetween(ctx context.Context, routeShortName, fromStopCode, toStopCode string) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	route, ok := r.routes[routeShortName]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	for _, trip := range route.Trips {
+		from := -1
+		for i, code := range trip {
+			if from < 0 && code == fromStopCode {
+				from = i
+			} else if from >= 0 && code == toStopCode {
+				return i - from + 1, nil
+			}
+		}
+	}
+	return 0, ErrNotFound
+}
+
+// ============================================================================
+// INCIDENTES
+// ============================================================================
+
+type memIncidents Memory
+
+func (r *memIncidents) Create(ctx context.Context, incident *models.Incident) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return (*Memory)(r).insertIncident(incident), nil
+}
+
+// insertIncident crea un incidente activo (el llamador tiene el lock)
+func (m *Memory) insertIncident(incident *models.Incident) int64 {
+	m.nextIncidentID++
+	stored := *incident
+	stored.ID = m.nextIncidentID
+	stored.Status = models.IncidentStatusActive
+	stored.CreatedAt = m.now()
+	stored.UpdatedAt = stored.CreatedAt
+	stored.ExpiresAt = stored.CreatedAt.Add(stored.Type.TTL())
+	m.incidents[stored.ID] = &stored
+	return stored.ID
+}
+
+func (r *memIncidents) Get(ctx context.Context, id int64) (*models.Incident, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	incident, ok := r.incidents[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *incident
+	return &found, nil
+}
+
+func (r *memIncidents) List(ctx context.Context, filter IncidentFilter) ([]models.Incident, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := r.now()
+	incidents := []models.Incident{}
+	for _, incident := range r.incidents {
+		if incident.IsHidden && !filter.IncludeHidden {
+			continue
+		}
+		if !filter.IncludeInactive && !isLive(incident, now) {
+			continue
+		}
+		if filter.Box != nil && !filter.Box.Contains(incident.Latitude, incident.Longitude) {
+			continue
+		}
+		if filter.RouteName != "" && (incident.RouteName == nil || *incident.RouteName != filter.RouteName) {
+			continue
+		}
+		if filter.Within > 0 && !incident.CreatedAt.After(now.Add(-filter.Within)) {
+			continue
+		}
+		incidents = append(incidents, *incident)
+	}
+	sort.Slice(incidents, func(i, j int) bool {
+		if incidents[i].CreatedAt.Equal(incidents[j].CreatedAt) {
+			return incidents[i].ID > incidents[j].ID
+		}
+		return incidents[i].CreatedAt.After(incidents[j].CreatedAt)
+	})
+	if filter.Limit > 0 && len(incidents) > filter.Limit {
+		incidents = incidents[:filter.Limit]
+	}
+	return incidents, nil
+}
+
+func (r *memIncidents) CastVote(ctx context.Context, vote models.IncidentVote, thresholds ModerationThresholds) (*models.Incident, []models.IncidentModerationEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	incident, ok := r.incidents[vote.IncidentID]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+
+	votes := r.incidentVotes[vote.IncidentID]
+	if votes == nil {
+		votes = make(map[string]models.IncidentVote)
+		r.incidentVotes[vote.IncidentID] = votes
+	}
+	var previous *models.IncidentVote
+	if prev, ok := votes[vote.VoterKey]; ok {
+		if prev.Vote == vote.Vote {
+			return nil, nil, ErrDuplicate
+		}
+		previous = &prev
+	}
+	votes[vote.VoterKey] = vote
+
+	now := r.now()
+	var deviceScore float64
+	for key, v := range votes {
+		if strings.HasPrefix(key, DeviceVoterPrefix) {
+			deviceScore += float64(v.Vote) * v.Weight
+		}
+	}
+
+	applyVote(incident, previous, vote)
+	actions := thresholds.moderate(incident, deviceScore)
+	incident.UpdatedAt = now
+
+	entries := []models.IncidentModerationEntry{}
+	for _, action := range actions {
+		entry := models.IncidentModerationEntry{
+			ID:            int64(len(r.moderationLog) + 1),
+			IncidentID:    incident.ID,
+			Action:        action,
+			WeightedScore: incident.WeightedScore,
+			Upvotes:       incident.Upvotes,
+			Downvotes:     incident.Downvotes,
+			TriggerVoter:  vote.VoterKey,
+			CreatedAt:     now,
+		}
+		r.moderationLog = append(r.moderationLog, entry)
+		entries = append(entries, entry)
+	}
+
+	updated := *incident
+	return &updated, entries, nil
+}
+
+func (r *memIncidents) Confirm(ctx context.Context, confirmation models.IncidentConfirmation, resolveAfter int) (*ConfirmationResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	incident, ok := r.incidents[confirmation.IncidentID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	now := r.now()
+	if !isLive(incident, now) {
+		return nil, ErrInactive
+	}
+
+	confirmations := r.confirmations[incident.ID]
+	if confirmations == nil {
+		confirmations = make(map[string]bool)
+		r.confirmations[incident.ID] = confirmations
+	}
+	if previous, ok := confirmations[confirmation.VoterKey]; ok && previous == confirmation.StillThere {
+		return nil, ErrDuplicate
+	}
+	confirmations[confirmation.VoterKey] = confirmation.StillThere
+
+	result := &ConfirmationResult{}
+	for _, stillThere := range confirmations {
+		if stillThere {
+			result.StillThere++
+		} else {
+			result.Gone++
+		}
+	}
+
+	if confirmation.StillThere {
+		if extended := now.Add(incident.Type.TTL()); extended.After(incident.ExpiresAt) {
+			incident.ExpiresAt = extended
+		}
+		incident.UpdatedAt = now
+	} else if shouldResolve(result.StillThere, result.Gone, resolveAfter) {
+		incident.Status = models.IncidentStatusResolved
+		resolvedAt := now
+		incident.ResolvedAt = &resolvedAt
+		incident.UpdatedAt = now
+	}
+
+	updated := *incident
+	result.Incident = &updated
+	return result, nil
+}
+
+func (r *memIncidents) ExpireDue(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	var expired int64
+	for _, incident := range r.incidents {
+		if (incident.Status == models.IncidentStatusActive || incident.Status == models.IncidentStatusHidden) &&
+			!incident.ExpiresAt.After(now) {
+			incident.Status = models.IncidentStatusExpired
+			incident.UpdatedAt = now
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+func (r *memIncidents) ModerationLog(ctx context.Context, incidentID int64) ([]models.IncidentModerationEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entries := []models.IncidentModerationEntry{}
+	for _, entry := range r.moderationLog {
+		if entry.IncidentID == incidentID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (r *memIncidents) Reputation(ctx context.Context, reporterID string) (*models.ReporterReputation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rep := &models.ReporterReputation{ReporterID: reporterID}
+	for _, incident := range r.incidents {
+		if incident.ReporterID != reporterID {
+			continue
+		}
+		rep.Reports++
+		rep.Upvotes += incident.Upvotes
+		rep.Downvotes += incident.Downvotes
+		if incident.IsVerified {
+			rep.Verified++
+		}
+		if incident.IsHidden {
+			rep.Hidden++
+		}
+	}
+	return rep, nil
+}
+
+func (r *memIncidents) Stats(ctx context.Context) (*models.IncidentStats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stats := &models.IncidentStats{
+		ByType:     make(map[models.IncidentType]int),
+		BySeverity: make(map[models.IncidentSeverity]int),
+		ByStatus:   make(map[models.IncidentStatus]int),
+	}
+	now := r.now()
+	since := now.Add(-24 * time.Hour)
+	byRoute := make(map[string]int)
+	for _, incident := range r.incidents {
+		stats.TotalIncidents++
+		stats.ByType[incident.Type]++
+		stats.BySeverity[incident.Severity]++
+		if incident.IsVerified {
+			stats.VerifiedCount++
+		}
+		if incident.IsHidden {
+			stats.HiddenCount++
+		}
+		if incident.CreatedAt.After(since) {
+			stats.Last24Hours++
+		}
+		live := isLive(incident, now)
+		status := incident.Status
+		if !live && (status == models.IncidentStatusActive || status == models.IncidentStatusHidden) {
+			status = models.IncidentStatusExpired // Vencido aún sin barrer
+		}
+		stats.ByStatus[status]++
+		if live && status == models.IncidentStatusActive {
+			stats.ActiveCount++
+			if incident.RouteName != nil {
+				byRoute[*incident.RouteName]++
+			}
+		}
+	}
+	best := 0
+	for route, n := range byRoute {
+		if n > best || (n == best && stats.MostReportedRoute != nil && route < *stats.MostReportedRoute) {
+			name := route
+			stats.MostReportedRoute = &name
+			best = n
+		}
+	}
+	return stats, nil
+}
+
+// ============================================================================
+// HISTORIAL DE VIAJES
+// ============================================================================
+
+type memTrips Memory
+
+func (r *memTrips) Create(ctx context.Context, trip *models.TripHistory) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextTripID++
+	stored := *trip
+	stored.ID = r.nextTripID
+	stored.CreatedAt = r.now()
+	r.trips = append(r.trips, stored)
+	return stored.ID, nil
+}
+
+// userTrips retorna los viajes del usuario (llamar con el lock tomado)
+func (r *memTrips) userTrips(userID int64) []models.TripHistory {
+	var trips []models.TripHistory
+	for _, trip := range r.trips {
+		if trip.UserID == userID {
+			trips = append(trips, trip)
+		}
+	}
+	return trips
+}
+
+func (r *memTrips) ListByUser(ctx context.Context, userID int64, limit, offset int) ([]models.TripHistory, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	trips := r.userTrips(userID)
+	// Igual que ORDER BY completed_at DESC en MariaDB: los NULL van al final
+	sort.SliceStable(trips, func(i, j int) bool {
+		a, b := trips[i].CompletedAt, trips[j].CompletedAt
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return a.After(*b)
+	})
+	if offset >= len(trips) {
+		return []models.TripHistory{}, nil
+	}
+	trips = trips[offset:]
+	if limit >= 0 && len(trips) > limit {
+		trips = trips[:limit]
+	}
+	return trips, nil
+}
+
+// groupDestinations agrupa viajes por clave de destino, más visitados primero
+func groupDestinations(trips []models.TripHistory, key func(models.TripHistory) string, limit int) []models.FrequentLocation {
+	type group struct {
+		loc            models.FrequentLocation
+		sumLat, sumLon float64
+	}
+	groups := make(map[string]*group)
+	var order []string
+	for _, trip := range trips {
+		k := key(trip)
+		g, ok := groups[k]
+		if !ok {
+			g = &group{loc: models.FrequentLocation{Name: trip.DestinationName, FirstVisit: trip.StartedAt, LastVisit: trip.StartedAt}}
+			groups[k] = g
+			order = append(order, k)
+		}
+		g.loc.VisitCount++
+		g.sumLat += trip.DestinationLat
+		g.sumLon += trip.DestinationLon
+		if trip.StartedAt.Before(g.loc.FirstVisit) {
+			g.loc.FirstVisit = trip.StartedAt
+		}
+		if trip.StartedAt.After(g.loc.LastVisit) {
+			g.loc.LastVisit = trip.StartedAt
+		}
+	}
+
+	locations := make([]models.FrequentLocation, 0, len(order))
+	for _, k := range order {
+		g := groups[k]
+		g.loc.Latitude = g.sumLat / float64(g.loc.VisitCount)
+		g.loc.Longitude = g.sumLon / float64(g.loc.VisitCount)
+		locations = append(locations, g.loc)
+	}
+	sort.SliceStable(locations, func(i, j int) bool {
+		if locations[i].VisitCount != locations[j].VisitCount {
+			return locations[i].VisitCount > locations[j].VisitCount
+		}
+		return locations[i].LastVisit.After(locations[j].LastVisit)
+	})
+	if limit >= 0 && len(locations) > limit {
+		locations = locations[:limit]
+	}
+	return locations
+}
+
+func (r *memTrips) FrequentLocations(ctx context.Context, userID int64, limit int) ([]models.FrequentLocation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return groupDestinations(r.userTrips(userID), func(t models.TripHistory) string { return t.DestinationName }, limit), nil
+}
+
+func (r *memTrips) Statistics(ctx context.Context, userID int64) (*models.TripStatistics, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	trips := r.userTrips(userID)
+	stats := &models.TripStatistics{TotalTrips: len(trips)}
+	if len(trips) == 0 {
+		return stats, nil
+	}
+
+	hours := make(map[int]int)
+	for _, trip := range trips {
+		stats.TotalDistanceMeters += trip.DistanceMeters
+		stats.TotalDurationSeconds += int64(trip.DurationSeconds)
+		hours[trip.StartedAt.Hour()]++
+	}
+	stats.AverageDistanceMeters = stats.TotalDistanceMeters / float64(len(trips))
+	stats.AverageDurationSeconds = int(float64(stats.TotalDurationSeconds)/float64(len(trips)) + 0.5)
+
+	frequent := groupDestinations(trips, func(t models.TripHistory) string { return t.DestinationName }, 1)
+	stats.MostVisitedLocation = &frequent[0]
+
+	favorite, best := 0, 0
+	for hour, n := range hours {
+		if n > best || (n == best && hour < favorite) {
+			favorite, best = hour, n
+		}
+	}
+	stats.FavoriteTimeOfDay = fmt.Sprintf("%02d:00", favorite)
+	return stats, nil
+}
+
+func (r *memTrips) DestinationsAt(ctx context.Context, userID int64, fromHour, toHour int, weekday time.Weekday, limit int) ([]models.FrequentLocation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var matching []models.TripHistory
+	for _, trip := range r.userTrips(userID) {
+		h := trip.StartedAt.Hour()
+		if h >= fromHour && h <= toHour && trip.StartedAt.Weekday() == weekday {
+			matching = append(matching, trip)
+		}
+	}
+	key := func(t models.TripHistory) string {
+		return fmt.Sprintf("%s|%f|%f", t.DestinationName, t.DestinationLat, t.DestinationLon)
+	}
+	return groupDestinations(matching, key, limit), nil
+}
+
+// ============================================================================
+// UBICACIÓN COMPARTIDA
+// ============================================================================
+
+type memShares Memory
+
+func (r *memShares) Create(ctx context.Context, share *models.LocationShare) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.shares[share.ID]; exists {
+		return ErrDuplicate
+	}
+	stored := *share
+	stored.IsActive = true
+	stored.CreatedAt = r.now()
+	stored.LastUpdatedAt = stored.CreatedAt
+	r.shares[stored.ID] = &stored
+	return nil
+}
+
+// activeShare retorna el share si está activo y vigente (llamar con el lock tomado)
+func (r *memShares) activeShare(id string) (*models.LocationShare, bool) {
+	share, ok := r.shares[id]
+	if !ok || !share.IsActive || !share.ExpiresAt.After(r.now()) {
+		return nil, false
+	}
+	return share, true
+}
+
+func (r *memShares) GetActive(ctx context.Context, id string) (*models.LocationShare, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	share, ok := r.activeShare(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *share
+	return &found, nil
+}
+
+func (r *memShares) GetForUser(ctx context.Context, id string, userID int64) (*models.LocationShare, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	share, ok := r.shares[id]
+	if !ok || share.UserID != userID {
+		return nil, ErrNotFound
+	}
+	found := *share
+	return &found, nil
+}
+
+func (r *memShares) UpdatePosition(ctx context.Context, id string, userID int64, pos models.SharePosition) (*models.LocationShare, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	share, ok := r.activeShare(id)
+	if !ok || share.UserID != userID {
+		return nil, ErrNotFound
+	}
+	share.Latitude = pos.Latitude
+	share.Longitude = pos.Longitude
+	share.Heading = pos.Heading
+	share.Speed = pos.Speed
+	share.BusRoute = pos.BusRoute
+	share.NextStop = pos.NextStop
+	share.NextStopETA = pos.NextStopETA
+	share.LastUpdatedAt = r.now()
+	updated := *share
+	return &updated, nil
+}
+
+func (r *memShares) Stop(ctx context.Context, id string, userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	share, ok := r.shares[id]
+	if !ok || share.UserID != userID {
+		return ErrNotFound
+	}
+	share.IsActive = false
+	share.LastUpdatedAt = r.now()
+	return nil
+}
+
+func (r *memShares) ListByUser(ctx context.Context, userID int64, limit int) ([]models.LocationShare, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	shares := []models.LocationShare{}
+	for _, share := range r.shares {
+		if share.UserID == userID {
+			shares = append(shares, *share)
+		}
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		return shares[i].CreatedAt.After(shares[j].CreatedAt)
+	})
+	if limit >= 0 && len(shares) > limit {
+		shares = shares[:limit]
+	}
+	return shares, nil
+}
+
+func (r *memShares) AddPoint(ctx context.Context, id string, point models.SharePoint, keep int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextPointID++
+	point.ID = r.nextPointID
+	point.ShareID = id
+	point.RecordedAt = r.now()
+	points := append(r.sharePoints[id], point)
+	if len(points) > keep {
+		points = append([]models.SharePoint(nil), points[len(points)-keep:]...)
+	}
+	r.sharePoints[id] = points
+	return nil
+}
+
+func (r *memShares) Trail(ctx context.Context, id string, limit int) ([]models.SharePoint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	points := r.sharePoints[id]
+	if limit >= 0 && len(points) > limit {
+		points = points[len(points)-limit:]
+	}
+	return append([]models.SharePoint{}, points...), nil
+}
+
+func (r *memShares) AddAlert(ctx context.Context, alert *models.ShareAlert) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextAlertID++
+	stored := *alert
+	stored.ID = r.nextAlertID
+	stored.CreatedAt = r.now()
+	r.shareAlerts[stored.ShareID] = append(r.shareAlerts[stored.ShareID], stored)
+	return stored.ID, nil
+}
+
+func (r *memShares) Alerts(ctx context.Context, id string) ([]models.ShareAlert, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]models.ShareAlert{}, r.shareAlerts[id]...), nil
+}
+
+func (r *memShares) AddRecipient(ctx context.Context, recipient *models.ShareRecipient) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.shareRecipients {
+		if existing.TokenHash == recipient.TokenHash {
+			return 0, ErrDuplicate
+		}
+	}
+	r.nextRecipientID++
+	stored := *recipient
+	stored.ID = r.nextRecipientID
+	stored.HasPIN = stored.PINHash != nil
+	stored.CreatedAt = r.now()
+	r.shareRecipients[stored.ID] = &stored
+	return stored.ID, nil
+}
+
+func (r *memShares) Recipients(ctx context.Context, shareID string) ([]models.ShareRecipient, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	recipients := []models.ShareRecipient{}
+	for _, recipient := range r.shareRecipients {
+		if recipient.ShareID == shareID {
+			recipients = append(recipients, *recipient)
+		}
+	}
+	sort.Slice(recipients, func(i, j int) bool {
+		return recipients[i].ID < recipients[j].ID
+	})
+	return recipients, nil
+}
+
+func (r *memShares) RecipientByToken(ctx context.Context, tokenHash string) (*models.ShareRecipient, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, recipient := range r.shareRecipients {
+		if recipient.TokenHash == tokenHash {
+			found := *recipient
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memShares) RevokeRecipient(ctx context.Context, shareID string, recipientID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	recipient, ok := r.shareRecipients[recipientID]
+	if !ok || recipient.ShareID != shareID || recipient.RevokedAt != nil {
+		return ErrNotFound
+	}
+	now := r.now()
+	recipient.RevokedAt = &now
+	return nil
+}
+
+func (r *memShares) LogAccess(ctx context.Context, entry *models.ShareAccess) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextAccessID++
+	stored := *entry
+	stored.ID = r.nextAccessID
+	stored.CreatedAt = r.now()
+	r.shareAccess = append(r.shareAccess, stored)
+	entry.ID = stored.ID
+	if stored.Outcome == models.ShareAccessGranted && stored.RecipientID != nil {
+		if recipient, ok := r.shareRecipients[*stored.RecipientID]; ok {
+			recipient.LastAccessAt = &stored.CreatedAt
+		}
+	}
+	return nil
+}
+
+func (r *memShares) SetAccessOutcome(ctx context.Context, accessID int64, outcome models.ShareAccessOutcome) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.shareAccess {
+		entry := &r.shareAccess[i]
+		if entry.ID != accessID {
+			continue
+		}
+		entry.Outcome = outcome
+		if outcome == models.ShareAccessGranted && entry.RecipientID != nil {
+			if recipient, ok := r.shareRecipients[*entry.RecipientID]; ok {
+				now := r.now()
+				recipient.LastAccessAt = &now
+			}
+		}
+		return nil
+	}
+	return ErrNotFound
+}
+
+func (r *memShares) AccessLog(ctx context.Context, shareID string, limit int) ([]models.ShareAccess, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entries := []models.ShareAccess{}
+	for i := len(r.shareAccess) - 1; i >= 0 && (limit < 0 || len(entries) < limit); i-- {
+		if r.shareAccess[i].ShareID == shareID {
+			entries = append(entries, r.shareAccess[i])
+		}
+	}
+	return entries, nil
+}
+
+func (r *memShares) CountAccess(ctx context.Context, recipientID int64, outcome models.ShareAccessOutcome, since time.Time) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	count := 0
+	for _, entry := range r.shareAccess {
+		if entry.RecipientID != nil && *entry.RecipientID == recipientID &&
+			entry.Outcome == outcome && !entry.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ============================================================================
+// USUARIOS
+// ============================================================================
+
+type memUsers Memory
+
+func (r *memUsers) Create(ctx context.Context, user *models.User) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if u.Username == user.Username ||
+			(user.Email != "" && u.Email == user.Email) ||
+			(user.BiometricID != "" && u.BiometricID == user.BiometricID) {
+			return 0, ErrDuplicate
+		}
+	}
+	r.nextUserID++
+	stored := *user
+	stored.ID = r.nextUserID
+	stored.CreatedAt = r.now()
+	if stored.AuthType == "" {
+		stored.AuthType = "password"
+	}
+	if stored.Role == "" {
+		stored.Role = models.RoleUser
+	}
+	r.users[stored.ID] = &stored
+	return stored.ID, nil
+}
+
+func (r *memUsers) find(match func(*models.User) bool) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, u := range r.users {
+		if match(u) {
+			found := *u
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memUsers) ByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.Username == username })
+}
+
+func (r *memUsers) ByBiometricID(ctx context.Context, biometricID string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return biometricID != "" && u.BiometricID == biometricID })
+}
+
+func (r *memUsers) TouchLastLogin(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if u, ok := r.users[id]; ok {
+		now := r.now()
+		u.LastLogin = &now
+	}
+	return nil
+}
+
+// ============================================================================
+// SESIONES (refresh tokens por dispositivo)
+// ============================================================================
+
+type memSession struct {
+	session     models.UserSession
+	refreshHash string
+	usedHashes  map[string]bool // Refresh tokens ya rotados
+}
+
+type memSessions Memory
+
+func (r *memSessions) Create(ctx context.Context, session *models.UserSession, refreshHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sessions[session.ID]; ok {
+		return ErrDuplicate
+	}
+	stored := *session
+	stored.CreatedAt = r.now()
+	stored.LastUsedAt = stored.CreatedAt
+	stored.RevokedAt = nil
+	r.sessions[stored.ID] = &memSession{session: stored, refreshHash: refreshHash, usedHashes: make(map[string]bool)}
+	return nil
+}
+
+func (r *memSessions) active(s *memSession) bool {
+	return s.session.RevokedAt == nil && s.session.ExpiresAt.After(r.now())
+}
+
+func (r *memSessions) ByRefreshHash(ctx context.Context, hash string) (*RefreshSession, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, s := range r.sessions {
+		if s.refreshHash != hash {
+			continue
+		}
+		user, ok := r.users[s.session.UserID]
+		if !ok {
+			return nil, ErrNotFound
+		}
+		return &RefreshSession{
+			SessionID: s.session.ID,
+			UserID:    user.ID,
+			Username:  user.Username,
+			Role:      user.Role,
+			Active:    r.active(s) && user.DisabledAt == nil,
+		}, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memSessions) ByUsedHash(ctx context.Context, hash string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, s := range r.sessions {
+		if s.usedHashes[hash] {
+			return s.session.ID, nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+func (r *memSessions) Rotate(ctx context.Context, id, currentHash, newHash string, expiresAt time.Time, ipAddress string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[id]
+	if !ok || s.refreshHash != currentHash || s.session.RevokedAt != nil {
+		return ErrConflict
+	}
+	s.usedHashes[currentHash] = true
+	s.refreshHash = newHash
+	s.session.LastUsedAt = r.now()
+	s.session.ExpiresAt = expiresAt
+	s.session.IPAddress = nil
+	if ipAddress != "" {
+		s.session.IPAddress = &ipAddress
+	}
+	return nil
+}
+
+func (r *memSessions) IsActive(ctx context.Context, id string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.sessions[id]
+	return ok && r.active(s), nil
+}
+
+func (r *memSessions) ListActive(ctx context.Context, userID int64) ([]models.UserSession, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sessions := []models.UserSession{}
+	for _, s := range r.sessions {
+		if s.session.UserID == userID && r.active(s) {
+			sessions = append(sessions, s.session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+	return sessions, nil
+}
+
+func (r *memSessions) Revoke(ctx context.Context, id string, userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[id]
+	if !ok || s.session.RevokedAt != nil || (userID != 0 && s.session.UserID != userID) {
+		return ErrNotFound
+	}
+	now := r.now()
+	s.session.RevokedAt = &now
+	return nil
+}
+
+func (r *memSessions) RevokeAll(ctx context.Context, userID int64, exceptID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	var revoked int64
+	for id, s := range r.sessions {
+		if s.session.UserID != userID || s.session.RevokedAt != nil || (exceptID != "" && id == exceptID) {
+			continue
+		}
+		s.session.RevokedAt = &now
+		revoked++
+	}
+	return revoked, nil
+}
+
+// ============================================================================
+// PREFERENCIAS DE NOTIFICACIÓN
+// ============================================================================
+
+type memPreferences Memory
+
+func (r *memPreferences) Get(ctx context.Context, userID int64) (*models.NotificationPreferences, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	prefs, ok := r.prefs[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *prefs
+	return &found, nil
+}
+
+func (r *memPreferences) Upsert(ctx context.Context, userID int64, req models.NotificationPreferencesUpdateRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	prefs, ok := r.prefs[userID]
+	if !ok {
+		defaults := DefaultNotificationPreferences()
+		r.nextPrefsID++
+		defaults.ID = r.nextPrefsID
+		defaults.UserID = userID
+		defaults.CreatedAt = now
+		prefs = &defaults
+		r.prefs[userID] = prefs
+	}
+	applyPreferences(prefs, req)
+	prefs.UpdatedAt = now
+	return nil
+}
+
+// ============================================================================
+// SUSCRIPCIONES Y NOTIFICACIONES
+// ============================================================================
+
+type memSubscriptions Memory
+
+func (r *memSubscriptions) Create(ctx context.Context, sub *models.IncidentSubscription) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextSubscriptionID++
+	stored := *sub
+	stored.ID = r.nextSubscriptionID
+	stored.CreatedAt = r.now()
+	r.subscriptions = append(r.subscriptions, stored)
+	return stored.ID, nil
+}
+
+func (r *memSubscriptions) ListByUser(ctx context.Context, userID int64) ([]models.IncidentSubscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	subs := []models.IncidentSubscription{}
+	for _, sub := range r.subscriptions {
+		if sub.UserID == userID {
+			subs = append(subs, sub)
+		}
+	}
+	return subs, nil
+}
+
+func (r *memSubscriptions) Delete(ctx context.Context, id, userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, sub := range r.subscriptions {
+		if sub.ID == id && sub.UserID == userID {
+			r.subscriptions = append(r.subscriptions[:i], r.subscriptions[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memSubscriptions) Matching(ctx context.Context, incident *models.Incident) ([]models.IncidentSubscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	subs := []models.IncidentSubscription{}
+	for _, sub := range r.subscriptions {
+		var match bool
+		switch sub.Kind {
+		case models.SubscriptionRoute:
+			match = sameName(sub.RouteName, incident.RouteName)
+		case models.SubscriptionStop:
+			match = sameName(sub.StopName, incident.StopName)
+		case models.SubscriptionArea:
+			match = sub.Latitude != nil && sub.Longitude != nil && sub.RadiusM != nil &&
+				distanceMeters(*sub.Latitude, *sub.Longitude, incident.Latitude, incident.Longitude) <= *sub.RadiusM
+		}
+		if match {
+			subs = append(subs, sub)
+		}
+	}
+	sort.SliceStable(subs, func(i, j int) bool { return subs[i].UserID < subs[j].UserID })
+	return subs, nil
+}
+
+// sameName compara nombres de ruta/paradero como lo hace la collation de MariaDB
+func sameName(a, b *string) bool {
+	return a != nil && b != nil && *b != "" && strings.EqualFold(*a, *b)
+}
+
+// distanceMeters calcula la distancia Haversine en metros
+func distanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371000.0
+	dLat := (lat2 - lat1) * math.Pi / 180.0
+	dLon := (lon2 - lon1) * math.Pi / 180.0
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180.0)*math.Cos(lat2*math.Pi/180.0)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return earthRadius * 2 * math.Asin(math.Sqrt(a))
+}
+
+type memNotifications Memory
+
+func (r *memNotifications) Create(ctx context.Context, notification *models.Notification) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextNotificationID++
+	stored := *notification
+	stored.ID = r.nextNotificationID
+	stored.CreatedAt = r.now()
+	r.notifications = append(r.notifications, stored)
+	return stored.ID, nil
+}
+
+func (r *memNotifications) ListByUser(ctx context.Context, userID int64, unreadOnly bool, limit int) ([]models.Notification, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	notifications := []models.Notification{}
+	for i := len(r.notifications) - 1; i >= 0 && len(notifications) < limit; i-- {
+		n := r.notifications[i]
+		if n.UserID != userID || (unreadOnly && n.ReadAt != nil) {
+			continue
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, nil
+}
+
+func (r *memNotifications) UnreadCount(ctx context.Context, userID int64) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	count := 0
+	for _, n := range r.notifications {
+		if n.UserID == userID && n.ReadAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memNotifications) MarkRead(ctx context.Context, userID int64, ids []int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	wanted := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	now := r.now()
+	var marked int64
+	for i := range r.notifications {
+		n := &r.notifications[i]
+		if n.UserID != userID || n.ReadAt != nil || (len(ids) > 0 && !wanted[n.ID]) {
+			continue
+		}
+		readAt := now
+		n.ReadAt = &readAt
+		marked++
+	}
+	return marked, nil
+}
+
+// ============================================================================
+// CONTRIBUCIONES
+// ============================================================================
+
+type memContributions Memory
+
+func (r *memContributions) Create(ctx context.Context, contribution *models.Contribution) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextContributionID++
+	stored := *contribution
+	stored.ID = r.nextContributionID
+	stored.Status = models.ContributionPending
+	stored.CreatedAt = r.now()
+	stored.UpdatedAt = stored.CreatedAt
+	r.contributions[stored.ID] = &stored
+	return stored.ID, nil
+}
+
+func (r *memContributions) Get(ctx context.Context, id int64) (*models.Contribution, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	contribution, ok := r.contributions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *contribution
+	return &found, nil
+}
+
+func (r *memContributions) List(ctx context.Context, filter ContributionFilter) ([]models.Contribution, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	matched := []models.Contribution{}
+	for _, c := range r.contributions {
+		if len(filter.Statuses) > 0 && !hasStatus(c.Status, filter.Statuses) {
+			continue
+		}
+		if filter.UserID != nil && (c.UserID == nil || *c.UserID != *filter.UserID) {
+			continue
+		}
+		if filter.Type != "" && c.Type != filter.Type {
+			continue
+		}
+		if filter.BusRoute != "" && (c.BusRoute == nil || *c.BusRoute != filter.BusRoute) {
+			continue
+		}
+		matched = append(matched, *c)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if filter.OldestFirst {
+			return matched[i].ID < matched[j].ID
+		}
+		return matched[i].ID > matched[j].ID
+	})
+
+	if filter.Offset >= len(matched) {
+		return []models.Contribution{}, nil
+	}
+	matched = matched[filter.Offset:]
+	if len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched, nil
+}
+
+// ownPending retorna la contribución pendiente del usuario (el llamador tiene el lock)
+func (r *memContributions) ownPending(id, userID int64) (*models.Contribution, error) {
+	contribution, ok := r.contributions[id]
+	if !ok || contribution.UserID == nil || *contribution.UserID != userID {
+		return nil, ErrNotFound
+	}
+	if contribution.Status != models.ContributionPending {
+		return nil, ErrConflict
+	}
+	return contribution, nil
+}
+
+func (r *memContributions) Update(ctx context.Context, id, userID int64, req models.ContributionUpdateRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	contribution, err := r.ownPending(id, userID)
+	if err != nil {
+		return err
+	}
+	contribution.Apply(req)
+	contribution.UpdatedAt = r.now()
+	return nil
+}
+
+func (r *memContributions) Delete(ctx context.Context, id, userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.ownPending(id, userID); err != nil {
+		return err
+	}
+	delete(r.contributions, id)
+	return nil
+}
+
+func (r *memContributions) Moderate(ctx context.Context, id int64, decision ContributionDecision) (*models.Contribution, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	contribution, ok := r.contributions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if !hasStatus(contribution.Status, decision.From) {
+		return nil, ErrConflict
+	}
+
+	now := r.now()
+	if decision.Incident != nil {
+		incidentID := (*Memory)(r).insertIncident(decision.Incident)
+		contribution.IncidentID = &incidentID
+	}
+	if decision.To == models.ContributionResolved && contribution.IncidentID != nil {
+		if incident, ok := r.incidents[*contribution.IncidentID]; ok && isLive(incident, now) {
+			incident.Status = models.IncidentStatusResolved
+			incident.ResolvedAt = &now
+			incident.UpdatedAt = now
+		}
+	}
+
+	contribution.Status = decision.To
+	contribution.ModeratorNote = nil
+	if decision.Note != "" {
+		note := decision.Note
+		contribution.ModeratorNote = &note
+	}
+	moderator := decision.Moderator
+	contribution.ModeratedBy = &moderator
+	contribution.ModeratedAt = &now
+	contribution.UpdatedAt = now
+
+	moderated := *contribution
+	return &moderated, nil
+}
+
+// ============================================================================
+// EVENTOS DE DEBUG DE LA APP
+// ============================================================================
+
+type memDebugEvents Memory
+
+// paginate aplica OFFSET/LIMIT a un resultado ya ordenado
+func paginate[T any](items []T, offset, limit int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+	items = items[offset:]
+	if limit >= 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
+
+func (r *memDebugEvents) Create(ctx context.Context, event *models.DebugEvent) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextDebugEventID++
+	stored := *event
+	stored.ID = r.nextDebugEventID
+	stored.CreatedAt = r.now()
+	r.debugEvents = append(r.debugEvents, stored)
+	return stored.ID, nil
+}
+
+// matchesDebugEvent replica el WHERE de mariaDebugEvents
+func matchesDebugEvent(e models.DebugEvent, filter DebugEventFilter) bool {
+	if len(filter.Kinds) > 0 {
+		found := false
+		for _, kind := range filter.Kinds {
+			found = found || e.Kind == kind
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(filter.Levels) > 0 {
+		found := false
+		for _, level := range filter.Levels {
+			found = found || e.Level == level
+		}
+		if !found {
+			return false
+		}
+	}
+	if filter.DeviceID != "" && e.DeviceID != filter.DeviceID {
+		return false
+	}
+	if filter.SessionID != "" && e.SessionID != filter.SessionID {
+		return false
+	}
+	if filter.UserID != nil && (e.UserID == nil || *e.UserID != *filter.UserID) {
+		return false
+	}
+	if filter.Fingerprint != "" && e.Fingerprint != filter.Fingerprint {
+		return false
+	}
+	if filter.Query != "" {
+		query := strings.ToLower(filter.Query)
+		if !strings.Contains(strings.ToLower(e.Message), query) && !strings.Contains(strings.ToLower(e.StackTrace), query) {
+			return false
+		}
+	}
+	if filter.Since != nil && e.OccurredAt.Before(*filter.Since) {
+		return false
+	}
+	if filter.Until != nil && !e.OccurredAt.Before(*filter.Until) {
+		return false
+	}
+	return true
+}
+
+func (r *memDebugEvents) List(ctx context.Context, filter DebugEventFilter) ([]models.DebugEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	events := []models.DebugEvent{}
+	for _, e := range r.debugEvents {
+		if matchesDebugEvent(e, filter) {
+			events = append(events, e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if !a.OccurredAt.Equal(b.OccurredAt) {
+			return a.OccurredAt.Before(b.OccurredAt) == filter.OldestFirst
+		}
+		return (a.ID < b.ID) == filter.OldestFirst
+	})
+	return paginate(events, filter.Offset, filter.Limit), nil
+}
+
+func (r *memDebugEvents) Issues(ctx context.Context, filter DebugEventFilter, byCount bool) ([]models.DebugIssue, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	filter.Kinds = []models.DebugEventKind{models.DebugEventError}
+
+	groups := make(map[string]*models.DebugIssue)
+	devices := make(map[string]map[string]bool)
+	sessions := make(map[string]map[string]bool)
+	for _, e := range r.debugEvents {
+		if e.Fingerprint == "" || !matchesDebugEvent(e, filter) {
+			continue
+		}
+		issue, ok := groups[e.Fingerprint]
+		if !ok {
+			issue = &models.DebugIssue{Fingerprint: e.Fingerprint, FirstSeen: e.OccurredAt, LastSeen: e.OccurredAt}
+			groups[e.Fingerprint] = issue
+			devices[e.Fingerprint] = make(map[string]bool)
+			sessions[e.Fingerprint] = make(map[string]bool)
+		}
+		issue.Count++
+		if e.DeviceID != "" {
+			devices[e.Fingerprint][e.DeviceID] = true
+		}
+		if e.SessionID != "" {
+			sessions[e.Fingerprint][e.SessionID] = true
+		}
+		if e.OccurredAt.Before(issue.FirstSeen) {
+			issue.FirstSeen = e.OccurredAt
+		}
+		if e.OccurredAt.After(issue.LastSeen) {
+			issue.LastSeen = e.OccurredAt
+		}
+		if e.ID > issue.LastEventID {
+			issue.LastEventID = e.ID
+			issue.ErrorType = e.EventType
+			issue.Message = e.Message
+			issue.StackTrace = e.StackTrace
+		}
+	}
+
+	issues := make([]models.DebugIssue, 0, len(groups))
+	for fingerprint, issue := range groups {
+		issue.Devices = len(devices[fingerprint])
+		issue.Sessions = len(sessions[fingerprint])
+		issues = append(issues, *issue)
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		a, b := issues[i], issues[j]
+		if byCount && a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.LastSeen.After(b.LastSeen)
+	})
+	return paginate(issues, filter.Offset, filter.Limit), nil
+}
+
+func (r *memDebugEvents) Prune(ctx context.Context, before time.Time, max int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := r.debugEvents[:0]
+	for _, e := range r.debugEvents {
+		if before.IsZero() || !e.CreatedAt.Before(before) {
+			kept = append(kept, e)
+		}
+	}
+	if max > 0 && len(kept) > max {
+		kept = kept[len(kept)-max:]
+	}
+	deleted := int64(len(r.debugEvents) - len(kept))
+	r.debugEvents = append([]models.DebugEvent(nil), kept...)
+	return deleted, nil
+}
+
+// ============================================================================
+// OBSERVACIONES DE LLEGADAS
+// ============================================================================
+
+type memArrivals Memory
+
+func (r *memArrivals) Record(ctx context.Context, observations []models.ArrivalObservation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, o := range observations {
+		r.nextArrivalID++
+		o.ID = r.nextArrivalID
+		r.arrivals = append(r.arrivals, o)
+	}
+	return nil
+}
+
+func (r *memArrivals) List(ctx context.Context, filter ArrivalObservationFilter) ([]models.ArrivalObservation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	observations := []models.ArrivalObservation{}
+	for _, o := range r.arrivals {
+		if o.ObservedAt.Before(filter.Since) ||
+			(filter.StopCode != "" && o.StopCode != filter.StopCode) ||
+			(filter.Route != "" && o.Route != filter.Route) {
+			continue
+		}
+		observations = append(observations, o)
+	}
+	sort.SliceStable(observations, func(i, j int) bool {
+		a, b := observations[i], observations[j]
+		if a.StopCode != b.StopCode {
+			return a.StopCode < b.StopCode
+		}
+		if a.Route != b.Route {
+			return a.Route < b.Route
+		}
+		if !a.ObservedAt.Equal(b.ObservedAt) {
+			return a.ObservedAt.Before(b.ObservedAt)
+		}
+		return a.ID < b.ID
+	})
+	if filter.Limit > 0 && len(observations) > filter.Limit {
+		observations = observations[:filter.Limit]
+	}
+	return observations, nil
+}
+
+func (r *memArrivals) Prune(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := r.arrivals[:0]
+	for _, o := range r.arrivals {
+		if !o.ObservedAt.Before(before) {
+			kept = append(kept, o)
+		}
+	}
+	deleted := int64(len(r.arrivals) - len(kept))
+	r.arrivals = append([]models.ArrivalObservation(nil), kept...)
+	return deleted, nil
+}
@@ -0,0 +1,471 @@
+// ============================================================================
+// Repositories - WayFindCL
+// ============================================================================
+// Acceso a datos por agregado (paradas, rutas, incidentes, viajes, shares,
+// usuarios, sesiones, preferencias). Los handlers dependen sólo de estas interfaces:
+//   - NewMariaDB: implementación de producción sobre *sql.DB
+//   - NewMemory:  implementación embebida en memoria para tests end-to-end
+//                 sin servidor de base de datos
+// ============================================================================
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/yourorg/wayfindcl/internal/models"
+)
+
+var (
+	// ErrNotFound indica que el registro no existe (o no es visible para el usuario)
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate indica que se violó una clave única (ej: username ya registrado)
+	ErrDuplicate = errors.New("duplicate entry")
+	// ErrInactive indica que el incidente ya fue resuelto o expiró
+	ErrInactive = errors.New("incident not active")
+	// ErrConflict indica que el estado actual del registro no permite la operación
+	// (ej: rotar un refresh token que otra petición ya rotó)
+	ErrConflict = errors.New("state conflict")
+)
+
+// BoundingBox delimita una búsqueda espacial en grados
+type BoundingBox struct {
+	MinLat, MaxLat float64
+	MinLon, MaxLon float64
+}
+
+// Contains indica si la coordenada está dentro de la caja
+func (b BoundingBox) Contains(lat, lon float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lon >= b.MinLon && lon <= b.MaxLon
+}
+
+// StopRepository consulta las paradas GTFS activas
+type StopRepository interface {
+	// InBoundingBox retorna las paradas dentro de la caja (sin ordenar)
+	InBoundingBox(ctx context.Context, box BoundingBox) ([]models.Stop, error)
+	// ByCode busca por stop_id o código de paradero, sin distinguir mayúsculas
+	ByCode(ctx context.Context, code string) (*models.Stop, error)
+}
+
+// RouteRepository consulta la geometría y paradas de las rutas GTFS
+type RouteRepository interface {
+	// Shape retorna los puntos [lon, lat] del primer shape de la ruta (short_name)
+	Shape(ctx context.Context, routeShortName string) (string, [][]float64, error)
+	// CountStopsBetween cuenta las paradas de un viaje de la ruta entre dos
+	// paraderos, ambos inclusive. ErrNotFound si ningún viaje pasa por ambos.
+	CountStopsBetween(ctx context.Context, routeShortName, fromStopCode, toStopCode string) (int, error)
+}
+
+// IncidentFilter restringe IncidentRepository.List
+type IncidentFilter struct {
+	Box       *BoundingBox
+	RouteName string
+	Within    time.Duration // Sólo incidentes creados en esta ventana (0 = todos)
+	Limit     int
+	// IncludeHidden incluye los incidentes ocultados por votos negativos
+	IncludeHidden bool
+	// IncludeInactive incluye los resueltos y expirados (por defecto sólo los
+	// vigentes: activos u ocultos con expires_at en el futuro)
+	IncludeInactive bool
+}
+
+// ConfirmationResult es el estado del incidente tras una confirmación
+type ConfirmationResult struct {
+	Incident   *models.Incident `json:"incident"`
+	StillThere int              `json:"still_there"` // Votantes que dicen que sigue ahí
+	Gone       int              `json:"gone"`        // Votantes que dicen que ya no está
+}
+
+// DeviceVoterPrefix marca en voter_key los votos anónimos (por dispositivo)
+const DeviceVoterPrefix = "device:"
+
+// ModerationThresholds define cuándo un incidente se verifica u oculta solo
+type ModerationThresholds struct {
+	Verify float64 // weighted_score >= Verify marca el incidente como verificado
+	Hide   float64 // weighted_score <= -Hide lo oculta de los listados
+	// MaxDeviceScore acota (en valor absoluto) lo que los votos anónimos
+	// aportan al puntaje que decide la moderación: su device_id lo elige el
+	// cliente. 0 = no cuentan.
+	MaxDeviceScore float64
+}
+
+// moderate recalcula is_verified/is_hidden según el puntaje ponderado, con el
+// aporte de los votos anónimos (deviceScore) acotado, y retorna las acciones
+// que cambiaron (para la auditoría)
+func (t ModerationThresholds) moderate(incident *models.Incident, deviceScore float64) []string {
+	score := incident.WeightedScore - deviceScore + math.Max(-t.MaxDeviceScore, math.Min(deviceScore, t.MaxDeviceScore))
+
+	var actions []string
+	verified := t.Verify > 0 && score >= t.Verify
+	if verified != incident.IsVerified {
+		incident.IsVerified = verified
+		if verified {
+			actions = append(actions, models.ModerationVerified)
+		} else {
+			actions = append(actions, models.ModerationUnverified)
+		}
+	}
+	hidden := t.Hide > 0 && score <= -t.Hide
+	if hidden != incident.IsHidden {
+		incident.IsHidden = hidden
+		if hidden {
+			actions = append(actions, models.ModerationHidden)
+		} else {
+			actions = append(actions, models.ModerationUnhidden)
+		}
+		// Los resueltos y expirados conservan su estado
+		if hidden && incident.Status == models.IncidentStatusActive {
+			incident.Status = models.IncidentStatusHidden
+		} else if !hidden && incident.Status == models.IncidentStatusHidden {
+			incident.Status = models.IncidentStatusActive
+		}
+	}
+	return actions
+}
+
+// isLive indica si el incidente sigue vigente (activo u oculto, sin vencer)
+func isLive(incident *models.Incident, now time.Time) bool {
+	return (incident.Status == models.IncidentStatusActive || incident.Status == models.IncidentStatusHidden) &&
+		incident.ExpiresAt.After(now)
+}
+
+// shouldResolve aplica la regla de cierre: al menos resolveAfter votantes
+// dicen que ya no está y son más que los que dicen que sigue ahí
+func shouldResolve(stillThere, gone, resolveAfter int) bool {
+	return gone >= resolveAfter && gone > stillThere
+}
+
+// applyVote suma el voto al incidente, descontando el voto previo del mismo
+// votante si lo había (previous == nil para el primer voto)
+func applyVote(incident *models.Incident, previous *models.IncidentVote, vote models.IncidentVote) {
+	if previous != nil {
+		if previous.Vote > 0 {
+			incident.Upvotes--
+		} else {
+			incident.Downvotes--
+		}
+		incident.WeightedScore -= float64(previous.Vote) * previous.Weight
+	}
+	if vote.Vote > 0 {
+		incident.Upvotes++
+	} else {
+		incident.Downvotes++
+	}
+	incident.WeightedScore += float64(vote.Vote) * vote.Weight
+}
+
+// IncidentRepository persiste los incidentes reportados por usuarios
+type IncidentRepository interface {
+	Create(ctx context.Context, incident *models.Incident) (int64, error)
+	Get(ctx context.Context, id int64) (*models.Incident, error)
+	// List retorna los incidentes del filtro, más recientes primero
+	List(ctx context.Context, filter IncidentFilter) ([]models.Incident, error)
+	// CastVote registra el voto (uno por votante; puede cambiar de sentido pero
+	// no repetirse: ErrDuplicate) y aplica los umbrales de moderación. Retorna
+	// el incidente actualizado y los cambios de estado registrados en la auditoría.
+	CastVote(ctx context.Context, vote models.IncidentVote, thresholds ModerationThresholds) (*models.Incident, []models.IncidentModerationEntry, error)
+	// ModerationLog retorna la auditoría del incidente, más antigua primero
+	ModerationLog(ctx context.Context, incidentID int64) ([]models.IncidentModerationEntry, error)
+	// Confirm registra si el incidente sigue ahí (uno por votante; puede cambiar
+	// pero no repetirse: ErrDuplicate). "Sigue ahí" extiende expires_at por el TTL
+	// del tipo; "ya no está" lo resuelve según shouldResolve. ErrInactive si ya
+	// fue resuelto o expiró.
+	Confirm(ctx context.Context, confirmation models.IncidentConfirmation, resolveAfter int) (*ConfirmationResult, error)
+	// ExpireDue marca como expirados los incidentes vigentes cuyo expires_at pasó
+	ExpireDue(ctx context.Context) (int64, error)
+	// Reputation cuenta cómo fueron votados los reportes del usuario
+	// (Score y VoteWeight los calcula quien consume)
+	Reputation(ctx context.Context, reporterID string) (*models.ReporterReputation, error)
+	Stats(ctx context.Context) (*models.IncidentStats, error)
+}
+
+// TripRepository persiste el historial de viajes de cada usuario
+type TripRepository interface {
+	Create(ctx context.Context, trip *models.TripHistory) (int64, error)
+	// ListByUser retorna los viajes, más recientes primero
+	ListByUser(ctx context.Context, userID int64, limit, offset int) ([]models.TripHistory, error)
+	// FrequentLocations agrupa los viajes por destino, más visitados primero
+	FrequentLocations(ctx context.Context, userID int64, limit int) ([]models.FrequentLocation, error)
+	// Statistics calcula totales, destino más visitado y hora favorita
+	Statistics(ctx context.Context, userID int64) (*models.TripStatistics, error)
+	// DestinationsAt agrupa los viajes iniciados entre fromHour y toHour (inclusive)
+	// del día de la semana indicado, más frecuentes primero
+	DestinationsAt(ctx context.Context, userID int64, fromHour, toHour int, weekday time.Weekday, limit int) ([]models.FrequentLocation, error)
+}
+
+// ShareRepository persiste las ubicaciones compartidas
+type ShareRepository interface {
+	Create(ctx context.Context, share *models.LocationShare) error
+	// GetActive retorna el share si sigue activo y no expiró
+	GetActive(ctx context.Context, id string) (*models.LocationShare, error)
+	// GetForUser retorna un share del usuario, activo o no
+	GetForUser(ctx context.Context, id string, userID int64) (*models.LocationShare, error)
+	// UpdatePosition mueve un share activo del usuario (reemplaza rumbo,
+	// velocidad y viaje activo) y retorna el share actualizado
+	UpdatePosition(ctx context.Context, id string, userID int64, pos models.SharePosition) (*models.LocationShare, error)
+	// Stop desactiva un share del usuario
+	Stop(ctx context.Context, id string, userID int64) error
+	ListByUser(ctx context.Context, userID int64, limit int) ([]models.LocationShare, error)
+	// AddPoint agrega un punto al recorrido del share y conserva sólo los
+	// keep más recientes
+	AddPoint(ctx context.Context, id string, point models.SharePoint, keep int) error
+	// Trail retorna los últimos limit puntos del recorrido, más antiguos primero
+	Trail(ctx context.Context, id string, limit int) ([]models.SharePoint, error)
+	AddAlert(ctx context.Context, alert *models.ShareAlert) (int64, error)
+	// Alerts retorna las alertas del share, más antiguas primero
+	Alerts(ctx context.Context, id string) ([]models.ShareAlert, error)
+
+	AddRecipient(ctx context.Context, recipient *models.ShareRecipient) (int64, error)
+	// Recipients retorna los receptores del share (incluye revocados), en orden de creación
+	Recipients(ctx context.Context, shareID string) ([]models.ShareRecipient, error)
+	RecipientByToken(ctx context.Context, tokenHash string) (*models.ShareRecipient, error)
+	// RevokeRecipient revoca un receptor; ErrNotFound si no existe o ya estaba revocado
+	RevokeRecipient(ctx context.Context, shareID string, recipientID int64) error
+	// LogAccess registra un intento de ver el share y asigna entry.ID; si fue
+	// concedido actualiza también last_access_at del receptor
+	LogAccess(ctx context.Context, entry *models.ShareAccess) error
+	// SetAccessOutcome cambia el resultado de un acceso ya registrado (ej. un
+	// intento de PIN anotado como fallido antes de compararlo), con el mismo
+	// efecto sobre last_access_at que LogAccess; ErrNotFound si no existe
+	SetAccessOutcome(ctx context.Context, accessID int64, outcome models.ShareAccessOutcome) error
+	// AccessLog retorna los accesos del share, más recientes primero
+	AccessLog(ctx context.Context, shareID string, limit int) ([]models.ShareAccess, error)
+	// CountAccess cuenta los accesos de un receptor con ese resultado desde since
+	CountAccess(ctx context.Context, recipientID int64, outcome models.ShareAccessOutcome, since time.Time) (int, error)
+}
+
+// UserRepository persiste las cuentas (password y biométricas).
+// Las sesiones de cada dispositivo van en SessionRepository.
+type UserRepository interface {
+	// Create inserta el usuario; ErrDuplicate si username, email o biometric_id ya existen
+	Create(ctx context.Context, user *models.User) (int64, error)
+	ByUsername(ctx context.Context, username string) (*models.User, error)
+	ByBiometricID(ctx context.Context, biometricID string) (*models.User, error)
+	TouchLastLogin(ctx context.Context, id int64) error
+}
+
+// RefreshSession es la sesión dueña de un refresh token, con los datos del
+// usuario para emitir el nuevo access token
+type RefreshSession struct {
+	SessionID string
+	UserID    int64
+	Username  string
+	Role      models.Role
+	// Active es falso si la sesión fue revocada o venció, o el usuario está deshabilitado
+	Active bool
+}
+
+// SessionRepository persiste las sesiones por dispositivo y sus refresh tokens
+// rotativos (sólo se guarda el hash SHA-256 de cada token)
+type SessionRepository interface {
+	// Create inserta la sesión (ID, usuario, dispositivo y expiración los pone el llamador)
+	Create(ctx context.Context, session *models.UserSession, refreshHash string) error
+	// ByRefreshHash busca la sesión cuyo refresh token vigente es hash; ErrNotFound si ninguna
+	ByRefreshHash(ctx context.Context, hash string) (*RefreshSession, error)
+	// ByUsedHash retorna la sesión que ya usó y rotó el refresh token hash
+	// (cualquiera de sus tokens anteriores, no sólo el último); ErrNotFound si ninguna
+	ByUsedHash(ctx context.Context, hash string) (string, error)
+	// Rotate reemplaza el refresh token sólo si sigue siendo currentHash y la
+	// sesión no fue revocada (de dos rotaciones concurrentes gana una, la otra
+	// recibe ErrConflict), y deja currentHash entre los usados de la sesión
+	Rotate(ctx context.Context, id, currentHash, newHash string, expiresAt time.Time, ipAddress string) error
+	// IsActive indica si la sesión existe, no fue revocada y no venció
+	IsActive(ctx context.Context, id string) (bool, error)
+	// ListActive retorna las sesiones vigentes del usuario, usadas más recientemente primero
+	ListActive(ctx context.Context, userID int64) ([]models.UserSession, error)
+	// Revoke revoca una sesión vigente (con userID != 0, sólo si es suya);
+	// ErrNotFound si no había una
+	Revoke(ctx context.Context, id string, userID int64) error
+	// RevokeAll revoca las sesiones del usuario salvo exceptID ("" = todas) y retorna cuántas
+	RevokeAll(ctx context.Context, userID int64, exceptID string) (int64, error)
+}
+
+// PreferencesRepository persiste las preferencias de notificación
+type PreferencesRepository interface {
+	// Get retorna ErrNotFound si el usuario nunca guardó preferencias
+	Get(ctx context.Context, userID int64) (*models.NotificationPreferences, error)
+	// Upsert aplica los campos presentes; los ausentes toman el valor por defecto
+	// si la fila aún no existe
+	Upsert(ctx context.Context, userID int64, req models.NotificationPreferencesUpdateRequest) error
+}
+
+// SubscriptionRepository persiste las suscripciones a incidentes
+type SubscriptionRepository interface {
+	Create(ctx context.Context, sub *models.IncidentSubscription) (int64, error)
+	// ListByUser retorna las suscripciones del usuario, más antiguas primero
+	ListByUser(ctx context.Context, userID int64) ([]models.IncidentSubscription, error)
+	// Delete elimina una suscripción del usuario
+	Delete(ctx context.Context, id, userID int64) error
+	// Matching retorna las suscripciones que cubren el incidente: misma ruta,
+	// mismo paradero (sin distinguir mayúsculas) o zona que contiene su ubicación
+	Matching(ctx context.Context, incident *models.Incident) ([]models.IncidentSubscription, error)
+}
+
+// NotificationRepository es la bandeja in-app de notificaciones
+type NotificationRepository interface {
+	Create(ctx context.Context, notification *models.Notification) (int64, error)
+	// ListByUser retorna las notificaciones, más recientes primero
+	ListByUser(ctx context.Context, userID int64, unreadOnly bool, limit int) ([]models.Notification, error)
+	UnreadCount(ctx context.Context, userID int64) (int, error)
+	// MarkRead marca como leídas las notificaciones indicadas (todas si ids está vacío)
+	MarkRead(ctx context.Context, userID int64, ids []int64) (int64, error)
+}
+
+// ContributionFilter restringe ContributionRepository.List
+type ContributionFilter struct {
+	Statuses    []models.ContributionStatus // Vacío = todos
+	UserID      *int64
+	Type        models.ContributionType
+	BusRoute    string
+	OldestFirst bool // Cola de moderación (por defecto más recientes primero)
+	Limit       int
+	Offset      int
+}
+
+// ContributionDecision es una decisión de moderación
+type ContributionDecision struct {
+	From      []models.ContributionStatus // Estados desde los que se permite
+	To        models.ContributionStatus
+	Note      string
+	Moderator string
+	// Incident se crea en la misma transacción y queda enlazado (al aprobar)
+	Incident *models.Incident
+}
+
+// ContributionRepository persiste los reportes y sugerencias de la comunidad
+type ContributionRepository interface {
+	Create(ctx context.Context, contribution *models.Contribution) (int64, error)
+	Get(ctx context.Context, id int64) (*models.Contribution, error)
+	List(ctx context.Context, filter ContributionFilter) ([]models.Contribution, error)
+	// Update aplica los campos presentes a una contribución pendiente del
+	// usuario: ErrNotFound si no es suya, ErrConflict si ya fue moderada
+	Update(ctx context.Context, id, userID int64, req models.ContributionUpdateRequest) error
+	// Delete elimina una contribución pendiente del usuario (mismos errores que Update)
+	Delete(ctx context.Context, id, userID int64) error
+	// Moderate aplica la decisión (ErrConflict si el estado actual no está en
+	// From). Al resolver, el incidente enlazado también se marca como resuelto.
+	Moderate(ctx context.Context, id int64, decision ContributionDecision) (*models.Contribution, error)
+}
+
+// hasStatus indica si status está en allowed
+func hasStatus(status models.ContributionStatus, allowed []models.ContributionStatus) bool {
+	for _, s := range allowed {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// DebugEventFilter restringe DebugEventRepository.List e Issues
+type DebugEventFilter struct {
+	Kinds       []models.DebugEventKind // Vacío = todos
+	Levels      []string
+	DeviceID    string
+	SessionID   string
+	UserID      *int64
+	Fingerprint string
+	Query       string // Texto contenido en el mensaje o el stack trace
+	Since       *time.Time
+	Until       *time.Time
+	OldestFirst bool // Línea de tiempo (por defecto más recientes primero)
+	Limit       int
+	Offset      int
+}
+
+// DebugEventRepository guarda los logs, errores y eventos de navegación de la app
+type DebugEventRepository interface {
+	Create(ctx context.Context, event *models.DebugEvent) (int64, error)
+	// List ordena por occurred_at (y luego id)
+	List(ctx context.Context, filter DebugEventFilter) ([]models.DebugEvent, error)
+	// Issues agrupa los errores que pasan el filtro por fingerprint, los vistos
+	// más recientemente primero (o los más frecuentes con byCount)
+	Issues(ctx context.Context, filter DebugEventFilter, byCount bool) ([]models.DebugIssue, error)
+	// Prune borra los eventos recibidos antes de before (cero = sin límite de
+	// edad) y, si aún quedan más de max (0 = sin límite), los más antiguos.
+	// Retorna cuántos borró.
+	Prune(ctx context.Context, before time.Time, max int) (int64, error)
+}
+
+// ArrivalObservationFilter acota ArrivalObservationRepository.List
+type ArrivalObservationFilter struct {
+	StopCode string // Vacío = todos los paraderos
+	Route    string // Vacío = todas las rutas
+	Since    time.Time
+	Limit    int // 0 = sin límite
+}
+
+// ArrivalObservationRepository guarda la serie de tiempo de llegadas de Red.cl
+type ArrivalObservationRepository interface {
+	Record(ctx context.Context, observations []models.ArrivalObservation) error
+	// List ordena por paradero, ruta y observed_at (y luego id)
+	List(ctx context.Context, filter ArrivalObservationFilter) ([]models.ArrivalObservation, error)
+	// Prune borra las observaciones anteriores a before y retorna cuántas borró
+	Prune(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Store agrupa los repositorios que usan los handlers
+type Store struct {
+	Stops         StopRepository
+	Routes        RouteRepository
+	Incidents     IncidentRepository
+	Trips         TripRepository
+	Shares        ShareRepository
+	Users         UserRepository
+	Sessions      SessionRepository
+	Preferences   PreferencesRepository
+	Subscriptions SubscriptionRepository
+	Notifications NotificationRepository
+	Contributions ContributionRepository
+	DebugEvents   DebugEventRepository
+	Arrivals      ArrivalObservationRepository
+}
+
+// DefaultNotificationPreferences son las preferencias de un usuario que nunca las configuró
+func DefaultNotificationPreferences() models.NotificationPreferences {
+	return models.NotificationPreferences{
+		ApproachingDistance: 300,
+		NearDistance:        100,
+		VeryNearDistance:    30,
+		EnableAudio:         true,
+		EnableVibration:     true,
+		EnableVisual:        true,
+		AudioVolume:         0.8,
+		VibrationIntensity:  0.7,
+		MinimumPriority:     "medium",
+	}
+}
+
+// applyPreferences copia a prefs los campos presentes en req
+func applyPreferences(prefs *models.NotificationPreferences, req models.NotificationPreferencesUpdateRequest) {
+	if req.ApproachingDistance != nil {
+		prefs.ApproachingDistance = *req.ApproachingDistance
+	}
+	if req.NearDistance != nil {
+		prefs.NearDistance = *req.NearDistance
+	}
+	if req.VeryNearDistance != nil {
+		prefs.VeryNearDistance = *req.VeryNearDistance
+	}
+	if req.EnableAudio != nil {
+		prefs.EnableAudio = *req.EnableAudio
+	}
+	if req.EnableVibration != nil {
+		prefs.EnableVibration = *req.EnableVibration
+	}
+	if req.EnableVisual != nil {
+		prefs.EnableVisual = *req.EnableVisual
+	}
+	if req.AudioVolume != nil {
+		prefs.AudioVolume = *req.AudioVolume
+	}
+	if req.VibrationIntensity != nil {
+		prefs.VibrationIntensity = *req.VibrationIntensity
+	}
+	if req.MinimumPriority != nil {
+		prefs.MinimumPriority = *req.MinimumPriority
+	}
+}
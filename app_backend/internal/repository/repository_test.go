@@ -0,0 +1,467 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/yourorg/wayfindcl/internal/db"
+	"github.com/yourorg/wayfindcl/internal/models"
+)
+
+// testDSNEnv apunta a una base MariaDB desechable (con parseTime=true). Sin
+// ella los casos corren sólo contra la implementación en memoria.
+const testDSNEnv = "WAYFINDCL_TEST_DSN"
+
+// forEachStore corre los mismos casos contra cada implementación del Store,
+// para que la de memoria no se aparte del contrato que cumple MariaDB
+func forEachStore(t *testing.T, run func(t *testing.T, store *Store)) {
+	t.Run("memory", func(t *testing.T) {
+		run(t, &NewMemory().Store)
+	})
+	t.Run("mariadb", func(t *testing.T) {
+		dsn := os.Getenv(testDSNEnv)
+		if dsn == "" {
+			t.Skipf("%s no definido", testDSNEnv)
+		}
+		conn, err := sql.Open("mysql", dsn)
+		if err != nil {
+			t.Fatalf("abrir %s: %v", testDSNEnv, err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		if _, err := db.MigrateUp(context.Background(), conn); err != nil {
+			t.Fatalf("migrar: %v", err)
+		}
+		run(t, NewMariaDB(conn))
+	})
+}
+
+// uniqueName evita choques con filas de corridas anteriores en MariaDB
+func uniqueName(prefix string) string {
+	return fmt.Sprintf("%s_%d", prefix, time.Now().UnixNano())
+}
+
+func createTestUser(t *testing.T, store *Store, prefix string) int64 {
+	t.Helper()
+	username := uniqueName(prefix)
+	id, err := store.Users.Create(context.Background(), &models.User{
+		Username:     username,
+		Email:        username + "@example.com",
+		Name:         prefix,
+		PasswordHash: "hash",
+	})
+	if err != nil {
+		t.Fatalf("crear usuario: %v", err)
+	}
+	return id
+}
+
+func TestUsersContract(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		username := uniqueName("contrato")
+		user := &models.User{Username: username, Email: username + "@example.com", PasswordHash: "hash"}
+
+		id, err := store.Users.Create(ctx, user)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if _, err := store.Users.Create(ctx, user); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("Create duplicado: err %v, want ErrDuplicate", err)
+		}
+
+		got, err := store.Users.ByUsername(ctx, username)
+		if err != nil {
+			t.Fatalf("ByUsername: %v", err)
+		}
+		if got.ID != id || got.AuthType != "password" {
+			t.Errorf("ByUsername: id %d auth %q, want %d password", got.ID, got.AuthType, id)
+		}
+		if _, err := store.Users.ByUsername(ctx, uniqueName("nadie")); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ByUsername inexistente: err %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestSessionsContract(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		userID := createTestUser(t, store, "sesiones")
+		sessionID := uniqueName("s")
+		h1, h2, h3 := uniqueName("h1"), uniqueName("h2"), uniqueName("h3")
+		expires := time.Now().Add(time.Hour)
+
+		if err := store.Sessions.Create(ctx, &models.UserSession{ID: sessionID, UserID: userID, ExpiresAt: expires}, h1); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		session, err := store.Sessions.ByRefreshHash(ctx, h1)
+		if err != nil {
+			t.Fatalf("ByRefreshHash: %v", err)
+		}
+		if session.SessionID != sessionID || session.UserID != userID || !session.Active {
+			t.Errorf("ByRefreshHash: %+v", session)
+		}
+
+		// Rotar: el token vigente pasa a ser el anterior
+		if err := store.Sessions.Rotate(ctx, sessionID, h1, h2, expires, "10.0.0.1"); err != nil {
+			t.Fatalf("Rotate: %v", err)
+		}
+		if err := store.Sessions.Rotate(ctx, sessionID, h1, h3, expires, ""); !errors.Is(err, ErrConflict) {
+			t.Errorf("Rotate con token ya rotado: err %v, want ErrConflict", err)
+		}
+		if _, err := store.Sessions.ByRefreshHash(ctx, h1); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ByRefreshHash rotado: err %v, want ErrNotFound", err)
+		}
+		if id, err := store.Sessions.ByUsedHash(ctx, h1); err != nil || id != sessionID {
+			t.Errorf("ByUsedHash: %q %v, want %q", id, err, sessionID)
+		}
+		if _, err := store.Sessions.ByUsedHash(ctx, h2); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ByUsedHash vigente: err %v, want ErrNotFound", err)
+		}
+
+		// Tras otra rotación siguen registrados todos los tokens usados
+		if err := store.Sessions.Rotate(ctx, sessionID, h2, h3, expires, ""); err != nil {
+			t.Fatalf("segundo Rotate: %v", err)
+		}
+		for _, used := range []string{h1, h2} {
+			if id, err := store.Sessions.ByUsedHash(ctx, used); err != nil || id != sessionID {
+				t.Errorf("ByUsedHash tras dos rotaciones: %q %v, want %q", id, err, sessionID)
+			}
+		}
+
+		active, err := store.Sessions.ListActive(ctx, userID)
+		if err != nil || len(active) != 1 {
+			t.Fatalf("ListActive: %d sesiones (%v), want 1", len(active), err)
+		}
+
+		// Sólo el dueño puede revocar
+		if err := store.Sessions.Revoke(ctx, sessionID, userID+1); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Revoke ajeno: err %v, want ErrNotFound", err)
+		}
+		if err := store.Sessions.Revoke(ctx, sessionID, userID); err != nil {
+			t.Fatalf("Revoke: %v", err)
+		}
+		if err := store.Sessions.Revoke(ctx, sessionID, userID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Revoke repetido: err %v, want ErrNotFound", err)
+		}
+		if ok, err := store.Sessions.IsActive(ctx, sessionID); err != nil || ok {
+			t.Errorf("IsActive tras Revoke: %v %v, want false", ok, err)
+		}
+		if session, err := store.Sessions.ByRefreshHash(ctx, h3); err != nil || session.Active {
+			t.Errorf("ByRefreshHash tras Revoke: %+v %v, want inactiva", session, err)
+		}
+		if err := store.Sessions.Rotate(ctx, sessionID, h3, uniqueName("h4"), expires, ""); !errors.Is(err, ErrConflict) {
+			t.Errorf("Rotate revocada: err %v, want ErrConflict", err)
+		}
+		if ok, err := store.Sessions.IsActive(ctx, uniqueName("nada")); err != nil || ok {
+			t.Errorf("IsActive inexistente: %v %v, want false", ok, err)
+		}
+	})
+}
+
+func TestSessionsRevokeAllContract(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		userID := createTestUser(t, store, "revocar")
+		expires := time.Now().Add(time.Hour)
+
+		ids := []string{uniqueName("a"), uniqueName("b"), uniqueName("c")}
+		for _, id := range ids {
+			if err := store.Sessions.Create(ctx, &models.UserSession{ID: id, UserID: userID, ExpiresAt: expires}, uniqueName("h")); err != nil {
+				t.Fatalf("Create %s: %v", id, err)
+			}
+		}
+
+		n, err := store.Sessions.RevokeAll(ctx, userID, ids[0])
+		if err != nil || n != 2 {
+			t.Fatalf("RevokeAll: %d (%v), want 2", n, err)
+		}
+		want := map[string]bool{ids[0]: true, ids[1]: false, ids[2]: false}
+		for id, active := range want {
+			if ok, _ := store.Sessions.IsActive(ctx, id); ok != active {
+				t.Errorf("IsActive(%s) = %v, want %v", id, ok, active)
+			}
+		}
+	})
+}
+
+func TestIncidentsContract(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		route := uniqueName("R")
+
+		id, err := store.Incidents.Create(ctx, &models.Incident{
+			Type:       models.IncidentBusFull,
+			Latitude:   -33.4489,
+			Longitude:  -70.6693,
+			Severity:   models.SeverityHigh,
+			ReporterID: "anonymous",
+			RouteName:  &route,
+		})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		got, err := store.Incidents.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if got.Type != models.IncidentBusFull || got.Severity != models.SeverityHigh || *got.RouteName != route {
+			t.Errorf("Get: %+v", got)
+		}
+
+		tests := []struct {
+			name   string
+			filter IncidentFilter
+			want   int
+		}{
+			{"por ruta", IncidentFilter{RouteName: route, Within: time.Hour}, 1},
+			{"otra ruta", IncidentFilter{RouteName: uniqueName("R")}, 0},
+			{"dentro de la caja", IncidentFilter{RouteName: route, Box: &BoundingBox{MinLat: -34, MaxLat: -33, MinLon: -71, MaxLon: -70}}, 1},
+			{"fuera de la caja", IncidentFilter{RouteName: route, Box: &BoundingBox{MinLat: -30, MaxLat: -29, MinLon: -71, MaxLon: -70}}, 0},
+		}
+		for _, tt := range tests {
+			list, err := store.Incidents.List(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("List %s: %v", tt.name, err)
+			}
+			if len(list) != tt.want {
+				t.Errorf("List %s: %d incidentes, want %d", tt.name, len(list), tt.want)
+			}
+		}
+
+		if _, err := store.Incidents.Get(ctx, id+1_000_000); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get inexistente: err %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestCastVoteContract(t *testing.T) {
+	thresholds := ModerationThresholds{Verify: 2, Hide: 2, MaxDeviceScore: 1}
+
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		route := uniqueName("R")
+		id, err := store.Incidents.Create(ctx, &models.Incident{
+			Type:       models.IncidentBusDelayed,
+			Latitude:   -33.45,
+			Longitude:  -70.66,
+			Severity:   models.SeverityMedium,
+			ReporterID: "anonymous",
+			RouteName:  &route,
+		})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		steps := []struct {
+			name     string
+			voter    string
+			vote     int
+			weight   float64
+			wantErr  error
+			up, down int
+			score    float64
+			actions  []string
+			hidden   bool
+			verified bool
+		}{
+			{"primer voto", "device:a", 1, 1, nil, 1, 0, 1, nil, false, false},
+			{"voto repetido", "device:a", 1, 1, ErrDuplicate, 0, 0, 0, nil, false, false},
+			{"cruza el umbral de verificación", "user:1", 1, 1.5, nil, 2, 0, 2.5, []string{models.ModerationVerified}, false, true},
+			// Cambiar el voto descuenta el anterior con su peso original
+			{"cambio de voto", "device:a", -1, 1, nil, 1, 1, 0.5, []string{models.ModerationUnverified}, false, false},
+			// Los anónimos suman -2 pero cuentan -1 para moderar: 0.5 en vez de -0.5
+			{"anónimos acotados", "device:b", -1, 1, nil, 1, 2, -0.5, nil, false, false},
+			{"cruza el umbral de ocultamiento", "user:2", -1, 3, nil, 1, 3, -3.5, []string{models.ModerationHidden}, true, false},
+		}
+		var logged []string
+		for _, step := range steps {
+			incident, entries, err := store.Incidents.CastVote(ctx, models.IncidentVote{
+				IncidentID: id,
+				VoterKey:   step.voter,
+				Vote:       step.vote,
+				Weight:     step.weight,
+			}, thresholds)
+			if step.wantErr != nil {
+				if !errors.Is(err, step.wantErr) {
+					t.Fatalf("%s: err %v, want %v", step.name, err, step.wantErr)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+			if incident.Upvotes != step.up || incident.Downvotes != step.down || incident.WeightedScore != step.score {
+				t.Errorf("%s: votos %d/%d puntaje %v, want %d/%d %v", step.name,
+					incident.Upvotes, incident.Downvotes, incident.WeightedScore, step.up, step.down, step.score)
+			}
+			if incident.IsVerified != step.verified || incident.IsHidden != step.hidden {
+				t.Errorf("%s: verificado %v oculto %v, want %v %v", step.name,
+					incident.IsVerified, incident.IsHidden, step.verified, step.hidden)
+			}
+			var actions []string
+			for _, entry := range entries {
+				if entry.TriggerVoter != step.voter {
+					t.Errorf("%s: auditoría con votante %q, want %q", step.name, entry.TriggerVoter, step.voter)
+				}
+				actions = append(actions, entry.Action)
+			}
+			if fmt.Sprint(actions) != fmt.Sprint(step.actions) {
+				t.Errorf("%s: acciones %v, want %v", step.name, actions, step.actions)
+			}
+			logged = append(logged, actions...)
+		}
+
+		log, err := store.Incidents.ModerationLog(ctx, id)
+		if err != nil {
+			t.Fatalf("ModerationLog: %v", err)
+		}
+		var actions []string
+		for _, entry := range log {
+			actions = append(actions, entry.Action)
+		}
+		if fmt.Sprint(actions) != fmt.Sprint(logged) {
+			t.Errorf("ModerationLog: %v, want %v", actions, logged)
+		}
+
+		// Oculto: fuera de los listados salvo IncludeHidden, pero accesible por id
+		if list, _ := store.Incidents.List(ctx, IncidentFilter{RouteName: route}); len(list) != 0 {
+			t.Errorf("List con incidente oculto: %d, want 0", len(list))
+		}
+		if list, _ := store.Incidents.List(ctx, IncidentFilter{RouteName: route, IncludeHidden: true}); len(list) != 1 {
+			t.Errorf("List IncludeHidden: %d, want 1", len(list))
+		}
+		if _, err := store.Incidents.Get(ctx, id); err != nil {
+			t.Errorf("Get oculto: %v", err)
+		}
+
+		if _, _, err := store.Incidents.CastVote(ctx, models.IncidentVote{IncidentID: id + 1_000_000, VoterKey: "device:a", Vote: 1, Weight: 1}, thresholds); !errors.Is(err, ErrNotFound) {
+			t.Errorf("CastVote inexistente: err %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestModerationThresholds(t *testing.T) {
+	tests := []struct {
+		name        string
+		thresholds  ModerationThresholds
+		score       float64
+		deviceScore float64 // Parte de score que viene de votos anónimos
+		verified    bool
+		hidden      bool
+		want        []string
+	}{
+		{"bajo ambos umbrales", ModerationThresholds{Verify: 3, Hide: 3}, 2.9, 0, false, false, nil},
+		{"alcanza la verificación", ModerationThresholds{Verify: 3, Hide: 3}, 3, 0, false, false, []string{models.ModerationVerified}},
+		{"ya verificado", ModerationThresholds{Verify: 3, Hide: 3}, 4, 0, true, false, nil},
+		{"pierde la verificación", ModerationThresholds{Verify: 3, Hide: 3}, 2, 0, true, false, []string{models.ModerationUnverified}},
+		{"alcanza el ocultamiento", ModerationThresholds{Verify: 3, Hide: 3}, -3, 0, false, false, []string{models.ModerationHidden}},
+		{"vuelve a mostrarse", ModerationThresholds{Verify: 3, Hide: 3}, -1, 0, false, true, []string{models.ModerationUnhidden}},
+		{"de verificado a oculto", ModerationThresholds{Verify: 1, Hide: 1}, -1, 0, true, false, []string{models.ModerationUnverified, models.ModerationHidden}},
+		{"umbrales desactivados", ModerationThresholds{}, 10, 0, false, false, nil},
+		{"sólo anónimos no verifican", ModerationThresholds{Verify: 3, Hide: 3, MaxDeviceScore: 1}, 4, 4, false, false, nil},
+		{"sólo anónimos no ocultan", ModerationThresholds{Verify: 3, Hide: 3, MaxDeviceScore: 1}, -4, -4, false, false, nil},
+		{"anónimos acotados suman", ModerationThresholds{Verify: 3, Hide: 3, MaxDeviceScore: 1}, 5, 3, false, false, []string{models.ModerationVerified}},
+		{"anónimos no cuentan", ModerationThresholds{Verify: 3, Hide: 3}, 3.5, 1, false, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			incident := &models.Incident{WeightedScore: tt.score, IsVerified: tt.verified, IsHidden: tt.hidden}
+			got := tt.thresholds.moderate(incident, tt.deviceScore)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("moderate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreferencesContract(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		userID := createTestUser(t, store, "preferencias")
+
+		if _, err := store.Preferences.Get(ctx, userID); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get sin guardar: err %v, want ErrNotFound", err)
+		}
+
+		audio := false
+		near := 150.0
+		if err := store.Preferences.Upsert(ctx, userID, models.NotificationPreferencesUpdateRequest{EnableAudio: &audio}); err != nil {
+			t.Fatalf("Upsert: %v", err)
+		}
+		if err := store.Preferences.Upsert(ctx, userID, models.NotificationPreferencesUpdateRequest{NearDistance: &near}); err != nil {
+			t.Fatalf("Upsert parcial: %v", err)
+		}
+
+		got, err := store.Preferences.Get(ctx, userID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		want := DefaultNotificationPreferences()
+		// Los campos ausentes conservan lo guardado antes o el valor por defecto
+		if got.EnableAudio || got.NearDistance != near || got.ApproachingDistance != want.ApproachingDistance || got.MinimumPriority != want.MinimumPriority {
+			t.Errorf("Get: %+v", got)
+		}
+	})
+}
+
+func TestShareAccessContract(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store *Store) {
+		ctx := context.Background()
+		userID := createTestUser(t, store, "share_pin")
+		shareID := uniqueName("share")
+		if err := store.Shares.Create(ctx, &models.LocationShare{
+			ID:        shareID,
+			UserID:    userID,
+			Latitude:  -33.4372,
+			Longitude: -70.6506,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		recipientID, err := store.Shares.AddRecipient(ctx, &models.ShareRecipient{ShareID: shareID, TokenHash: uniqueName("token")})
+		if err != nil {
+			t.Fatalf("AddRecipient: %v", err)
+		}
+		since := time.Now().Add(-time.Minute)
+
+		// Un intento de PIN se anota como fallido antes de comparar
+		attempt := &models.ShareAccess{ShareID: shareID, RecipientID: &recipientID, Via: "api", Outcome: models.ShareAccessBadPIN}
+		if err := store.Shares.LogAccess(ctx, attempt); err != nil {
+			t.Fatalf("LogAccess: %v", err)
+		}
+		if attempt.ID == 0 {
+			t.Fatal("LogAccess no asignó el id")
+		}
+		if n, err := store.Shares.CountAccess(ctx, recipientID, models.ShareAccessBadPIN, since); err != nil || n != 1 {
+			t.Fatalf("CountAccess: %d, %v, want 1", n, err)
+		}
+
+		// y se corrige si el PIN era el correcto
+		if err := store.Shares.SetAccessOutcome(ctx, attempt.ID, models.ShareAccessGranted); err != nil {
+			t.Fatalf("SetAccessOutcome: %v", err)
+		}
+		if n, err := store.Shares.CountAccess(ctx, recipientID, models.ShareAccessBadPIN, since); err != nil || n != 0 {
+			t.Errorf("CountAccess fallidos tras conceder: %d, %v, want 0", n, err)
+		}
+		if n, err := store.Shares.CountAccess(ctx, recipientID, models.ShareAccessGranted, since); err != nil || n != 1 {
+			t.Errorf("CountAccess concedidos: %d, %v, want 1", n, err)
+		}
+		recipients, err := store.Shares.Recipients(ctx, shareID)
+		if err != nil || len(recipients) != 1 {
+			t.Fatalf("Recipients: %v, %v", recipients, err)
+		}
+		if recipients[0].LastAccessAt == nil {
+			t.Error("SetAccessOutcome concedido no actualizó last_access_at")
+		}
+
+		if err := store.Shares.SetAccessOutcome(ctx, attempt.ID+1000000, models.ShareAccessGranted); !errors.Is(err, ErrNotFound) {
+			t.Errorf("SetAccessOutcome inexistente: err %v, want ErrNotFound", err)
+		}
+	})
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/yourorg/wayfindcl/internal/geometry"
 	"github.com/yourorg/wayfindcl/internal/handlers"
 	"github.com/yourorg/wayfindcl/internal/middleware"
+	"github.com/yourorg/wayfindcl/internal/models"
+	"github.com/yourorg/wayfindcl/internal/notifications"
 )
 
 // Variable global para configurar RedBusHandler después de inicializar geometría
@@ -40,16 +42,50 @@ func Register(app *fiber.App, db *sql.DB) {
 	// Verificar si un token biométrico ya existe
 	api.Post("/biometric/check", middleware.StrictRateLimiter(), handlers.CheckBiometricExists)
 
+	// ============================================================================
+	// SESIONES (refresh tokens rotativos + gestión de dispositivos)
+	// ============================================================================
+	// Autenticación JWT (Bearer) - popula c.Locals("userID") y c.Locals("username")
+	middleware.SetSessionValidator(handlers.IsSessionActive)
+	requireAuth := middleware.RequireAuth(handlers.JWTSecret)
+	optionalAuth := middleware.OptionalAuth(handlers.JWTSecret)
+	// Roles (user < moderator < admin) viajan en el JWT; se asignan con `cli users role`
+	requireModerator := middleware.RequireRole(models.RoleModerator)
+	requireAdmin := middleware.RequireRole(models.RoleAdmin)
+
+	authGroup.Post("/refresh", handlers.RefreshToken)
+	// POST /api/auth/refresh - Body: {refresh_token} → nuevo access + refresh token
+
+	authGroup.Post("/logout", requireAuth, handlers.Logout)
+	// POST /api/auth/logout - Cierra la sesión del dispositivo actual
+
+	sessions := api.Group("/auth/sessions", requireAuth)
+	sessions.Get("/", handlers.ListSessions)
+	// GET /api/auth/sessions - Dispositivos con sesión activa
+
+	sessions.Delete("/:id", handlers.RevokeSession)
+	// DELETE /api/auth/sessions/:id - Revoca un dispositivo (ej: teléfono robado)
+
+	sessions.Delete("/", handlers.RevokeAllSessions)
+	// DELETE /api/auth/sessions?keep_current=true - Revoca todas las sesiones
+
 	// Initialize GraphHopper (inicia como subproceso del backend)
 	handlers.InitGraphHopper()
 
-	// Initialize handlers
-	incidentHandler := handlers.NewIncidentHandler(db)
-	locationShareHandler := handlers.NewLocationShareHandler(db)
-	tripHistoryHandler := handlers.NewTripHistoryHandler(db)
-	notificationPrefsHandler := handlers.NewNotificationPreferencesHandler(db)
+	// Initialize handlers (repositorios creados en handlers.Setup)
+	store := handlers.Repositories()
+	incidentAlerts := notifications.NewIncidentAlerts(store.Subscriptions, store.Preferences, notifications.FromEnv(store.Notifications))
+	incidentHandler := handlers.NewIncidentHandler(store.Incidents, incidentAlerts)
+	subscriptionHandler := handlers.NewSubscriptionHandler(store.Subscriptions)
+	notificationHandler := handlers.NewNotificationHandler(store.Notifications)
+	contributionHandler := handlers.NewContributionHandler(store.Contributions, store.Routes, incidentAlerts)
+	locationShareHandler := handlers.NewLocationShareHandler(store.Shares)
+	tripHistoryHandler := handlers.NewTripHistoryHandler(store.Trips)
+	debugEventHandler := handlers.NewDebugEventHandler(store.DebugEvents)
+	notificationPrefsHandler := handlers.NewNotificationPreferencesHandler(store.Preferences)
 	redBusHandler := handlers.NewRedBusHandler(db)
-	busArrivalsHandler := handlers.NewBusArrivalsHandler(db)
+	busArrivalsHandler := handlers.NewBusArrivalsHandler(db, store.Arrivals)
+	boardingAlertHandler := handlers.NewBoardingAlertHandler(busArrivalsHandler.Arrivals())
 	statsHandler := handlers.NewStatsHandler(db)
 	gtfsStatsHandler := handlers.NewGTFSStatsHandler(db)
 	dbStatsHandler := handlers.NewDatabaseStatsHandler(db)
@@ -59,6 +95,15 @@ func Register(app *fiber.App, db *sql.DB) {
 	// Guardar referencia global para configuración posterior
 	redBusHandlerInstance = redBusHandler
 
+	// Cachés en memoria que el CLI puede vaciar (POST /api/admin/cache/flush)
+	handlers.RegisterCacheFlusher("bus_arrivals", busArrivalsHandler.ClearCache)
+	handlers.RegisterCacheFlusher("stop_schedules", busArrivalsHandler.ClearSchedules)
+	handlers.RegisterCacheFlusher("gtfs_stats", gtfsStatsHandler.ClearCache)
+	handlers.RegisterCacheFlusher("red_bus", redBusHandler.ClearCache)
+
+	// Métricas del caché de llegadas en /api/stats/scraper
+	dbStatsHandler.SetArrivalsStats(busArrivalsHandler.CacheStats)
+
 	// Status endpoint para el dashboard
 	api.Get("/status", statusHandler.GetStatus)
 
@@ -164,6 +209,11 @@ func Register(app *fiber.App, db *sql.DB) {
 	// Body: {origin, destination, departure_time, preferences: {minimize_transfers, minimize_walking}}
 	// Retorna: Ruta ÓPTIMA según preferencias del usuario
 	
+	route.Post("/transit/native", handlers.GetNativeTransitRoute)
+	// POST /api/route/transit/native
+	// Body: {origin, destination, departure_time, max_walk_distance, max_transfers}
+	// Retorna: Itinerarios Pareto-óptimos (llegada vs. transbordos) con RAPTOR sobre GTFS local (offline)
+	
 	// ────────────────────────────────────────────────────────────────────────
 	// OPCIONES DE RUTA (Resumen)
 	// ────────────────────────────────────────────────────────────────────────
@@ -208,31 +258,82 @@ func Register(app *fiber.App, db *sql.DB) {
 	arrivals.Post("/nearby", busArrivalsHandler.GetBusArrivalsByLocation)
 	// POST /api/bus-arrivals/nearby - Obtiene llegadas del paradero más cercano
 
+	arrivals.Post("/:stopCode/subscribe", requireAuth, busArrivalsHandler.SubscribeStop)
+	// POST /api/bus-arrivals/PC615/subscribe - Refresca el paradero en segundo plano por 10 minutos (requiere login)
+
+	arrivals.Get("/:stopCode/reliability", busArrivalsHandler.GetStopReliability)
+	// GET /api/bus-arrivals/PC615/reliability?route=506&days=7 - Headways, error de predicción y score por ruta y hora
+
+	// ============================================================================
+	// BOARDING ALERTS (Avisar cuando se acerca el bus)
+	// ============================================================================
+	boarding := api.Group("/boarding-alerts", requireAuth)
+	boarding.Post("/", boardingAlertHandler.CreateBoardingAlert)
+	// POST /api/boarding-alerts - {"stop_code":"PA433","route":"506","trigger":"minutes","threshold":5}
+	boarding.Get("/", boardingAlertHandler.ListBoardingAlerts)
+	// GET /api/boarding-alerts - Alertas activas del usuario
+	boarding.Get("/stream", boardingAlertHandler.StreamBoardingAlerts)
+	// GET /api/boarding-alerts/stream - Eventos de las alertas (SSE)
+	boarding.Delete("/:id", boardingAlertHandler.CancelBoardingAlert)
+	// DELETE /api/boarding-alerts/:id - Cancela una alerta
+
 	// ============================================================================
 	// INCIDENTS (Reportes de incidentes)
+	// AUTH: opcional - se permiten reportes anónimos
 	// ============================================================================
 	incidents := api.Group("/incidents")
+	incidents.Use(optionalAuth)
 	incidents.Post("/", incidentHandler.CreateIncident)
 	incidents.Get("/nearby", incidentHandler.GetNearbyIncidents)
 	incidents.Get("/route", incidentHandler.GetIncidentsByRoute)
 	incidents.Get("/stats", incidentHandler.GetIncidentStats)
+	incidents.Get("/reporters/:reporterId/reputation", incidentHandler.GetReporterReputation)
+	incidents.Get("/:id/audit", incidentHandler.GetIncidentAudit)
 	incidents.Get("/:id", incidentHandler.GetIncidentByID)
-	incidents.Put("/:id/vote", incidentHandler.VoteIncident)
+	anonymousVotes := middleware.AnonymousVoteRateLimiter()
+	incidents.Put("/:id/vote", anonymousVotes, incidentHandler.VoteIncident)
+	incidents.Post("/:id/confirm", anonymousVotes, incidentHandler.ConfirmIncident)
 
 	// ============================================================================
 	// LOCATION SHARING (Compartir ubicación en tiempo real)
+	// AUTH: requerida; los receptores entran con su token por /api/shared
 	// ============================================================================
-	shares := api.Group("/shares")
+	shares := api.Group("/shares", requireAuth)
 	shares.Post("/", locationShareHandler.CreateLocationShare)
 	shares.Get("/:id", locationShareHandler.GetLocationShare)
+	shares.Get("/:id/stream", locationShareHandler.StreamLocationShare)
+	// GET /api/shares/:id/stream - Server-Sent Events con cada actualización (position, alert, stopped, expired)
+	shares.Get("/:id/trail", locationShareHandler.GetShareTrail)
+	// GET /api/shares/:id/trail?limit=N - Recorrido (breadcrumbs), más antiguos primero
+	shares.Get("/:id/alerts", locationShareHandler.GetShareAlerts)
+	// GET /api/shares/:id/alerts - Llegada, desvío de la ruta planificada y detenciones
 	shares.Put("/:id/location", locationShareHandler.UpdateLocationShare)
 	shares.Delete("/:id", locationShareHandler.StopLocationShare)
 	shares.Get("/", locationShareHandler.GetUserShares)
 
+	shares.Post("/:id/recipients", locationShareHandler.CreateShareRecipient)
+	// POST /api/shares/:id/recipients - Nuevo enlace de receptor {label, pin}; el token sólo viene aquí
+	shares.Get("/:id/recipients", locationShareHandler.ListShareRecipients)
+	shares.Delete("/:id/recipients/:recipientId", locationShareHandler.RevokeShareRecipient)
+	// DELETE /api/shares/:id/recipients/:recipientId - Revoca un receptor y corta su stream
+	shares.Get("/:id/access", locationShareHandler.GetShareAccessLog)
+	// GET /api/shares/:id/access?limit=N - Registro de accesos de los receptores
+
+	// Vista pública de los receptores (token propio + header X-Share-PIN si tiene PIN)
+	shared := api.Group("/shared")
+	shared.Get("/:token", locationShareHandler.GetSharedLocation)
+	shared.Get("/:token/stream", locationShareHandler.StreamSharedLocation)
+
+	// Página HTML para ver el share sin instalar la app
+	app.Get("/share/:token", locationShareHandler.ViewSharePage)
+	app.Post("/share/:token", locationShareHandler.ViewSharePage)
+
 	// ============================================================================
 	// TRIP HISTORY (Historial de viajes)
+	// AUTH: requerida
 	// ============================================================================
 	trips := api.Group("/trips")
+	trips.Use(requireAuth)
 	trips.Post("/", tripHistoryHandler.SaveTrip)
 	trips.Get("/", tripHistoryHandler.GetUserTrips)
 	trips.Get("/frequent", tripHistoryHandler.GetFrequentLocations)
@@ -241,15 +342,57 @@ func Register(app *fiber.App, db *sql.DB) {
 
 	// ============================================================================
 	// USER PREFERENCES (Preferencias de notificaciones)
+	// AUTH: requerida
 	// ============================================================================
 	prefs := api.Group("/preferences")
+	prefs.Use(requireAuth)
 	prefs.Get("/notifications", notificationPrefsHandler.GetNotificationPreferences)
 	prefs.Put("/notifications", notificationPrefsHandler.UpdateNotificationPreferences)
 
+	// ============================================================================
+	// SUBSCRIPTIONS + NOTIFICATIONS (Avisos de incidentes en rutas/paraderos/zonas)
+	// AUTH: requerida
+	// ============================================================================
+	subscriptions := api.Group("/subscriptions")
+	subscriptions.Use(requireAuth)
+	subscriptions.Post("/", subscriptionHandler.CreateSubscription)
+	subscriptions.Get("/", subscriptionHandler.GetSubscriptions)
+	subscriptions.Delete("/:id", subscriptionHandler.DeleteSubscription)
+
+	inbox := api.Group("/notifications")
+	inbox.Use(requireAuth)
+	inbox.Get("/", notificationHandler.GetNotifications)
+	// GET /api/notifications?unread_only=true&limit=50 - Bandeja in-app
+	inbox.Post("/read", notificationHandler.MarkNotificationsRead)
+	// POST /api/notifications/read - Body: {ids: [...]} (vacío = todas)
+
+	// ============================================================================
+	// CONTRIBUTIONS (Reportes y sugerencias de la comunidad, con moderación)
+	// AUTH: opcional para crear y consultar (anónimos permitidos), requerida para editar
+	// ============================================================================
+	contributions := api.Group("/contributions")
+	contributions.Use(optionalAuth)
+	contributions.Post("/", contributionHandler.CreateContribution)
+	contributions.Get("/", contributionHandler.GetContributions)
+	// GET /api/contributions?status=verified&type=bus_status&bus_route=506 - Aprobadas/resueltas
+	contributions.Get("/mine", requireAuth, contributionHandler.GetMyContributions)
+	contributions.Get("/:id", contributionHandler.GetContribution)
+	contributions.Put("/:id", requireAuth, contributionHandler.UpdateContribution)
+	contributions.Delete("/:id", requireAuth, contributionHandler.DeleteContribution)
+	// PUT/DELETE sólo para el autor y mientras esté pendiente
+
+	// Cola de moderación para usuarios con rol moderator (el CLI usa /api/admin/contributions)
+	moderation := api.Group("/moderation", requireAuth, requireModerator)
+	moderation.Get("/contributions", contributionHandler.GetModerationQueue)
+	moderation.Post("/contributions/:id/approve", contributionHandler.ApproveContribution)
+	moderation.Post("/contributions/:id/reject", contributionHandler.RejectContribution)
+	moderation.Post("/contributions/:id/resolve", contributionHandler.ResolveContribution)
+
 	// ============================================================================
 	// STATISTICS (Estadísticas y métricas del sistema)
+	// AUTH: rol admin (dashboard)
 	// ============================================================================
-	stats := api.Group("/stats")
+	stats := api.Group("/stats", requireAuth, requireAdmin)
 	stats.Get("/system", statsHandler.GetSystemStats)
 	// GET /api/stats/system - Estadísticas generales del sistema (CPU, memoria, DB, etc.)
 	
@@ -274,6 +417,9 @@ func Register(app *fiber.App, db *sql.DB) {
 	stats.Get("/scraper", dbStatsHandler.GetScraperMetrics)
 	// GET /api/stats/scraper - Métricas de scraping de Moovit
 	
+	stats.Get("/reliability", busArrivalsHandler.GetReliabilityStats)
+	// GET /api/stats/reliability?days=&limit= - Rutas y paraderos menos confiables según las llegadas observadas
+	
 	stats.Get("/graphhopper", dbStatsHandler.GetGraphHopperMetrics)
 	// GET /api/stats/graphhopper - Métricas del motor de routing GraphHopper
 	
@@ -285,28 +431,60 @@ func Register(app *fiber.App, db *sql.DB) {
 	// ============================================================================
 	// NOTA: gtfs/sync se maneja automáticamente en la inicialización del servidor
 	// No es necesario exponerlo como endpoint público
+	// AUTH: header X-Admin-Token = ADMIN_TOKEN (usado por el CLI)
+	admin := api.Group("/admin", middleware.RequireAdminToken())
+	admin.Post("/cache/flush", handlers.FlushCaches)
+	// POST /api/admin/cache/flush?names=gtfs_stats,red_bus - Vacía cachés en memoria
+	admin.Get("/contributions", contributionHandler.GetModerationQueue)
+	// GET /api/admin/contributions?status=pending - Cola de moderación (más antiguas primero)
+	admin.Post("/contributions/:id/approve", contributionHandler.ApproveContribution)
+	admin.Post("/contributions/:id/reject", contributionHandler.RejectContribution)
+	admin.Post("/contributions/:id/resolve", contributionHandler.ResolveContribution)
+	// Body: {note} (requerida al rechazar/resolver); header opcional X-Admin-User
 	
 	// ============================================================================
 	// DEBUG DASHBOARD WEBSOCKET
 	// ============================================================================
 	// Endpoints para recibir logs y eventos desde la app Flutter
-	debugApi := api.Group("/debug")
-	debugApi.Post("/log", handlers.ReceiveFlutterLog)
-	debugApi.Post("/event", handlers.ReceiveFlutterEvent)
-	debugApi.Post("/error", handlers.ReceiveFlutterError)
-	debugApi.Post("/metrics", handlers.ReceiveFlutterMetrics)
-	debugApi.Post("/navigation", handlers.ReceiveNavigationEvent)
-	
-	// WebSocket para el dashboard web (siempre disponible)
+	// AUTH: opcional (la app también reporta antes del login o con la sesión
+	// vencida; con token el evento queda asociado al usuario)
+	// Los logs, errores y eventos de navegación se guardan (DEBUG_EVENTS_RETENTION)
+	debugApi := api.Group("/debug", optionalAuth)
+	debugApi.Post("/log", debugEventHandler.ReceiveFlutterLog)
+	debugApi.Post("/event", debugEventHandler.ReceiveFlutterEvent)
+	debugApi.Post("/error", debugEventHandler.ReceiveFlutterError)
+	debugApi.Post("/metrics", debugEventHandler.ReceiveFlutterMetrics)
+	debugApi.Post("/navigation", debugEventHandler.ReceiveNavigationEvent)
+
+	// Consultas sobre lo guardado
+	// AUTH: rol admin (requireAuth primero: optionalAuth deja pasar sin token)
+	debugApi.Get("/events", requireAuth, requireAdmin, debugEventHandler.SearchDebugEvents)
+	// GET /api/debug/events?kind=log,navigation&level=warn,error&device_id=&session_id=&q=&since=&until=
+
+	debugApi.Get("/errors", requireAuth, requireAdmin, debugEventHandler.SearchErrors)
+	// GET /api/debug/errors?q=timeout&device_id=&since= - Busca errores por texto del mensaje o stack
+
+	debugApi.Get("/issues", requireAuth, requireAdmin, debugEventHandler.GetIssues)
+	// GET /api/debug/issues?sort=count|recent&since= - Errores agrupados por stack normalizado
+
+	debugApi.Get("/issues/:fingerprint", requireAuth, requireAdmin, debugEventHandler.GetIssueEvents)
+	// GET /api/debug/issues/:fingerprint - Ocurrencias de un issue
+
+	debugApi.Get("/sessions/:sessionId/timeline", requireAuth, requireAdmin, debugEventHandler.GetSessionTimeline)
+	// GET /api/debug/sessions/:sessionId/timeline - Eventos de una sesión de la app en orden
+	
+	// WebSocket para el dashboard web
+	// AUTH: rol admin en el handshake (header Authorization o ?access_token=)
 	app.Use("/ws/debug", func(c *fiber.Ctx) error {
 		if websocket.IsWebSocketUpgrade(c) {
 			return c.Next()
 		}
 		return fiber.ErrUpgradeRequired
-	})
+	}, middleware.RequireWebSocketAuth(handlers.JWTSecret), requireAdmin)
 	
 	app.Get("/ws/debug", websocket.New(func(c *websocket.Conn) {
-		debug.HandleWebSocketFiber(c)
+		username, _ := c.Locals(middleware.LocalUsername).(string)
+		debug.HandleWebSocketFiber(c, username)
 	}))
 }
 
@@ -0,0 +1,286 @@
+// ============================================================================
+// RAPTOR - Round-bAsed Public Transit Optimized Router
+// ============================================================================
+// Cada ronda k encuentra las llegadas más tempranas usando exactamente k viajes
+// en transporte público. El resultado es el conjunto Pareto-óptimo de viajes
+// según (hora de llegada, número de transbordos).
+// ============================================================================
+
+package transit
+
+import "sort"
+
+const unreachable = int(^uint(0) >> 1)
+
+// Access es una parada de origen/destino alcanzable caminando
+type Access struct {
+	Stop     int
+	WalkSecs int
+	Meters   float64
+}
+
+// Query describe una búsqueda RAPTOR sobre un Timetable
+type Query struct {
+	DepartureSecs  int      // Segundos desde medianoche del día de servicio
+	Origins        []Access // Paradas de acceso desde el origen
+	Destinations   []Access // Paradas de egreso hacia el destino
+	MaxRounds      int      // Máximo de viajes (transbordos + 1)
+	MinTransferSec int      // Holgura mínima para cambiar de bus
+}
+
+type labelKind int
+
+const (
+	labelNone labelKind = iota
+	labelAccess
+	labelTransit
+)
+
+// label guarda cómo se llegó a una parada en una ronda (para reconstruir el viaje)
+type label struct {
+	arrival int
+	kind    labelKind
+	trips   int // viajes usados para llegar (ronda original del label)
+
+	// Acceso a pie desde el origen
+	access Access
+
+	// Tramo en transporte público
+	pattern   int
+	trip      int // índice dentro de pattern.trips
+	boardPos  int
+	alightPos int
+
+	// Transbordo a pie posterior al tramo (walkTo = -1 si no hubo)
+	walkTo     int
+	walkSecs   int
+	walkMeters float64
+}
+
+// rawJourney es un resultado de RAPTOR en índices internos
+type rawJourney struct {
+	arrival int
+	trips   int
+	egress  Access
+	legs    []rawLeg
+}
+
+type rawLeg struct {
+	walk bool
+
+	// walk
+	fromStop, toStop int
+	depSecs, arrSecs int
+	meters           float64
+
+	// transit
+	pattern, trip, boardPos, alightPos int
+}
+
+// Run ejecuta RAPTOR y retorna los viajes Pareto-óptimos (menos viajes primero)
+func (t *Timetable) Run(q Query) []rawJourney {
+	if q.MaxRounds <= 0 {
+		q.MaxRounds = 4
+	}
+	n := len(t.Stops)
+
+	rounds := make([][]label, q.MaxRounds+1)
+	rounds[0] = make([]label, n)
+	best := make([]int, n)
+	for i := range best {
+		best[i] = unreachable
+		rounds[0][i] = label{arrival: unreachable, walkTo: -1}
+	}
+
+	marked := make(map[int]bool)
+	for _, o := range q.Origins {
+		arr := q.DepartureSecs + o.WalkSecs
+		if arr < rounds[0][o.Stop].arrival {
+			rounds[0][o.Stop] = label{arrival: arr, kind: labelAccess, access: o, walkTo: -1}
+			best[o.Stop] = arr
+			marked[o.Stop] = true
+		}
+	}
+
+	egress := make(map[int]Access, len(q.Destinations))
+	for _, d := range q.Destinations {
+		if prev, ok := egress[d.Stop]; !ok || d.WalkSecs < prev.WalkSecs {
+			egress[d.Stop] = d
+		}
+	}
+
+	bestTarget := unreachable
+	var journeys []rawJourney
+
+	for k := 1; k <= q.MaxRounds && len(marked) > 0; k++ {
+		prev := rounds[k-1]
+		cur := make([]label, n)
+		copy(cur, prev)
+		rounds[k] = cur
+
+		// Patrones a recorrer: posición más temprana de una parada marcada
+		queue := make(map[int]int)
+		for stop := range marked {
+			for _, ref := range t.stopPatterns[stop] {
+				if pos, ok := queue[ref.pattern]; !ok || ref.pos < pos {
+					queue[ref.pattern] = ref.pos
+				}
+			}
+		}
+		marked = make(map[int]bool)
+
+		patternIDs := make([]int, 0, len(queue))
+		for p := range queue {
+			patternIDs = append(patternIDs, p)
+		}
+		sort.Ints(patternIDs) // orden determinístico
+
+		improvedByTransit := []int{}
+		for _, pIdx := range patternIDs {
+			p := &t.patterns[pIdx]
+			tripIdx := -1
+			boardPos := -1
+
+			for pos := queue[pIdx]; pos < len(p.stops); pos++ {
+				stop := p.stops[pos]
+
+				if tripIdx >= 0 {
+					arr := p.trips[tripIdx].arr[pos]
+					if arr < best[stop] && arr < bestTarget {
+						cur[stop] = label{
+							arrival:   arr,
+							kind:      labelTransit,
+							trips:     k,
+							pattern:   pIdx,
+							trip:      tripIdx,
+							boardPos:  boardPos,
+							alightPos: pos,
+							walkTo:    -1,
+						}
+						best[stop] = arr
+						marked[stop] = true
+						improvedByTransit = append(improvedByTransit, stop)
+					}
+				}
+
+				// ¿Se puede tomar un viaje más temprano en esta parada?
+				if prev[stop].arrival == unreachable {
+					continue
+				}
+				ready := prev[stop].arrival
+				if prev[stop].kind == labelTransit {
+					ready += q.MinTransferSec
+				}
+				if tripIdx >= 0 && p.trips[tripIdx].dep[pos] < ready {
+					continue
+				}
+				if candidate := earliestTrip(p, pos, ready); candidate >= 0 && (tripIdx < 0 || candidate < tripIdx) {
+					tripIdx = candidate
+					boardPos = pos
+				}
+			}
+		}
+
+		// Transbordos a pie desde paradas mejoradas en esta ronda
+		for _, stop := range improvedByTransit {
+			base := cur[stop]
+			if base.kind != labelTransit || base.trips != k || base.walkTo != -1 {
+				continue
+			}
+			for _, fp := range t.footpaths[stop] {
+				arr := base.arrival + fp.walkSecs
+				if arr < best[fp.to] && arr < bestTarget {
+					l := base
+					l.arrival = arr
+					l.walkTo = fp.to
+					l.walkSecs = fp.walkSecs
+					l.walkMeters = fp.meters
+					// El tramo en bus termina en "stop"; el label se guarda en la parada destino del transbordo
+					cur[fp.to] = l
+					best[fp.to] = arr
+					marked[fp.to] = true
+				}
+			}
+		}
+
+		// Mejor llegada al destino con k viajes
+		roundBest := unreachable
+		var roundEgress Access
+		for stop, e := range egress {
+			l := cur[stop]
+			if l.kind != labelTransit || l.arrival == unreachable {
+				continue
+			}
+			if arr := l.arrival + e.WalkSecs; arr < roundBest || (arr == roundBest && e.WalkSecs < roundEgress.WalkSecs) {
+				roundBest = arr
+				roundEgress = e
+			}
+		}
+		if roundBest < bestTarget {
+			bestTarget = roundBest
+			if j, ok := t.reconstruct(rounds, roundEgress, k); ok {
+				j.arrival = roundBest
+				journeys = append(journeys, j)
+			}
+		}
+	}
+
+	return journeys
+}
+
+// earliestTrip busca el primer viaje del patrón que sale de pos a partir de "ready"
+func earliestTrip(p *pattern, pos, ready int) int {
+	i := sort.Search(len(p.trips), func(i int) bool { return p.trips[i].dep[pos] >= ready })
+	// Los patrones no garantizan FIFO estricto: verificar hacia adelante
+	for ; i < len(p.trips); i++ {
+		if p.trips[i].dep[pos] >= ready {
+			return i
+		}
+	}
+	return -1
+}
+
+// reconstruct recorre los labels hacia atrás desde la parada de egreso
+func (t *Timetable) reconstruct(rounds [][]label, egress Access, k int) (rawJourney, bool) {
+	j := rawJourney{trips: k, egress: egress}
+	stop := egress.Stop
+	round := k
+
+	var legs []rawLeg
+	for guard := 0; guard <= len(rounds); guard++ {
+		l := rounds[round][stop]
+		switch l.kind {
+		case labelAccess:
+			for i, k := 0, len(legs)-1; i < k; i, k = i+1, k-1 {
+				legs[i], legs[k] = legs[k], legs[i]
+			}
+			j.legs = legs
+			return j, true
+		case labelTransit:
+			p := &t.patterns[l.pattern]
+			trip := p.trips[l.trip]
+			alightStop := p.stops[l.alightPos]
+			if l.walkTo >= 0 {
+				legs = append(legs, rawLeg{
+					walk:     true,
+					fromStop: alightStop,
+					toStop:   l.walkTo,
+					depSecs:  trip.arr[l.alightPos],
+					arrSecs:  l.arrival,
+					meters:   l.walkMeters,
+				})
+			}
+			legs = append(legs, rawLeg{
+				pattern:   l.pattern,
+				trip:      l.trip,
+				boardPos:  l.boardPos,
+				alightPos: l.alightPos,
+			})
+			stop = p.stops[l.boardPos]
+			round = l.trips - 1
+		default:
+			return rawJourney{}, false
+		}
+	}
+	return rawJourney{}, false
+}
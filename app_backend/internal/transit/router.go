@@ -0,0 +1,470 @@
+package transit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yourorg/wayfindcl/internal/gtfs"
+)
+
+// Router planifica viajes en transporte público sobre las tablas GTFS locales.
+// Mantiene en memoria el horario del día de servicio (y del anterior, para
+// viajes nocturnos con horas > 24:00:00).
+type Router struct {
+	db       *sql.DB
+	location *time.Location
+	opts     TimetableOptions
+
+	mu           sync.Mutex
+	cache        map[string]*cachedTimetable // día de servicio -> horario (LRU de timetableCacheSize)
+	loading      map[string]*timetableCall   // cargas en curso por día
+	epoch        int64                       // cambia con cada Invalidate: descarta cargas iniciadas antes
+	generation   int64                       // generación GTFS activa con la que se cargó el caché
+	generationAt time.Time                   // última verificación de la generación activa
+}
+
+const (
+	// timetableCacheSize es cuántos días de servicio se mantienen en memoria
+	timetableCacheSize = 3
+	// generationCheckInterval es cada cuánto se consulta la generación GTFS activa
+	generationCheckInterval = 30 * time.Second
+	// timetableLoadTimeout acota la carga de un horario (no depende de quien la pidió)
+	timetableLoadTimeout = 5 * time.Minute
+)
+
+type cachedTimetable struct {
+	timetable *Timetable
+	usedAt    time.Time
+}
+
+// timetableCall es una carga en curso; done se cierra al terminar
+type timetableCall struct {
+	done      chan struct{}
+	timetable *Timetable
+	err       error
+}
+
+// PlanRequest es una consulta de viaje origen → destino
+type PlanRequest struct {
+	FromLat, FromLon float64
+	ToLat, ToLon     float64
+	Departure        time.Time
+	MaxWalkMeters    float64 // Radio de caminata para acceso/egreso
+	MaxTransfers     int
+}
+
+// JourneyStop es una parada dentro de un tramo
+type JourneyStop struct {
+	StopID string  `json:"stop_id"`
+	Code   string  `json:"code,omitempty"`
+	Name   string  `json:"name"`
+	Lat    float64 `json:"lat"`
+	Lon    float64 `json:"lon"`
+}
+
+// Leg es un tramo del viaje: caminata o transporte público
+type Leg struct {
+	Mode            string        `json:"mode"` // "walk", "bus", "metro", "rail"
+	From            *JourneyStop  `json:"from,omitempty"`
+	To              *JourneyStop  `json:"to,omitempty"`
+	Departure       time.Time     `json:"departure"`
+	Arrival         time.Time     `json:"arrival"`
+	DurationSeconds int           `json:"duration_seconds"`
+	DistanceMeters  float64       `json:"distance_meters,omitempty"`
+	RouteID         string        `json:"route_id,omitempty"`
+	RouteShortName  string        `json:"route_short_name,omitempty"`
+	Headsign        string        `json:"headsign,omitempty"`
+	TripID          string        `json:"trip_id,omitempty"`
+	Stops           []JourneyStop `json:"intermediate_stops,omitempty"`
+}
+
+// Journey es un itinerario Pareto-óptimo
+type Journey struct {
+	Departure       time.Time `json:"departure"`
+	Arrival         time.Time `json:"arrival"`
+	DurationSeconds int       `json:"duration_seconds"`
+	Transfers       int       `json:"transfers"`
+	WalkSeconds     int       `json:"walk_seconds"`
+	WalkMeters      float64   `json:"walk_meters"`
+	Legs            []Leg     `json:"legs"`
+}
+
+// ErrNoStopsNearby indica que no hay paradas caminables desde el origen o destino
+var ErrNoStopsNearby = errors.New("transit: no stops within walking distance")
+
+// Location es la zona horaria de los horarios GTFS (America/Santiago, o la
+// hora local si el sistema no la conoce)
+var Location = sync.OnceValue(func() *time.Location {
+	loc, err := time.LoadLocation("America/Santiago")
+	if err != nil {
+		log.Printf("⚠️ [TRANSIT] Zona horaria America/Santiago no disponible, usando hora local: %v", err)
+		return time.Local
+	}
+	return loc
+})
+
+// NewRouter crea un router sobre la base de datos GTFS
+func NewRouter(db *sql.DB) *Router {
+	return &Router{
+		db:       db,
+		location: Location(),
+		opts:     TimetableOptions{MaxTransferMeters: 250},
+		cache:    make(map[string]*cachedTimetable),
+		loading:  make(map[string]*timetableCall),
+	}
+}
+
+// Invalidate descarta los horarios en memoria (ej: después de un GTFS sync)
+func (r *Router) Invalidate() {
+	r.mu.Lock()
+	r.cache = make(map[string]*cachedTimetable)
+	r.loading = make(map[string]*timetableCall)
+	r.epoch++
+	r.mu.Unlock()
+}
+
+// Timetable retorna (cargando si es necesario) el horario de un día de
+// servicio. Las consultas simultáneas por un mismo día comparten la carga, que
+// corre fuera del lock y sin el contexto de quien la inició: cancelar una
+// consulta sólo deja de esperarla.
+func (r *Router) Timetable(ctx context.Context, serviceDate time.Time) (*Timetable, error) {
+	key := serviceDate.Format("2006-01-02")
+	r.checkGeneration(ctx)
+
+	r.mu.Lock()
+	if entry, ok := r.cache[key]; ok {
+		entry.usedAt = time.Now()
+		r.mu.Unlock()
+		return entry.timetable, nil
+	}
+	call, ok := r.loading[key]
+	if !ok {
+		call = &timetableCall{done: make(chan struct{})}
+		r.loading[key] = call
+		go r.load(key, serviceDate, r.epoch, call)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.timetable, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (r *Router) load(key string, serviceDate time.Time, epoch int64, call *timetableCall) {
+	ctx, cancel := context.WithTimeout(context.Background(), timetableLoadTimeout)
+	defer cancel()
+
+	call.timetable, call.err = LoadTimetable(ctx, r.db, serviceDate, r.opts)
+
+	r.mu.Lock()
+	if r.epoch == epoch {
+		delete(r.loading, key)
+		if call.err == nil {
+			r.storeLocked(key, call.timetable)
+		}
+	}
+	r.mu.Unlock()
+	close(call.done)
+}
+
+// storeLocked guarda un horario descartando el usado hace más tiempo si se
+// supera timetableCacheSize. Requiere r.mu tomado.
+func (r *Router) storeLocked(key string, tt *Timetable) {
+	for len(r.cache) >= timetableCacheSize {
+		oldest := ""
+		for k, entry := range r.cache {
+			if oldest == "" || entry.usedAt.Before(r.cache[oldest].usedAt) {
+				oldest = k
+			}
+		}
+		delete(r.cache, oldest)
+	}
+	r.cache[key] = &cachedTimetable{timetable: tt, usedAt: time.Now()}
+}
+
+// checkGeneration descarta el caché si cambió la generación GTFS activa: una
+// activación o rollback hecho desde el CLI no pasa por Invalidate. Consulta la
+// base a lo más cada generationCheckInterval.
+func (r *Router) checkGeneration(ctx context.Context) {
+	r.mu.Lock()
+	if time.Since(r.generationAt) < generationCheckInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.generationAt = time.Now()
+	r.mu.Unlock()
+
+	active, err := gtfs.ActiveGeneration(ctx, r.db)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	changed := active != r.generation
+	r.generation = active
+	r.mu.Unlock()
+	if changed {
+		r.Invalidate()
+	}
+}
+
+// ServiceDay retorna el origen de los horarios GTFS del día de servicio de t
+// (ver ServiceDayStart)
+func (r *Router) ServiceDay(t time.Time) time.Time {
+	return ServiceDayStart(t.In(r.location))
+}
+
+// ServiceDayStart retorna el origen de los horarios GTFS del día de date, en
+// su zona horaria: "mediodía menos 12h", como define GTFS. Coincide con la
+// medianoche salvo cuando el cambio de hora cae entre medianoche y mediodía.
+// Su fecha puede ser la del día anterior (en Santiago la medianoche del
+// cambio de hora de septiembre no existe), así que las fechas de servicio se
+// llevan al mediodía y sólo se pasan por aquí para sumar horas GTFS.
+func ServiceDayStart(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, date.Location()).Add(-12 * time.Hour)
+}
+
+// Plan calcula los viajes Pareto-óptimos (llegada, transbordos) entre dos coordenadas
+func (r *Router) Plan(ctx context.Context, req PlanRequest) ([]Journey, error) {
+	if req.MaxWalkMeters <= 0 {
+		req.MaxWalkMeters = 600
+	}
+	if req.MaxTransfers < 0 {
+		req.MaxTransfers = 0
+	}
+	if req.MaxTransfers > 5 {
+		req.MaxTransfers = 5
+	}
+	if req.Departure.IsZero() {
+		req.Departure = time.Now()
+	}
+
+	// Fechas de servicio al mediodía: no dependen del cambio de hora
+	local := req.Departure.In(r.location)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 12, 0, 0, 0, r.location)
+	dates := []time.Time{today}
+	// Viajes nocturnos del día anterior (horas GTFS > 24:00:00)
+	if local.Hour() < 4 {
+		dates = append(dates, today.AddDate(0, 0, -1))
+	}
+
+	var all []Journey
+	noStops := false
+	for _, date := range dates {
+		tt, err := r.Timetable(ctx, date)
+		if err != nil {
+			log.Printf("⚠️ [TRANSIT] Sin horario para %s: %v", date.Format("2006-01-02"), err)
+			continue
+		}
+		journeys, err := r.planOn(tt, ServiceDayStart(date), req)
+		if errors.Is(err, ErrNoStopsNearby) {
+			noStops = true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, journeys...)
+	}
+
+	// Caminata directa si el destino está cerca
+	if meters := haversineMeters(req.FromLat, req.FromLon, req.ToLat, req.ToLon); meters <= req.MaxWalkMeters {
+		secs := walkSeconds(meters)
+		all = append(all, Journey{
+			Departure:       req.Departure,
+			Arrival:         req.Departure.Add(time.Duration(secs) * time.Second),
+			DurationSeconds: secs,
+			WalkSeconds:     secs,
+			WalkMeters:      meters,
+			Legs: []Leg{{
+				Mode:            "walk",
+				Departure:       req.Departure,
+				Arrival:         req.Departure.Add(time.Duration(secs) * time.Second),
+				DurationSeconds: secs,
+				DistanceMeters:  meters,
+			}},
+		})
+	}
+
+	if len(all) == 0 && noStops {
+		return nil, ErrNoStopsNearby
+	}
+	return paretoFilter(all), nil
+}
+
+func (r *Router) planOn(tt *Timetable, day time.Time, req PlanRequest) ([]Journey, error) {
+	origins := tt.nearbyStops(req.FromLat, req.FromLon, req.MaxWalkMeters)
+	destinations := tt.nearbyStops(req.ToLat, req.ToLon, req.MaxWalkMeters)
+	if len(origins) == 0 || len(destinations) == 0 {
+		return nil, ErrNoStopsNearby
+	}
+
+	depSecs := int(req.Departure.Sub(day).Seconds())
+	raw := tt.Run(Query{
+		DepartureSecs:  depSecs,
+		Origins:        origins,
+		Destinations:   destinations,
+		MaxRounds:      req.MaxTransfers + 1,
+		MinTransferSec: 60,
+	})
+
+	journeys := make([]Journey, 0, len(raw))
+	for _, rj := range raw {
+		journeys = append(journeys, tt.toJourney(rj, day, req, origins))
+	}
+	return journeys, nil
+}
+
+// nearbyStops retorna las paradas servidas a distancia caminable de un punto
+func (t *Timetable) nearbyStops(lat, lon, maxMeters float64) []Access {
+	latDelta := maxMeters / 111000.0
+	lonDelta := maxMeters / (111000.0 * math.Cos(lat*math.Pi/180))
+
+	var out []Access
+	for i, s := range t.Stops {
+		if len(t.stopPatterns[i]) == 0 {
+			continue
+		}
+		if math.Abs(s.Lat-lat) > latDelta || math.Abs(s.Lon-lon) > lonDelta {
+			continue
+		}
+		if meters := haversineMeters(lat, lon, s.Lat, s.Lon); meters <= maxMeters {
+			out = append(out, Access{Stop: i, WalkSecs: walkSeconds(meters), Meters: meters})
+		}
+	}
+	return out
+}
+
+func (t *Timetable) journeyStop(idx int) *JourneyStop {
+	s := t.Stops[idx]
+	return &JourneyStop{StopID: s.ID, Code: s.Code, Name: s.Name, Lat: s.Lat, Lon: s.Lon}
+}
+
+func (t *Timetable) toJourney(rj rawJourney, day time.Time, req PlanRequest, origins []Access) Journey {
+	at := func(secs int) time.Time { return day.Add(time.Duration(secs) * time.Second) }
+	j := Journey{Transfers: rj.trips - 1}
+
+	// Acceso a pie hasta la primera parada de abordaje
+	var legs []Leg
+	if len(rj.legs) > 0 && !rj.legs[0].walk {
+		first := rj.legs[0]
+		p := &t.patterns[first.pattern]
+		boardStop := p.stops[first.boardPos]
+		for _, o := range origins {
+			if o.Stop == boardStop {
+				arrive := req.Departure.Add(time.Duration(o.WalkSecs) * time.Second)
+				legs = append(legs, Leg{
+					Mode:            "walk",
+					To:              t.journeyStop(boardStop),
+					Departure:       req.Departure,
+					Arrival:         arrive,
+					DurationSeconds: o.WalkSecs,
+					DistanceMeters:  o.Meters,
+				})
+				break
+			}
+		}
+	}
+
+	for _, rl := range rj.legs {
+		if rl.walk {
+			legs = append(legs, Leg{
+				Mode:            "walk",
+				From:            t.journeyStop(rl.fromStop),
+				To:              t.journeyStop(rl.toStop),
+				Departure:       at(rl.depSecs),
+				Arrival:         at(rl.arrSecs),
+				DurationSeconds: rl.arrSecs - rl.depSecs,
+				DistanceMeters:  rl.meters,
+			})
+			continue
+		}
+		p := &t.patterns[rl.pattern]
+		pt := p.trips[rl.trip]
+		trip := t.Trips[pt.trip]
+		leg := Leg{
+			Mode:            routeMode(trip.RouteType),
+			From:            t.journeyStop(p.stops[rl.boardPos]),
+			To:              t.journeyStop(p.stops[rl.alightPos]),
+			Departure:       at(pt.dep[rl.boardPos]),
+			Arrival:         at(pt.arr[rl.alightPos]),
+			DurationSeconds: pt.arr[rl.alightPos] - pt.dep[rl.boardPos],
+			RouteID:         trip.RouteID,
+			RouteShortName:  trip.RouteShortName,
+			Headsign:        trip.Headsign,
+			TripID:          trip.ID,
+		}
+		for pos := rl.boardPos + 1; pos < rl.alightPos; pos++ {
+			leg.Stops = append(leg.Stops, *t.journeyStop(p.stops[pos]))
+		}
+		legs = append(legs, leg)
+	}
+
+	// Egreso a pie hasta el destino
+	lastArrival := at(rj.arrival - rj.egress.WalkSecs)
+	legs = append(legs, Leg{
+		Mode:            "walk",
+		From:            t.journeyStop(rj.egress.Stop),
+		Departure:       lastArrival,
+		Arrival:         at(rj.arrival),
+		DurationSeconds: rj.egress.WalkSecs,
+		DistanceMeters:  rj.egress.Meters,
+	})
+
+	j.Legs = legs
+	j.Departure = req.Departure
+	j.Arrival = at(rj.arrival)
+	j.DurationSeconds = int(j.Arrival.Sub(j.Departure).Seconds())
+	for _, l := range legs {
+		if l.Mode == "walk" {
+			j.WalkSeconds += l.DurationSeconds
+			j.WalkMeters += l.DistanceMeters
+		}
+	}
+	return j
+}
+
+// routeMode traduce route_type GTFS a un modo legible
+func routeMode(routeType int) string {
+	switch routeType {
+	case 1:
+		return "metro"
+	case 2:
+		return "rail"
+	default:
+		return "bus"
+	}
+}
+
+// paretoFilter conserva sólo viajes no dominados en (llegada, transbordos)
+func paretoFilter(journeys []Journey) []Journey {
+	sort.SliceStable(journeys, func(i, j int) bool {
+		if journeys[i].Transfers != journeys[j].Transfers {
+			return journeys[i].Transfers < journeys[j].Transfers
+		}
+		return journeys[i].Arrival.Before(journeys[j].Arrival)
+	})
+
+	var out []Journey
+	for _, j := range journeys {
+		dominated := false
+		for _, kept := range out {
+			if !kept.Arrival.After(j.Arrival) && kept.Transfers <= j.Transfers {
+				dominated = true
+				break
+			}
+		}
+		if !dominated {
+			out = append(out, j)
+		}
+	}
+	return out
+}
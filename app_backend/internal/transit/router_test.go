@@ -0,0 +1,90 @@
+package transit
+
+import (
+	"testing"
+	"time"
+)
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("zona horaria %s no disponible: %v", name, err)
+	}
+	return loc
+}
+
+// Las horas GTFS se miden desde "mediodía menos 12h": 08:00:00 debe ser las
+// 08:00 locales también los días de cambio de hora
+func TestServiceDayStartAcrossDST(t *testing.T) {
+	tests := []struct {
+		name  string
+		zone  string
+		year  int
+		month time.Month
+		day   int
+	}{
+		// Santiago adelanta la hora a las 24:00 del sábado: la medianoche del
+		// domingo no existe
+		{"Santiago septiembre, sábado", "America/Santiago", 2024, time.September, 7},
+		{"Santiago septiembre, domingo", "America/Santiago", 2024, time.September, 8},
+		// y la atrasa a las 24:00 del sábado: las 23:00 del sábado se repiten
+		{"Santiago abril, sábado", "America/Santiago", 2024, time.April, 6},
+		{"Santiago abril, domingo", "America/Santiago", 2024, time.April, 7},
+		{"Santiago día normal", "America/Santiago", 2024, time.June, 12},
+		// Cambio entre medianoche y mediodía: la medianoche local no sirve de origen
+		{"Nueva York marzo", "America/New_York", 2024, time.March, 10},
+		{"Nueva York noviembre", "America/New_York", 2024, time.November, 3},
+	}
+	// Horas que existen una sola vez (o primero) en todos esos días
+	gtfsTimes := []struct {
+		secs       int
+		hour, minu int
+	}{
+		{8 * 3600, 8, 0},
+		{12 * 3600, 12, 0},
+		{23*3600 + 59*60, 23, 59},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := loadLocation(t, tt.zone)
+			noon := time.Date(tt.year, tt.month, tt.day, 12, 0, 0, 0, loc)
+			start := ServiceDayStart(noon)
+			for _, g := range gtfsTimes {
+				at := start.Add(time.Duration(g.secs) * time.Second).In(loc)
+				if at.Year() != tt.year || at.Month() != tt.month || at.Day() != tt.day ||
+					at.Hour() != g.hour || at.Minute() != g.minu {
+					t.Errorf("%02d:%02d GTFS = %s, want %d-%02d-%02d %02d:%02d",
+						g.hour, g.minu, at, tt.year, tt.month, tt.day, g.hour, g.minu)
+				}
+			}
+		})
+	}
+}
+
+// ServiceDay toma cualquier hora del día y la lleva a la zona horaria GTFS
+func TestRouterServiceDay(t *testing.T) {
+	loc := loadLocation(t, "America/Santiago")
+	r := &Router{location: loc}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{"domingo de septiembre", time.Date(2024, time.September, 8, 9, 15, 0, 0, loc),
+			time.Date(2024, time.September, 8, 8, 0, 0, 0, loc)},
+		{"domingo de abril", time.Date(2024, time.April, 7, 9, 15, 0, 0, loc),
+			time.Date(2024, time.April, 7, 8, 0, 0, 0, loc)},
+		{"en UTC", time.Date(2024, time.September, 8, 13, 15, 0, 0, time.UTC),
+			time.Date(2024, time.September, 8, 8, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.ServiceDay(tt.t).Add(8 * time.Hour)
+			if !got.Equal(tt.want) {
+				t.Errorf("ServiceDay(%s) + 08:00 = %s, want %s", tt.t, got.In(loc), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package transit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ScheduledDeparture es una pasada programada de un viaje por una parada
+type ScheduledDeparture struct {
+	TripID         string
+	RouteID        string
+	RouteShortName string
+	Headsign       string
+	ServiceID      string
+	// Secs es la hora de llegada a la parada en segundos desde medianoche del
+	// día de servicio; puede exceder 24h (viajes después de medianoche)
+	Secs int
+}
+
+// StopSchedule son todas las pasadas programadas por una parada, de todos
+// los service_id. On filtra las de un día de servicio. A diferencia de
+// LoadTimetable sólo lee los viajes que pasan por la parada.
+type StopSchedule struct {
+	StopID     string
+	StopCode   string
+	StopName   string
+	departures []ScheduledDeparture // ordenadas por Secs
+}
+
+// LoadStopSchedule lee el horario de una parada por stop_id o código (ej:
+// "PA433"), expandiendo los viajes por frecuencia e interpolando las paradas
+// sin horario. ErrNoRows si la parada no existe.
+func LoadStopSchedule(ctx context.Context, db *sql.DB, stop string) (*StopSchedule, error) {
+	schedule := &StopSchedule{}
+	err := db.QueryRowContext(ctx, `
+		SELECT stop_id, COALESCE(code, ''), name FROM gtfs_stops
+		WHERE stop_id = ? OR code = ?
+		ORDER BY stop_id = ? DESC
+		LIMIT 1
+	`, stop, stop, stop).Scan(&schedule.StopID, &schedule.StopCode, &schedule.StopName)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT st.trip_id, t.route_id, COALESCE(t.service_id, ''), COALESCE(t.headsign, ''), COALESCE(r.short_name, '')
+		FROM gtfs_stop_times st
+		JOIN gtfs_trips t ON t.trip_id = st.trip_id
+		JOIN gtfs_routes r ON r.route_id = t.route_id
+		WHERE st.stop_id = ?
+	`, schedule.StopID)
+	if err != nil {
+		return nil, fmt.Errorf("transit: query stop trips: %w", err)
+	}
+	trips := make(map[string]ScheduledDeparture)
+	for rows.Next() {
+		var d ScheduledDeparture
+		if err := rows.Scan(&d.TripID, &d.RouteID, &d.ServiceID, &d.Headsign, &d.RouteShortName); err != nil {
+			continue
+		}
+		trips[d.TripID] = d
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(trips) == 0 {
+		return schedule, nil
+	}
+
+	tripIDs := make([]string, 0, len(trips))
+	for id := range trips {
+		tripIDs = append(tripIDs, id)
+	}
+	sort.Strings(tripIDs)
+
+	// Los horarios completos de cada viaje: para interpolar y para ubicar la
+	// parada respecto de la primera salida en los viajes por frecuencia
+	stopTimes, err := loadTripStopTimes(ctx, db, tripIDs)
+	if err != nil {
+		return nil, err
+	}
+	frequencies, err := loadFrequencies(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tripID := range tripIDs {
+		sts := stopTimes[tripID]
+		if len(sts) < 2 || !fillTimes(sts) {
+			continue
+		}
+		at := -1
+		for i, st := range sts {
+			if st.stopID == schedule.StopID {
+				at = i
+				break
+			}
+		}
+		if at < 0 {
+			continue
+		}
+
+		departure := trips[tripID]
+		if freqs, ok := frequencies[tripID]; ok {
+			offset := sts[at].arr - sts[0].dep
+			for _, f := range freqs {
+				for startAt := f.start; startAt < f.end; startAt += f.headway {
+					instance := departure
+					instance.TripID = tripID + "@" + FormatGTFSTime(startAt)
+					instance.Secs = startAt + offset
+					schedule.departures = append(schedule.departures, instance)
+				}
+			}
+			continue
+		}
+		departure.Secs = sts[at].arr
+		schedule.departures = append(schedule.departures, departure)
+	}
+
+	sort.SliceStable(schedule.departures, func(i, j int) bool {
+		return schedule.departures[i].Secs < schedule.departures[j].Secs
+	})
+	return schedule, nil
+}
+
+// On retorna las pasadas de los servicios activos (ver ActiveServices),
+// ordenadas por hora
+func (s *StopSchedule) On(services map[string]bool) []ScheduledDeparture {
+	departures := []ScheduledDeparture{}
+	for _, d := range s.departures {
+		if services[d.ServiceID] {
+			departures = append(departures, d)
+		}
+	}
+	return departures
+}
+
+// UpcomingDeparture es una pasada programada con su hora absoluta
+type UpcomingDeparture struct {
+	ScheduledDeparture
+	At time.Time
+}
+
+// Upcoming retorna las pasadas entre now y now+window, ordenadas por hora.
+// Considera el día de servicio anterior (sus viajes después de medianoche
+// tienen Secs >= 24h) y los siguientes que alcance la ventana. services
+// resuelve los servicios activos de un día (ver ActiveServices) y recibe el
+// mediodía de la fecha; los días se toman en la zona horaria de now.
+func (s *StopSchedule) Upcoming(now time.Time, window time.Duration, services func(day time.Time) (map[string]bool, error)) ([]UpcomingDeparture, error) {
+	loc := now.Location()
+	end := now.Add(window)
+	upcoming := []UpcomingDeparture{}
+
+	// Fechas al mediodía: no dependen del cambio de hora (ver ServiceDayStart)
+	first := now.AddDate(0, 0, -1)
+	date := time.Date(first.Year(), first.Month(), first.Day(), 12, 0, 0, 0, loc)
+	for ; !ServiceDayStart(date).After(end); date = date.AddDate(0, 0, 1) {
+		active, err := services(date)
+		if err != nil {
+			return nil, err
+		}
+		start := ServiceDayStart(date)
+		for _, d := range s.On(active) {
+			// Horas GTFS desde el inicio del día de servicio, como en el router
+			at := start.Add(time.Duration(d.Secs) * time.Second)
+			if at.Before(now) || at.After(end) {
+				continue
+			}
+			upcoming = append(upcoming, UpcomingDeparture{ScheduledDeparture: d, At: at})
+		}
+	}
+
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		return upcoming[i].At.Before(upcoming[j].At)
+	})
+	return upcoming, nil
+}
+
+func loadTripStopTimes(ctx context.Context, db *sql.DB, tripIDs []string) (map[string][]rawStopTime, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(tripIDs)), ",")
+	args := make([]interface{}, len(tripIDs))
+	for i, id := range tripIDs {
+		args[i] = id
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT trip_id, stop_id, COALESCE(arrival_time, ''), COALESCE(departure_time, '')
+		FROM gtfs_stop_times
+		WHERE trip_id IN (`+placeholders+`)
+		ORDER BY trip_id, stop_sequence
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("transit: query trip stop_times: %w", err)
+	}
+	defer rows.Close()
+
+	stopTimes := make(map[string][]rawStopTime)
+	for rows.Next() {
+		var tripID, stopID, arrStr, depStr string
+		if err := rows.Scan(&tripID, &stopID, &arrStr, &depStr); err != nil {
+			continue
+		}
+		st := rawStopTime{stopID: stopID}
+		st.arr, st.hasArr = ParseGTFSTime(arrStr)
+		st.dep, st.hasDep = ParseGTFSTime(depStr)
+		stopTimes[tripID] = append(stopTimes[tripID], st)
+	}
+	return stopTimes, rows.Err()
+}
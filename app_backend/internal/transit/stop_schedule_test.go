@@ -0,0 +1,138 @@
+package transit
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStopScheduleUpcoming(t *testing.T) {
+	loc := Location()
+	gtfs := func(hhmm string) int {
+		secs, ok := ParseGTFSTime(hhmm + ":00")
+		if !ok {
+			t.Fatalf("hora GTFS inválida %q", hhmm)
+		}
+		return secs
+	}
+	schedule := &StopSchedule{StopCode: "PA433", departures: []ScheduledDeparture{
+		{TripID: "lab-0020", ServiceID: "L", Secs: gtfs("00:20")},
+		{TripID: "lab-0050", ServiceID: "L", Secs: gtfs("00:50")},
+		{TripID: "sab-0055", ServiceID: "S", Secs: gtfs("00:55")},
+		{TripID: "dom-1030", ServiceID: "D", Secs: gtfs("10:30")},
+		{TripID: "sab-2350", ServiceID: "S", Secs: gtfs("23:50")},
+		{TripID: "lab-2350", ServiceID: "L", Secs: gtfs("23:50")},
+		// Viajes del día de servicio anterior que pasan después de medianoche
+		{TripID: "lab-2440", ServiceID: "L", Secs: gtfs("24:40")},
+		{TripID: "lab-2510", ServiceID: "L", Secs: gtfs("25:10")},
+		{TripID: "dom-2530", ServiceID: "D", Secs: gtfs("25:30")},
+	}}
+	// L de lunes a viernes, S sábado y D domingo
+	services := func(day time.Time) (map[string]bool, error) {
+		switch day.Weekday() {
+		case time.Saturday:
+			return map[string]bool{"S": true}, nil
+		case time.Sunday:
+			return map[string]bool{"D": true}, nil
+		}
+		return map[string]bool{"L": true}, nil
+	}
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		window time.Duration
+		want   []string
+	}{
+		{
+			name:   "madrugada: viajes de ayer pasadas las 24:00 y de hoy",
+			now:    time.Date(2026, 3, 10, 0, 30, 0, 0, loc), // martes
+			window: time.Hour,
+			want:   []string{"lab-2440 00:40", "lab-0050 00:50", "lab-2510 01:10"},
+		},
+		{
+			name:   "la ventana cruza la medianoche",
+			now:    time.Date(2026, 3, 9, 23, 30, 0, 0, loc), // lunes
+			window: 75 * time.Minute,
+			want:   []string{"lab-2350 23:50", "lab-0020 00:20", "lab-2440 00:40"},
+		},
+		{
+			name:   "sábado de madrugada sigue el servicio del viernes",
+			now:    time.Date(2026, 3, 14, 0, 45, 0, 0, loc),
+			window: 30 * time.Minute,
+			want:   []string{"sab-0055 00:55", "lab-2510 01:10"},
+		},
+		{
+			// El 25:10 es del servicio de lunes a viernes: el domingo no corre
+			name:   "lunes de madrugada sigue el servicio del domingo",
+			now:    time.Date(2026, 3, 16, 1, 0, 0, 0, loc),
+			window: time.Hour,
+			want:   []string{"dom-2530 01:30"},
+		},
+		{
+			name:   "los límites de la ventana se incluyen",
+			now:    time.Date(2026, 3, 10, 0, 20, 0, 0, loc),
+			window: 20 * time.Minute,
+			want:   []string{"lab-0020 00:20", "lab-2440 00:40"},
+		},
+		{
+			// Santiago adelanta la hora a las 24:00 del sábado 5: la
+			// medianoche del domingo no existe, pero el día sigue siendo domingo
+			name:   "domingo del cambio de hora de septiembre",
+			now:    time.Date(2026, 9, 6, 10, 0, 0, 0, loc),
+			window: time.Hour,
+			want:   []string{"dom-1030 10:30"},
+		},
+		{
+			// y la atrasa a las 24:00 del sábado 4 de abril: 23:00-24:00 se repite
+			name:   "sábado del cambio de hora de abril",
+			now:    time.Date(2026, 4, 4, 23, 30, 0, 0, loc),
+			window: 30 * time.Minute,
+			want:   []string{"sab-2350 23:50"},
+		},
+		{
+			name:   "domingo del cambio de hora de abril",
+			now:    time.Date(2026, 4, 5, 10, 0, 0, 0, loc),
+			window: time.Hour,
+			want:   []string{"dom-1030 10:30"},
+		},
+		{
+			name:   "sin pasadas en la ventana",
+			now:    time.Date(2026, 3, 10, 12, 0, 0, 0, loc),
+			window: time.Hour,
+			want:   []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upcoming, err := schedule.Upcoming(tt.now, tt.window, services)
+			if err != nil {
+				t.Fatalf("Upcoming: %v", err)
+			}
+			got := []string{}
+			for _, d := range upcoming {
+				got = append(got, d.TripID+" "+d.At.Format("15:04"))
+				if d.At.Location() != loc {
+					t.Errorf("%s en zona %s, want %s", d.TripID, d.At.Location(), loc)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pasadas %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStopScheduleUpcomingServicesError(t *testing.T) {
+	schedule := &StopSchedule{departures: []ScheduledDeparture{{TripID: "t1", ServiceID: "L", Secs: 3600}}}
+	failure := errors.New("calendar unavailable")
+
+	_, err := schedule.Upcoming(time.Now(), time.Hour, func(time.Time) (map[string]bool, error) {
+		return nil, failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("error %v, want %v", err, failure)
+	}
+}
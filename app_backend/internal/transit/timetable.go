@@ -0,0 +1,486 @@
+// ============================================================================
+// TRANSIT TIMETABLE - WayFindCL
+// ============================================================================
+// Horario de un día de servicio construido desde las tablas GTFS locales
+// (gtfs_stops, gtfs_trips, gtfs_stop_times, gtfs_calendar*, gtfs_frequencies).
+// Es la estructura de datos sobre la que corre el router RAPTOR.
+// ============================================================================
+
+package transit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yourorg/wayfindcl/internal/gtfs"
+)
+
+// Velocidad de caminata para personas con discapacidad visual (igual que geometry)
+const walkingSpeedMps = 0.85
+
+// Stop es una parada del horario
+type Stop struct {
+	ID   string  `json:"stop_id"`
+	Code string  `json:"code,omitempty"`
+	Name string  `json:"name"`
+	Lat  float64 `json:"lat"`
+	Lon  float64 `json:"lon"`
+}
+
+// Trip es una instancia de viaje (los viajes por frecuencia se expanden en varias)
+type Trip struct {
+	ID             string `json:"trip_id"`
+	RouteID        string `json:"route_id"`
+	RouteShortName string `json:"route_short_name"`
+	RouteType      int    `json:"route_type"`
+	Headsign       string `json:"headsign,omitempty"`
+}
+
+// pattern agrupa viajes que recorren exactamente la misma secuencia de paradas
+type pattern struct {
+	stops []int
+	trips []patternTrip // ordenados por hora de salida
+}
+
+type patternTrip struct {
+	trip int
+	arr  []int // segundos desde medianoche del día de servicio
+	dep  []int
+}
+
+type patternRef struct {
+	pattern int
+	pos     int
+}
+
+type footpath struct {
+	to       int
+	walkSecs int
+	meters   float64
+}
+
+// Timetable contiene el horario de un día de servicio listo para RAPTOR
+type Timetable struct {
+	ServiceDate  time.Time
+	Stops        []Stop
+	Trips        []Trip
+	stopIndex    map[string]int
+	patterns     []pattern
+	stopPatterns [][]patternRef
+	footpaths    [][]footpath
+}
+
+// TimetableOptions controla la construcción del horario
+type TimetableOptions struct {
+	MaxTransferMeters float64 // Radio para transbordos a pie entre paradas
+}
+
+// StopIndex retorna el índice interno de una parada por stop_id
+func (t *Timetable) StopIndex(stopID string) (int, bool) {
+	idx, ok := t.stopIndex[stopID]
+	return idx, ok
+}
+
+// LoadTimetable construye el horario para la fecha de servicio indicada
+func LoadTimetable(ctx context.Context, db *sql.DB, serviceDate time.Time, opts TimetableOptions) (*Timetable, error) {
+	if opts.MaxTransferMeters <= 0 {
+		opts.MaxTransferMeters = 250
+	}
+	start := time.Now()
+
+	services, err := ActiveServices(ctx, db, serviceDate)
+	if err != nil {
+		return nil, err
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("transit: no active services on %s", serviceDate.Format("2006-01-02"))
+	}
+
+	tt := &Timetable{
+		ServiceDate: serviceDate,
+		stopIndex:   make(map[string]int),
+	}
+	if err := tt.loadStops(ctx, db); err != nil {
+		return nil, err
+	}
+
+	trips, err := loadTrips(ctx, db, services)
+	if err != nil {
+		return nil, err
+	}
+	stopTimes, err := loadStopTimes(ctx, db, services)
+	if err != nil {
+		return nil, err
+	}
+	frequencies, err := loadFrequencies(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	tt.buildPatterns(trips, stopTimes, frequencies)
+	tt.buildFootpaths(opts.MaxTransferMeters)
+
+	log.Printf("🚏 [TRANSIT] Horario %s: %d paradas, %d viajes, %d patrones (%.1fs)",
+		serviceDate.Format("2006-01-02"), len(tt.Stops), len(tt.Trips), len(tt.patterns), time.Since(start).Seconds())
+	return tt, nil
+}
+
+// ActiveServices retorna los service_id vigentes en una fecha según
+// gtfs_calendar (día de la semana + rango) y las excepciones de gtfs_calendar_dates
+func ActiveServices(ctx context.Context, db *sql.DB, date time.Time) (map[string]bool, error) {
+	day := date.Format("2006-01-02")
+	weekday := strings.ToLower(date.Weekday().String())
+
+	services := make(map[string]bool)
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT service_id FROM gtfs_calendar
+		WHERE %s = 1 AND start_date <= ? AND end_date >= ?
+	`, weekday), day, day)
+	if err != nil {
+		return nil, fmt.Errorf("transit: query calendar: %w", err)
+	}
+	for rows.Next() {
+		var serviceID string
+		if err := rows.Scan(&serviceID); err == nil {
+			services[serviceID] = true
+		}
+	}
+	rows.Close()
+
+	rows, err = db.QueryContext(ctx, `SELECT service_id, exception_type FROM gtfs_calendar_dates WHERE date = ?`, day)
+	if err != nil {
+		return nil, fmt.Errorf("transit: query calendar_dates: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var serviceID string
+		var exceptionType int
+		if err := rows.Scan(&serviceID, &exceptionType); err != nil {
+			continue
+		}
+		switch exceptionType {
+		case 1:
+			services[serviceID] = true
+		case 2:
+			delete(services, serviceID)
+		}
+	}
+	return services, rows.Err()
+}
+
+// ParseGTFSTime convierte "HH:MM:SS" a segundos desde medianoche.
+// Acepta horas >= 24 (viajes que continúan después de medianoche). Usa el mismo
+// parser que el validador de feeds para que ambos acepten exactamente lo mismo.
+func ParseGTFSTime(value string) (int, bool) {
+	return gtfs.ParseTime(value)
+}
+
+// FormatGTFSTime convierte segundos a "HH:MM:SS" (puede exceder 24:00:00)
+func FormatGTFSTime(secs int) string {
+	return fmt.Sprintf("%02d:%02d:%02d", secs/3600, (secs%3600)/60, secs%60)
+}
+
+func (t *Timetable) loadStops(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `SELECT stop_id, COALESCE(code, ''), name, latitude, longitude FROM gtfs_stops`)
+	if err != nil {
+		return fmt.Errorf("transit: query stops: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s Stop
+		if err := rows.Scan(&s.ID, &s.Code, &s.Name, &s.Lat, &s.Lon); err != nil {
+			continue
+		}
+		t.stopIndex[s.ID] = len(t.Stops)
+		t.Stops = append(t.Stops, s)
+	}
+	return rows.Err()
+}
+
+func loadTrips(ctx context.Context, db *sql.DB, services map[string]bool) (map[string]Trip, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT t.trip_id, t.route_id, COALESCE(t.service_id, ''), COALESCE(t.headsign, ''),
+			COALESCE(r.short_name, ''), COALESCE(r.type, 3)
+		FROM gtfs_trips t
+		JOIN gtfs_routes r ON r.route_id = t.route_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("transit: query trips: %w", err)
+	}
+	defer rows.Close()
+
+	trips := make(map[string]Trip)
+	for rows.Next() {
+		var trip Trip
+		var serviceID string
+		if err := rows.Scan(&trip.ID, &trip.RouteID, &serviceID, &trip.Headsign, &trip.RouteShortName, &trip.RouteType); err != nil {
+			continue
+		}
+		if services[serviceID] {
+			trips[trip.ID] = trip
+		}
+	}
+	return trips, rows.Err()
+}
+
+type rawStopTime struct {
+	stopID string
+	arr    int
+	dep    int
+	hasArr bool
+	hasDep bool
+}
+
+func loadStopTimes(ctx context.Context, db *sql.DB, services map[string]bool) (map[string][]rawStopTime, error) {
+	ids := make([]string, 0, len(services))
+	for id := range services {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT st.trip_id, st.stop_id, COALESCE(st.arrival_time, ''), COALESCE(st.departure_time, '')
+		FROM gtfs_stop_times st
+		JOIN gtfs_trips t ON t.trip_id = st.trip_id
+		WHERE t.service_id IN (`+placeholders+`)
+		ORDER BY st.trip_id, st.stop_sequence
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("transit: query stop_times: %w", err)
+	}
+	defer rows.Close()
+
+	stopTimes := make(map[string][]rawStopTime)
+	for rows.Next() {
+		var tripID, stopID, arrStr, depStr string
+		if err := rows.Scan(&tripID, &stopID, &arrStr, &depStr); err != nil {
+			continue
+		}
+		st := rawStopTime{stopID: stopID}
+		st.arr, st.hasArr = ParseGTFSTime(arrStr)
+		st.dep, st.hasDep = ParseGTFSTime(depStr)
+		stopTimes[tripID] = append(stopTimes[tripID], st)
+	}
+	return stopTimes, rows.Err()
+}
+
+type frequency struct {
+	start   int
+	end     int
+	headway int
+}
+
+func loadFrequencies(ctx context.Context, db *sql.DB) (map[string][]frequency, error) {
+	rows, err := db.QueryContext(ctx, `SELECT trip_id, start_time, end_time, headway_secs FROM gtfs_frequencies`)
+	if err != nil {
+		return nil, fmt.Errorf("transit: query frequencies: %w", err)
+	}
+	defer rows.Close()
+
+	freqs := make(map[string][]frequency)
+	for rows.Next() {
+		var tripID, startStr, endStr string
+		var headway int
+		if err := rows.Scan(&tripID, &startStr, &endStr, &headway); err != nil {
+			continue
+		}
+		start, okStart := ParseGTFSTime(startStr)
+		end, okEnd := ParseGTFSTime(endStr)
+		if !okStart || !okEnd || headway <= 0 || end <= start {
+			continue
+		}
+		freqs[tripID] = append(freqs[tripID], frequency{start: start, end: end, headway: headway})
+	}
+	return freqs, rows.Err()
+}
+
+// fillTimes completa horarios faltantes (paradas sin timepoint) por interpolación lineal
+func fillTimes(sts []rawStopTime) bool {
+	for i := range sts {
+		if !sts[i].hasArr && sts[i].hasDep {
+			sts[i].arr, sts[i].hasArr = sts[i].dep, true
+		}
+		if !sts[i].hasDep && sts[i].hasArr {
+			sts[i].dep, sts[i].hasDep = sts[i].arr, true
+		}
+	}
+	if len(sts) == 0 || !sts[0].hasDep || !sts[len(sts)-1].hasArr {
+		return false
+	}
+	last := 0
+	for i := 1; i < len(sts); i++ {
+		if !sts[i].hasArr {
+			continue
+		}
+		if gap := i - last; gap > 1 {
+			step := float64(sts[i].arr-sts[last].dep) / float64(gap)
+			for j := last + 1; j < i; j++ {
+				v := sts[last].dep + int(math.Round(step*float64(j-last)))
+				sts[j].arr, sts[j].dep = v, v
+				sts[j].hasArr, sts[j].hasDep = true, true
+			}
+		}
+		last = i
+	}
+	return true
+}
+
+func (t *Timetable) buildPatterns(trips map[string]Trip, stopTimes map[string][]rawStopTime, frequencies map[string][]frequency) {
+	patternByKey := make(map[string]int)
+
+	tripIDs := make([]string, 0, len(stopTimes))
+	for id := range stopTimes {
+		tripIDs = append(tripIDs, id)
+	}
+	sort.Strings(tripIDs) // orden determinístico
+
+	for _, tripID := range tripIDs {
+		trip, ok := trips[tripID]
+		if !ok {
+			continue
+		}
+		sts := stopTimes[tripID]
+		if len(sts) < 2 || !fillTimes(sts) {
+			continue
+		}
+
+		stops := make([]int, 0, len(sts))
+		arr := make([]int, 0, len(sts))
+		dep := make([]int, 0, len(sts))
+		keyParts := make([]string, 0, len(sts))
+		valid := true
+		for _, st := range sts {
+			idx, ok := t.stopIndex[st.stopID]
+			if !ok {
+				valid = false
+				break
+			}
+			stops = append(stops, idx)
+			arr = append(arr, st.arr)
+			dep = append(dep, st.dep)
+			keyParts = append(keyParts, strconv.Itoa(idx))
+		}
+		if !valid {
+			continue
+		}
+
+		key := strings.Join(keyParts, ",")
+		pIdx, ok := patternByKey[key]
+		if !ok {
+			pIdx = len(t.patterns)
+			patternByKey[key] = pIdx
+			t.patterns = append(t.patterns, pattern{stops: stops})
+		}
+
+		// Viajes por frecuencia: el horario del viaje es una plantilla relativa a su primera salida
+		if freqs, ok := frequencies[tripID]; ok {
+			base := dep[0]
+			for _, f := range freqs {
+				for startAt := f.start; startAt < f.end; startAt += f.headway {
+					offset := startAt - base
+					instance := trip
+					instance.ID = tripID + "@" + FormatGTFSTime(startAt)
+					t.addPatternTrip(pIdx, instance, shift(arr, offset), shift(dep, offset))
+				}
+			}
+			continue
+		}
+
+		t.addPatternTrip(pIdx, trip, arr, dep)
+	}
+
+	t.stopPatterns = make([][]patternRef, len(t.Stops))
+	for pIdx := range t.patterns {
+		p := &t.patterns[pIdx]
+		sort.SliceStable(p.trips, func(i, j int) bool { return p.trips[i].dep[0] < p.trips[j].dep[0] })
+		for pos, stop := range p.stops {
+			t.stopPatterns[stop] = append(t.stopPatterns[stop], patternRef{pattern: pIdx, pos: pos})
+		}
+	}
+}
+
+func (t *Timetable) addPatternTrip(pIdx int, trip Trip, arr, dep []int) {
+	tripIdx := len(t.Trips)
+	t.Trips = append(t.Trips, trip)
+	t.patterns[pIdx].trips = append(t.patterns[pIdx].trips, patternTrip{trip: tripIdx, arr: arr, dep: dep})
+}
+
+func shift(values []int, offset int) []int {
+	out := make([]int, len(values))
+	for i, v := range values {
+		out[i] = v + offset
+	}
+	return out
+}
+
+// buildFootpaths calcula transbordos a pie entre paradas cercanas usando una grilla espacial
+func (t *Timetable) buildFootpaths(maxMeters float64) {
+	t.footpaths = make([][]footpath, len(t.Stops))
+	cellDeg := maxMeters / 111000.0
+	if cellDeg <= 0 {
+		return
+	}
+
+	type cell struct{ x, y int }
+	grid := make(map[cell][]int)
+	cellOf := func(s Stop) cell {
+		return cell{int(math.Floor(s.Lon / cellDeg)), int(math.Floor(s.Lat / cellDeg))}
+	}
+	for i, s := range t.Stops {
+		c := cellOf(s)
+		grid[c] = append(grid[c], i)
+	}
+
+	for i, s := range t.Stops {
+		if len(t.stopPatterns[i]) == 0 {
+			continue
+		}
+		c := cellOf(s)
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				for _, j := range grid[cell{c.x + dx, c.y + dy}] {
+					if j == i || len(t.stopPatterns[j]) == 0 {
+						continue
+					}
+					meters := haversineMeters(s.Lat, s.Lon, t.Stops[j].Lat, t.Stops[j].Lon)
+					if meters <= maxMeters {
+						t.footpaths[i] = append(t.footpaths[i], footpath{
+							to:       j,
+							walkSecs: walkSeconds(meters),
+							meters:   meters,
+						})
+					}
+				}
+			}
+		}
+	}
+}
+
+func walkSeconds(meters float64) int {
+	return int(math.Ceil(meters / walkingSpeedMps))
+}
+
+// haversineMeters calcula la distancia en metros entre dos coordenadas
+func haversineMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371000.0
+	dLat := (lat2 - lat1) * math.Pi / 180.0
+	dLon := (lon2 - lon1) * math.Pi / 180.0
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180.0)*math.Cos(lat2*math.Pi/180.0)*
+			math.Sin(dLon/2)*math.Sin(dLon/2)
+	return earthRadius * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
@@ -0,0 +1,15 @@
+package validation
+
+import "unicode/utf8"
+
+// Truncate recorta s a lo más max bytes sin partir un carácter multibyte:
+// MariaDB con utf8mb4 en modo estricto rechaza un UTF-8 cortado a la mitad
+func Truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
@@ -0,0 +1,35 @@
+package validation
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		max  int
+		want string
+	}{
+		{"más corto", "Pixel 8", 20, "Pixel 8"},
+		{"exacto", "Pixel", 5, "Pixel"},
+		{"ascii", "Pixel 8 Pro", 5, "Pixel"},
+		// "ñ" ocupa 2 bytes: cortar en el byte 4 lo partiría
+		{"no parte un acento", "Peñalolén", 3, "Pe"},
+		{"corta después del acento", "Peñalolén", 4, "Peñ"},
+		{"emoji de 4 bytes", "bus 🚌", 6, "bus "},
+		{"cero", "Pixel", 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Truncate(tt.in, tt.max)
+			if got != tt.want {
+				t.Errorf("Truncate(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("Truncate(%q, %d) = %q no es UTF-8 válido", tt.in, tt.max, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Sesión del dashboard: el backend exige un usuario con rol admin para
+// /api/stats/* y para el handshake de /ws/debug
+export const API_URL = 'http://localhost:8080';
+const STORAGE_KEY = 'wayfindcl.dashboard.session';
+
+interface Session {
+  token: string;
+  expiresAt: number; // ms epoch del access token
+  refreshToken: string;
+  username: string;
+  role: string;
+}
+
+function loadSession(): Session | null {
+  try {
+    const raw = localStorage.getItem(STORAGE_KEY);
+    return raw ? (JSON.parse(raw) as Session) : null;
+  } catch {
+    return null;
+  }
+}
+
+export const authStore = $state<{ session: Session | null; error: string }>({
+  session: loadSession(),
+  error: '',
+});
+
+function saveSession(session: Session | null) {
+  authStore.session = session;
+  if (session) {
+    localStorage.setItem(STORAGE_KEY, JSON.stringify(session));
+  } else {
+    localStorage.removeItem(STORAGE_KEY);
+  }
+}
+
+function sessionFrom(data: any, username: string, role: string): Session {
+  return {
+    token: data.token,
+    expiresAt: new Date(data.expires_at).getTime(),
+    refreshToken: data.refresh_token,
+    username,
+    role,
+  };
+}
+
+// Inicia sesión con username/password; sólo acepta cuentas con rol admin
+export async function login(username: string, password: string): Promise<boolean> {
+  authStore.error = '';
+  try {
+    const response = await fetch(`${API_URL}/api/login`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ username, password, device_info: 'wayfindcl-dashboard' }),
+    });
+    const data = await response.json();
+    if (!response.ok) {
+      authStore.error = data.error === 'invalid credentials' ? 'Usuario o contraseña incorrectos' : data.error || 'No se pudo iniciar sesión';
+      return false;
+    }
+    if (data.user?.role !== 'admin') {
+      authStore.error = 'La cuenta no tiene rol admin (cli users role --role admin)';
+      return false;
+    }
+    saveSession(sessionFrom(data, data.user.username, data.user.role));
+    return true;
+  } catch (error) {
+    authStore.error = 'No se pudo conectar con el backend';
+    return false;
+  }
+}
+
+export async function logout() {
+  const session = authStore.session;
+  saveSession(null);
+  if (!session) return;
+  try {
+    await fetch(`${API_URL}/api/auth/logout`, {
+      method: 'POST',
+      headers: { Authorization: `Bearer ${session.token}` },
+    });
+  } catch {
+    // La sesión local ya se descartó
+  }
+}
+
+let refreshing: Promise<boolean> | null = null;
+
+// Renueva el access token con el refresh token (una sola renovación a la vez)
+async function refresh(): Promise<boolean> {
+  const session = authStore.session;
+  if (!session) return false;
+  refreshing ??= (async () => {
+    try {
+      const response = await fetch(`${API_URL}/api/auth/refresh`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refresh_token: session.refreshToken }),
+      });
+      if (!response.ok) {
+        saveSession(null);
+        return false;
+      }
+      saveSession(sessionFrom(await response.json(), session.username, session.role));
+      return true;
+    } catch {
+      return false;
+    } finally {
+      refreshing = null;
+    }
+  })();
+  return refreshing;
+}
+
+// Token vigente (renovado si vence en menos de un minuto), o null si no hay sesión
+export async function accessToken(): Promise<string | null> {
+  const session = authStore.session;
+  if (!session) return null;
+  if (session.expiresAt - Date.now() < 60_000 && !(await refresh())) {
+    return null;
+  }
+  return authStore.session?.token ?? null;
+}
+
+// fetch autenticado contra el backend (path relativo, ej: /api/stats/metrics).
+// Un 401 intenta renovar el token una vez; un 403 cierra la sesión.
+export async function apiFetch(path: string, init: RequestInit = {}): Promise<Response> {
+  const send = (token: string | null) => {
+    const headers = new Headers(init.headers);
+    if (token) headers.set('Authorization', `Bearer ${token}`);
+    return fetch(`${API_URL}${path}`, { ...init, headers });
+  };
+
+  let response = await send(await accessToken());
+  if (response.status === 401 && (await refresh())) {
+    response = await send(authStore.session?.token ?? null);
+  }
+  if (response.status === 401 || response.status === 403) {
+    authStore.error = response.status === 403 ? 'La cuenta ya no tiene rol admin' : 'La sesión expiró';
+    saveSession(null);
+  }
+  return response;
+}
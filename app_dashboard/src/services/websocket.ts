@@ -1,4 +1,5 @@
 import { addLog, apiStatusStore, metricsStore, scrapingStatusStore } from '../stores/index.svelte';
+import { accessToken, authStore } from './auth.svelte';
 
 const WS_URL = 'ws://localhost:8080/ws/debug';
 const STATUS_URL = 'http://localhost:8080/api/status';
@@ -6,6 +7,8 @@ let ws: WebSocket | null = null;
 let reconnectAttempts = 0;
 let mockDataInterval: number | null = null;
 let statusInterval: number | null = null;
+// El backend reenvía su historial al conectar; al reconectar se omite para no duplicar logs
+let replayReceived = false;
 
 // Función para obtener el estado del sistema
 async function fetchSystemStatus() {
@@ -44,13 +47,18 @@ function stopStatusPolling() {
   }
 }
 
-export function connectWebSocket() {
+export async function connectWebSocket() {
   if (ws && ws.readyState === WebSocket.OPEN) {
     console.log('WebSocket already connected.');
     return;
   }
 
-  ws = new WebSocket(WS_URL);
+  // El handshake exige rol admin; el navegador no permite headers, el token va en la URL
+  const token = await accessToken();
+  if (!token) return;
+
+  const replay = replayReceived ? '&replay=0' : '';
+  ws = new WebSocket(`${WS_URL}?access_token=${encodeURIComponent(token)}${replay}`);
 
   ws.onopen = () => {
     console.log('✅ WebSocket conectado al backend');
@@ -60,6 +68,7 @@ export function connectWebSocket() {
       message: 'Dashboard conectado al servidor de debug',
     });
     reconnectAttempts = 0;
+    replayReceived = true;
     stopMockData(); // Detener datos de prueba si se conecta
     startStatusPolling(); // Iniciar polling de status
   };
@@ -95,9 +104,10 @@ export function connectWebSocket() {
     apiStatusStore.graphhopper.status = 'offline';
     apiStatusStore.database.status = 'offline';
     
-    // Intentar reconectar cada 3 segundos
+    // Intentar reconectar cada 3 segundos (mientras haya sesión)
     reconnectAttempts++;
     setTimeout(() => {
+      if (!authStore.session) return;
       if (reconnectAttempts < 10) { // Máximo 10 intentos
         connectWebSocket();
       } else {
@@ -147,6 +157,18 @@ function handleWebSocketMessage(data: any) {
       scrapingStatusStore.redCL = data.status.redCL;
       break;
 
+    case 'subscribed':
+      console.log(`📼 Suscripción activa, ${data.replayed} mensajes del historial`, data.subscription);
+      break;
+
+    case 'dropped':
+      addLog({
+        source: 'frontend',
+        level: 'warn',
+        message: `El servidor descartó ${data.count} mensajes: el dashboard no los alcanzó a recibir`,
+      });
+      break;
+
     default:
       console.warn('Unknown message type:', data.type);
   }
@@ -161,6 +183,13 @@ export function sendCommand(command: string, params?: any) {
   }
 }
 
+// Cambia el filtro del servidor (arrays vacíos = todo) y pide reenviar hasta `replay` mensajes del historial
+export function subscribe(filter: { types?: string[]; sources?: string[]; levels?: string[] }, replay = 0) {
+  if (ws && ws.readyState === WebSocket.OPEN) {
+    ws.send(JSON.stringify({ type: 'subscribe', ...filter, replay }));
+  }
+}
+
 // Mock data para desarrollo cuando el backend no está disponible
 function startMockData() {
   if (mockDataInterval) return;
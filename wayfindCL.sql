@@ -245,6 +245,7 @@ CREATE TABLE IF NOT EXISTS `users` (
   `device_info` varchar(255) DEFAULT NULL COMMENT 'Información del dispositivo para usuarios biométricos',
   `created_at` timestamp NOT NULL DEFAULT current_timestamp(),
   `last_login` timestamp NULL DEFAULT NULL COMMENT 'Último inicio de sesión del usuario',
+  `disabled_at` datetime DEFAULT NULL COMMENT 'Cuenta deshabilitada por un administrador',
   PRIMARY KEY (`id`),
   UNIQUE KEY `username` (`username`),
   UNIQUE KEY `email` (`email`),